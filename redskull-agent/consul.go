@@ -3,11 +3,11 @@ package main
 import (
 	"errors"
 	"fmt"
-	"log"
 	"math/rand"
 	"time"
 
 	consul "github.com/hashicorp/consul/api"
+	"github.com/therealbill/redskull/redskull-shared/logging"
 )
 
 var (
@@ -106,7 +106,7 @@ func (s *RemoteService) GetEntries() (entries []string, err error) {
 	if err != nil {
 		return
 	}
-	log.Printf("found %d %q services", len(s.services), s.Name)
+	logging.Debugf("found %d %q services", len(s.services), s.Name)
 	for _, e := range s.services {
 		entries = append(entries, fmt.Sprintf("%s:%d", e.Node.Address, e.Service.Port))
 	}
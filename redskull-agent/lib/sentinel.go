@@ -4,10 +4,11 @@ import (
 	"bufio"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"strconv"
 	"strings"
+
+	"github.com/therealbill/redskull/redskull-shared/logging"
 )
 
 const GCPORT = "8008"
@@ -87,7 +88,7 @@ func (c *Constellation) extractSentinelDirective(entries []string) error {
 		if !exists {
 			c.SentinelConfig.ManagedPodConfigs[entries[1]] = spc
 		}
-		log.Printf("read pod config: %+v", spc)
+		logging.Debugf("read pod config: %+v", spc)
 		return nil
 
 	case "auth-pass":
@@ -110,7 +111,7 @@ func (c *Constellation) extractSentinelDirective(entries []string) error {
 
 	default:
 		err := fmt.Errorf("Unhandled sentinel directive: %+v", entries)
-		log.Print(err)
+		logging.Errorf("%s", err)
 		return nil
 	}
 }
@@ -120,7 +121,7 @@ func (c *Constellation) extractSentinelDirective(entries []string) error {
 func (c *Constellation) LoadSentinelConfigFile() error {
 	file, err := os.Open(c.SentinelConfigName)
 	if err != nil {
-		log.Print(err)
+		logging.Errorf("%s", err)
 		return err
 	}
 	defer file.Close()
@@ -141,7 +142,7 @@ func (c *Constellation) LoadSentinelConfigFile() error {
 				if err != nil {
 					// TODO: Fix this to return a different error if we can't
 					// connect to the sentinel
-					log.Printf("Misshapen sentinel directive: '%s'", line)
+					logging.Warnf("Misshapen sentinel directive: '%s'", line)
 				}
 			case "port":
 				iport, _ := strconv.Atoi(entries[1])
@@ -150,10 +151,10 @@ func (c *Constellation) LoadSentinelConfigFile() error {
 			case "dir":
 				c.SentinelConfig.Dir = entries[1]
 			case "bind":
-				log.Printf("Local sentinel is listening on IP %s", c.SentinelConfig.Host)
+				logging.Debugf("Local sentinel is listening on IP %s", c.SentinelConfig.Host)
 			case "":
 				if err == io.EOF {
-					log.Print("File load complete?")
+					logging.Debugf("File load complete?")
 					if c.Name == "" {
 						c.Name = fmt.Sprintf("%s:%d", c.SentinelConfig.Host, c.SentinelConfig.Port)
 					}
@@ -163,11 +164,11 @@ func (c *Constellation) LoadSentinelConfigFile() error {
 				//log.Printf("Found %d REMOTE sentinels", len(c.RemoteSentinels))
 				//return nil
 			default:
-				log.Printf("UNhandled Sentinel Directive: %s", line)
+				logging.Warnf("UNhandled Sentinel Directive: %s", line)
 			}
 		} else {
-			log.Print("=============== LOAD FILE ERROR ===============")
-			log.Fatal(err)
+			logging.Errorf("Unable to load sentinel config file")
+			logging.Fatalf("%s", err)
 		}
 	}
 }
@@ -180,7 +181,7 @@ func GetAddressPair(astring string) (host string, port int, err error) {
 	host = apair[0]
 	port, err = strconv.Atoi(apair[1])
 	if err != nil {
-		log.Printf("Unable to convert %s to port integer!", apair[1])
+		logging.Errorf("Unable to convert %s to port integer!", apair[1])
 	}
 	return
 }
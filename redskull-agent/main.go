@@ -1,10 +1,13 @@
 package main
 
 import (
-	"log"
+	"fmt"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/therealbill/redskull/redskull-shared/auth"
+	"github.com/therealbill/redskull/redskull-shared/logging"
 	"github.com/urfave/cli"
 )
 
@@ -31,7 +34,7 @@ func RefreshData() {
 	//if err != nil {
 	//log.Fatal("Unable to connect to constellation")
 	//}
-	log.Printf("TODO: Refreshing routine needs rebuilt")
+	logging.Infof("TODO: Refreshing routine needs rebuilt")
 }
 
 type LaunchConfig struct {
@@ -65,7 +68,59 @@ func main() {
 			Value:  "localhost:8500",
 			EnvVar: "REDSKULL_CELL",
 		},
+		cli.StringFlag{
+			Name:   "loglevel",
+			Usage:  "Log level: debug, info, warn or error",
+			Value:  "info",
+			EnvVar: "REDSKULL_LOGLEVEL",
+		},
+		cli.StringFlag{
+			Name:   "logformat",
+			Usage:  "Log format: text or json",
+			Value:  "text",
+			EnvVar: "REDSKULL_LOGFORMAT",
+		},
+		cli.IntFlag{
+			Name:   "jsonrpc-port",
+			Usage:  "Port to also serve the RPC methods on as JSON-RPC 2.0 over HTTP; 0 disables it",
+			EnvVar: "REDSKULL_JSONRPCPORT",
+		},
+		cli.StringFlag{
+			Name:   "tls-cert",
+			Usage:  "Certificate file the RPC port presents; enables TLS",
+			EnvVar: "REDSKULL_RPCTLSCERT",
+		},
+		cli.StringFlag{
+			Name:   "tls-key",
+			Usage:  "Key file for --tls-cert",
+			EnvVar: "REDSKULL_RPCTLSKEY",
+		},
+		cli.StringFlag{
+			Name:   "tls-client-ca",
+			Usage:  "CA file client certificates are verified against",
+			EnvVar: "REDSKULL_RPCTLSCLIENTCA",
+		},
+		cli.BoolFlag{
+			Name:   "require-client-cert",
+			Usage:  "Refuse RPC clients without a certificate signed by --tls-client-ca",
+			EnvVar: "REDSKULL_RPCREQUIRECLIENTCERT",
+		},
+		cli.StringFlag{
+			Name:   "token-file",
+			Usage:  "File of RPC tokens, one per line as TOKEN ROLE NAME",
+			EnvVar: "REDSKULL_RPCTOKENFILE",
+		},
+		cli.StringSliceFlag{
+			Name:  "cert-role",
+			Usage: "Role for a client certificate common name, as NAME:ROLE; may be repeated",
+		},
+		cli.StringFlag{
+			Name:   "cert-default-role",
+			Usage:  "Role for verified client certificates not given a --cert-role",
+			EnvVar: "REDSKULL_RPCCERTDEFAULTROLE",
+		},
 	}
+	app.Before = setupLogging
 	// TODO: add commands to be used by the local sentinel event handler, and
 	// add self to config for each pod on the sentinel
 	app.Commands = []cli.Command{
@@ -78,12 +133,74 @@ func main() {
 	app.Run(os.Args)
 
 }
+
+// setupLogging applies the log level and format flags
+func setupLogging(c *cli.Context) error {
+	level, err := logging.ParseLevel(c.String("loglevel"))
+	if err != nil {
+		return err
+	}
+	logging.SetLevel(level)
+	err = logging.SetFormat(c.String("logformat"))
+	if err != nil {
+		return err
+	}
+	logging.CaptureStandardLog()
+	return nil
+}
+
 func runRPCServer(c *cli.Context) error {
 	cell := c.String("cellname")
 	if cell == "" {
 		cell = "cell0"
 	}
+	server, err := rpcSecurity(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
 	agent = NewRedAgentService(cell)
+	agent.RPCServer = server
+	agent.JSONRPCPort = c.GlobalInt("jsonrpc-port")
 	agent.ServeRPC()
 	return nil
 }
+
+// rpcSecurity configures TLS and authentication for the RPC port from the
+// flags
+func rpcSecurity(c *cli.Context) (*auth.RPCServer, error) {
+	server := &auth.RPCServer{}
+	if c.GlobalString("tls-cert") > "" {
+		tlsConfig, err := auth.ServerTLSConfig(c.GlobalString("tls-cert"), c.GlobalString("tls-key"), c.GlobalString("tls-client-ca"), c.GlobalBool("require-client-cert"))
+		if err != nil {
+			return nil, err
+		}
+		server.TLS = tlsConfig
+	}
+	if c.GlobalString("token-file") > "" {
+		tokens, err := auth.NewTokenAuthenticator(c.GlobalString("token-file"))
+		if err != nil {
+			return nil, err
+		}
+		server.Tokens = tokens
+	}
+	names := make(map[string]string)
+	for _, pair := range c.GlobalStringSlice("cert-role") {
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("--cert-role '%s' must be NAME:ROLE", pair)
+		}
+		names[parts[0]] = parts[1]
+	}
+	roles, err := auth.ParseRoles(names)
+	if err != nil {
+		return nil, err
+	}
+	server.CertRoles = roles
+	if c.GlobalString("cert-default-role") > "" {
+		server.CertDefaultRole, err = auth.ParseRole(c.GlobalString("cert-default-role"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return server, nil
+}
@@ -1,10 +1,15 @@
 package rsclient
 
 import (
-	"log"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
 	"net"
 	"net/rpc"
 	"time"
+
+	"github.com/therealbill/redskull/redskull-shared/logging"
 )
 
 type Client struct {
@@ -21,13 +26,79 @@ type NewPodRequest struct {
 	Auth   string
 }
 
+// LoginMethod authenticates the connection with a token. It is answered by
+// the server's RPC layer, not a service.
+const LoginMethod = "Auth.Login"
+
+// Options configure how a client connects and authenticates
+type Options struct {
+	// Timeout bounds dialing, the TLS handshake and the login
+	Timeout time.Duration
+	// TLS, if set, connects over TLS. Include a client certificate to
+	// authenticate with it.
+	TLS *tls.Config
+	// Token, if set, is presented to the server right after connecting
+	Token string
+}
+
 // NewClient returns a client connection
 func NewClient(dsn string, timeout time.Duration) (*Client, error) {
-	connection, err := net.DialTimeout("tcp", dsn, timeout)
+	return NewClientWithOptions(dsn, Options{Timeout: timeout})
+}
+
+// NewClientWithOptions returns a client connection using TLS and token
+// authentication as configured in opts
+func NewClientWithOptions(dsn string, opts Options) (*Client, error) {
+	dialer := &net.Dialer{Timeout: opts.Timeout}
+	var connection net.Conn
+	var err error
+	if opts.TLS != nil {
+		connection, err = tls.DialWithDialer(dialer, "tcp", dsn, opts.TLS)
+	} else {
+		connection, err = dialer.Dial("tcp", dsn)
+	}
 	if err != nil {
 		return nil, err
 	}
-	return &Client{connection: rpc.NewClient(connection)}, nil
+	c := &Client{connection: rpc.NewClient(connection)}
+	if opts.Token > "" {
+		var identity string
+		if opts.Timeout > 0 {
+			connection.SetDeadline(time.Now().Add(opts.Timeout))
+		}
+		err = c.connection.Call(LoginMethod, opts.Token, &identity)
+		connection.SetDeadline(time.Time{})
+		if err != nil {
+			c.connection.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// TLSConfig returns a TLS configuration trusting the CA in caFile, or the
+// system roots if it is empty, and presenting the client certificate in
+// certFile and keyFile if they are set
+func TLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile > "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in '%s'", caFile)
+		}
+	}
+	if certFile > "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
 }
 
 // GetPodAuth(podname) will return the lib.RedisPod type for the given pod, if
@@ -36,7 +107,53 @@ func (c *Client) GetPodAuth(podname string) (string, error) {
 	var token string
 	err := c.connection.Call("RPC.GetPodAuth", podname, &token)
 	if err != nil {
-		log.Print(err)
+		logging.Errorf("%s", err)
 	}
 	return token, err
 }
+
+// EnableMaintenance puts the agent's Consul service into maintenance mode
+// with the given reason
+func (c *Client) EnableMaintenance(reason string) error {
+	var ok bool
+	err := c.connection.Call("RPC.EnableMaintenance", reason, &ok)
+	if err != nil {
+		logging.Errorf("%s", err)
+	}
+	return err
+}
+
+// DisableMaintenance takes the agent's Consul service out of maintenance mode
+func (c *Client) DisableMaintenance() error {
+	var ok bool
+	err := c.connection.Call("RPC.DisableMaintenance", true, &ok)
+	if err != nil {
+		logging.Errorf("%s", err)
+	}
+	return err
+}
+
+// GetLogLevel returns the agent's log level
+func (c *Client) GetLogLevel() (string, error) {
+	var level string
+	err := c.connection.Call("RPC.GetLogLevel", true, &level)
+	if err != nil {
+		logging.Errorf("%s", err)
+	}
+	return level, err
+}
+
+// SetLogLevel changes the agent's log level to debug, info, warn or error
+func (c *Client) SetLogLevel(level string) error {
+	var set string
+	err := c.connection.Call("RPC.SetLogLevel", level, &set)
+	if err != nil {
+		logging.Errorf("%s", err)
+	}
+	return err
+}
+
+// Close closes the connection to the agent
+func (c *Client) Close() error {
+	return c.connection.Close()
+}
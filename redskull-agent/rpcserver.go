@@ -3,8 +3,6 @@ package main
 import (
 	"errors"
 	"fmt"
-	"log"
-	"net"
 	"net/rpc"
 	"os"
 	"os/signal"
@@ -15,6 +13,9 @@ import (
 
 	consul "github.com/hashicorp/consul/api"
 	lib "github.com/therealbill/redskull/redskull-agent/lib"
+	"github.com/therealbill/redskull/redskull-shared/auth"
+	"github.com/therealbill/redskull/redskull-shared/jsonrpc"
+	"github.com/therealbill/redskull/redskull-shared/logging"
 )
 
 type RedAgentService struct {
@@ -31,6 +32,8 @@ type RedAgentService struct {
 	Multi         bool
 	ID            string
 	RPC           *RPC
+	RPCServer     *auth.RPCServer
+	JSONRPCPort   int
 }
 
 // SECTION: CONSUL
@@ -41,10 +44,10 @@ func (s *RedAgentService) ConsulConnect() error {
 	cc.Address = s.ConsulAddress
 	s.client, err = consul.NewClient(cc)
 	if err != nil {
-		log.Print("unable to open consul")
+		logging.Errorf("unable to open consul")
 		return err
 	}
-	log.Print("connected to consul")
+	logging.Infof("connected to consul")
 	return nil
 }
 
@@ -84,10 +87,10 @@ func (s *RedAgentService) SetValue(k, v string) error {
 	mkey := s.Confbase + k
 	key := strings.TrimPrefix(mkey, "/")
 	kp := consul.KVPair{Key: key, Value: []byte(v)}
-	log.Printf("kp: %+v", kp)
+	logging.Debugf("kp: %+v", kp)
 	kv := s.client.KV()
 	wm, err := kv.Put(&kp, nil)
-	log.Printf("Put got '%+v'", wm)
+	logging.Debugf("Put got '%+v'", wm)
 	return err
 }
 
@@ -110,7 +113,7 @@ func (s *RedAgentService) GetString(k string, bail bool) (string, error) {
 	pair, _, err := kv.Get(kurl, nil)
 	if err != nil {
 		if bail {
-			log.Fatal(errors.New("unable to communicate with backing store"))
+			logging.Fatalf("Unable to communicate with backing store")
 		}
 		return "", err
 	}
@@ -129,7 +132,7 @@ func (s *RedAgentService) GetInteger(k string, bail bool) (int, error) {
 	pair, _, err := kv.Get(kurl, nil)
 	if err != nil {
 		if bail {
-			log.Fatal(errors.New("unable to communicate with backing store"))
+			logging.Fatalf("Unable to communicate with backing store")
 		}
 		return 0, err
 	}
@@ -156,14 +159,14 @@ func (s *RedAgentService) RegisterService() error {
 		Address: myaddr,
 		Tags:    []string{s.CellName},
 	}
-	log.Printf("asr: %+v", asr)
+	logging.Debugf("asr: %+v", asr)
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-signals
-		log.Printf("Deregistering service %s", s.ID)
+		logging.Infof("Deregistering service %s", s.ID)
 		agent.ServiceDeregister(s.ID)
-		log.Printf("Deregistered service %s", s.ID)
+		logging.Infof("Deregistered service %s", s.ID)
 		os.Exit(0)
 	}()
 	return agent.ServiceRegister(asr)
@@ -177,7 +180,7 @@ func (s *RedAgentService) RegisterService() error {
 // services on the host. Frankly, given how rare that should be, I don't think
 // it is worth the added effort.
 func (s *RedAgentService) EnableMaintenance(r string) error {
-	log.Printf("Enabling maintenance on %q", s.Name)
+	logging.Infof("Enabling maintenance on %q", s.Name)
 	s.ConsulConnect()
 	return s.client.Agent().EnableServiceMaintenance(s.Name, r)
 }
@@ -185,19 +188,41 @@ func (s *RedAgentService) EnableMaintenance(r string) error {
 // DisableMaintenance takes a string as the reason and switches on Consul's maintenance mode for the service
 func (s *RedAgentService) DisableMaintenance() error {
 	s.ConsulConnect()
-	log.Printf("Disabling maintenance on %q", s.Name)
+	logging.Infof("Disabling maintenance on %q", s.Name)
 	return s.client.Agent().DisableServiceMaintenance(s.Name)
 }
 
-// ServeRPC is used to start serving the RPC interface using config pulled from Consul
+// rpcPolicy is the role needed for each agent RPC method. GetPodAuth hands
+// out pod passwords so it is left at admin.
+var rpcPolicy = auth.RPCPolicy{
+	"RPC.EnableMaintenance":  auth.Operator,
+	"RPC.DisableMaintenance": auth.Operator,
+}
+
+// ServeRPC is used to start serving the RPC interface using config pulled
+// from Consul. TLS and authentication are taken from s.RPCServer, if set,
+// and JSON-RPC is also served if s.JSONRPCPort is set.
 func (s *RedAgentService) ServeRPC() {
-	rpc.Register(s.RPC)
+	server := s.RPCServer
+	if server == nil {
+		server = &auth.RPCServer{}
+	}
+	server.Server = rpc.NewServer()
+	server.Policy = rpcPolicy
+	server.Server.Register(s.RPC)
+	if s.JSONRPCPort > 0 {
+		go func() {
+			err := jsonrpc.ListenAndServe(fmt.Sprintf("%s:%d", s.Address, s.JSONRPCPort), server)
+			if err != nil {
+				logging.Fatalf("JSON-RPC listen error:%s", err)
+			}
+		}()
+	}
 	rpc_on := fmt.Sprintf("%s:%d", s.Address, s.Port)
-	l, e := net.Listen("tcp", rpc_on)
+	e := server.ListenAndServe(rpc_on)
 	if e != nil {
-		log.Fatal("listen error:", e)
+		logging.Fatalf("listen error:%s", e)
 	}
-	rpc.Accept(l)
 }
 
 func NewRedAgentService(cell string) RedAgentService {
@@ -208,21 +233,22 @@ func NewRedAgentService(cell string) RedAgentService {
 		ConsulAddress: "localhost:8500",
 		CellName:      cell,
 	}
-	log.Printf("sc: %+v", sc)
+	logging.Debugf("sc: %+v", sc)
 	sc.ConsulConnect()
 	sc.Port, _ = sc.GetInteger("config/rpcport", true)
 	sc.Address = sc.GetLocalAddress()
 	conf, err := sc.GetString("config/sentinelconfig", true)
 	if err != nil {
-		log.Printf("Err: %v", err)
+		logging.Errorf("Err: %v", err)
 	}
 	sc.RPC = NewRPC(sc.Address, conf, cell, sc.Address)
+	sc.RPC.service = &sc
 	pods, err := sc.RPC.GetPods()
 	for n, c := range pods {
-		log.Printf("Need to register pod %v (%+v)", n, c)
+		logging.Infof("Need to register pod %v (%+v)", n, c)
 		err = sc.RegisterPod(n, c.IP, c.Port)
 		if err != nil {
-			log.Printf("unable to register pod. Error was %v", err)
+			logging.Errorf("unable to register pod. Error was %v", err)
 		}
 	}
 	sc.RegisterService()
@@ -239,6 +265,7 @@ type Item struct {
 type RPC struct {
 	constellation *lib.Constellation
 	mu            *sync.RWMutex
+	service       *RedAgentService
 }
 
 func badContextError(err error) {
@@ -248,7 +275,7 @@ func badContextError(err error) {
 }
 
 func (r *RPC) GetPodAuth(podname string, resp *string) (err error) {
-	log.Printf("mpc: %+v", r.constellation.SentinelConfig.ManagedPodConfigs)
+	logging.Debugf("mpc: %+v", r.constellation.SentinelConfig.ManagedPodConfigs)
 	pod, exists := r.constellation.SentinelConfig.ManagedPodConfigs[podname]
 	if !exists {
 		err = errors.New("Pod Not found")
@@ -258,6 +285,46 @@ func (r *RPC) GetPodAuth(podname string, resp *string) (err error) {
 	return err
 }
 
+// EnableMaintenance switches on Consul's maintenance mode for the agent's
+// service with the given reason
+func (r *RPC) EnableMaintenance(reason string, resp *bool) error {
+	if r.service == nil {
+		return errors.New("Agent service is not initialized")
+	}
+	err := r.service.EnableMaintenance(reason)
+	*resp = err == nil
+	return err
+}
+
+// DisableMaintenance switches off Consul's maintenance mode for the agent's
+// service
+func (r *RPC) DisableMaintenance(unused bool, resp *bool) error {
+	if r.service == nil {
+		return errors.New("Agent service is not initialized")
+	}
+	err := r.service.DisableMaintenance()
+	*resp = err == nil
+	return err
+}
+
+// GetLogLevel returns the agent's current log level
+func (r *RPC) GetLogLevel(unused bool, resp *string) error {
+	*resp = logging.GetLevel().String()
+	return nil
+}
+
+// SetLogLevel changes the agent's log level until it is restarted
+func (r *RPC) SetLogLevel(level string, resp *string) error {
+	l, err := logging.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	logging.SetLevel(l)
+	logging.Infof("Log level set to %s", l)
+	*resp = l.String()
+	return nil
+}
+
 func (r *RPC) GetPods() (map[string]lib.SentinelPodConfig, error) {
 	return r.constellation.SentinelConfig.ManagedPodConfigs, nil
 }
@@ -265,7 +332,7 @@ func (r *RPC) GetPods() (map[string]lib.SentinelPodConfig, error) {
 func NewRPC(name, config, cell, addr string) *RPC {
 	con, err := lib.GetConstellation(name, config, cell, addr)
 	if err != nil {
-		log.Fatal(err)
+		logging.Fatalf("%s", err)
 	}
 	return &RPC{
 		constellation: &con,
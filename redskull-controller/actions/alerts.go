@@ -0,0 +1,699 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-controller/events"
+	"github.com/therealbill/redskull/redskull-shared/logging"
+)
+
+// AlertInterval is how often the alert rules are evaluated. Zero disables
+// the alert engine.
+var AlertInterval = 30 * time.Second
+
+// AlertRuleFile is the YAML or JSON file the alert rules are loaded, and
+// reloaded, from. Empty means there are no rules.
+var AlertRuleFile string
+
+// DefaultAlertNotifiers are the notifiers told of alerts whose rule names
+// none
+var DefaultAlertNotifiers = []string{"events"}
+
+// AlertNotifier is told of an alert when it starts firing and again when it
+// resolves. Notify is called from the evaluation loop, so a notifier which
+// may be slow should hand the alert off rather than deliver it in place.
+type AlertNotifier interface {
+	Notify(ctx context.Context, alert common.Alert) error
+}
+
+// AlertNotifierFunc lets an ordinary function be used as an AlertNotifier
+type AlertNotifierFunc func(ctx context.Context, alert common.Alert) error
+
+// Notify calls f
+func (f AlertNotifierFunc) Notify(ctx context.Context, alert common.Alert) error {
+	return f(ctx, alert)
+}
+
+// alertNotifiers holds the registered notifiers by name. The events
+// notifier is always there.
+var alertNotifiers = struct {
+	sync.RWMutex
+	m map[string]AlertNotifier
+}{m: map[string]AlertNotifier{"events": AlertNotifierFunc(publishAlert)}}
+
+// RegisterAlertNotifier makes a notifier available to rules under name,
+// replacing any already registered under it. Notifiers must be registered
+// before rules naming them are loaded.
+func RegisterAlertNotifier(name string, n AlertNotifier) {
+	alertNotifiers.Lock()
+	alertNotifiers.m[name] = n
+	alertNotifiers.Unlock()
+}
+
+func alertNotifier(name string) (AlertNotifier, bool) {
+	alertNotifiers.RLock()
+	defer alertNotifiers.RUnlock()
+	n, ok := alertNotifiers.m[name]
+	return n, ok
+}
+
+// publishAlert is the events notifier. It publishes an alert.firing or
+// alert.resolved event, which reaches webhooks and the event stream.
+func publishAlert(ctx context.Context, a common.Alert) error {
+	e := common.Event{
+		Type:     common.EventAlertFiring,
+		Severity: a.Severity,
+		Pod:      a.Pod,
+		Message:  a.Message,
+		Data: map[string]string{
+			"rule":   a.Rule,
+			"metric": a.Metric,
+			"target": a.Target,
+			"value":  common.FormatMetric(a.Value),
+		},
+	}
+	if a.Metric == common.MetricSentinelUnreachable {
+		e.Sentinel = a.Target
+	}
+	if a.State == common.AlertResolved {
+		e.Type = common.EventAlertResolved
+		e.Severity = common.SeverityInfo
+		e.Message = fmt.Sprintf("Resolved after %s: %s", a.ResolvedAt.Sub(a.FiredAt).Round(time.Second), a.Message)
+	}
+	events.Publish(e)
+	return nil
+}
+
+// AlertConfig is the alert rule file
+type AlertConfig struct {
+	Rules []common.AlertRule `json:"rules" yaml:"rules"`
+}
+
+// LoadAlertConfig reads and validates a YAML or JSON alert rule file. Rule
+// names must be unique and every notifier named must be registered.
+func LoadAlertConfig(file string) (cfg AlertConfig, err error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return cfg, err
+	}
+	err = common.ParseConfig(data, &cfg)
+	if err != nil {
+		return cfg, fmt.Errorf("Unable to parse alert rules: %s", err)
+	}
+	names := make(map[string]bool)
+	for i, rule := range cfg.Rules {
+		if err := rule.Validate(); err != nil {
+			return cfg, fmt.Errorf("Alert rule %d: %s", i+1, err)
+		}
+		if names[rule.Name] {
+			return cfg, fmt.Errorf("Alert rule %d: name '%s' is used by an earlier rule", i+1, rule.Name)
+		}
+		names[rule.Name] = true
+		for _, name := range rule.Notify {
+			if _, ok := alertNotifier(name); !ok {
+				return cfg, fmt.Errorf("Alert rule '%s': no notifier called '%s'", rule.Name, name)
+			}
+		}
+		if rule.Severity == "" {
+			cfg.Rules[i].Severity = common.SeverityWarning
+		}
+	}
+	return cfg, nil
+}
+
+// alertNotice is an alert to tell the rule's notifiers of
+type alertNotice struct {
+	alert  common.Alert
+	notify []string
+}
+
+// AlertEngine holds the alert rules and the alerts they raised, along with
+// the silences, which are persisted as JSON in the data directory. Alerts
+// are only held in memory, so ones still firing when RedSkull restarts are
+// notified again.
+type AlertEngine struct {
+	sync.RWMutex
+	saving   sync.Mutex
+	path     string
+	rules    []common.AlertRule
+	alerts   map[string]*common.Alert
+	silences []common.Silence
+}
+
+// NewAlertEngine creates an engine with no rules, loading any silences
+// already persisted at path
+func NewAlertEngine(path string) (*AlertEngine, error) {
+	ae := &AlertEngine{path: path, alerts: make(map[string]*common.Alert)}
+	if path == "" {
+		return ae, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ae, nil
+	}
+	if err != nil {
+		return ae, err
+	}
+	err = json.Unmarshal(data, &ae.silences)
+	return ae, err
+}
+
+// Rules returns the rules being evaluated, in file order
+func (ae *AlertEngine) Rules() []common.AlertRule {
+	ae.RLock()
+	defer ae.RUnlock()
+	return append([]common.AlertRule{}, ae.rules...)
+}
+
+// SetRules replaces the rules. Alerts of rules still present by name keep
+// their state; those of rules no longer present resolve, and the ones
+// notifiers were told of are returned.
+func (ae *AlertEngine) SetRules(rules []common.AlertRule, now time.Time) []alertNotice {
+	ae.Lock()
+	defer ae.Unlock()
+	old := make(map[string]common.AlertRule)
+	for _, rule := range ae.rules {
+		old[rule.Name] = rule
+	}
+	ae.rules = append([]common.AlertRule(nil), rules...)
+	kept := make(map[string]bool)
+	for _, rule := range rules {
+		kept[rule.Name] = true
+	}
+	var notices []alertNotice
+	for _, key := range sortedAlertKeys(ae.alerts) {
+		a := ae.alerts[key]
+		if kept[a.Rule] {
+			continue
+		}
+		delete(ae.alerts, key)
+		if a.Notified {
+			a.State = common.AlertResolved
+			a.ResolvedAt = now
+			notices = append(notices, alertNotice{alert: *a, notify: old[a.Rule].Notify})
+		}
+	}
+	return notices
+}
+
+// Alerts returns the pending and firing alerts, firing first, then by
+// severity, most severe first, and then oldest first
+func (ae *AlertEngine) Alerts() []common.Alert {
+	ae.RLock()
+	alerts := make([]common.Alert, 0, len(ae.alerts))
+	for _, a := range ae.alerts {
+		alerts = append(alerts, *a)
+	}
+	ae.RUnlock()
+	sort.Slice(alerts, func(i, j int) bool {
+		a, b := alerts[i], alerts[j]
+		if a.State != b.State {
+			return a.State == common.AlertFiring
+		}
+		if ra, rb := common.SeverityRank(a.Severity), common.SeverityRank(b.Severity); ra != rb {
+			return ra > rb
+		}
+		if !a.Since.Equal(b.Since) {
+			return a.Since.Before(b.Since)
+		}
+		return alertKey(a.Rule, a.Target) < alertKey(b.Rule, b.Target)
+	})
+	return alerts
+}
+
+// Silences returns the silences which have not expired at now, soonest to
+// expire first
+func (ae *AlertEngine) Silences(now time.Time) []common.Silence {
+	ae.RLock()
+	defer ae.RUnlock()
+	silences := []common.Silence{}
+	for _, s := range ae.silences {
+		if s.Active(now) {
+			silences = append(silences, s)
+		}
+	}
+	sort.SliceStable(silences, func(i, j int) bool { return silences[i].Expires.Before(silences[j].Expires) })
+	return silences
+}
+
+// AddSilence stores the silence under a new ID, dropping any which have
+// expired, and returns it
+func (ae *AlertEngine) AddSilence(s common.Silence) (common.Silence, error) {
+	s.ID = newJobID()
+	ae.Lock()
+	now := time.Now()
+	var silences []common.Silence
+	for _, existing := range ae.silences {
+		if existing.Active(now) {
+			silences = append(silences, existing)
+		}
+	}
+	ae.silences = append(silences, s)
+	ae.resilence(now)
+	ae.Unlock()
+	return s, ae.save()
+}
+
+// ExpireSilence removes the silence with the given ID, returning false if
+// there is none. Firing alerts it kept quiet are notified at the next
+// evaluation.
+func (ae *AlertEngine) ExpireSilence(id string) (bool, error) {
+	ae.Lock()
+	found := false
+	for i, s := range ae.silences {
+		if s.ID == id {
+			ae.silences = append(ae.silences[:i:i], ae.silences[i+1:]...)
+			found = true
+			break
+		}
+	}
+	ae.resilence(time.Now())
+	ae.Unlock()
+	if !found {
+		return false, nil
+	}
+	return true, ae.save()
+}
+
+// resilence updates whether each alert is silenced. The caller holds the
+// lock.
+func (ae *AlertEngine) resilence(now time.Time) {
+	for _, a := range ae.alerts {
+		a.Silenced = ae.silenced(*a, now)
+	}
+}
+
+// silenced returns true if an active silence matches the alert. The caller
+// holds the lock.
+func (ae *AlertEngine) silenced(a common.Alert, now time.Time) bool {
+	for _, s := range ae.silences {
+		if s.Active(now) && s.Matches(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluate applies the rules to the samples read at now. A rule's alert for
+// a target goes pending when its condition first holds and fires once it
+// has held for the rule's For duration. Notifiers are told once when it
+// starts firing, or when a silence keeping it quiet ends, and once when it
+// resolves if they were told it was firing. Alerts of pods in unread are
+// left as they were, as their samples are missing rather than fine.
+func (ae *AlertEngine) evaluate(samples []alertSample, unread map[string]bool, now time.Time) []alertNotice {
+	ae.Lock()
+	defer ae.Unlock()
+	var notices []alertNotice
+	seen := make(map[string]bool)
+	notify := make(map[string][]string)
+	for _, rule := range ae.rules {
+		notify[rule.Name] = rule.Notify
+		wait, _ := rule.ForDuration()
+		for _, s := range samples {
+			if s.metric != rule.Metric || !rule.Matches(s.pod, s.target) || !rule.Holds(s.value) {
+				continue
+			}
+			key := alertKey(rule.Name, s.target)
+			seen[key] = true
+			a, ok := ae.alerts[key]
+			if !ok {
+				a = &common.Alert{Rule: rule.Name, Metric: rule.Metric, Target: s.target, Pod: s.pod, State: common.AlertPending, Since: now}
+				ae.alerts[key] = a
+			}
+			a.Severity = rule.Severity
+			a.Value = s.value
+			a.Message = alertMessage(rule, s)
+			if a.State == common.AlertPending && now.Sub(a.Since) >= wait {
+				a.State = common.AlertFiring
+				a.FiredAt = now
+			}
+			a.Silenced = ae.silenced(*a, now)
+			if a.State == common.AlertFiring && !a.Notified && !a.Silenced {
+				a.Notified = true
+				notices = append(notices, alertNotice{alert: *a, notify: rule.Notify})
+			}
+		}
+	}
+	for _, key := range sortedAlertKeys(ae.alerts) {
+		a := ae.alerts[key]
+		if seen[key] || a.Pod != "" && unread[a.Pod] {
+			continue
+		}
+		delete(ae.alerts, key)
+		if a.Notified {
+			a.State = common.AlertResolved
+			a.ResolvedAt = now
+			notices = append(notices, alertNotice{alert: *a, notify: notify[a.Rule]})
+		}
+	}
+	return notices
+}
+
+// save writes the silences to the engine's path. Saves are made one at a
+// time, as they share the temporary file.
+func (ae *AlertEngine) save() error {
+	if ae.path == "" {
+		return nil
+	}
+	ae.saving.Lock()
+	defer ae.saving.Unlock()
+	ae.RLock()
+	data, err := json.MarshalIndent(ae.silences, "", "  ")
+	ae.RUnlock()
+	if err != nil {
+		return err
+	}
+	tmp := ae.path + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, ae.path)
+}
+
+func alertKey(rule, target string) string {
+	return rule + "/" + target
+}
+
+func sortedAlertKeys(m map[string]*common.Alert) (keys []string) {
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// alertMessage describes the rule's condition holding for the sample
+func alertMessage(rule common.AlertRule, s alertSample) string {
+	var subject string
+	switch {
+	case s.pod == "":
+		subject = fmt.Sprintf("Sentinel %s", s.target)
+	case s.target == s.pod:
+		subject = fmt.Sprintf("Pod '%s'", s.pod)
+	default:
+		subject = fmt.Sprintf("Node %s of pod '%s'", s.target, s.pod)
+	}
+	msg := fmt.Sprintf("%s %s is %s (%s)", subject, s.metric, common.FormatMetric(s.value), rule.Condition())
+	if s.detail != "" {
+		msg += ": " + s.detail
+	}
+	if rule.Summary != "" {
+		msg = rule.Summary + ": " + msg
+	}
+	return msg
+}
+
+// StartAlertEngine loads the alert silences from the data directory and the
+// rules from AlertRuleFile
+func (c *Constellation) StartAlertEngine() {
+	path := ""
+	if DataDirectory > "" {
+		path = filepath.Join(DataDirectory, "silences.json")
+	}
+	engine, err := NewAlertEngine(path)
+	if err != nil {
+		logging.Errorf("Unable to load alert silences, starting without: %s", err)
+	}
+	c.Alerts = engine
+	if AlertRuleFile == "" {
+		return
+	}
+	cfg, err := LoadAlertConfig(AlertRuleFile)
+	if err != nil {
+		logging.Errorf("Unable to load alert rules: %s", err)
+		return
+	}
+	engine.SetRules(cfg.Rules, time.Now())
+}
+
+// ReloadAlertRules loads the rules from AlertRuleFile again and returns how
+// many there are. A file which does not load leaves the rules as they were.
+func (c *Constellation) ReloadAlertRules(ctx context.Context) (int, error) {
+	if AlertRuleFile == "" {
+		return 0, errors.New("No alert rule file is configured")
+	}
+	if c.Alerts == nil {
+		c.StartAlertEngine()
+	}
+	cfg, err := LoadAlertConfig(AlertRuleFile)
+	if err != nil {
+		return 0, err
+	}
+	c.notifyAlerts(ctx, c.Alerts.SetRules(cfg.Rules, time.Now()))
+	logging.Op("alerts").Infof("Loaded %d alert rules from %s", len(cfg.Rules), AlertRuleFile)
+	return len(cfg.Rules), nil
+}
+
+// WatchAlerts evaluates the alert rules every AlertInterval until the
+// context ends
+func (c *Constellation) WatchAlerts(ctx context.Context) {
+	if AlertInterval <= 0 {
+		return
+	}
+	if c.Alerts == nil {
+		c.StartAlertEngine()
+	}
+	logging.Infof("Evaluating alert rules every %s", AlertInterval)
+	ticker := time.NewTicker(AlertInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		c.EvaluateAlerts(ctx)
+	}
+}
+
+// EvaluateAlerts reads the metrics the rules use, updates the alerts and
+// tells the notifiers of those which started firing or resolved. Each pod
+// is bounded by common.CallTimeout. Pods in maintenance are not read, so
+// their alerts resolve.
+func (c *Constellation) EvaluateAlerts(ctx context.Context) {
+	if c.Alerts == nil {
+		c.StartAlertEngine()
+	}
+	rules := c.Alerts.Rules()
+	if len(rules) == 0 {
+		return
+	}
+	metrics := make(map[string]bool)
+	for _, rule := range rules {
+		metrics[rule.Metric] = true
+	}
+	samples, unread := c.alertSamples(ctx, metrics)
+	if ctx.Err() != nil {
+		return
+	}
+	c.notifyAlerts(ctx, c.Alerts.evaluate(samples, unread, time.Now()))
+}
+
+// notifyAlerts tells each notice's notifiers, or the default ones, of its
+// alert
+func (c *Constellation) notifyAlerts(ctx context.Context, notices []alertNotice) {
+	for _, n := range notices {
+		a := n.alert
+		log := logging.Op("alerts").Pod(a.Pod)
+		if a.State == common.AlertResolved {
+			log.Infof("Alert %s on %s resolved", a.Rule, a.Target)
+		} else {
+			log.Warnf("Alert %s on %s firing: %s", a.Rule, a.Target, a.Message)
+		}
+		names := n.notify
+		if len(names) == 0 {
+			names = DefaultAlertNotifiers
+		}
+		for _, name := range names {
+			notifier, ok := alertNotifier(name)
+			if !ok {
+				log.Errorf("Alert %s names notifier '%s', which is not registered", a.Rule, name)
+				continue
+			}
+			if err := notifier.Notify(ctx, a); err != nil {
+				log.Errorf("Notifier '%s' failed on alert %s on %s: %s", name, a.Rule, a.Target, err)
+			}
+		}
+	}
+}
+
+// alertSample is one reading of a metric. Sentinel metrics have no pod.
+type alertSample struct {
+	metric string
+	pod    string
+	target string
+	value  float64
+	detail string
+}
+
+// alertSamples reads the given metrics across a snapshot of the
+// constellation, so the pods and sentinels are read without its lock. Pods
+// in maintenance are skipped; pods which could not be read are returned in
+// unread.
+func (c *Constellation) alertSamples(ctx context.Context, metrics map[string]bool) (samples []alertSample, unread map[string]bool) {
+	unread = make(map[string]bool)
+	readPods := metrics[common.MetricPromotableSlaves] || metrics[common.MetricPodErrors] ||
+		metrics[common.MetricNodeMemory] || metrics[common.MetricReplicaLag]
+	snap := c.Snapshot()
+	names := sortedPodNames(snap.PodMap)
+	for _, name := range names {
+		if c.InMaintenance(name) {
+			continue
+		}
+		if metrics[common.MetricPodUnavailable] {
+			samples = append(samples, c.unavailableSample(name))
+		}
+		if !readPods {
+			continue
+		}
+		poll, cancel := common.WithCallTimeout(ctx)
+		read, err := snap.podAlertSamples(poll, name, metrics)
+		if err == nil {
+			err = poll.Err()
+		}
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return samples, unread
+			}
+			logging.Op("alerts").Pod(name).Warnf("Unable to read pod '%s' for alerts: %s", name, err)
+			unread[name] = true
+			continue
+		}
+		samples = append(samples, read...)
+	}
+	if metrics[common.MetricSentinelUnreachable] {
+		samples = append(samples, snap.sentinelAlertSamples(ctx)...)
+	}
+	return samples, unread
+}
+
+// unavailableSample reads whether the failover history has the pod down
+func (c *Constellation) unavailableSample(podname string) alertSample {
+	s := alertSample{metric: common.MetricPodUnavailable, pod: podname, target: podname}
+	if c.History == nil {
+		return s
+	}
+	if h, ok := c.History.Get(podname); ok {
+		if down := h.Down(); down != nil {
+			s.value = 1
+			s.detail = down.Reason
+		}
+	}
+	return s
+}
+
+// podAlertSamples reads the pod and its nodes for the pod and node metrics.
+// Nodes with no maxmemory have no memory percentage to alert on, and lag is
+// only known for slaves connected to the master.
+func (c *Constellation) podAlertSamples(ctx context.Context, podname string, metrics map[string]bool) (samples []alertSample, err error) {
+	var pod *common.RedisPod
+	if metrics[common.MetricPodErrors] {
+		pod, err = c.podWithSentinelCount(ctx, podname)
+	} else {
+		pod, err = c.GetPod(ctx, podname)
+		if err == nil && (pod == nil || pod.Name == "") {
+			err = fmt.Errorf("Pod '%s' not found", podname)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	master := pod.Master
+	if master == nil || !master.LastUpdateValid {
+		return nil, fmt.Errorf("master of pod '%s' could not be read", podname)
+	}
+	sample := func(metric, target string, value float64, detail string) {
+		samples = append(samples, alertSample{metric: metric, pod: podname, target: target, value: value, detail: detail})
+	}
+	if metrics[common.MetricPodErrors] {
+		if pod.HasErrors(ctx) {
+			sample(common.MetricPodErrors, podname, 1, strings.Join(podErrorReasons(ctx, pod), ", "))
+		} else {
+			sample(common.MetricPodErrors, podname, 0, "")
+		}
+	}
+	if metrics[common.MetricNodeMemory] && master.MaxMemory > 0 {
+		sample(common.MetricNodeMemory, master.Name, master.PercentUsed, "")
+	}
+	promotable := 0
+	for _, slave := range master.Slaves {
+		if slave == nil {
+			continue
+		}
+		if _, err := slave.UpdateData(ctx); err != nil {
+			continue
+		}
+		if slave.Info.Replication.MasterLinkStatus == "up" && slave.IsPromotable() {
+			promotable++
+		}
+		if metrics[common.MetricNodeMemory] && slave.MaxMemory > 0 {
+			sample(common.MetricNodeMemory, slave.Name, slave.PercentUsed, "")
+		}
+	}
+	if metrics[common.MetricPromotableSlaves] {
+		sample(common.MetricPromotableSlaves, podname, float64(promotable), "")
+	}
+	if metrics[common.MetricReplicaLag] {
+		for _, s := range master.Info.Replication.Slaves {
+			sample(common.MetricReplicaLag, fmt.Sprintf("%s:%d", s.IP, s.Port), float64(s.Lag), "")
+		}
+	}
+	return samples, nil
+}
+
+// sentinelAlertSamples pings every known sentinel, including ones which
+// could not be connected to when they were added. Each ping is bounded by
+// common.CallTimeout. It is called on a snapshot.
+func (c *Constellation) sentinelAlertSamples(ctx context.Context) (samples []alertSample) {
+	pass, cancel := common.WithCallTimeout(ctx)
+	sentinels, _ := c.GetAllSentinels(pass)
+	known := make(map[string]*Sentinel)
+	for _, s := range sentinels {
+		known[s.Name] = s
+	}
+	for name, s := range c.BadSentinels {
+		if _, ok := known[name]; !ok {
+			known[name] = s
+		}
+	}
+	cancel()
+	var names []string
+	for name := range known {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s := alertSample{metric: common.MetricSentinelUnreachable, target: name}
+		ping, cancel := common.WithCallTimeout(ctx)
+		if err := pingSentinel(ping, known[name]); err != nil {
+			s.value = 1
+			s.detail = err.Error()
+		}
+		cancel()
+		samples = append(samples, s)
+	}
+	return samples
+}
+
+// pingSentinel returns an error unless the sentinel answers a PING
+func pingSentinel(ctx context.Context, s *Sentinel) error {
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.ClosePool()
+	return common.Do(ctx, conn.Ping)
+}
@@ -0,0 +1,196 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/therealbill/libredis/client"
+	"github.com/therealbill/libredis/structures"
+	"github.com/therealbill/redskull/redskull-controller/common"
+)
+
+// ValidatePodSentinels connects to each sentinel listed for a pod and
+// collects its view of the pod: master address, config-epoch, flags,
+// num-other-sentinels, num-slaves, the CKQUORUM result and whether the
+// sentinel is in TILT mode. Sentinels which diverge from the majority, or
+// which report a problem, are flagged. An error is returned if any sentinel
+// is flagged.
+func (c *Constellation) ValidatePodSentinels(ctx context.Context, podname string) (report common.SentinelConsistencyReport, err error) {
+	report.Pod = podname
+	report.Checked = time.Now()
+	report.Checks = make(map[string]bool)
+	_, exists := c.PodMap[podname]
+	_, mapped := c.PodToSentinelsMap[podname]
+	if !exists && !mapped {
+		return report, errors.New("Pod not found")
+	}
+
+	// The cached list may include sentinels which have since stopped
+	// answering; those are exactly the ones worth reporting on.
+	names := make(map[string]bool)
+	for _, s := range c.PodToSentinelsMap[podname] {
+		names[s.Name] = true
+	}
+	for _, s := range c.GetSentinelsForPod(ctx, podname) {
+		names[s.Name] = true
+	}
+	for _, name := range sortedBoolKeys(names) {
+		view := sentinelView(ctx, name, podname)
+		report.Checks[name] = view.Reachable && view.Master != ""
+		report.Views = append(report.Views, view)
+	}
+	if len(report.Views) == 0 {
+		return report, fmt.Errorf("No sentinels found for pod '%s'", podname)
+	}
+
+	masters := make(map[string]int)
+	epochs := make(map[string]int)
+	others := make(map[string]int)
+	slaves := make(map[string]int)
+	for _, v := range report.Views {
+		if !v.Reachable {
+			continue
+		}
+		masters[v.Master]++
+		epochs[strconv.Itoa(v.ConfigEpoch)]++
+		others[strconv.Itoa(v.NumOtherSentinels)]++
+		slaves[strconv.Itoa(v.NumSlaves)]++
+	}
+	report.Majority.Master = majorityValue(masters)
+	report.Majority.ConfigEpoch, _ = strconv.Atoi(majorityValue(epochs))
+	report.Majority.NumOtherSentinels, _ = strconv.Atoi(majorityValue(others))
+	report.Majority.NumSlaves, _ = strconv.Atoi(majorityValue(slaves))
+
+	for i := range report.Views {
+		v := &report.Views[i]
+		if !v.Reachable {
+			report.Problems = append(report.Problems, fmt.Sprintf("%s is unreachable: %s", v.Sentinel, v.Error))
+			continue
+		}
+		if v.Master != report.Majority.Master {
+			v.Divergent = append(v.Divergent, "master")
+		}
+		if v.ConfigEpoch != report.Majority.ConfigEpoch {
+			v.Divergent = append(v.Divergent, "config-epoch")
+		}
+		if v.NumOtherSentinels != report.Majority.NumOtherSentinels {
+			v.Divergent = append(v.Divergent, "num-other-sentinels")
+		}
+		if v.NumSlaves != report.Majority.NumSlaves {
+			v.Divergent = append(v.Divergent, "num-slaves")
+		}
+		if len(v.Divergent) > 0 {
+			report.Problems = append(report.Problems, fmt.Sprintf("%s diverges from the majority on %s", v.Sentinel, strings.Join(v.Divergent, ", ")))
+		}
+		if v.Tilt {
+			report.Problems = append(report.Problems, fmt.Sprintf("%s is in TILT mode", v.Sentinel))
+		}
+		if !v.CKQuorumOK {
+			report.Problems = append(report.Problems, fmt.Sprintf("%s fails CKQUORUM: %s", v.Sentinel, v.CKQuorum))
+		}
+		if v.ODown {
+			report.Problems = append(report.Problems, fmt.Sprintf("%s considers the master objectively down", v.Sentinel))
+		} else if v.SDown {
+			report.Problems = append(report.Problems, fmt.Sprintf("%s considers the master subjectively down", v.Sentinel))
+		}
+	}
+	report.Consistent = len(report.Problems) == 0
+	if !report.Consistent {
+		return report, errors.New("Not all sentinels validated")
+	}
+	return report, nil
+}
+
+// sentinelView collects a single sentinel's view of the pod
+func sentinelView(ctx context.Context, name, podname string) (view common.SentinelView) {
+	view.Sentinel = name
+	sc, err := common.Dial(ctx, client.DialConfig{Address: name})
+	if err != nil {
+		view.Error = err.Error()
+		return view
+	}
+	defer sc.ClosePool()
+	var mi structures.MasterInfo
+	err = common.Do(ctx, func() (err error) {
+		mi, err = sc.SentinelMasterInfo(podname)
+		return err
+	})
+	if err != nil {
+		view.Error = err.Error()
+		return view
+	}
+	view.Reachable = true
+	view.ConfigEpoch = mi.ConfigEpoch
+	view.Flags = mi.Flags
+	view.NumOtherSentinels = mi.NumOtherSentinels
+	view.NumSlaves = mi.NumSlaves
+	view.Quorum = mi.Quorum
+	for _, flag := range strings.Split(mi.Flags, ",") {
+		switch flag {
+		case "s_down":
+			view.SDown = true
+		case "o_down":
+			view.ODown = true
+		}
+	}
+	view.Master = fmt.Sprintf("%s:%d", mi.IP, mi.Port)
+
+	// The remaining queries only refine the view; if the deadline passes
+	// while they run, return what has been gathered so far
+	detailed := view
+	if common.Do(ctx, func() error {
+		sentinelDetails(sc, podname, &detailed)
+		return nil
+	}) == nil {
+		view = detailed
+	}
+	return view
+}
+
+// sentinelDetails adds the sentinel's current master address, CKQUORUM
+// result and TILT state to the view
+func sentinelDetails(sc *client.Redis, podname string, view *common.SentinelView) {
+	if addr, err := sc.SentinelGetMaster(podname); err == nil && addr.Port > 0 {
+		view.Master = fmt.Sprintf("%s:%d", addr.Host, addr.Port)
+	}
+
+	rp, err := sc.ExecuteCommand("SENTINEL", "CKQUORUM", podname)
+	if err != nil {
+		view.CKQuorum = err.Error()
+	} else {
+		view.CKQuorum, err = rp.StatusValue()
+		view.CKQuorumOK = err == nil && strings.HasPrefix(view.CKQuorum, "OK")
+	}
+
+	rp, err = sc.ExecuteCommand("INFO", "sentinel")
+	if err == nil {
+		info, _ := rp.StringValue()
+		for _, line := range strings.Split(info, "\n") {
+			if strings.HasPrefix(line, "sentinel_tilt:") {
+				view.Tilt = strings.TrimSpace(strings.TrimPrefix(line, "sentinel_tilt:")) == "1"
+			}
+		}
+	}
+}
+
+// majorityValue returns the most common value, breaking ties by value so
+// the result is stable
+func majorityValue(counts map[string]int) (value string) {
+	var keys []string
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	best := -1
+	for _, k := range keys {
+		if counts[k] > best {
+			value, best = k, counts[k]
+		}
+	}
+	return value
+}
@@ -2,27 +2,24 @@ package actions
 
 import (
 	"bufio"
-	"errors"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
-	"log"
-	"math/rand"
 	"net"
-	"net/http"
 	"os"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/golang/groupcache"
-	"github.com/therealbill/libredis/client"
 	"github.com/therealbill/libredis/structures"
 	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-shared/logging"
 )
 
-const GCPORT = "8008"
-
 // SentinelPodConfig is a struct carrying information about a Pod's config as
 // pulled from the sentinel config file.
 type SentinelPodConfig struct {
@@ -34,6 +31,14 @@ type SentinelPodConfig struct {
 	Sentinels map[string]string
 }
 
+// MarshalJSON masks the pod's auth token
+func (spc SentinelPodConfig) MarshalJSON() ([]byte, error) {
+	type plain SentinelPodConfig
+	p := plain(spc)
+	p.AuthToken = common.MaskSecret(p.AuthToken)
+	return json.Marshal(p)
+}
+
 // LocalSentinelConfig is a struct holding information about the sentinel RS is
 // running on.
 type LocalSentinelConfig struct {
@@ -47,6 +52,9 @@ type LocalSentinelConfig struct {
 // Constellation is a construct which holds information about the constellation
 // as well providing an interface for taking actions against it.
 type Constellation struct {
+	mu                  *sync.Mutex
+	published           *atomic.Value
+	snapshot            bool
 	Name                string
 	PodMap              map[string]*common.RedisPod
 	LocalPodMap         map[string]*common.RedisPod
@@ -62,15 +70,20 @@ type Constellation struct {
 	SentinelConfig      LocalSentinelConfig
 	PodToSentinelsMap   map[string][]*Sentinel
 	Balanced            bool
-	AuthCache           *PodAuthCache
 	Groupname           string
-	Peers               *groupcache.HTTPPool
+	Credentials         *CredentialStore
+	Maintenance         *MaintenanceStore
+	Drills              *DrillStore
+	History             *HistoryStore
+	Alerts              *AlertEngine
+	podErrorState       map[string]bool
+	podMasters          map[string]string
 	PeerList            map[string]string
 	PodAuthMap          map[string]string
 	NodeMap             map[string]*common.RedisNode
 	NodeNameToPodMap    map[string]string
 	ConfiguredSentinels map[string]interface{}
-	Metrics             ConstellationStats
+	Metrics             common.ConstellationStats
 	LocalOverrides      SentinelOverrides
 }
 type SentinelOverrides struct {
@@ -82,8 +95,8 @@ type SentinelOverrides struct {
 // constellation, and hence this RedSkull instance, belongs to.
 // In the future this will be used in clsuter coordination as well as for a
 // protective measure against cluster merge
-func GetConstellation(name, cfg, group, sentinelAddress string) (Constellation, error) {
-	con := Constellation{Name: name}
+func GetConstellation(ctx context.Context, name, cfg, group, sentinelAddress string) (Constellation, error) {
+	con := Constellation{Name: name, mu: new(sync.Mutex), published: new(atomic.Value)}
 	con.SentinelConfig.ManagedPodConfigs = make(map[string]SentinelPodConfig)
 	con.PodToSentinelsMap = make(map[string][]*Sentinel)
 	con.RemoteSentinels = make(map[string]*Sentinel)
@@ -96,37 +109,28 @@ func GetConstellation(name, cfg, group, sentinelAddress string) (Constellation,
 	con.PeerList = make(map[string]string)
 	con.NodeNameToPodMap = make(map[string]string)
 	con.ConfiguredSentinels = make(map[string]interface{})
+	con.podErrorState = make(map[string]bool)
+	con.podMasters = make(map[string]string)
 	con.Groupname = group
 	con.LocalOverrides = SentinelOverrides{BindAddress: sentinelAddress}
 	con.SentinelConfigName = cfg
+	con.StartMaintenanceStore()
+	con.StartDrillStore()
+	con.StartHistoryStore()
+	con.StartAlertEngine()
 	con.LoadSentinelConfigFile()
-	con.LoadLocalPods()
-	con.LoadRemoteSentinels()
+	con.LoadLocalPods(ctx)
+	con.LoadRemoteSentinels(ctx)
 	con.Balanced = true
 	con.PeerList = make(map[string]string)
-	con.GetStats()
+	con.GetStats(ctx)
 	return con, nil
 }
 
-// ConstellationStats holds mtrics about the constellation. As the
-// Constellation term is undergoing a change, this will also need to change to
-// reflect the new terminology.
-// As soon as it is determined
-type ConstellationStats struct {
-	PodCount        int
-	NodeCount       int
-	TotalPodMemory  int64
-	TotalNodeMemory int64
-	SentinelCount   int
-	PodSizes        map[int64]int64
-	MemoryUsed      int64
-	MemoryPctAvail  float64
-}
-
 // GetStats returns metrics about the constellation
-func (c *Constellation) GetStats() ConstellationStats {
+func (c *Constellation) GetStats(ctx context.Context) common.ConstellationStats {
 	// first: pod crawling
-	var metrics ConstellationStats
+	var metrics common.ConstellationStats
 	metrics.PodSizes = make(map[int64]int64)
 	pmap := c.PodMap
 	metrics.PodCount = len(pmap)
@@ -137,13 +141,13 @@ func (c *Constellation) GetStats() ConstellationStats {
 		if master == nil {
 			address := fmt.Sprintf("%s:%d", pod.Info.IP, pod.Info.Port)
 			var err error
-			master, err = c.GetNode(address, pod.Name, pod.AuthToken)
+			master, err = c.GetNode(ctx, address, pod.Name, pod.AuthToken)
 			if err != nil {
-				log.Printf("Unable to get master for pod '%s', ERR='%s'", pod.Name, err)
+				logging.Pod(pod.Name).Errorf("Unable to get master for pod '%s', ERR='%s'", pod.Name, err)
 				continue
 			}
 		}
-		master.UpdateData()
+		master.UpdateData(ctx)
 		metrics.NodeCount++
 		for _, slave := range master.Slaves {
 			metrics.NodeCount++
@@ -161,15 +165,15 @@ func (c *Constellation) GetStats() ConstellationStats {
 // GetNode will retun an instance of a common.RedisNode.
 // It also attempts to determine dynamic data such as sentinels and booleans
 // like CanFailover
-func (c *Constellation) GetNode(name, podname, auth string) (node *common.RedisNode, err error) {
+func (c *Constellation) GetNode(ctx context.Context, name, podname, auth string) (node *common.RedisNode, err error) {
 	if c.NodeMap == nil {
-		log.Fatal("c.NodeMap is not initialized. wtf?!")
+		logging.Node(name).Pod(podname).Fatalf("Constellation's node map is not initialized, unable to get node %s of pod '%s'", name, podname)
 	}
 	node, exists := c.NodeMap[name]
 	if exists {
-		_, err := node.UpdateData()
+		_, err := node.UpdateData(ctx)
 		if err != nil {
-			log.Print("ERROR in GetNode:Update -> ", err)
+			logging.Errorf("ERROR in GetNode:Update -> %s", err)
 			// somehow I need to find a good way to bubble up this error as it usually means bad auth
 			return node, err
 		}
@@ -184,66 +188,76 @@ func (c *Constellation) GetNode(name, podname, auth string) (node *common.RedisN
 		return node, err
 	}
 	if auth == "" {
-		log.Print("Auth was blank when called, trying to determine it from authcache - ", podname)
+		logging.Pod(podname).Debugf("Auth was blank when called, trying to determine it from authcache - %s", podname)
 		auth = c.GetPodAuth(podname)
 	}
 	host, port, err := GetAddressPair(name)
 	if err != nil {
-		log.Print("Unable to determine connection info. Err:", err)
+		logging.Errorf("Unable to determine connection info. Err:%s", err)
 		return
 	}
-	node, err = common.LoadNodeFromHostPort(host, port, auth)
+	node, err = common.LoadNodeFromHostPort(ctx, host, port, auth)
 	if err != nil {
-		log.Print("Unable to obtain connection . Err:", err)
+		logging.Errorf("Unable to obtain connection . Err:%s", err)
 		return
 	}
 	c.NodeMap[name] = node
 	return
 }
 
-// GetPodAuth will return an authstring from the local config and/or the
-// groupcache group if it is in there. This probably still needs a bit of work
-// to be reliable enough for me.
+// GetPodAuth returns the pod's auth token. The credential store is checked
+// first, then the local config (seeding the store), and finally the store's
+// peers so pods managed by other RedSkull instances resolve as well.
 func (c *Constellation) GetPodAuth(podname string) string {
-	return c.PodAuthMap[podname]
-	//return c.AuthCache.Get(podname)
+	if c.Credentials == nil {
+		return c.PodAuthMap[podname]
+	}
+	if auth, ok := c.Credentials.Get(podname); ok {
+		return auth
+	}
+	if auth := c.PodAuthMap[podname]; auth > "" {
+		c.Credentials.Set(podname, auth, "config")
+		return auth
+	}
+	if auth, ok := c.Credentials.Fetch(podname); ok {
+		c.PodAuthMap[podname] = auth
+		return auth
+	}
+	return ""
 }
 
-// StartCache is used to start up the groupcache mechanism
-func (c *Constellation) StartCache() {
-	log.Print("Starting AuthCache")
-	var peers []string
+// setPodAuth records a new auth token for the pod
+func (c *Constellation) setPodAuth(podname, auth, source string) {
+	c.PodAuthMap[podname] = auth
+	if c.Credentials != nil {
+		c.Credentials.Set(podname, auth, source)
+	}
+}
+
+// StartCredentialStore opens the credential store and starts serving it to
+// peers on the local sentinel's host
+func (c *Constellation) StartCredentialStore() {
+	logging.Infof("Starting credential store")
 	if c.PeerList == nil {
-		log.Print("Initializing PeerList")
+		logging.Debugf("Initializing PeerList")
 		c.PeerList = make(map[string]string)
 	}
-
-	for _, peer := range c.PeerList {
-		log.Printf("Assigning peer '%s'", peer)
-		if peer > "" {
-			peers = append(peers, "http://"+peer+":"+GCPORT)
-		}
+	store, err := NewCredentialStore(CredentialStoreFile, SecretKey)
+	if err != nil {
+		logging.Errorf("Unable to load credential store, starting empty: %s", err)
 	}
-	c.Peers.Set(peers...)
-	var authcache = groupcache.NewGroup(c.Groupname, 64<<20, groupcache.GetterFunc(
-		func(ctx groupcache.Context, key string, dest groupcache.Sink) error {
-			pod := key
-			auth := c.GetAuthForPodFromConfig(pod)
-			if auth > "" {
-				dest.SetString(auth)
-				return nil
-			}
-			err := fmt.Errorf("Found no value for auth on pod %s, not storing anything", pod)
-			return err
-		}))
-	c.AuthCache = NewCache(authcache)
-
+	c.Credentials = store
+	c.SetPeers()
+	for podname, auth := range c.PodAuthMap {
+		c.Credentials.Set(podname, auth, "config")
+	}
+	go c.Credentials.Listen(fmt.Sprintf("%s:%d", c.SentinelConfig.Host, CredentialPort))
 }
 
 // LoadLocalPods uses the PodConfigs read from the sentinel config file and
 // talks to the local sentinel to develop the list of pods the local sentinel
 // knows about.
-func (c *Constellation) LoadLocalPods() error {
+func (c *Constellation) LoadLocalPods(ctx context.Context) error {
 	if c.LocalPodMap == nil {
 		c.LocalPodMap = make(map[string]*common.RedisPod)
 	}
@@ -255,60 +269,59 @@ func (c *Constellation) LoadLocalPods() error {
 	}
 	// Initialize local sentinel
 	if c.LocalSentinel.Name == "" {
-		log.Print("Initializing LOCAL sentinel")
+		logging.Debugf("Initializing LOCAL sentinel")
 		var address string
 		var err error
 		if c.SentinelConfig.Host == "" {
-			log.Print("No Hostname, determining local hostname")
+			logging.Debugf("No Hostname, determining local hostname")
 			myhostname, err := os.Hostname()
 			if err != nil {
-				log.Print(err)
+				logging.Errorf("%s", err)
 			}
 			myip, err := net.LookupHost(myhostname)
 			if err != nil {
-				log.Fatal(err)
+				logging.Fatalf("%s", err)
 			}
 			c.LocalSentinel.Host = myip[0]
 			c.SentinelConfig.Host = myip[0]
-			log.Printf("%+v", myip)
+			logging.Debugf("%+v", myip)
 			address = fmt.Sprintf("%s:%d", myip[0], c.SentinelConfig.Port)
 			c.LocalSentinel.Name = address
-			log.Printf("Determined LOCAL address is: %s", address)
-			log.Printf("Determined LOCAL name is: %s", c.LocalSentinel.Name)
+			logging.Debugf("Determined LOCAL address is: %s", address)
+			logging.Debugf("Determined LOCAL name is: %s", c.LocalSentinel.Name)
 			c.Name = address
 		} else {
 			address = fmt.Sprintf("%s:%d", c.SentinelConfig.Host, c.SentinelConfig.Port)
-			log.Printf("Determined LOCAL address is: %s", address)
+			logging.Debugf("Determined LOCAL address is: %s", address)
 			c.LocalSentinel.Name = address
-			log.Printf("Determined LOCAL name is: %s", c.LocalSentinel.Name)
+			logging.Debugf("Determined LOCAL name is: %s", c.LocalSentinel.Name)
 		}
 		c.LocalSentinel.Host = c.SentinelConfig.Host
 		c.LocalSentinel.Port = c.SentinelConfig.Port
-		c.LocalSentinel.Connection, err = client.DialWithConfig(&client.DialConfig{Address: address})
+		err = c.LocalSentinel.connect(ctx, address)
 		if err != nil {
 			// Handle error reporting here!
 			//log.Printf("SentinelConfig=%+v", c.SentinelConfig)
-			log.Fatalf("LOCAL Sentinel '%s' failed connection attempt", c.LocalSentinel.Name)
+			logging.Fatalf("LOCAL Sentinel '%s' failed connection attempt", c.LocalSentinel.Name)
 		}
-		c.LocalSentinel.Info, _ = c.LocalSentinel.Connection.SentinelInfo()
 	}
-	log.Print("INitial iteration through ManagedPodConfigs")
+	logging.Debugf("INitial iteration through ManagedPodConfigs")
 	local_config_count := len(c.SentinelConfig.ManagedPodConfigs)
 	ctr := 0
 	for pname, pconfig := range c.SentinelConfig.ManagedPodConfigs {
-		mi, err := c.LocalSentinel.GetMaster(pname)
+		mi, err := c.LocalSentinel.GetMaster(ctx, pname)
 		if err != nil {
-			log.Printf("WARNING: Pod '%s' in config but not found when talking to the sentinel controller. Err: '%s'", pname, err)
+			logging.Pod(pname).Warnf("Pod '%s' in config but not found when talking to the sentinel controller. Err: '%s'", pname, err)
 			continue
 		}
 		address := fmt.Sprintf("%s:%d", mi.Host, mi.Port)
-		pod, err := c.LocalSentinel.GetPod(pname)
-		master, err := c.GetNode(address, pname, pconfig.AuthToken)
+		pod, err := c.LocalSentinel.GetPod(ctx, pname)
+		master, err := c.GetNode(ctx, address, pname, pconfig.AuthToken)
 		//c.GetNode(address, pname, pconfig.AuthToken)
 		if err != nil {
-			log.Printf("Was unable to get node '%s' for pod '%s' with auth '%s'", address, pname, pconfig.AuthToken)
+			logging.Pod(pname).Errorf("Was unable to get node '%s' for pod '%s' with auth '%s'", address, pname, common.MaskSecret(pconfig.AuthToken))
 			if strings.Contains(err.Error(), "password") {
-				log.Print("marking pod/node auth invalid")
+				logging.Debugf("marking pod/node auth invalid")
 				master.HasValidAuth = false
 				pod.ValidAuth = false
 			}
@@ -317,7 +330,7 @@ func (c *Constellation) LoadLocalPods() error {
 			master.HasValidAuth = true
 		}
 		if err != nil {
-			log.Printf("ERROR: No pod found on LOCAL sentinel for %s", pname)
+			logging.Pod(pname).Errorf("No pod found on LOCAL sentinel for %s", pname)
 		}
 		if c.PodMap == nil {
 			c.PodMap = make(map[string]*common.RedisPod)
@@ -328,12 +341,12 @@ func (c *Constellation) LoadLocalPods() error {
 		pod.Master = master
 		c.PodMap[pod.Name] = &pod
 		c.LocalPodMap[pod.Name] = &pod
-		c.LoadNodesForPod(&pod, &c.LocalSentinel)
+		c.LoadNodesForPod(ctx, &pod, &c.LocalSentinel)
 		ctr++
-		log.Printf("Loaded %d of %d configured local pods", ctr, local_config_count)
+		logging.Infof("Loaded %d of %d configured local pods", ctr, local_config_count)
 	}
 
-	log.Print("Done with LocalSentinel initialization")
+	logging.Debugf("Done with LocalSentinel initialization")
 	return nil
 }
 
@@ -347,49 +360,49 @@ func (c *Constellation) GetAuthForPodFromConfig(podname string) string {
 // IsBalanced is likely to be deprecated. What it currently does is to look
 // across the known sentinels and pods and determine if any pod is
 // "unbalanced".
-func (c *Constellation) IsBalanced() (isbal bool) {
+func (c *Constellation) IsBalanced(ctx context.Context) (isbal bool) {
 	if c.Balanced == false {
 		return c.Balanced
 	}
 	isbal = true
 	needed_monitors := 0
 	monitors := 0
-	for _, sentinel := range c.GetAllSentinelsQuietly() {
-		pc := sentinel.PodCount()
+	for _, sentinel := range c.GetAllSentinelsQuietly(ctx) {
+		pc := sentinel.PodCount(ctx)
 		monitors += pc
 	}
 	for name, sentinels := range c.PodToSentinelsMap {
 		// First try to get from local sentinel, then iterate over the rest to
 		// find it
-		pod, err := c.LocalSentinel.GetPod(name)
+		pod, err := c.LocalSentinel.GetPod(ctx, name)
 		if err != nil {
 			for _, s := range sentinels {
-				pod, err = s.GetPod(name)
+				pod, err = s.GetPod(ctx, name)
 				if err == nil {
 					break
 				}
 			}
 		}
 		if pod.Name == "" {
-			log.Printf("WARNING: Unable to get pod '%s' from anywhere", name)
+			logging.Pod(name).Warnf("Unable to get pod '%s' from anywhere", name)
 		}
 		needed := pod.Info.Quorum + 1
 		needed_monitors += needed
 		if len(sentinels) == 0 {
-			log.Printf("WARNING: Pod %s has no sentinels?? trying to find some", pod.Name)
-			sentinels = c.GetSentinelsForPod(pod.Name)
+			logging.Pod(pod.Name).Warnf("Pod %s has no sentinels?? trying to find some", pod.Name)
+			sentinels = c.GetSentinelsForPod(ctx, pod.Name)
 			c.PodToSentinelsMap[pod.Name] = sentinels
 		}
 		pod.SentinelCount = len(sentinels)
 		if pod.SentinelCount < needed {
-			log.Printf("Pod '%s' has %d of %d needed sentinels monitoring it, thus we are unbalanced", pod.Name, pod.SentinelCount, needed)
+			logging.Pod(pod.Name).Warnf("Pod '%s' has %d of %d needed sentinels monitoring it, thus we are unbalanced", pod.Name, pod.SentinelCount, needed)
 			isbal = false
 			c.Balanced = isbal
 			return isbal
 		}
 	}
 	if needed_monitors > monitors {
-		log.Printf("Need total of %d monitors, have %d", needed_monitors, monitors)
+		logging.Debugf("Need total of %d monitors, have %d", needed_monitors, monitors)
 		isbal = false
 	}
 	c.Balanced = isbal
@@ -397,7 +410,7 @@ func (c *Constellation) IsBalanced() (isbal bool) {
 }
 
 // MonitorPod is used to add a pod/master to the constellation cluster.
-func (c *Constellation) MonitorPod(podname, address string, port, quorum int, auth string) (ok bool, err error) {
+func (c *Constellation) MonitorPod(ctx context.Context, podname, address string, port, quorum int, auth string) (ok bool, err error) {
 	_, havekey := c.LocalPodMap[podname]
 	if havekey {
 		err = fmt.Errorf("C:MP -> Pod '%s' already being monitored", podname)
@@ -413,27 +426,27 @@ func (c *Constellation) MonitorPod(podname, address string, port, quorum int, au
 	var pod common.RedisPod
 	neededSentinels := quorum + 1
 
-	sentinels, err := c.GetAvailableSentinels(podname, neededSentinels)
+	sentinels, err := c.GetAvailableSentinels(ctx, podname, neededSentinels)
 	if err != nil {
-		log.Print("NO sentinels available! Error:", err)
+		logging.Errorf("NO sentinels available! Error:%s", err)
 		return false, err
 	}
-	c.PodAuthMap[podname] = auth
+	c.setPodAuth(podname, auth, "monitor")
 	cfg := SentinelPodConfig{Name: podname, AuthToken: auth, IP: address, Port: port, Quorum: quorum}
 	c.SentinelConfig.ManagedPodConfigs[podname] = cfg
 	isLocal := false
 	for _, sentinel := range sentinels {
-		log.Printf("C:MP -> Adding pod to %s", sentinel.Name)
+		logging.Op("MonitorPod").Sentinel(sentinel.Name).Debugf("Adding pod to %s", sentinel.Name)
 		if sentinel.Name == c.LocalSentinel.Name {
 			isLocal = true
 		}
-		pod, err = sentinel.MonitorPod(podname, address, port, quorum, auth)
+		pod, err = sentinel.MonitorPod(ctx, podname, address, port, quorum, auth)
 		successfulSentinels++
 	}
 	// I generally dislike sleeps. Hoeever in
 	// this case it is a decent ooption for refreshing data from the
 	// sentinels
-	time.Sleep(2 * time.Second)
+	common.Sleep(ctx, 2*time.Second)
 	pod.SentinelCount = successfulSentinels
 	if isLocal {
 		c.LocalPodMap[podname] = &pod
@@ -450,19 +463,19 @@ func (c *Constellation) MonitorPod(podname, address string, port, quorum int, au
 }
 
 // RemovePod removes a pod from each of it's sentinels.
-func (c *Constellation) RemovePod(podname string) (bool, error) {
+func (c *Constellation) RemovePod(ctx context.Context, podname string) (bool, error) {
 	var err error
-	sentinels := c.GetSentinelsForPod(podname)
+	sentinels := c.GetSentinelsForPod(ctx, podname)
 	if err != nil {
-		log.Print("RemovePod GetAllSentinels err: ", err)
+		logging.Errorf("RemovePod GetAllSentinels err: %s", err)
 		return false, err
 	}
-	log.Printf("Found %d sentinels handling %s", len(sentinels), podname)
+	logging.Pod(podname).Debugf("Found %d sentinels handling %s", len(sentinels), podname)
 	for _, sentinel := range sentinels {
-		log.Printf("Removing pod from %s", sentinel.Name)
-		ok, err := sentinel.RemovePod(podname)
+		logging.Sentinel(sentinel.Name).Debugf("Removing pod from %s", sentinel.Name)
+		ok, err := sentinel.RemovePod(ctx, podname)
 		if err != nil || !ok {
-			log.Printf("Unable to remove %s from %s. Error:%s", podname, sentinel.Name, err.Error())
+			logging.Pod(podname).Sentinel(sentinel.Name).Errorf("Unable to remove %s from %s. Error:%s", podname, sentinel.Name, err.Error())
 		}
 	}
 	delete(c.SentinelConfig.ManagedPodConfigs, podname)
@@ -473,14 +486,21 @@ func (c *Constellation) RemovePod(podname string) (bool, error) {
 	return true, err
 }
 
-// Initiates a failover on a given pod.
-func (c *Constellation) Failover(podname string) (ok bool, err error) {
+// Initiates a failover on a given pod. Pods in maintenance are only failed
+// over when forced.
+func (c *Constellation) Failover(ctx context.Context, podname string, force bool) (ok bool, err error) {
+	if !force && c.InMaintenance(podname) {
+		return false, ErrPodInMaintenance
+	}
 	// change this to iterate over known sentinels via the
 	// GetSentinelsForPod call
 	didFailover := false
 	for _, s := range c.PodToSentinelsMap[podname] {
-		didFailover, err = s.DoFailover(podname)
+		didFailover, err = s.DoFailover(ctx, podname)
 		if didFailover {
+			if c.History != nil {
+				c.History.NoteFailover(podname, common.ChangeRequested)
+			}
 			return true, nil
 		}
 	}
@@ -488,17 +508,17 @@ func (c *Constellation) Failover(podname string) (ok bool, err error) {
 }
 
 // GetAllSentinels returns all known sentinels
-func (c *Constellation) GetAllSentinels() (sentinels []*Sentinel, err error) {
+func (c *Constellation) GetAllSentinels(ctx context.Context) (sentinels []*Sentinel, err error) {
 	for name, pod := range c.LocalPodMap {
-		slist, _ := c.LocalSentinel.GetSentinels(name)
+		slist, _ := c.LocalSentinel.GetSentinels(ctx, name)
 		for _, sent := range slist {
 			if sent.Name == c.LocalSentinel.Name {
 				continue
 			}
 			_, exists := c.RemoteSentinels[sent.Name]
 			if !exists {
-				c.AddSentinelByAddress(sent.Name)
-				log.Printf("Added REMOTE sentinel '%s' for LOCAL pod", sent.Name)
+				c.AddSentinelByAddress(ctx, sent.Name)
+				logging.Sentinel(sent.Name).Debugf("Added REMOTE sentinel '%s' for LOCAL pod", sent.Name)
 			}
 		}
 		c.PodToSentinelsMap[name] = slist
@@ -510,7 +530,7 @@ func (c *Constellation) GetAllSentinels() (sentinels []*Sentinel, err error) {
 		if islocal {
 			continue
 		}
-		slist, _ := c.LocalSentinel.GetSentinels(name)
+		slist, _ := c.LocalSentinel.GetSentinels(ctx, name)
 		for _, sent := range slist {
 			if sent.Name == c.LocalSentinel.Name {
 				continue
@@ -518,8 +538,8 @@ func (c *Constellation) GetAllSentinels() (sentinels []*Sentinel, err error) {
 			_, exists := c.RemoteSentinels[sent.Name]
 			if !exists {
 				c.RemoteSentinels[sent.Name] = sent
-				c.AddSentinelByAddress(sent.Name)
-				log.Printf("Added REMOTE sentinel '%s' for REMOTE pod", sent.Name)
+				c.AddSentinelByAddress(ctx, sent.Name)
+				logging.Sentinel(sent.Name).Debugf("Added REMOTE sentinel '%s' for REMOTE pod", sent.Name)
 			}
 		}
 		pod.SentinelCount = len(slist)
@@ -528,7 +548,7 @@ func (c *Constellation) GetAllSentinels() (sentinels []*Sentinel, err error) {
 	for _, s := range c.RemoteSentinels {
 		_, err := s.GetPods()
 		if err != nil {
-			log.Printf("Sentinel %s -> GetPods err: '%s'", s.Name, err)
+			logging.Sentinel(s.Name).Errorf("Sentinel %s -> GetPods err: '%s'", s.Name, err)
 			continue
 		}
 		sentinels = append(sentinels, s)
@@ -539,30 +559,34 @@ func (c *Constellation) GetAllSentinels() (sentinels []*Sentinel, err error) {
 
 // GetSentinelsForPod returns all sentinels the pod is monitored by. In
 // other words, the pod's constellation
-func (c *Constellation) GetSentinelsForPod(podname string) (sentinels []*Sentinel) {
-	pod, err := c.GetPod(podname)
+func (c *Constellation) GetSentinelsForPod(ctx context.Context, podname string) (sentinels []*Sentinel) {
+	pod, err := c.GetPod(ctx, podname)
 	if err != nil || pod == nil {
-		log.Printf("Unable to get pod '%s' from constellation", podname)
+		logging.Pod(podname).Errorf("Unable to get pod '%s' from constellation", podname)
 		return
 	}
-	all_sentinels, _ := c.GetAllSentinels()
+	all_sentinels, _ := c.GetAllSentinels(ctx)
 	knownSentinels := make(map[string]*Sentinel)
 	var current_sentinels []*Sentinel
 	for _, s := range all_sentinels {
-		conn, err := s.GetConnection()
+		conn, err := s.GetConnection(ctx)
 		if err != nil {
-			log.Printf("Unable to connect to sentinel %s", s.Name)
+			logging.Sentinel(s.Name).Errorf("Unable to connect to sentinel %s", s.Name)
 			continue
 		}
 		defer conn.ClosePool()
-		reportedSentinels, _ := conn.SentinelSentinels(podname)
+		var reportedSentinels []structures.SentinelInfo
+		common.Do(ctx, func() (err error) {
+			reportedSentinels, err = conn.SentinelSentinels(podname)
+			return err
+		})
 		if len(reportedSentinels) == 0 {
-			log.Printf("Sentinel %s was reported as having pod %s. It doesn't. Pod Needs Reset. This can also occur if the master is non-responsive and there are no known slaes for the master.", s.Name, podname)
+			logging.Sentinel(s.Name).Pod(podname).Warnf("Sentinel %s was reported as having pod %s. It doesn't. Pod Needs Reset. This can also occur if the master is non-responsive and there are no known slaes for the master.", s.Name, podname)
 			continue
 		}
-		slist, err := s.GetSentinels(podname)
+		slist, err := s.GetSentinels(ctx, podname)
 		if err != nil {
-			log.Print(err)
+			logging.Errorf("%s", err)
 			continue
 		}
 		knownSentinels[s.Name] = s
@@ -576,13 +600,13 @@ func (c *Constellation) GetSentinelsForPod(podname string) (sentinels []*Sentine
 				if known {
 					continue
 				}
-				p, err := sentinel.GetSentinels(podname)
+				p, err := sentinel.GetSentinels(ctx, podname)
 				if err != nil {
-					log.Printf("Sentinel %s was reported as having pod %s. It doesn't. Pod Needs Reset", sentinel.Name, podname)
-					log.Print("GetPod Err:", err)
+					logging.Sentinel(sentinel.Name).Pod(podname).Warnf("Sentinel %s was reported as having pod %s. It doesn't. Pod Needs Reset", sentinel.Name, podname)
+					logging.Errorf("GetPod Err:%s", err)
 				} else {
 					if len(p) == 0 {
-						log.Printf("Sentinel %s was reported as having pod %s. It doesn't. Pod Needs Reset", sentinel.Name, podname)
+						logging.Sentinel(sentinel.Name).Pod(podname).Warnf("Sentinel %s was reported as having pod %s. It doesn't. Pod Needs Reset", sentinel.Name, podname)
 						continue
 					}
 					knownSentinels[sentinel.Name] = sentinel
@@ -595,31 +619,31 @@ func (c *Constellation) GetSentinelsForPod(podname string) (sentinels []*Sentine
 	}
 	c.PodToSentinelsMap[podname] = current_sentinels
 	pod.SentinelCount = len(current_sentinels)
-	log.Printf("Found %d known sentinels for pod %s", pod.SentinelCount, pod.Name)
+	logging.Pod(pod.Name).Debugf("Found %d known sentinels for pod %s", pod.SentinelCount, pod.Name)
 	return current_sentinels
 }
 
 // GetAvailableSentinels returns a list of sentinels the give pod is *not*
 // already monitored by. It will return the least-used of the available
 // sentinels in an effort to level sentinel use.
-func (c *Constellation) GetAvailableSentinels(podname string, needed int) (sentinels []*Sentinel, err error) {
-	all, err := c.GetAllSentinels()
+func (c *Constellation) GetAvailableSentinels(ctx context.Context, podname string, needed int) (sentinels []*Sentinel, err error) {
+	all, err := c.GetAllSentinels(ctx)
 	if err != nil {
 		return sentinels, err
 	}
 	if len(all) < needed {
 		return sentinels, fmt.Errorf("Not enough sentinels to achieve quorum!")
 	}
-	pcount := func(s1, s2 *Sentinel) bool { return s1.PodCount() < s2.PodCount() }
+	pcount := func(s1, s2 *Sentinel) bool { return s1.PodCount(ctx) < s2.PodCount(ctx) }
 	By(pcount).Sort(all)
 	if len(all) < needed {
-		log.Printf("WTF? needed %d sentinels but only %d available?", needed, len(sentinels))
+		logging.Pod(podname).Warnf("Pod '%s' needs %d sentinels but only %d are available", podname, needed, len(all))
 	}
 	// time to do some tricky testing to ensure we get valid sentinels: ones
 	// which do not already have this pod on them
 	// THis might be cleaner with a dl-list
 	w := 0 // write index
-	existing_sentinels := c.GetSentinelsForPod(podname)
+	existing_sentinels := c.GetSentinelsForPod(ctx, podname)
 	if len(existing_sentinels) > 0 {
 	loop:
 		for _, x := range all {
@@ -638,63 +662,66 @@ func (c *Constellation) GetAvailableSentinels(podname string, needed int) (senti
 
 // AddSentinelByAddress is a convenience function to add a sentinel by
 // it's ip:port string
-func (c *Constellation) AddSentinelByAddress(address string) error {
+func (c *Constellation) AddSentinelByAddress(ctx context.Context, address string) error {
 	apair := strings.Split(address, ":")
 	ip := apair[0]
 	port, _ := strconv.Atoi(apair[1])
-	return c.AddSentinel(ip, port)
+	return c.AddSentinel(ctx, ip, port)
 }
 
-// SetPeers is used when the peers list for groupcache may have changed
+// SetPeers is used when the peers list for the credential store may have
+// changed
 func (c *Constellation) SetPeers() error {
+	if c.Credentials == nil {
+		return nil
+	}
 	var peers []string
 	for _, peer := range c.PeerList {
-		if peer > "" {
-			peers = append(peers, "http://"+peer+":"+GCPORT)
+		if peer > "" && peer != c.SentinelConfig.Host {
+			peers = append(peers, fmt.Sprintf("%s:%d", peer, CredentialPort))
 		}
 	}
-	c.Peers.Set(peers...)
+	c.Credentials.SetPeers(peers)
 	return nil
 }
 
 // LoadRemoteSentinels interrogates all known remote sentinels and crawls
 // the results to explore non-local configuration
-func (c *Constellation) LoadRemoteSentinels() {
+func (c *Constellation) LoadRemoteSentinels(ctx context.Context) {
 	for k := range c.ConfiguredSentinels {
-		log.Printf("INIT REMOTE SENTINEL: %s", k)
-		c.AddSentinelByAddress(k)
+		logging.Debugf("INIT REMOTE SENTINEL: %s", k)
+		c.AddSentinelByAddress(ctx, k)
 	}
 }
 
 // AddSentinel adds a sentinel to the constellation
-func (c *Constellation) AddSentinel(ip string, port int) error {
+func (c *Constellation) AddSentinel(ctx context.Context, ip string, port int) error {
 	if c.LocalSentinel.Name == "" {
-		log.Print("Initializing LOCAL sentinel")
+		logging.Debugf("Initializing LOCAL sentinel")
 		if c.SentinelConfig.Host == "" {
 			myhostname, err := os.Hostname()
 			if err != nil {
-				log.Print(err)
+				logging.Errorf("%s", err)
 			}
 			myip, err := net.LookupHost(myhostname)
 			if err != nil {
-				log.Print(err)
+				logging.Errorf("%s", err)
 			}
 			c.LocalSentinel.Host = myip[0]
 		}
 		address := fmt.Sprintf("%s:%d", c.SentinelConfig.Host, c.SentinelConfig.Port)
 		c.LocalSentinel.Name = address
 		var err error
-		c.LocalSentinel.Connection, err = client.DialWithConfig(&client.DialConfig{Address: address})
+		err = c.LocalSentinel.connect(ctx, address)
 		if err != nil {
 			// Handle error reporting here! I don't thnk we want to do a
 			// fatal here anymore
-			log.Fatalf("LOCAL Sentinel '%s' failed connection attempt", c.LocalSentinel.Name)
+			logging.Fatalf("LOCAL Sentinel '%s' failed connection attempt", c.LocalSentinel.Name)
 		}
-		c.LocalSentinel.Info, _ = c.LocalSentinel.Connection.SentinelInfo()
 	}
 	var sentinel Sentinel
 	if port == 0 {
-		err := fmt.Errorf("AddSentinel called w/ZERO port .. wtf, man?")
+		err := fmt.Errorf("Unable to add sentinel on %s: port 0 is not a valid sentinel port", ip)
 		return err
 	}
 	address := fmt.Sprintf("%s:%d", ip, port)
@@ -710,15 +737,15 @@ func (c *Constellation) AddSentinel(ip string, port int) error {
 	if exists {
 		return nil
 	}
-	// Now to add to the PeerList for GroupCache
-	// For now we are using just the IP and expect port 8000 by convention
+	// Now to add to the PeerList for the credential store
+	// For now we are using just the IP and expect CredentialPort by convention
 	// This will change to serf/consul when that part is added I expect
 	if c.PeerList == nil {
 		c.PeerList = make(map[string]string)
 	}
 	_, exists = c.PeerList[address]
 	if !exists {
-		log.Print("New Peer: ", address)
+		logging.Debugf("New Peer: %s", address)
 		c.PeerList[address] = ip
 		c.SetPeers()
 	}
@@ -728,27 +755,25 @@ func (c *Constellation) AddSentinel(ip string, port int) error {
 	sentinel.Port = port
 	_, known := c.RemoteSentinels[address]
 	if known {
-		log.Printf("Already have crawled '%s'", sentinel.Name)
+		logging.Sentinel(sentinel.Name).Debugf("Already have crawled '%s'", sentinel.Name)
 	} else {
-		log.Printf("Adding REMOTE Sentinel '%s'", address)
-		conn, err := client.DialWithConfig(&client.DialConfig{Address: address})
+		logging.Debugf("Adding REMOTE Sentinel '%s'", address)
+		err := sentinel.connect(ctx, address)
 		if err != nil {
 			// Handle error reporting here!
 			err = fmt.Errorf("AddSentinel -> '%s' failed connection attempt", address)
 			c.BadSentinels[address] = &sentinel
 			return err
 		}
-		sentinel.Connection = conn
-		sentinel.Info, _ = sentinel.Connection.SentinelInfo()
 		if address != c.LocalSentinel.Name {
-			log.Print("discovering pods on remote sentinel " + sentinel.Name)
-			sentinel.LoadPods()
+			logging.Sentinel(sentinel.Name).Debugf("Discovering pods on remote sentinel %s", sentinel.Name)
+			sentinel.LoadPods(ctx)
 			pods, _ := sentinel.GetPods()
-			log.Printf("%d Pods to load from %s ", len(pods), address)
+			logging.Debugf("%d Pods to load from %s ", len(pods), address)
 			c.RemoteSentinels[address] = &sentinel
 			for _, pod := range pods {
 				if pod.Name == "" {
-					log.Print("WUT: Have a nameless pod. This is probably a bug.")
+					logging.Sentinel(address).Warnf("Sentinel %s reported a pod with no name, skipping it", address)
 					continue
 				}
 				_, islocal := c.LocalPodMap[pod.Name]
@@ -759,11 +784,11 @@ func (c *Constellation) AddSentinel(ip string, port int) error {
 				if isremote {
 					continue
 				}
-				log.Print("Adding DISCOVERED remotely managed pod " + pod.Name)
+				logging.Pod(pod.Name).Infof("Adding DISCOVERED remotely managed pod %s", pod.Name)
 				c.GetPodAuth(pod.Name)
-				log.Print("Got auth for pod")
-				c.LoadNodesForPod(&pod, &sentinel)
-				newsentinels, _ := sentinel.GetSentinels(pod.Name)
+				logging.Debugf("Got auth for pod")
+				c.LoadNodesForPod(ctx, &pod, &sentinel)
+				newsentinels, _ := sentinel.GetSentinels(ctx, pod.Name)
 				pod.SentinelCount = len(newsentinels)
 				c.PodToSentinelsMap[pod.Name] = newsentinels
 				c.RemotePodMap[pod.Name] = &pod
@@ -775,7 +800,7 @@ func (c *Constellation) AddSentinel(ip string, port int) error {
 					if ns.Name == c.LocalSentinel.Name || ns.Name == sentinel.Name {
 						continue
 					}
-					c.AddSentinelByAddress(ns.Name)
+					c.AddSentinelByAddress(ctx, ns.Name)
 				}
 			}
 		}
@@ -785,18 +810,18 @@ func (c *Constellation) AddSentinel(ip string, port int) error {
 
 // common.LoadNodesForPod is called to add the master and slave nodes for the
 // given pod.
-func (c *Constellation) LoadNodesForPod(pod *common.RedisPod, sentinel *Sentinel) {
-	mi, err := sentinel.GetMaster(pod.Name)
+func (c *Constellation) LoadNodesForPod(ctx context.Context, pod *common.RedisPod, sentinel *Sentinel) {
+	mi, err := sentinel.GetMaster(ctx, pod.Name)
 	if err != nil {
-		log.Printf("WARNING: Pod '%s' in config but not found when talking to the sentinel controller. Err: '%s'", pod.Name, err)
+		logging.Pod(pod.Name).Warnf("Pod '%s' in config but not found when talking to the sentinel controller. Err: '%s'", pod.Name, err)
 		return
 	}
 	address := fmt.Sprintf("%s:%d", mi.Host, mi.Port)
-	node, err := c.GetNode(address, pod.Name, pod.AuthToken)
+	node, err := c.GetNode(ctx, address, pod.Name, pod.AuthToken)
 	if err != nil {
-		log.Printf("Was unable to get node '%s' for pod '%s' with auth '%s'", address, pod.Name, pod.AuthToken)
+		logging.Pod(pod.Name).Errorf("Was unable to get node '%s' for pod '%s' with auth '%s'", address, pod.Name, common.MaskSecret(pod.AuthToken))
 		if strings.Contains(err.Error(), "password") {
-			log.Print("marking auth invalid")
+			logging.Debugf("marking auth invalid")
 			pod.ValidAuth = false
 		}
 		return
@@ -804,15 +829,15 @@ func (c *Constellation) LoadNodesForPod(pod *common.RedisPod, sentinel *Sentinel
 	pod.ValidAuth = true
 	slaves := node.Slaves
 	for _, si := range slaves {
-		c.GetNode(si.Name, pod.Name, pod.AuthToken)
+		c.GetNode(ctx, si.Name, pod.Name, pod.AuthToken)
 	}
 
 }
 
 // GetAllSentinelsQuietly is a convenience function used primarily in the
 // UI.
-func (c *Constellation) GetAllSentinelsQuietly() (sentinels []*Sentinel) {
-	sentinels, _ = c.GetAllSentinels()
+func (c *Constellation) GetAllSentinelsQuietly(ctx context.Context) (sentinels []*Sentinel) {
+	sentinels, _ = c.GetAllSentinels(ctx)
 	return
 }
 
@@ -823,23 +848,23 @@ func (c *Constellation) SentinelCount() int {
 
 // LoadRemotePods loads pods discovered through remote sentinel
 // interrogation or througg known-sentinel directives
-func (c *Constellation) LoadRemotePods() error {
+func (c *Constellation) LoadRemotePods(ctx context.Context) error {
 	if c.RemotePodMap == nil {
 		c.RemotePodMap = make(map[string]*common.RedisPod)
 	}
 	sentinels := []*Sentinel{&c.LocalSentinel}
-	log.Printf("Loading pods on %d sentinels", len(sentinels))
+	logging.Debugf("Loading pods on %d sentinels", len(sentinels))
 	if len(sentinels) == 0 {
 		err := fmt.Errorf("C:LP-> ERROR: All Sentinels failed connection") // This error is becoming more common in the code perhaps moving it to a dedicated method?
-		log.Println(err)
+		logging.Errorf("%s", err)
 		return err
 	}
 	for si, sentinel := range c.RemoteSentinels {
-		log.Printf("Loading remote pods on sentinel % of %", si, len(c.RemoteSentinels))
+		logging.Sentinel(si).Debugf("Loading remote pods from sentinel %s of %d", si, len(c.RemoteSentinels))
 		if sentinel.Name != c.LocalSentinel.Name {
 			pods, err := sentinel.GetPods()
 			if err != nil {
-				log.Print("C:LP-> sentinel error:", err)
+				logging.Op("LoadRemotePods").Sentinel(si).Errorf("Sentinel error: %s", err)
 				continue
 			}
 			for i, pod := range pods {
@@ -847,14 +872,14 @@ func (c *Constellation) LoadRemotePods() error {
 				if exists {
 					continue
 				}
-				log.Printf("loading pod %d of %s", i, len(pods))
+				logging.Debugf("Loading pod %s, one of %d", i, len(pods))
 				if pod.Name == "" {
-					log.Print("WUT: Have a nameless pod. This is probably a bug.")
+					logging.Sentinel(sentinel.Name).Warnf("Sentinel %s reported a pod with no name, skipping it", sentinel.Name)
 					continue
 				}
-				_, err := sentinel.GetSentinels(pod.Name)
+				_, err := sentinel.GetSentinels(ctx, pod.Name)
 				if err != nil {
-					log.Printf("WTF? Sentinel returned no sentinels list for it's own pod '%s'", pod.Name)
+					logging.Pod(pod.Name).Sentinel(sentinel.Name).Warnf("Sentinel %s monitors pod '%s' but returned no sentinels for it: %s", sentinel.Name, pod.Name, err)
 				} else {
 					podauth := c.GetPodAuth(pod.Name)
 					pod.AuthToken = podauth
@@ -878,8 +903,8 @@ func (c *Constellation) GetAnySentinel() (sentinel Sentinel, err error) {
 // state.
 // TODO: this needs to be "cloned" to a HasPodsInWarningState when that
 // refoctoring takes place.
-func (c *Constellation) HasPodsInErrorState() bool {
-	c.NumErrorPods = c.ErrorPodCount()
+func (c *Constellation) HasPodsInErrorState(ctx context.Context) bool {
+	c.NumErrorPods = c.ErrorPodCount(ctx)
 	if c.NumErrorPods > 0 {
 		return true
 	}
@@ -887,13 +912,13 @@ func (c *Constellation) HasPodsInErrorState() bool {
 }
 
 // ErrorPodCount returns the number of pods currently reporting errors
-func (c *Constellation) ErrorPodCount() (count int) {
-	log.Print("ErrorPodCount called")
+func (c *Constellation) ErrorPodCount(ctx context.Context) (count int) {
+	logging.Debugf("ErrorPodCount called")
 	if time.Since(c.LastErrorCheck) < (3 * time.Second) {
-		log.Print("short interval, not refreshing data")
+		logging.Debugf("short interval, not refreshing data")
 		return c.NumErrorPods
 	}
-	log.Print("ErrorPodCount calling full check")
+	logging.Debugf("ErrorPodCount calling full check")
 	var epods []*common.RedisPod
 	errormap := make(map[string]*common.RedisPod)
 	cleanmap := make(map[string]*common.RedisPod)
@@ -901,15 +926,26 @@ func (c *Constellation) ErrorPodCount() (count int) {
 		_, inerror := errormap[pod.Name]
 		_, clean := cleanmap[pod.Name]
 		if clean || inerror {
-			log.Printf("Pod %s is being checked for errors again..skipping", pod.Name)
+			logging.Pod(pod.Name).Debugf("Pod %s is being checked for errors again..skipping", pod.Name)
+			continue
+		}
+		if c.InMaintenance(pod.Name) {
 			continue
 		}
-		if pod.HasErrors() {
-			log.Printf("pod %s has errors", pod.Name)
+		hasErrors := pod.HasErrors(ctx)
+		if ctx.Err() != nil {
+			// A check cut short by the context says nothing about the pod
+			logging.Debugf("ErrorPodCount interrupted: %s", ctx.Err())
+			return c.NumErrorPods
+		}
+		if hasErrors {
+			logging.Pod(pod.Name).Warnf("Pod %s has errors", pod.Name)
 			errormap[pod.Name] = pod
+			c.notePodErrorState(ctx, pod, true)
 			continue
 		} else {
 			cleanmap[pod.Name] = pod
+			c.notePodErrorState(ctx, pod, false)
 		}
 	}
 	for _, pod := range errormap {
@@ -923,9 +959,9 @@ func (c *Constellation) ErrorPodCount() (count int) {
 
 // GetPodsInError is used to get the list of pods currently reporting
 // errors
-func (c *Constellation) GetPodsInError() (errors []*common.RedisPod) {
-	log.Print("GetPodsInError called")
-	c.ErrorPodCount()
+func (c *Constellation) GetPodsInError(ctx context.Context) (errors []*common.RedisPod) {
+	logging.Debugf("GetPodsInError called")
+	c.ErrorPodCount(ctx)
 	return c.PodsInError
 }
 
@@ -936,86 +972,60 @@ func (c *Constellation) PodCount() int {
 	return len(podmap)
 }
 
-// BalancePod is used to rebalance a pod. This means pulling a lis tof
-// available sentinels, determining how many are "missing" and adding
-// the pod to the appropriate number of sentinels to bring it up to spec
-func (c *Constellation) BalancePod(pod *common.RedisPod) {
-	pod, _ = c.GetPod(pod.Name) // testing a theory
-	log.Print("Balance called on Pod" + pod.Name)
-	neededTotal := pod.Info.Quorum + 1
-	sentinels := c.GetSentinelsForPod(pod.Name)
-	pod.SentinelCount = len(sentinels)
-	log.Printf("Pod needs %d sentinels, has %d sentinels", neededTotal, pod.SentinelCount)
-	if pod.SentinelCount < neededTotal {
-		log.Printf("Attempting rebalance of %s \n'%+v' ", pod.Name, pod)
-		needed := neededTotal - pod.SentinelCount
-		if pod.AuthToken == "" {
-			pod.AuthToken = c.GetPodAuth(pod.Name)
-		}
-		log.Printf("%s on %d sentinels, needs %d more", pod.Name, pod.SentinelCount, needed)
-		sentinels, _ := c.GetAvailableSentinels(pod.Name, needed)
-		log.Printf("Request %d sentinels for %s, got %d to use", needed, pod.Name, len(sentinels))
-		isLocal := false
-		for _, sentinel := range sentinels {
-			log.Print("Adding to sentinel ", sentinel.Name)
-			if sentinel.Name == c.LocalSentinel.Name {
-				isLocal = true
-			}
-			pod, err := sentinel.MonitorPod(pod.Name, pod.Info.IP, pod.Info.Port, pod.Info.Quorum, pod.AuthToken)
-			if err != nil {
-				log.Printf("Sentinel %s Pod: %s, Error: %s", sentinel.Name, pod.Name, err)
-				continue
-			}
-			c.PodToSentinelsMap[pod.Name] = append(c.PodToSentinelsMap[pod.Name], sentinel)
-		}
-		time.Sleep(500 * time.Millisecond) // wait for propagation between sentinels
-		slist := c.GetSentinelsForPod(pod.Name)
-		c.PodToSentinelsMap[pod.Name] = slist
-		pod.SentinelCount = len(slist)
-		if isLocal {
-			c.LocalPodMap[pod.Name] = pod
-		} else {
-			c.RemotePodMap[pod.Name] = pod
-		}
-		log.Printf("Rebalance of %s completed, it now has %d sentinels", pod.Name, pod.SentinelCount)
-	} else if pod.SentinelCount > neededTotal {
-		remove := pod.SentinelCount - neededTotal
-		log.Printf("[%s] has too many sentinels, reducing sentinel count by %d", pod.Name, remove)
-		index := rand.Intn(neededTotal)
-		sentinel := sentinels[index]
-		ok, err := sentinel.RemovePod(pod.Name)
-		if !ok || err != nil {
-			log.Printf("Unable to remove %s from %s. Err:", pod.Name, sentinel.Name)
+// BalancePod is used to rebalance a pod. It plans the moves needed to bring
+// the pod to quorum+1 sentinels and executes them. See PlanPodRebalance for
+// how sentinels are chosen. Pods in maintenance are only balanced when
+// forced.
+func (c *Constellation) BalancePod(ctx context.Context, pod *common.RedisPod, force bool) error {
+	logging.Pod(pod.Name).Infof("Balance called on pod %s", pod.Name)
+	if !force && c.InMaintenance(pod.Name) {
+		logging.Pod(pod.Name).Warnf("Pod %s is in maintenance, not balancing", pod.Name)
+		return ErrPodInMaintenance
+	}
+	plan, err := c.PlanPodRebalance(ctx, pod.Name)
+	if err != nil {
+		logging.Pod(pod.Name).Errorf("Unable to plan rebalance of %s. Err: %s", pod.Name, err)
+		return err
+	}
+	for _, warning := range plan.Warnings {
+		logging.Warnf("Rebalance warning: %s", warning)
+	}
+	report := c.ExecuteRebalance(ctx, plan)
+	for _, res := range report.Results {
+		if res.Error != "" {
+			logging.Pod(res.Move.Pod).Sentinel(res.Move.Sentinel).Errorf("Unable to %s %s on %s. Err: %s", res.Move.Action, res.Move.Pod, res.Move.Sentinel, res.Error)
 		}
-		c.ResetPod(pod.Name, true)
 	}
+	return nil
 }
 
 // Balance will attempt to balance the constellation
 // A constellation is unbalanced if any pod is not listed as managed by enough
 // sentinels to achieve quorum+1
-// It will first verify the current balance state to avoid unnecessary balance
-// attempts.
-// This will likely be deprecated
-func (c *Constellation) Balance() {
-	log.Print("Balance called on constellation")
-	c.HasPodsInErrorState()
-	allpods := c.GetPods()
-
-	log.Printf("Constellation rebalance initiated, have %d pods unbalanced", len(c.PodsInError))
-	for _, pod := range allpods {
-		c.BalancePod(pod)
+// It plans the moves for every pod together, so sentinel load is spread
+// across the whole constellation, then executes them.
+func (c *Constellation) Balance(ctx context.Context) {
+	logging.Debugf("Balance called on constellation")
+	c.HasPodsInErrorState(ctx)
+	plan, err := c.PlanRebalance(ctx)
+	if err != nil {
+		logging.Errorf("Unable to plan constellation rebalance. Err: %s", err)
+		return
 	}
+	logging.Infof("Constellation rebalance initiated, %d moves planned", len(plan.Moves))
+	c.ExecuteRebalance(ctx, plan)
 	c.Balanced = true
 }
 
 // Getmaster returns the current structures.MasterAddress struct for the given
-// pod
-func (c *Constellation) GetMaster(podname string) (master structures.MasterAddress, err error) {
-	sentinels, _ := c.GetAllSentinels()
+// pod. A master differing from the last one seen publishes a master change
+// event.
+func (c *Constellation) GetMaster(ctx context.Context, podname string) (master structures.MasterAddress, err error) {
+	sentinels, _ := c.GetAllSentinels(ctx)
 	for _, sentinel := range sentinels {
-		master, err := sentinel.GetMaster(podname)
+		master, err := sentinel.GetMaster(ctx, podname)
 		if err == nil {
+			c.noteMaster(podname, sentinel.Name, fmt.Sprintf("%s:%d", master.Host, master.Port))
 			return master, nil
 		}
 	}
@@ -1023,20 +1033,20 @@ func (c *Constellation) GetMaster(podname string) (master structures.MasterAddre
 }
 
 // GetPod returns a *common.RedisPod instance for the given podname
-func (c *Constellation) GetPod(podname string) (pod *common.RedisPod, err error) {
+func (c *Constellation) GetPod(ctx context.Context, podname string) (pod *common.RedisPod, err error) {
 	pod, islocal := c.LocalPodMap[podname]
 
 	if islocal {
-		spod, err := c.LocalSentinel.GetPod(podname)
+		spod, err := c.LocalSentinel.GetPod(ctx, podname)
 		address := fmt.Sprintf("%s:%d", spod.Info.IP, spod.Info.Port)
 		auth := spod.AuthToken
 		if auth == "" {
 			auth = c.GetPodAuth(podname)
 		}
-		master, _ := c.GetNode(address, podname, auth)
+		master, _ := c.GetNode(ctx, address, podname, auth)
 		spod.Master = master
-		c.LocalSentinel.GetSlaves(podname)
-		c.LoadNodesForPod(pod, &c.LocalSentinel)
+		c.LocalSentinel.GetSlaves(ctx, podname)
+		c.LoadNodesForPod(ctx, pod, &c.LocalSentinel)
 		pod = &spod
 		c.LocalPodMap[podname] = pod
 		c.PodMap[podname] = pod
@@ -1045,21 +1055,25 @@ func (c *Constellation) GetPod(podname string) (pod *common.RedisPod, err error)
 	if pod == nil || pod.Master != nil {
 		return pod, nil
 	}
-	sentinels, _ := c.GetAllSentinels()
+	sentinels, _ := c.GetAllSentinels(ctx)
 	for _, s := range sentinels {
-		conn, err := s.GetConnection()
+		conn, err := s.GetConnection(ctx)
 		if err != nil {
-			log.Printf("Unable to connect to sentinel '%s'", s.Name)
+			logging.Sentinel(s.Name).Errorf("Unable to connect to sentinel '%s'", s.Name)
 			continue
 		}
 		defer conn.ClosePool()
-		mi, _ := conn.SentinelMasterInfo(podname)
+		var mi structures.MasterInfo
+		common.Do(ctx, func() (err error) {
+			mi, err = conn.SentinelMasterInfo(podname)
+			return err
+		})
 		if mi.Name == podname {
 			auth := c.GetPodAuth(podname)
 			address := fmt.Sprintf("%s:%d", mi.IP, mi.Port)
-			master, err := c.GetNode(address, podname, auth)
+			master, err := c.GetNode(ctx, address, podname, auth)
 			if err != nil {
-				log.Print("Unable to get master node ===========")
+				logging.Errorf("Unable to get master node")
 			}
 			pod, _ := NewMasterFromMasterInfo(mi, auth)
 			pod.Master = master
@@ -1069,17 +1083,17 @@ func (c *Constellation) GetPod(podname string) (pod *common.RedisPod, err error)
 	}
 
 	if err != nil {
-		log.Printf("Could NOT load pod '%s' from %s", podname, err)
+		logging.Pod(podname).Errorf("Could NOT load pod '%s' from %s", podname, err)
 		return pod, err
 	}
 	return pod, nil
 }
 
 // GetSlaves return a list of client.SlaveInfo structs for the given pod
-func (c *Constellation) GetSlaves(podname string) (slaves []structures.SlaveInfo, err error) {
-	sentinels, err := c.GetAllSentinels()
+func (c *Constellation) GetSlaves(ctx context.Context, podname string) (slaves []structures.SlaveInfo, err error) {
+	sentinels, err := c.GetAllSentinels(ctx)
 	for _, sentinel := range sentinels {
-		slaves, err = sentinel.GetSlaves(podname)
+		slaves, err = sentinel.GetSlaves(ctx, podname)
 		if err == nil {
 			return
 		}
@@ -1093,7 +1107,7 @@ func (c *Constellation) GetPods() (pods []*common.RedisPod) {
 	havepods := make(map[string]interface{})
 	for _, pod := range podmap {
 		if pod.Name == "" {
-			log.Print("WUT: Have a nameless pod. Probably a bug")
+			logging.Warnf("Constellation's pod map holds a pod with no name, skipping it")
 			continue
 		}
 		_, have := havepods[pod.Name]
@@ -1149,7 +1163,7 @@ func (c *Constellation) extractSentinelDirective(entries []string) error {
 		pname := entries[1]
 		pc := c.SentinelConfig.ManagedPodConfigs[pname]
 		pc.AuthToken = entries[2]
-		c.PodAuthMap[pname] = pc.AuthToken
+		c.setPodAuth(pname, pc.AuthToken, "config")
 		c.SentinelConfig.ManagedPodConfigs[pname] = pc
 		return nil
 
@@ -1158,26 +1172,22 @@ func (c *Constellation) extractSentinelDirective(entries []string) error {
 		sentinel_address := entries[2] + ":" + entries[3]
 		pc := c.SentinelConfig.ManagedPodConfigs[podname]
 		pc.Sentinels[sentinel_address] = ""
-		if c.Peers == nil {
+		if c.Credentials == nil {
 			// This means the sentinel config has no bind statement
 			// So we will pull the local IP and use it
 			// I don't like this but dont' have a great option either.
 			myhostname, err := os.Hostname()
 			if err != nil {
-				log.Print(err)
+				logging.Errorf("%s", err)
 			}
 			myip, err := net.LookupHost(myhostname)
 			if err != nil {
-				log.Print(err)
+				logging.Errorf("%s", err)
 			}
 			c.LocalSentinel.Host = myip[0]
-			log.Printf("NO BIND STATEMENT FOUND. USING: '%s'", c.LocalSentinel.Host)
-			me := "http://" + c.SentinelConfig.Host + ":" + GCPORT
-			c.Peers = groupcache.NewHTTPPool(me)
+			logging.Warnf("NO BIND STATEMENT FOUND. USING: '%s'", c.LocalSentinel.Host)
 			c.PeerList[c.SentinelConfig.Host+fmt.Sprintf(":%d", c.SentinelConfig.Port)] = c.SentinelConfig.Host
-			c.SetPeers()
-			go http.ListenAndServe(c.SentinelConfig.Host+":"+GCPORT, http.HandlerFunc(c.Peers.ServeHTTP))
-			c.StartCache()
+			c.StartCredentialStore()
 		}
 		c.ConfiguredSentinels[sentinel_address] = sentinel_address
 		return nil
@@ -1192,7 +1202,7 @@ func (c *Constellation) extractSentinelDirective(entries []string) error {
 
 	default:
 		err := fmt.Errorf("Unhandled sentinel directive: %+v", entries)
-		log.Print(err)
+		logging.Errorf("%s", err)
 		return nil
 	}
 }
@@ -1202,7 +1212,7 @@ func (c *Constellation) extractSentinelDirective(entries []string) error {
 func (c *Constellation) LoadSentinelConfigFile() error {
 	file, err := os.Open(c.SentinelConfigName)
 	if err != nil {
-		log.Print(err)
+		logging.Errorf("%s", err)
 		return err
 	}
 	defer file.Close()
@@ -1223,7 +1233,7 @@ func (c *Constellation) LoadSentinelConfigFile() error {
 				if err != nil {
 					// TODO: Fix this to return a different error if we can't
 					// connect to the sentinel
-					log.Printf("Misshapen sentinel directive: '%s'", line)
+					logging.Warnf("Misshapen sentinel directive: '%s'", line)
 				}
 			case "port":
 				iport, _ := strconv.Atoi(entries[1])
@@ -1233,47 +1243,39 @@ func (c *Constellation) LoadSentinelConfigFile() error {
 				c.SentinelConfig.Dir = entries[1]
 			case "bind":
 				if c.LocalOverrides.BindAddress > "" {
-					log.Printf("Overriding Sentinel BIND directive '%s' with '%s'", entries[1], c.LocalOverrides.BindAddress)
+					logging.Warnf("Overriding Sentinel BIND directive '%s' with '%s'", entries[1], c.LocalOverrides.BindAddress)
 				} else {
 					c.SentinelConfig.Host = entries[1]
-					if c.Peers == nil {
-						me := "http://" + c.SentinelConfig.Host + ":" + GCPORT
-						c.Peers = groupcache.NewHTTPPool(me)
+					if c.Credentials == nil {
 						c.PeerList[c.SentinelConfig.Host+fmt.Sprintf(":%d", c.SentinelConfig.Port)] = c.SentinelConfig.Host
-						c.SetPeers()
-						go http.ListenAndServe(c.SentinelConfig.Host+":"+GCPORT, http.HandlerFunc(c.Peers.ServeHTTP))
-						c.StartCache()
+						c.StartCredentialStore()
 					}
 				}
-				log.Printf("Local sentinel is listening on IP %s", c.SentinelConfig.Host)
+				logging.Debugf("Local sentinel is listening on IP %s", c.SentinelConfig.Host)
 			case "":
 				if err == io.EOF {
-					log.Print("File load complete?")
+					logging.Debugf("File load complete?")
 					if c.LocalOverrides.BindAddress > "" {
 						c.SentinelConfig.Host = c.LocalOverrides.BindAddress
-						log.Printf("Local sentinel is listening on IP %s", c.SentinelConfig.Host)
+						logging.Debugf("Local sentinel is listening on IP %s", c.SentinelConfig.Host)
 					} else {
-						if c.Peers == nil {
+						if c.Credentials == nil {
 							// This means the sentinel config has no bind statement
 							// So we will pull the local IP and use it
 							// I don't like this but dont' have a great option either.
 							myhostname, err := os.Hostname()
 							if err != nil {
-								log.Print(err)
+								logging.Errorf("%s", err)
 							}
 							myip, err := net.LookupHost(myhostname)
 							if err != nil {
-								log.Print(err)
+								logging.Errorf("%s", err)
 							}
-							log.Printf("myip: %+v", myip)
+							logging.Debugf("myip: %+v", myip)
 							c.LocalSentinel.Host = myip[0]
-							log.Printf("NO BIND STATEMENT FOUND. USING: '%s'", c.LocalSentinel.Host)
-							me := "http://" + c.SentinelConfig.Host + ":" + GCPORT
-							c.Peers = groupcache.NewHTTPPool(me)
+							logging.Warnf("NO BIND STATEMENT FOUND. USING: '%s'", c.LocalSentinel.Host)
 							c.PeerList[c.SentinelConfig.Host+fmt.Sprintf(":%d", c.SentinelConfig.Port)] = c.SentinelConfig.Host
-							c.SetPeers()
-							go http.ListenAndServe(c.SentinelConfig.Host+":"+GCPORT, http.HandlerFunc(c.Peers.ServeHTTP))
-							c.StartCache()
+							c.StartCredentialStore()
 						}
 					}
 					if c.Name == "" {
@@ -1285,34 +1287,40 @@ func (c *Constellation) LoadSentinelConfigFile() error {
 				//log.Printf("Found %d REMOTE sentinels", len(c.RemoteSentinels))
 				//return nil
 			default:
-				log.Printf("UNhandled Sentinel Directive: %s", line)
+				logging.Warnf("UNhandled Sentinel Directive: %s", line)
 			}
 		} else {
-			log.Print("=============== LOAD FILE ERROR ===============")
-			log.Fatal(err)
+			logging.Errorf("Unable to load sentinel config file")
+			logging.Fatalf("%s", err)
 		}
 	}
 }
 
 // ResetPod this is the constellation cluster level call to issue a reset
 // against the sentinels for the given pod.
-func (c *Constellation) ResetPod(podname string, simultaneous bool) {
-	sentinels := c.GetSentinelsForPod(podname)
-	log.Printf("Calling reset on %d sentinels for pod '%s'", len(sentinels), podname)
+func (c *Constellation) ResetPod(ctx context.Context, podname string, simultaneous bool) {
+	sentinels := c.GetSentinelsForPod(ctx, podname)
+	logging.Pod(podname).Debugf("Calling reset on %d sentinels for pod '%s'", len(sentinels), podname)
 	if len(sentinels) == 0 {
-		log.Print("ERROR: Attempt to call resre on pod with no sentinels??:" + podname)
+		logging.Pod(podname).Errorf("Attempt to call reset on pod %s with no sentinels", podname)
 		return
 	}
+	var wg sync.WaitGroup
 	for _, sentinel := range sentinels {
-		log.Print("Issuing reset for " + podname)
+		logging.Pod(podname).Debugf("Issuing reset for %s", podname)
 		if simultaneous {
-			go sentinel.ResetPod(podname)
+			wg.Add(1)
+			go func(sentinel *Sentinel) {
+				defer wg.Done()
+				sentinel.ResetPod(ctx, podname)
+			}(sentinel)
 		} else {
-			sentinel.ResetPod(podname)
-			time.Sleep(2 * time.Second)
+			sentinel.ResetPod(ctx, podname)
+			common.Sleep(ctx, 2*time.Second)
 		}
 	}
-	c.GetAllSentinelsQuietly()
+	wg.Wait()
+	c.GetAllSentinelsQuietly(ctx)
 }
 
 // By is a convenience type to enable sorting sentinels by their
@@ -1349,79 +1357,18 @@ func (s *sentinelSorter) Less(i, j int) bool {
 	return s.by(s.sentinels[i], s.sentinels[j])
 }
 
-// PodAuthCache is a struct used for groupcache to propogate
-// authentication informaton for a pod.
-type PodAuthCache struct {
-	cacheGroup *groupcache.Group
-	CacheType  string
-}
-
-// NewCache creates a new PodAuthCache
-func NewCache(cacheGroup *groupcache.Group) *PodAuthCache {
-	cache := new(PodAuthCache)
-	cache.cacheGroup = cacheGroup
-	return cache
-}
-
-// GetStats returns the MainCache metrics
-func (pc *PodAuthCache) GetStats() groupcache.CacheStats {
-	return pc.cacheGroup.CacheStats(groupcache.MainCache)
-}
-
-// GetStats returns the HotCache metrics
-func (pc *PodAuthCache) GetHotStats() groupcache.CacheStats {
-	return pc.cacheGroup.CacheStats(groupcache.HotCache)
-}
-
-// Get is used by GroupCache to load a key not found in the cache
-func (pc *PodAuthCache) Get(podname string) string {
-	var auth string
-	pc.cacheGroup.Get(nil, podname, groupcache.StringSink(&auth))
-	return auth
-}
-
 // GetAddressPair is a convenience function for converting an ip and port
 // into the ip:port string. Probably need to move this to the common
 // package
 func GetAddressPair(astring string) (host string, port int, err error) {
 	apair := strings.Split(astring, ":")
+	if len(apair) != 2 {
+		return host, port, fmt.Errorf("'%s' is not an ip:port pair", astring)
+	}
 	host = apair[0]
 	port, err = strconv.Atoi(apair[1])
 	if err != nil {
-		log.Printf("Unable to convert %s to port integer!", apair[1])
+		logging.Errorf("Unable to convert %s to port integer!", apair[1])
 	}
 	return
 }
-
-//ValidatePodSentinels will attempt to connect to each sentinel listed for a pod
-// and pull the master info from it. This is to validate we can 1) connect to
-// it, and 2) it actually has the pod in it's list
-func (c *Constellation) ValidatePodSentinels(podname string) (map[string]bool, error) {
-	_, exists := c.PodMap[podname]
-	checks := make(map[string]bool)
-	if !exists {
-		return checks, errors.New("Pod not found")
-	}
-	allvalid := true
-	//PodToSentinelsMap   map[string][]*Sentinel
-	for _, s := range c.PodToSentinelsMap[podname] {
-		sname := s.Name
-		sc, err := client.DialWithConfig(&client.DialConfig{Address: s.Name})
-		if err != nil {
-			checks[sname] = false
-			allvalid = false
-			continue
-		}
-		_, err = sc.SentinelGetMaster(podname)
-		if err != nil {
-			checks[sname] = false
-			allvalid = false
-			continue
-		}
-		checks[sname] = true
-	}
-	if !allvalid {
-		return checks, errors.New("Not all sentinels validated")
-	}
-	return checks, nil
-}
@@ -0,0 +1,438 @@
+package actions
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-shared/logging"
+)
+
+// CredentialPort is the port RedSkull peers share pod credentials on
+var CredentialPort = 8008
+
+// CredentialStoreFile is the file credentials are persisted to, encrypted
+// with SecretKey. When empty credentials are only held in memory.
+var CredentialStoreFile string
+
+// maxCredentialVersions is how many versions of each credential are kept
+const maxCredentialVersions = 10
+
+// credentialSkew is how far a peer request's timestamp may be from ours
+const credentialSkew = 5 * time.Minute
+
+// CredentialMissTTL is how long a pod no peer had a credential for is not
+// asked about again
+var CredentialMissTTL = time.Minute
+
+// CredentialStore holds pod credentials. It is encrypted at rest with
+// SecretKey and replicated between RedSkull peers over HTTP. Peer requests
+// are signed with a key derived from SecretKey and payloads are encrypted
+// with it, so only peers sharing the key file can read or write. Without a
+// SecretKey the store is memory-only and not shared.
+type CredentialStore struct {
+	sync.RWMutex
+	saving  sync.Mutex
+	path    string
+	key     []byte
+	records map[string][]common.CredentialVersion
+	misses  map[string]time.Time
+	peers   []string
+	client  *http.Client
+}
+
+// NewCredentialStore creates a store, loading any credentials already
+// persisted at path
+func NewCredentialStore(path string, key []byte) (*CredentialStore, error) {
+	cs := &CredentialStore{
+		path:    path,
+		key:     key,
+		records: make(map[string][]common.CredentialVersion),
+		misses:  make(map[string]time.Time),
+		client:  &http.Client{Timeout: 2 * time.Second},
+	}
+	if len(key) == 0 {
+		logging.Warnf("No secret key configured; pod credentials will not be persisted or shared with peers")
+		return cs, nil
+	}
+	if path == "" {
+		return cs, nil
+	}
+	err := cs.load()
+	if os.IsNotExist(err) {
+		return cs, nil
+	}
+	return cs, err
+}
+
+// Shared returns true if the store can persist and replicate credentials
+func (cs *CredentialStore) Shared() bool {
+	return len(cs.key) > 0
+}
+
+// Get returns the current credential for the pod
+func (cs *CredentialStore) Get(podname string) (string, bool) {
+	cs.RLock()
+	defer cs.RUnlock()
+	versions := cs.records[podname]
+	if len(versions) == 0 {
+		return "", false
+	}
+	return versions[len(versions)-1].Secret, true
+}
+
+// Set records a new version of the pod's credential if it differs from the
+// current one, persists the store and pushes the change to peers
+func (cs *CredentialStore) Set(podname, secret, source string) bool {
+	if secret == "" {
+		return false
+	}
+	cs.Lock()
+	versions := cs.records[podname]
+	if len(versions) > 0 && versions[len(versions)-1].Secret == secret {
+		cs.Unlock()
+		return false
+	}
+	next := common.CredentialVersion{Version: 1, Secret: secret, Updated: time.Now(), Source: source}
+	if len(versions) > 0 {
+		next.Version = versions[len(versions)-1].Version + 1
+	}
+	cs.records[podname] = trimVersions(append(versions, next))
+	cs.Unlock()
+	if err := cs.save(); err != nil {
+		logging.Errorf("Unable to persist credential store: %s", err)
+	}
+	go cs.push(podname)
+	return true
+}
+
+// Versions returns the recorded versions of the pod's credential with the
+// secrets masked
+func (cs *CredentialStore) Versions(podname string) []common.CredentialVersion {
+	cs.RLock()
+	defer cs.RUnlock()
+	var versions []common.CredentialVersion
+	for _, v := range cs.records[podname] {
+		v.Secret = common.MaskSecret(v.Secret)
+		versions = append(versions, v)
+	}
+	return versions
+}
+
+// Count returns the number of pods with a stored credential
+func (cs *CredentialStore) Count() int {
+	cs.RLock()
+	defer cs.RUnlock()
+	return len(cs.records)
+}
+
+// SetPeers sets the addresses (host:port) of the peers to replicate with
+func (cs *CredentialStore) SetPeers(peers []string) {
+	sort.Strings(peers)
+	cs.Lock()
+	cs.peers = peers
+	cs.Unlock()
+}
+
+// Fetch asks each peer for the pod's credential, merging what they return,
+// and returns the resulting current credential. If no peer has one, peers
+// are not asked about the pod again for CredentialMissTTL.
+func (cs *CredentialStore) Fetch(podname string) (string, bool) {
+	if !cs.Shared() {
+		return "", false
+	}
+	cs.RLock()
+	peers := cs.peers
+	missed, recent := cs.misses[podname]
+	cs.RUnlock()
+	if recent && time.Since(missed) < CredentialMissTTL {
+		return "", false
+	}
+	for _, peer := range peers {
+		versions, err := cs.peerRequest("GET", peer, podname, nil)
+		if err != nil {
+			logging.Pod(podname).Errorf("Unable to fetch credential for %s from peer %s: %s", podname, peer, err)
+			continue
+		}
+		if cs.merge(podname, versions) {
+			if err := cs.save(); err != nil {
+				logging.Errorf("Unable to persist credential store: %s", err)
+			}
+		}
+		if secret, ok := cs.Get(podname); ok {
+			return secret, true
+		}
+	}
+	cs.Lock()
+	cs.misses[podname] = time.Now()
+	cs.Unlock()
+	return "", false
+}
+
+// push sends the pod's credential history to every peer
+func (cs *CredentialStore) push(podname string) {
+	if !cs.Shared() {
+		return
+	}
+	cs.RLock()
+	peers := cs.peers
+	versions := append([]common.CredentialVersion(nil), cs.records[podname]...)
+	cs.RUnlock()
+	for _, peer := range peers {
+		if _, err := cs.peerRequest("POST", peer, podname, versions); err != nil {
+			logging.Pod(podname).Errorf("Unable to push credential for %s to peer %s: %s", podname, peer, err)
+		}
+	}
+}
+
+// merge folds a peer's versions into ours, keeping the union ordered by
+// version. Where both sides hold the same version number the later update
+// wins. It returns true if anything changed.
+func (cs *CredentialStore) merge(podname string, theirs []common.CredentialVersion) bool {
+	if len(theirs) == 0 {
+		return false
+	}
+	cs.Lock()
+	defer cs.Unlock()
+	byVersion := make(map[int]common.CredentialVersion)
+	for _, v := range cs.records[podname] {
+		byVersion[v.Version] = v
+	}
+	changed := false
+	for _, v := range theirs {
+		mine, have := byVersion[v.Version]
+		if !have || (v.Updated.After(mine.Updated) && v.Secret != mine.Secret) {
+			v.Source = "peer"
+			byVersion[v.Version] = v
+			changed = true
+		}
+	}
+	if !changed {
+		return false
+	}
+	var merged []common.CredentialVersion
+	for _, v := range byVersion {
+		merged = append(merged, v)
+	}
+	sort.Sort(credentialVersions(merged))
+	cs.records[podname] = trimVersions(merged)
+	return true
+}
+
+// ServeHTTP answers peer requests. GET /credentials/POD returns the pod's
+// history, POST /credentials/POD merges the posted history.
+func (cs *CredentialStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, "/credentials/") {
+		http.NotFound(w, r)
+		return
+	}
+	podname := strings.TrimPrefix(r.URL.Path, "/credentials/")
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := cs.verify(r, body); err != nil {
+		logging.Warnf("Rejected credential request from %s: %s", r.RemoteAddr, err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	switch r.Method {
+	case "GET":
+		cs.RLock()
+		versions := cs.records[podname]
+		cs.RUnlock()
+		payload, err := cs.seal(versions)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(payload)
+	case "POST":
+		versions, err := cs.open(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if cs.merge(podname, versions) {
+			logging.Pod(podname).Infof("Received updated credential for %s from peer %s", podname, r.RemoteAddr)
+			if err := cs.save(); err != nil {
+				logging.Errorf("Unable to persist credential store: %s", err)
+			}
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Listen serves peer requests on the given address
+func (cs *CredentialStore) Listen(address string) {
+	if !cs.Shared() {
+		return
+	}
+	logging.Infof("Serving credential store to peers on %s", address)
+	err := http.ListenAndServe(address, cs)
+	if err != nil {
+		logging.Errorf("Credential store listener error: %s", err)
+	}
+}
+
+func (cs *CredentialStore) peerRequest(method, peer, podname string, versions []common.CredentialVersion) ([]common.CredentialVersion, error) {
+	var body []byte
+	if versions != nil {
+		sealed, err := cs.seal(versions)
+		if err != nil {
+			return nil, err
+		}
+		body = sealed
+	}
+	path := "/credentials/" + podname
+	req, err := http.NewRequest(method, "http://"+peer+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("X-Redskull-Timestamp", ts)
+	req.Header.Set("X-Redskull-Signature", cs.signature(method, path, ts, body))
+	resp, err := cs.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("peer returned %s", resp.Status)
+	}
+	if method != "GET" {
+		return nil, nil
+	}
+	return cs.open(data)
+}
+
+// signature is the HMAC of the request under a key derived from SecretKey
+func (cs *CredentialStore) signature(method, path, ts string, body []byte) string {
+	derived := sha256.Sum256(append([]byte("redskull-credential-peer:"), cs.key...))
+	mac := hmac.New(sha256.New, derived[:])
+	fmt.Fprintf(mac, "%s\n%s\n%s\n", method, path, ts)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (cs *CredentialStore) verify(r *http.Request, body []byte) error {
+	if !cs.Shared() {
+		return errors.New("credential sharing is disabled")
+	}
+	ts := r.Header.Get("X-Redskull-Timestamp")
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return errors.New("missing timestamp")
+	}
+	skew := time.Since(time.Unix(unix, 0))
+	if skew > credentialSkew || skew < -credentialSkew {
+		return errors.New("timestamp outside allowed window")
+	}
+	expected := cs.signature(r.Method, r.URL.Path, ts, body)
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get("X-Redskull-Signature"))) {
+		return errors.New("bad signature")
+	}
+	return nil
+}
+
+func (cs *CredentialStore) seal(versions []common.CredentialVersion) ([]byte, error) {
+	data, err := json.Marshal(versions)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := common.EncryptSecret(cs.key, string(data))
+	return []byte(sealed), err
+}
+
+func (cs *CredentialStore) open(data []byte) ([]common.CredentialVersion, error) {
+	var versions []common.CredentialVersion
+	if len(data) == 0 {
+		return versions, nil
+	}
+	if !common.IsEncryptedSecret(string(data)) {
+		return nil, errors.New("payload is not encrypted")
+	}
+	plain, err := common.DecryptSecret(cs.key, string(data))
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal([]byte(plain), &versions)
+	return versions, err
+}
+
+// save writes the whole store, encrypted, to its file. Saves are made one at
+// a time, so an older copy of the store never replaces a newer one.
+func (cs *CredentialStore) save() error {
+	if !cs.Shared() || cs.path == "" {
+		return nil
+	}
+	cs.saving.Lock()
+	defer cs.saving.Unlock()
+	cs.RLock()
+	data, err := json.Marshal(cs.records)
+	cs.RUnlock()
+	if err != nil {
+		return err
+	}
+	sealed, err := common.EncryptSecret(cs.key, string(data))
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(cs.path), ".credentials")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.WriteString(sealed); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	tmp.Close()
+	return os.Rename(tmp.Name(), cs.path)
+}
+
+func (cs *CredentialStore) load() error {
+	data, err := ioutil.ReadFile(cs.path)
+	if err != nil {
+		return err
+	}
+	plain, err := common.DecryptSecret(cs.key, strings.TrimSpace(string(data)))
+	if err != nil {
+		return fmt.Errorf("Unable to decrypt credential store %s: %s", cs.path, err)
+	}
+	return json.Unmarshal([]byte(plain), &cs.records)
+}
+
+func trimVersions(versions []common.CredentialVersion) []common.CredentialVersion {
+	if len(versions) > maxCredentialVersions {
+		return versions[len(versions)-maxCredentialVersions:]
+	}
+	return versions
+}
+
+// credentialVersions sorts versions oldest first
+type credentialVersions []common.CredentialVersion
+
+func (v credentialVersions) Len() int           { return len(v) }
+func (v credentialVersions) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v credentialVersions) Less(i, j int) bool { return v[i].Version < v[j].Version }
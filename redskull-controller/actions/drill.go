@@ -0,0 +1,681 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/therealbill/libredis/client"
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-controller/events"
+	"github.com/therealbill/redskull/redskull-shared/logging"
+)
+
+// maxDrillReports is how many drill reports are kept
+const maxDrillReports = 500
+
+// DrillPollInterval is how often sentinels are asked for a pod's master
+// while a drill waits for a failover to be seen
+var DrillPollInterval = 250 * time.Millisecond
+
+// DrillCheckInterval is how often the drill scheduler looks for pods due a
+// drill
+var DrillCheckInterval = time.Minute
+
+// ErrDrillInProgress is returned when a drill is started on a pod which is
+// already being drilled
+var ErrDrillInProgress = errors.New("A drill of this pod is already in progress")
+
+// drilling holds the pods with a drill in progress
+var drilling = struct {
+	sync.Mutex
+	pods map[string]bool
+}{pods: make(map[string]bool)}
+
+// DrillRunning returns true if the pod is being drilled
+func DrillRunning(podname string) bool {
+	drilling.Lock()
+	defer drilling.Unlock()
+	return drilling.pods[podname]
+}
+
+// DrillConfig is the drill schedule configuration file
+type DrillConfig struct {
+	Schedules []common.DrillSchedule `json:"schedules" yaml:"schedules"`
+}
+
+// LoadDrillConfig reads and validates a YAML or JSON drill schedule file
+func LoadDrillConfig(file string) (cfg DrillConfig, err error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return cfg, err
+	}
+	err = common.ParseConfig(data, &cfg)
+	if err != nil {
+		return cfg, fmt.Errorf("Unable to parse drill config: %s", err)
+	}
+	for i, s := range cfg.Schedules {
+		if err := s.Validate(); err != nil {
+			return cfg, fmt.Errorf("Drill schedule %d: %s", i+1, err)
+		}
+	}
+	return cfg, nil
+}
+
+// DrillStore holds the reports of past drills, newest first, persisted as
+// JSON in the data directory. It also holds the slave priorities a drill's
+// failback has pinned and not yet restored, persisted next to the reports,
+// so they can be restored after a restart.
+type DrillStore struct {
+	sync.RWMutex
+	saving  sync.Mutex
+	path    string
+	reports []common.DrillReport
+	pins    map[string]map[string]string
+}
+
+// NewDrillStore creates a store, loading any reports and pinned priorities
+// already persisted at path
+func NewDrillStore(path string) (*DrillStore, error) {
+	ds := &DrillStore{path: path, pins: make(map[string]map[string]string)}
+	if path == "" {
+		return ds, nil
+	}
+	if err := loadJSON(path, &ds.reports); err != nil {
+		return ds, err
+	}
+	return ds, loadJSON(ds.pinsPath(), &ds.pins)
+}
+
+// loadJSON unpacks the file at path into v, leaving v alone if the file
+// does not exist
+func loadJSON(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// pinsPath is where pinned priorities are persisted
+func (ds *DrillStore) pinsPath() string {
+	return filepath.Join(filepath.Dir(ds.path), "drill-priorities.json")
+}
+
+// Pin records the slave-priority to restore on the pod's node at address
+func (ds *DrillStore) Pin(podname, address, priority string) error {
+	ds.Lock()
+	if ds.pins[podname] == nil {
+		ds.pins[podname] = make(map[string]string)
+	}
+	ds.pins[podname][address] = priority
+	ds.Unlock()
+	return ds.save()
+}
+
+// Unpin forgets the priority pinned on the pod's node at address, once it
+// has been restored
+func (ds *DrillStore) Unpin(podname, address string) error {
+	ds.Lock()
+	delete(ds.pins[podname], address)
+	if len(ds.pins[podname]) == 0 {
+		delete(ds.pins, podname)
+	}
+	ds.Unlock()
+	return ds.save()
+}
+
+// Pinned returns the priorities to restore, by pod and node address
+func (ds *DrillStore) Pinned() map[string]map[string]string {
+	ds.RLock()
+	defer ds.RUnlock()
+	pinned := make(map[string]map[string]string, len(ds.pins))
+	for podname, nodes := range ds.pins {
+		pinned[podname] = copyStrings(nodes)
+	}
+	return pinned
+}
+
+// Add stores a report, dropping the oldest once maxDrillReports are held
+func (ds *DrillStore) Add(report common.DrillReport) error {
+	ds.Lock()
+	ds.reports = append([]common.DrillReport{report}, ds.reports...)
+	if len(ds.reports) > maxDrillReports {
+		ds.reports = ds.reports[:maxDrillReports]
+	}
+	ds.Unlock()
+	return ds.save()
+}
+
+// Get returns the report with the given ID
+func (ds *DrillStore) Get(id string) (common.DrillReport, bool) {
+	ds.RLock()
+	defer ds.RUnlock()
+	for _, report := range ds.reports {
+		if report.ID == id {
+			return report, true
+		}
+	}
+	return common.DrillReport{}, false
+}
+
+// List returns every report, newest first
+func (ds *DrillStore) List() []common.DrillReport {
+	ds.RLock()
+	defer ds.RUnlock()
+	return append([]common.DrillReport{}, ds.reports...)
+}
+
+// Last returns the pod's most recent report, if it has been drilled
+func (ds *DrillStore) Last(podname string) (common.DrillReport, bool) {
+	ds.RLock()
+	defer ds.RUnlock()
+	for _, report := range ds.reports {
+		if report.Pod == podname {
+			return report, true
+		}
+	}
+	return common.DrillReport{}, false
+}
+
+// save writes the reports and pinned priorities to their files. Saves are
+// made one at a time, as they share the temporary files.
+func (ds *DrillStore) save() error {
+	if ds.path == "" {
+		return nil
+	}
+	ds.saving.Lock()
+	defer ds.saving.Unlock()
+	ds.RLock()
+	reports, err := json.MarshalIndent(ds.reports, "", "  ")
+	if err != nil {
+		ds.RUnlock()
+		return err
+	}
+	pins, err := json.MarshalIndent(ds.pins, "", "  ")
+	ds.RUnlock()
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(ds.path, reports); err != nil {
+		return err
+	}
+	return writeFileAtomic(ds.pinsPath(), pins)
+}
+
+// writeFileAtomic replaces the file at path with data
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	err := ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// StartDrillStore loads the drill report store from the data directory
+func (c *Constellation) StartDrillStore() {
+	path := ""
+	if DataDirectory > "" {
+		path = filepath.Join(DataDirectory, "drills.json")
+	}
+	store, err := NewDrillStore(path)
+	if err != nil {
+		logging.Errorf("Unable to load drill reports, starting empty: %s", err)
+	}
+	c.Drills = store
+}
+
+// drillStore returns the drill report store, starting it under the
+// constellation's lock if it has not been started
+func (c *Constellation) drillStore() *DrillStore {
+	c.Acquire()
+	defer c.Release()
+	if c.Drills == nil {
+		c.StartDrillStore()
+	}
+	return c.Drills
+}
+
+// RunDrill fails the pod over as a drill and, if failback is set, fails it
+// back to the original master afterwards. Each failover may take up to
+// timeout. The report is stored and a drill.finished event published
+// whether or not the drill passed. Pods in maintenance are not drilled.
+// RunDrill takes the constellation's lock for each step which uses the
+// constellation, and not while it waits for the sentinels, so it must not
+// be called with the lock held.
+func (c *Constellation) RunDrill(ctx context.Context, podname string, failback bool, timeout time.Duration, trigger string) (report common.DrillReport, err error) {
+	drilling.Lock()
+	if drilling.pods[podname] {
+		drilling.Unlock()
+		return report, ErrDrillInProgress
+	}
+	drilling.pods[podname] = true
+	drilling.Unlock()
+	defer func() {
+		drilling.Lock()
+		delete(drilling.pods, podname)
+		drilling.Unlock()
+	}()
+
+	log := logging.Op("drill").Pod(podname)
+	report = common.DrillReport{ID: newJobID(), Pod: podname, Trigger: trigger, Started: time.Now()}
+	log.Infof("Drill %s of pod '%s' started by %s", report.ID, podname, trigger)
+	report.Failure = c.drill(ctx, &report, failback, timeout)
+	report.Passed = report.Failure == ""
+	report.Finished = time.Now()
+	c.recordDrill(report)
+	if !report.Passed {
+		log.Warnf("Drill %s of pod '%s' failed: %s", report.ID, podname, report.Failure)
+		return report, errors.New(report.Failure)
+	}
+	log.Infof("Drill %s of pod '%s' passed: switch-master after %s, clients switched after %s",
+		report.ID, podname, report.Failover.SwitchMaster, report.Failover.ClientsSwitched)
+	return report, nil
+}
+
+// drill runs the drill's steps, filling in report, and returns why it
+// failed or "" if it passed
+func (c *Constellation) drill(ctx context.Context, report *common.DrillReport, failback bool, timeout time.Duration) string {
+	podname := report.Pod
+	if c.InMaintenance(podname) {
+		return ErrPodInMaintenance.Error()
+	}
+	sentinels, failure := c.drillStart(ctx, report)
+	if failure != "" {
+		return failure
+	}
+
+	var err error
+	report.Failover, err = c.drillFailover(ctx, podname, sentinels, timeout)
+	if err != nil {
+		report.Failover.Error = err.Error()
+		return fmt.Sprintf("Failover: %s", err)
+	}
+	c.noteDrillPodErrors(ctx, report, "after failover")
+	if !failback {
+		return ""
+	}
+
+	step, err := c.drillFailback(ctx, podname, report.Failover.From, sentinels, timeout)
+	report.Failback = &step
+	if err != nil {
+		step.Error = err.Error()
+		return fmt.Sprintf("Failback: %s", err)
+	}
+	c.noteDrillPodErrors(ctx, report, "after failback")
+	return ""
+}
+
+// drillStart checks, under the constellation's lock, that the pod can be
+// drilled and returns the sentinels to watch it with, or why it cannot
+func (c *Constellation) drillStart(ctx context.Context, report *common.DrillReport) (sentinels []*Sentinel, failure string) {
+	c.Acquire()
+	defer c.Release()
+	pod, err := c.podWithSentinelCount(ctx, report.Pod)
+	if err != nil {
+		return nil, err.Error()
+	}
+	c.noteDrillErrors(ctx, report, pod, "before")
+	if !pod.CanFailover(ctx) {
+		return nil, "Pod cannot fail over"
+	}
+	// The sentinels are fixed for the drill; mid-failover they disagree
+	// over the master and would not all be found again
+	return append([]*Sentinel(nil), c.PodToSentinelsMap[report.Pod]...), ""
+}
+
+// noteDrillPodErrors reloads the pod under the constellation's lock and
+// notes its errors in the report
+func (c *Constellation) noteDrillPodErrors(ctx context.Context, report *common.DrillReport, when string) {
+	c.Acquire()
+	defer c.Release()
+	if pod, err := c.podWithSentinelCount(ctx, report.Pod); err == nil {
+		c.noteDrillErrors(ctx, report, pod, when)
+	}
+}
+
+// podWithSentinelCount loads the pod along with the count of sentinels
+// monitoring it, which HasErrors relies on
+func (c *Constellation) podWithSentinelCount(ctx context.Context, podname string) (*common.RedisPod, error) {
+	pod, err := c.GetPod(ctx, podname)
+	if pod == nil || pod.Name == "" {
+		if err == nil {
+			err = fmt.Errorf("Pod '%s' not found", podname)
+		}
+		return nil, err
+	}
+	pod.SentinelCount = len(c.GetSentinelsForPod(ctx, podname))
+	return pod, nil
+}
+
+// drillFailover requests a failover of the pod and times how long until one
+// of its sentinels, then the constellation's GetMaster and finally every
+// reachable sentinel report the new master. A failover still in progress
+// from an earlier step is retried. The constellation's lock is taken for
+// each GetMaster and Failover call; the sentinels are polled without it.
+func (c *Constellation) drillFailover(ctx context.Context, podname string, sentinels []*Sentinel, timeout time.Duration) (step common.DrillStep, err error) {
+	wait, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	c.Acquire()
+	master, err := c.GetMaster(wait, podname)
+	c.Release()
+	if err != nil {
+		return step, err
+	}
+	step.From = fmt.Sprintf("%s:%d", master.Host, master.Port)
+
+	var start time.Time
+	for {
+		start = time.Now()
+		c.Acquire()
+		ok, err := c.Failover(wait, podname, false)
+		c.Release()
+		if ok {
+			if c.History != nil {
+				c.History.NoteFailover(podname, common.ChangeDrill)
+			}
+			break
+		}
+		if err == nil {
+			err = errors.New("no sentinel accepted the failover")
+		}
+		if !strings.Contains(err.Error(), "INPROG") {
+			return step, err
+		}
+		if !drillSleep(wait) {
+			return step, fmt.Errorf("a previous failover was still in progress after %s", timeout)
+		}
+	}
+
+	for step.To == "" {
+		for _, address := range sentinelMasters(wait, sentinels, podname) {
+			if address != step.From {
+				step.To = address
+				step.SwitchMaster = time.Since(start)
+				break
+			}
+		}
+		if step.To == "" && !drillSleep(wait) {
+			return step, fmt.Errorf("no sentinel switched master within %s", timeout)
+		}
+	}
+	for step.ClientsSwitched == 0 {
+		c.Acquire()
+		m, err := c.GetMaster(wait, podname)
+		c.Release()
+		if err == nil && fmt.Sprintf("%s:%d", m.Host, m.Port) == step.To {
+			step.ClientsSwitched = time.Since(start)
+			break
+		}
+		if !drillSleep(wait) {
+			return step, fmt.Errorf("clients were not given the new master within %s", timeout)
+		}
+	}
+	for {
+		agreed := true
+		for _, address := range sentinelMasters(wait, sentinels, podname) {
+			if address != step.To {
+				agreed = false
+			}
+		}
+		if agreed {
+			step.SentinelsAgreed = time.Since(start)
+			return step, nil
+		}
+		if !drillSleep(wait) {
+			return step, fmt.Errorf("sentinels did not all switch to the new master within %s", timeout)
+		}
+	}
+}
+
+// sentinelMasters returns the pod's master address as reported by each of
+// the sentinels which answered
+func sentinelMasters(ctx context.Context, sentinels []*Sentinel, podname string) (masters []string) {
+	for _, s := range sentinels {
+		m, err := s.GetMaster(ctx, podname)
+		if err != nil {
+			continue
+		}
+		masters = append(masters, fmt.Sprintf("%s:%d", m.Host, m.Port))
+	}
+	return masters
+}
+
+// drillFailback fails the pod back to original once it has rejoined as a
+// slave. The other slaves are given a priority of zero for the failover so
+// the sentinels promote original, and have their priority restored
+// afterwards.
+func (c *Constellation) drillFailback(ctx context.Context, podname, original string, sentinels []*Sentinel, timeout time.Duration) (step common.DrillStep, err error) {
+	wait, cancel := context.WithTimeout(ctx, timeout)
+	c.Acquire()
+	auth := c.GetPodAuth(podname)
+	c.Release()
+	var others []string
+	for {
+		found := false
+		others = others[:0]
+		for _, s := range sentinels {
+			slaves, err := s.GetSlaves(wait, podname)
+			if err != nil {
+				continue
+			}
+			for _, slave := range slaves {
+				address := fmt.Sprintf("%s:%d", slave.IP, slave.Port)
+				if address == original {
+					found = true
+				} else {
+					others = append(others, address)
+				}
+			}
+			break
+		}
+		if found {
+			break
+		}
+		if !drillSleep(wait) {
+			cancel()
+			return step, fmt.Errorf("original master %s did not rejoin as a slave within %s", original, timeout)
+		}
+	}
+	cancel()
+
+	// The priorities are stored before they are changed, so any left
+	// pinned, by a restart or a node which could not be reached, are
+	// restored by RestoreDrillPriorities
+	store := c.drillStore()
+	restore := make(map[string]string)
+	defer func() {
+		// restoring must not be cut short by the drill's own deadline
+		rctx, cancel := common.WithCallTimeout(context.Background())
+		defer cancel()
+		for address, priority := range restore {
+			c.restoreSlavePriority(rctx, store, podname, address, auth, priority)
+		}
+	}()
+	for _, address := range others {
+		previous, err := slavePriority(ctx, address, auth)
+		if err == nil {
+			err = store.Pin(podname, address, previous)
+		}
+		if err == nil {
+			restore[address] = previous
+			err = setSlavePriority(ctx, address, auth, "0")
+		}
+		if err != nil {
+			return step, fmt.Errorf("unable to pin failback to %s: %s", original, err)
+		}
+	}
+
+	step, err = c.drillFailover(ctx, podname, sentinels, timeout)
+	if err == nil && step.To != original {
+		err = fmt.Errorf("failed back to %s instead of %s", step.To, original)
+	}
+	return step, err
+}
+
+// restoreSlavePriority sets the node's slave-priority back to the one a
+// drill pinned and, once it is, forgets the pin
+func (c *Constellation) restoreSlavePriority(ctx context.Context, store *DrillStore, podname, address, auth, priority string) {
+	if err := setSlavePriority(ctx, address, auth, priority); err != nil {
+		logging.Pod(podname).Node(address).Errorf("Unable to restore slave-priority %s of %s after drill of pod '%s': %s", priority, address, podname, err)
+		return
+	}
+	if err := store.Unpin(podname, address); err != nil {
+		logging.Pod(podname).Node(address).Errorf("Unable to forget restored slave-priority of %s: %s", address, err)
+	}
+}
+
+// RestoreDrillPriorities restores the slave priorities drills pinned and
+// did not restore, such as when RedSkull stopped during a failback. It is
+// called at startup, before any drill can run, and takes the
+// constellation's lock as it needs.
+func (c *Constellation) RestoreDrillPriorities(ctx context.Context) {
+	store := c.drillStore()
+	for podname, nodes := range store.Pinned() {
+		c.Acquire()
+		auth := c.GetPodAuth(podname)
+		c.Release()
+		for address, priority := range nodes {
+			logging.Pod(podname).Node(address).Infof("Restoring slave-priority %s of %s, pinned by a drill of pod '%s'", priority, address, podname)
+			c.restoreSlavePriority(ctx, store, podname, address, auth, priority)
+		}
+	}
+}
+
+// slavePriority returns the slave-priority of the node at address
+func slavePriority(ctx context.Context, address, auth string) (priority string, err error) {
+	conn, err := common.Dial(ctx, client.DialConfig{Address: address, Password: auth})
+	if err != nil {
+		return priority, err
+	}
+	defer conn.ClosePool()
+	err = common.Do(ctx, func() error {
+		current, err := conn.ConfigGet("slave-priority")
+		priority = current["slave-priority"]
+		return err
+	})
+	if priority == "" {
+		priority = "100"
+	}
+	return priority, err
+}
+
+// setSlavePriority sets the slave-priority of the node at address
+func setSlavePriority(ctx context.Context, address, auth, priority string) error {
+	conn, err := common.Dial(ctx, client.DialConfig{Address: address, Password: auth})
+	if err != nil {
+		return err
+	}
+	defer conn.ClosePool()
+	return common.Do(ctx, func() error {
+		return conn.ConfigSet("slave-priority", priority)
+	})
+}
+
+// drillSleep waits DrillPollInterval, returning false if ctx ends first
+func drillSleep(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(DrillPollInterval):
+		return true
+	}
+}
+
+// noteDrillErrors adds the reasons the pod is in error, if it is, to the
+// report's errors, prefixed with when they were seen
+func (c *Constellation) noteDrillErrors(ctx context.Context, report *common.DrillReport, pod *common.RedisPod, when string) {
+	if !pod.HasErrors(ctx) {
+		return
+	}
+	for _, reason := range podErrorReasons(ctx, pod) {
+		report.Errors = append(report.Errors, fmt.Sprintf("%s: %s", when, reason))
+	}
+}
+
+// recordDrill stores the report and publishes a drill.finished event
+func (c *Constellation) recordDrill(report common.DrillReport) {
+	if err := c.drillStore().Add(report); err != nil {
+		logging.Pod(report.Pod).Errorf("Unable to store drill report %s: %s", report.ID, err)
+	}
+	severity := common.SeverityInfo
+	result := "passed"
+	message := fmt.Sprintf("Drill of pod '%s' passed, clients switched to %s after %s", report.Pod, report.Failover.To, report.Failover.ClientsSwitched)
+	if !report.Passed {
+		severity = common.SeverityWarning
+		result = "failed"
+		message = fmt.Sprintf("Drill of pod '%s' failed: %s", report.Pod, report.Failure)
+	}
+	events.Publish(common.Event{
+		Type:     common.EventDrillFinished,
+		Severity: severity,
+		Pod:      report.Pod,
+		Message:  message,
+		Data:     map[string]string{"drill": report.ID, "result": result},
+	})
+}
+
+// ScheduleDrills drills pods as the schedules say until the context ends.
+// A pod is covered by the first schedule matching it. Drills run one at a
+// time; pods in maintenance are skipped until they leave it. The pods are
+// listed under the constellation's lock, which RunDrill takes as it needs.
+func (c *Constellation) ScheduleDrills(ctx context.Context, schedules []common.DrillSchedule) {
+	if len(schedules) == 0 || DrillCheckInterval <= 0 {
+		return
+	}
+	c.drillStore()
+	logging.Infof("Drill scheduler running %d schedules", len(schedules))
+	ticker := time.NewTicker(DrillCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		c.Acquire()
+		names := sortedPodNames(c.PodMap)
+		c.Release()
+		for _, name := range names {
+			if ctx.Err() != nil {
+				return
+			}
+			c.scheduledDrill(ctx, name, schedules)
+		}
+	}
+}
+
+// scheduledDrill drills the pod if a schedule covers it and it is due
+func (c *Constellation) scheduledDrill(ctx context.Context, podname string, schedules []common.DrillSchedule) {
+	for _, s := range schedules {
+		if !s.Matches(podname) {
+			continue
+		}
+		now := time.Now()
+		if !s.InWindow(now) {
+			return
+		}
+		every, _ := s.Interval()
+		if last, ok := c.drillStore().Last(podname); ok && now.Sub(last.Started) < every {
+			return
+		}
+		if c.InMaintenance(podname) {
+			logging.Pod(podname).Debugf("Skipping scheduled drill of pod '%s', it is in maintenance", podname)
+			return
+		}
+		timeout, _ := s.StepTimeout()
+		c.RunDrill(ctx, podname, s.Failback, timeout, "schedule")
+		return
+	}
+}
@@ -0,0 +1,361 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/therealbill/libredis/client"
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-controller/events"
+	"github.com/therealbill/redskull/redskull-shared/logging"
+)
+
+// HistoryInterval is how often every pod's master is polled for the
+// failover history. Zero disables the poller.
+var HistoryInterval = 10 * time.Second
+
+// SLAWindows are the windows pod availability is reported over, shortest
+// first. History older than the longest is dropped.
+var SLAWindows = common.DefaultSLAWindows
+
+// maxHistoryEntries is how many timeline entries are kept per pod
+const maxHistoryEntries = 1000
+
+// failoverRequestTTL is how long after RedSkull requests a failover of a pod
+// a change of its master is put down to the request
+const failoverRequestTTL = 5 * time.Minute
+
+// HistoryStore holds the timeline of master changes and down periods of
+// each pod, persisted as JSON in the data directory
+type HistoryStore struct {
+	sync.RWMutex
+	saving    sync.Mutex
+	path      string
+	pods      map[string]*common.PodHistory
+	requested map[string]failoverRequest
+}
+
+// failoverRequest is a failover RedSkull asked the sentinels for
+type failoverRequest struct {
+	at     time.Time
+	reason string
+}
+
+// NewHistoryStore creates a store, loading any history already persisted
+// at path
+func NewHistoryStore(path string) (*HistoryStore, error) {
+	hs := &HistoryStore{path: path, pods: make(map[string]*common.PodHistory), requested: make(map[string]failoverRequest)}
+	if path == "" {
+		return hs, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return hs, nil
+	}
+	if err != nil {
+		return hs, err
+	}
+	err = json.Unmarshal(data, &hs.pods)
+	return hs, err
+}
+
+// Get returns a copy of the pod's history, if it has been polled
+func (hs *HistoryStore) Get(podname string) (common.PodHistory, bool) {
+	hs.RLock()
+	defer hs.RUnlock()
+	h, ok := hs.pods[podname]
+	if !ok {
+		return common.PodHistory{}, false
+	}
+	history := *h
+	history.Entries = append([]common.HistoryEntry(nil), h.Entries...)
+	return history, true
+}
+
+// List returns a copy of every pod's history, ordered by pod name
+func (hs *HistoryStore) List() []common.PodHistory {
+	hs.RLock()
+	var names []string
+	for name := range hs.pods {
+		names = append(names, name)
+	}
+	hs.RUnlock()
+	sort.Strings(names)
+	var list []common.PodHistory
+	for _, name := range names {
+		if h, ok := hs.Get(name); ok {
+			list = append(list, h)
+		}
+	}
+	return list
+}
+
+// NoteFailover records that RedSkull asked for a failover of the pod, so the
+// master change which follows is put down to reason rather than to the
+// sentinels acting alone
+func (hs *HistoryStore) NoteFailover(podname, reason string) {
+	hs.Lock()
+	hs.requested[podname] = failoverRequest{at: time.Now(), reason: reason}
+	hs.Unlock()
+}
+
+// Record updates the pod's history with the result of polling it: master is
+// the writable master found, or "" with why there was none in down. It
+// returns the entries added and any down period it ended.
+func (hs *HistoryStore) Record(podname, master, down string, now time.Time) (changed []common.HistoryEntry) {
+	hs.Lock()
+	h, seen := hs.pods[podname]
+	if !seen {
+		h = &common.PodHistory{Pod: podname, Tracked: now, Master: master}
+		hs.pods[podname] = h
+	}
+	open := h.Down()
+	switch {
+	case master == "" && open == nil:
+		h.Entries = append(h.Entries, common.HistoryEntry{Pod: podname, Kind: common.HistoryDown, Start: now, From: h.Master, Reason: down})
+		changed = append(changed, h.Entries[len(h.Entries)-1])
+	case master > "":
+		if open != nil {
+			open.End = now
+			open.To = master
+			changed = append(changed, *open)
+		}
+		if h.Master > "" && master != h.Master {
+			reason := common.ChangeSentinel
+			if req, ok := hs.requested[podname]; ok && now.Sub(req.at) < failoverRequestTTL {
+				reason = req.reason
+			} else if open != nil {
+				reason = common.ChangeMasterDown
+			}
+			delete(hs.requested, podname)
+			h.Entries = append(h.Entries, common.HistoryEntry{Pod: podname, Kind: common.HistoryMasterChange, Start: now, From: h.Master, To: master, Reason: reason})
+			changed = append(changed, h.Entries[len(h.Entries)-1])
+		}
+		h.Master = master
+	}
+	if len(changed) > 0 {
+		h.Entries = trimHistory(h.Entries, now)
+	}
+	hs.Unlock()
+	if !seen || len(changed) > 0 {
+		if err := hs.save(); err != nil {
+			logging.Pod(podname).Errorf("Unable to store history of pod '%s': %s", podname, err)
+		}
+	}
+	return changed
+}
+
+// trimHistory drops entries which ended before the longest SLA window and
+// any beyond maxHistoryEntries, oldest first
+func trimHistory(entries []common.HistoryEntry, now time.Time) []common.HistoryEntry {
+	var retention time.Duration
+	for _, w := range SLAWindows {
+		if w > retention {
+			retention = w
+		}
+	}
+	keep := 0
+	for i, e := range entries {
+		end := e.Start
+		if e.Kind == common.HistoryDown {
+			end = e.End
+		}
+		if retention > 0 && !e.Ongoing() && now.Sub(end) > retention {
+			keep = i + 1
+		}
+	}
+	if len(entries)-keep > maxHistoryEntries {
+		keep = len(entries) - maxHistoryEntries
+	}
+	return append([]common.HistoryEntry(nil), entries[keep:]...)
+}
+
+// save writes the store to its path. Saves are made one at a time, as they
+// share the temporary file.
+func (hs *HistoryStore) save() error {
+	if hs.path == "" {
+		return nil
+	}
+	hs.saving.Lock()
+	defer hs.saving.Unlock()
+	hs.RLock()
+	data, err := json.MarshalIndent(hs.pods, "", "  ")
+	hs.RUnlock()
+	if err != nil {
+		return err
+	}
+	tmp := hs.path + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, hs.path)
+}
+
+// StartHistoryStore loads the pod history store from the data directory
+func (c *Constellation) StartHistoryStore() {
+	path := ""
+	if DataDirectory > "" {
+		path = filepath.Join(DataDirectory, "history.json")
+	}
+	store, err := NewHistoryStore(path)
+	if err != nil {
+		logging.Errorf("Unable to load pod history, starting empty: %s", err)
+	}
+	c.History = store
+}
+
+// TrackHistory polls every pod's master every HistoryInterval, recording
+// master changes and periods without a writable master in the history
+// store, until the context ends
+func (c *Constellation) TrackHistory(ctx context.Context) {
+	if HistoryInterval <= 0 {
+		return
+	}
+	if c.History == nil {
+		c.StartHistoryStore()
+	}
+	logging.Infof("Recording pod failover history every %s", HistoryInterval)
+	ticker := time.NewTicker(HistoryInterval)
+	defer ticker.Stop()
+	for {
+		c.PollHistory(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PollHistory asks each known sentinel for the master of every pod and
+// records the result in the history store. Each pod is bounded by
+// common.CallTimeout; a pod whose poll is cut short is not recorded. The
+// sentinels are polled through a snapshot of the constellation, without its
+// lock.
+func (c *Constellation) PollHistory(ctx context.Context) {
+	if c.History == nil {
+		c.StartHistoryStore()
+	}
+	snap := c.Snapshot()
+	pass, cancel := common.WithCallTimeout(ctx)
+	sentinels, _ := snap.GetAllSentinels(pass)
+	names := sortedPodNames(snap.PodMap)
+	cancel()
+	for _, name := range names {
+		poll, cancel := common.WithCallTimeout(ctx)
+		master, down := snap.writableMaster(poll, sentinels, name)
+		err := poll.Err()
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logging.Pod(name).Warnf("History poll of pod '%s' did not finish within %s", name, common.CallTimeout)
+			continue
+		}
+		for _, e := range c.History.Record(name, master, down, time.Now()) {
+			c.noteHistory(e)
+		}
+	}
+}
+
+// writableMaster asks each sentinel for the pod's master and returns the
+// first of the addresses given, most reported first, which answers as a
+// master. If none does, down says why.
+func (c *Constellation) writableMaster(ctx context.Context, sentinels []*Sentinel, podname string) (master, down string) {
+	votes := make(map[string]int)
+	for _, s := range sentinels {
+		addr, err := s.GetMaster(ctx, podname)
+		if err != nil || addr.Port == 0 {
+			continue
+		}
+		votes[fmt.Sprintf("%s:%d", addr.Host, addr.Port)]++
+	}
+	if len(votes) == 0 {
+		return "", "no sentinel returned a master"
+	}
+	candidates := sortedIntKeys(votes)
+	sort.SliceStable(candidates, func(i, j int) bool { return votes[candidates[i]] > votes[candidates[j]] })
+	auth := c.GetPodAuth(podname)
+	var reasons []string
+	for _, address := range candidates {
+		role, err := nodeRole(ctx, address, auth)
+		if err != nil {
+			reasons = append(reasons, fmt.Sprintf("master %s is unreachable: %s", address, err))
+			continue
+		}
+		if role == "master" {
+			return address, ""
+		}
+		reasons = append(reasons, fmt.Sprintf("master %s is a %s", address, role))
+	}
+	return "", strings.Join(reasons, ", ")
+}
+
+// nodeRole returns the replication role the node at address reports. A node
+// which refuses RedSkull's password still answers clients which have the
+// right one, so it is taken to be the master the sentinels say it is.
+func nodeRole(ctx context.Context, address, auth string) (string, error) {
+	conn, err := common.Dial(ctx, client.DialConfig{Address: address, Password: auth})
+	if err != nil {
+		if isAuthError(err) {
+			return "master", nil
+		}
+		return "", err
+	}
+	defer conn.ClosePool()
+	var role string
+	err = common.Do(ctx, func() error {
+		info, err := conn.Info()
+		role = info.Replication.Role
+		return err
+	})
+	if err != nil && isAuthError(err) {
+		return "master", nil
+	}
+	return role, err
+}
+
+func isAuthError(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "NOAUTH") || strings.Contains(msg, "invalid password") || strings.Contains(msg, "WRONGPASS")
+}
+
+// noteHistory logs a history entry and publishes an event when a pod loses
+// or regains a writable master. Master changes already publish one from
+// GetMaster.
+func (c *Constellation) noteHistory(e common.HistoryEntry) {
+	log := logging.Op("history").Pod(e.Pod)
+	switch {
+	case e.Kind == common.HistoryMasterChange:
+		log.Infof("Pod '%s' master changed from %s to %s (%s)", e.Pod, e.From, e.To, e.Reason)
+	case e.Ongoing():
+		log.Warnf("Pod '%s' has no writable master: %s", e.Pod, e.Reason)
+		events.Publish(common.Event{
+			Type:     common.EventPodUnavailable,
+			Severity: common.SeverityCritical,
+			Pod:      e.Pod,
+			Message:  fmt.Sprintf("Pod '%s' has no writable master: %s", e.Pod, e.Reason),
+			Data:     map[string]string{"reason": e.Reason, "master": e.From},
+		})
+	default:
+		d := e.Duration(e.End)
+		log.Infof("Pod '%s' has a writable master again after %s", e.Pod, d)
+		events.Publish(common.Event{
+			Type:     common.EventPodAvailable,
+			Severity: common.SeverityInfo,
+			Pod:      e.Pod,
+			Message:  fmt.Sprintf("Pod '%s' has a writable master, %s, after %s without one", e.Pod, e.To, d),
+			Data:     map[string]string{"master": e.To, "seconds": fmt.Sprintf("%.0f", d.Seconds())},
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package actions
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-controller/events"
+	"github.com/therealbill/redskull/redskull-shared/logging"
+)
+
+// maxJobs is how many finished jobs are remembered
+const maxJobs = 500
+
+// JobFunc does a job's work, returning its result. log carries the job's ID
+// and pod. Jobs outlive the request which started them, so ctx is the job's
+// own and is cancelled once the job returns.
+type JobFunc func(ctx context.Context, log *logging.Logger) (interface{}, error)
+
+// JobStore tracks the jobs started on this RedSkull instance
+type JobStore struct {
+	sync.RWMutex
+	jobs map[string]*common.Job
+}
+
+// Jobs holds every job started through the API
+var Jobs = NewJobStore()
+
+// NewJobStore returns an empty job store
+func NewJobStore() *JobStore {
+	return &JobStore{jobs: make(map[string]*common.Job)}
+}
+
+// Start runs fn in the background as a job of the given type and returns the
+// job as started. A job.finished event is published when it completes.
+func (js *JobStore) Start(jobType, pod, owner string, fn JobFunc) common.Job {
+	job := &common.Job{ID: newJobID(), Type: jobType, Pod: pod, Owner: owner, State: common.JobRunning, Started: time.Now()}
+	js.Lock()
+	js.jobs[job.ID] = job
+	js.prune()
+	started := *job
+	js.Unlock()
+
+	log := logging.Op(jobType).Job(job.ID)
+	if pod > "" {
+		log = log.Pod(pod)
+	}
+	log.Infof("Job %s started", job.ID)
+	go func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		result, err := fn(ctx, log)
+		cancel()
+		js.Lock()
+		job.Result = result
+		job.Finished = time.Now()
+		job.State = common.JobSucceeded
+		if err != nil {
+			job.State = common.JobFailed
+			job.Error = err.Error()
+		}
+		finished := *job
+		js.Unlock()
+		severity := common.SeverityInfo
+		if err != nil {
+			severity = common.SeverityWarning
+			log.Errorf("Job %s failed: %s", finished.ID, err)
+		} else {
+			log.Infof("Job %s succeeded", finished.ID)
+		}
+		events.Publish(common.Event{
+			Type:     common.EventJobFinished,
+			Severity: severity,
+			Pod:      pod,
+			Message:  fmt.Sprintf("%s job %s %s", jobType, finished.ID, finished.State),
+			Data:     map[string]string{"job": finished.ID, "type": jobType, "state": finished.State},
+		})
+	}()
+	return started
+}
+
+// Get returns the job with the given ID
+func (js *JobStore) Get(id string) (common.Job, bool) {
+	js.RLock()
+	defer js.RUnlock()
+	job, ok := js.jobs[id]
+	if !ok {
+		return common.Job{}, false
+	}
+	return *job, true
+}
+
+// List returns every job, newest first
+func (js *JobStore) List() []common.Job {
+	js.RLock()
+	defer js.RUnlock()
+	list := make([]common.Job, 0, len(js.jobs))
+	for _, job := range js.jobs {
+		list = append(list, *job)
+	}
+	sort.Sort(jobsByStart(list))
+	return list
+}
+
+// prune drops the oldest finished jobs once more than maxJobs are held. The
+// caller must hold the lock.
+func (js *JobStore) prune() {
+	if len(js.jobs) <= maxJobs {
+		return
+	}
+	var finished []common.Job
+	for _, job := range js.jobs {
+		if job.Done() {
+			finished = append(finished, *job)
+		}
+	}
+	sort.Sort(jobsByStart(finished))
+	for i := len(finished) - 1; i >= 0 && len(js.jobs) > maxJobs; i-- {
+		delete(js.jobs, finished[i].ID)
+	}
+}
+
+type jobsByStart []common.Job
+
+func (j jobsByStart) Len() int           { return len(j) }
+func (j jobsByStart) Swap(a, b int)      { j[a], j[b] = j[b], j[a] }
+func (j jobsByStart) Less(a, b int) bool { return j[a].Started.After(j[b].Started) }
+
+func newJobID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,214 @@
+package actions
+
+import (
+	"sync"
+
+	"github.com/therealbill/redskull/redskull-controller/common"
+)
+
+// Acquire takes the constellation's lock. Crawling the constellation updates
+// its maps, and the pods, nodes and sentinels they hold, in place, so work
+// which changes the constellation (requests other than GETs, RPC calls
+// making changes, jobs and watcher passes) holds the lock while it does so.
+// Work which only reads the constellation uses a Snapshot instead. Copies
+// of a constellation share its lock. Methods do not take it themselves
+// unless their comment says so.
+func (c *Constellation) Acquire() {
+	c.mu.Lock()
+}
+
+// Release publishes the constellation for Snapshot to copy while the lock
+// is next held, then releases the lock taken by Acquire
+func (c *Constellation) Release() {
+	if c.published != nil {
+		c.published.Store(c.copy())
+	}
+	c.mu.Unlock()
+}
+
+// Snapshot returns a copy of the constellation sharing nothing which
+// changes with it, for work which only reads the constellation. The copy
+// can be crawled and rendered without the lock, so readers neither wait for
+// each other nor for the work holding the lock: while the lock is held, the
+// copy is of the constellation as it was when last released. Changes made
+// to a snapshot, including those made by crawling it, are not seen by the
+// constellation, and snapshots do not publish pod error or master change
+// events; the watchers do.
+func (c *Constellation) Snapshot() *Constellation {
+	if c.mu.TryLock() {
+		defer c.mu.Unlock()
+		return c.copy()
+	}
+	if c.published != nil {
+		if latest, ok := c.published.Load().(*Constellation); ok {
+			return latest.copy()
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.copy()
+}
+
+// copy returns a deep copy of the constellation. The stores are shared, as
+// they have locks of their own.
+func (c *Constellation) copy() *Constellation {
+	cp := copier{nodes: make(common.NodeCopier), pods: make(map[*common.RedisPod]*common.RedisPod), sentinels: make(map[*Sentinel]*Sentinel)}
+	s := *c
+	s.mu = new(sync.Mutex)
+	s.published = nil
+	s.snapshot = true
+	s.podErrorState = nil
+	s.podMasters = nil
+	cp.sentinels[&c.LocalSentinel] = &s.LocalSentinel
+	cp.copySentinel(&s.LocalSentinel, &c.LocalSentinel)
+
+	s.PodMap = cp.podMap(c.PodMap)
+	s.LocalPodMap = cp.podMap(c.LocalPodMap)
+	s.RemotePodMap = cp.podMap(c.RemotePodMap)
+	if c.PodsInError != nil {
+		s.PodsInError = make([]*common.RedisPod, len(c.PodsInError))
+		for i, pod := range c.PodsInError {
+			s.PodsInError[i] = cp.pod(pod)
+		}
+	}
+	s.RemoteSentinels = cp.sentinelMap(c.RemoteSentinels)
+	s.BadSentinels = cp.sentinelMap(c.BadSentinels)
+	if c.PodToSentinelsMap != nil {
+		s.PodToSentinelsMap = make(map[string][]*Sentinel, len(c.PodToSentinelsMap))
+		for podname, sentinels := range c.PodToSentinelsMap {
+			s.PodToSentinelsMap[podname] = cp.sentinelList(sentinels)
+		}
+	}
+	if c.NodeMap != nil {
+		s.NodeMap = make(map[string]*common.RedisNode, len(c.NodeMap))
+		for name, node := range c.NodeMap {
+			s.NodeMap[name] = cp.nodes.Node(node)
+		}
+	}
+	if c.SentinelConfig.ManagedPodConfigs != nil {
+		s.SentinelConfig.ManagedPodConfigs = make(map[string]SentinelPodConfig, len(c.SentinelConfig.ManagedPodConfigs))
+		for podname, cfg := range c.SentinelConfig.ManagedPodConfigs {
+			cfg.Sentinels = copyStrings(cfg.Sentinels)
+			s.SentinelConfig.ManagedPodConfigs[podname] = cfg
+		}
+	}
+	if c.Metrics.PodSizes != nil {
+		s.Metrics.PodSizes = make(map[int64]int64, len(c.Metrics.PodSizes))
+		for size, count := range c.Metrics.PodSizes {
+			s.Metrics.PodSizes[size] = count
+		}
+	}
+	if c.ConfiguredSentinels != nil {
+		s.ConfiguredSentinels = make(map[string]interface{}, len(c.ConfiguredSentinels))
+		for address, v := range c.ConfiguredSentinels {
+			s.ConfiguredSentinels[address] = v
+		}
+	}
+	s.PeerList = copyStrings(c.PeerList)
+	s.PodAuthMap = copyStrings(c.PodAuthMap)
+	s.NodeNameToPodMap = copyStrings(c.NodeNameToPodMap)
+	return &s
+}
+
+// copier deep copies a constellation's pods, nodes and sentinels, copying
+// each once however many maps and lists it is reached through
+type copier struct {
+	nodes     common.NodeCopier
+	pods      map[*common.RedisPod]*common.RedisPod
+	sentinels map[*Sentinel]*Sentinel
+}
+
+func (cp copier) pod(p *common.RedisPod) *common.RedisPod {
+	if p == nil {
+		return nil
+	}
+	if c, ok := cp.pods[p]; ok {
+		return c
+	}
+	c := cp.nodes.Pod(*p)
+	cp.pods[p] = &c
+	return &c
+}
+
+func (cp copier) podMap(pods map[string]*common.RedisPod) map[string]*common.RedisPod {
+	if pods == nil {
+		return nil
+	}
+	c := make(map[string]*common.RedisPod, len(pods))
+	for name, pod := range pods {
+		c[name] = cp.pod(pod)
+	}
+	return c
+}
+
+func (cp copier) podList(pods []common.RedisPod) []common.RedisPod {
+	if pods == nil {
+		return nil
+	}
+	c := make([]common.RedisPod, len(pods))
+	for i, pod := range pods {
+		c[i] = cp.nodes.Pod(pod)
+	}
+	return c
+}
+
+func (cp copier) sentinel(s *Sentinel) *Sentinel {
+	if s == nil {
+		return nil
+	}
+	if c, ok := cp.sentinels[s]; ok {
+		return c
+	}
+	c := new(Sentinel)
+	cp.sentinels[s] = c
+	cp.copySentinel(c, s)
+	return c
+}
+
+// copySentinel sets dst to a copy of src. The sentinel's connection is
+// shared; it is only kept, never used.
+func (cp copier) copySentinel(dst, src *Sentinel) {
+	*dst = *src
+	if src.PodMap != nil {
+		dst.PodMap = make(map[string]common.RedisPod, len(src.PodMap))
+		for name, pod := range src.PodMap {
+			dst.PodMap[name] = cp.nodes.Pod(pod)
+		}
+	}
+	dst.Pods = cp.podList(src.Pods)
+	dst.PodsInError = cp.podList(src.PodsInError)
+	dst.KnownSentinels = cp.sentinelMap(src.KnownSentinels)
+}
+
+func (cp copier) sentinelMap(sentinels map[string]*Sentinel) map[string]*Sentinel {
+	if sentinels == nil {
+		return nil
+	}
+	c := make(map[string]*Sentinel, len(sentinels))
+	for name, s := range sentinels {
+		c[name] = cp.sentinel(s)
+	}
+	return c
+}
+
+func (cp copier) sentinelList(sentinels []*Sentinel) []*Sentinel {
+	if sentinels == nil {
+		return nil
+	}
+	c := make([]*Sentinel, len(sentinels))
+	for i, s := range sentinels {
+		c[i] = cp.sentinel(s)
+	}
+	return c
+}
+
+func copyStrings(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,264 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	rsagent "github.com/therealbill/redskull/redskull-agent/rpcclient"
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-shared/logging"
+)
+
+// DataDirectory is where RedSkull keeps its persistent state, such as pod
+// maintenance windows. When empty that state is only held in memory.
+var DataDirectory string
+
+// AgentRPCPort is the port redskull-agent listens on. When set, maintenance
+// can also put the agent on a pod's master host into Consul maintenance.
+var AgentRPCPort int
+
+// AgentRPCOptions holds the TLS settings and token used to call
+// redskull-agent. The timeout is set per call.
+var AgentRPCOptions rsagent.Options
+
+// ErrPodInMaintenance is returned when an automated or unforced action is
+// attempted on a pod in maintenance
+var ErrPodInMaintenance = errors.New("Pod is in maintenance, force the action to proceed anyway")
+
+// MaintenanceStore holds the maintenance windows of pods, persisted as JSON
+// in the data directory
+type MaintenanceStore struct {
+	sync.RWMutex
+	saving  sync.Mutex
+	path    string
+	entries map[string]common.PodMaintenance
+}
+
+// NewMaintenanceStore creates a store, loading any entries already persisted
+// at path
+func NewMaintenanceStore(path string) (*MaintenanceStore, error) {
+	ms := &MaintenanceStore{path: path, entries: make(map[string]common.PodMaintenance)}
+	if path == "" {
+		return ms, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ms, nil
+	}
+	if err != nil {
+		return ms, err
+	}
+	err = json.Unmarshal(data, &ms.entries)
+	return ms, err
+}
+
+// Get returns the pod's maintenance entry, if it has one
+func (ms *MaintenanceStore) Get(podname string) (common.PodMaintenance, bool) {
+	ms.RLock()
+	defer ms.RUnlock()
+	m, ok := ms.entries[podname]
+	return m, ok
+}
+
+// Set stores the pod's maintenance entry
+func (ms *MaintenanceStore) Set(m common.PodMaintenance) error {
+	ms.Lock()
+	ms.entries[m.Pod] = m
+	ms.Unlock()
+	return ms.save()
+}
+
+// Delete removes the pod's maintenance entry
+func (ms *MaintenanceStore) Delete(podname string) error {
+	ms.Lock()
+	delete(ms.entries, podname)
+	ms.Unlock()
+	return ms.save()
+}
+
+// List returns every entry, ordered by pod name
+func (ms *MaintenanceStore) List() []common.PodMaintenance {
+	ms.RLock()
+	defer ms.RUnlock()
+	var names []string
+	for name := range ms.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var list []common.PodMaintenance
+	for _, name := range names {
+		list = append(list, ms.entries[name])
+	}
+	return list
+}
+
+// save writes the store to its path. Saves are made one at a time, as they
+// share the temporary file.
+func (ms *MaintenanceStore) save() error {
+	if ms.path == "" {
+		return nil
+	}
+	ms.saving.Lock()
+	defer ms.saving.Unlock()
+	ms.RLock()
+	data, err := json.MarshalIndent(ms.entries, "", "  ")
+	ms.RUnlock()
+	if err != nil {
+		return err
+	}
+	tmp := ms.path + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, ms.path)
+}
+
+// StartMaintenanceStore loads the maintenance store from the data directory
+func (c *Constellation) StartMaintenanceStore() {
+	path := ""
+	if DataDirectory > "" {
+		path = filepath.Join(DataDirectory, "maintenance.json")
+	} else {
+		logging.Warnf("No data directory configured; pod maintenance will not survive a restart")
+	}
+	store, err := NewMaintenanceStore(path)
+	if err != nil {
+		logging.Errorf("Unable to load maintenance store, starting empty: %s", err)
+	}
+	c.Maintenance = store
+}
+
+// SetPodMaintenance places the pod into maintenance. A zero expires means
+// until cleared. If consul is set the agent on the pod's master host is put
+// into Consul maintenance as well.
+func (c *Constellation) SetPodMaintenance(ctx context.Context, podname, reason, owner string, expires time.Time, consul bool) (m common.PodMaintenance, err error) {
+	pod, err := c.GetPod(ctx, podname)
+	if pod == nil || pod.Name == "" {
+		if err == nil {
+			err = fmt.Errorf("Pod '%s' not found", podname)
+		}
+		return m, err
+	}
+	if c.Maintenance == nil {
+		c.StartMaintenanceStore()
+	}
+	m = common.PodMaintenance{Pod: podname, Reason: reason, Owner: owner, Started: time.Now(), Expires: expires, Consul: consul}
+	if consul {
+		err = agentMaintenance(ctx, pod.Info.IP, true, fmt.Sprintf("%s: %s (%s)", podname, reason, owner))
+		if err != nil {
+			return m, fmt.Errorf("Unable to set Consul maintenance for pod '%s': %s", podname, err)
+		}
+	}
+	logging.Pod(podname).Infof("Pod '%s' entering maintenance by %s: %s", podname, owner, reason)
+	err = c.Maintenance.Set(m)
+	return m, err
+}
+
+// ClearPodMaintenance takes the pod out of maintenance
+func (c *Constellation) ClearPodMaintenance(ctx context.Context, podname string) error {
+	if c.Maintenance == nil {
+		return nil
+	}
+	m, ok := c.Maintenance.Get(podname)
+	if !ok {
+		return nil
+	}
+	logging.Pod(podname).Infof("Pod '%s' leaving maintenance", podname)
+	if m.Consul {
+		host := ""
+		if pod, _ := c.GetPod(ctx, podname); pod != nil {
+			host = pod.Info.IP
+		}
+		err := agentMaintenance(ctx, host, false, "")
+		if err != nil {
+			logging.Pod(podname).Errorf("Unable to clear Consul maintenance for pod '%s': %s", podname, err)
+		}
+	}
+	return c.Maintenance.Delete(podname)
+}
+
+// GetPodMaintenance returns the pod's maintenance entry if it is in
+// maintenance. It changes nothing: expired entries are reported as not in
+// maintenance and left for ClearExpiredMaintenance to remove.
+func (c *Constellation) GetPodMaintenance(podname string) (common.PodMaintenance, bool) {
+	if c.Maintenance == nil {
+		return common.PodMaintenance{}, false
+	}
+	m, ok := c.Maintenance.Get(podname)
+	return m, ok && m.Active()
+}
+
+// ClearExpiredMaintenance takes pods whose maintenance has expired out of
+// maintenance, clearing Consul maintenance where it was set. The caller
+// holds the constellation's lock.
+func (c *Constellation) ClearExpiredMaintenance(ctx context.Context) {
+	if c.Maintenance == nil {
+		return
+	}
+	for _, m := range c.Maintenance.List() {
+		if m.Active() {
+			continue
+		}
+		err := c.ClearPodMaintenance(ctx, m.Pod)
+		if err != nil {
+			logging.Pod(m.Pod).Errorf("Unable to clear expired maintenance for pod '%s': %s", m.Pod, err)
+		}
+	}
+}
+
+// InMaintenance returns true if the pod is in maintenance
+func (c *Constellation) InMaintenance(podname string) bool {
+	_, in := c.GetPodMaintenance(podname)
+	return in
+}
+
+// ListMaintenance returns every pod currently in maintenance
+func (c *Constellation) ListMaintenance() (list []common.PodMaintenance) {
+	if c.Maintenance == nil {
+		return list
+	}
+	for _, m := range c.Maintenance.List() {
+		if _, in := c.GetPodMaintenance(m.Pod); in {
+			list = append(list, m)
+		}
+	}
+	return list
+}
+
+// agentMaintenance switches Consul maintenance on or off through the
+// redskull-agent running on host. The call is cut short by the context's
+// deadline.
+func agentMaintenance(ctx context.Context, host string, enable bool, reason string) error {
+	if AgentRPCPort == 0 {
+		return errors.New("no agent RPC port configured")
+	}
+	if host == "" {
+		return errors.New("unable to determine the pod's master host")
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	opts := AgentRPCOptions
+	opts.Timeout = 5 * time.Second
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < opts.Timeout {
+		opts.Timeout = time.Until(deadline)
+	}
+	agent, err := rsagent.NewClientWithOptions(fmt.Sprintf("%s:%d", host, AgentRPCPort), opts)
+	if err != nil {
+		return err
+	}
+	defer agent.Close()
+	if enable {
+		return agent.EnableMaintenance(reason)
+	}
+	return agent.DisableMaintenance()
+}
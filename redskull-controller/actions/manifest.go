@@ -0,0 +1,269 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/therealbill/libredis/structures"
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-shared/logging"
+)
+
+// PlanManifest compares the manifest against the live constellation and
+// returns the steps needed to bring the constellation in line with it. It
+// makes no changes.
+func (c *Constellation) PlanManifest(ctx context.Context, m common.Manifest) (plan common.ManifestPlan, err error) {
+	err = m.Validate()
+	if err != nil {
+		return plan, err
+	}
+	livepods, _ := c.GetPodMap()
+	wanted := make(map[string]bool)
+	for _, pm := range m.Pods {
+		wanted[pm.Name] = true
+		live, exists := livepods[pm.Name]
+		if !exists {
+			plan.Steps = append(plan.Steps, c.planNewPod(ctx, pm)...)
+			continue
+		}
+		plan.Steps = append(plan.Steps, c.planExistingPod(ctx, pm, live)...)
+	}
+	if m.Prune {
+		var names []string
+		for name := range livepods {
+			if !wanted[name] {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			plan.Steps = append(plan.Steps, common.ManifestStep{Pod: name, Action: common.ManifestRemove, Detail: "pod is not in the manifest"})
+		}
+	}
+	return plan, nil
+}
+
+// planNewPod returns the steps for a pod which is not yet monitored
+func (c *Constellation) planNewPod(ctx context.Context, pm common.PodManifest) (steps []common.ManifestStep) {
+	steps = append(steps, common.ManifestStep{
+		Pod:    pm.Name,
+		Action: common.ManifestMonitor,
+		Detail: fmt.Sprintf("monitor %s with quorum %d on %d sentinels", pm.Master, pm.Quorum, pm.Quorum+1),
+	})
+	for _, key := range sortedKeys(pm.Parameters) {
+		steps = append(steps, common.ManifestStep{Pod: pm.Name, Action: common.ManifestSet, Parameter: key, Value: pm.Parameters[key]})
+	}
+	return steps
+}
+
+// planExistingPod returns the steps needed to change a monitored pod to
+// match its manifest entry
+func (c *Constellation) planExistingPod(ctx context.Context, pm common.PodManifest, live *common.RedisPod) (steps []common.ManifestStep) {
+	liveMaster := fmt.Sprintf("%s:%d", live.Info.IP, live.Info.Port)
+	if liveMaster != pm.Master && !podHasNode(live, pm.Master) {
+		steps = append(steps, common.ManifestStep{
+			Pod:    pm.Name,
+			Action: common.ManifestWarn,
+			Detail: fmt.Sprintf("manifest master %s is not a member of the pod, sentinel reports master %s", pm.Master, liveMaster),
+		})
+	}
+	if live.Info.Quorum != pm.Quorum {
+		steps = append(steps, common.ManifestStep{
+			Pod:       pm.Name,
+			Action:    common.ManifestSet,
+			Parameter: "quorum",
+			Value:     strconv.Itoa(pm.Quorum),
+			Detail:    fmt.Sprintf("quorum is %d", live.Info.Quorum),
+		})
+	}
+	for _, key := range sortedKeys(pm.Parameters) {
+		desired := pm.Parameters[key]
+		current, known := currentSentinelParameter(live.Info, key)
+		if known && current == desired {
+			continue
+		}
+		step := common.ManifestStep{Pod: pm.Name, Action: common.ManifestSet, Parameter: key, Value: desired}
+		if known {
+			step.Detail = fmt.Sprintf("%s is %s", key, current)
+		} else {
+			step.Detail = "current value can not be read from sentinel"
+		}
+		steps = append(steps, step)
+	}
+	if pm.AuthSecret > "" {
+		auth, err := pm.ResolveAuth()
+		if err != nil {
+			steps = append(steps, common.ManifestStep{Pod: pm.Name, Action: common.ManifestWarn, Detail: "unable to resolve auth secret: " + err.Error()})
+		} else if auth != c.GetPodAuth(pm.Name) {
+			steps = append(steps, common.ManifestStep{Pod: pm.Name, Action: common.ManifestSet, Parameter: "auth-pass", Value: pm.AuthSecret, Detail: "auth token differs from the referenced secret"})
+		}
+	}
+	sentinels := c.GetSentinelsForPod(ctx, pm.Name)
+	if len(sentinels) != pm.Quorum+1 {
+		steps = append(steps, common.ManifestStep{
+			Pod:    pm.Name,
+			Action: common.ManifestBalance,
+			Detail: fmt.Sprintf("pod has %d sentinels, needs %d", len(sentinels), pm.Quorum+1),
+		})
+	}
+	if pm.MinReplicas > 0 {
+		replicas := 0
+		if live.Master != nil {
+			for _, slave := range live.Master.Slaves {
+				if slave != nil {
+					replicas++
+				}
+			}
+		}
+		if replicas < pm.MinReplicas {
+			steps = append(steps, common.ManifestStep{
+				Pod:    pm.Name,
+				Action: common.ManifestWarn,
+				Detail: fmt.Sprintf("pod has %d replicas, manifest requires %d. Replicas must be added manually", replicas, pm.MinReplicas),
+			})
+		}
+	}
+	return steps
+}
+
+// ApplyManifest plans the manifest and executes each step. When dryRun is
+// set the plan is returned as a report without being executed.
+func (c *Constellation) ApplyManifest(ctx context.Context, m common.Manifest, dryRun bool) (report common.ManifestReport, err error) {
+	report.DryRun = dryRun
+	plan, err := c.PlanManifest(ctx, m)
+	if err != nil {
+		return report, err
+	}
+	desired := make(map[string]common.PodManifest)
+	for _, pm := range m.Pods {
+		desired[pm.Name] = pm
+	}
+	for _, step := range plan.Steps {
+		res := common.ManifestStepResult{Step: step}
+		if dryRun || step.Action == common.ManifestWarn {
+			report.Results = append(report.Results, res)
+			continue
+		}
+		err := c.applyManifestStep(ctx, step, desired[step.Pod])
+		if err != nil {
+			logging.Pod(step.Pod).Errorf("Manifest step %s on pod '%s' failed: %s", step.Action, step.Pod, err)
+			res.Error = err.Error()
+		} else {
+			res.Applied = true
+		}
+		report.Results = append(report.Results, res)
+	}
+	return report, nil
+}
+
+// applyManifestStep executes a single planned step
+func (c *Constellation) applyManifestStep(ctx context.Context, step common.ManifestStep, pm common.PodManifest) error {
+	switch step.Action {
+	case common.ManifestMonitor:
+		host, port, err := pm.MasterHostPort()
+		if err != nil {
+			return err
+		}
+		auth, err := pm.ResolveAuth()
+		if err != nil {
+			return err
+		}
+		_, err = c.MonitorPod(ctx, pm.Name, host, port, pm.Quorum, auth)
+		return err
+	case common.ManifestSet:
+		value := step.Value
+		if step.Parameter == "auth-pass" {
+			// the plan only carries the reference, never the secret
+			auth, err := pm.ResolveAuth()
+			if err != nil {
+				return err
+			}
+			value = auth
+		}
+		return c.SetPodParameter(ctx, step.Pod, step.Parameter, value)
+	case common.ManifestBalance:
+		pod, err := c.GetPod(ctx, step.Pod)
+		if err != nil || pod == nil {
+			return fmt.Errorf("Unable to load pod '%s' for balancing", step.Pod)
+		}
+		return c.BalancePod(ctx, pod, false)
+	case common.ManifestRemove:
+		_, err := c.RemovePod(ctx, step.Pod)
+		return err
+	}
+	return fmt.Errorf("Unknown manifest action '%s'", step.Action)
+}
+
+// SetPodParameter issues a SENTINEL SET for the pod on every sentinel
+// monitoring it. Only common.SentinelParameters may be set.
+func (c *Constellation) SetPodParameter(ctx context.Context, podname, key, value string) error {
+	if err := common.CheckSentinelParameter(key); err != nil {
+		return err
+	}
+	sentinels := c.GetSentinelsForPod(ctx, podname)
+	if len(sentinels) == 0 {
+		return fmt.Errorf("No sentinels found for pod '%s'", podname)
+	}
+	var failed []string
+	for _, sentinel := range sentinels {
+		err := sentinel.SetPodParameter(ctx, podname, key, value)
+		if err != nil {
+			logging.Pod(podname).Sentinel(sentinel.Name).Errorf("Unable to set %s for pod '%s' on %s. Err: %s", key, podname, sentinel.Name, err)
+			failed = append(failed, sentinel.Name)
+		}
+	}
+	if key == "auth-pass" {
+		c.setPodAuth(podname, value, "parameter")
+		if cfg, exists := c.SentinelConfig.ManagedPodConfigs[podname]; exists {
+			cfg.AuthToken = value
+			c.SentinelConfig.ManagedPodConfigs[podname] = cfg
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("Unable to set %s on sentinels %v", key, failed)
+	}
+	return nil
+}
+
+// podHasNode returns true if the address is the pod's master or one of its
+// known slaves
+func podHasNode(pod *common.RedisPod, address string) bool {
+	if pod.Master == nil {
+		return false
+	}
+	if pod.Master.Name == address {
+		return true
+	}
+	for _, slave := range pod.Master.Slaves {
+		if slave != nil && slave.Name == address {
+			return true
+		}
+	}
+	return false
+}
+
+// currentSentinelParameter returns the value sentinel reports for the
+// parameters it exposes in SENTINEL MASTER output.
+func currentSentinelParameter(mi structures.MasterInfo, key string) (string, bool) {
+	switch key {
+	case "down-after-milliseconds":
+		return strconv.Itoa(mi.DownAfterMilliseconds), true
+	case "failover-timeout":
+		return strconv.Itoa(mi.FailoverTimeout), true
+	case "parallel-syncs":
+		return strconv.Itoa(mi.ParallelSyncs), true
+	case "quorum":
+		return strconv.Itoa(mi.Quorum), true
+	}
+	return "", false
+}
+
+func sortedKeys(m map[string]string) (keys []string) {
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
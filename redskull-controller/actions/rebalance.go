@@ -0,0 +1,339 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-shared/logging"
+)
+
+// ErrRebalancePlanChanged is returned when a rebalance is confirmed against a
+// plan which no longer matches the constellation
+var ErrRebalancePlanChanged = errors.New("Rebalance plan has changed since it was previewed")
+
+// ErrRebalanceUnconfirmed is returned when a rebalance is confirmed without
+// the fingerprint of a previewed plan
+var ErrRebalanceUnconfirmed = errors.New("A rebalance must be confirmed with the fingerprint of a previewed plan")
+
+// PlanRebalance computes the moves needed to bring every pod in the
+// constellation to quorum+1 sentinels. Pods in maintenance are left alone.
+// Nothing is changed.
+func (c *Constellation) PlanRebalance(ctx context.Context) (common.RebalancePlan, error) {
+	var pods, skipped []*common.RedisPod
+	for _, pod := range c.GetPods() {
+		if c.InMaintenance(pod.Name) {
+			skipped = append(skipped, pod)
+			continue
+		}
+		pods = append(pods, pod)
+	}
+	plan, err := c.planRebalance(ctx, pods)
+	sort.Sort(podsByName(skipped))
+	for _, pod := range skipped {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("Pod '%s' is in maintenance, skipping", pod.Name))
+	}
+	return plan, err
+}
+
+// PlanPodRebalance computes the moves needed to bring a single pod to
+// quorum+1 sentinels, taking the load of the whole constellation into
+// account. Nothing is changed.
+func (c *Constellation) PlanPodRebalance(ctx context.Context, podname string) (common.RebalancePlan, error) {
+	pod, err := c.GetPod(ctx, podname)
+	if pod == nil || pod.Name == "" {
+		if err == nil {
+			err = fmt.Errorf("Pod '%s' not found", podname)
+		}
+		return common.RebalancePlan{}, err
+	}
+	return c.planRebalance(ctx, []*common.RedisPod{pod})
+}
+
+// planRebalance builds the plan for the given pods. Only the pods which are
+// short of, or over, quorum+1 sentinels are touched, and only by the number
+// of sentinels they are off by. When adding, the sentinel chosen is the
+// least loaded one on a host the pod does not already have a sentinel on,
+// preferring hosts other than the pod's master. When removing, a sentinel
+// sharing a host with another of the pod's sentinels goes first, then the
+// most loaded one.
+func (c *Constellation) planRebalance(ctx context.Context, pods []*common.RedisPod) (plan common.RebalancePlan, err error) {
+	plan.Created = time.Now()
+	all, err := c.GetAllSentinels(ctx)
+	if err != nil {
+		return plan, err
+	}
+	available := make(map[string]*Sentinel)
+	for _, s := range all {
+		available[s.Name] = s
+	}
+
+	// Current assignments come from the cached map for pods outside the
+	// plan, and are refreshed from the sentinels for pods in it.
+	assigned := make(map[string]map[string]bool)
+	for podname, slist := range c.PodToSentinelsMap {
+		assigned[podname] = make(map[string]bool)
+		for _, s := range slist {
+			assigned[podname][s.Name] = true
+		}
+	}
+	for _, pod := range pods {
+		assigned[pod.Name] = make(map[string]bool)
+		for _, s := range c.GetSentinelsForPod(ctx, pod.Name) {
+			assigned[pod.Name][s.Name] = true
+		}
+	}
+
+	load := make(map[string]int)
+	for name := range available {
+		load[name] = 0
+	}
+	for _, set := range assigned {
+		for name := range set {
+			load[name]++
+		}
+	}
+	plan.Load = make(map[string]int)
+	for name, count := range load {
+		plan.Load[name] = count
+	}
+
+	sort.Sort(podsByName(pods))
+	for _, pod := range pods {
+		if pod.Info.Quorum < 1 {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("Pod '%s' has no known quorum, skipping", pod.Name))
+			continue
+		}
+		needed := pod.Info.Quorum + 1
+		current := assigned[pod.Name]
+		hosts := make(map[string]int)
+		for name := range current {
+			hosts[sentinelHost(available, name)]++
+		}
+		have := len(current)
+
+		for have < needed {
+			candidate := ""
+			for _, name := range sortedSentinelNames(available) {
+				if current[name] {
+					continue
+				}
+				if candidate == "" || betterPlacement(name, candidate, pod, available, hosts, load) {
+					candidate = name
+				}
+			}
+			if candidate == "" {
+				plan.Warnings = append(plan.Warnings, fmt.Sprintf("Pod '%s' needs %d sentinels but only %d are available", pod.Name, needed, have))
+				break
+			}
+			host := sentinelHost(available, candidate)
+			reason := fmt.Sprintf("pod has %d of %d sentinels; %s monitors %d pods", have, needed, candidate, load[candidate])
+			if hosts[host] > 0 {
+				reason += fmt.Sprintf(" (host %s already has one of the pod's sentinels)", host)
+			}
+			plan.Moves = append(plan.Moves, common.RebalanceMove{Pod: pod.Name, Action: common.RebalanceAdd, Sentinel: candidate, Host: host, Reason: reason})
+			current[candidate] = true
+			hosts[host]++
+			load[candidate]++
+			have++
+		}
+
+		for have > needed {
+			candidate := ""
+			for name := range current {
+				if _, reachable := available[name]; !reachable {
+					continue
+				}
+				if candidate == "" || betterRemoval(name, candidate, available, hosts, load) {
+					candidate = name
+				}
+			}
+			if candidate == "" {
+				plan.Warnings = append(plan.Warnings, fmt.Sprintf("Pod '%s' has %d sentinels but none can be reached to remove it from", pod.Name, have))
+				break
+			}
+			host := sentinelHost(available, candidate)
+			reason := fmt.Sprintf("pod has %d sentinels, needs %d; %s monitors %d pods", have, needed, candidate, load[candidate])
+			if hosts[host] > 1 {
+				reason = fmt.Sprintf("pod has %d sentinels, needs %d; %s shares host %s with another of the pod's sentinels", have, needed, candidate, host)
+			}
+			plan.Moves = append(plan.Moves, common.RebalanceMove{Pod: pod.Name, Action: common.RebalanceRemove, Sentinel: candidate, Host: host, Reason: reason})
+			delete(current, candidate)
+			hosts[host]--
+			load[candidate]--
+			have--
+		}
+	}
+	plan.ProjectedLoad = load
+	plan.SetFingerprint()
+	return plan, nil
+}
+
+// betterPlacement returns true if sentinel a is a better place to add the
+// pod than sentinel b
+func betterPlacement(a, b string, pod *common.RedisPod, available map[string]*Sentinel, hosts map[string]int, load map[string]int) bool {
+	ha, hb := sentinelHost(available, a), sentinelHost(available, b)
+	if (hosts[ha] > 0) != (hosts[hb] > 0) {
+		return hosts[ha] == 0
+	}
+	if (ha == pod.Info.IP) != (hb == pod.Info.IP) {
+		return hb == pod.Info.IP
+	}
+	if load[a] != load[b] {
+		return load[a] < load[b]
+	}
+	return a < b
+}
+
+// betterRemoval returns true if sentinel a is a better one to remove the pod
+// from than sentinel b
+func betterRemoval(a, b string, available map[string]*Sentinel, hosts map[string]int, load map[string]int) bool {
+	ha, hb := sentinelHost(available, a), sentinelHost(available, b)
+	if (hosts[ha] > 1) != (hosts[hb] > 1) {
+		return hosts[ha] > 1
+	}
+	if load[a] != load[b] {
+		return load[a] > load[b]
+	}
+	return a < b
+}
+
+// sentinelHost returns the host a sentinel runs on, falling back to the host
+// part of its name for sentinels which can not be reached
+func sentinelHost(available map[string]*Sentinel, name string) string {
+	if s, ok := available[name]; ok && s.Host > "" {
+		return s.Host
+	}
+	host, _, err := GetAddressPair(name)
+	if err != nil {
+		return name
+	}
+	return host
+}
+
+func sortedSentinelNames(sentinels map[string]*Sentinel) []string {
+	var names []string
+	for name := range sentinels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ConfirmRebalance recomputes the constellation plan and executes it if it
+// matches the fingerprint of the previewed plan. Without a fingerprint
+// nothing is executed and ErrRebalanceUnconfirmed is returned. If the fresh
+// plan does not match it, nothing is executed and ErrRebalancePlanChanged is
+// returned along with the new plan.
+func (c *Constellation) ConfirmRebalance(ctx context.Context, fingerprint string) (plan common.RebalancePlan, report common.RebalanceReport, err error) {
+	if fingerprint == "" {
+		return plan, report, ErrRebalanceUnconfirmed
+	}
+	plan, err = c.PlanRebalance(ctx)
+	if err != nil {
+		return plan, report, err
+	}
+	if fingerprint != plan.Fingerprint {
+		return plan, report, ErrRebalancePlanChanged
+	}
+	report = c.ExecuteRebalance(ctx, plan)
+	return plan, report, nil
+}
+
+// ExecuteRebalance carries out the moves in the plan, then refreshes the
+// sentinel mappings of every pod it touched. It rewrites the constellation's
+// pod maps, so the caller must hold the constellation's lock, as must
+// callers of ConfirmRebalance, BalancePod and Balance.
+func (c *Constellation) ExecuteRebalance(ctx context.Context, plan common.RebalancePlan) (report common.RebalanceReport) {
+	report.Fingerprint = plan.Fingerprint
+	if !plan.HasChanges() {
+		return report
+	}
+	all, _ := c.GetAllSentinels(ctx)
+	available := make(map[string]*Sentinel)
+	for _, s := range all {
+		available[s.Name] = s
+	}
+	pods := make(map[string]*common.RedisPod)
+	removed := make(map[string]bool)
+	for _, move := range plan.Moves {
+		res := common.RebalanceResult{Move: move}
+		sentinel, ok := available[move.Sentinel]
+		if !ok {
+			res.Error = fmt.Sprintf("sentinel %s is not reachable", move.Sentinel)
+			report.Results = append(report.Results, res)
+			continue
+		}
+		pod, ok := pods[move.Pod]
+		if !ok {
+			var err error
+			pod, err = c.GetPod(ctx, move.Pod)
+			if pod == nil || pod.Name == "" {
+				res.Error = fmt.Sprintf("unable to load pod: %v", err)
+				report.Results = append(report.Results, res)
+				continue
+			}
+			if pod.AuthToken == "" {
+				pod.AuthToken = c.GetPodAuth(pod.Name)
+			}
+			pods[move.Pod] = pod
+		}
+		switch move.Action {
+		case common.RebalanceAdd:
+			logging.Pod(pod.Name).Sentinel(sentinel.Name).Debugf("Rebalance: adding %s to sentinel %s", pod.Name, sentinel.Name)
+			_, err := sentinel.MonitorPod(ctx, pod.Name, pod.Info.IP, pod.Info.Port, pod.Info.Quorum, pod.AuthToken)
+			if err != nil {
+				res.Error = err.Error()
+			}
+		case common.RebalanceRemove:
+			logging.Pod(pod.Name).Sentinel(sentinel.Name).Debugf("Rebalance: removing %s from sentinel %s", pod.Name, sentinel.Name)
+			ok, err := sentinel.RemovePod(ctx, pod.Name)
+			if err != nil {
+				res.Error = err.Error()
+			} else if !ok {
+				res.Error = "sentinel refused removal"
+			} else {
+				removed[pod.Name] = true
+			}
+		default:
+			res.Error = fmt.Sprintf("unknown action '%s'", move.Action)
+		}
+		res.Applied = res.Error == ""
+		report.Results = append(report.Results, res)
+	}
+
+	common.Sleep(ctx, 500*time.Millisecond) // wait for propagation between sentinels
+	for name, pod := range pods {
+		// Remaining sentinels keep a pod's removed sentinel in their lists
+		// until reset
+		if removed[name] {
+			c.ResetPod(ctx, name, true)
+		}
+		slist := c.GetSentinelsForPod(ctx, name)
+		pod.SentinelCount = len(slist)
+		isLocal := false
+		for _, s := range slist {
+			if s.Name == c.LocalSentinel.Name {
+				isLocal = true
+			}
+		}
+		if isLocal {
+			c.LocalPodMap[name] = pod
+		} else {
+			delete(c.LocalPodMap, name)
+			c.RemotePodMap[name] = pod
+		}
+		logging.Pod(name).Infof("Rebalance of %s completed, it now has %d sentinels", name, pod.SentinelCount)
+	}
+	return report
+}
+
+// podsByName sorts pods by name
+type podsByName []*common.RedisPod
+
+func (p podsByName) Len() int           { return len(p) }
+func (p podsByName) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p podsByName) Less(i, j int) bool { return p[i].Name < p[j].Name }
@@ -2,15 +2,16 @@ package actions
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"strings"
 
 	"github.com/therealbill/libredis/client"
 	"github.com/therealbill/libredis/structures"
 	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-shared/logging"
 )
 
 type Sentinel struct {
@@ -27,30 +28,61 @@ type Sentinel struct {
 	DialConfig     client.DialConfig
 }
 
-func (s *Sentinel) GetMasters() (master []structures.MasterInfo, err error) {
-	conn, err := client.Dial(s.Host, s.Port)
+// dial connects to the sentinel within the context's deadline
+func (s *Sentinel) dial(ctx context.Context) (*client.Redis, error) {
+	return common.Dial(ctx, client.DialConfig{Address: fmt.Sprintf("%s:%d", s.Host, s.Port)})
+}
+
+// connect dials the sentinel at address and keeps the connection, along
+// with the sentinel's INFO, on s
+func (s *Sentinel) connect(ctx context.Context, address string) error {
+	conn, err := common.Dial(ctx, client.DialConfig{Address: address})
+	if err != nil {
+		return err
+	}
+	s.Connection = conn
+	var info structures.RedisInfoAll
+	if common.Do(ctx, func() (err error) {
+		info, err = conn.SentinelInfo()
+		return err
+	}) == nil {
+		s.Info = info
+	}
+	return nil
+}
+
+func (s *Sentinel) GetMasters(ctx context.Context) (master []structures.MasterInfo, err error) {
+	conn, err := s.dial(ctx)
 	if err != nil {
 		return
 	}
 	defer conn.ClosePool()
-	return conn.SentinelMasters()
+	var masters []structures.MasterInfo
+	err = common.Do(ctx, func() (err error) {
+		masters, err = conn.SentinelMasters()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return masters, nil
 }
 
-func (s *Sentinel) PodCount() int {
-	s.LoadPods()
+func (s *Sentinel) PodCount(ctx context.Context) int {
+	s.LoadPods(ctx)
 	return len(s.PodMap)
 }
 
-func (s *Sentinel) LoadPods() error {
+func (s *Sentinel) LoadPods(ctx context.Context) error {
 	var pods []common.RedisPod
 	var epods []common.RedisPod
 	podmap := make(map[string]common.RedisPod)
 	if s.KnownSentinels == nil {
 		s.KnownSentinels = make(map[string]*Sentinel)
 	}
-	masters, err := s.GetMasters()
+	masters, err := s.GetMasters(ctx)
 	if err != nil {
-		log.Print("S:LP-> sentinel error:", err)
+		logging.Op("LoadPods").Sentinel(s.Name).Errorf("Sentinel error: %s", err)
 		return err
 	}
 	//log.Printf("S:LP -> sentinel %s has %d masters to load", s.Name, len(masters))
@@ -58,17 +90,17 @@ func (s *Sentinel) LoadPods() error {
 		//log.Printf("S:LP-> (%d) sentinel %s loading master: %s", i, s.Name, mi.Name)
 		auth, err := s.GetPodAuthFromConfig(mi.Name)
 		if err != nil {
-			log.Print("GetPodAuthFromConfig returned error ", err)
+			logging.Errorf("GetPodAuthFromConfig returned error %s", err)
 			continue
 		}
 		if auth == "" {
-			log.Printf("Pod %s is non-local, trying to return from podmap (no auth)", mi.Name)
+			logging.Pod(mi.Name).Debugf("Pod %s is non-local, trying to return from podmap (no auth)", mi.Name)
 			pod, exists := s.PodMap[mi.Name]
 			if exists {
 				podmap[mi.Name] = pod
 				continue
 			}
-			log.Printf("Pod %s is neither in local podmap for sentinel %s nor has auth", mi.Name, s.Name)
+			logging.Pod(mi.Name).Sentinel(s.Name).Debugf("Pod %s is neither in local podmap for sentinel %s nor has auth", mi.Name, s.Name)
 			continue
 		}
 		rp, err := NewMasterFromMasterInfo(mi, auth)
@@ -80,9 +112,9 @@ func (s *Sentinel) LoadPods() error {
 		// Currently a bug in redis means the sentinels counts in the info
 		// commands are NOT always current. So we calculate it here
 		//log.Print("S:LP -> Checking on sentinels")
-		pod_sentinels, err := s.GetSentinels(rp.Name)
+		pod_sentinels, err := s.GetSentinels(ctx, rp.Name)
 		if err != nil {
-			log.Printf("WARNING: Sentinel '%s' is recorded as havig pod '%s' but it doesn't return. Err is '%s'", s.Name, rp.Name, err)
+			logging.Sentinel(s.Name).Pod(rp.Name).Warnf("Sentinel '%s' is recorded as havig pod '%s' but it doesn't return. Err is '%s'", s.Name, rp.Name, err)
 			continue
 		}
 		//log.Print("S:LP GetSentinels returned")
@@ -93,7 +125,7 @@ func (s *Sentinel) LoadPods() error {
 		//log.Printf("Sentinel %s reports pod %s has %d sentinels", s.Name, rp.Name, rp.SentinelCount)
 
 		//log.Printf("S:LP-> got rp=%s", rp.Name)
-		if rp.HasErrors() {
+		if rp.HasErrors(ctx) {
 			epods = append(epods, rp)
 		}
 		podmap[mi.Name] = rp
@@ -106,60 +138,89 @@ func (s *Sentinel) LoadPods() error {
 	return err
 }
 
-func (s *Sentinel) DoFailover(podname string) (ok bool, err error) {
+func (s *Sentinel) DoFailover(ctx context.Context, podname string) (ok bool, err error) {
 	// Q: Move error handling/reporting to constellation?
-	conn, err := client.Dial(s.Host, s.Port)
+	conn, err := s.dial(ctx)
 	if err != nil {
 		return
 	}
-	didFailover, err := conn.SentinelFailover(podname)
-	return didFailover, err
+	defer conn.ClosePool()
+	var didFailover bool
+	err = common.Do(ctx, func() (err error) {
+		didFailover, err = conn.SentinelFailover(podname)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return didFailover, nil
 }
 
-func (s *Sentinel) ResetPod(podname string) {
-	conn, err := client.Dial(s.Host, s.Port)
+func (s *Sentinel) ResetPod(ctx context.Context, podname string) {
+	conn, err := s.dial(ctx)
 	if err != nil {
 		return
 	}
 	defer conn.ClosePool()
-	err = conn.SentinelReset(podname)
+	err = common.Do(ctx, func() error {
+		return conn.SentinelReset(podname)
+	})
 	if err != nil {
-		log.Print("Error on reset call for " + podname + " Err=" + err.Error())
+		logging.Pod(podname).Errorf("Error on reset call for %s Err=%s", podname, err)
 	}
 }
 
-func (s *Sentinel) GetSlaves(podname string) (slaves []structures.SlaveInfo, err error) {
+func (s *Sentinel) GetSlaves(ctx context.Context, podname string) (slaves []structures.SlaveInfo, err error) {
 	// TODO: Bubble errors to out custom error package
 	// See DoFailover for an example
-	conn, err := client.Dial(s.Host, s.Port)
+	conn, err := s.dial(ctx)
 	if err != nil {
 		return
 	}
 	defer conn.ClosePool()
-	return conn.SentinelSlaves(podname)
+	var found []structures.SlaveInfo
+	err = common.Do(ctx, func() (err error) {
+		found, err = conn.SentinelSlaves(podname)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return found, nil
 }
 
-func (s *Sentinel) GetSentinels(podname string) (sentinels []*Sentinel, err error) {
-	conn, err := client.Dial(s.Host, s.Port)
+func (s *Sentinel) GetSentinels(ctx context.Context, podname string) (sentinels []*Sentinel, err error) {
+	conn, err := s.dial(ctx)
 	if err != nil {
 		return
 	}
 	defer conn.ClosePool()
-	sinfos, err := conn.SentinelSentinels(podname)
+	var sinfos []structures.SentinelInfo
+	err = common.Do(ctx, func() (err error) {
+		sinfos, err = conn.SentinelSentinels(podname)
+		return err
+	})
 	if err != nil {
 		return sentinels, err
 	}
 	stracker := make(map[string]*Sentinel)
 	for _, sent := range sinfos {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		sentinel := Sentinel{Name: sent.Name, Host: sent.IP, Port: sent.Port}
-		conn, err := client.Dial(sent.IP, sent.Port)
+		conn, err := sentinel.dial(ctx)
 		if err != nil {
 			//log.Printf("Unable to connect to sentinel %s. Error reported as '%s'", sent.Name, err.Error())
 			continue
 		}
 		defer conn.ClosePool()
 		sentinel.Connection = conn
-		pm, err := sentinel.Connection.SentinelGetMaster(podname)
+		var pm structures.MasterAddress
+		err = common.Do(ctx, func() (err error) {
+			pm, err = conn.SentinelGetMaster(podname)
+			return err
+		})
 		if err != nil || pm.Port == 0 {
 			//log.Printf("S:GS -> %s said %s had pod %s but it didn't.", s.Name, sentinel.Name, podname)
 		} else {
@@ -173,44 +234,57 @@ func (s *Sentinel) GetSentinels(podname string) (sentinels []*Sentinel, err erro
 	return sentinels, nil
 }
 
-func (s *Sentinel) GetConnection() (conn *client.Redis, err error) {
-	conn, err = client.Dial(s.Host, s.Port)
-	return
+// GetConnection returns a connection to the sentinel, dialed within the
+// context's deadline. Calls made on it are not bound by the context; wrap
+// them in common.Do.
+func (s *Sentinel) GetConnection(ctx context.Context) (conn *client.Redis, err error) {
+	return s.dial(ctx)
 }
 
-func (s *Sentinel) GetMaster(podname string) (master structures.MasterAddress, err error) {
-	if s.Connection == nil {
-		log.Fatal("s.Connection is nil, connection not initialzed!")
-	}
-	conn, err := client.Dial(s.Host, s.Port)
+func (s *Sentinel) GetMaster(ctx context.Context, podname string) (master structures.MasterAddress, err error) {
+	conn, err := s.dial(ctx)
 	if err != nil {
 		return
 	}
-	master, err = conn.SentinelGetMaster(podname)
+	defer conn.ClosePool()
+	var found structures.MasterAddress
+	err = common.Do(ctx, func() (err error) {
+		found, err = conn.SentinelGetMaster(podname)
+		return err
+	})
 	// TODO: THis needs changed to our custom errors package
-	return
+	if err != nil {
+		return master, err
+	}
+	return found, nil
 }
 
-func (s *Sentinel) MonitorPod(podname, address string, port, quorum int, auth string) (rp common.RedisPod, err error) {
+func (s *Sentinel) MonitorPod(ctx context.Context, podname, address string, port, quorum int, auth string) (rp common.RedisPod, err error) {
 	// TODO: Update to new common and error packages
 	//log.Printf("S:MP-> add called for %s-> %s:%d", podname, address, port)
-	conn, err := client.Dial(s.Host, s.Port)
+	conn, err := s.dial(ctx)
 	if err != nil {
 		return
 	}
-	_, err = conn.SentinelMonitor(podname, address, port, quorum)
+	defer conn.ClosePool()
+	err = common.Do(ctx, func() error {
+		if _, err := conn.SentinelMonitor(podname, address, port, quorum); err != nil {
+			return err
+		}
+		if auth > "" {
+			conn.SentinelSetString(podname, "auth-pass", auth)
+		}
+		return nil
+	})
 	if err != nil {
 		return rp, err
 	}
-	if auth > "" {
-		conn.SentinelSetString(podname, "auth-pass", auth)
-	}
-	s.LoadPods()
-	rp, err = s.GetPod(podname)
+	s.LoadPods(ctx)
+	rp, err = s.GetPod(ctx, podname)
 	if err != nil {
-		log.Printf("S:MP Error on s.GetPod: %s", err.Error())
+		logging.Op("MonitorPod").Pod(podname).Errorf("Error on s.GetPod: %s", err.Error())
 	}
-	_, err = common.LoadNodeFromHostPort(address, port, auth)
+	_, err = common.LoadNodeFromHostPort(ctx, address, port, auth)
 	if err != nil {
 		return rp, fmt.Errorf("S:MP-> unable to load new pod's master node: Error: %s", err)
 	}
@@ -218,12 +292,28 @@ func (s *Sentinel) MonitorPod(podname, address string, port, quorum int, auth st
 	return rp, nil
 }
 
-func (s *Sentinel) RemovePod(podname string) (ok bool, err error) {
-	conn, err := client.Dial(s.Host, s.Port)
+// SetPodParameter issues a SENTINEL SET for the given pod and parameter
+func (s *Sentinel) SetPodParameter(ctx context.Context, podname, key, value string) error {
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.ClosePool()
+	return common.Do(ctx, func() error {
+		return conn.SentinelSetString(podname, key, value)
+	})
+}
+
+func (s *Sentinel) RemovePod(ctx context.Context, podname string) (ok bool, err error) {
+	conn, err := s.dial(ctx)
 	if err != nil {
 		return
 	}
-	_, err = conn.SentinelRemove(podname)
+	defer conn.ClosePool()
+	err = common.Do(ctx, func() error {
+		_, err := conn.SentinelRemove(podname)
+		return err
+	})
 	if err != nil {
 		// convert to custom errors package
 		return false, err
@@ -237,19 +327,25 @@ func (s *Sentinel) GetPods() (pods map[string]common.RedisPod, err error) {
 	return s.PodMap, err
 }
 
-func (s *Sentinel) GetPod(podname string) (rp common.RedisPod, err error) {
+func (s *Sentinel) GetPod(ctx context.Context, podname string) (rp common.RedisPod, err error) {
 	//log.Printf("Sentinel.Getpod called for pod '%s'", podname)
-	conn, err := client.Dial(s.Host, s.Port)
+	conn, err := s.dial(ctx)
 	if err != nil {
 		return
 	}
-	mi, err := conn.SentinelMasterInfo(podname)
+	defer conn.ClosePool()
+	var mi structures.MasterInfo
+	err = common.Do(ctx, func() (err error) {
+		mi, err = conn.SentinelMasterInfo(podname)
+		return err
+	})
 	if err != nil {
-		log.Print("S:GetPod failed to get master info. Err:", err)
+		logging.Op("GetPod").Pod(podname).Errorf("Failed to get master info. Err: %s", err)
 		return rp, err
 	}
 	if mi.Port == 0 {
-		err = fmt.Errorf("WTF?! Got nothing back from SentinelMasterInfo, not even an error")
+		err = fmt.Errorf("Sentinel %s returned no master info for pod '%s'", s.Name, podname)
+		logging.Op("GetPod").Pod(podname).Sentinel(s.Name).Errorf("%s", err)
 		return rp, err
 	}
 	auth, _ := s.GetPodAuthFromConfig(podname)
@@ -260,7 +356,7 @@ func (s *Sentinel) GetPod(podname string) (rp common.RedisPod, err error) {
 		return rp, err
 	}
 	if err != nil {
-		log.Print("S:GetPod failed to get pod from master info. Err:", err)
+		logging.Op("GetPod").Pod(podname).Errorf("Failed to get pod from master info. Err: %s", err)
 		return rp, err
 	}
 	if s.PodMap == nil {
@@ -278,7 +374,7 @@ func (s *Sentinel) GetPodAuthFromConfig(podname string) (string, error) {
 	}
 	file, err := os.Open(s.Info.Server.ConfigFile)
 	if err != nil {
-		log.Printf("unable to open '%s'. Err:%s", s.Info.Server.ConfigFile, err.Error())
+		logging.Errorf("unable to open '%s'. Err:%s", s.Info.Server.ConfigFile, err.Error())
 		return "", err
 	}
 	defer file.Close()
@@ -309,7 +405,7 @@ ReadFile:
 			}
 			break ReadFile
 		default:
-			log.Fatal(err)
+			logging.Fatalf("%s", err)
 		}
 	}
 	for _, line := range lines {
@@ -0,0 +1,96 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/therealbill/libredis/client"
+	"github.com/therealbill/libredis/structures"
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-shared/logging"
+)
+
+// ErrAlreadySlave is returned when adding a slave which already replicates
+// from the pod's master
+var ErrAlreadySlave = errors.New("Already connected to specified master")
+
+// ErrNotSlaveOfPod is returned when removing a node which does not replicate
+// from the pod's master
+var ErrNotSlaveOfPod = errors.New("Node is not a slave of the pod's master")
+
+// AddSlaveToPod points the Redis instance at address:port to the pod's
+// master and sets its auth to the pod's.
+func (c *Constellation) AddSlaveToPod(ctx context.Context, podname, address string, port int, auth string) error {
+	pod, err := c.GetPod(ctx, podname)
+	if err != nil || pod == nil || pod.Name == "" {
+		return fmt.Errorf("Pod '%s' not found", podname)
+	}
+	name := fmt.Sprintf("%s:%d", address, port)
+	log := logging.Pod(podname).Node(name)
+	conn, err := common.Dial(ctx, client.DialConfig{Address: name, Password: auth})
+	if err != nil {
+		log.Errorf("Unable to connect to new slave: %s", err)
+		return fmt.Errorf("Unable to connect to slave %s", name)
+	}
+	defer conn.ClosePool()
+	err = common.Do(ctx, func() error {
+		return conn.SlaveOf(pod.Info.IP, fmt.Sprintf("%d", pod.Info.Port))
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "Already connected to specified master") {
+			return ErrAlreadySlave
+		}
+		log.Errorf("Unable to slave to %s:%d: %s", pod.Info.IP, pod.Info.Port, err)
+		return err
+	}
+	common.Do(ctx, func() error {
+		conn.ConfigSet("masterauth", pod.AuthToken)
+		return conn.ConfigSet("requirepass", pod.AuthToken)
+	})
+	if pod.Master != nil {
+		pod.Master.LastUpdateValid = false
+	}
+	c.PodMap[pod.Name] = pod
+	log.Infof("Added slave %s to pod %s", name, podname)
+	return nil
+}
+
+// RemoveSlaveFromPod detaches the slave at address, in host:port form, from
+// the pod's master and resets the pod's sentinels so they forget it. The
+// node keeps its data but no longer replicates.
+func (c *Constellation) RemoveSlaveFromPod(ctx context.Context, podname, address string) error {
+	pod, err := c.GetPod(ctx, podname)
+	if err != nil || pod == nil || pod.Name == "" {
+		return fmt.Errorf("Pod '%s' not found", podname)
+	}
+	log := logging.Pod(podname).Node(address)
+	conn, err := common.Dial(ctx, client.DialConfig{Address: address, Password: pod.AuthToken})
+	if err != nil {
+		log.Errorf("Unable to connect to slave: %s", err)
+		return fmt.Errorf("Unable to connect to slave %s", address)
+	}
+	defer conn.ClosePool()
+	var info structures.RedisInfoAll
+	err = common.Do(ctx, func() (err error) {
+		info, err = conn.Info()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if info.Replication.Role != "slave" || info.Replication.MasterHost != pod.Info.IP || info.Replication.MasterPort != pod.Info.Port {
+		return ErrNotSlaveOfPod
+	}
+	err = common.Do(ctx, func() error {
+		return conn.SlaveOf("no", "one")
+	})
+	if err != nil {
+		log.Errorf("Unable to detach slave: %s", err)
+		return err
+	}
+	log.Infof("Removed slave %s from pod %s", address, podname)
+	c.ResetPod(ctx, podname, true)
+	return nil
+}
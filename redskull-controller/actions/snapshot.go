@@ -0,0 +1,208 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-shared/logging"
+)
+
+// SecretKey is the key used to encrypt secrets leaving the controller, such
+// as pod auth tokens in exported snapshots. It is loaded from the file named
+// by REDSKULL_SECRETKEYFILE.
+var SecretKey []byte
+
+// snapshotParameters are the sentinel parameters recorded for each pod
+var snapshotParameters = []string{"down-after-milliseconds", "failover-timeout", "parallel-syncs"}
+
+// ExportSnapshot builds a versioned snapshot of the constellation's
+// topology. When encrypt is set pod auth tokens are encrypted with SecretKey;
+// otherwise a warning is logged if any are exported in plaintext.
+func (c *Constellation) ExportSnapshot(ctx context.Context, encrypt bool) (snap common.ConstellationSnapshot, err error) {
+	if encrypt && len(SecretKey) == 0 {
+		return snap, errors.New("Encrypted export requested but no secret key is configured")
+	}
+	snap.Version = common.SnapshotVersion
+	snap.Name = c.Name
+	snap.Created = time.Now()
+	snap.Encrypted = encrypt
+
+	podmap, _ := c.GetPodMap()
+	for name, pod := range c.PodMap {
+		if _, have := podmap[name]; !have {
+			podmap[name] = pod
+		}
+	}
+	sentinelPods := make(map[string][]string)
+	for name, pod := range podmap {
+		if name == "" {
+			continue
+		}
+		ps := common.PodSnapshot{
+			Name:       name,
+			Master:     fmt.Sprintf("%s:%d", pod.Info.IP, pod.Info.Port),
+			Quorum:     pod.Info.Quorum,
+			Parameters: make(map[string]string),
+		}
+		if pod.Master != nil {
+			for _, slave := range pod.Master.Slaves {
+				if slave != nil && slave.Name > "" {
+					ps.Replicas = append(ps.Replicas, slave.Name)
+				}
+			}
+		}
+		for _, s := range c.PodToSentinelsMap[name] {
+			ps.Sentinels = append(ps.Sentinels, s.Name)
+			sentinelPods[s.Name] = append(sentinelPods[s.Name], name)
+		}
+		for _, key := range snapshotParameters {
+			if val, ok := currentSentinelParameter(pod.Info, key); ok {
+				ps.Parameters[key] = val
+			}
+		}
+		ps.AuthToken, err = c.snapshotAuth(ctx, name, pod.AuthToken, encrypt)
+		if err != nil {
+			return snap, err
+		}
+		snap.Pods = append(snap.Pods, ps)
+	}
+	// Pods in the local config the sentinel no longer reports still belong
+	// in the record
+	for name, cfg := range c.SentinelConfig.ManagedPodConfigs {
+		if _, have := podmap[name]; have || name == "" {
+			continue
+		}
+		ps := common.PodSnapshot{Name: name, Master: fmt.Sprintf("%s:%d", cfg.IP, cfg.Port), Quorum: cfg.Quorum}
+		ps.AuthToken, err = c.snapshotAuth(ctx, name, cfg.AuthToken, encrypt)
+		if err != nil {
+			return snap, err
+		}
+		snap.Pods = append(snap.Pods, ps)
+	}
+	sort.Sort(podSnapshots(snap.Pods))
+
+	snap.Sentinels = append(snap.Sentinels, common.SentinelSnapshot{
+		Name:  c.LocalSentinel.Name,
+		Host:  c.LocalSentinel.Host,
+		Port:  c.LocalSentinel.Port,
+		Local: true,
+		Pods:  sentinelPods[c.LocalSentinel.Name],
+	})
+	for name, s := range c.RemoteSentinels {
+		snap.Sentinels = append(snap.Sentinels, common.SentinelSnapshot{Name: name, Host: s.Host, Port: s.Port, Pods: sentinelPods[name]})
+	}
+	for _, ss := range snap.Sentinels {
+		sort.Strings(ss.Pods)
+	}
+	if !encrypt {
+		plaintext := 0
+		for _, ps := range snap.Pods {
+			if ps.AuthToken > "" {
+				plaintext++
+			}
+		}
+		if plaintext > 0 {
+			logging.Op("export").Warnf("Snapshot of %s exported with %d pod auth tokens in plaintext", c.Name, plaintext)
+		}
+	}
+	return snap, nil
+}
+
+// snapshotAuth returns the auth token to record for the pod, encrypted if
+// requested
+func (c *Constellation) snapshotAuth(ctx context.Context, podname, known string, encrypt bool) (string, error) {
+	auth := known
+	if auth == "" {
+		auth = c.GetPodAuth(podname)
+	}
+	if !encrypt {
+		return auth, nil
+	}
+	return common.EncryptSecret(SecretKey, auth)
+}
+
+// RestoreSnapshot re-monitors every pod in the snapshot which the
+// constellation does not already know about. Pods are placed on the
+// currently available sentinels using MonitorPod, so the sentinels recorded
+// in the snapshot do not need to exist.
+func (c *Constellation) RestoreSnapshot(ctx context.Context, snap common.ConstellationSnapshot) (report common.RestoreReport, err error) {
+	if snap.Version < 1 || snap.Version > common.SnapshotVersion {
+		return report, fmt.Errorf("Unsupported snapshot version %d, this RedSkull supports up to %d", snap.Version, common.SnapshotVersion)
+	}
+	if snap.Encrypted && len(SecretKey) == 0 {
+		return report, errors.New("Snapshot is encrypted but no secret key is configured")
+	}
+	known, _ := c.GetPodMap()
+	for _, ps := range snap.Pods {
+		res := common.RestoreResult{Pod: ps.Name}
+		if _, exists := known[ps.Name]; exists {
+			res.Skipped = true
+			res.Message = "pod is already monitored"
+			report.Results = append(report.Results, res)
+			continue
+		}
+		auth, err := common.DecryptSecret(SecretKey, ps.AuthToken)
+		if err != nil {
+			res.Error = err.Error()
+			report.Results = append(report.Results, res)
+			continue
+		}
+		master := findSnapshotMaster(ctx, ps, auth)
+		res.Master = master
+		host, port, err := GetAddressPair(master)
+		if err != nil {
+			res.Error = fmt.Sprintf("invalid master address '%s'", master)
+			report.Results = append(report.Results, res)
+			continue
+		}
+		logging.Pod(ps.Name).Infof("Restoring pod '%s' with master %s", ps.Name, master)
+		ok, err := c.MonitorPod(ctx, ps.Name, host, port, ps.Quorum, auth)
+		if err != nil {
+			res.Error = err.Error()
+		}
+		res.Restored = ok
+		if ok {
+			for _, key := range sortedKeys(ps.Parameters) {
+				err := c.SetPodParameter(ctx, ps.Name, key, ps.Parameters[key])
+				if err != nil {
+					res.Message = fmt.Sprintf("restored, but unable to set %s", key)
+				}
+			}
+		}
+		report.Results = append(report.Results, res)
+	}
+	return report, nil
+}
+
+// findSnapshotMaster returns the address of the pod member currently acting
+// as master. A failover may have happened since the snapshot was taken so
+// the recorded replicas are checked as well. If no member can be reached the
+// recorded master is returned.
+func findSnapshotMaster(ctx context.Context, ps common.PodSnapshot, auth string) string {
+	candidates := append([]string{ps.Master}, ps.Replicas...)
+	for _, address := range candidates {
+		host, port, err := GetAddressPair(address)
+		if err != nil {
+			continue
+		}
+		node, err := common.LoadNodeFromHostPort(ctx, host, port, auth)
+		if err != nil {
+			continue
+		}
+		if node.Info.Replication.Role == "master" {
+			return address
+		}
+	}
+	return ps.Master
+}
+
+// podSnapshots sorts pod snapshots by name
+type podSnapshots []common.PodSnapshot
+
+func (p podSnapshots) Len() int           { return len(p) }
+func (p podSnapshots) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p podSnapshots) Less(i, j int) bool { return p[i].Name < p[j].Name }
@@ -0,0 +1,98 @@
+package actions
+
+import (
+	"context"
+	"sort"
+
+	"github.com/therealbill/redskull/redskull-controller/common"
+)
+
+// SummarizePod returns the list representation of the pod
+func (c *Constellation) SummarizePod(ctx context.Context, pod *common.RedisPod) common.PodSummary {
+	return common.PodSummary{
+		Name:            pod.Name,
+		MasterAddress:   pod.Info.IP,
+		MasterPort:      pod.Info.Port,
+		Quorum:          pod.Info.Quorum,
+		Slaves:          pod.Info.NumSlaves,
+		SentinelCount:   pod.SentinelCount,
+		NeededSentinels: pod.NeededSentinels,
+		HasErrors:       pod.HasErrors(ctx),
+		CanFailover:     pod.CanFailover(ctx),
+		InMaintenance:   c.InMaintenance(pod.Name),
+	}
+}
+
+// SummarizeSentinel returns the list representation of the sentinel
+func (c *Constellation) SummarizeSentinel(ctx context.Context, s *Sentinel) common.SentinelSummary {
+	summary := common.SentinelSummary{Name: s.Name, Host: s.Host, Port: s.Port, Errors: s.Errors, Pods: []string{}}
+	summary.Local = s.Name == c.LocalSentinel.Name
+	for _, pod := range s.Pods {
+		summary.Pods = append(summary.Pods, pod.Name)
+	}
+	sort.Strings(summary.Pods)
+	return summary
+}
+
+// PodSummaries returns a summary of every pod, sorted by name
+func (c *Constellation) PodSummaries(ctx context.Context) []common.PodSummary {
+	pods := []common.PodSummary{}
+	for _, pod := range c.GetPods() {
+		pods = append(pods, c.SummarizePod(ctx, pod))
+	}
+	sort.Sort(podSummariesByName(pods))
+	return pods
+}
+
+// SentinelSummaries returns a summary of every sentinel, sorted by name
+func (c *Constellation) SentinelSummaries(ctx context.Context) []common.SentinelSummary {
+	sentinels := []common.SentinelSummary{}
+	for _, s := range c.GetAllSentinelsQuietly(ctx) {
+		sentinels = append(sentinels, c.SummarizeSentinel(ctx, s))
+	}
+	sort.Sort(sentinelSummariesByName(sentinels))
+	return sentinels
+}
+
+// NodeSummaries returns a summary of every node RedSkull has connected to,
+// sorted by name
+func (c *Constellation) NodeSummaries(ctx context.Context) []common.NodeSummary {
+	nodes := []common.NodeSummary{}
+	for name, node := range c.NodeMap {
+		if node == nil {
+			continue
+		}
+		nodes = append(nodes, common.NodeSummary{
+			Name:              name,
+			Address:           node.Address,
+			Port:              node.Port,
+			Pod:               c.NodeNameToPodMap[name],
+			Role:              node.Info.Replication.Role,
+			Connected:         node.Connected,
+			MaxMemory:         node.MaxMemory,
+			PercentUsed:       node.PercentUsed,
+			MemoryUseWarn:     node.MemoryUseWarn,
+			MemoryUseCritical: node.MemoryUseCritical,
+		})
+	}
+	sort.Sort(nodeSummariesByName(nodes))
+	return nodes
+}
+
+type podSummariesByName []common.PodSummary
+
+func (p podSummariesByName) Len() int           { return len(p) }
+func (p podSummariesByName) Swap(a, b int)      { p[a], p[b] = p[b], p[a] }
+func (p podSummariesByName) Less(a, b int) bool { return p[a].Name < p[b].Name }
+
+type sentinelSummariesByName []common.SentinelSummary
+
+func (s sentinelSummariesByName) Len() int           { return len(s) }
+func (s sentinelSummariesByName) Swap(a, b int)      { s[a], s[b] = s[b], s[a] }
+func (s sentinelSummariesByName) Less(a, b int) bool { return s[a].Name < s[b].Name }
+
+type nodeSummariesByName []common.NodeSummary
+
+func (n nodeSummariesByName) Len() int           { return len(n) }
+func (n nodeSummariesByName) Swap(a, b int)      { n[a], n[b] = n[b], n[a] }
+func (n nodeSummariesByName) Less(a, b int) bool { return n[a].Name < n[b].Name }
@@ -0,0 +1,244 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/therealbill/redskull/redskull-controller/common"
+)
+
+// maxTopologyNodes bounds how many nodes a topology check will crawl
+const maxTopologyNodes = 64
+
+// CheckPodTopology compares what the pod's sentinels report against what the
+// pod's Redis nodes report about replication and returns any anomalies as
+// pod findings. It looks for sentinels disagreeing on the master, more than
+// one node claiming to be master, replicas following an address other than
+// the sentinel-reported master, replicas the sentinels do not know about, and
+// replicas of replicas.
+func (c *Constellation) CheckPodTopology(ctx context.Context, podname string) (report common.TopologyReport, err error) {
+	report.Pod = podname
+	report.Checked = time.Now()
+	report.SentinelMasters = make(map[string]string)
+	report.Nodes = make(map[string]string)
+
+	sentinels := c.GetSentinelsForPod(ctx, podname)
+	if len(sentinels) == 0 {
+		sentinels = c.PodToSentinelsMap[podname]
+	}
+	if len(sentinels) == 0 {
+		return report, fmt.Errorf("No sentinels found for pod '%s'", podname)
+	}
+
+	// What the sentinels say
+	votes := make(map[string]int)
+	known := make(map[string]bool)
+	for _, s := range sentinels {
+		addr, err := s.GetMaster(ctx, podname)
+		if err != nil || addr.Port == 0 {
+			report.Errors = append(report.Errors, fmt.Sprintf("sentinel %s did not return a master: %v", s.Name, err))
+			continue
+		}
+		master := fmt.Sprintf("%s:%d", addr.Host, addr.Port)
+		report.SentinelMasters[s.Name] = master
+		votes[master]++
+		known[master] = true
+		slaves, err := s.GetSlaves(ctx, podname)
+		if err != nil {
+			continue
+		}
+		for _, slave := range slaves {
+			known[fmt.Sprintf("%s:%d", slave.IP, slave.Port)] = true
+		}
+	}
+	if len(votes) == 0 {
+		return report, fmt.Errorf("No sentinel returned a master for pod '%s'", podname)
+	}
+	report.Master = consensusMaster(votes)
+	if len(votes) > 1 {
+		var views []string
+		for _, name := range sortedKeys(report.SentinelMasters) {
+			views = append(views, fmt.Sprintf("%s says %s", name, report.SentinelMasters[name]))
+		}
+		report.Findings = append(report.Findings, common.PodFinding{
+			Pod:      podname,
+			Kind:     common.FindingSentinelDisagreement,
+			Severity: common.SeverityCritical,
+			Detail:   "Sentinels disagree on the master: " + strings.Join(views, ", "),
+		})
+	}
+
+	// What the nodes say. Nodes the sentinels know about, and the replicas
+	// below them, are crawled. Upstream masters of those are checked but not
+	// crawled, so a replica pointing into another pod does not pull that
+	// pod in.
+	auth := c.GetPodAuth(podname)
+	nodes := make(map[string]*common.RedisNode)
+	inPod := make(map[string]bool)
+	var queue []string
+	for _, address := range sortedBoolKeys(known) {
+		queue = append(queue, address)
+		inPod[address] = true
+	}
+	for len(queue) > 0 && len(nodes) < maxTopologyNodes {
+		address := queue[0]
+		queue = queue[1:]
+		if _, seen := nodes[address]; seen {
+			continue
+		}
+		node, err := loadTopologyNode(ctx, address, auth)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("node %s could not be checked: %s", address, err))
+			nodes[address] = nil
+			continue
+		}
+		nodes[address] = node
+		repl := node.Info.Replication
+		report.Nodes[address] = repl.Role
+		if !inPod[address] {
+			continue
+		}
+		if repl.Role == "slave" {
+			upstream := fmt.Sprintf("%s:%d", repl.MasterHost, repl.MasterPort)
+			if _, seen := nodes[upstream]; !seen {
+				queue = append(queue, upstream)
+			}
+		}
+		for _, slave := range repl.Slaves {
+			downstream := fmt.Sprintf("%s:%d", slave.IP, slave.Port)
+			inPod[downstream] = true
+			if _, seen := nodes[downstream]; !seen {
+				queue = append(queue, downstream)
+			}
+		}
+	}
+
+	var masters []string
+	for _, address := range sortedNodeKeys(nodes) {
+		node := nodes[address]
+		if node == nil || !inPod[address] {
+			continue
+		}
+		repl := node.Info.Replication
+		switch repl.Role {
+		case "master":
+			masters = append(masters, address)
+		case "slave":
+			upstream := fmt.Sprintf("%s:%d", repl.MasterHost, repl.MasterPort)
+			if upstream == report.Master {
+				break
+			}
+			if up, ok := nodes[upstream]; ok && up != nil && inPod[upstream] && up.Info.Replication.Role == "slave" {
+				report.Findings = append(report.Findings, common.PodFinding{
+					Pod:      podname,
+					Kind:     common.FindingChainedReplication,
+					Severity: common.SeverityWarning,
+					Node:     address,
+					Detail:   fmt.Sprintf("%s replicates from %s, which is itself a replica", address, upstream),
+				})
+				break
+			}
+			report.Findings = append(report.Findings, common.PodFinding{
+				Pod:      podname,
+				Kind:     common.FindingWrongMaster,
+				Severity: common.SeverityCritical,
+				Node:     address,
+				Detail:   fmt.Sprintf("%s replicates from %s but the sentinels report %s as master", address, upstream, report.Master),
+			})
+		}
+		if !known[address] {
+			report.Findings = append(report.Findings, common.PodFinding{
+				Pod:      podname,
+				Kind:     common.FindingOrphanReplica,
+				Severity: common.SeverityWarning,
+				Node:     address,
+				Detail:   fmt.Sprintf("%s is a %s of the pod but no sentinel knows about it", address, repl.Role),
+			})
+		}
+	}
+	if len(masters) > 1 {
+		report.Findings = append(report.Findings, common.PodFinding{
+			Pod:      podname,
+			Kind:     common.FindingMultipleMasters,
+			Severity: common.SeverityCritical,
+			Detail:   "More than one node claims role:master: " + strings.Join(masters, ", "),
+		})
+	}
+	return report, nil
+}
+
+// CheckTopology runs CheckPodTopology against every pod
+func (c *Constellation) CheckTopology(ctx context.Context) (reports []common.TopologyReport) {
+	for _, pod := range c.GetPods() {
+		report, err := c.CheckPodTopology(ctx, pod.Name)
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+		}
+		reports = append(reports, report)
+	}
+	sort.Sort(topologyReports(reports))
+	return reports
+}
+
+// loadTopologyNode loads the node and forces fresh INFO, as stale
+// replication data is exactly what a topology check must avoid
+func loadTopologyNode(ctx context.Context, address, auth string) (*common.RedisNode, error) {
+	host, port, err := GetAddressPair(address)
+	if err != nil {
+		return nil, err
+	}
+	node, err := common.LoadNodeFromHostPort(ctx, host, port, auth)
+	if err != nil {
+		return nil, err
+	}
+	node.LastUpdateValid = false
+	if _, err := node.UpdateData(ctx); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// consensusMaster returns the master address with the most votes, breaking
+// ties by address so the result is stable
+func consensusMaster(votes map[string]int) (master string) {
+	for _, address := range sortedIntKeys(votes) {
+		if master == "" || votes[address] > votes[master] {
+			master = address
+		}
+	}
+	return master
+}
+
+func sortedBoolKeys(m map[string]bool) (keys []string) {
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedIntKeys(m map[string]int) (keys []string) {
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedNodeKeys(m map[string]*common.RedisNode) (keys []string) {
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// topologyReports sorts topology reports by pod name
+type topologyReports []common.TopologyReport
+
+func (t topologyReports) Len() int           { return len(t) }
+func (t topologyReports) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t topologyReports) Less(i, j int) bool { return t[i].Pod < t[j].Pod }
@@ -0,0 +1,148 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-controller/events"
+	"github.com/therealbill/redskull/redskull-shared/logging"
+)
+
+// WatchInterval is how often the constellation is checked for pod error and
+// master changes. Zero disables the watcher.
+var WatchInterval = 30 * time.Second
+
+// Watch periodically checks every pod's error state and master so events are
+// published even when nobody is looking at the UI, and takes pods whose
+// maintenance has expired out of maintenance. Each pass is bounded by
+// common.CallTimeout. It takes the constellation's lock for the error check
+// and for each pod's master in turn, so changes to the constellation are
+// not held up for the whole pass. It returns when the context ends.
+func (c *Constellation) Watch(ctx context.Context) {
+	if WatchInterval <= 0 {
+		return
+	}
+	logging.Infof("Watching constellation for pod changes every %s", WatchInterval)
+	ticker := time.NewTicker(WatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		pass, cancel := common.WithCallTimeout(ctx)
+		c.Acquire()
+		c.ClearExpiredMaintenance(pass)
+		c.ErrorPodCount(pass)
+		names := sortedPodNames(c.PodMap)
+		c.Release()
+		for _, name := range names {
+			c.Acquire()
+			c.GetMaster(pass, name)
+			c.Release()
+		}
+		if pass.Err() == context.DeadlineExceeded {
+			logging.Warnf("Watch pass did not finish within %s", common.CallTimeout)
+		}
+		cancel()
+	}
+}
+
+// notePodErrorState publishes an event when a pod's error state differs
+// from the last one seen. The first state seen for a pod is only recorded.
+// Snapshots record nothing.
+func (c *Constellation) notePodErrorState(ctx context.Context, pod *common.RedisPod, hasErrors bool) {
+	if c.snapshot {
+		return
+	}
+	if c.podErrorState == nil {
+		c.podErrorState = make(map[string]bool)
+	}
+	previous, seen := c.podErrorState[pod.Name]
+	c.podErrorState[pod.Name] = hasErrors
+	if !seen || previous == hasErrors {
+		return
+	}
+	if hasErrors {
+		reasons := podErrorReasons(ctx, pod)
+		severity := common.SeverityWarning
+		if !pod.CanFailover(ctx) || pod.MissingSentinels {
+			severity = common.SeverityCritical
+		}
+		events.Publish(common.Event{
+			Type:     common.EventPodError,
+			Severity: severity,
+			Pod:      pod.Name,
+			Message:  fmt.Sprintf("Pod '%s' has errors: %s", pod.Name, strings.Join(reasons, ", ")),
+			Data:     map[string]string{"reasons": strings.Join(reasons, ",")},
+		})
+		return
+	}
+	events.Publish(common.Event{
+		Type:     common.EventPodRecovered,
+		Severity: common.SeverityInfo,
+		Pod:      pod.Name,
+		Message:  fmt.Sprintf("Pod '%s' no longer has errors", pod.Name),
+	})
+}
+
+// noteMaster publishes an event when a pod's master differs from the last
+// one seen. The first master seen for a pod is only recorded. Snapshots
+// record nothing.
+func (c *Constellation) noteMaster(podname, sentinel, master string) {
+	if c.snapshot {
+		return
+	}
+	if c.podMasters == nil {
+		c.podMasters = make(map[string]string)
+	}
+	previous, seen := c.podMasters[podname]
+	c.podMasters[podname] = master
+	if !seen || previous == master {
+		return
+	}
+	events.Publish(common.Event{
+		Type:     common.EventMasterChanged,
+		Severity: common.SeverityWarning,
+		Pod:      podname,
+		Sentinel: sentinel,
+		Message:  fmt.Sprintf("Pod '%s' master changed from %s to %s", podname, previous, master),
+		Data:     map[string]string{"previous": previous, "master": master},
+	})
+}
+
+// podErrorReasons lists why HasErrors considers the pod to be in error
+func podErrorReasons(ctx context.Context, pod *common.RedisPod) (reasons []string) {
+	if pod.MissingSentinels {
+		reasons = append(reasons, "missing-sentinels")
+	}
+	if pod.NeedsReset {
+		reasons = append(reasons, "needs-reset")
+	}
+	if pod.TooManySentinels {
+		reasons = append(reasons, "too-many-sentinels")
+	}
+	if !pod.CanFailover(ctx) {
+		reasons = append(reasons, "cannot-failover")
+	}
+	if !pod.SlavesHaveEnoughMemory() {
+		reasons = append(reasons, "slaves-lack-memory")
+	}
+	if len(reasons) == 0 {
+		reasons = append(reasons, "unknown")
+	}
+	return reasons
+}
+
+func sortedPodNames(m map[string]*common.RedisPod) (keys []string) {
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
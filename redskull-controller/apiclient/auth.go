@@ -0,0 +1,53 @@
+package apiclient
+
+import "net/http"
+
+// Authenticator adds credentials to a request before it is sent
+type Authenticator interface {
+	Authenticate(r *http.Request) error
+}
+
+// AuthFunc adapts a function to an Authenticator, for schemes such as
+// fetching short lived tokens
+type AuthFunc func(r *http.Request) error
+
+// Authenticate calls f(r)
+func (f AuthFunc) Authenticate(r *http.Request) error {
+	return f(r)
+}
+
+// BasicAuth authenticates with HTTP basic auth, for RedSkull's htpasswd
+// authentication
+type BasicAuth struct {
+	User     string
+	Password string
+}
+
+// Authenticate sets the request's basic auth credentials
+func (a BasicAuth) Authenticate(r *http.Request) error {
+	r.SetBasicAuth(a.User, a.Password)
+	return nil
+}
+
+// TokenAuth authenticates with an API token sent as a bearer token
+type TokenAuth struct {
+	Token string
+}
+
+// Authenticate sets the request's Authorization header
+func (a TokenAuth) Authenticate(r *http.Request) error {
+	r.Header.Set("Authorization", "Bearer "+a.Token)
+	return nil
+}
+
+// HeaderAuth sets fixed headers, such as the user and role headers expected
+// when RedSkull sits behind an authenticating proxy
+type HeaderAuth map[string]string
+
+// Authenticate sets the headers on the request
+func (a HeaderAuth) Authenticate(r *http.Request) error {
+	for k, v := range a {
+		r.Header.Set(k, v)
+	}
+	return nil
+}
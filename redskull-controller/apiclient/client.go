@@ -0,0 +1,260 @@
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/therealbill/redskull/redskull-controller/common"
+)
+
+// APIPrefix is the path the v2 API is served under
+const APIPrefix = "/api/v2"
+
+// DefaultTimeout bounds each attempt of a call when Config.Timeout is unset
+const DefaultTimeout = 30 * time.Second
+
+// DefaultRetryPolicy is used when Config.Retry is unset
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 3, MinBackoff: 250 * time.Millisecond, MaxBackoff: 5 * time.Second}
+
+// Config configures a Client
+type Config struct {
+	// URL is the RedSkull base URL, such as http://redskull:8000
+	URL string
+	// Auth authenticates every request. Nil sends no credentials.
+	Auth Authenticator
+	// HTTPClient is used to make requests. http.DefaultClient if nil.
+	HTTPClient *http.Client
+	// Timeout bounds each attempt of a call, DefaultTimeout if zero. It does
+	// not apply to event streams.
+	Timeout time.Duration
+	// Retry controls retries of idempotent calls, DefaultRetryPolicy if
+	// MaxAttempts is zero.
+	Retry RetryPolicy
+	// UserAgent is sent with every request if set
+	UserAgent string
+}
+
+// RetryPolicy controls how idempotent calls (GET, PUT and DELETE) are
+// retried after network errors and 502, 503 and 504 responses. Backoff
+// doubles from MinBackoff up to MaxBackoff, with jitter.
+type RetryPolicy struct {
+	MaxAttempts int
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+}
+
+// backoff returns how long to wait before the given retry, counting from 1
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	d := p.MinBackoff
+	for i := 1; i < retry && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// Client calls the RedSkull v2 API. It is safe for concurrent use.
+type Client struct {
+	base      *url.URL
+	auth      Authenticator
+	http      *http.Client
+	timeout   time.Duration
+	retry     RetryPolicy
+	userAgent string
+}
+
+// NewClient returns a client for the RedSkull at cfg.URL
+func NewClient(cfg Config) (*Client, error) {
+	base, err := url.Parse(strings.TrimRight(cfg.URL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid RedSkull URL: %s", err)
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, errors.New("RedSkull URL must be http or https")
+	}
+	c := &Client{base: base, auth: cfg.Auth, http: cfg.HTTPClient, timeout: cfg.Timeout, retry: cfg.Retry, userAgent: cfg.UserAgent}
+	if c.http == nil {
+		c.http = http.DefaultClient
+	}
+	if c.timeout == 0 {
+		c.timeout = DefaultTimeout
+	}
+	if c.retry.MaxAttempts == 0 {
+		c.retry = DefaultRetryPolicy
+	}
+	return c, nil
+}
+
+// Error is returned when the API answers a call with an error
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+	Details    map[string]string
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("RedSkull returned %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("RedSkull returned %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// ErrorCode returns the API error code of err, or "" if err is not an *Error
+func ErrorCode(err error) string {
+	if e, ok := err.(*Error); ok {
+		return e.Code
+	}
+	return ""
+}
+
+// IsNotFound returns true if err is an API error for a missing pod, node,
+// sentinel, job or other resource
+func IsNotFound(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+// envelope is the body of every v2 response
+type envelope struct {
+	Data  json.RawMessage
+	Meta  *common.ListMeta
+	Error *Error
+}
+
+// do makes the call, retrying as the policy allows, and decodes the
+// response's Data into out and Meta into meta when they are not nil
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}, meta *common.ListMeta) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+	attempts := 1
+	if method != "POST" {
+		attempts = c.retry.MaxAttempts
+	}
+	var err error
+	for attempt := 1; ; attempt++ {
+		var retry bool
+		retry, err = c.attempt(ctx, method, path, query, payload, out, meta)
+		if !retry || attempt >= attempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.retry.backoff(attempt)):
+		}
+	}
+}
+
+// attempt makes one try at a call. retry is true if the call failed in a
+// way worth retrying.
+func (c *Client) attempt(ctx context.Context, method, path string, query url.Values, payload []byte, out interface{}, meta *common.ListMeta) (retry bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := c.newRequest(ctx, method, path, query, body)
+	if err != nil {
+		return false, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		// the caller's context ending is not worth retrying
+		return ctx.Err() == nil || ctx.Err() == context.DeadlineExceeded, err
+	}
+	defer resp.Body.Close()
+	raw, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return true, err
+	}
+	var env envelope
+	if err := json.Unmarshal(raw, &env); err != nil || (resp.StatusCode >= 400 && env.Error == nil) {
+		apiErr := &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(raw))}
+		if resp.StatusCode < 400 {
+			apiErr.Message = fmt.Sprintf("Unable to decode response: %v", err)
+		}
+		return retryable(resp.StatusCode), apiErr
+	}
+	if env.Error != nil {
+		env.Error.StatusCode = resp.StatusCode
+		return retryable(resp.StatusCode), env.Error
+	}
+	if meta != nil && env.Meta != nil {
+		*meta = *env.Meta
+	}
+	if out != nil && len(env.Data) > 0 {
+		if err := json.Unmarshal(env.Data, out); err != nil {
+			return false, fmt.Errorf("Unable to decode response data: %s", err)
+		}
+	}
+	return false, nil
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, query url.Values, body io.Reader) (*http.Request, error) {
+	// path's segments are already escaped; keep them in RawPath so
+	// url.URL doesn't escape them a second time
+	u := *c.base
+	u.RawPath = c.base.EscapedPath() + APIPrefix + path
+	unescaped, err := url.PathUnescape(u.RawPath)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = unescaped
+	if len(query) > 0 {
+		u.RawQuery = query.Encode()
+	}
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+	if c.auth != nil {
+		if err := c.auth.Authenticate(req); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+func retryable(status int) bool {
+	switch status {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// escape escapes a name for use as a path segment
+func escape(name string) string {
+	return url.PathEscape(name)
+}
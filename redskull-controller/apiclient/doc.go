@@ -0,0 +1,17 @@
+// Package apiclient is a client for RedSkull's versioned HTTP API, served
+// under /api/v2. Unlike the rpcclient package it does not need Go's net/rpc,
+// every call takes a context, idempotent calls are retried on transient
+// failures, and how requests are authenticated is pluggable.
+//
+//	c, err := apiclient.NewClient(apiclient.Config{
+//		URL:  "http://redskull.example.com:8000",
+//		Auth: apiclient.TokenAuth{Token: os.Getenv("REDSKULL_TOKEN")},
+//	})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	pods, _, err := c.ListPods(ctx, apiclient.PodListOptions{Status: "error"})
+//
+// Failed calls return an *Error carrying the HTTP status and the API's
+// machine readable error code.
+package apiclient
@@ -0,0 +1,159 @@
+package apiclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/therealbill/redskull/redskull-controller/common"
+)
+
+// DefaultPollInterval is how often WaitJob checks a job when no interval is
+// given
+const DefaultPollInterval = time.Second
+
+// JobListOptions filters ListJobs. Pod is a glob pattern.
+type JobListOptions struct {
+	ListOptions
+	Type  string
+	State string
+	Pod   string
+}
+
+// ListJobs returns a page of jobs, newest first
+func (c *Client) ListJobs(ctx context.Context, opts JobListOptions) ([]common.Job, common.ListMeta, error) {
+	q := opts.values()
+	setIf(q, "type", opts.Type)
+	setIf(q, "state", opts.State)
+	setIf(q, "pod", opts.Pod)
+	var jobs []common.Job
+	var meta common.ListMeta
+	err := c.do(ctx, "GET", "/jobs", q, nil, &jobs, &meta)
+	return jobs, meta, err
+}
+
+// GetJob returns the job with the given ID
+func (c *Client) GetJob(ctx context.Context, id string) (common.Job, error) {
+	var job common.Job
+	err := c.do(ctx, "GET", "/jobs/"+escape(id), nil, nil, &job, nil)
+	return job, err
+}
+
+// WaitJob polls the job every interval until it has finished or ctx ends,
+// returning its last known state. A failed job is not an error; check the
+// job's State.
+func (c *Client) WaitJob(ctx context.Context, id string, interval time.Duration) (common.Job, error) {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		job, err := c.GetJob(ctx, id)
+		if err != nil || job.Done() {
+			return job, err
+		}
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// EventFilter selects events. Type and Pod are glob patterns; MinSeverity is
+// info, warning or critical.
+type EventFilter struct {
+	Type        string
+	Pod         string
+	MinSeverity string
+}
+
+// EventListOptions filters ListEvents
+type EventListOptions struct {
+	ListOptions
+	EventFilter
+	Since time.Time
+}
+
+// ListEvents returns a page of recent events, newest first
+func (c *Client) ListEvents(ctx context.Context, opts EventListOptions) ([]common.Event, common.ListMeta, error) {
+	q := opts.values()
+	setIf(q, "type", opts.Type)
+	setIf(q, "pod", opts.Pod)
+	setIf(q, "severity", opts.MinSeverity)
+	if !opts.Since.IsZero() {
+		q.Set("since", opts.Since.Format(time.RFC3339))
+	}
+	var events []common.Event
+	var meta common.ListMeta
+	err := c.do(ctx, "GET", "/events", q, nil, &events, &meta)
+	return events, meta, err
+}
+
+// StreamEvents calls fn for each event matching the filter as RedSkull
+// publishes it. It blocks until ctx ends, fn returns an error, or the
+// connection is lost, and returns why. Events published while not connected
+// are not replayed; use ListEvents with Since to catch up.
+func (c *Client) StreamEvents(ctx context.Context, f EventFilter, fn func(common.Event) error) error {
+	q := url.Values{}
+	setIf(q, "type", f.Type)
+	setIf(q, "pod", f.Pod)
+	setIf(q, "severity", f.MinSeverity)
+	req, err := c.newRequest(ctx, "GET", "/events/stream", q, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		raw, _ := ioutil.ReadAll(resp.Body)
+		var env envelope
+		if json.Unmarshal(raw, &env) == nil && env.Error != nil {
+			env.Error.StatusCode = resp.StatusCode
+			return env.Error
+		}
+		return &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(raw))}
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if len(data) == 0 {
+				continue
+			}
+			var e common.Event
+			err := json.Unmarshal([]byte(strings.Join(data, "\n")), &e)
+			data = data[:0]
+			if err != nil {
+				return fmt.Errorf("Unable to decode event: %s", err)
+			}
+			if err := fn(e); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("Event stream closed by server")
+}
@@ -0,0 +1,70 @@
+package apiclient
+
+import (
+	"context"
+
+	"github.com/therealbill/redskull/redskull-controller/common"
+)
+
+// NodeListOptions filters ListNodes. Pod is a glob pattern; Role is master
+// or slave.
+type NodeListOptions struct {
+	ListOptions
+	Pod  string
+	Role string
+}
+
+// ListNodes returns a page of the nodes RedSkull knows about
+func (c *Client) ListNodes(ctx context.Context, opts NodeListOptions) ([]common.NodeSummary, common.ListMeta, error) {
+	q := opts.values()
+	setIf(q, "pod", opts.Pod)
+	setIf(q, "role", opts.Role)
+	var nodes []common.NodeSummary
+	var meta common.ListMeta
+	err := c.do(ctx, "GET", "/nodes", q, nil, &nodes, &meta)
+	return nodes, meta, err
+}
+
+// GetNode returns the named node, in host:port form, in full
+func (c *Client) GetNode(ctx context.Context, name string) (common.RedisNode, error) {
+	var node common.RedisNode
+	err := c.do(ctx, "GET", "/nodes/"+escape(name), nil, nil, &node, nil)
+	return node, err
+}
+
+// CloneNode clones one node to another as described by req. The returned
+// job can be followed with GetJob or WaitJob.
+func (c *Client) CloneNode(ctx context.Context, req common.CloneRequest) (common.Job, error) {
+	var job common.Job
+	err := c.do(ctx, "POST", "/nodes/clone", nil, req, &job, nil)
+	return job, err
+}
+
+// SentinelListOptions filters ListSentinels. Name is a glob pattern.
+type SentinelListOptions struct {
+	ListOptions
+	Name string
+}
+
+// ListSentinels returns a page of the sentinels in the constellation
+func (c *Client) ListSentinels(ctx context.Context, opts SentinelListOptions) ([]common.SentinelSummary, common.ListMeta, error) {
+	q := opts.values()
+	setIf(q, "name", opts.Name)
+	var sentinels []common.SentinelSummary
+	var meta common.ListMeta
+	err := c.do(ctx, "GET", "/sentinels", q, nil, &sentinels, &meta)
+	return sentinels, meta, err
+}
+
+// GetSentinel returns the named sentinel
+func (c *Client) GetSentinel(ctx context.Context, name string) (common.SentinelSummary, error) {
+	var sentinel common.SentinelSummary
+	err := c.do(ctx, "GET", "/sentinels/"+escape(name), nil, nil, &sentinel, nil)
+	return sentinel, err
+}
+
+// AddSentinel adds the sentinel at address, in host:port form, to the
+// constellation
+func (c *Client) AddSentinel(ctx context.Context, address string) error {
+	return c.do(ctx, "POST", "/sentinels", nil, common.AddSentinelRequest{Address: address}, nil, nil)
+}
@@ -0,0 +1,156 @@
+package apiclient
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+
+	"github.com/therealbill/libredis/structures"
+	"github.com/therealbill/redskull/redskull-controller/common"
+)
+
+// ListOptions selects a page of a list. Zero values use the server's
+// defaults.
+type ListOptions struct {
+	Limit  int
+	Offset int
+}
+
+func (o ListOptions) values() url.Values {
+	v := url.Values{}
+	if o.Limit > 0 {
+		v.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Offset > 0 {
+		v.Set("offset", strconv.Itoa(o.Offset))
+	}
+	return v
+}
+
+// setIf sets the query parameter only if value is not empty
+func setIf(v url.Values, name, value string) {
+	if value != "" {
+		v.Set(name, value)
+	}
+}
+
+// PodListOptions filters ListPods. Name is a glob pattern; Status is one of
+// ok, error or maintenance.
+type PodListOptions struct {
+	ListOptions
+	Name   string
+	Status string
+}
+
+// ListPods returns a page of pod summaries
+func (c *Client) ListPods(ctx context.Context, opts PodListOptions) ([]common.PodSummary, common.ListMeta, error) {
+	q := opts.values()
+	setIf(q, "name", opts.Name)
+	setIf(q, "status", opts.Status)
+	var pods []common.PodSummary
+	var meta common.ListMeta
+	err := c.do(ctx, "GET", "/pods", q, nil, &pods, &meta)
+	return pods, meta, err
+}
+
+// GetPod returns the named pod
+func (c *Client) GetPod(ctx context.Context, podname string) (common.RedisPod, error) {
+	var pod common.RedisPod
+	err := c.do(ctx, "GET", "/pods/"+escape(podname), nil, nil, &pod, nil)
+	return pod, err
+}
+
+// MonitorPod has every sentinel in the constellation monitor the pod
+// described by req
+func (c *Client) MonitorPod(ctx context.Context, req common.MonitorRequest) (common.RedisPod, error) {
+	var pod common.RedisPod
+	err := c.do(ctx, "PUT", "/pods/"+escape(req.Podname), nil, req, &pod, nil)
+	return pod, err
+}
+
+// RemovePod stops the constellation monitoring the pod
+func (c *Client) RemovePod(ctx context.Context, podname string) error {
+	return c.do(ctx, "DELETE", "/pods/"+escape(podname), nil, nil, nil, nil)
+}
+
+// Failover fails the pod over to one of its slaves. Force proceeds even if
+// the pod is in maintenance.
+func (c *Client) Failover(ctx context.Context, podname string, force bool) error {
+	return c.do(ctx, "POST", "/pods/"+escape(podname)+"/failover", nil, common.FailoverOptions{Force: force}, nil, nil)
+}
+
+// ResetPod resets the pod on its sentinels. The returned job can be
+// followed with GetJob or WaitJob.
+func (c *Client) ResetPod(ctx context.Context, podname string, simultaneous bool) (common.Job, error) {
+	var job common.Job
+	err := c.do(ctx, "POST", "/pods/"+escape(podname)+"/reset", nil, common.ResetOptions{Simultaneous: simultaneous}, &job, nil)
+	return job, err
+}
+
+// BalancePod brings the pod to the number of sentinels it needs. The
+// returned job can be followed with GetJob or WaitJob.
+func (c *Client) BalancePod(ctx context.Context, podname string, force bool) (common.Job, error) {
+	var job common.Job
+	err := c.do(ctx, "POST", "/pods/"+escape(podname)+"/balance", nil, common.BalanceOptions{Force: force}, &job, nil)
+	return job, err
+}
+
+// GetMaster returns the pod's current master as its sentinels report it
+func (c *Client) GetMaster(ctx context.Context, podname string) (structures.MasterAddress, error) {
+	var master structures.MasterAddress
+	err := c.do(ctx, "GET", "/pods/"+escape(podname)+"/master", nil, nil, &master, nil)
+	return master, err
+}
+
+// ListSlaves returns a page of the pod's slaves as its sentinels report them
+func (c *Client) ListSlaves(ctx context.Context, podname string, opts ListOptions) ([]structures.SlaveInfo, common.ListMeta, error) {
+	var slaves []structures.SlaveInfo
+	var meta common.ListMeta
+	err := c.do(ctx, "GET", "/pods/"+escape(podname)+"/slaves", opts.values(), nil, &slaves, &meta)
+	return slaves, meta, err
+}
+
+// AddSlave makes the Redis instance in req a slave of the pod's master
+func (c *Client) AddSlave(ctx context.Context, req common.AddSlaveRequest) error {
+	return c.do(ctx, "POST", "/pods/"+escape(req.Podname)+"/slaves", nil, req, nil, nil)
+}
+
+// RemoveSlave detaches the slave at address, in host:port form, from the pod
+func (c *Client) RemoveSlave(ctx context.Context, podname, address string) error {
+	return c.do(ctx, "DELETE", "/pods/"+escape(podname)+"/slaves/"+escape(address), nil, nil, nil, nil)
+}
+
+// ListPodSentinels returns a page of the sentinels monitoring the pod
+func (c *Client) ListPodSentinels(ctx context.Context, podname string, opts ListOptions) ([]common.SentinelSummary, common.ListMeta, error) {
+	var sentinels []common.SentinelSummary
+	var meta common.ListMeta
+	err := c.do(ctx, "GET", "/pods/"+escape(podname)+"/sentinels", opts.values(), nil, &sentinels, &meta)
+	return sentinels, meta, err
+}
+
+// GetPodTopology checks the pod's replication topology
+func (c *Client) GetPodTopology(ctx context.Context, podname string) (common.TopologyReport, error) {
+	var report common.TopologyReport
+	err := c.do(ctx, "GET", "/pods/"+escape(podname)+"/topology", nil, nil, &report, nil)
+	return report, err
+}
+
+// GetPodMaintenance returns the pod's maintenance window. A pod not in
+// maintenance returns an error for which IsNotFound is true.
+func (c *Client) GetPodMaintenance(ctx context.Context, podname string) (common.PodMaintenance, error) {
+	var m common.PodMaintenance
+	err := c.do(ctx, "GET", "/pods/"+escape(podname)+"/maintenance", nil, nil, &m, nil)
+	return m, err
+}
+
+// SetPodMaintenance places the pod named in req into maintenance
+func (c *Client) SetPodMaintenance(ctx context.Context, req common.MaintenanceRequest) (common.PodMaintenance, error) {
+	var m common.PodMaintenance
+	err := c.do(ctx, "PUT", "/pods/"+escape(req.Podname)+"/maintenance", nil, req, &m, nil)
+	return m, err
+}
+
+// ClearPodMaintenance takes the pod out of maintenance
+func (c *Client) ClearPodMaintenance(ctx context.Context, podname string) error {
+	return c.do(ctx, "DELETE", "/pods/"+escape(podname)+"/maintenance", nil, nil, nil, nil)
+}
@@ -0,0 +1,251 @@
+package common
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Alert metrics. Pod metrics have the pod as their target, node metrics a
+// node's address and sentinel metrics a sentinel's. Metrics which are
+// conditions are 1 while the condition holds and 0 otherwise.
+const (
+	// MetricPromotableSlaves is how many of the pod's slaves are reachable,
+	// linked to the master and have a non-zero slave-priority
+	MetricPromotableSlaves = "promotable-slaves"
+	// MetricPodErrors is 1 while the pod has errors, as the dashboard counts
+	MetricPodErrors = "pod-errors"
+	// MetricPodUnavailable is 1 while the failover history has the pod
+	// without a writable master
+	MetricPodUnavailable = "pod-unavailable"
+	// MetricNodeMemory is a master or slave's PercentUsed
+	MetricNodeMemory = "node-memory-percent"
+	// MetricReplicaLag is how many seconds since a slave last heard from
+	// its master, as the master reports it
+	MetricReplicaLag = "replica-lag"
+	// MetricSentinelUnreachable is 1 while a known sentinel does not answer
+	// a PING
+	MetricSentinelUnreachable = "sentinel-unreachable"
+)
+
+// AlertMetrics lists every metric a rule may use
+var AlertMetrics = []string{
+	MetricPromotableSlaves,
+	MetricPodErrors,
+	MetricPodUnavailable,
+	MetricNodeMemory,
+	MetricReplicaLag,
+	MetricSentinelUnreachable,
+}
+
+// Alert states. An alert is pending while its rule's condition holds for
+// less than the rule's For duration, and firing after. A resolved alert is
+// only seen by notifiers.
+const (
+	AlertPending  = "pending"
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// AlertRule raises an alert for each target whose metric compares to Value
+// as Op says, once it has done so for the For duration. Pods and Targets
+// are lists of glob patterns matched against the pod name and the target,
+// an empty list matches everything. Notify names the notifiers told of the
+// alert; empty means the default ones. Summary, if given, leads the alert's
+// message.
+type AlertRule struct {
+	Name     string   `json:"name" yaml:"name"`
+	Metric   string   `json:"metric" yaml:"metric"`
+	Op       string   `json:"op" yaml:"op"`
+	Value    float64  `json:"value" yaml:"value"`
+	For      string   `json:"for,omitempty" yaml:"for,omitempty"`
+	Severity string   `json:"severity,omitempty" yaml:"severity,omitempty"`
+	Pods     []string `json:"pods,omitempty" yaml:"pods,omitempty"`
+	Targets  []string `json:"targets,omitempty" yaml:"targets,omitempty"`
+	Notify   []string `json:"notify,omitempty" yaml:"notify,omitempty"`
+	Summary  string   `json:"summary,omitempty" yaml:"summary,omitempty"`
+}
+
+// Validate checks the rule's metric, comparison, severity, duration and
+// patterns
+func (r AlertRule) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("Alert rule has no name")
+	}
+	known := false
+	for _, m := range AlertMetrics {
+		known = known || m == r.Metric
+	}
+	if !known {
+		return fmt.Errorf("Unknown metric '%s'", r.Metric)
+	}
+	switch r.Op {
+	case ">", ">=", "<", "<=", "==", "!=":
+	default:
+		return fmt.Errorf("Invalid op '%s', expected one of > >= < <= == !=", r.Op)
+	}
+	if r.Severity != "" && SeverityRank(r.Severity) == 0 {
+		return fmt.Errorf("Invalid severity '%s', expected info, warning or critical", r.Severity)
+	}
+	if _, err := r.ForDuration(); err != nil {
+		return err
+	}
+	if len(r.Pods) > 0 && r.Metric == MetricSentinelUnreachable {
+		return fmt.Errorf("Metric %s has no pod to match pods against", r.Metric)
+	}
+	for _, pattern := range append(append([]string(nil), r.Pods...), r.Targets...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("Invalid pattern '%s': %s", pattern, err)
+		}
+	}
+	return nil
+}
+
+// ForDuration returns how long the condition must hold before the alert
+// fires
+func (r AlertRule) ForDuration() (time.Duration, error) {
+	if r.For == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(r.For)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("Invalid for duration '%s'", r.For)
+	}
+	return d, nil
+}
+
+// Matches returns true if the rule covers the target of the given pod
+func (r AlertRule) Matches(podname, target string) bool {
+	return matchAny(r.Pods, podname) && matchAny(r.Targets, target)
+}
+
+// Holds returns true if value meets the rule's condition
+func (r AlertRule) Holds(value float64) bool {
+	switch r.Op {
+	case ">":
+		return value > r.Value
+	case ">=":
+		return value >= r.Value
+	case "<":
+		return value < r.Value
+	case "<=":
+		return value <= r.Value
+	case "==":
+		return value == r.Value
+	case "!=":
+		return value != r.Value
+	}
+	return false
+}
+
+// Condition renders the rule's comparison, such as "replica-lag > 10"
+func (r AlertRule) Condition() string {
+	return fmt.Sprintf("%s %s %s", r.Metric, r.Op, FormatMetric(r.Value))
+}
+
+// Alert is a rule's condition holding for one target. Since is when the
+// condition started to hold and FiredAt when the alert started firing.
+// Notified is true once notifiers have been told it is firing, and
+// Silenced while a silence matches it.
+type Alert struct {
+	Rule       string
+	Metric     string
+	Severity   string
+	Target     string
+	Pod        string
+	Value      float64
+	State      string
+	Since      time.Time
+	FiredAt    time.Time
+	ResolvedAt time.Time
+	Notified   bool
+	Silenced   bool
+	Message    string
+}
+
+// Silence keeps alerts matching it from being notified until Expires. Rule,
+// Pod and Target are glob patterns; empty matches everything.
+type Silence struct {
+	ID      string
+	Rule    string
+	Pod     string
+	Target  string
+	Comment string
+	Owner   string
+	Created time.Time
+	Expires time.Time
+}
+
+// Active returns true if the silence has not expired at now
+func (s Silence) Active(now time.Time) bool {
+	return now.Before(s.Expires)
+}
+
+// Matches returns true if the silence covers the alert
+func (s Silence) Matches(a Alert) bool {
+	return globMatch(s.Rule, a.Rule) && globMatch(s.Pod, a.Pod) && globMatch(s.Target, a.Target)
+}
+
+// SilenceRequest creates a silence through the API. Duration is parsed with
+// time.ParseDuration. At least one of Rule, Pod and Target must be given.
+type SilenceRequest struct {
+	Rule     string
+	Pod      string
+	Target   string
+	Comment  string
+	Duration string
+}
+
+// Silence validates the request and returns the silence it describes,
+// created at now
+func (r SilenceRequest) Silence(owner string, now time.Time) (Silence, error) {
+	if r.Rule == "" && r.Pod == "" && r.Target == "" {
+		return Silence{}, fmt.Errorf("A silence needs a rule, pod or target")
+	}
+	for _, pattern := range []string{r.Rule, r.Pod, r.Target} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return Silence{}, fmt.Errorf("Invalid pattern '%s': %s", pattern, err)
+		}
+	}
+	d, err := time.ParseDuration(r.Duration)
+	if err != nil || d <= 0 {
+		return Silence{}, fmt.Errorf("Invalid silence duration '%s', expected a positive duration such as 2h", r.Duration)
+	}
+	return Silence{
+		Rule:    r.Rule,
+		Pod:     r.Pod,
+		Target:  r.Target,
+		Comment: r.Comment,
+		Owner:   owner,
+		Created: now,
+		Expires: now.Add(d),
+	}, nil
+}
+
+// FormatMetric renders a metric value with at most two decimals
+func FormatMetric(value float64) string {
+	s := strconv.FormatFloat(value, 'f', 2, 64)
+	return strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+}
+
+func matchAny(patterns []string, name string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func globMatch(pattern, name string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
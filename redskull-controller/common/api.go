@@ -0,0 +1,119 @@
+package common
+
+// Types used on the wire by the v2 HTTP API and the RPC service, shared by
+// the servers and the apiclient and rpcclient packages.
+
+// Machine readable error codes returned by the HTTP and RPC APIs
+const (
+	ErrCodeInvalidRequest     = "invalid_request"
+	ErrCodeInvalidJSON        = "invalid_json"
+	ErrCodeNotFound           = "not_found"
+	ErrCodePodNotFound        = "pod_not_found"
+	ErrCodeNodeNotFound       = "node_not_found"
+	ErrCodeSentinelNotFound   = "sentinel_not_found"
+	ErrCodeJobNotFound        = "job_not_found"
+	ErrCodeDrillNotFound      = "drill_not_found"
+	ErrCodeSilenceNotFound    = "silence_not_found"
+	ErrCodeInMaintenance      = "pod_in_maintenance"
+	ErrCodeFailoverInProgress = "failover_in_progress"
+	ErrCodeNoGoodSlave        = "no_good_slave"
+	ErrCodeAlreadySlave       = "already_slave"
+	ErrCodeNodeUnreachable    = "node_unreachable"
+	ErrCodeQuorum             = "quorum_not_reached"
+	ErrCodeSentinel           = "sentinel_error"
+	ErrCodeInternal           = "internal_error"
+	ErrCodeNotSlave           = "not_slave"
+	ErrCodeRebalanceChanged   = "rebalance_plan_changed"
+	ErrCodeIncompatible       = "incompatible_version"
+	ErrCodeUnauthorized       = "unauthorized"
+	ErrCodeForbidden          = "forbidden"
+)
+
+// PodSummary is the list representation of a pod
+type PodSummary struct {
+	Name            string
+	MasterAddress   string
+	MasterPort      int
+	Quorum          int
+	Slaves          int
+	SentinelCount   int
+	NeededSentinels int
+	HasErrors       bool
+	CanFailover     bool
+	InMaintenance   bool
+}
+
+// Pod statuses as reported by PodSummary.Status
+const (
+	PodStatusOK          = "ok"
+	PodStatusError       = "error"
+	PodStatusMaintenance = "maintenance"
+)
+
+// Status returns the pod's status. Errors are not reported for pods in
+// maintenance.
+func (p PodSummary) Status() string {
+	switch {
+	case p.InMaintenance:
+		return PodStatusMaintenance
+	case p.HasErrors:
+		return PodStatusError
+	}
+	return PodStatusOK
+}
+
+// NodeSummary is the list representation of a Redis node
+type NodeSummary struct {
+	Name              string
+	Address           string
+	Port              int
+	Pod               string
+	Role              string
+	Connected         bool
+	MaxMemory         int
+	PercentUsed       float64
+	MemoryUseWarn     bool
+	MemoryUseCritical bool
+}
+
+// SentinelSummary is the representation of a sentinel
+type SentinelSummary struct {
+	Name   string
+	Host   string
+	Port   int
+	Local  bool
+	Errors int
+	Pods   []string
+}
+
+// ListMeta describes the page of results a list endpoint returned
+type ListMeta struct {
+	Total  int
+	Limit  int
+	Offset int
+}
+
+// APIResult is returned by actions which have no other data to return
+type APIResult struct {
+	Message string
+}
+
+// FailoverOptions is the body of a failover call
+type FailoverOptions struct {
+	Force bool
+}
+
+// ResetOptions is the body of a pod reset call
+type ResetOptions struct {
+	Simultaneous bool
+}
+
+// BalanceOptions is the body of a pod balance call
+type BalanceOptions struct {
+	Force bool
+}
+
+// AddSentinelRequest is the body of an add sentinel call
+type AddSentinelRequest struct {
+	Address string
+}
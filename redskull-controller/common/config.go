@@ -0,0 +1,10 @@
+package common
+
+import "gopkg.in/yaml.v2"
+
+// ParseConfig parses a YAML or JSON configuration file's contents into v.
+// JSON is valid YAML, so one parser covers both formats; fields are matched
+// using their yaml tags.
+func ParseConfig(data []byte, v interface{}) error {
+	return yaml.Unmarshal(data, v)
+}
@@ -0,0 +1,42 @@
+package common
+
+import "time"
+
+// SentinelView is one sentinel's view of a pod. Divergent lists the fields
+// in which it disagrees with the majority of the pod's sentinels.
+type SentinelView struct {
+	Sentinel          string
+	Reachable         bool
+	Error             string
+	Master            string
+	ConfigEpoch       int
+	Flags             string
+	SDown             bool
+	ODown             bool
+	NumOtherSentinels int
+	NumSlaves         int
+	Quorum            int
+	CKQuorumOK        bool
+	CKQuorum          string
+	Tilt              bool
+	Divergent         []string
+}
+
+// SentinelConsistencyReport collects every sentinel's view of a pod and
+// compares them. Majority holds the most common value of each compared
+// field. Checks records, per sentinel, whether it returned a master at all.
+type SentinelConsistencyReport struct {
+	Pod        string
+	Checked    time.Time
+	Consistent bool
+	Majority   SentinelView
+	Views      []SentinelView
+	Checks     map[string]bool
+	Problems   []string
+}
+
+// IsFlagged returns true if the view diverges from the majority or shows a
+// problem of its own
+func (v SentinelView) IsFlagged() bool {
+	return !v.Reachable || v.Tilt || !v.CKQuorumOK || v.SDown || v.ODown || len(v.Divergent) > 0
+}
@@ -0,0 +1,101 @@
+package common
+
+import (
+	"context"
+	"time"
+
+	"github.com/therealbill/libredis/client"
+)
+
+// CallTimeout bounds calls which have no deadline of their own, such as RPC
+// calls and background crawls. Zero leaves them unbounded.
+var CallTimeout = 30 * time.Second
+
+// minDialTimeout keeps a nearly expired deadline from being passed to
+// libredis as zero, which it takes to mean no timeout at all
+const minDialTimeout = time.Millisecond
+
+// WithCallTimeout returns a context bounded by CallTimeout
+func WithCallTimeout(parent context.Context) (context.Context, context.CancelFunc) {
+	if CallTimeout <= 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, CallTimeout)
+}
+
+// TimeoutFor returns DialTimeout, or the time left before the context's
+// deadline if that is sooner
+func TimeoutFor(ctx context.Context) time.Duration {
+	timeout := DialTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		left := time.Until(deadline)
+		if timeout <= 0 || left < timeout {
+			timeout = left
+		}
+	}
+	if timeout > 0 && timeout < minDialTimeout {
+		timeout = minDialTimeout
+	}
+	return timeout
+}
+
+// Dial connects to a Redis instance or sentinel, with the connect timeout cut
+// short by the context's deadline. If the context ends first its error is
+// returned and the connection, should it still succeed, is closed.
+func Dial(ctx context.Context, config client.DialConfig) (*client.Redis, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if config.Network == "" {
+		config.Network = "tcp"
+	}
+	config.Timeout = TimeoutFor(ctx)
+	type dialed struct {
+		conn *client.Redis
+		err  error
+	}
+	done := make(chan dialed, 1)
+	go func() {
+		conn, err := client.DialWithConfig(&config)
+		done <- dialed{conn, err}
+	}()
+	select {
+	case d := <-done:
+		return d.conn, d.err
+	case <-ctx.Done():
+		go func() {
+			if d := <-done; d.err == nil {
+				d.conn.ClosePool()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// Do runs call, returning the context's error instead if the context ends
+// first. libredis does not take contexts, so an abandoned call finishes in
+// the background; callers must not read anything call writes unless Do
+// returns its result.
+func Do(ctx context.Context, call func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- call()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Sleep pauses for d or until the context ends, whichever is first
+func Sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-time.After(d):
+	case <-ctx.Done():
+	}
+}
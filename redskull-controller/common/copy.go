@@ -0,0 +1,43 @@
+package common
+
+import "github.com/therealbill/libredis/structures"
+
+// NodeCopier deep copies nodes and pods so the copies can be updated, or
+// read while the originals are updated, without either seeing the other's
+// changes. It remembers the nodes it has copied, so a node reached more than
+// once (as a pod's master and through the constellation's node map, say) is
+// copied once and the copies keep the originals' sharing. The zero value is
+// not usable; use make(NodeCopier).
+//
+// Node INFO, latency and slowlog data are shared rather than copied, as
+// they are only ever replaced, never changed in place.
+type NodeCopier map[*RedisNode]*RedisNode
+
+// Node returns the copy of n
+func (nc NodeCopier) Node(n *RedisNode) *RedisNode {
+	if n == nil {
+		return nil
+	}
+	if c, ok := nc[n]; ok {
+		return c
+	}
+	c := new(RedisNode)
+	*c = *n
+	nc[n] = c
+	if n.Slaves != nil {
+		c.Slaves = make([]*RedisNode, len(n.Slaves))
+		for i, slave := range n.Slaves {
+			c.Slaves[i] = nc.Node(slave)
+		}
+	}
+	return c
+}
+
+// Pod returns a copy of p with a copy of its master
+func (nc NodeCopier) Pod(p RedisPod) RedisPod {
+	p.Master = nc.Node(p.Master)
+	if p.Slaves != nil {
+		p.Slaves = append([]structures.InfoSlaves(nil), p.Slaves...)
+	}
+	return p
+}
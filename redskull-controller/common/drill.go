@@ -0,0 +1,168 @@
+package common
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// DrillStep is one failover made during a drill. SwitchMaster is how long
+// after the failover was requested the first of the pod's sentinels switched
+// to the new master, which is when a sentinel emits +switch-master.
+// ClientsSwitched is how long until the constellation's GetMaster, which is
+// what clients are given, returned the new master, and SentinelsAgreed how
+// long until every reachable sentinel of the pod did.
+type DrillStep struct {
+	From            string
+	To              string
+	SwitchMaster    time.Duration
+	ClientsSwitched time.Duration
+	SentinelsAgreed time.Duration
+	Error           string
+}
+
+// DrillReport is the outcome of a failover drill on a pod. Errors lists the
+// HasErrors conditions seen on the pod before, during or after the drill.
+type DrillReport struct {
+	ID       string
+	Pod      string
+	Trigger  string
+	Started  time.Time
+	Finished time.Time
+	Passed   bool
+	Failure  string
+	Failover DrillStep
+	Failback *DrillStep
+	Errors   []string
+}
+
+// DrillRequest starts a drill through the API. Timeout bounds each failover
+// of the drill and is parsed with time.ParseDuration; empty means
+// DefaultDrillTimeout.
+type DrillRequest struct {
+	Failback bool
+	Timeout  string
+}
+
+// DefaultDrillTimeout is how long each failover of a drill may take when no
+// timeout is given
+const DefaultDrillTimeout = 2 * time.Minute
+
+// DrillSchedule says when pods are drilled. Pods is a list of glob patterns
+// matched against the pod name, an empty list matches every pod. Window is
+// the local time of day drills may start in, such as "02:00-04:00"; it may
+// wrap past midnight and empty means any time. Every is how long to leave
+// between drills of a pod, such as "168h".
+type DrillSchedule struct {
+	Pods     []string `json:"pods,omitempty" yaml:"pods,omitempty"`
+	Window   string   `json:"window,omitempty" yaml:"window,omitempty"`
+	Every    string   `json:"every" yaml:"every"`
+	Failback bool     `json:"failback,omitempty" yaml:"failback,omitempty"`
+	Timeout  string   `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+// Validate checks the schedule's window and durations parse
+func (s DrillSchedule) Validate() error {
+	if _, _, err := s.window(); err != nil {
+		return err
+	}
+	if _, err := s.Interval(); err != nil {
+		return err
+	}
+	if _, err := s.StepTimeout(); err != nil {
+		return err
+	}
+	for _, pattern := range s.Pods {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("Invalid pod pattern '%s': %s", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Matches returns true if the schedule covers the pod
+func (s DrillSchedule) Matches(podname string) bool {
+	if len(s.Pods) == 0 {
+		return true
+	}
+	for _, pattern := range s.Pods {
+		if ok, _ := path.Match(pattern, podname); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Interval returns how long to leave between drills of a pod
+func (s DrillSchedule) Interval() (time.Duration, error) {
+	d, err := time.ParseDuration(s.Every)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid drill interval '%s': %s", s.Every, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("Drill interval must be positive")
+	}
+	return d, nil
+}
+
+// StepTimeout returns how long each failover of a drill may take
+func (s DrillSchedule) StepTimeout() (time.Duration, error) {
+	return DrillRequest{Timeout: s.Timeout}.StepTimeout()
+}
+
+// InWindow returns true if t falls within the schedule's window
+func (s DrillSchedule) InWindow(t time.Time) bool {
+	start, end, err := s.window()
+	if err != nil {
+		return false
+	}
+	if start == end {
+		return true
+	}
+	now := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	if start < end {
+		return now >= start && now < end
+	}
+	return now >= start || now < end
+}
+
+// window returns the start and end of the window as offsets from midnight.
+// An empty window starts and ends at midnight.
+func (s DrillSchedule) window() (start, end time.Duration, err error) {
+	if s.Window == "" {
+		return 0, 0, nil
+	}
+	parts := strings.Split(s.Window, "-")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("Invalid drill window '%s', expected HH:MM-HH:MM", s.Window)
+	}
+	for i, part := range parts {
+		t, err := time.Parse("15:04", strings.TrimSpace(part))
+		if err != nil {
+			return 0, 0, fmt.Errorf("Invalid drill window '%s', expected HH:MM-HH:MM", s.Window)
+		}
+		offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+		if i == 0 {
+			start = offset
+		} else {
+			end = offset
+		}
+	}
+	return start, end, nil
+}
+
+// StepTimeout returns the request's timeout, or DefaultDrillTimeout
+func (r DrillRequest) StepTimeout() (time.Duration, error) {
+	if r.Timeout == "" {
+		return DefaultDrillTimeout, nil
+	}
+	d, err := time.ParseDuration(r.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid drill timeout '%s': %s", r.Timeout, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("Drill timeout must be positive")
+	}
+	return d, nil
+}
@@ -0,0 +1,45 @@
+package common
+
+import "time"
+
+// Event types
+const (
+	EventPodError       = "pod.error"
+	EventPodRecovered   = "pod.recovered"
+	EventMasterChanged  = "pod.master-changed"
+	EventJobFinished    = "job.finished"
+	EventDrillFinished  = "drill.finished"
+	EventPodUnavailable = "pod.unavailable"
+	EventPodAvailable   = "pod.available"
+	EventAlertFiring    = "alert.firing"
+	EventAlertResolved  = "alert.resolved"
+	EventTest           = "test"
+)
+
+// Event is something which happened to a pod or sentinel that RedSkull
+// notifies about. Data carries event specific details, such as the old and
+// new master on a master change.
+type Event struct {
+	ID       string
+	Type     string
+	Severity string
+	Pod      string
+	Sentinel string
+	Message  string
+	Time     time.Time
+	Data     map[string]string
+}
+
+// SeverityRank orders severities so they can be compared. Unknown
+// severities rank lowest.
+func SeverityRank(severity string) int {
+	switch severity {
+	case SeverityCritical:
+		return 3
+	case SeverityWarning:
+		return 2
+	case SeverityInfo:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,233 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// History entry kinds
+const (
+	HistoryMasterChange = "master-change"
+	HistoryDown         = "down"
+)
+
+// Reasons given for a master change
+const (
+	ChangeDrill      = "drill"
+	ChangeRequested  = "requested"
+	ChangeMasterDown = "master-down"
+	ChangeSentinel   = "sentinel"
+)
+
+// DefaultSLAWindows are the windows availability is reported over when none
+// are configured
+var DefaultSLAWindows = []time.Duration{24 * time.Hour, 7 * 24 * time.Hour, 30 * 24 * time.Hour}
+
+// HistoryEntry is one item of a pod's timeline: a change of master, or a
+// period during which the pod had no writable master. A master change
+// happens at Start; a down period lasts until End, which is zero while the
+// pod is still down.
+type HistoryEntry struct {
+	Pod    string
+	Kind   string
+	Start  time.Time
+	End    time.Time
+	From   string
+	To     string
+	Reason string
+}
+
+// Ongoing returns true for a down period which has not ended
+func (e HistoryEntry) Ongoing() bool {
+	return e.Kind == HistoryDown && e.End.IsZero()
+}
+
+// Duration returns how long a down period lasted, up to now if it is
+// ongoing. Master changes have no duration.
+func (e HistoryEntry) Duration(now time.Time) time.Duration {
+	if e.Kind != HistoryDown {
+		return 0
+	}
+	if e.Ongoing() {
+		return now.Sub(e.Start)
+	}
+	return e.End.Sub(e.Start)
+}
+
+// CSVHeader names the columns of CSVRecord
+func (e HistoryEntry) CSVHeader() []string {
+	return []string{"pod", "kind", "start", "end", "seconds", "from", "to", "reason"}
+}
+
+// CSVRecord renders the entry as a CSV row. Times are RFC 3339 and the
+// duration of a down period is in seconds.
+func (e HistoryEntry) CSVRecord() []string {
+	end, seconds := "", ""
+	if e.Kind == HistoryDown {
+		seconds = strconv.FormatFloat(e.Duration(time.Now()).Seconds(), 'f', 3, 64)
+		if !e.End.IsZero() {
+			end = e.End.Format(time.RFC3339)
+		}
+	}
+	return []string{e.Pod, e.Kind, e.Start.Format(time.RFC3339), end, seconds, e.From, e.To, e.Reason}
+}
+
+// PodHistory is what RedSkull has seen of a pod's masters since Tracked,
+// when it first polled the pod. Entries are oldest first.
+type PodHistory struct {
+	Pod     string
+	Tracked time.Time
+	Master  string
+	Entries []HistoryEntry
+}
+
+// Down returns the ongoing down period, if the pod is down
+func (h *PodHistory) Down() *HistoryEntry {
+	for i := len(h.Entries) - 1; i >= 0; i-- {
+		if h.Entries[i].Kind == HistoryDown {
+			if h.Entries[i].Ongoing() {
+				return &h.Entries[i]
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// Since returns the entries which started at or after t, or which were
+// still ongoing at t, newest first
+func (h PodHistory) Since(t time.Time) (entries []HistoryEntry) {
+	for i := len(h.Entries) - 1; i >= 0; i-- {
+		e := h.Entries[i]
+		if e.Start.Before(t) && !(e.Kind == HistoryDown && (e.Ongoing() || e.End.After(t))) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// SLA works out the pod's failovers and unavailable time over the window
+// ending at now. Only the part of the window since the pod was first
+// tracked is observed, and availability is a percentage of that.
+func (h PodHistory) SLA(window time.Duration, now time.Time) PodSLA {
+	sla := PodSLA{Pod: h.Pod, Window: FormatWindow(window), Since: now.Add(-window), Availability: 100}
+	if h.Tracked.After(sla.Since) {
+		sla.Since = h.Tracked
+	}
+	sla.Observed = now.Sub(sla.Since)
+	if sla.Observed < 0 {
+		sla.Observed = 0
+	}
+	for _, e := range h.Entries {
+		switch e.Kind {
+		case HistoryMasterChange:
+			if !e.Start.Before(sla.Since) && !e.Start.After(now) {
+				sla.Failovers++
+			}
+		case HistoryDown:
+			start, end := e.Start, e.End
+			if e.Ongoing() {
+				end = now
+			}
+			if start.Before(sla.Since) {
+				start = sla.Since
+			}
+			if end.After(now) {
+				end = now
+			}
+			if end.After(start) {
+				sla.Unavailable += end.Sub(start)
+				sla.DownPeriods++
+			}
+		}
+	}
+	if sla.Observed > 0 {
+		sla.Availability = 100 * (1 - float64(sla.Unavailable)/float64(sla.Observed))
+	}
+	return sla
+}
+
+// PodSLA is a pod's failover count and unavailable time over a window.
+// Observed is how much of the window RedSkull was tracking the pod for,
+// from Since, and Availability the percentage of it the pod had a writable
+// master.
+type PodSLA struct {
+	Pod          string
+	Window       string
+	Since        time.Time
+	Observed     time.Duration
+	Failovers    int
+	DownPeriods  int
+	Unavailable  time.Duration
+	Availability float64
+}
+
+// CSVHeader names the columns of CSVRecord
+func (s PodSLA) CSVHeader() []string {
+	return []string{"pod", "window", "since", "observed_seconds", "failovers", "down_periods", "unavailable_seconds", "availability_percent"}
+}
+
+// CSVRecord renders the SLA as a CSV row, with durations in seconds
+func (s PodSLA) CSVRecord() []string {
+	return []string{
+		s.Pod,
+		s.Window,
+		s.Since.Format(time.RFC3339),
+		strconv.FormatFloat(s.Observed.Seconds(), 'f', 0, 64),
+		strconv.Itoa(s.Failovers),
+		strconv.Itoa(s.DownPeriods),
+		strconv.FormatFloat(s.Unavailable.Seconds(), 'f', 3, 64),
+		strconv.FormatFloat(s.Availability, 'f', 4, 64),
+	}
+}
+
+// ParseWindows parses a comma separated list of SLA windows. Besides what
+// time.ParseDuration accepts a window may be given in days, such as "30d".
+func ParseWindows(list string) (windows []time.Duration, err error) {
+	for _, part := range strings.Split(list, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		d, err := ParseWindow(part)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, d)
+	}
+	sort.Slice(windows, func(i, j int) bool { return windows[i] < windows[j] })
+	return windows, nil
+}
+
+// ParseWindow parses a single SLA window, such as "24h" or "7d"
+func ParseWindow(window string) (time.Duration, error) {
+	var d time.Duration
+	var err error
+	if strings.HasSuffix(window, "d") {
+		var days int
+		days, err = strconv.Atoi(strings.TrimSuffix(window, "d"))
+		d = time.Duration(days) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(window)
+	}
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("Invalid SLA window '%s', expected a positive duration such as 24h or 30d", window)
+	}
+	return d, nil
+}
+
+// FormatWindow renders a window in whole days or hours where it can be, as
+// ParseWindow accepts
+func FormatWindow(window time.Duration) string {
+	switch {
+	case window >= 24*time.Hour && window%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", window/(24*time.Hour))
+	case window >= time.Hour && window%time.Hour == 0:
+		return fmt.Sprintf("%dh", window/time.Hour)
+	}
+	return window.String()
+}
@@ -0,0 +1,47 @@
+package common
+
+import (
+	"encoding/gob"
+	"time"
+)
+
+// Job states
+const (
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// Job types
+const (
+	JobClone   = "clone"
+	JobReset   = "reset"
+	JobBalance = "balance"
+	JobDrill   = "drill"
+)
+
+// Job is a long running operation started through the API. Result holds
+// whatever the operation returns once it has finished.
+type Job struct {
+	ID       string
+	Type     string
+	Pod      string
+	Owner    string
+	State    string
+	Error    string
+	Result   interface{}
+	Started  time.Time
+	Finished time.Time
+}
+
+func init() {
+	// job results travel over RPC as interface values
+	gob.Register(APIResult{})
+	gob.Register(DrillReport{})
+	gob.Register(map[string]string{})
+}
+
+// Done returns true once the job has finished, successfully or not
+func (j Job) Done() bool {
+	return j.State == JobSucceeded || j.State == JobFailed
+}
@@ -0,0 +1,44 @@
+package common
+
+import "time"
+
+// PodMaintenance records that a pod is being worked on. While it is active
+// RedSkull does not report the pod's errors or take automated action on it.
+type PodMaintenance struct {
+	Pod     string
+	Reason  string
+	Owner   string
+	Started time.Time
+	Expires time.Time
+	Consul  bool
+}
+
+// Active returns true if the maintenance window has not expired. A zero
+// Expires never expires.
+func (m PodMaintenance) Active() bool {
+	return m.Expires.IsZero() || time.Now().Before(m.Expires)
+}
+
+// MaintenanceRequest is used to place a pod into maintenance. Duration is
+// parsed with time.ParseDuration; empty means until cleared. Consul also
+// puts the pod's master host agent into Consul maintenance.
+type MaintenanceRequest struct {
+	Podname  string
+	Reason   string
+	Owner    string
+	Duration string
+	Consul   bool
+}
+
+// ExpiresAt returns when maintenance placed now with the request's Duration
+// would expire. The zero time is returned for an empty Duration.
+func (r MaintenanceRequest) ExpiresAt() (time.Time, error) {
+	if r.Duration == "" {
+		return time.Time{}, nil
+	}
+	d, err := time.ParseDuration(r.Duration)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Now().Add(d), nil
+}
@@ -0,0 +1,269 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Manifest step actions
+const (
+	ManifestMonitor = "monitor"
+	ManifestSet     = "set"
+	ManifestBalance = "balance"
+	ManifestRemove  = "remove"
+	ManifestWarn    = "warn"
+)
+
+// SentinelParameters are the pod parameters which may be changed with
+// SENTINEL SET. Scripts are not among them, as setting one would have every
+// sentinel run a command of the caller's choosing.
+var SentinelParameters = map[string]bool{
+	"down-after-milliseconds": true,
+	"failover-timeout":        true,
+	"parallel-syncs":          true,
+	"quorum":                  true,
+	"auth-pass":               true,
+	"auth-user":               true,
+}
+
+// CheckSentinelParameter returns an error if the parameter is not one of
+// SentinelParameters
+func CheckSentinelParameter(key string) error {
+	if !SentinelParameters[key] {
+		return fmt.Errorf("Sentinel parameter '%s' can not be set", key)
+	}
+	return nil
+}
+
+// SecretsDirectory is the directory "file:" secret references sent to the
+// controller must be in. When empty the controller resolves no references;
+// clients resolve them before sending the manifest.
+var SecretsDirectory string
+
+// PodManifest describes the desired state of a single pod. AuthSecret is a
+// reference to the pod's auth token; clients resolve it into Auth before
+// sending the manifest to the controller.
+type PodManifest struct {
+	Name        string            `json:"name" yaml:"name"`
+	Master      string            `json:"master" yaml:"master"`
+	Quorum      int               `json:"quorum" yaml:"quorum"`
+	Parameters  map[string]string `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+	MinReplicas int               `json:"minReplicas,omitempty" yaml:"minReplicas,omitempty"`
+	AuthSecret  string            `json:"authSecret,omitempty" yaml:"authSecret,omitempty"`
+	Auth        string            `json:"auth,omitempty" yaml:"auth,omitempty"`
+}
+
+// Manifest is the desired state of the pods managed by a constellation. When
+// Prune is set, pods found in the constellation but not in the manifest are
+// removed on apply.
+type Manifest struct {
+	Prune bool          `json:"prune,omitempty" yaml:"prune,omitempty"`
+	Pods  []PodManifest `json:"pods" yaml:"pods"`
+}
+
+// ManifestStep is a single change needed to bring a pod in line with its
+// manifest.
+type ManifestStep struct {
+	Pod       string
+	Action    string
+	Parameter string
+	Value     string
+	Detail    string
+}
+
+// ManifestPlan is the ordered list of steps needed to apply a manifest.
+type ManifestPlan struct {
+	Steps []ManifestStep
+}
+
+// ManifestStepResult records the outcome of a step during apply.
+type ManifestStepResult struct {
+	Step    ManifestStep
+	Applied bool
+	Error   string
+}
+
+// ManifestReport is the result of applying, or dry-running, a manifest.
+type ManifestReport struct {
+	DryRun  bool
+	Results []ManifestStepResult
+}
+
+// HasChanges returns true if the plan contains any step which would change
+// the constellation.
+func (p ManifestPlan) HasChanges() bool {
+	for _, step := range p.Steps {
+		if step.Action != ManifestWarn {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseManifest parses a YAML or JSON manifest and validates it.
+func ParseManifest(data []byte) (m Manifest, err error) {
+	err = ParseConfig(data, &m)
+	if err != nil {
+		return m, fmt.Errorf("Unable to parse manifest: %s", err)
+	}
+	return m, m.Validate()
+}
+
+// LoadManifestFile reads and parses the manifest at the given path
+func LoadManifestFile(path string) (m Manifest, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return m, err
+	}
+	return ParseManifest(data)
+}
+
+// Validate checks the manifest for missing or malformed pod definitions
+func (m Manifest) Validate() error {
+	seen := make(map[string]bool)
+	for i, pm := range m.Pods {
+		if pm.Name == "" {
+			return fmt.Errorf("Pod #%d in manifest has no name", i+1)
+		}
+		if seen[pm.Name] {
+			return fmt.Errorf("Pod '%s' is listed more than once", pm.Name)
+		}
+		seen[pm.Name] = true
+		if _, _, err := pm.MasterHostPort(); err != nil {
+			return fmt.Errorf("Pod '%s': %s", pm.Name, err)
+		}
+		if pm.Quorum < 1 {
+			return fmt.Errorf("Pod '%s' needs a quorum of at least 1", pm.Name)
+		}
+		if pm.MinReplicas < 0 {
+			return fmt.Errorf("Pod '%s' has a negative minReplicas", pm.Name)
+		}
+		for key := range pm.Parameters {
+			if err := CheckSentinelParameter(key); err != nil {
+				return fmt.Errorf("Pod '%s': %s", pm.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// MasterHostPort splits the manifest's master address into host and port
+func (pm PodManifest) MasterHostPort() (host string, port int, err error) {
+	apair := strings.Split(pm.Master, ":")
+	if len(apair) != 2 || apair[0] == "" {
+		return host, port, fmt.Errorf("master '%s' is not in ip:port form", pm.Master)
+	}
+	port, err = strconv.Atoi(apair[1])
+	if err != nil || port <= 0 {
+		return host, port, fmt.Errorf("master '%s' has an invalid port", pm.Master)
+	}
+	return apair[0], port, nil
+}
+
+// ResolveSecrets resolves each pod's AuthSecret reference into its Auth
+// token. Clients call it before sending a manifest, so references are read
+// on the client's machine rather than the controller's.
+func (m *Manifest) ResolveSecrets() error {
+	for i, pm := range m.Pods {
+		if pm.AuthSecret == "" || pm.Auth > "" {
+			continue
+		}
+		auth, err := ResolveSecretRef(pm.AuthSecret)
+		if err != nil {
+			return fmt.Errorf("Pod '%s': %s", pm.Name, err)
+		}
+		m.Pods[i].Auth = auth
+	}
+	return nil
+}
+
+// ResolveAuth returns the pod's auth token on the controller: the token the
+// client resolved, or failing that the AuthSecret reference resolved by
+// ResolveControllerSecretRef.
+func (pm PodManifest) ResolveAuth() (string, error) {
+	if pm.Auth > "" {
+		return pm.Auth, nil
+	}
+	return ResolveControllerSecretRef(pm.AuthSecret)
+}
+
+// ResolveSecretRef resolves an "env:" or "file:" secret reference. An empty
+// reference resolves to an empty secret. References take the form
+// "env:VARIABLE" or "file:/path/to/secret" so the secret itself never needs
+// to live in the manifest.
+func ResolveSecretRef(ref string) (string, error) {
+	scheme, name, err := splitSecretRef(ref)
+	if err != nil || scheme == "" {
+		return "", err
+	}
+	switch scheme {
+	case "env":
+		val, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("Environment variable '%s' is not set", name)
+		}
+		return val, nil
+	case "file":
+		return readSecretFile(name)
+	}
+	return "", errors.New("Unknown secret reference scheme: " + scheme)
+}
+
+// ResolveControllerSecretRef resolves a secret reference sent to the
+// controller. Only "file:" references to files in SecretsDirectory are
+// resolved, so a manifest can not be used to read the controller's
+// environment or other files.
+func ResolveControllerSecretRef(ref string) (string, error) {
+	scheme, name, err := splitSecretRef(ref)
+	if err != nil || scheme == "" {
+		return "", err
+	}
+	if scheme != "file" {
+		return "", fmt.Errorf("Secret reference '%s' must be resolved by the client", ref)
+	}
+	if SecretsDirectory == "" {
+		return "", fmt.Errorf("Secret reference '%s' must be resolved by the client, no secrets directory is configured", ref)
+	}
+	dir, err := filepath.EvalSymlinks(SecretsDirectory)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(dir, name)
+	}
+	path, err := filepath.EvalSymlinks(name)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("Secret reference '%s' is outside the secrets directory", ref)
+	}
+	return readSecretFile(path)
+}
+
+// splitSecretRef splits a secret reference into its scheme and name. An
+// empty reference has an empty scheme.
+func splitSecretRef(ref string) (scheme, name string, err error) {
+	if ref == "" {
+		return "", "", nil
+	}
+	parts := strings.SplitN(ref, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", "", fmt.Errorf("Secret reference '%s' is not in scheme:name form", ref)
+	}
+	return parts[0], parts[1], nil
+}
+
+func readSecretFile(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
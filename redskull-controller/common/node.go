@@ -1,29 +1,42 @@
 package common
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"log"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/dustin/go-humanize"
 	"github.com/therealbill/libredis/client"
+	"github.com/therealbill/libredis/structures"
+	"github.com/therealbill/redskull/redskull-shared/logging"
 )
 
 var NodeRefreshInterval float64
+
+// NodesMap holds a copy of each node as last loaded, by name. Its nodes are
+// never changed once stored; LoadNodeFromHostPort hands out copies of them.
+// It is guarded by nodesMu.
 var NodesMap map[string]*RedisNode
+var nodesMu sync.Mutex
 var DialTimeout time.Duration = 900 * time.Millisecond
 
+func init() {
+	NodesMap = make(map[string]*RedisNode)
+}
+
 // UpdateData will check if an update is needed, and update if so. It returns a
-// boolean indicating if an update was done and an err.
-func (n *RedisNode) UpdateData() (bool, error) {
+// boolean indicating if an update was done and an err. The context bounds
+// every call made to the node and its slaves.
+func (n *RedisNode) UpdateData(ctx context.Context) (bool, error) {
 	// If the last update was successful and it has been less than 10 seconds,
 	// don't bother.
 	if n == nil {
-		log.Print("WTF?! a nill node?")
-		return false, errors.New("Node given does not exist in the system. SOmewhere there is a bug.")
+		logging.Warnf("UpdateData called on a nil node")
+		return false, errors.New("Node given does not exist in the system")
 	}
 	if n.LastUpdateValid {
 		elapsed := time.Since(n.LastUpdate)
@@ -32,29 +45,85 @@ func (n *RedisNode) UpdateData() (bool, error) {
 			return false, nil
 		}
 	}
-	dconf := client.DialConfig{Address: n.Name, Password: n.Auth, Network: "tcp", Timeout: DialTimeout}
-	conn, err := client.DialWithConfig(&dconf)
-	//deadline := time.Now().Add(DialTimeout)
+	conn, err := Dial(ctx, client.DialConfig{Address: n.Name, Password: n.Auth})
 	if err != nil {
-		log.Print("unable to connect to node. Err:", err)
+		logging.Errorf("unable to connect to node. Err:%s", err)
 		n.LastUpdateValid = false
 		n.LastUpdateDelay = time.Since(n.LastUpdate)
 		return false, err
 	}
 	defer conn.ClosePool()
-	nodeinfo, err := conn.Info()
+	// The node is read into a copy so a call abandoned when the context ends
+	// can't write to n behind the caller's back
+	fresh := *n
+	err = Do(ctx, func() error {
+		return fresh.load(conn)
+	})
 	if err != nil {
-		log.Print("Info error on node. Err:", err)
+		logging.Errorf("Info error on node. Err:%s", err)
 		n.LastUpdateValid = false
 		n.LastUpdateDelay = time.Since(n.LastUpdate)
 		return false, err
 	}
+	*n = fresh
+
+	var slavenodes []*RedisNode
+	for _, slave := range n.Info.Replication.Slaves {
+		if ctx.Err() != nil {
+			n.LastUpdateValid = false
+			return false, ctx.Err()
+		}
+		snode, err := LoadNodeFromHostPort(ctx, slave.IP, slave.Port, n.Auth)
+		if err != nil {
+			logging.Errorf("Unable to load node from %s:%d. Error:%s", slave.IP, slave.Port, err)
+			continue
+		}
+		slavenodes = append(slavenodes, snode)
+	}
+	if n.Slaves == nil {
+		n.Slaves = make([]*RedisNode, 5)
+	}
+	n.Slaves = slavenodes
+	n.LastUpdateValid = true
+	n.LastUpdate = time.Now()
+	n.LastUpdateDelay = time.Since(n.LastUpdate)
+	cacheNode(n)
+	return true, nil
+}
+
+// cachedNode returns a copy of the node last stored under name
+func cachedNode(name string) (*RedisNode, bool) {
+	nodesMu.Lock()
+	defer nodesMu.Unlock()
+	node, exists := NodesMap[name]
+	if !exists {
+		return nil, false
+	}
+	return make(NodeCopier).Node(node), true
+}
+
+// cacheNode stores a copy of the node in NodesMap, so later changes to n
+// are not seen through it
+func cacheNode(n *RedisNode) {
+	nodesMu.Lock()
+	defer nodesMu.Unlock()
+	if NodesMap == nil {
+		logging.Fatalf("NodesMap not initialized")
+	}
+	NodesMap[n.Name] = make(NodeCopier).Node(n)
+}
+
+// load reads the node's INFO, memory, persistence, latency and slowlog data
+// over conn
+func (n *RedisNode) load(conn *client.Redis) error {
+	nodeinfo, err := conn.Info()
+	if err != nil {
+		return err
+	}
 	n.LastUpdate = time.Now()
 	if nodeinfo.Server.Version == "" {
-		log.Print("WARNING: Unable to get INFO or node!")
-		n.LastUpdateValid = false
-		n.LastUpdateDelay = time.Since(n.LastUpdate)
-		return false, fmt.Errorf("Unable to pull valid INFO for %s", n.Name)
+		logging.Warnf("Unable to get INFO or node!")
+		return fmt.Errorf("Unable to pull valid INFO for %s", n.Name)
 	}
 
 	n.Info = nodeinfo
@@ -70,7 +139,7 @@ func (n *RedisNode) UpdateData() (bool, error) {
 
 	cfg, err := conn.ConfigGet("save")
 	if err != nil {
-		log.Print("Unable to get 'save' from config call")
+		logging.Errorf("Unable to get 'save' from config call")
 	}
 	does_save := cfg["save"]
 	if len(does_save) != 0 {
@@ -104,29 +173,7 @@ func (n *RedisNode) UpdateData() (bool, error) {
 	n.SlowLogThreshold, err = strconv.ParseInt(res["slowlog-log-slower-than"], 0, 64)
 	n.SlowLogLength, _ = conn.SlowLogLen()
 	n.SlowLogRecords, _ = conn.SlowLogGet(n.SlowLogLength)
-
-	var slavenodes []*RedisNode
-	for _, slave := range n.Info.Replication.Slaves {
-		snode, err := LoadNodeFromHostPort(slave.IP, slave.Port, n.Auth)
-		if err != nil {
-			log.Printf("Unable to load node from %s:%d. Error:%s", slave.IP, slave.Port, err)
-			continue
-		}
-		slavenodes = append(slavenodes, snode)
-	}
-	if n.Slaves == nil {
-		n.Slaves = make([]*RedisNode, 5)
-	}
-	n.Slaves = slavenodes
-	n.LastUpdateValid = true
-	n.LastUpdate = time.Now()
-	n.LastUpdateDelay = time.Since(n.LastUpdate)
-	log.Printf("NodesMap: '%v'", NodesMap)
-	if NodesMap == nil {
-		log.Fatal("NodesMap not initialized")
-	}
-	NodesMap[n.Name] = n
-	return true, nil
+	return nil
 }
 
 func (n *RedisNode) UptimeHuman() string {
@@ -137,8 +184,8 @@ func (n *RedisNode) MaxMemoryHuman() string {
 	return humanize.Bytes(uint64(n.MaxMemory))
 }
 
-func (n *RedisNode) InErrorState() bool {
-	n.UpdateData()
+func (n *RedisNode) InErrorState(ctx context.Context) bool {
+	n.UpdateData(ctx)
 	if n.MemoryUseCritical {
 		return true
 	}
@@ -156,13 +203,13 @@ func (n *RedisNode) IsFree() bool {
 	return false
 }
 
-func (n *RedisNode) Ping() bool {
-	dconf := client.DialConfig{Address: n.Name, Password: n.Auth, Network: "tcp", Timeout: DialTimeout}
-	conn, err := client.DialWithConfig(&dconf)
+func (n *RedisNode) Ping(ctx context.Context) bool {
+	conn, err := Dial(ctx, client.DialConfig{Address: n.Name, Password: n.Auth})
 	if err != nil {
 		return false
 	}
-	err = conn.Ping()
+	defer conn.ClosePool()
+	err = Do(ctx, conn.Ping)
 	if err != nil {
 		return false
 	}
@@ -181,21 +228,21 @@ type NodeStore struct {
 
 type NodeManager interface {
 	GetNodes() []*RedisNode
-	GetNode(string) *RedisNode
+	GetNode(context.Context, string) *RedisNode
 	GetFreeNodes() []*RedisNode
-	GetNodesInError() []*RedisNode
+	GetNodesInError(context.Context) []*RedisNode
 	LoadNodes() bool
-	HasNodesInErrorState() bool
+	HasNodesInErrorState(context.Context) bool
 	NodeCount() int
-	ErrorNodeCount() int
+	ErrorNodeCount(context.Context) int
 	FreeNodeCount() int
 	HasFreeNodes() bool
 	AddNode(*RedisNode)
 }
 
-func LoadNodeFromHostPort(ip string, port int, authtoken string) (node *RedisNode, err error) {
+func LoadNodeFromHostPort(ctx context.Context, ip string, port int, authtoken string) (node *RedisNode, err error) {
 	name := fmt.Sprintf("%s:%d", ip, port)
-	node, exists := NodesMap[name]
+	node, exists := cachedNode(name)
 	if exists {
 		return node, nil
 	}
@@ -203,36 +250,40 @@ func LoadNodeFromHostPort(ip string, port int, authtoken string) (node *RedisNod
 	node.LastUpdateValid = false
 	node.Slaves = make([]*RedisNode, 5)
 
-	conn, err := client.DialWithConfig(&client.DialConfig{Address: name, Password: authtoken, Timeout: DialTimeout})
+	conn, err := Dial(ctx, client.DialConfig{Address: name, Password: authtoken})
 	if err != nil {
-		log.Printf("Failed connection to %s:%d. Error:%s", ip, port, err.Error())
+		logging.Errorf("Failed connection to %s:%d. Error:%s", ip, port, err.Error())
 		return node, err
 	}
 	defer conn.ClosePool()
 
 	node.Connected = true
-	nodeInfo, err := conn.Info()
+	var nodeInfo structures.RedisInfoAll
+	err = Do(ctx, func() (err error) {
+		nodeInfo, err = conn.Info()
+		return err
+	})
 	if err != nil {
 		if strings.Contains(err.Error(), "password") {
 			node.HasValidAuth = false
 		}
-		log.Printf("WARNING: NODE '%s' was unable to return Info(). Error='%s'", name, err)
+		logging.Warnf("NODE '%s' was unable to return Info(). Error='%s'", name, err)
 		return node, err
 	}
 	if nodeInfo.Server.Version == "" {
-		log.Printf("WARNING: NODE '%s' was unable to return Info(). Error=NONE", name)
+		logging.Warnf("NODE '%s' was unable to return Info(). Error=NONE", name)
 		return node, err
 	}
 	node.HasValidAuth = true
-	log.Print("updating node data")
-	_, err = node.UpdateData()
-	log.Print("node data updated")
+	logging.Debugf("updating node data")
+	_, err = node.UpdateData(ctx)
+	logging.Debugf("node data updated")
 	if err != nil {
-		log.Printf("Node %s has invalid state. Err from UpdateData call: %s", node.Name, err)
+		logging.Node(node.Name).Warnf("Node %s has invalid state. Err from UpdateData call: %s", node.Name, err)
 		return node, err
 	}
 	node.Info = nodeInfo
-	NodesMap[name] = node
+	cacheNode(node)
 	//log.Printf("node: %+v", node)
 	return node, nil
 }
@@ -243,12 +294,12 @@ func (nm *NodeStore) HasFreeNodes() bool {
 	}
 	return false
 }
-func (nm *NodeStore) HasNodesInErrorState() bool {
+func (nm *NodeStore) HasNodesInErrorState(ctx context.Context) bool {
 	if len(nm.NodesInError) != 0 {
 		return true
 	}
 	for _, n := range nm.NodesMap {
-		if n.InErrorState() {
+		if n.InErrorState(ctx) {
 			return true
 		}
 	}
@@ -278,9 +329,9 @@ func (nm *NodeStore) AddNode(node *RedisNode) {
 	}
 }
 
-func (nm *NodeStore) ErrorNodeCount() (count int) {
+func (nm *NodeStore) ErrorNodeCount(ctx context.Context) (count int) {
 	for _, node := range nm.NodesMap {
-		if node.InErrorState() {
+		if node.InErrorState(ctx) {
 			count++
 		}
 	}
@@ -295,9 +346,9 @@ func (nm *NodeStore) NodeCount() int {
 	return len(nm.Nodes)
 }
 
-func (nm *NodeStore) GetNodesInError() (nodes []*RedisNode) {
+func (nm *NodeStore) GetNodesInError(ctx context.Context) (nodes []*RedisNode) {
 	for _, node := range nm.NodesMap {
-		if node.InErrorState() {
+		if node.InErrorState(ctx) {
 			nodes = append(nodes, node)
 		}
 	}
@@ -314,16 +365,16 @@ func (nm *NodeStore) GetNodes() (nodes []*RedisNode) {
 	return
 }
 
-func (nm *NodeStore) GetNode(name string) (node *RedisNode) {
+func (nm *NodeStore) GetNode(ctx context.Context, name string) (node *RedisNode) {
 	if len(name) == 0 {
-		log.Print("Called w/empty name")
+		logging.Warnf("Called w/empty name")
 	}
 	for _, node := range nm.Nodes {
 		if node.Name == name {
-			node.UpdateData()
+			node.UpdateData(ctx)
 			return node
 		}
 	}
-	log.Print("Node not found:", name)
+	logging.Warnf("Node not found:%s", name)
 	return node
 }
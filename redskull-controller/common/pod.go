@@ -1,8 +1,10 @@
 package common
 
 import (
-	"log"
+	"context"
 	"strings"
+
+	"github.com/therealbill/redskull/redskull-shared/logging"
 )
 
 // HasQuorum checks to see if the pod has Quorum.
@@ -11,17 +13,17 @@ func (rp *RedisPod) HasQuorum() bool {
 }
 
 // CanFailover tests failover conditions to determine if a failover call would
-// succeed
-func (rp *RedisPod) CanFailover() bool {
+// succeed. The master is loaded within the context if it isn't already.
+func (rp *RedisPod) CanFailover(ctx context.Context) bool {
 	if rp.AuthToken == "" {
-		log.Printf("%s has no valid auth, so considered unable to failover", rp.Name)
+		logging.Pod(rp.Name).Warnf("%s has no valid auth, so considered unable to failover", rp.Name)
 		return false
 	}
 	promotable_slaves := 0
 	if rp.Master == nil {
-		master, err := LoadNodeFromHostPort(rp.Info.IP, rp.Info.Port, rp.AuthToken)
+		master, err := LoadNodeFromHostPort(ctx, rp.Info.IP, rp.Info.Port, rp.AuthToken)
 		if err != nil {
-			log.Printf("Unable to load %s. Err: '%s'", rp.Name, err)
+			logging.Pod(rp.Name).Errorf("Unable to load %s. Err: '%s'", rp.Name, err)
 			if strings.Contains(err.Error(), "invalid password") {
 				rp.ValidAuth = false
 				master.HasValidAuth = false
@@ -39,12 +41,12 @@ func (rp *RedisPod) CanFailover() bool {
 	}
 	if !rp.Master.LastUpdateValid {
 		rp.HasInfo = false
-		log.Printf("Pod %s has no valid update", rp.Name)
+		logging.Pod(rp.Name).Debugf("Pod %s has no valid update", rp.Name)
 	} else {
 		rp.HasInfo = true
 		for _, slave := range rp.Master.Slaves {
 			if slave.Info.Server.Version == "" {
-				log.Print("slave had no info stored, skipping")
+				logging.Debugf("slave had no info stored, skipping")
 				continue
 			}
 			if slave.Info.Replication.SlavePriority > 0 {
@@ -75,7 +77,7 @@ func (rp *RedisPod) SlavesHaveEnoughMemory() bool {
 	}
 	for _, node := range rp.Master.Slaves {
 		if node == nil {
-			log.Print("Node is nil!")
+			logging.Warnf("Node is nil!")
 			continue
 		}
 		if node.MaxMemory < rp.Master.MaxMemory {
@@ -90,14 +92,14 @@ func (rp *RedisPod) SlavesHaveEnoughMemory() bool {
 // TODO: Some of these are better categorized as warnings and this should be
 // split into a pair of functions: one for errors and one for warning.
 // This will require additional work to incorporate the HasWarnings concept
-// through the system.
-func (rp *RedisPod) HasErrors() bool {
+// through the system. The master's data is refreshed within the context.
+func (rp *RedisPod) HasErrors(ctx context.Context) bool {
 	rp.NeededSentinels = rp.Info.Quorum + 1
 	rp.ReportedSentinelCount = rp.Info.NumOtherSentinels
 	hasErrors := false
 	if rp.Master != nil {
 		rp.Master.LastUpdateValid = false
-		rp.Master.UpdateData()
+		rp.Master.UpdateData(ctx)
 	}
 	if rp.Info.NumOtherSentinels > 0 {
 		rp.ReportedSentinelCount++
@@ -114,7 +116,7 @@ func (rp *RedisPod) HasErrors() bool {
 		rp.TooManySentinels = true
 		return true
 	}
-	if !rp.CanFailover() {
+	if !rp.CanFailover(ctx) {
 		return true
 	}
 	if !rp.SlavesHaveEnoughMemory() {
@@ -0,0 +1,64 @@
+package common
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"time"
+)
+
+const (
+	RebalanceAdd    = "add"
+	RebalanceRemove = "remove"
+)
+
+// RebalanceMove is a single change in a rebalance plan: adding a pod to, or
+// removing a pod from, one sentinel.
+type RebalanceMove struct {
+	Pod      string
+	Action   string
+	Sentinel string
+	Host     string
+	Reason   string
+}
+
+// RebalancePlan is the full set of moves needed to bring every pod to
+// quorum+1 sentinels. Load is the number of pods each sentinel monitors
+// before the plan, ProjectedLoad after it. Warnings list pods the plan can
+// not fully fix.
+type RebalancePlan struct {
+	Created       time.Time
+	Fingerprint   string
+	Moves         []RebalanceMove
+	Load          map[string]int
+	ProjectedLoad map[string]int
+	Warnings      []string
+}
+
+// RebalanceResult records the outcome of one move
+type RebalanceResult struct {
+	Move    RebalanceMove
+	Applied bool
+	Error   string
+}
+
+// RebalanceReport is the result of executing a rebalance plan
+type RebalanceReport struct {
+	Fingerprint string
+	Results     []RebalanceResult
+}
+
+// HasChanges returns true if the plan contains any moves
+func (p RebalancePlan) HasChanges() bool {
+	return len(p.Moves) > 0
+}
+
+// SetFingerprint computes a fingerprint of the plan's moves. A confirmation
+// carrying the fingerprint is only honoured if a freshly computed plan
+// matches it, so an operator never executes moves they have not seen.
+func (p *RebalancePlan) SetFingerprint() {
+	h := sha1.New()
+	for _, m := range p.Moves {
+		fmt.Fprintf(h, "%s|%s|%s\n", m.Pod, m.Action, m.Sentinel)
+	}
+	p.Fingerprint = fmt.Sprintf("%x", h.Sum(nil))[:16]
+}
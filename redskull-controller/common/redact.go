@@ -0,0 +1,85 @@
+package common
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+)
+
+// RedactedSecret replaces credentials in serialized output
+const RedactedSecret = "********"
+
+// MaskSecret returns RedactedSecret for any non-empty secret, so callers can
+// still tell whether a secret is set
+func MaskSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return RedactedSecret
+}
+
+// podWire and nodeWire have the same fields as RedisPod and RedisNode but
+// none of their methods, so they can be encoded without recursing into the
+// redacting encoders below.
+type podWire RedisPod
+type nodeWire RedisNode
+
+// MarshalJSON masks the pod's auth token. Use the audited auth endpoint to
+// retrieve it.
+func (rp RedisPod) MarshalJSON() ([]byte, error) {
+	w := podWire(rp)
+	w.AuthToken = MaskSecret(w.AuthToken)
+	return json.Marshal(w)
+}
+
+// MarshalJSON masks the node's auth
+func (n RedisNode) MarshalJSON() ([]byte, error) {
+	w := nodeWire(n)
+	w.Auth = MaskSecret(w.Auth)
+	return json.Marshal(w)
+}
+
+// GobEncode masks the pod's auth token in RPC responses
+func (rp RedisPod) GobEncode() ([]byte, error) {
+	w := podWire(rp)
+	w.AuthToken = MaskSecret(w.AuthToken)
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(w)
+	return buf.Bytes(), err
+}
+
+// GobDecode implements gob.GobDecoder
+func (rp *RedisPod) GobDecode(data []byte) error {
+	var w podWire
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&w); err != nil {
+		return err
+	}
+	*rp = RedisPod(w)
+	return nil
+}
+
+// GobEncode masks the node's auth in RPC responses. Unloaded (nil) slaves
+// are dropped as gob can not encode them.
+func (n RedisNode) GobEncode() ([]byte, error) {
+	w := nodeWire(n)
+	w.Auth = MaskSecret(w.Auth)
+	w.Slaves = nil
+	for _, slave := range n.Slaves {
+		if slave != nil {
+			w.Slaves = append(w.Slaves, slave)
+		}
+	}
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(w)
+	return buf.Bytes(), err
+}
+
+// GobDecode implements gob.GobDecoder
+func (n *RedisNode) GobDecode(data []byte) error {
+	var w nodeWire
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&w); err != nil {
+		return err
+	}
+	*n = RedisNode(w)
+	return nil
+}
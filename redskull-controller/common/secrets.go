@@ -0,0 +1,106 @@
+package common
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// EncryptedSecretPrefix marks a secret as having been encrypted with
+// EncryptSecret
+const EncryptedSecretPrefix = "enc:v1:"
+
+// CredentialVersion is one version of a pod's credential. Source records
+// where it came from: the sentinel config, an API call, or a peer.
+type CredentialVersion struct {
+	Version int
+	Secret  string
+	Updated time.Time
+	Source  string
+}
+
+// LoadKeyFile reads a 256 bit key from the given file. The key may be stored
+// as 32 raw bytes, 64 hex characters, or base64.
+func LoadKeyFile(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 32 {
+		return data, nil
+	}
+	text := strings.TrimSpace(string(data))
+	if key, err := hex.DecodeString(text); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(text); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	return nil, errors.New("Key file must hold a 256 bit key as raw bytes, hex, or base64")
+}
+
+// IsEncryptedSecret returns true if the secret was produced by EncryptSecret
+func IsEncryptedSecret(secret string) bool {
+	return strings.HasPrefix(secret, EncryptedSecretPrefix)
+}
+
+// EncryptSecret seals the plaintext with AES-GCM under the given key. Empty
+// secrets are returned unchanged.
+func EncryptSecret(key []byte, plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return EncryptedSecretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptSecret reverses EncryptSecret. Secrets without the encrypted prefix
+// are returned as-is.
+func DecryptSecret(key []byte, secret string) (string, error) {
+	if !IsEncryptedSecret(secret) {
+		return secret, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, EncryptedSecretPrefix))
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("Encrypted secret is truncated")
+	}
+	nonce := sealed[:gcm.NonceSize()]
+	plain, err := gcm.Open(nil, nonce, sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("Unable to decrypt secret, wrong key?")
+	}
+	return string(plain), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, errors.New("No valid secret key configured")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
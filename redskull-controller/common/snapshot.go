@@ -0,0 +1,54 @@
+package common
+
+import "time"
+
+// SnapshotVersion is the version of the snapshot document produced by this
+// version of RedSkull. Restore refuses documents with a newer version.
+const SnapshotVersion = 1
+
+// ConstellationSnapshot is a point-in-time record of the constellation's
+// topology, used to rebuild it after losing sentinels.
+type ConstellationSnapshot struct {
+	Version   int
+	Name      string
+	Created   time.Time
+	Encrypted bool
+	Sentinels []SentinelSnapshot
+	Pods      []PodSnapshot
+}
+
+// SentinelSnapshot records a sentinel and the pods it was monitoring
+type SentinelSnapshot struct {
+	Name  string
+	Host  string
+	Port  int
+	Local bool
+	Pods  []string
+}
+
+// PodSnapshot records a pod's master, replicas, sentinels and settings.
+// AuthToken is encrypted when the snapshot's Encrypted flag is set.
+type PodSnapshot struct {
+	Name       string
+	Master     string
+	Quorum     int
+	AuthToken  string
+	Replicas   []string
+	Sentinels  []string
+	Parameters map[string]string
+}
+
+// RestoreResult records what happened to a pod during a restore
+type RestoreResult struct {
+	Pod      string
+	Master   string
+	Restored bool
+	Skipped  bool
+	Message  string
+	Error    string
+}
+
+// RestoreReport is the result of restoring a snapshot
+type RestoreReport struct {
+	Results []RestoreResult
+}
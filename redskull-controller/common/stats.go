@@ -0,0 +1,16 @@
+package common
+
+// ConstellationStats holds mtrics about the constellation. As the
+// Constellation term is undergoing a change, this will also need to change to
+// reflect the new terminology.
+// As soon as it is determined
+type ConstellationStats struct {
+	PodCount        int
+	NodeCount       int
+	TotalPodMemory  int64
+	TotalNodeMemory int64
+	SentinelCount   int
+	PodSizes        map[int64]int64
+	MemoryUsed      int64
+	MemoryPctAvail  float64
+}
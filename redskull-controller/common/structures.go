@@ -18,6 +18,7 @@ type CloneRequest struct {
 type FailoverRequest struct {
 	Podname   string
 	ReturnNew bool
+	Force     bool
 }
 
 type AddSlaveRequest struct {
@@ -27,6 +28,10 @@ type AddSlaveRequest struct {
 	SlaveAuth    string
 }
 
+type RebalanceRequest struct {
+	Fingerprint string
+}
+
 type MonitorRequest struct {
 	Podname       string
 	MasterAddress string
@@ -0,0 +1,57 @@
+package common
+
+import "time"
+
+// Severities of findings and events
+const (
+	SeverityCritical = "critical"
+	SeverityWarning  = "warning"
+	SeverityInfo     = "info"
+)
+
+// Topology finding kinds
+const (
+	FindingMultipleMasters      = "multiple-masters"
+	FindingWrongMaster          = "wrong-master"
+	FindingSentinelDisagreement = "sentinel-disagreement"
+	FindingOrphanReplica        = "orphan-replica"
+	FindingChainedReplication   = "chained-replication"
+)
+
+// PodFinding is an anomaly found while checking a pod
+type PodFinding struct {
+	Pod      string
+	Kind     string
+	Severity string
+	Node     string
+	Detail   string
+}
+
+// TopologyReport compares what a pod's sentinels report with what its Redis
+// nodes report. SentinelMasters maps each sentinel to the master address it
+// returned; Master is the address most sentinels agree on. Errors lists
+// sentinels and nodes which could not be checked.
+type TopologyReport struct {
+	Pod             string
+	Checked         time.Time
+	Master          string
+	SentinelMasters map[string]string
+	Nodes           map[string]string
+	Findings        []PodFinding
+	Errors          []string
+}
+
+// HasFindings returns true if any anomaly was found
+func (t TopologyReport) HasFindings() bool {
+	return len(t.Findings) > 0
+}
+
+// IsCritical returns true if any finding is critical
+func (t TopologyReport) IsCritical() bool {
+	for _, f := range t.Findings {
+		if f.Severity == SeverityCritical {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package errors
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/therealbill/airbrake-go"
+)
+
+// DefaultAirbrakeEndpoint is used when no endpoint is configured
+const DefaultAirbrakeEndpoint = "https://api.airbrake.io/notifier_api/v2/notices"
+
+// airbrakeMu serializes reports, as the airbrake client is configured through
+// package variables
+var airbrakeMu sync.Mutex
+
+// AirbrakeReporter sends reports to Airbrake or a compatible service
+type AirbrakeReporter struct {
+	Endpoint string
+	APIKey   string
+}
+
+// NewAirbrakeReporter returns a reporter for the endpoint, or the public
+// Airbrake service if endpoint is empty
+func NewAirbrakeReporter(endpoint, key string) *AirbrakeReporter {
+	if endpoint == "" {
+		endpoint = DefaultAirbrakeEndpoint
+	}
+	return &AirbrakeReporter{Endpoint: endpoint, APIKey: key}
+}
+
+// Name returns the reporter's description
+func (a *AirbrakeReporter) Name() string {
+	return "airbrake at " + a.Endpoint
+}
+
+// Report sends the report as an Airbrake notice. Airbrake has no fields for
+// the pod or sentinel so they are appended to the message.
+func (a *AirbrakeReporter) Report(r Report) error {
+	airbrakeMu.Lock()
+	defer airbrakeMu.Unlock()
+	airbrake.Endpoint = a.Endpoint
+	airbrake.ApiKey = a.APIKey
+	airbrake.Environment = r.Environment
+	n := airbrake.ExtendedNotification{ErrorClass: r.Class, Error: fmt.Errorf("%s", r.describe())}
+	return airbrake.ExtendedError(n, r.HTTPRequest())
+}
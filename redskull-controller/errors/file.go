@@ -0,0 +1,40 @@
+package errors
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// FileReporter appends each report to a file as a line of JSON
+type FileReporter struct {
+	sync.Mutex
+	Path string
+}
+
+// NewFileReporter returns a reporter appending to path
+func NewFileReporter(path string) *FileReporter {
+	return &FileReporter{Path: path}
+}
+
+// Name returns the reporter's description
+func (f *FileReporter) Name() string {
+	return "file " + f.Path
+}
+
+// Report appends the report to the file
+func (f *FileReporter) Report(r Report) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	f.Lock()
+	defer f.Unlock()
+	out, err := os.OpenFile(f.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = out.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,55 @@
+package errors
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// HTTPReporter POSTs each report as JSON to an endpoint
+type HTTPReporter struct {
+	URL     string
+	Headers map[string]string
+	client  *http.Client
+}
+
+// NewHTTPReporter returns a reporter POSTing to url with the given extra
+// headers, such as an Authorization header
+func NewHTTPReporter(url string, headers map[string]string) *HTTPReporter {
+	return &HTTPReporter{URL: url, Headers: headers, client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+// Name returns the reporter's description
+func (h *HTTPReporter) Name() string {
+	return "http endpoint " + h.URL
+}
+
+// Report POSTs the report, treating any non-2xx response as a failure
+func (h *HTTPReporter) Report(r Report) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "RedSkull-ErrorReporter")
+	for k, v := range h.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("endpoint returned %d", resp.StatusCode)
+	}
+	return nil
+}
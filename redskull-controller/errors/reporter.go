@@ -0,0 +1,158 @@
+// Package errors reports errors RedSkull encounters, such as failed
+// failovers or unreachable sentinels, to an external error tracker.
+package errors
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/therealbill/redskull/redskull-shared/logging"
+)
+
+// Report is a single error report along with the pod and sentinel it
+// concerns
+type Report struct {
+	Class       string            `json:"class"`
+	Message     string            `json:"message"`
+	Pod         string            `json:"pod,omitempty"`
+	Sentinel    string            `json:"sentinel,omitempty"`
+	Context     map[string]string `json:"context,omitempty"`
+	Request     *RequestInfo      `json:"request,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Host        string            `json:"host,omitempty"`
+	Time        time.Time         `json:"time"`
+	Err         error             `json:"-"`
+	request     *http.Request
+}
+
+// RequestInfo describes the HTTP request being handled when the error
+// occurred
+type RequestInfo struct {
+	Method     string `json:"method"`
+	URL        string `json:"url"`
+	RemoteAddr string `json:"remoteAddr"`
+	UserAgent  string `json:"userAgent,omitempty"`
+}
+
+// HTTPRequest returns the request being handled when the error occurred, if
+// any
+func (r Report) HTTPRequest() *http.Request {
+	return r.request
+}
+
+// Reporter sends error reports somewhere
+type Reporter interface {
+	Name() string
+	Report(r Report) error
+}
+
+// ReporterConfig selects and configures a Reporter. Kind is one of airbrake,
+// http, file or none.
+type ReporterConfig struct {
+	Kind   string
+	URL    string
+	File   string
+	APIKey string
+}
+
+// NewReporter returns the reporter described by cfg
+func NewReporter(cfg ReporterConfig) (Reporter, error) {
+	switch strings.ToLower(cfg.Kind) {
+	case "airbrake":
+		if cfg.APIKey == "" {
+			return nil, fmt.Errorf("The airbrake error reporter needs an API key")
+		}
+		return NewAirbrakeReporter(cfg.URL, cfg.APIKey), nil
+	case "http":
+		if !strings.HasPrefix(cfg.URL, "http://") && !strings.HasPrefix(cfg.URL, "https://") {
+			return nil, fmt.Errorf("The http error reporter needs an http or https url")
+		}
+		return NewHTTPReporter(cfg.URL, nil), nil
+	case "file":
+		if cfg.File == "" {
+			return nil, fmt.Errorf("The file error reporter needs a file")
+		}
+		return NewFileReporter(cfg.File), nil
+	case "", "none":
+		return NopReporter{}, nil
+	}
+	return nil, fmt.Errorf("Unknown error reporter '%s'", cfg.Kind)
+}
+
+// NopReporter discards every report
+type NopReporter struct{}
+
+// Name returns "none"
+func (NopReporter) Name() string { return "none" }
+
+// Report does nothing
+func (NopReporter) Report(r Report) error { return nil }
+
+// Environment tags every report with the environment RedSkull runs in
+var Environment = "Development"
+
+var (
+	mu          sync.RWMutex
+	current     Reporter = NopReporter{}
+	hostname, _          = os.Hostname()
+)
+
+// SetReporter makes r the reporter used by Notify
+func SetReporter(r Reporter) {
+	mu.Lock()
+	current = r
+	mu.Unlock()
+	logging.Infof("Reporting errors to %s", r.Name())
+}
+
+// CurrentReporter returns the reporter used by Notify
+func CurrentReporter() Reporter {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// Notify completes the report from req, which may be nil, and sends it to the
+// configured reporter. Failure to report is logged rather than returned, so
+// callers can carry on handling the original error.
+func Notify(req *http.Request, r Report) {
+	if r.Message == "" && r.Err != nil {
+		r.Message = r.Err.Error()
+	}
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	r.Host = hostname
+	r.Environment = Environment
+	if req != nil {
+		r.request = req
+		r.Request = &RequestInfo{
+			Method:     req.Method,
+			URL:        req.URL.String(),
+			RemoteAddr: req.RemoteAddr,
+			UserAgent:  req.UserAgent(),
+		}
+	}
+	reporter := CurrentReporter()
+	err := reporter.Report(r)
+	if err != nil {
+		logging.Errorf("Error reporter %s failed to report %s: %s", reporter.Name(), r.Class, err)
+	}
+}
+
+// describe returns the message with the pod and sentinel appended, for
+// backends with no place to put them
+func (r Report) describe() string {
+	msg := r.Message
+	if r.Pod > "" {
+		msg += fmt.Sprintf(" pod=%s", r.Pod)
+	}
+	if r.Sentinel > "" {
+		msg += fmt.Sprintf(" sentinel=%s", r.Sentinel)
+	}
+	return msg
+}
@@ -0,0 +1,65 @@
+// Package events distributes pod and sentinel events to the subsystems
+// interested in them, such as webhook notification.
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-shared/logging"
+)
+
+// Handler is called for every published event
+type Handler func(common.Event)
+
+var (
+	mu       sync.RWMutex
+	handlers = make(map[int]Handler)
+	nextID   int
+)
+
+// Subscribe registers a handler to be called for every event published from
+// now on. Calling the returned function unsubscribes it.
+func Subscribe(h Handler) (cancel func()) {
+	mu.Lock()
+	id := nextID
+	nextID++
+	handlers[id] = h
+	mu.Unlock()
+	return func() {
+		mu.Lock()
+		delete(handlers, id)
+		mu.Unlock()
+	}
+}
+
+// Publish sends the event to every subscriber and records it in the history.
+// The ID and Time are filled in if missing. Handlers are called in their own
+// goroutine so a slow one does not hold up the caller.
+func Publish(e common.Event) {
+	if e.ID == "" {
+		e.ID = newID()
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if e.Severity == "" {
+		e.Severity = common.SeverityInfo
+	}
+	logging.Pod(e.Pod).Infof("Event %s [%s]: %s", e.Type, e.Severity, e.Message)
+	remember(e)
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, h := range handlers {
+		go h(e)
+	}
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,69 @@
+package events
+
+import (
+	"path"
+	"sync"
+	"time"
+
+	"github.com/therealbill/redskull/redskull-controller/common"
+)
+
+// maxHistory is how many published events are kept in memory
+const maxHistory = 1000
+
+var (
+	historyMu sync.RWMutex
+	history   []common.Event
+)
+
+// Filter selects events from the history. Type and Pod are glob patterns and
+// empty fields match everything.
+type Filter struct {
+	Type        string
+	Pod         string
+	MinSeverity string
+	Since       time.Time
+}
+
+// Matches returns true if the event passes the filter
+func (f Filter) Matches(e common.Event) bool {
+	if f.Type != "" {
+		if ok, _ := path.Match(f.Type, e.Type); !ok {
+			return false
+		}
+	}
+	if f.Pod != "" {
+		if ok, _ := path.Match(f.Pod, e.Pod); !ok {
+			return false
+		}
+	}
+	if f.MinSeverity != "" && common.SeverityRank(e.Severity) < common.SeverityRank(f.MinSeverity) {
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	return true
+}
+
+func remember(e common.Event) {
+	historyMu.Lock()
+	history = append(history, e)
+	if len(history) > maxHistory {
+		history = history[len(history)-maxHistory:]
+	}
+	historyMu.Unlock()
+}
+
+// History returns the recent events matching the filter, newest first
+func History(f Filter) []common.Event {
+	historyMu.RLock()
+	defer historyMu.RUnlock()
+	list := []common.Event{}
+	for i := len(history) - 1; i >= 0; i-- {
+		if f.Matches(history[i]) {
+			list = append(list, history[i])
+		}
+	}
+	return list
+}
@@ -0,0 +1,353 @@
+package events
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-shared/logging"
+)
+
+// maxDeliveryLog is how many delivery attempts are kept in memory
+const maxDeliveryLog = 500
+
+// maxBackoff caps the delay between delivery attempts
+const maxBackoff = time.Minute
+
+// WebhookSink is an endpoint events are POSTed to. Events, Pods and
+// MinSeverity filter which events are sent: Events and Pods are lists of
+// glob patterns matched against the event type and pod name, and an empty
+// list matches everything. Template is a text/template rendering the JSON
+// body from the event; by default the event itself is sent. When Secret is
+// set the body is signed with HMAC-SHA256 in the X-Redskull-Signature header.
+type WebhookSink struct {
+	Name        string            `json:"name" yaml:"name"`
+	URL         string            `json:"url" yaml:"url"`
+	Events      []string          `json:"events,omitempty" yaml:"events,omitempty"`
+	Pods        []string          `json:"pods,omitempty" yaml:"pods,omitempty"`
+	MinSeverity string            `json:"minSeverity,omitempty" yaml:"minSeverity,omitempty"`
+	Template    string            `json:"template,omitempty" yaml:"template,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Secret      string            `json:"secret,omitempty" yaml:"secret,omitempty"`
+	MaxAttempts int               `json:"maxAttempts,omitempty" yaml:"maxAttempts,omitempty"`
+	Timeout     string            `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+// WebhookConfig is the webhook configuration file
+type WebhookConfig struct {
+	Sinks []WebhookSink `json:"sinks" yaml:"sinks"`
+}
+
+// Delivery records one attempt to deliver an event to a sink
+type Delivery struct {
+	Event     string
+	EventType string
+	Pod       string
+	Sink      string
+	Attempt   int
+	Time      time.Time
+	Status    int
+	Error     string
+	Delivered bool
+}
+
+// Matches returns true if the sink's filters accept the event
+func (s WebhookSink) Matches(e common.Event) bool {
+	if !globMatch(s.Events, e.Type) {
+		return false
+	}
+	if !globMatch(s.Pods, e.Pod) {
+		return false
+	}
+	if s.MinSeverity != "" && common.SeverityRank(e.Severity) < common.SeverityRank(s.MinSeverity) {
+		return false
+	}
+	return true
+}
+
+func globMatch(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadWebhookConfig reads a YAML or JSON webhook configuration file
+func LoadWebhookConfig(file string) (cfg WebhookConfig, err error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return cfg, err
+	}
+	err = common.ParseConfig(data, &cfg)
+	if err != nil {
+		return cfg, fmt.Errorf("Unable to parse webhook config: %s", err)
+	}
+	return cfg, nil
+}
+
+// Webhooks is the dispatcher set up from the configuration, or nil if no
+// webhooks are configured
+var Webhooks *Dispatcher
+
+// EnableWebhooks makes d the active dispatcher and subscribes it to events
+func EnableWebhooks(d *Dispatcher) {
+	Webhooks = d
+	Subscribe(d.Handle)
+}
+
+// webhook is a sink ready for delivery
+type webhook struct {
+	WebhookSink
+	tmpl    *template.Template
+	timeout time.Duration
+}
+
+// Dispatcher delivers events to the configured webhook sinks, retrying
+// failed deliveries with exponential backoff, and keeps a log of every
+// delivery attempt.
+type Dispatcher struct {
+	sync.Mutex
+	sinks      []*webhook
+	deliveries []Delivery
+	logFile    string
+	backoff    time.Duration
+}
+
+// NewDispatcher validates the configuration and returns a dispatcher for it.
+// If logFile is set every delivery attempt is also appended to it as a line
+// of JSON.
+func NewDispatcher(cfg WebhookConfig, logFile string) (*Dispatcher, error) {
+	d := &Dispatcher{logFile: logFile, backoff: time.Second}
+	seen := make(map[string]bool)
+	for i, sink := range cfg.Sinks {
+		if sink.Name == "" {
+			return nil, fmt.Errorf("Webhook #%d has no name", i+1)
+		}
+		if seen[sink.Name] {
+			return nil, fmt.Errorf("Webhook '%s' is listed more than once", sink.Name)
+		}
+		seen[sink.Name] = true
+		u, err := url.Parse(sink.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("Webhook '%s' needs an http or https url", sink.Name)
+		}
+		if sink.MinSeverity != "" && common.SeverityRank(sink.MinSeverity) == 0 {
+			return nil, fmt.Errorf("Webhook '%s' has unknown minSeverity '%s'", sink.Name, sink.MinSeverity)
+		}
+		for _, pattern := range append(append([]string{}, sink.Events...), sink.Pods...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("Webhook '%s' has invalid pattern '%s'", sink.Name, pattern)
+			}
+		}
+		wh := &webhook{WebhookSink: sink, timeout: 5 * time.Second}
+		if sink.MaxAttempts < 1 {
+			wh.MaxAttempts = 5
+		}
+		if sink.Timeout != "" {
+			wh.timeout, err = time.ParseDuration(sink.Timeout)
+			if err != nil {
+				return nil, fmt.Errorf("Webhook '%s' has invalid timeout: %s", sink.Name, err)
+			}
+		}
+		if sink.Template != "" {
+			wh.tmpl, err = template.New(sink.Name).Funcs(templateFuncs).Parse(sink.Template)
+			if err != nil {
+				return nil, fmt.Errorf("Webhook '%s' has an invalid template: %s", sink.Name, err)
+			}
+		}
+		d.sinks = append(d.sinks, wh)
+	}
+	return d, nil
+}
+
+// templateFuncs are available to payload templates. json renders a value as
+// JSON, so strings are quoted and escaped.
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"upper": strings.ToUpper,
+}
+
+// Handle delivers the event to every sink whose filters match it
+func (d *Dispatcher) Handle(e common.Event) {
+	for _, wh := range d.sinks {
+		if wh.Matches(e) {
+			go d.deliver(wh, e)
+		}
+	}
+}
+
+// Test sends a test event to the named sink and waits for the outcome
+func (d *Dispatcher) Test(name string) error {
+	for _, wh := range d.sinks {
+		if wh.Name != name {
+			continue
+		}
+		e := common.Event{
+			ID:       newID(),
+			Type:     common.EventTest,
+			Severity: common.SeverityInfo,
+			Message:  "Test event from RedSkull",
+			Time:     time.Now(),
+		}
+		if d.deliver(wh, e) {
+			return nil
+		}
+		return fmt.Errorf("Delivery to webhook '%s' failed, see the delivery log", name)
+	}
+	return fmt.Errorf("No webhook named '%s'", name)
+}
+
+// Sinks returns the configured sinks with their secrets and headers masked
+func (d *Dispatcher) Sinks() []WebhookSink {
+	var sinks []WebhookSink
+	for _, wh := range d.sinks {
+		sink := wh.WebhookSink
+		sink.Secret = common.MaskSecret(sink.Secret)
+		if len(sink.Headers) > 0 {
+			masked := make(map[string]string)
+			for k, v := range sink.Headers {
+				masked[k] = common.MaskSecret(v)
+			}
+			sink.Headers = masked
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks
+}
+
+// Deliveries returns the most recent delivery attempts, newest first
+func (d *Dispatcher) Deliveries() []Delivery {
+	d.Lock()
+	defer d.Unlock()
+	list := make([]Delivery, 0, len(d.deliveries))
+	for i := len(d.deliveries) - 1; i >= 0; i-- {
+		list = append(list, d.deliveries[i])
+	}
+	return list
+}
+
+// deliver POSTs the event to the sink, retrying with exponential backoff on
+// network errors, 5xx and 429 responses. It returns true once delivered.
+func (d *Dispatcher) deliver(wh *webhook, e common.Event) bool {
+	body, err := wh.payload(e)
+	if err != nil {
+		d.record(Delivery{Event: e.ID, EventType: e.Type, Pod: e.Pod, Sink: wh.Name, Attempt: 1, Time: time.Now(), Error: err.Error()})
+		return false
+	}
+	client := &http.Client{Timeout: wh.timeout}
+	wait := d.backoff
+	for attempt := 1; attempt <= wh.MaxAttempts; attempt++ {
+		rec := Delivery{Event: e.ID, EventType: e.Type, Pod: e.Pod, Sink: wh.Name, Attempt: attempt, Time: time.Now()}
+		retry := true
+		status, err := wh.post(client, body)
+		rec.Status = status
+		switch {
+		case err != nil:
+			rec.Error = err.Error()
+		case status >= 200 && status < 300:
+			rec.Delivered = true
+		default:
+			rec.Error = fmt.Sprintf("endpoint returned %d", status)
+			retry = status >= 500 || status == http.StatusTooManyRequests
+		}
+		d.record(rec)
+		if rec.Delivered {
+			return true
+		}
+		if !retry || attempt == wh.MaxAttempts {
+			break
+		}
+		time.Sleep(wait)
+		wait *= 2
+		if wait > maxBackoff {
+			wait = maxBackoff
+		}
+	}
+	logging.Errorf("Giving up delivering event %s (%s) to webhook '%s'", e.ID, e.Type, wh.Name)
+	return false
+}
+
+func (wh *webhook) payload(e common.Event) ([]byte, error) {
+	if wh.tmpl == nil {
+		return json.Marshal(e)
+	}
+	var buf bytes.Buffer
+	err := wh.tmpl.Execute(&buf, e)
+	if err != nil {
+		return nil, fmt.Errorf("template error: %s", err)
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, errors.New("template did not produce valid JSON")
+	}
+	return buf.Bytes(), nil
+}
+
+func (wh *webhook) post(client *http.Client, body []byte) (int, error) {
+	req, err := http.NewRequest("POST", wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "RedSkull-Webhook")
+	for k, v := range wh.Headers {
+		req.Header.Set(k, v)
+	}
+	if wh.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(wh.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Redskull-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// record adds the attempt to the delivery log
+func (d *Dispatcher) record(rec Delivery) {
+	if !rec.Delivered {
+		logging.Warnf("Webhook '%s' attempt %d for event %s failed: %s", rec.Sink, rec.Attempt, rec.Event, rec.Error)
+	}
+	d.Lock()
+	d.deliveries = append(d.deliveries, rec)
+	if len(d.deliveries) > maxDeliveryLog {
+		d.deliveries = d.deliveries[len(d.deliveries)-maxDeliveryLog:]
+	}
+	d.Unlock()
+	if d.logFile == "" {
+		return
+	}
+	line, _ := json.Marshal(rec)
+	f, err := os.OpenFile(d.logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		logging.Errorf("Unable to write webhook delivery log: %s", err)
+		return
+	}
+	defer f.Close()
+	f.Write(append(line, '\n'))
+}
@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -11,16 +10,18 @@ import (
 	"io/ioutil"
 
 	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-shared/logging"
 	"github.com/zenazn/goji/web"
 )
 
 // AddPodHTML is the action target for adding a pod. It does the heavy lifting
 func AddPodHTML(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	// Change to use actions package
-	log.Print("########### ADD POD FORM PROCESSING ###########")
+	logging.Debugf("########### ADD POD FORM PROCESSING ###########")
 	r.ParseForm()
-	log.Print("add pod post called")
-	context, err := NewPageContext()
+	logging.Debugf("add pod post called")
+	context, err := NewPageContext(ctx)
 	checkContextError(err, &w)
 	context.Title = "Pod Add Result"
 	context.ViewTemplate = "podaddpost"
@@ -32,7 +33,7 @@ func AddPodHTML(c web.C, w http.ResponseWriter, r *http.Request) {
 	host := addpair[0]
 	port, err := strconv.Atoi(addpair[1])
 	quorum, _ := strconv.Atoi(r.FormValue("quorum"))
-	log.Printf("Name: %s. Address: %s, Quorum: %d", podname, address, quorum)
+	logging.Pod(podname).Debugf("Name: %s. Address: %s, Quorum: %d", podname, address, quorum)
 	type results struct {
 		Name     string
 		Address  string
@@ -43,9 +44,9 @@ func AddPodHTML(c web.C, w http.ResponseWriter, r *http.Request) {
 		Pod      common.RedisPod
 	}
 	res := results{Name: podname, Address: address, Quorum: quorum}
-	_, err = context.Constellation.MonitorPod(podname, host, port, quorum, auth)
+	_, err = context.Constellation.MonitorPod(ctx, podname, host, port, quorum, auth)
 	if err != nil {
-		log.Printf("Error on addpod: %s", err.Error())
+		logging.Pod(podname).Errorf("Error on addpod: %s", err.Error())
 		res.Error = err.Error()
 		res.HasError = true
 		context.Data = res
@@ -54,9 +55,9 @@ func AddPodHTML(c web.C, w http.ResponseWriter, r *http.Request) {
 	}
 	// I hate this, just here for debugging
 	time.Sleep(25 * time.Millisecond)
-	pod, err := context.Constellation.GetPod(podname)
+	pod, err := context.Constellation.GetPod(ctx, podname)
 	if err != nil {
-		log.Printf("H:MP-> Unable to get newly added pod! Error: %s", err.Error())
+		logging.Op("AddPod").Pod(podname).Errorf("Unable to get newly added pod! Error: %s", err.Error())
 		res.Error = err.Error()
 		res.HasError = true
 	}
@@ -71,35 +72,40 @@ func AddPodHTML(c web.C, w http.ResponseWriter, r *http.Request) {
 	}
 	context.Pod = pod
 	context.Data = res
-	log.Print("########### ADD POD FORM PROCESSED ###########")
+	logging.Debugf("########### ADD POD FORM PROCESSED ###########")
 	render(w, context)
 }
 
 // AddPodForm displays the form for adding a pod
 func AddPodForm(c web.C, w http.ResponseWriter, r *http.Request) {
-	context, err := NewPageContext()
+	ctx := r.Context()
+	context, err := NewPageContext(ctx)
 	checkContextError(err, &w)
 	context.Title = "Add Pod to Constellation"
 	context.ViewTemplate = "addpod"
+	context.CSRFToken = CSRFToken(c)
 	render(w, context)
 }
 
 // AddSentinelForm displays the form for adding a sentinel
 func AddSentinelForm(c web.C, w http.ResponseWriter, r *http.Request) {
-	context, err := NewPageContext()
+	ctx := r.Context()
+	context, err := NewPageContext(ctx)
 	checkContextError(err, &w)
 	context.Title = "Add Sentinel to Constellation"
 	context.ViewTemplate = "addsentinel"
+	context.CSRFToken = CSRFToken(c)
 	render(w, context)
 }
 
 // AddSentinelHTML does the heavy lifting of adding a sentinel. It is the
 // action target for the sentinel add form
 func AddSentinelHTML(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	// Change to use actions package
-	log.Print("########### ADD SENTINEL FORM PROCESSING ###########")
+	logging.Debugf("########### ADD SENTINEL FORM PROCESSING ###########")
 	r.ParseForm()
-	context, err := NewPageContext()
+	context, err := NewPageContext(ctx)
 	checkContextError(err, &w)
 	context.Title = "Sentinel Add Result"
 	context.ViewTemplate = "sentineladdpost"
@@ -116,9 +122,9 @@ func AddSentinelHTML(c web.C, w http.ResponseWriter, r *http.Request) {
 		HasError bool
 	}
 	res := results{Name: name, Address: address}
-	err = context.Constellation.AddSentinelByAddress(address)
+	err = context.Constellation.AddSentinelByAddress(ctx, address)
 	if err != nil {
-		log.Printf("Error on addsentinel: %s", err.Error())
+		logging.Errorf("Error on addsentinel: %s", err.Error())
 		res.Error = err.Error()
 		res.HasError = true
 	}
@@ -129,20 +135,21 @@ func AddSentinelHTML(c web.C, w http.ResponseWriter, r *http.Request) {
 		res.HasError = true
 	}
 	context.Data = res
-	log.Print("########### ADD SENTINEL FORM PROCESSED ###########")
+	logging.Debugf("########### ADD SENTINEL FORM PROCESSED ###########")
 	render(w, context)
 }
 
 func AddPodJSON(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	// Change to use actions package
 	var reqdata common.MonitorRequest
-	context, err := NewPageContext()
+	context, err := NewPageContext(ctx)
 	checkContextError(err, &w)
 	body, err := ioutil.ReadAll(r.Body)
 	err = json.Unmarshal(body, &reqdata)
 	if err != nil {
 		retcode, em := throwJSONParseError(r)
-		log.Println(body)
+		logging.Debugf("%s", body)
 		if retcode >= 400 {
 			http.Error(w, em, retcode)
 			return
@@ -159,7 +166,7 @@ func AddPodJSON(c web.C, w http.ResponseWriter, r *http.Request) {
 		PodURL   string
 	}
 	res := results{Name: reqdata.Podname, Address: reqdata.MasterAddress, Port: reqdata.MasterPort, Quorum: reqdata.Quorum}
-	_, err = context.Constellation.MonitorPod(reqdata.Podname, reqdata.MasterAddress, reqdata.MasterPort, reqdata.Quorum, reqdata.AuthToken)
+	_, err = context.Constellation.MonitorPod(ctx, reqdata.Podname, reqdata.MasterAddress, reqdata.MasterPort, reqdata.Quorum, reqdata.AuthToken)
 	if err != nil {
 		res.Error = err.Error()
 		res.HasError = true
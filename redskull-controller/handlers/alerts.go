@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/therealbill/redskull/redskull-controller/actions"
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-shared/auth"
+	"github.com/zenazn/goji/web"
+)
+
+// alertsPage is the data behind the alerts page
+type alertsPage struct {
+	Alerts   []common.Alert
+	Rules    []common.AlertRule
+	Silences []common.Silence
+	Silence  common.SilenceRequest
+}
+
+// ShowAlerts lists the pending and firing alerts, the active silences and
+// the rules, with a form for adding a silence. Query parameters prefill the
+// form.
+func ShowAlerts(c web.C, w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	renderAlerts(c, w, r, common.SilenceRequest{Rule: q.Get("rule"), Pod: q.Get("pod"), Target: q.Get("target"), Duration: "2h"}, nil)
+}
+
+// renderAlerts renders the alerts page with the silence form holding req
+func renderAlerts(c web.C, w http.ResponseWriter, r *http.Request, req common.SilenceRequest, formErr error) {
+	ctx := r.Context()
+	context, err := NewPageContext(ctx)
+	checkContextError(err, &w)
+	context.Title = "Alerts"
+	context.ViewTemplate = "alerts"
+	context.CSRFToken = CSRFToken(c)
+	context.Error = formErr
+	data := alertsPage{Silence: req}
+	if engine := context.Constellation.Alerts; engine != nil {
+		data.Alerts = engine.Alerts()
+		data.Rules = engine.Rules()
+		data.Silences = engine.Silences(time.Now())
+	}
+	context.Data = data
+	if formErr != nil {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	render(w, context)
+}
+
+// SilenceHTML is the action target for the silence form
+func SilenceHTML(c web.C, w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	req := common.SilenceRequest{
+		Rule:     r.FormValue("rule"),
+		Pod:      r.FormValue("pod"),
+		Target:   r.FormValue("target"),
+		Comment:  r.FormValue("comment"),
+		Duration: r.FormValue("duration"),
+	}
+	if _, err := addSilence(c, r, req); err != nil {
+		renderAlerts(c, w, r, req, err)
+		return
+	}
+	http.Redirect(w, r, "/alerts/", http.StatusSeeOther)
+}
+
+// ExpireSilenceHTML ends a silence early
+func ExpireSilenceHTML(c web.C, w http.ResponseWriter, r *http.Request) {
+	if _, err := expireSilence(c, r); err != nil {
+		renderAlerts(c, w, r, common.SilenceRequest{Duration: "2h"}, err)
+		return
+	}
+	http.Redirect(w, r, "/alerts/", http.StatusSeeOther)
+}
+
+// v2ListAlerts lists the pending and firing alerts, firing and most severe
+// first, filtered by state, severity, rule and pod
+func v2ListAlerts(c web.C, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	q := r.URL.Query()
+	state := q.Get("state")
+	if state != "" && state != common.AlertPending && state != common.AlertFiring {
+		return nil, apiError(http.StatusBadRequest, common.ErrCodeInvalidRequest, "state must be %s or %s", common.AlertPending, common.AlertFiring)
+	}
+	severity := q.Get("severity")
+	if severity != "" && common.SeverityRank(severity) == 0 {
+		return nil, apiError(http.StatusBadRequest, common.ErrCodeInvalidRequest, "severity must be info, warning or critical")
+	}
+	rule, err := globQuery(r, "rule")
+	if err != nil {
+		return nil, err
+	}
+	pod, err := globQuery(r, "pod")
+	if err != nil {
+		return nil, err
+	}
+	context, err := v2Context(ctx)
+	if err != nil {
+		return nil, err
+	}
+	alerts := []common.Alert{}
+	if context.Constellation.Alerts != nil {
+		for _, a := range context.Constellation.Alerts.Alerts() {
+			if state != "" && a.State != state {
+				continue
+			}
+			if common.SeverityRank(a.Severity) < common.SeverityRank(severity) {
+				continue
+			}
+			if !globOK(rule, a.Rule) || !globOK(pod, a.Pod) {
+				continue
+			}
+			alerts = append(alerts, a)
+		}
+	}
+	return paginate(r, alerts)
+}
+
+// v2ListAlertRules lists the alert rules being evaluated
+func v2ListAlertRules(c web.C, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	context, err := v2Context(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rules := []common.AlertRule{}
+	if context.Constellation.Alerts != nil {
+		rules = context.Constellation.Alerts.Rules()
+	}
+	return paginate(r, rules)
+}
+
+// v2ReloadAlertRules loads the alert rule file again
+func v2ReloadAlertRules(c web.C, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	context, err := v2Context(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if actions.AlertRuleFile == "" {
+		return nil, apiError(http.StatusConflict, common.ErrCodeInvalidRequest, "No alert rule file is configured")
+	}
+	auth.Audit(c, r, "reload-alert-rules", actions.AlertRuleFile)
+	count, err := context.Constellation.ReloadAlertRules(ctx)
+	if err != nil {
+		return nil, apiError(http.StatusUnprocessableEntity, common.ErrCodeInvalidRequest, "%s", err)
+	}
+	return common.APIResult{Message: fmt.Sprintf("Loaded %d alert rules from %s", count, actions.AlertRuleFile)}, nil
+}
+
+// v2ListSilences lists the silences which have not expired, soonest to
+// expire first
+func v2ListSilences(c web.C, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	context, err := v2Context(ctx)
+	if err != nil {
+		return nil, err
+	}
+	silences := []common.Silence{}
+	if context.Constellation.Alerts != nil {
+		silences = context.Constellation.Alerts.Silences(time.Now())
+	}
+	return paginate(r, silences)
+}
+
+// v2AddSilence silences the alerts matching the request until it expires
+func v2AddSilence(c web.C, r *http.Request) (interface{}, error) {
+	var req common.SilenceRequest
+	if err := decodeBody(r, &req); err != nil {
+		return nil, err
+	}
+	return addSilence(c, r, req)
+}
+
+// v2ExpireSilence ends a silence early
+func v2ExpireSilence(c web.C, r *http.Request) (interface{}, error) {
+	return expireSilence(c, r)
+}
+
+// addSilence validates and stores the silence for both the API and the
+// form, owned by the caller
+func addSilence(c web.C, r *http.Request, req common.SilenceRequest) (common.Silence, error) {
+	ctx := r.Context()
+	silence, err := req.Silence(owner(c), time.Now())
+	if err != nil {
+		return silence, apiError(http.StatusBadRequest, common.ErrCodeInvalidRequest, "%s", err)
+	}
+	context, err := v2Context(ctx)
+	if err != nil {
+		return silence, err
+	}
+	if context.Constellation.Alerts == nil {
+		context.Constellation.StartAlertEngine()
+	}
+	auth.Audit(c, r, "silence", req.Pod)
+	silence, err = context.Constellation.Alerts.AddSilence(silence)
+	if err != nil {
+		return silence, apiError(http.StatusInternalServerError, common.ErrCodeInternal, "Unable to store silence: %s", err)
+	}
+	return silence, nil
+}
+
+// expireSilence removes the silence named by the id URL parameter
+func expireSilence(c web.C, r *http.Request) (common.APIResult, error) {
+	ctx := r.Context()
+	id := c.URLParams["id"]
+	context, err := v2Context(ctx)
+	if err != nil {
+		return common.APIResult{}, err
+	}
+	found := false
+	if context.Constellation.Alerts != nil {
+		auth.Audit(c, r, "expire-silence", id)
+		found, err = context.Constellation.Alerts.ExpireSilence(id)
+		if err != nil {
+			return common.APIResult{}, apiError(http.StatusInternalServerError, common.ErrCodeInternal, "Unable to store silences: %s", err)
+		}
+	}
+	if !found {
+		return common.APIResult{}, apiError(http.StatusNotFound, common.ErrCodeSilenceNotFound, "Silence '%s' not found", id)
+	}
+	return common.APIResult{Message: fmt.Sprintf("Silence %s expired", id)}, nil
+}
@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"reflect"
+	"strconv"
+
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-shared/auth"
+	"github.com/therealbill/redskull/redskull-shared/logging"
+	"github.com/zenazn/goji/web"
+)
+
+// APIv2Prefix is where the v2 API is served
+const APIv2Prefix = "/api/v2"
+
+// Pagination limits for v2 list endpoints
+const (
+	DefaultPageLimit = 100
+	MaxPageLimit     = 1000
+)
+
+// APIError is the error object every failed v2 call returns
+type APIError struct {
+	Status  int `json:"-"`
+	Code    string
+	Message string
+	Details map[string]string `json:",omitempty"`
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// apiError builds an APIError with a formatted message
+func apiError(status int, code, format string, v ...interface{}) *APIError {
+	return &APIError{Status: status, Code: code, Message: fmt.Sprintf(format, v...)}
+}
+
+// V2Response is the envelope of every successful v2 call. Meta is only set
+// on list endpoints.
+type V2Response struct {
+	Data interface{}
+	Meta *common.ListMeta `json:",omitempty"`
+}
+
+// V2ErrorResponse is the envelope of every failed v2 call
+type V2ErrorResponse struct {
+	Error *APIError
+}
+
+// listResult is returned by list handlers so the page details end up in the
+// envelope's Meta
+type listResult struct {
+	items interface{}
+	meta  common.ListMeta
+}
+
+// v2Handler does the work of a v2 call. A returned *APIError is sent as is,
+// any other error is sent as an internal error.
+type v2Handler func(c web.C, r *http.Request) (interface{}, error)
+
+// apiParam documents a query parameter
+type apiParam struct {
+	Name        string
+	Description string
+}
+
+// apiRoute is one v2 endpoint. The routes table is used both to register
+// the handlers and to generate the OpenAPI document, so the two can not
+// drift apart. Stream routes write a text/event-stream of Response items
+// themselves instead of returning an envelope. CSV routes also return their
+// items as text/csv when asked with format=csv.
+type apiRoute struct {
+	ID       string
+	Method   string
+	Path     string
+	Tag      string
+	Summary  string
+	Role     auth.Role
+	Query    []apiParam
+	Body     interface{}
+	Response interface{}
+	List     bool
+	Status   int
+	Handler  v2Handler
+	Stream   web.HandlerFunc
+	CSV      bool
+}
+
+// pageParams are accepted by every list endpoint
+var pageParams = []apiParam{
+	{"limit", fmt.Sprintf("Maximum number of items to return (default %d, at most %d)", DefaultPageLimit, MaxPageLimit)},
+	{"offset", "Number of items to skip"},
+}
+
+// formatParam is accepted by every CSV route
+var formatParam = apiParam{"format", "Response format: json (default) or csv"}
+
+// csvRecord is implemented by the items CSV routes return
+type csvRecord interface {
+	CSVHeader() []string
+	CSVRecord() []string
+}
+
+// RegisterAPIv2 adds the v2 API routes to the mux
+func RegisterAPIv2(m *web.Mux) {
+	for _, route := range apiV2Routes() {
+		var handler web.HandlerFunc = route.serve
+		if route.Stream != nil {
+			handler = route.Stream
+		}
+		if route.Role > auth.Viewer {
+			handler = auth.Require(route.Role, handler)
+		}
+		pattern := APIv2Prefix + route.Path
+		switch route.Method {
+		case "GET":
+			m.Get(pattern, handler)
+		case "POST":
+			m.Post(pattern, handler)
+		case "PUT":
+			m.Put(pattern, handler)
+		case "DELETE":
+			m.Delete(pattern, handler)
+		}
+	}
+	m.Get(APIv2Prefix+"/openapi.json", APIv2OpenAPI)
+}
+
+// serve runs the route's handler and writes the response envelope
+func (route apiRoute) serve(c web.C, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	format := r.URL.Query().Get("format")
+	var data interface{}
+	var err error
+	if route.CSV && format != "" && format != "json" && format != "csv" {
+		err = apiError(http.StatusBadRequest, common.ErrCodeInvalidRequest, "format must be json or csv")
+	} else {
+		data, err = route.Handler(c, r)
+	}
+	if err != nil {
+		apiErr, ok := err.(*APIError)
+		if !ok {
+			logging.Op(route.Method + " " + route.Path).Err(err).Errorf("v2 call failed")
+			apiErr = apiError(http.StatusInternalServerError, common.ErrCodeInternal, "%s", err)
+		}
+		writeV2(w, apiErr.Status, V2ErrorResponse{Error: apiErr})
+		return
+	}
+	status := route.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if route.CSV && format == "csv" {
+		writeCSV(w, status, data)
+		return
+	}
+	response := V2Response{Data: data}
+	if list, ok := data.(listResult); ok {
+		response.Data = list.items
+		response.Meta = &list.meta
+	}
+	writeV2(w, status, response)
+}
+
+func writeV2(w http.ResponseWriter, status int, body interface{}) {
+	packed, err := json.Marshal(body)
+	if err != nil {
+		logging.Errorf("Unable to pack JSON, err:%s", err)
+		status = http.StatusInternalServerError
+		packed = []byte(`{"Error":{"Code":"internal_error","Message":"Unable to encode response"}}`)
+	}
+	w.WriteHeader(status)
+	w.Write(packed)
+}
+
+// writeCSV writes the items of a CSV route, a slice of csvRecord, as
+// text/csv with a header row. The total of a paginated list is sent in the
+// X-Total-Count header.
+func writeCSV(w http.ResponseWriter, status int, data interface{}) {
+	if list, ok := data.(listResult); ok {
+		w.Header().Set("X-Total-Count", strconv.Itoa(list.meta.Total))
+		data = list.items
+	}
+	v := reflect.ValueOf(data)
+	var header csvRecord
+	if v.Kind() == reflect.Slice {
+		header, _ = reflect.Zero(v.Type().Elem()).Interface().(csvRecord)
+	}
+	if header == nil {
+		logging.Errorf("Unable to write %T as CSV", data)
+		writeV2(w, http.StatusInternalServerError, V2ErrorResponse{Error: apiError(http.StatusInternalServerError, common.ErrCodeInternal, "Unable to encode response as CSV")})
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.WriteHeader(status)
+	out := csv.NewWriter(w)
+	out.Write(header.CSVHeader())
+	for i := 0; i < v.Len(); i++ {
+		out.Write(v.Index(i).Interface().(csvRecord).CSVRecord())
+	}
+	out.Flush()
+}
+
+// v2Context returns the constellation context, bound to ctx, or an internal
+// error
+func v2Context(ctx context.Context) (PageContext, error) {
+	context, err := NewPageContext(ctx)
+	if err != nil {
+		return context, apiError(http.StatusServiceUnavailable, common.ErrCodeInternal, "%s", err)
+	}
+	return context, nil
+}
+
+// decodeBody unmarshals the JSON request body into v
+func decodeBody(r *http.Request, v interface{}) error {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return apiError(http.StatusBadRequest, common.ErrCodeInvalidRequest, "Unable to read request body: %s", err)
+	}
+	if len(body) == 0 {
+		return nil
+	}
+	err = json.Unmarshal(body, v)
+	if err != nil {
+		throwJSONParseError(r)
+		return apiError(http.StatusUnprocessableEntity, common.ErrCodeInvalidJSON, "Unable to parse JSON body: %s", err)
+	}
+	return nil
+}
+
+// paginate returns the page of items, a slice, selected by the limit and
+// offset query parameters
+func paginate(r *http.Request, items interface{}) (interface{}, error) {
+	limit, err := queryInt(r, "limit", DefaultPageLimit)
+	if err != nil {
+		return nil, err
+	}
+	if limit < 1 || limit > MaxPageLimit {
+		return nil, apiError(http.StatusBadRequest, common.ErrCodeInvalidRequest, "limit must be between 1 and %d", MaxPageLimit)
+	}
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 {
+		return nil, apiError(http.StatusBadRequest, common.ErrCodeInvalidRequest, "offset must not be negative")
+	}
+	v := reflect.ValueOf(items)
+	total := v.Len()
+	start, end := offset, offset+limit
+	if start > total {
+		start = total
+	}
+	if end > total {
+		end = total
+	}
+	page := reflect.MakeSlice(v.Type(), 0, end-start)
+	page = reflect.AppendSlice(page, v.Slice(start, end))
+	return listResult{items: page.Interface(), meta: common.ListMeta{Total: total, Limit: limit, Offset: offset}}, nil
+}
+
+func queryInt(r *http.Request, name string, def int) (int, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return def, nil
+	}
+	i, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, apiError(http.StatusBadRequest, common.ErrCodeInvalidRequest, "%s must be an integer", name)
+	}
+	return i, nil
+}
+
+// queryBool parses an optional boolean query parameter; set is false when
+// the parameter is absent
+func queryBool(r *http.Request, name string) (value, set bool, err error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return false, false, nil
+	}
+	value, err = strconv.ParseBool(raw)
+	if err != nil {
+		return false, false, apiError(http.StatusBadRequest, common.ErrCodeInvalidRequest, "%s must be true or false", name)
+	}
+	return value, true, nil
+}
+
+// globQuery returns a validated glob pattern from the query parameter
+func globQuery(r *http.Request, name string) (string, error) {
+	pattern := r.URL.Query().Get(name)
+	if pattern == "" {
+		return "", nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return "", apiError(http.StatusBadRequest, common.ErrCodeInvalidRequest, "%s is not a valid pattern", name)
+	}
+	return pattern, nil
+}
+
+// globOK returns true if value matches pattern, or pattern is empty
+func globOK(pattern, value string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(pattern, value)
+	return ok
+}
+
+// owner returns the name of the authenticated user for job records
+func owner(c web.C) string {
+	id, _ := auth.FromContext(c)
+	return id.Name
+}
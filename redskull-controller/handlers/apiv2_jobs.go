@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/therealbill/redskull/redskull-controller/actions"
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-controller/events"
+	"github.com/therealbill/redskull/redskull-shared/logging"
+	"github.com/zenazn/goji/web"
+)
+
+// v2ListJobs lists jobs, newest first, filtered by type, state and pod
+func v2ListJobs(c web.C, r *http.Request) (interface{}, error) {
+	q := r.URL.Query()
+	pod, err := globQuery(r, "pod")
+	if err != nil {
+		return nil, err
+	}
+	jobs := []common.Job{}
+	for _, job := range actions.Jobs.List() {
+		if q.Get("type") != "" && job.Type != q.Get("type") {
+			continue
+		}
+		if q.Get("state") != "" && job.State != q.Get("state") {
+			continue
+		}
+		if !globOK(pod, job.Pod) {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	return paginate(r, jobs)
+}
+
+// v2GetJob returns a single job
+func v2GetJob(c web.C, r *http.Request) (interface{}, error) {
+	job, ok := actions.Jobs.Get(c.URLParams["id"])
+	if !ok {
+		return nil, apiError(http.StatusNotFound, common.ErrCodeJobNotFound, "Job '%s' not found", c.URLParams["id"])
+	}
+	return job, nil
+}
+
+// v2ListEvents lists recent events, newest first
+func v2ListEvents(c web.C, r *http.Request) (interface{}, error) {
+	f, err := eventFilter(r)
+	if err != nil {
+		return nil, err
+	}
+	return paginate(r, events.History(f))
+}
+
+// eventFilter builds an events filter from the query parameters
+func eventFilter(r *http.Request) (f events.Filter, err error) {
+	if f.Type, err = globQuery(r, "type"); err != nil {
+		return f, err
+	}
+	if f.Pod, err = globQuery(r, "pod"); err != nil {
+		return f, err
+	}
+	f.MinSeverity = r.URL.Query().Get("severity")
+	if f.MinSeverity != "" && common.SeverityRank(f.MinSeverity) == 0 {
+		return f, apiError(http.StatusBadRequest, common.ErrCodeInvalidRequest, "severity must be info, warning or critical")
+	}
+	if since := r.URL.Query().Get("since"); since != "" {
+		f.Since, err = time.Parse(time.RFC3339, since)
+		if err != nil {
+			return f, apiError(http.StatusBadRequest, common.ErrCodeInvalidRequest, "since must be an RFC 3339 time")
+		}
+	}
+	return f, nil
+}
+
+// streamBuffer is how many events a slow stream client may fall behind by
+// before events are dropped for it
+const streamBuffer = 64
+
+// streamKeepalive is how often a comment is sent on an idle stream so
+// proxies do not close it
+var streamKeepalive = 30 * time.Second
+
+// v2StreamEvents sends events matching the query's filter as server-sent
+// events until the client goes away
+func v2StreamEvents(c web.C, w http.ResponseWriter, r *http.Request) {
+	f, err := eventFilter(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		apiErr := err.(*APIError)
+		writeV2(w, apiErr.Status, V2ErrorResponse{Error: apiErr})
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		writeV2(w, http.StatusInternalServerError, V2ErrorResponse{Error: apiError(http.StatusInternalServerError, common.ErrCodeInternal, "Streaming is not supported")})
+		return
+	}
+	queue := make(chan common.Event, streamBuffer)
+	cancel := events.Subscribe(func(e common.Event) {
+		if !f.Matches(e) {
+			return
+		}
+		select {
+		case queue <- e:
+		default:
+			logging.Warnf("Event stream to %s is behind, dropping event %s", r.RemoteAddr, e.ID)
+		}
+	})
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	keepalive := time.NewTicker(streamKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		case e := <-queue:
+			packed, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, e.Type, packed)
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/therealbill/redskull/redskull-controller/actions"
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-shared/auth"
+	"github.com/therealbill/redskull/redskull-shared/logging"
+	"github.com/zenazn/goji/web"
+)
+
+// v2ListNodes lists the nodes RedSkull has connected to, filtered by pod and
+// role
+func v2ListNodes(c web.C, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	context, err := v2Context(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pod, err := globQuery(r, "pod")
+	if err != nil {
+		return nil, err
+	}
+	role := r.URL.Query().Get("role")
+	nodes := []common.NodeSummary{}
+	for _, summary := range context.Constellation.NodeSummaries(ctx) {
+		if globOK(pod, summary.Pod) && (role == "" || role == summary.Role) {
+			nodes = append(nodes, summary)
+		}
+	}
+	return paginate(r, nodes)
+}
+
+// v2GetNode returns a node in full, refreshing its data first
+func v2GetNode(c web.C, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	name := c.URLParams["node"]
+	context, err := v2Context(ctx)
+	if err != nil {
+		return nil, err
+	}
+	podname, known := context.Constellation.NodeNameToPodMap[name]
+	if !known {
+		return nil, apiError(http.StatusNotFound, common.ErrCodeNodeNotFound, "Node '%s' is not part of a known pod", name)
+	}
+	node, err := context.Constellation.GetNode(ctx, name, podname, "")
+	if err != nil || node == nil {
+		return nil, apiError(http.StatusBadGateway, common.ErrCodeNodeNotFound, "Unable to connect to node '%s': %v", name, err)
+	}
+	node.UpdateData(ctx)
+	return node, nil
+}
+
+// v2CloneNode clones one Redis node to another as a job
+func v2CloneNode(c web.C, r *http.Request) (interface{}, error) {
+	var req common.CloneRequest
+	if err := decodeBody(r, &req); err != nil {
+		return nil, err
+	}
+	if req.Origin == "" || req.Clone == "" {
+		return nil, apiError(http.StatusBadRequest, common.ErrCodeInvalidRequest, "Origin and Clone are required")
+	}
+	if req.Origin == req.Clone {
+		return nil, apiError(http.StatusBadRequest, common.ErrCodeInvalidRequest, "Can not clone a node to itself")
+	}
+	if req.Role == "" {
+		req.Role = "master"
+	}
+	if req.Reconfig {
+		req.Promote = true
+	}
+	auth.Audit(c, r, "clone-node", req.Origin+" -> "+req.Clone)
+	return actions.Jobs.Start(common.JobClone, "", owner(c), func(ctx context.Context, log *logging.Logger) (interface{}, error) {
+		result := CloneServer(ctx, req.Origin, req.Clone, req.Promote, req.Reconfig, 3.0, req.Role)
+		if result["status"] == "ERROR" {
+			return result, fmt.Errorf("%s", result["error"])
+		}
+		return result, nil
+	}), nil
+}
@@ -0,0 +1,376 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/therealbill/libredis/structures"
+	"github.com/therealbill/redskull/redskull-controller/actions"
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-shared/auth"
+	"github.com/therealbill/redskull/redskull-shared/logging"
+	"github.com/zenazn/goji/web"
+)
+
+// v2Pod returns the named pod or a pod_not_found error
+func v2Pod(ctx context.Context, con *actions.Constellation, podname string) (*common.RedisPod, error) {
+	pod, err := con.GetPod(ctx, podname)
+	if pod == nil || pod.Name == "" {
+		if err != nil {
+			return nil, apiError(http.StatusNotFound, common.ErrCodePodNotFound, "Pod '%s' not found: %s", podname, err)
+		}
+		return nil, apiError(http.StatusNotFound, common.ErrCodePodNotFound, "Pod '%s' not found", podname)
+	}
+	return pod, nil
+}
+
+// v2ListPods lists pods, filtered by name pattern and status
+func v2ListPods(c web.C, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	context, err := v2Context(ctx)
+	if err != nil {
+		return nil, err
+	}
+	name, err := globQuery(r, "name")
+	if err != nil {
+		return nil, err
+	}
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", common.PodStatusOK, common.PodStatusError, common.PodStatusMaintenance:
+	default:
+		return nil, apiError(http.StatusBadRequest, common.ErrCodeInvalidRequest, "status must be ok, error or maintenance")
+	}
+	pods := []common.PodSummary{}
+	for _, summary := range context.Constellation.PodSummaries(ctx) {
+		if globOK(name, summary.Name) && (status == "" || status == summary.Status()) {
+			pods = append(pods, summary)
+		}
+	}
+	return paginate(r, pods)
+}
+
+// v2GetPod returns a pod in full
+func v2GetPod(c web.C, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	context, err := v2Context(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return v2Pod(ctx, context.Constellation, c.URLParams["pod"])
+}
+
+// v2MonitorPod starts monitoring a pod on the constellation's sentinels
+func v2MonitorPod(c web.C, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	var req common.MonitorRequest
+	if err := decodeBody(r, &req); err != nil {
+		return nil, err
+	}
+	req.Podname = c.URLParams["pod"]
+	if req.MasterAddress == "" || req.MasterPort == 0 || req.Quorum < 1 {
+		return nil, apiError(http.StatusBadRequest, common.ErrCodeInvalidRequest, "MasterAddress, MasterPort and Quorum are required")
+	}
+	context, err := v2Context(ctx)
+	if err != nil {
+		return nil, err
+	}
+	auth.Audit(c, r, "monitor-pod", req.Podname)
+	ok, err := context.Constellation.MonitorPod(ctx, req.Podname, req.MasterAddress, req.MasterPort, req.Quorum, req.AuthToken)
+	if !ok {
+		apiErr := apiError(http.StatusBadGateway, common.ErrCodeQuorum, "Pod '%s' failed to reach sentinel quorum", req.Podname)
+		if err != nil {
+			apiErr.Details = map[string]string{"sentinel": err.Error()}
+		}
+		return nil, apiErr
+	}
+	return v2Pod(ctx, context.Constellation, req.Podname)
+}
+
+// v2RemovePod stops monitoring a pod
+func v2RemovePod(c web.C, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	podname := c.URLParams["pod"]
+	context, err := v2Context(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := v2Pod(ctx, context.Constellation, podname); err != nil {
+		return nil, err
+	}
+	auth.Audit(c, r, "remove-pod", podname)
+	ok, err := context.Constellation.RemovePod(ctx, podname)
+	if err != nil || !ok {
+		return nil, apiError(http.StatusBadGateway, common.ErrCodeSentinel, "Unable to remove pod '%s' from every sentinel: %v", podname, err)
+	}
+	return common.APIResult{Message: fmt.Sprintf("Pod '%s' removed", podname)}, nil
+}
+
+// v2Failover starts a failover of the pod
+func v2Failover(c web.C, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	var req common.FailoverOptions
+	if err := decodeBody(r, &req); err != nil {
+		return nil, err
+	}
+	podname := c.URLParams["pod"]
+	context, err := v2Context(ctx)
+	if err != nil {
+		return nil, err
+	}
+	auth.Audit(c, r, "failover", podname)
+	ok, err := context.Constellation.Failover(ctx, podname, req.Force)
+	if err != nil || !ok {
+		return nil, failoverAPIError(podname, r, err)
+	}
+	return common.APIResult{Message: "Failover command accepted"}, nil
+}
+
+// failoverAPIError converts a failover failure into a v2 error
+func failoverAPIError(podname string, r *http.Request, err error) *APIError {
+	retcode, msg := handleFailoverError(podname, r, err)
+	switch {
+	case err == actions.ErrPodInMaintenance:
+		return apiError(http.StatusConflict, common.ErrCodeInMaintenance, "%s", msg)
+	case retcode == http.StatusNotFound:
+		return apiError(http.StatusNotFound, common.ErrCodePodNotFound, "%s", msg)
+	case strings.Contains(msg, "INPROG") || retcode == 420:
+		return apiError(http.StatusConflict, common.ErrCodeFailoverInProgress, "%s", msg)
+	case strings.Contains(msg, "NOGOODSLAVE"):
+		return apiError(http.StatusConflict, common.ErrCodeNoGoodSlave, "No suitable slave to promote")
+	}
+	return apiError(http.StatusBadGateway, common.ErrCodeSentinel, "%s", msg)
+}
+
+// v2ResetPod resets the pod on its sentinels as a job
+func v2ResetPod(c web.C, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	var req common.ResetOptions
+	if err := decodeBody(r, &req); err != nil {
+		return nil, err
+	}
+	podname := c.URLParams["pod"]
+	context, err := v2Context(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := v2Pod(ctx, context.Constellation, podname); err != nil {
+		return nil, err
+	}
+	auth.Audit(c, r, "reset-pod", podname)
+	return actions.Jobs.Start(common.JobReset, podname, owner(c), resetPodJob(context.Constellation, podname, req.Simultaneous)), nil
+}
+
+// resetPodJob returns the job run by v2ResetPod
+func resetPodJob(con *actions.Constellation, podname string, simultaneous bool) actions.JobFunc {
+	return func(ctx context.Context, log *logging.Logger) (interface{}, error) {
+		con.Acquire()
+		defer con.Release()
+		con.ResetPod(ctx, podname, simultaneous)
+		return common.APIResult{Message: fmt.Sprintf("Pod '%s' reset", podname)}, nil
+	}
+}
+
+// v2BalancePod brings the pod's sentinel count to what it needs as a job
+func v2BalancePod(c web.C, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	var req common.BalanceOptions
+	if err := decodeBody(r, &req); err != nil {
+		return nil, err
+	}
+	podname := c.URLParams["pod"]
+	context, err := v2Context(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pod, err := v2Pod(ctx, context.Constellation, podname)
+	if err != nil {
+		return nil, err
+	}
+	if !req.Force && context.Constellation.InMaintenance(podname) {
+		return nil, apiError(http.StatusConflict, common.ErrCodeInMaintenance, "%s", actions.ErrPodInMaintenance)
+	}
+	auth.Audit(c, r, "balance-pod", podname)
+	return actions.Jobs.Start(common.JobBalance, podname, owner(c), balancePodJob(context.Constellation, pod, req.Force)), nil
+}
+
+// balancePodJob returns the job run by v2BalancePod
+func balancePodJob(con *actions.Constellation, pod *common.RedisPod, force bool) actions.JobFunc {
+	return func(ctx context.Context, log *logging.Logger) (interface{}, error) {
+		con.Acquire()
+		defer con.Release()
+		err := con.BalancePod(ctx, pod, force)
+		if err != nil {
+			return nil, err
+		}
+		return common.APIResult{Message: fmt.Sprintf("Pod '%s' balanced", pod.Name)}, nil
+	}
+}
+
+// v2GetMaster returns the pod's current master as reported by its sentinels
+func v2GetMaster(c web.C, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	podname := c.URLParams["pod"]
+	context, err := v2Context(ctx)
+	if err != nil {
+		return nil, err
+	}
+	master, err := context.Constellation.GetMaster(ctx, podname)
+	if err != nil {
+		return nil, apiError(http.StatusBadGateway, common.ErrCodeSentinel, "%s", err)
+	}
+	if master.Host == "" {
+		return nil, apiError(http.StatusNotFound, common.ErrCodePodNotFound, "No master found for pod '%s'", podname)
+	}
+	return master, nil
+}
+
+// v2GetSlaves lists the pod's slaves as reported by its sentinels
+func v2GetSlaves(c web.C, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	podname := c.URLParams["pod"]
+	context, err := v2Context(ctx)
+	if err != nil {
+		return nil, err
+	}
+	slaves, err := context.Constellation.GetSlaves(ctx, podname)
+	if err != nil {
+		return nil, apiError(http.StatusBadGateway, common.ErrCodeSentinel, "%s", err)
+	}
+	if slaves == nil {
+		slaves = []structures.SlaveInfo{}
+	}
+	return paginate(r, slaves)
+}
+
+// v2GetPodSentinels lists the sentinels monitoring the pod
+func v2GetPodSentinels(c web.C, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	podname := c.URLParams["pod"]
+	context, err := v2Context(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := v2Pod(ctx, context.Constellation, podname); err != nil {
+		return nil, err
+	}
+	sentinels := []common.SentinelSummary{}
+	for _, s := range context.Constellation.GetSentinelsForPod(ctx, podname) {
+		sentinels = append(sentinels, context.Constellation.SummarizeSentinel(ctx, s))
+	}
+	return paginate(r, sentinels)
+}
+
+// v2GetPodTopology checks the pod's replication topology
+func v2GetPodTopology(c web.C, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	podname := c.URLParams["pod"]
+	context, err := v2Context(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report, err := context.Constellation.CheckPodTopology(ctx, podname)
+	if err != nil {
+		return nil, apiError(http.StatusBadGateway, common.ErrCodeSentinel, "%s", err)
+	}
+	return report, nil
+}
+
+// v2GetPodMaintenance returns the pod's maintenance window
+func v2GetPodMaintenance(c web.C, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	podname := c.URLParams["pod"]
+	context, err := v2Context(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m, in := context.Constellation.GetPodMaintenance(podname)
+	if !in {
+		return nil, apiError(http.StatusNotFound, common.ErrCodeNotFound, "Pod '%s' is not in maintenance", podname)
+	}
+	return m, nil
+}
+
+// v2SetPodMaintenance places the pod into maintenance
+func v2SetPodMaintenance(c web.C, r *http.Request) (interface{}, error) {
+	var req common.MaintenanceRequest
+	if err := decodeBody(r, &req); err != nil {
+		return nil, err
+	}
+	req.Podname = c.URLParams["pod"]
+	m, err := setMaintenance(c, r, req)
+	if err != nil {
+		return nil, apiError(http.StatusBadRequest, common.ErrCodeInvalidRequest, "%s", err)
+	}
+	return m, nil
+}
+
+// v2ClearPodMaintenance takes the pod out of maintenance
+func v2ClearPodMaintenance(c web.C, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	podname := c.URLParams["pod"]
+	context, err := v2Context(ctx)
+	if err != nil {
+		return nil, err
+	}
+	auth.Audit(c, r, "clear-maintenance", podname)
+	err = context.Constellation.ClearPodMaintenance(ctx, podname)
+	if err != nil {
+		return nil, err
+	}
+	return common.APIResult{Message: fmt.Sprintf("Pod '%s' is out of maintenance", podname)}, nil
+}
+
+// v2AddSlave makes a Redis instance a slave of the pod's master
+func v2AddSlave(c web.C, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	var req common.AddSlaveRequest
+	if err := decodeBody(r, &req); err != nil {
+		return nil, err
+	}
+	req.Podname = c.URLParams["pod"]
+	if req.SlaveAddress == "" || req.SlavePort == 0 {
+		return nil, apiError(http.StatusBadRequest, common.ErrCodeInvalidRequest, "SlaveAddress and SlavePort are required")
+	}
+	context, err := v2Context(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := v2Pod(ctx, context.Constellation, req.Podname); err != nil {
+		return nil, err
+	}
+	slave := fmt.Sprintf("%s:%d", req.SlaveAddress, req.SlavePort)
+	auth.Audit(c, r, "add-slave", req.Podname+" "+slave)
+	err = context.Constellation.AddSlaveToPod(ctx, req.Podname, req.SlaveAddress, req.SlavePort, req.SlaveAuth)
+	switch {
+	case err == actions.ErrAlreadySlave:
+		return nil, apiError(http.StatusConflict, common.ErrCodeAlreadySlave, "%s is already a slave of pod '%s'", slave, req.Podname)
+	case err != nil:
+		return nil, apiError(http.StatusBadGateway, common.ErrCodeNodeUnreachable, "%s", err)
+	}
+	return common.APIResult{Message: fmt.Sprintf("Slave %s added to pod '%s'", slave, req.Podname)}, nil
+}
+
+// v2RemoveSlave detaches a slave from the pod
+func v2RemoveSlave(c web.C, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	podname, slave := c.URLParams["pod"], c.URLParams["slave"]
+	context, err := v2Context(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := v2Pod(ctx, context.Constellation, podname); err != nil {
+		return nil, err
+	}
+	auth.Audit(c, r, "remove-slave", podname+" "+slave)
+	err = context.Constellation.RemoveSlaveFromPod(ctx, podname, slave)
+	switch {
+	case err == actions.ErrNotSlaveOfPod:
+		return nil, apiError(http.StatusNotFound, common.ErrCodeNotSlave, "%s is not a slave of pod '%s'", slave, podname)
+	case err != nil:
+		return nil, apiError(http.StatusBadGateway, common.ErrCodeNodeUnreachable, "%s", err)
+	}
+	return common.APIResult{Message: fmt.Sprintf("Slave %s removed from pod '%s'", slave, podname)}, nil
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-shared/auth"
+	"github.com/zenazn/goji/web"
+)
+
+// v2ListSentinels lists the known sentinels, filtered by name pattern
+func v2ListSentinels(c web.C, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	context, err := v2Context(ctx)
+	if err != nil {
+		return nil, err
+	}
+	name, err := globQuery(r, "name")
+	if err != nil {
+		return nil, err
+	}
+	sentinels := []common.SentinelSummary{}
+	for _, s := range context.Constellation.SentinelSummaries(ctx) {
+		if globOK(name, s.Name) {
+			sentinels = append(sentinels, s)
+		}
+	}
+	return paginate(r, sentinels)
+}
+
+// v2GetSentinel returns a single sentinel
+func v2GetSentinel(c web.C, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	name := c.URLParams["sentinel"]
+	context, err := v2Context(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range context.Constellation.GetAllSentinelsQuietly(ctx) {
+		if s.Name == name {
+			return context.Constellation.SummarizeSentinel(ctx, s), nil
+		}
+	}
+	return nil, apiError(http.StatusNotFound, common.ErrCodeSentinelNotFound, "Sentinel '%s' not found", name)
+}
+
+// v2AddSentinel adds a sentinel to the constellation
+func v2AddSentinel(c web.C, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	var req common.AddSentinelRequest
+	if err := decodeBody(r, &req); err != nil {
+		return nil, err
+	}
+	if req.Address == "" {
+		return nil, apiError(http.StatusBadRequest, common.ErrCodeInvalidRequest, "Address is required")
+	}
+	context, err := v2Context(ctx)
+	if err != nil {
+		return nil, err
+	}
+	auth.Audit(c, r, "add-sentinel", req.Address)
+	err = context.Constellation.AddSentinelByAddress(ctx, req.Address)
+	if err != nil {
+		return nil, apiError(http.StatusBadGateway, common.ErrCodeSentinel, "Unable to add sentinel '%s': %s", req.Address, err)
+	}
+	return common.APIResult{Message: fmt.Sprintf("Sentinel '%s' added", req.Address)}, nil
+}
@@ -1,10 +1,10 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -13,6 +13,7 @@ import (
 	"github.com/pborman/uuid"
 	"github.com/therealbill/libredis/client"
 	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-shared/logging"
 	"github.com/zenazn/goji/web"
 )
 
@@ -27,7 +28,7 @@ func Clone(c web.C, w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		fmt.Fprint(w, "ohnos unmarshal error")
 	}
-	log.Printf("%+v", reqdata)
+	logging.Debugf("%+v", reqdata)
 	if err != nil {
 		panic("ohnoes")
 	}
@@ -46,13 +47,15 @@ func Clone(c web.C, w http.ResponseWriter, r *http.Request) {
 		promoteClone = true
 	}
 
-	data := CloneServer(originAddress, cloneAddress, promoteClone, reconfigureSlaves, 3.0, roleRequired)
+	data := CloneServer(r.Context(), originAddress, cloneAddress, promoteClone, reconfigureSlaves, 3.0, roleRequired)
 	fmt.Fprint(w, data)
 }
 
 // TODO?: rename/copy this to have MigratePodToNewPod and CloneServer ?
 // CloneServer does the heavy lifting to clone one Redis instance to another.
-func CloneServer(originHost, cloneHost string, promoteWhenComplete, reconfigureSlaves bool, syncTimeout float64, roleRequired string) (result map[string]string) {
+// Connections are made within ctx, and the clone stops waiting on the sync
+// or reconfiguring slaves once it ends.
+func CloneServer(ctx context.Context, originHost, cloneHost string, promoteWhenComplete, reconfigureSlaves bool, syncTimeout float64, roleRequired string) (result map[string]string) {
 	// the plan for jobID is to store the job status/ID into a shared storage
 	// (Consul) so API calls can be made to get current state of the job.
 	// TODO: Move the "can I clone" checks into the webrequest call so we can
@@ -75,7 +78,7 @@ func CloneServer(originHost, cloneHost string, promoteWhenComplete, reconfigureS
 	 */
 
 	if cloneHost == originHost {
-		log.Print("Can not clone a host to itself, aborting")
+		logging.Warnf("Can not clone a host to itself, aborting")
 		result["status"] = "ERROR"
 		result["error"] = "Can not clone a node to itself"
 		return
@@ -83,58 +86,58 @@ func CloneServer(originHost, cloneHost string, promoteWhenComplete, reconfigureS
 
 	// Connect to the Origin node
 	originConf := client.DialConfig{Address: originHost}
-	origin, err := client.DialWithConfig(&originConf)
+	origin, err := common.Dial(ctx, originConf)
 	if err != nil {
-		log.Println("Unable to connect to origin", err)
+		logging.Errorf("Unable to connect to origin %s", err)
 		result["status"] = "ERROR"
 		result["error"] = "Unable to connect to origin"
 		return
 	} else {
-		log.Print("Connection to origin confirmed")
+		logging.Debugf("Connection to origin confirmed")
 	}
 	// obtain node information
 	info, err := origin.Info()
 	role := info.Replication.Role
 	if err != nil {
-		log.Printf("Unable to get the role of the origin instance")
+		logging.Errorf("Unable to get the role of the origin instance")
 		result["status"] = "ERROR"
 		result["error"] = "Unable to get replication role for origin"
 		return
 	}
 
-	log.Print("Role:", role)
+	logging.Debugf("Role:%s", role)
 	// verify the role we get matches our condition for a backup
 	switch role {
 	case roleRequired:
-		log.Print("acceptable role confirmed, now to perform a clone...")
+		logging.Debugf("acceptable role confirmed, now to perform a clone...")
 	default:
-		log.Print("Role mismatch, no clone will be performed")
+		logging.Debugf("Role mismatch, no clone will be performed")
 		result["status"] = "ERROR"
 		result["error"] = "Role requirement not met"
 		return
 	}
 	// Now connect to the clone ...
 	cloneConf := client.DialConfig{Address: cloneHost}
-	clone, err := client.DialWithConfig(&cloneConf)
+	clone, err := common.Dial(ctx, cloneConf)
 	if err != nil {
-		log.Println("Unable to connect to clone")
+		logging.Errorf("Unable to connect to clone")
 		result["status"] = "ERROR"
 		result["error"] = "Unable to connect to clone target"
 		return
 	} else {
-		log.Print("Connection to clone confirmed")
+		logging.Debugf("Connection to clone confirmed")
 	}
 	clone.Info()
 
 	oconfig, err := origin.ConfigGet("*")
 	if err != nil {
-		log.Println("Unable to get origin config, aborting on err:", err)
+		logging.Errorf("Unable to get origin config, aborting on err: %s", err)
 		result["status"] = "ERROR"
 		result["error"] = "Unable to get config from origin"
 		return
 	}
 	// OK, now we are ready to start cloning
-	log.Print("Cloning config")
+	logging.Debugf("Cloning config")
 	for k, v := range oconfig {
 		// slaveof is not clone-able and is set separately, so skip it
 		if k == "slaveof" {
@@ -143,48 +146,48 @@ func CloneServer(originHost, cloneHost string, promoteWhenComplete, reconfigureS
 		err := clone.ConfigSet(k, v)
 		if err != nil {
 			if !strings.Contains(err.Error(), "Unsupported CONFIG parameter") {
-				log.Printf("Unable to set key '%s' to val '%s' on clone due to Error '%s'\n", k, v, err)
+				logging.Errorf("Unable to set key '%s' to val '%s' on clone due to Error '%s'", k, v, err)
 			}
 		}
 	}
-	log.Print("Config cloned, now syncing data")
+	logging.Infof("Config cloned, now syncing data")
 	switch role {
 	case "slave":
 		// If we are cloning a slave we are assuming it needs to look just like
 		// the others, so we simply clone the settings and slave it to the
 		// origin's master
 		slaveof := strings.Split(oconfig["slaveof"], " ")
-		log.Printf("Need to set clone to slave to %s on port %s\n", slaveof[0], slaveof[1])
+		logging.Infof("Need to set clone to slave to %s on port %s", slaveof[0], slaveof[1])
 		slaveres := clone.SlaveOf(slaveof[0], slaveof[1])
 		if slaveres != nil {
-			log.Printf("Unable to clone slave setting! Error: '%s'\n", slaveres)
+			logging.Errorf("Unable to clone slave setting! Error: '%s'", slaveres)
 		} else {
-			log.Print("Successfully cloned new slave")
+			logging.Infof("Successfully cloned new slave")
 			return
 		}
 	case "master":
 		// master clones can get tricky.
 		// First, slave to the origin nde to get a copy of the data
-		log.Print("Role being cloned is 'master'")
-		log.Print("First, we need to slave to the original master to pull data down")
+		logging.Debugf("Role being cloned is 'master'")
+		logging.Debugf("First, we need to slave to the original master to pull data down")
 		slaveof := strings.Split(originHost, ":")
 		slaveres := clone.SlaveOf(slaveof[0], slaveof[1])
 		if slaveres != nil {
 			if !strings.Contains(slaveres.Error(), "Already connected") {
-				log.Printf("Unable to slave clone to origin! Error: '%s'\n", slaveres)
-				log.Print("Aborting clone so you can investigate why.")
+				logging.Errorf("Unable to slave clone to origin! Error: '%s'", slaveres)
+				logging.Errorf("Aborting clone so you can investigate why.")
 				return
 			}
 		}
-		log.Printf("Successfully cloned to %s:%s\n", slaveof[0], slaveof[1])
+		logging.Infof("Successfully cloned to %s:%s", slaveof[0], slaveof[1])
 
 		syncInProgress := true
 		new_info, _ := clone.Info()
 		syncInProgress = new_info.Replication.MasterSyncInProgress || new_info.Replication.MasterLinkStatus == "down"
 		syncTime := 0.0
 		if syncInProgress {
-			log.Print("Sync in progress...")
-			for {
+			logging.Debugf("Sync in progress...")
+			for ctx.Err() == nil {
 				new_info, _ := clone.Info()
 				syncInProgress = new_info.Replication.MasterSyncInProgress || new_info.Replication.MasterLinkStatus == "down"
 				if syncInProgress {
@@ -192,14 +195,14 @@ func CloneServer(originHost, cloneHost string, promoteWhenComplete, reconfigureS
 					if syncTime >= syncTimeout {
 						break
 					}
-					time.Sleep(time.Duration(500) * time.Millisecond)
+					common.Sleep(ctx, time.Duration(500)*time.Millisecond)
 				} else {
 					break
 				}
 			}
 		}
 		if syncInProgress {
-			log.Print("Sync took longer than expected, aborting until this is better handled!")
+			logging.Errorf("Sync took longer than expected, aborting until this is better handled!")
 			result["message"] = "Sync in progress"
 			return
 		}
@@ -207,22 +210,22 @@ func CloneServer(originHost, cloneHost string, promoteWhenComplete, reconfigureS
 		// Next we need to see if we should promote the new clone to a master
 		// this is useful for migrating a master but also for providing a
 		// production clone for dev or testing
-		log.Print("Now checking for slave promotion")
+		logging.Debugf("Now checking for slave promotion")
 		if promoteWhenComplete {
 			promoted := clone.SlaveOf("no", "one")
 			if promoted != nil {
-				log.Print("Was unable to promote clone to master, investigate why!")
+				logging.Errorf("Was unable to promote clone to master, investigate why!")
 				return
 			}
-			log.Print("Promoted clone to master")
+			logging.Infof("Promoted clone to master")
 			// IF we are migrating a master entirely, we want to reconfigure
 			// it's slaves to point to the new master
 			// While it might make sense to promote the clone after slaving,
 			// doing that means writes are lost in between slave migration and
 			// promotion. This gets tricky, which is why by default we don't do it.
 			if !reconfigureSlaves {
-				log.Print("Not instructed to promote existing slaves")
-				log.Print("Clone complete")
+				logging.Warnf("Not instructed to promote existing slaves")
+				logging.Infof("Clone complete")
 				result["status"] = "Complete"
 				return
 			} else {
@@ -230,26 +233,32 @@ func CloneServer(originHost, cloneHost string, promoteWhenComplete, reconfigureS
 				slaveof := strings.Split(cloneHost, ":")
 				desired_port, _ := strconv.Atoi(slaveof[1])
 				for index, data := range info.Replication.Slaves {
-					log.Printf("Reconfiguring slave %d/%d\n", index, info.Replication.ConnectedSlaves)
-					fmt.Printf("Slave data: %+v\n", data)
+					if ctx.Err() != nil {
+						logging.Errorf("Clone interrupted reconfiguring slaves: %s", ctx.Err())
+						result["status"] = "ERROR"
+						result["error"] = ctx.Err().Error()
+						return
+					}
+					logging.Debugf("Reconfiguring slave %d/%d", index, info.Replication.ConnectedSlaves)
+					logging.Debugf("Slave data: %+v", data)
 					slave_connstring := fmt.Sprintf("%s:%d", data.IP, data.Port)
-					slaveconn, err := client.DialWithConfig(&client.DialConfig{Address: slave_connstring})
+					slaveconn, err := common.Dial(ctx, client.DialConfig{Address: slave_connstring})
 					if err != nil {
-						log.Printf("Unable to connect to slave '%s', skipping", slave_connstring)
+						logging.Node(slave_connstring).Errorf("Unable to connect to slave '%s', skipping", slave_connstring)
 						continue
 					}
 					err = slaveconn.SlaveOf(slaveof[0], slaveof[1])
 					if err != nil {
-						log.Printf("Unable to slave %s to clone. Err: '%s'", slave_connstring, err)
+						logging.Node(slave_connstring).Errorf("Unable to slave %s to clone. Err: '%s'", slave_connstring, err)
 						continue
 					}
-					time.Sleep(time.Duration(100) * time.Millisecond) // needed to give the slave time to sync.
+					common.Sleep(ctx, time.Duration(100)*time.Millisecond) // needed to give the slave time to sync.
 					slave_info, _ := slaveconn.Info()
 					if slave_info.Replication.MasterHost == slaveof[0] {
 						if slave_info.Replication.MasterPort == desired_port {
-							log.Printf("Slaved %s to clone", slave_connstring)
+							logging.Node(slave_connstring).Infof("Slaved %s to clone", slave_connstring)
 						} else {
-							log.Print("Hmm, slave settings don't match, look into this on slave", data.IP, data.Port)
+							logging.Warnf("Hmm, slave settings don't match, look into this on slave %s:%v", data.IP, data.Port)
 						}
 					}
 				}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/zenazn/goji/web"
+)
+
+// ConfirmAction describes a destructive pod action awaiting typed
+// confirmation
+type ConfirmAction struct {
+	Title       string
+	Description string
+	Button      string
+	URL         string
+	Pod         string
+	Forceable   bool
+	Maintenance *common.PodMaintenance
+}
+
+// errNotConfirmed is shown when the typed pod name does not match
+var errNotConfirmed = errors.New("The name entered does not match the pod name, nothing was changed")
+
+func failoverConfirmation(podname string) ConfirmAction {
+	return ConfirmAction{
+		Title:       "Force Failover",
+		Description: "This promotes a slave to master. Clients connected to the current master will be disconnected.",
+		Button:      "Force Failover",
+		URL:         fmt.Sprintf("/pod/%s/failover", podname),
+		Pod:         podname,
+		Forceable:   true,
+	}
+}
+
+func resetConfirmation(podname string) ConfirmAction {
+	return ConfirmAction{
+		Title:       "Reset Slaves & Sentinels",
+		Description: "This resets the pod on every sentinel, which then rediscover its slaves and sentinels. The pod is briefly unprotected while they do.",
+		Button:      "Reset Pod",
+		URL:         fmt.Sprintf("/pod/%s/reset", podname),
+		Pod:         podname,
+	}
+}
+
+func removeConfirmation(podname string) ConfirmAction {
+	return ConfirmAction{
+		Title:       "Stop Managing Pod",
+		Description: "This removes the pod from every sentinel. It will no longer be monitored or failed over.",
+		Button:      "Stop Managing",
+		URL:         fmt.Sprintf("/constellation/removepod/%s", podname),
+		Pod:         podname,
+	}
+}
+
+func drillConfirmation(podname string) ConfirmAction {
+	return ConfirmAction{
+		Title:       "Failover Drill",
+		Description: "This fails the pod over, times how long its sentinels and clients take to see the new master, then fails it back to the current master. Clients will be disconnected twice.",
+		Button:      "Run Drill",
+		URL:         fmt.Sprintf("/pod/%s/drill", podname),
+		Pod:         podname,
+	}
+}
+
+// ConfirmFailoverHTML asks the user to confirm a failover
+func ConfirmFailoverHTML(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	renderConfirmation(ctx, c, w, failoverConfirmation(c.URLParams["name"]), nil)
+}
+
+// ConfirmResetHTML asks the user to confirm a pod reset
+func ConfirmResetHTML(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	renderConfirmation(ctx, c, w, resetConfirmation(c.URLParams["name"]), nil)
+}
+
+// ConfirmRemovePodHTML asks the user to confirm removing a pod
+func ConfirmRemovePodHTML(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	renderConfirmation(ctx, c, w, removeConfirmation(c.URLParams["podname"]), nil)
+}
+
+// ConfirmDrillHTML asks the user to confirm a failover drill
+func ConfirmDrillHTML(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	renderConfirmation(ctx, c, w, drillConfirmation(c.URLParams["name"]), nil)
+}
+
+// confirmed returns true if the submitted form carries the pod name typed
+// into the confirmation field. Otherwise the confirmation page is shown again
+// with an error.
+func confirmed(c web.C, w http.ResponseWriter, r *http.Request, action ConfirmAction) bool {
+	ctx := r.Context()
+	r.ParseForm()
+	if r.FormValue("confirm") == action.Pod {
+		return true
+	}
+	w.WriteHeader(http.StatusBadRequest)
+	renderConfirmation(ctx, c, w, action, errNotConfirmed)
+	return false
+}
+
+func renderConfirmation(ctx context.Context, c web.C, w http.ResponseWriter, action ConfirmAction, err error) {
+	context, cerr := NewPageContext(ctx)
+	checkContextError(cerr, &w)
+	context.Title = action.Title
+	context.SubTitle = action.Pod
+	context.ViewTemplate = "confirm-action"
+	if m, in := context.Constellation.GetPodMaintenance(action.Pod); in {
+		action.Maintenance = &m
+	}
+	context.CSRFToken = CSRFToken(c)
+	context.Data = action
+	context.Error = err
+	render(w, context)
+}
@@ -4,23 +4,66 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"strings"
 
-	"github.com/therealbill/airbrake-go"
 	"github.com/therealbill/libredis/structures"
+	"github.com/therealbill/redskull/redskull-controller/actions"
 	"github.com/therealbill/redskull/redskull-controller/common"
+	rserrors "github.com/therealbill/redskull/redskull-controller/errors"
+	"github.com/therealbill/redskull/redskull-shared/logging"
 	"github.com/zenazn/goji/web"
 )
 
-// WEB UI CALL
+// RebalanceHTML shows the rebalance plan for the constellation and asks for
+// confirmation before anything is changed
 func RebalanceHTML(c web.C, w http.ResponseWriter, r *http.Request) {
-	context, err := NewPageContext()
+	ctx := r.Context()
+	context, err := NewPageContext(ctx)
 	checkContextError(err, &w)
+	context.Title = "Rebalance Plan"
+	context.ViewTemplate = "rebalance_plan"
+	context.CSRFToken = CSRFToken(c)
+	plan, err := context.Constellation.PlanRebalance(ctx)
+	context.Error = err
+	context.Data = plan
+	render(w, context)
+}
+
+// RebalanceConfirmHTML executes the previewed rebalance plan. If there was no
+// preview, or the constellation changed since it, the current plan is shown
+// instead.
+func RebalanceConfirmHTML(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	r.ParseForm()
+	context, err := NewPageContext(ctx)
+	checkContextError(err, &w)
+	plan, report, err := context.Constellation.ConfirmRebalance(ctx, r.FormValue("fingerprint"))
+	if err == actions.ErrRebalanceUnconfirmed {
+		context.Title = "Rebalance Plan"
+		plan, context.Error = context.Constellation.PlanRebalance(ctx)
+		if context.Error == nil {
+			context.Error = err
+		}
+		context.ViewTemplate = "rebalance_plan"
+		context.CSRFToken = CSRFToken(c)
+		context.Data = plan
+		render(w, context)
+		return
+	}
+	if err == actions.ErrRebalancePlanChanged {
+		context.Title = "Rebalance Plan Changed"
+		context.ViewTemplate = "rebalance_plan"
+		context.CSRFToken = CSRFToken(c)
+		context.Error = err
+		context.Data = plan
+		render(w, context)
+		return
+	}
 	context.Title = "Rebalance Attempt Complete"
 	context.ViewTemplate = "rebalance_complete"
-	context.Constellation.Balance()
+	context.Error = err
+	context.Data = report
 	context.Refresh = true
 	context.RefreshTime = 30
 	context.RefreshURL = "/constellation/"
@@ -28,10 +71,11 @@ func RebalanceHTML(c web.C, w http.ResponseWriter, r *http.Request) {
 }
 
 func ConstellationInfoHTML(c web.C, w http.ResponseWriter, r *http.Request) {
-	context, err := NewPageContext()
+	ctx := r.Context()
+	context, err := NewPageContext(ctx)
 	checkContextError(err, &w)
 	subtitle := context.Constellation.Name
-	context.Constellation.GetStats()
+	context.Constellation.GetStats(ctx)
 	context.Title = "Constellation Information"
 	context.SubTitle = subtitle
 	context.ViewTemplate = "show_constellation"
@@ -43,35 +87,110 @@ func ConstellationInfoHTML(c web.C, w http.ResponseWriter, r *http.Request) {
 // API Calls
 
 func RebalanceJSON(c web.C, w http.ResponseWriter, r *http.Request) {
-	context, err := NewPageContext()
+	ctx := r.Context()
+	context, err := NewPageContext(ctx)
 	checkContextError(err, &w)
-	context.Constellation.Balance()
-	response := InfoResponse{Status: "COMPLETE", StatusMessage: "Rebalance attempt completed", Data: context.Constellation.IsBalanced()}
+	context.Constellation.Balance(ctx)
+	response := InfoResponse{Status: "COMPLETE", StatusMessage: "Rebalance attempt completed", Data: context.Constellation.IsBalanced(ctx)}
+	packed, _ := json.Marshal(response)
+	w.Write(packed)
+}
+
+// APIRebalancePlan returns the moves a rebalance would make without making
+// them
+func APIRebalancePlan(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var response InfoResponse
+	context, err := NewPageContext(ctx)
+	checkContextError(err, &w)
+	plan, err := context.Constellation.PlanRebalance(ctx)
+	if err != nil {
+		response.Status = "ERROR"
+		response.StatusMessage = err.Error()
+	} else {
+		response.Status = "COMPLETE"
+		response.Data = plan
+		if !plan.HasChanges() {
+			response.StatusMessage = "Constellation is balanced"
+		}
+	}
+	packed, _ := json.Marshal(response)
+	w.Write(packed)
+}
+
+// APIRebalanceConfirm executes a rebalance. The request must carry the
+// Fingerprint of a previewed plan, and the rebalance only proceeds if the
+// plan is unchanged; otherwise a 409 with the new plan is returned.
+func APIRebalanceConfirm(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var (
+		response InfoResponse
+		reqdata  common.RebalanceRequest
+	)
+	body, _ := ioutil.ReadAll(r.Body)
+	if len(body) > 0 {
+		err := json.Unmarshal(body, &reqdata)
+		if err != nil {
+			retcode, em := throwJSONParseError(r)
+			logging.Errorf("%s", em)
+			http.Error(w, em, retcode)
+			return
+		}
+	}
+	context, err := NewPageContext(ctx)
+	checkContextError(err, &w)
+	plan, report, err := context.Constellation.ConfirmRebalance(ctx, reqdata.Fingerprint)
+	switch {
+	case err == actions.ErrRebalancePlanChanged:
+		response.Status = "PLANCHANGED"
+		response.StatusMessage = err.Error()
+		response.Data = plan
+		w.WriteHeader(http.StatusConflict)
+	case err == actions.ErrRebalanceUnconfirmed:
+		response.Status = "ERROR"
+		response.StatusMessage = err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+	case err != nil:
+		response.Status = "ERROR"
+		response.StatusMessage = err.Error()
+	default:
+		response.Status = "COMPLETE"
+		for _, res := range report.Results {
+			if res.Error != "" {
+				response.Status = "INCOMPLETE"
+				response.StatusMessage = "One or more moves failed"
+				break
+			}
+		}
+		response.Data = report
+	}
 	packed, _ := json.Marshal(response)
 	w.Write(packed)
 }
 
 func ConstellationInfoJSON(c web.C, w http.ResponseWriter, r *http.Request) {
-	context, err := NewPageContext()
+	ctx := r.Context()
+	context, err := NewPageContext(ctx)
 	checkContextError(err, &w)
 	packed, _ := json.Marshal(context.Constellation)
 	w.Write(packed)
 }
 
-func DoFailoverJSON(ctx web.C, w http.ResponseWriter, r *http.Request) (err error) {
-	podname := ctx.URLParams["podName"]
-	context, err := NewPageContext()
+func DoFailoverJSON(c web.C, w http.ResponseWriter, r *http.Request) (err error) {
+	ctx := r.Context()
+	podname := c.URLParams["podName"]
+	context, err := NewPageContext(ctx)
 	checkContextError(err, &w)
-	didFailover, err := context.Constellation.Failover(podname)
+	didFailover, err := context.Constellation.Failover(ctx, podname, r.FormValue("force") == "true")
 	if err != nil {
 		retcode, emsg := handleFailoverError(podname, r, err)
-		log.Printf("%d: '%s'", retcode, emsg)
+		logging.Warnf("%d: '%s'", retcode, emsg)
 		http.Error(w, emsg, retcode)
 		return
 	}
 	if !didFailover {
 		retcode, emsg := handleFailoverError(podname, r, err)
-		log.Printf("%d: '%s'", retcode, emsg)
+		logging.Warnf("%d: '%s'", retcode, emsg)
 		http.Error(w, emsg, retcode)
 		return
 	}
@@ -79,6 +198,7 @@ func DoFailoverJSON(ctx web.C, w http.ResponseWriter, r *http.Request) (err erro
 }
 
 func APIFailover(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	var (
 		response InfoResponse
 		reqdata  common.FailoverRequest
@@ -87,26 +207,30 @@ func APIFailover(c web.C, w http.ResponseWriter, r *http.Request) {
 	err = json.Unmarshal(body, &reqdata)
 	if err != nil {
 		retcode, em := throwJSONParseError(r)
-		log.Println(body)
+		logging.Debugf("%s", body)
 		if retcode >= 400 {
 			http.Error(w, em, retcode)
 			return
 		}
 	}
 	reqdata.Podname = c.URLParams["podName"]
-	context, err := NewPageContext()
+	context, err := NewPageContext(ctx)
 	checkContextError(err, &w)
-	ok, err := context.Constellation.Failover(reqdata.Podname)
+	ok, err := context.Constellation.Failover(ctx, reqdata.Podname, reqdata.Force)
 	if err != nil {
 		em := err.Error()
 		em = strings.TrimSpace(em)
 		response.Status = "ERROR"
-		switch em {
-		case "NOGOODSLAVE No suitable slave to promote":
+		switch {
+		case err == actions.ErrPodInMaintenance:
+			response.Status = "MAINTENANCE"
+			response.StatusMessage = em
+			w.WriteHeader(http.StatusConflict)
+		case em == "NOGOODSLAVE No suitable slave to promote":
 			response.Status = "NOGOODSLAVE"
 			response.StatusMessage = "No suitable slave to promote"
 		default:
-			log.Printf("'%s'", em)
+			logging.Errorf("'%s'", em)
 			response.StatusMessage = err.Error()
 		}
 		packed, _ := json.Marshal(response)
@@ -122,7 +246,7 @@ func APIFailover(c web.C, w http.ResponseWriter, r *http.Request) {
 	response.Status = "SUCCESS"
 	response.StatusMessage = "Failover command accepted"
 	if reqdata.ReturnNew {
-		newmaster, err := context.Constellation.GetMaster(reqdata.Podname)
+		newmaster, err := context.Constellation.GetMaster(ctx, reqdata.Podname)
 		if err != nil {
 			response.Status = "ERROR"
 			response.StatusMessage = err.Error()
@@ -134,11 +258,12 @@ func APIFailover(c web.C, w http.ResponseWriter, r *http.Request) {
 }
 
 func APIGetSlaves(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	var response InfoResponse
 	podName := c.URLParams["podName"]
-	context, err := NewPageContext()
+	context, err := NewPageContext(ctx)
 	checkContextError(err, &w)
-	slaves, err := context.Constellation.GetSlaves(podName)
+	slaves, err := context.Constellation.GetSlaves(ctx, podName)
 	response.Data = slaves
 	if err != nil {
 		response.Status = "ERROR"
@@ -149,20 +274,17 @@ func APIGetSlaves(c web.C, w http.ResponseWriter, r *http.Request) {
 }
 
 func APIGetMaster(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	var response InfoResponse
 	podName := c.URLParams["podName"]
-	context, err := NewPageContext()
+	context, err := NewPageContext(ctx)
 	checkContextError(err, &w)
-	master, err := context.Constellation.GetMaster(podName)
+	master, err := context.Constellation.GetMaster(ctx, podName)
 	if err != nil {
 		em := fmt.Errorf("Sentinel command error '%s'", err)
-		e := airbrake.ExtendedNotification{ErrorClass: "Sentinel.Command", Error: em}
-		err = airbrake.ExtendedError(e, r)
-		if err != nil {
-			log.Print("airbrake error:", err)
-		}
+		rserrors.Notify(r, rserrors.Report{Class: "Sentinel.Command", Err: em, Pod: podName})
 		response.Status = "COMMANDERROR"
-		response.StatusMessage = err.Error()
+		response.StatusMessage = em.Error()
 	} else {
 		var addr structures.MasterAddress
 		addr = master
@@ -181,6 +303,7 @@ func APIGetMaster(c web.C, w http.ResponseWriter, r *http.Request) {
 }
 
 func APIMonitorPod(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	var (
 		response InfoResponse
 		reqdata  common.MonitorRequest
@@ -190,22 +313,18 @@ func APIMonitorPod(c web.C, w http.ResponseWriter, r *http.Request) {
 	err = json.Unmarshal(body, &reqdata)
 	if err != nil {
 		retcode, em := throwJSONParseError(r)
-		log.Print(em)
+		logging.Errorf("%s", em)
 		http.Error(w, em, retcode)
 	}
 	reqdata.Podname = podName
-	context, err := NewPageContext()
+	context, err := NewPageContext(ctx)
 	checkContextError(err, &w)
-	ok, err := context.Constellation.MonitorPod(podName, reqdata.MasterAddress, reqdata.MasterPort, reqdata.Quorum, reqdata.AuthToken)
+	ok, err := context.Constellation.MonitorPod(ctx, podName, reqdata.MasterAddress, reqdata.MasterPort, reqdata.Quorum, reqdata.AuthToken)
 	if !ok {
 		response.StatusMessage = fmt.Sprintf("Pod '%s' failed to reach sentinel quorum.", reqdata.Podname)
 		response.Status = "INCOMPLETE"
 		em := fmt.Errorf("MONITOR pod '%s' failed to reach quorum", reqdata.Podname)
-		e := airbrake.ExtendedNotification{ErrorClass: "Pod.Quorum", Error: em}
-		err = airbrake.ExtendedError(e, r)
-		if err != nil {
-			log.Print("airbrake error:", err)
-		}
+		rserrors.Notify(r, rserrors.Report{Class: "Pod.Quorum", Err: em, Pod: reqdata.Podname})
 	} else {
 		response.Status = "COMPLETE"
 	}
@@ -215,13 +334,14 @@ func APIMonitorPod(c web.C, w http.ResponseWriter, r *http.Request) {
 }
 
 func APIRemovePod(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	var response InfoResponse
 	podName := c.URLParams["podName"]
-	log.Print("Removing pod:", podName)
+	logging.Pod(podName).Infof("Removing pod: %s", podName)
 
-	context, err := NewPageContext()
+	context, err := NewPageContext(ctx)
 	checkContextError(err, &w)
-	_, err = context.Constellation.RemovePod(podName)
+	_, err = context.Constellation.RemovePod(ctx, podName)
 	if err != nil {
 		response.Status = "COMMANDERROR"
 		response.StatusMessage = err.Error()
@@ -231,63 +351,66 @@ func APIRemovePod(c web.C, w http.ResponseWriter, r *http.Request) {
 	}
 	packed, err := json.Marshal(response)
 	if err != nil {
-		log.Print("Unable to pack JSON, err:", err)
+		logging.Errorf("Unable to pack JSON, err:%s", err)
 	}
 	w.Write(packed)
 }
 
 func APIGetPodMap(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	var (
 		response InfoResponse
 	)
-	context, err := NewPageContext()
+	context, err := NewPageContext(ctx)
 	checkContextError(err, &w)
 	pods, _ := context.Constellation.GetPodMap()
 	response.Status = "COMPLETE"
 	response.Data = pods
 	packed, err := json.Marshal(response)
 	if err != nil {
-		log.Print("Unable to pack JSON, err:", err)
+		logging.Errorf("Unable to pack JSON, err:%s", err)
 	}
 	w.Write(packed)
 }
 
 func APIGetPods(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	var (
 		response InfoResponse
 	)
-	context, err := NewPageContext()
+	context, err := NewPageContext(ctx)
 	checkContextError(err, &w)
 	pods := context.Constellation.GetPods()
 	response.Status = "COMPLETE"
 	response.Data = pods
 	packed, err := json.Marshal(response)
 	if err != nil {
-		log.Print("Unable to pack JSON, err:", err)
+		logging.Errorf("Unable to pack JSON, err:%s", err)
 	}
 	w.Write(packed)
 }
 
 func APIGetPod(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	var (
 		response InfoResponse
 	)
 	podname := c.URLParams["podName"]
-	log.Print("pulling API for pod " + podname)
+	logging.Pod(podname).Debugf("Pulling API for pod %s", podname)
 	if podname == "" {
 		err := fmt.Errorf("API:GP called w/o a pod??")
-		log.Print("API:GP Error:", err)
+		logging.Op("APIGetPod").Errorf("Error:%s", err)
 		response.Status = "ERROR"
 		response.StatusMessage = err.Error()
 	} else {
-		context, err := NewPageContext()
+		context, err := NewPageContext(ctx)
 		checkContextError(err, &w)
-		pod, err := context.Constellation.GetPod(podname)
+		pod, err := context.Constellation.GetPod(ctx, podname)
 		if pod.Name > "" {
 			response.Status = "COMPLETE"
 			response.Data = pod
 		} else {
-			log.Print("API:GP Error:", err)
+			logging.Op("APIGetPod").Errorf("Error:%s", err)
 			response.Status = "ERROR"
 			response.StatusMessage = err.Error()
 			response.Data = pod
@@ -295,7 +418,7 @@ func APIGetPod(c web.C, w http.ResponseWriter, r *http.Request) {
 	}
 	packed, err := json.Marshal(response)
 	if err != nil {
-		log.Print("Unable to pack JSON, err:", err)
+		logging.Errorf("Unable to pack JSON, err:%s", err)
 	}
 	w.Write(packed)
 }
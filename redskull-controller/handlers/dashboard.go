@@ -1,10 +1,10 @@
 package handlers
 
 import (
-	"log"
 	"net/http"
 	"time"
 
+	"github.com/therealbill/redskull/redskull-shared/logging"
 	"github.com/zenazn/goji/web"
 )
 
@@ -24,22 +24,23 @@ type ErrorMetrics struct {
 
 // Dashboard shows the dashboard
 func Dashboard(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	dash_start := time.Now()
-	log.Print("Dashboard requested %v", dash_start)
-	context, err := NewPageContext()
+	logging.Debugf("Dashboard requested %v", dash_start)
+	context, err := NewPageContext(ctx)
 	checkContextError(err, &w)
 	context.ViewTemplate = "dashboard"
 	context.Title = "RedSkull: Dashboard"
 	context.Refresh = true
 	context.RefreshURL = r.URL.Path
 	context.RefreshTime = 60
-	log.Printf("Dashboard context set up %v from dash call", time.Since(dash_start))
+	logging.Debugf("Dashboard context set up %v from dash call", time.Since(dash_start))
 
 	var emet ErrorMetrics
 	errgroups := make(map[string][]interface{})
-	log.Print("dashboard calling GetPodsInError")
-	pods := context.Constellation.GetPodsInError()
-	log.Printf("Dashboard error pod call %v from dash call", time.Since(dash_start))
+	logging.Debugf("dashboard calling GetPodsInError")
+	pods := context.Constellation.GetPodsInError(ctx)
+	logging.Debugf("Dashboard error pod call %v from dash call", time.Since(dash_start))
 	emet.TotalErrorPods = len(pods)
 	counted := make(map[string]interface{})
 	for _, pod := range pods {
@@ -48,7 +49,7 @@ func Dashboard(c web.C, w http.ResponseWriter, r *http.Request) {
 		}
 		_, dupe := counted[pod.Name]
 		if dupe {
-			log.Print("Mice!? IN MY BAGUETTES?!")
+			logging.Pod(pod.Name).Warnf("Pod '%s' is listed in error more than once, counting it once", pod.Name)
 			continue
 		}
 		if pod.MissingSentinels {
@@ -60,7 +61,7 @@ func Dashboard(c web.C, w http.ResponseWriter, r *http.Request) {
 		if !pod.HasQuorum() {
 			emet.NoQuorum++
 		}
-		if !pod.CanFailover() {
+		if !pod.CanFailover(ctx) {
 			emet.NoFailover++
 		}
 		if pod.Master == nil {
@@ -76,9 +77,9 @@ func Dashboard(c web.C, w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	emet.Groups = errgroups
-	log.Printf("NoAuth: %d", len(errgroups["InvalidAuth"]))
-	log.Printf("Dashboard iterated over pods in error in  %v from dash call", time.Since(dash_start))
+	logging.Debugf("NoAuth: %d", len(errgroups["InvalidAuth"]))
+	logging.Debugf("Dashboard iterated over pods in error in  %v from dash call", time.Since(dash_start))
 	context.Data = emet
 	render(w, context)
-	log.Printf("Dashboard completed  %v from dash call", time.Since(dash_start))
+	logging.Debugf("Dashboard completed  %v from dash call", time.Since(dash_start))
 }
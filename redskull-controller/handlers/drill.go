@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/therealbill/redskull/redskull-controller/actions"
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-shared/auth"
+	"github.com/therealbill/redskull/redskull-shared/logging"
+	"github.com/zenazn/goji/web"
+)
+
+// ShowDrills lists the stored drill reports, newest first. A pod query
+// parameter limits them to one pod.
+func ShowDrills(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	context, err := NewPageContext(ctx)
+	checkContextError(err, &w)
+	podname := r.URL.Query().Get("pod")
+	context.Title = "Failover Drills"
+	if podname > "" {
+		context.SubTitle = podname
+	}
+	context.ViewTemplate = "drills"
+	reports := []common.DrillReport{}
+	if context.Constellation.Drills != nil {
+		for _, report := range context.Constellation.Drills.List() {
+			if podname == "" || report.Pod == podname {
+				reports = append(reports, report)
+			}
+		}
+	}
+	context.Data = reports
+	render(w, context)
+}
+
+// DrillHTML starts a drill, failing back afterwards, once confirmed and
+// shows the pod's drill reports
+func DrillHTML(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	podname := c.URLParams["name"]
+	if !confirmed(c, w, r, drillConfirmation(podname)) {
+		return
+	}
+	context, err := NewPageContext(ctx)
+	checkContextError(err, &w)
+	var start error
+	switch {
+	case context.Constellation.InMaintenance(podname):
+		start = actions.ErrPodInMaintenance
+	case actions.DrillRunning(podname):
+		start = actions.ErrDrillInProgress
+	}
+	if start != nil {
+		w.WriteHeader(http.StatusConflict)
+		renderConfirmation(ctx, c, w, drillConfirmation(podname), start)
+		return
+	}
+	auth.Audit(c, r, "drill", podname)
+	actions.Jobs.Start(common.JobDrill, podname, owner(c), drillPodJob(context.Constellation, podname, true, common.DefaultDrillTimeout, owner(c)))
+	http.Redirect(w, r, "/drills/?pod="+podname, http.StatusSeeOther)
+}
+
+// v2ListDrills lists drill reports, newest first, filtered by pod and
+// result
+func v2ListDrills(c web.C, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	pod, err := globQuery(r, "pod")
+	if err != nil {
+		return nil, err
+	}
+	result := r.URL.Query().Get("result")
+	if result != "" && result != "passed" && result != "failed" {
+		return nil, apiError(http.StatusBadRequest, common.ErrCodeInvalidRequest, "result must be passed or failed")
+	}
+	context, err := v2Context(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reports := []common.DrillReport{}
+	if context.Constellation.Drills != nil {
+		for _, report := range context.Constellation.Drills.List() {
+			if !globOK(pod, report.Pod) {
+				continue
+			}
+			if result != "" && report.Passed != (result == "passed") {
+				continue
+			}
+			reports = append(reports, report)
+		}
+	}
+	return paginate(r, reports)
+}
+
+// v2GetDrill returns a single drill report
+func v2GetDrill(c web.C, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	context, err := v2Context(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if context.Constellation.Drills != nil {
+		if report, ok := context.Constellation.Drills.Get(c.URLParams["id"]); ok {
+			return report, nil
+		}
+	}
+	return nil, apiError(http.StatusNotFound, common.ErrCodeDrillNotFound, "Drill '%s' not found", c.URLParams["id"])
+}
+
+// v2DrillPod runs a failover drill of the pod as a job. The job's result is
+// the drill report.
+func v2DrillPod(c web.C, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	var req common.DrillRequest
+	if err := decodeBody(r, &req); err != nil {
+		return nil, err
+	}
+	timeout, err := req.StepTimeout()
+	if err != nil {
+		return nil, apiError(http.StatusBadRequest, common.ErrCodeInvalidRequest, "%s", err)
+	}
+	podname := c.URLParams["pod"]
+	context, err := v2Context(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := v2Pod(ctx, context.Constellation, podname); err != nil {
+		return nil, err
+	}
+	if context.Constellation.InMaintenance(podname) {
+		return nil, apiError(http.StatusConflict, common.ErrCodeInMaintenance, "%s", actions.ErrPodInMaintenance)
+	}
+	if actions.DrillRunning(podname) {
+		return nil, apiError(http.StatusConflict, common.ErrCodeFailoverInProgress, "%s", actions.ErrDrillInProgress)
+	}
+	auth.Audit(c, r, "drill", podname)
+	return actions.Jobs.Start(common.JobDrill, podname, owner(c), drillPodJob(context.Constellation, podname, req.Failback, timeout, owner(c))), nil
+}
+
+// drillPodJob returns the job run by v2DrillPod and DrillHTML
+func drillPodJob(con *actions.Constellation, podname string, failback bool, timeout time.Duration, trigger string) actions.JobFunc {
+	if trigger == "" {
+		trigger = "manual"
+	}
+	return func(ctx context.Context, log *logging.Logger) (interface{}, error) {
+		report, err := con.RunDrill(ctx, podname, failback, timeout, trigger)
+		if report.ID == "" {
+			return nil, err
+		}
+		return report, err
+	}
+}
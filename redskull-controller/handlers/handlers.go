@@ -4,18 +4,19 @@ package handlers
 // TODO: Move error handlers to error package
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"log"
 	"net/http"
-	"os"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/dustin/go-humanize"
-	"github.com/therealbill/airbrake-go"
 	"github.com/therealbill/redskull/redskull-controller/actions"
 	"github.com/therealbill/redskull/redskull-controller/common"
+	rserrors "github.com/therealbill/redskull/redskull-controller/errors"
+	"github.com/therealbill/redskull/redskull-shared/logging"
 )
 
 // constellation represents the constellation serveed by this Red Skull
@@ -37,36 +38,48 @@ type InfoResponse struct {
 }
 
 // PageContext holds all the contextual information a page will want to return,
-// use, or display
+// use, or display. RequestContext is passed by templates to the constellation
+// and node methods they call, so those stop when the request does.
 type PageContext struct {
-	Title         string
-	SubTitle      string
-	Data          interface{}
-	Static        string
-	ViewTemplate  string
-	CurrentURL    string
-	Constellation *actions.Constellation
-	NodeMaster    common.NodeManager
-	Pod           *common.RedisPod
-	Node          *common.RedisNode
-	Refresh       bool
-	RefreshTime   int
-	RefreshURL    string
-	Error         error
+	Title          string
+	SubTitle       string
+	Data           interface{}
+	Static         string
+	ViewTemplate   string
+	CurrentURL     string
+	Constellation  *actions.Constellation
+	NodeMaster     common.NodeManager
+	Pod            *common.RedisPod
+	Node           *common.RedisNode
+	Refresh        bool
+	RefreshTime    int
+	RefreshURL     string
+	CSRFToken      string
+	Error          error
+	RequestContext context.Context
+	Simulated      bool
 }
 
 // NewPageContext instantiates and returns a PageContext with "global" data
-// already set.
-func NewPageContext() (pc PageContext, err error) {
+// already set. ctx is normally the request's context; for GET and HEAD
+// requests the PageContext's Constellation is the request's snapshot.
+func NewPageContext(ctx context.Context) (pc PageContext, err error) {
 	if constellation.Name == "" {
 		return pc, errors.New("constellation was not properly initialized")
 	}
-	pc = PageContext{Static: STATIC_URL, Constellation: &constellation, NodeMaster: NodeMaster}
+	pc = PageContext{Static: STATIC_URL, Constellation: requestConstellation(ctx), NodeMaster: NodeMaster, RequestContext: ctx, Simulated: Simulation != nil}
 	return
 }
 
+// detachedContext returns a context for work a handler starts in the
+// background, which must not be cancelled when the request ends. It is
+// bounded by common.CallTimeout instead.
+func detachedContext() (context.Context, context.CancelFunc) {
+	return common.WithCallTimeout(context.Background())
+}
+
 func SetConstellation(con actions.Constellation) {
-	log.Printf("Setting handlers.constellation: %s", con.Name)
+	logging.Debugf("Setting handlers.constellation: %s", con.Name)
 	constellation = con
 }
 
@@ -126,6 +139,15 @@ func HumanizeCallStats(micros float64) (res string) {
 	return res
 }
 
+// HumanizeDuration rounds a duration to the second, or to the millisecond
+// when under one, for display
+func HumanizeDuration(d time.Duration) string {
+	if d < time.Second {
+		return (d / time.Millisecond * time.Millisecond).String()
+	}
+	return (d / time.Second * time.Second).String()
+}
+
 // IntFromFloat64 provides a convenience function fo convert an int to a float
 // insert screed about how you probably should not do it but sometimes you need
 // to here.
@@ -156,6 +178,7 @@ func render(w http.ResponseWriter, context PageContext) {
 		"OkToBool":          OkToBool,
 		"HumanizeCallStats": HumanizeCallStats,
 		"HumanizeSlowlog":   HumanizeSlowlog,
+		"HumanizeDuration":  HumanizeDuration,
 		"tableflip":         func() string { return "(╯°□°）╯︵ ┻━┻" },
 	}
 	context.Static = STATIC_URL
@@ -163,32 +186,22 @@ func render(w http.ResponseWriter, context PageContext) {
 	/*
 		t, err := template.ParseFiles(tmpl_list...)
 		if err != nil {
-			log.Print("template parsing error: ", err)
+			logging.Errorf("template parsing error: %s", err)
 		}
 	*/
 	t := template.Must(template.New("base.html").Funcs(funcMap).ParseFiles(tmpl_list...))
 	err := t.Execute(w, context)
 	if err != nil {
-		log.Print("template executing error: ", err)
+		logging.Errorf("template executing error: %s", err)
 	}
 }
 
-// currently only used to set up your airbrake key
-func init() {
-	airbrake.ApiKey = os.Getenv("AIRBRAKE_API_KEY")
-}
-
 // throwJSONParseError is used when the JSON a client submits via the API isn't
 // parseable
 func throwJSONParseError(req *http.Request) (retcode int, userMessage string) {
 	retcode = 422
 	userMessage = "JSON Parse failure"
-	em := fmt.Errorf(userMessage)
-	e := airbrake.ExtendedNotification{ErrorClass: "Request.ParseJSON", Error: em}
-	err := airbrake.ExtendedError(e, req)
-	if err != nil {
-		log.Print("airbrake error:", err)
-	}
+	rserrors.Notify(req, rserrors.Report{Class: "Request.ParseJSON", Err: errors.New(userMessage)})
 	return
 }
 
@@ -196,7 +209,7 @@ func throwJSONParseError(req *http.Request) (retcode int, userMessage string) {
 //from the call, returning an error i, re, reqqf not
 func checkContextError(err error, w *http.ResponseWriter) (retcode int, userMessage string) {
 	if err != nil {
-		log.Printf("Context error: %s", err.Error())
+		logging.Errorf("Context error: %s", err.Error())
 		http.Error(*w, "Context not initialized. See server log for details", http.StatusInternalServerError)
 		return 500, "Server Context Error"
 	}
@@ -207,26 +220,31 @@ func checkContextError(err error, w *http.ResponseWriter) (retcode int, userMess
 // This is going to need to be used to track times when a call initiated a
 // failover that failed.
 func handleFailoverError(pod string, req *http.Request, orig_err error) (retcode int, userMessage string) {
-	var em error
+	em := orig_err
 	retcode = 500
-	if strings.Contains(orig_err.Error(), "No such master with that name") {
+	if orig_err == nil {
+		em = fmt.Errorf("Failover of pod '%s' was not started", pod)
+	}
+	if orig_err == actions.ErrPodInMaintenance {
+		userMessage = orig_err.Error()
+		logging.Pod(pod).Warnf("Failover request for pod '%s' refused, pod is in maintenance", pod)
+		retcode = http.StatusConflict
+		return
+	}
+	if strings.Contains(em.Error(), "No such master with that name") {
 		userMessage = "No pod or master with that name was found"
-		log.Printf("Failover request for nonexistent pod: '%s'", pod)
+		logging.Pod(pod).Warnf("Failover request for nonexistent pod: '%s'", pod)
 		retcode = http.StatusNotFound
 		return
 	}
-	if strings.Contains(orig_err.Error(), "INPROG") {
+	if strings.Contains(em.Error(), "INPROG") {
 		userMessage = "Enhance your calm. Failover is in progress"
-		log.Printf("Attempt to failover pod '%s' during failover", pod)
+		logging.Pod(pod).Warnf("Attempt to failover pod '%s' during failover", pod)
 		//em = fmt.Errorf("Failover Error: podName='%s', err='%s'", pod, userMessage)
 		retcode = 420
 		return
 	}
-	e := airbrake.ExtendedNotification{ErrorClass: "Sentinel.Failover", Error: em}
-	err := airbrake.ExtendedError(e, req)
-	if err != nil {
-		log.Print("airbrake error:", err)
-	}
+	rserrors.Notify(req, rserrors.Report{Class: "Sentinel.Failover", Err: em, Pod: pod})
 	userMessage = em.Error()
 	return
 }
@@ -235,9 +253,5 @@ func handleFailoverError(pod string, req *http.Request, orig_err error) (retcode
 // sentinel.
 func throwSentinelConnectError(sentinel string, orig_err error, r *http.Request) {
 	//em := fmt.Errorf("Sentinel '%s' Unavailable. Error=%s", sentinel, orig_err)
-	e := airbrake.ExtendedNotification{ErrorClass: "Sentinel.Connection", Error: orig_err}
-	err := airbrake.ExtendedError(e, r)
-	if err != nil {
-		log.Print("airbrake error:", err)
-	}
+	rserrors.Notify(r, rserrors.Report{Class: "Sentinel.Connection", Err: orig_err, Sentinel: sentinel})
 }
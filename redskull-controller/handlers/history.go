@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/therealbill/redskull/redskull-controller/actions"
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/zenazn/goji/web"
+)
+
+// podHistoryEntries is how many timeline entries the pod page shows
+const podHistoryEntries = 20
+
+// v2ListPodHistory lists the pod's timeline, newest first, filtered by kind
+// and time. Pods no longer monitored keep the history recorded for them.
+func v2ListPodHistory(c web.C, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	kind := r.URL.Query().Get("kind")
+	if kind != "" && kind != common.HistoryMasterChange && kind != common.HistoryDown {
+		return nil, apiError(http.StatusBadRequest, common.ErrCodeInvalidRequest, "kind must be %s or %s", common.HistoryMasterChange, common.HistoryDown)
+	}
+	var since time.Time
+	if raw := r.URL.Query().Get("since"); raw != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return nil, apiError(http.StatusBadRequest, common.ErrCodeInvalidRequest, "since must be an RFC 3339 time")
+		}
+	}
+	podname := c.URLParams["pod"]
+	context, err := v2Context(ctx)
+	if err != nil {
+		return nil, err
+	}
+	entries := []common.HistoryEntry{}
+	history, ok := common.PodHistory{}, false
+	if context.Constellation.History != nil {
+		history, ok = context.Constellation.History.Get(podname)
+	}
+	if !ok {
+		if _, err := v2Pod(ctx, context.Constellation, podname); err != nil {
+			return nil, err
+		}
+		return paginate(r, entries)
+	}
+	for _, e := range history.Since(since) {
+		if kind == "" || e.Kind == kind {
+			entries = append(entries, e)
+		}
+	}
+	return paginate(r, entries)
+}
+
+// v2ListSLA reports the failovers and unavailable time of each pod with
+// history over each window, ordered by pod then window
+func v2ListSLA(c web.C, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	pod, err := globQuery(r, "pod")
+	if err != nil {
+		return nil, err
+	}
+	windows := actions.SLAWindows
+	if raw := r.URL.Query().Get("window"); raw != "" {
+		windows, err = common.ParseWindows(raw)
+		if err != nil {
+			return nil, apiError(http.StatusBadRequest, common.ErrCodeInvalidRequest, "%s", err)
+		}
+	}
+	context, err := v2Context(ctx)
+	if err != nil {
+		return nil, err
+	}
+	slas := []common.PodSLA{}
+	if context.Constellation.History != nil {
+		now := time.Now()
+		for _, history := range context.Constellation.History.List() {
+			if !globOK(pod, history.Pod) {
+				continue
+			}
+			for _, w := range windows {
+				slas = append(slas, history.SLA(w, now))
+			}
+		}
+	}
+	return paginate(r, slas)
+}
+
+// podHistory returns the pod's SLA over the configured windows and its
+// most recent timeline entries for the pod page
+func podHistory(con *actions.Constellation, podname string) (slas []common.PodSLA, recent []common.HistoryEntry) {
+	if con.History == nil {
+		return nil, nil
+	}
+	history, ok := con.History.Get(podname)
+	if !ok {
+		return nil, nil
+	}
+	now := time.Now()
+	for _, w := range actions.SLAWindows {
+		slas = append(slas, history.SLA(w, now))
+	}
+	recent = history.Since(time.Time{})
+	if len(recent) > podHistoryEntries {
+		recent = recent[:podHistoryEntries]
+	}
+	return slas, recent
+}
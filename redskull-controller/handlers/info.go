@@ -3,20 +3,23 @@ package handlers
 import (
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 
 	"github.com/therealbill/libredis/client"
+	"github.com/therealbill/libredis/structures"
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-shared/logging"
 	"github.com/zenazn/goji/web"
 )
 
 // Info is deprecated in favor of the cluster level node routines
 func Info(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	var response InfoResponse
 	target := c.URLParams["targetAddress"]
 	section := c.URLParams["section"]
 	_ = section
-	conn, err := client.DialWithConfig(&client.DialConfig{Address: target})
+	conn, err := common.Dial(ctx, client.DialConfig{Address: target})
 
 	if err != nil {
 		response.Status = "CONNECTIONERROR"
@@ -24,7 +27,11 @@ func Info(c web.C, w http.ResponseWriter, r *http.Request) {
 		fmt.Fprint(w, response)
 	} else {
 		defer conn.ClosePool()
-		info, err := conn.Info()
+		var info structures.RedisInfoAll
+		err := common.Do(ctx, func() (err error) {
+			info, err = conn.Info()
+			return err
+		})
 		if err != nil {
 			response.Status = "COMMANDERROR"
 			response.StatusMessage = err.Error()
@@ -36,7 +43,7 @@ func Info(c web.C, w http.ResponseWriter, r *http.Request) {
 	}
 	packed, err := json.Marshal(response)
 	if err != nil {
-		log.Printf("JSON Marshalling Error: %s", err)
+		logging.Errorf("JSON Marshalling Error: %s", err)
 	}
 	w.Write(packed)
 }
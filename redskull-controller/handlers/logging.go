@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/therealbill/redskull/redskull-shared/auth"
+	"github.com/therealbill/redskull/redskull-shared/logging"
+	"github.com/zenazn/goji/web"
+)
+
+// LogLevelRequest changes the log level
+type LogLevelRequest struct {
+	Level string
+}
+
+// APIGetLogLevel returns the current log level
+func APIGetLogLevel(c web.C, w http.ResponseWriter, r *http.Request) {
+	response := InfoResponse{Status: "COMPLETE", Data: LogLevelRequest{Level: logging.GetLevel().String()}}
+	packed, _ := json.Marshal(response)
+	w.Write(packed)
+}
+
+// APISetLogLevel changes the log level until the next restart
+func APISetLogLevel(c web.C, w http.ResponseWriter, r *http.Request) {
+	var (
+		response InfoResponse
+		reqdata  LogLevelRequest
+	)
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &reqdata)
+	}
+	if err != nil {
+		retcode, em := throwJSONParseError(r)
+		http.Error(w, em, retcode)
+		return
+	}
+	level, err := logging.ParseLevel(reqdata.Level)
+	if err != nil {
+		response.Status = "ERROR"
+		response.StatusMessage = err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+	} else {
+		auth.Audit(c, r, "set-log-level", level.String())
+		logging.SetLevel(level)
+		logging.Infof("Log level set to %s", level)
+		response.Status = "COMPLETE"
+		response.Data = LogLevelRequest{Level: level.String()}
+	}
+	packed, _ := json.Marshal(response)
+	w.Write(packed)
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-shared/auth"
+	"github.com/zenazn/goji/web"
+)
+
+// maintenanceForm is the data behind the maintenance form
+type maintenanceForm struct {
+	Owner       string
+	Maintenance *common.PodMaintenance
+}
+
+// MaintenanceFormHTML shows the form for placing a pod into, or taking it
+// out of, maintenance
+func MaintenanceFormHTML(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	podname := c.URLParams["podName"]
+	context, err := NewPageContext(ctx)
+	checkContextError(err, &w)
+	context.Title = fmt.Sprintf("Maintenance: %s", podname)
+	context.ViewTemplate = "maintenance-form"
+	context.CSRFToken = CSRFToken(c)
+	pod, err := context.Constellation.GetPod(ctx, podname)
+	if pod == nil || pod.Name == "" {
+		http.Error(w, "No such Pod", 404)
+		return
+	}
+	context.Pod = pod
+	data := maintenanceForm{}
+	if id, ok := auth.FromContext(c); ok {
+		data.Owner = id.Name
+	}
+	if m, in := context.Constellation.GetPodMaintenance(podname); in {
+		data.Maintenance = &m
+	}
+	context.Data = data
+	render(w, context)
+}
+
+// SetMaintenanceHTML is the action target for the maintenance form
+func SetMaintenanceHTML(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	r.ParseForm()
+	req := common.MaintenanceRequest{
+		Podname:  c.URLParams["podName"],
+		Reason:   r.FormValue("reason"),
+		Owner:    r.FormValue("owner"),
+		Duration: r.FormValue("duration"),
+		Consul:   r.FormValue("consul") == "true",
+	}
+	_, err := setMaintenance(c, r, req)
+	if err != nil {
+		context, cerr := NewPageContext(ctx)
+		checkContextError(cerr, &w)
+		context.Title = "Maintenance Error"
+		context.ViewTemplate = "maintenance-form"
+		context.CSRFToken = CSRFToken(c)
+		context.Pod, _ = context.Constellation.GetPod(ctx, req.Podname)
+		context.Data = maintenanceForm{Owner: req.Owner}
+		context.Error = err
+		w.WriteHeader(http.StatusBadRequest)
+		render(w, context)
+		return
+	}
+	http.Redirect(w, r, "/pod/"+req.Podname, http.StatusSeeOther)
+}
+
+// ClearMaintenanceHTML takes the pod out of maintenance
+func ClearMaintenanceHTML(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	podname := c.URLParams["podName"]
+	context, err := NewPageContext(ctx)
+	checkContextError(err, &w)
+	auth.Audit(c, r, "clear-maintenance", podname)
+	err = context.Constellation.ClearPodMaintenance(ctx, podname)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/pod/"+podname, http.StatusSeeOther)
+}
+
+// APIGetMaintenance returns every pod currently in maintenance
+func APIGetMaintenance(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	context, err := NewPageContext(ctx)
+	checkContextError(err, &w)
+	list := context.Constellation.ListMaintenance()
+	if list == nil {
+		list = []common.PodMaintenance{}
+	}
+	response := InfoResponse{Status: "COMPLETE", Data: list}
+	packed, _ := json.Marshal(response)
+	w.Write(packed)
+}
+
+// APIGetPodMaintenance returns the pod's maintenance entry
+func APIGetPodMaintenance(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var response InfoResponse
+	podname := c.URLParams["podName"]
+	context, err := NewPageContext(ctx)
+	checkContextError(err, &w)
+	if m, in := context.Constellation.GetPodMaintenance(podname); in {
+		response.Status = "MAINTENANCE"
+		response.Data = m
+	} else {
+		response.Status = "COMPLETE"
+		response.StatusMessage = "Pod is not in maintenance"
+	}
+	packed, _ := json.Marshal(response)
+	w.Write(packed)
+}
+
+// APISetPodMaintenance places the pod into maintenance. The body is a
+// common.MaintenanceRequest.
+func APISetPodMaintenance(c web.C, w http.ResponseWriter, r *http.Request) {
+	var (
+		response InfoResponse
+		reqdata  common.MaintenanceRequest
+	)
+	body, err := ioutil.ReadAll(r.Body)
+	if len(body) > 0 {
+		err = json.Unmarshal(body, &reqdata)
+		if err != nil {
+			retcode, em := throwJSONParseError(r)
+			http.Error(w, em, retcode)
+			return
+		}
+	}
+	reqdata.Podname = c.URLParams["podName"]
+	m, err := setMaintenance(c, r, reqdata)
+	if err != nil {
+		response.Status = "ERROR"
+		response.StatusMessage = err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+	} else {
+		response.Status = "COMPLETE"
+		response.Data = m
+	}
+	packed, _ := json.Marshal(response)
+	w.Write(packed)
+}
+
+// APIClearPodMaintenance takes the pod out of maintenance
+func APIClearPodMaintenance(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var response InfoResponse
+	podname := c.URLParams["podName"]
+	context, err := NewPageContext(ctx)
+	checkContextError(err, &w)
+	auth.Audit(c, r, "clear-maintenance", podname)
+	err = context.Constellation.ClearPodMaintenance(ctx, podname)
+	if err != nil {
+		response.Status = "ERROR"
+		response.StatusMessage = err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+	} else {
+		response.Status = "COMPLETE"
+		response.StatusMessage = "Pod is no longer in maintenance"
+	}
+	packed, _ := json.Marshal(response)
+	w.Write(packed)
+}
+
+// setMaintenance validates the request and places the pod into maintenance.
+// The owner defaults to the authenticated user.
+func setMaintenance(c web.C, r *http.Request, req common.MaintenanceRequest) (m common.PodMaintenance, err error) {
+	ctx := r.Context()
+	context, err := NewPageContext(ctx)
+	if err != nil {
+		return m, err
+	}
+	if req.Reason == "" {
+		return m, errors.New("A reason is required")
+	}
+	if req.Owner == "" {
+		if id, ok := auth.FromContext(c); ok {
+			req.Owner = id.Name
+		}
+	}
+	expires, err := req.ExpiresAt()
+	if err != nil {
+		return m, fmt.Errorf("Invalid duration '%s': %s", req.Duration, err)
+	}
+	auth.Audit(c, r, "set-maintenance", req.Podname)
+	return context.Constellation.SetPodMaintenance(ctx, req.Podname, req.Reason, req.Owner, expires, req.Consul)
+}
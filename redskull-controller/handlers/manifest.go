@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-shared/logging"
+	"github.com/zenazn/goji/web"
+)
+
+// readManifest parses the YAML or JSON manifest in the request body
+func readManifest(r *http.Request) (common.Manifest, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return common.Manifest{}, err
+	}
+	return common.ParseManifest(body)
+}
+
+// APIPlanManifest diffs the submitted manifest against the constellation.
+// Planning resolves the manifest's auth references, so it is admin only.
+func APIPlanManifest(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var response InfoResponse
+	manifest, err := readManifest(r)
+	if err != nil {
+		logging.Errorf("Manifest parse error: %s", err)
+		http.Error(w, err.Error(), 422)
+		return
+	}
+	context, err := NewPageContext(ctx)
+	checkContextError(err, &w)
+	plan, err := context.Constellation.PlanManifest(ctx, manifest)
+	if err != nil {
+		response.Status = "ERROR"
+		response.StatusMessage = err.Error()
+	} else {
+		response.Status = "COMPLETE"
+		response.Data = plan
+		if !plan.HasChanges() {
+			response.StatusMessage = "Constellation matches manifest"
+		}
+	}
+	packed, _ := json.Marshal(response)
+	w.Write(packed)
+}
+
+// APIApplyManifest applies the submitted manifest. Passing dryrun=true in the
+// query string returns the report without making changes.
+func APIApplyManifest(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var response InfoResponse
+	manifest, err := readManifest(r)
+	if err != nil {
+		logging.Errorf("Manifest parse error: %s", err)
+		http.Error(w, err.Error(), 422)
+		return
+	}
+	dryRun := r.URL.Query().Get("dryrun") == "true"
+	context, err := NewPageContext(ctx)
+	checkContextError(err, &w)
+	report, err := context.Constellation.ApplyManifest(ctx, manifest, dryRun)
+	if err != nil {
+		response.Status = "ERROR"
+		response.StatusMessage = err.Error()
+	} else {
+		response.Status = "COMPLETE"
+		for _, res := range report.Results {
+			if res.Error != "" {
+				response.Status = "INCOMPLETE"
+				response.StatusMessage = "One or more steps failed"
+				break
+			}
+		}
+		response.Data = report
+	}
+	packed, _ := json.Marshal(response)
+	w.Write(packed)
+}
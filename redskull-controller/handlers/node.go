@@ -3,17 +3,19 @@ package handlers
 import (
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
 
 	"github.com/therealbill/libredis/client"
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-shared/logging"
 	"github.com/zenazn/goji/web"
 )
 
 // ShowNodes shows the node listing page
 func ShowNodes(c web.C, w http.ResponseWriter, r *http.Request) {
-	context, err := NewPageContext()
+	ctx := r.Context()
+	context, err := NewPageContext(ctx)
 	checkContextError(err, &w)
 	//NodeMaster.LoadNodes()
 	context.Data = context.Constellation.NodeMap
@@ -24,15 +26,16 @@ func ShowNodes(c web.C, w http.ResponseWriter, r *http.Request) {
 
 // ShowNode handles the individual node display
 func ShowNode(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	target := c.URLParams["name"]
 	title := fmt.Sprintf("Node: %s", target)
-	context, err := NewPageContext()
+	context, err := NewPageContext(ctx)
 	checkContextError(err, &w)
 	context.Title = title
 	context.ViewTemplate = "show-node"
 	podname := context.Constellation.NodeNameToPodMap[target]
-	log.Printf("Getting node for pod: %s", podname)
-	node, _ := context.Constellation.GetNode(target, podname, "")
+	logging.Pod(podname).Debugf("Getting node for pod: %s", podname)
+	node, _ := context.Constellation.GetNode(ctx, target, podname, "")
 	context.Node = node
 	render(w, context)
 }
@@ -40,9 +43,10 @@ func ShowNode(c web.C, w http.ResponseWriter, r *http.Request) {
 // AddNode isn't currently used but would add a non-master, non-slave node.
 // This will be refactored out to a provisioning layer
 func AddNode(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	target := c.URLParams["nodeName"]
-	node := NodeMaster.GetNode(target)
-	context, err := NewPageContext()
+	node := NodeMaster.GetNode(ctx, target)
+	context, err := NewPageContext(ctx)
 	checkContextError(err, &w)
 	context.Title = fmt.Sprintf("Add Node %s", target)
 	context.ViewTemplate = "add-node-form"
@@ -53,22 +57,24 @@ func AddNode(c web.C, w http.ResponseWriter, r *http.Request) {
 
 // GetNodeJSON returns the JSON output of the data known about a node
 func GetNodeJSON(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	target := c.URLParams["name"]
 	//node := NodeMaster.GetNode(target)
-	context, err := NewPageContext()
+	context, err := NewPageContext(ctx)
 	checkContextError(err, &w)
 	podname := context.Constellation.NodeNameToPodMap[target]
-	log.Printf("Getting node for pod: %s", podname)
-	node, _ := context.Constellation.GetNode(target, podname, "")
-	node.UpdateData()
+	logging.Pod(podname).Debugf("Getting node for pod: %s", podname)
+	node, _ := context.Constellation.GetNode(ctx, target, podname, "")
+	node.UpdateData(ctx)
 	response := InfoResponse{Status: "COMPLETE", StatusMessage: "Pod Info Retrieved", Data: node}
-	log.Printf("[%s]: %+v", target, node)
+	logging.Pod(target).Node(node.Name).Debugf("[%s]: loaded node %s", target, node.Name)
 	packed, _ := json.Marshal(response)
 	w.Write(packed)
 }
 
 // AddNodeHTMLProcessor is the target for the AddNode form's action
 func AddNodeHTMLProcessor(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	r.ParseForm()
 	// initially this will require a node to already be available on the network
 	// will also need to add auth for node. Free nodes' auth string common
@@ -79,8 +85,8 @@ func AddNodeHTMLProcessor(c web.C, w http.ResponseWriter, r *http.Request) {
 	// Once I've got a Redis Anywhere API built/figured out it will call that
 	// to provision the node then add it into this system
 	nodename := c.URLParams["nodeName"]
-	node := NodeMaster.GetNode(nodename)
-	context, err := NewPageContext()
+	node := NodeMaster.GetNode(ctx, nodename)
+	context, err := NewPageContext(ctx)
 	checkContextError(err, &w)
 	context.Title = "Node Node Result"
 	context.ViewTemplate = "slave-added"
@@ -88,7 +94,7 @@ func AddNodeHTMLProcessor(c web.C, w http.ResponseWriter, r *http.Request) {
 	address := r.FormValue("host")
 	portstr := r.FormValue("port")
 	port, _ := strconv.Atoi(portstr)
-	log.Printf("Name: %s. Address: %s, Port: %d", nodename, address, port)
+	logging.Debugf("Name: %s. Address: %s, Port: %d", nodename, address, port)
 	_ = node
 	type results struct {
 		Name     string
@@ -99,16 +105,16 @@ func AddNodeHTMLProcessor(c web.C, w http.ResponseWriter, r *http.Request) {
 		NodeURL  string
 	}
 	res := results{Name: nodename, Address: address, Port: port}
-	nodeconn, err := client.Dial(address, port)
+	nodeconn, err := common.Dial(ctx, client.DialConfig{Address: fmt.Sprintf("%s:%d", address, port)})
 	if err != nil {
-		log.Print("ERR: Dialing node -", err)
+		logging.Node(fmt.Sprintf("%s:%d", address, port)).Errorf("Unable to dial node %s:%d: %s", address, port, err)
 		//context.Data = err
 		render(w, context)
 		return
 	}
 	defer nodeconn.ClosePool()
 	_ = nodeconn
-	context.Data = res // wtf, why is this insisting it needs to be a comparison?!
+	context.Data = res
 	render(w, context)
 
 }
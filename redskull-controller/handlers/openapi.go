@@ -0,0 +1,365 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/therealbill/libredis/structures"
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-shared/auth"
+	"github.com/zenazn/goji/web"
+)
+
+// apiV2Routes is the table of every v2 endpoint
+func apiV2Routes() []apiRoute {
+	podFilters := append([]apiParam{
+		{"name", "Glob pattern the pod name must match"},
+		{"status", "Only pods with this status: ok, error or maintenance"},
+	}, pageParams...)
+	return []apiRoute{
+		{ID: "listPods", Method: "GET", Path: "/pods", Tag: "pods", Summary: "List pods", Role: auth.Viewer,
+			Query: podFilters, Response: common.PodSummary{}, List: true, Handler: v2ListPods},
+		{ID: "getPod", Method: "GET", Path: "/pods/:pod", Tag: "pods", Summary: "Get a pod", Role: auth.Viewer,
+			Response: common.RedisPod{}, Handler: v2GetPod},
+		{ID: "monitorPod", Method: "PUT", Path: "/pods/:pod", Tag: "pods", Summary: "Monitor a pod on every sentinel", Role: auth.Operator,
+			Body: common.MonitorRequest{}, Response: common.RedisPod{}, Handler: v2MonitorPod},
+		{ID: "removePod", Method: "DELETE", Path: "/pods/:pod", Tag: "pods", Summary: "Stop monitoring a pod", Role: auth.Operator,
+			Response: common.APIResult{}, Handler: v2RemovePod},
+		{ID: "failoverPod", Method: "POST", Path: "/pods/:pod/failover", Tag: "pods", Summary: "Fail the pod over to a slave", Role: auth.Operator,
+			Body: common.FailoverOptions{}, Response: common.APIResult{}, Handler: v2Failover},
+		{ID: "resetPod", Method: "POST", Path: "/pods/:pod/reset", Tag: "pods", Summary: "Reset the pod on its sentinels", Role: auth.Operator,
+			Body: common.ResetOptions{}, Response: common.Job{}, Status: http.StatusAccepted, Handler: v2ResetPod},
+		{ID: "balancePod", Method: "POST", Path: "/pods/:pod/balance", Tag: "pods", Summary: "Bring the pod to its needed sentinel count", Role: auth.Operator,
+			Body: common.BalanceOptions{}, Response: common.Job{}, Status: http.StatusAccepted, Handler: v2BalancePod},
+		{ID: "drillPod", Method: "POST", Path: "/pods/:pod/drill", Tag: "drills", Summary: "Run a failover drill of the pod", Role: auth.Operator,
+			Body: common.DrillRequest{}, Response: common.Job{}, Status: http.StatusAccepted, Handler: v2DrillPod},
+		{ID: "getPodMaster", Method: "GET", Path: "/pods/:pod/master", Tag: "pods", Summary: "Get the pod's current master", Role: auth.Viewer,
+			Response: structures.MasterAddress{}, Handler: v2GetMaster},
+		{ID: "listPodSlaves", Method: "GET", Path: "/pods/:pod/slaves", Tag: "pods", Summary: "List the pod's slaves", Role: auth.Viewer,
+			Query: pageParams, Response: structures.SlaveInfo{}, List: true, Handler: v2GetSlaves},
+		{ID: "listPodSentinels", Method: "GET", Path: "/pods/:pod/sentinels", Tag: "pods", Summary: "List the sentinels monitoring the pod", Role: auth.Viewer,
+			Query: pageParams, Response: common.SentinelSummary{}, List: true, Handler: v2GetPodSentinels},
+		{ID: "addPodSlave", Method: "POST", Path: "/pods/:pod/slaves", Tag: "pods", Summary: "Make a Redis instance a slave of the pod's master", Role: auth.Operator,
+			Body: common.AddSlaveRequest{}, Response: common.APIResult{}, Status: http.StatusCreated, Handler: v2AddSlave},
+		{ID: "removePodSlave", Method: "DELETE", Path: "/pods/:pod/slaves/:slave", Tag: "pods", Summary: "Detach a slave, given as host:port, from the pod", Role: auth.Operator,
+			Response: common.APIResult{}, Handler: v2RemoveSlave},
+		{ID: "getPodTopology", Method: "GET", Path: "/pods/:pod/topology", Tag: "pods", Summary: "Check the pod's replication topology", Role: auth.Viewer,
+			Response: common.TopologyReport{}, Handler: v2GetPodTopology},
+		{ID: "getPodMaintenance", Method: "GET", Path: "/pods/:pod/maintenance", Tag: "pods", Summary: "Get the pod's maintenance window", Role: auth.Viewer,
+			Response: common.PodMaintenance{}, Handler: v2GetPodMaintenance},
+		{ID: "setPodMaintenance", Method: "PUT", Path: "/pods/:pod/maintenance", Tag: "pods", Summary: "Place the pod into maintenance", Role: auth.Operator,
+			Body: common.MaintenanceRequest{}, Response: common.PodMaintenance{}, Handler: v2SetPodMaintenance},
+		{ID: "clearPodMaintenance", Method: "DELETE", Path: "/pods/:pod/maintenance", Tag: "pods", Summary: "Take the pod out of maintenance", Role: auth.Operator,
+			Response: common.APIResult{}, Handler: v2ClearPodMaintenance},
+
+		{ID: "listNodes", Method: "GET", Path: "/nodes", Tag: "nodes", Summary: "List known nodes", Role: auth.Viewer,
+			Query: append([]apiParam{
+				{"pod", "Glob pattern the node's pod must match"},
+				{"role", "Only nodes with this replication role: master or slave"},
+			}, pageParams...), Response: common.NodeSummary{}, List: true, Handler: v2ListNodes},
+		{ID: "cloneNode", Method: "POST", Path: "/nodes/clone", Tag: "nodes", Summary: "Clone one node to another", Role: auth.Operator,
+			Body: common.CloneRequest{}, Response: common.Job{}, Status: http.StatusAccepted, Handler: v2CloneNode},
+		{ID: "getNode", Method: "GET", Path: "/nodes/:node", Tag: "nodes", Summary: "Get a node", Role: auth.Viewer,
+			Response: common.RedisNode{}, Handler: v2GetNode},
+
+		{ID: "listSentinels", Method: "GET", Path: "/sentinels", Tag: "sentinels", Summary: "List known sentinels", Role: auth.Viewer,
+			Query:    append([]apiParam{{"name", "Glob pattern the sentinel name must match"}}, pageParams...),
+			Response: common.SentinelSummary{}, List: true, Handler: v2ListSentinels},
+		{ID: "addSentinel", Method: "POST", Path: "/sentinels", Tag: "sentinels", Summary: "Add a sentinel to the constellation", Role: auth.Admin,
+			Body: common.AddSentinelRequest{}, Response: common.APIResult{}, Handler: v2AddSentinel},
+		{ID: "getSentinel", Method: "GET", Path: "/sentinels/:sentinel", Tag: "sentinels", Summary: "Get a sentinel", Role: auth.Viewer,
+			Response: common.SentinelSummary{}, Handler: v2GetSentinel},
+
+		{ID: "listJobs", Method: "GET", Path: "/jobs", Tag: "jobs", Summary: "List jobs, newest first", Role: auth.Viewer,
+			Query: append([]apiParam{
+				{"type", "Only jobs of this type: clone, reset, balance or drill"},
+				{"state", "Only jobs in this state: running, succeeded or failed"},
+				{"pod", "Glob pattern the job's pod must match"},
+			}, pageParams...), Response: common.Job{}, List: true, Handler: v2ListJobs},
+		{ID: "getJob", Method: "GET", Path: "/jobs/:id", Tag: "jobs", Summary: "Get a job", Role: auth.Viewer,
+			Response: common.Job{}, Handler: v2GetJob},
+
+		{ID: "listDrills", Method: "GET", Path: "/drills", Tag: "drills", Summary: "List drill reports, newest first", Role: auth.Viewer,
+			Query: append([]apiParam{
+				{"pod", "Glob pattern the drilled pod must match"},
+				{"result", "Only drills with this result: passed or failed"},
+			}, pageParams...), Response: common.DrillReport{}, List: true, Handler: v2ListDrills},
+		{ID: "getDrill", Method: "GET", Path: "/drills/:id", Tag: "drills", Summary: "Get a drill report", Role: auth.Viewer,
+			Response: common.DrillReport{}, Handler: v2GetDrill},
+
+		{ID: "listPodHistory", Method: "GET", Path: "/pods/:pod/history", Tag: "history", Summary: "List the pod's master changes and down periods, newest first", Role: auth.Viewer,
+			Query: append([]apiParam{
+				{"kind", "Only entries of this kind: master-change or down"},
+				{"since", "Only entries at or after this RFC 3339 time, and down periods ongoing then"},
+				formatParam,
+			}, pageParams...), Response: common.HistoryEntry{}, List: true, CSV: true, Handler: v2ListPodHistory},
+		{ID: "listSLA", Method: "GET", Path: "/sla", Tag: "history", Summary: "Report each pod's failovers and unavailable time over the SLA windows", Role: auth.Viewer,
+			Query: append([]apiParam{
+				{"pod", "Glob pattern the pod name must match"},
+				{"window", "Comma separated windows such as 24h,30d (default the configured SLA windows)"},
+				formatParam,
+			}, pageParams...), Response: common.PodSLA{}, List: true, CSV: true, Handler: v2ListSLA},
+
+		{ID: "listAlerts", Method: "GET", Path: "/alerts", Tag: "alerts", Summary: "List pending and firing alerts, firing and most severe first", Role: auth.Viewer,
+			Query: append([]apiParam{
+				{"state", "Only alerts in this state: pending or firing"},
+				{"severity", "Minimum severity: info, warning or critical"},
+				{"rule", "Glob pattern the alert's rule must match"},
+				{"pod", "Glob pattern the alert's pod must match"},
+			}, pageParams...), Response: common.Alert{}, List: true, Handler: v2ListAlerts},
+		{ID: "listAlertRules", Method: "GET", Path: "/alerts/rules", Tag: "alerts", Summary: "List the alert rules being evaluated", Role: auth.Viewer,
+			Query: pageParams, Response: common.AlertRule{}, List: true, Handler: v2ListAlertRules},
+		{ID: "reloadAlertRules", Method: "POST", Path: "/alerts/reload", Tag: "alerts", Summary: "Load the alert rule file again", Role: auth.Admin,
+			Response: common.APIResult{}, Handler: v2ReloadAlertRules},
+		{ID: "listSilences", Method: "GET", Path: "/silences", Tag: "alerts", Summary: "List silences which have not expired, soonest to expire first", Role: auth.Viewer,
+			Query: pageParams, Response: common.Silence{}, List: true, Handler: v2ListSilences},
+		{ID: "addSilence", Method: "POST", Path: "/silences", Tag: "alerts", Summary: "Silence the alerts matching a rule, pod or target pattern for a while", Role: auth.Operator,
+			Body: common.SilenceRequest{}, Response: common.Silence{}, Status: http.StatusCreated, Handler: v2AddSilence},
+		{ID: "expireSilence", Method: "DELETE", Path: "/silences/:id", Tag: "alerts", Summary: "Expire a silence early", Role: auth.Operator,
+			Response: common.APIResult{}, Handler: v2ExpireSilence},
+
+		{ID: "listEvents", Method: "GET", Path: "/events", Tag: "events", Summary: "List recent events, newest first", Role: auth.Viewer,
+			Query: append([]apiParam{
+				{"type", "Glob pattern the event type must match"},
+				{"pod", "Glob pattern the event's pod must match"},
+				{"severity", "Minimum severity: info, warning or critical"},
+				{"since", "Only events at or after this RFC 3339 time"},
+			}, pageParams...), Response: common.Event{}, List: true, Handler: v2ListEvents},
+		{ID: "streamEvents", Method: "GET", Path: "/events/stream", Tag: "events", Summary: "Stream events as they are published, as server-sent events", Role: auth.Viewer,
+			Query: []apiParam{
+				{"type", "Glob pattern the event type must match"},
+				{"pod", "Glob pattern the event's pod must match"},
+				{"severity", "Minimum severity: info, warning or critical"},
+			}, Response: common.Event{}, Stream: v2StreamEvents},
+	}
+}
+
+// APIv2OpenAPI serves the OpenAPI document describing the v2 API
+func APIv2OpenAPI(c web.C, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	packed, err := json.MarshalIndent(OpenAPIDocument(), "", "  ")
+	if err != nil {
+		writeV2(w, http.StatusInternalServerError, V2ErrorResponse{Error: apiError(http.StatusInternalServerError, common.ErrCodeInternal, "%s", err)})
+		return
+	}
+	w.Write(packed)
+}
+
+// OpenAPIDocument generates the OpenAPI 3 document for the v2 API from the
+// routes table
+func OpenAPIDocument() map[string]interface{} {
+	gen := &openAPIGen{schemas: make(map[string]interface{}), names: make(map[string]reflect.Type)}
+	errorSchema := gen.schema(reflect.TypeOf(V2ErrorResponse{}))
+	metaSchema := gen.schema(reflect.TypeOf(common.ListMeta{}))
+	paths := make(map[string]map[string]interface{})
+	for _, route := range apiV2Routes() {
+		p := openAPIPath(route.Path)
+		if paths[p] == nil {
+			paths[p] = make(map[string]interface{})
+		}
+		params := []interface{}{}
+		for _, seg := range strings.Split(route.Path, "/") {
+			if strings.HasPrefix(seg, ":") {
+				params = append(params, map[string]interface{}{
+					"name": seg[1:], "in": "path", "required": true,
+					"schema": map[string]interface{}{"type": "string"},
+				})
+			}
+		}
+		for _, q := range route.Query {
+			kind := "string"
+			if q.Name == "limit" || q.Name == "offset" {
+				kind = "integer"
+			}
+			params = append(params, map[string]interface{}{
+				"name": q.Name, "in": "query", "description": q.Description,
+				"schema": map[string]interface{}{"type": kind},
+			})
+		}
+
+		data := gen.schema(reflect.TypeOf(route.Response))
+		envelope := map[string]interface{}{"Data": data}
+		if route.List {
+			envelope["Data"] = map[string]interface{}{"type": "array", "items": data}
+			envelope["Meta"] = metaSchema
+		}
+		status := route.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		content := jsonContent(map[string]interface{}{
+			"type": "object", "properties": envelope,
+		})
+		if route.Stream != nil {
+			content = map[string]interface{}{"text/event-stream": map[string]interface{}{"schema": data}}
+		}
+		if route.CSV {
+			content["text/csv"] = map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+		}
+		op := map[string]interface{}{
+			"operationId": route.ID,
+			"summary":     route.Summary,
+			"description": fmt.Sprintf("Requires the %s role.", route.Role),
+			"tags":        []string{route.Tag},
+			"parameters":  params,
+			"responses": map[string]interface{}{
+				fmt.Sprint(status): map[string]interface{}{
+					"description": http.StatusText(status),
+					"content":     content,
+				},
+				"default": map[string]interface{}{
+					"description": "Error",
+					"content":     jsonContent(errorSchema),
+				},
+			},
+		}
+		if route.Body != nil {
+			op["requestBody"] = map[string]interface{}{
+				"content": jsonContent(gen.schema(reflect.TypeOf(route.Body))),
+			}
+		}
+		paths[p][strings.ToLower(route.Method)] = op
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "RedSkull API",
+			"version": "2",
+		},
+		"servers": []interface{}{map[string]interface{}{"url": APIv2Prefix}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": gen.schemas,
+			"securitySchemes": map[string]interface{}{
+				"basic":  map[string]interface{}{"type": "http", "scheme": "basic"},
+				"bearer": map[string]interface{}{"type": "http", "scheme": "bearer"},
+				"token":  map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-Redskull-Token"},
+			},
+		},
+	}
+}
+
+// openAPIPath converts a goji pattern to an OpenAPI path template
+func openAPIPath(pattern string) string {
+	segs := strings.Split(pattern, "/")
+	for i, seg := range segs {
+		if strings.HasPrefix(seg, ":") {
+			segs[i] = "{" + seg[1:] + "}"
+		}
+	}
+	return strings.Join(segs, "/")
+}
+
+func jsonContent(schema interface{}) map[string]interface{} {
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
+
+// openAPIGen builds schemas from Go types. Named structs become component
+// schemas referenced by $ref, which also handles recursive types such as
+// RedisNode.
+type openAPIGen struct {
+	schemas map[string]interface{}
+	names   map[string]reflect.Type
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+func (g *openAPIGen) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case durationType:
+		return map[string]interface{}{"type": "integer", "format": "int64", "description": "Nanoseconds"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		name := g.name(t)
+		if _, done := g.schemas[name]; !done {
+			// placeholder first so recursive types terminate
+			g.schemas[name] = map[string]interface{}{}
+			g.schemas[name] = g.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]interface{}{}
+}
+
+// name returns the component name for t, qualifying it with its package when
+// two packages use the same type name
+func (g *openAPIGen) name(t reflect.Type) string {
+	name := t.Name()
+	if other, taken := g.names[name]; taken && other != t {
+		pkg := t.PkgPath()
+		name = pkg[strings.LastIndex(pkg, "/")+1:] + "." + name
+	}
+	g.names[name] = t
+	return name
+}
+
+func (g *openAPIGen) structSchema(t reflect.Type) map[string]interface{} {
+	props := make(map[string]interface{})
+	g.addFields(t, props)
+	return map[string]interface{}{"type": "object", "properties": props}
+}
+
+// addFields adds t's fields to props the way encoding/json would marshal
+// them, flattening embedded structs
+func (g *openAPIGen) addFields(t reflect.Type, props map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			g.addFields(ft, props)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		switch ft.Kind() {
+		case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.schema(f.Type)
+	}
+}
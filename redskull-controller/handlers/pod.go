@@ -4,22 +4,24 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/therealbill/libredis/client"
+	"github.com/therealbill/redskull/redskull-controller/actions"
 	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-shared/logging"
 	"github.com/zenazn/goji/web"
 )
 
 // ShowPods shows the pods view page
 func ShowPods(c web.C, w http.ResponseWriter, r *http.Request) {
-	context, err := NewPageContext()
+	ctx := r.Context()
+	context, err := NewPageContext(ctx)
 	checkContextError(err, &w)
 	pods := context.Constellation.GetPods()
-	log.Printf("[SHOWPODS] Found %d pods", len(pods))
+	logging.Op("ShowPods").Debugf("Found %d pods", len(pods))
 	title := "Red Skull: Known Pods"
 	context.Title = title
 	context.ViewTemplate = "show_pods"
@@ -30,13 +32,13 @@ func ShowPods(c web.C, w http.ResponseWriter, r *http.Request) {
 			v.MissingSentinels = true
 		}
 		if v.Master == nil {
-			log.Print(v.Name, " has a nil master, probably can't log into it")
+			logging.Pod(v.Name).Warnf("%s has a nil master, probably can't log into it", v.Name)
 			v.HasInfo = false
 			pods[k] = v
 			continue
 		}
 		if v.Master.Info.Server.Version == "" {
-			log.Print(v.Name, " has a nil master.Info pointer, probably can't log into it")
+			logging.Pod(v.Name).Warnf("%s has a nil master.Info pointer, probably can't log into it", v.Name)
 			v.HasInfo = false
 			pods[k] = v
 			continue
@@ -50,25 +52,31 @@ func ShowPods(c web.C, w http.ResponseWriter, r *http.Request) {
 
 //ShowPod shows the view for a specific pod
 func ShowPod(c web.C, w http.ResponseWriter, r *http.Request) {
-	log.Print("ShowPod called")
+	ctx := r.Context()
+	logging.Debugf("ShowPod called")
 	type PodData struct {
-		Slaves     []*common.RedisNode
-		Conditions map[string]bool
-		Metrics    map[string]int
+		Slaves      []*common.RedisNode
+		Conditions  map[string]bool
+		Metrics     map[string]int
+		Topology    common.TopologyReport
+		Maintenance *common.PodMaintenance
+		SLA         []common.PodSLA
+		History     []common.HistoryEntry
 	}
 	target := c.URLParams["podName"]
-	context, err := NewPageContext()
+	context, err := NewPageContext(ctx)
 	checkContextError(err, &w)
 	context.Title = fmt.Sprintf("Pod: %s", target)
 	context.ViewTemplate = "show_pod"
-	pod, err := context.Constellation.GetPod(target)
+	context.CSRFToken = CSRFToken(c)
+	pod, err := context.Constellation.GetPod(ctx, target)
 	if err != nil {
-		log.Printf("Unable to c.GetPod(%s) -> Error: %s", target, err)
+		logging.Pod(target).Errorf("Unable to c.GetPod(%s) -> Error: %s", target, err)
 		context.Error = err
 		http.Error(w, "No such Pod", 404)
 		return
 	}
-	sentinels := context.Constellation.GetSentinelsForPod(target)
+	sentinels := context.Constellation.GetSentinelsForPod(ctx, target)
 	var updated_slaves []*common.RedisNode
 	if pod == nil {
 		// Need to load master here ...
@@ -79,16 +87,16 @@ func ShowPod(c web.C, w http.ResponseWriter, r *http.Request) {
 
 	eligibleSlaves := 0
 	for _, slave := range pod.Master.Slaves {
-		_, err := slave.UpdateData()
+		_, err := slave.UpdateData(ctx)
 		if err != nil {
-			log.Printf("Error on slave.UpdateData() %s", err.Error())
+			logging.Errorf("Error on slave.UpdateData() %s", err.Error())
 			continue
 		}
 		if slave.MaxMemory <= pod.Master.MaxMemory {
 			slave.HasEnoughMemoryForMaster = true
 		} else {
-			log.Printf("Slave %s has NOT enough memory", slave.Name)
-			log.Printf("Slave %s has %d needs %d", slave.Name, slave.MaxMemory, pod.Master.MaxMemory)
+			logging.Node(slave.Name).Warnf("Slave %s has NOT enough memory", slave.Name)
+			logging.Node(slave.Name).Debugf("Slave %s has %d needs %d", slave.Name, slave.MaxMemory, pod.Master.MaxMemory)
 		}
 		if slave.Info.Replication.SlavePriority > 0 {
 			eligibleSlaves++
@@ -112,6 +120,14 @@ func ShowPod(c web.C, w http.ResponseWriter, r *http.Request) {
 	flydata["HasFullSentinelComplement"] = neededSentinels <= metrics["LiveSentinels"]
 
 	data := PodData{Slaves: updated_slaves, Conditions: flydata, Metrics: metrics}
+	data.Topology, err = context.Constellation.CheckPodTopology(ctx, target)
+	if err != nil {
+		logging.Pod(target).Errorf("Unable to check topology of %s: %s", target, err)
+	}
+	if m, in := context.Constellation.GetPodMaintenance(target); in {
+		data.Maintenance = &m
+	}
+	data.SLA, data.History = podHistory(context.Constellation, target)
 	data.Slaves = updated_slaves
 	context.Pod = pod
 	context.Data = data
@@ -123,51 +139,56 @@ func ShowPod(c web.C, w http.ResponseWriter, r *http.Request) {
 
 // AddSlaveHTML shows the slave addition form
 func AddSlaveHTML(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	target := c.URLParams["podName"]
 	title := fmt.Sprintf("Add Slave To Pod: %s", target)
-	context, err := NewPageContext()
+	context, err := NewPageContext(ctx)
 	checkContextError(err, &w)
-	pod, _ := context.Constellation.GetPod(target)
+	pod, _ := context.Constellation.GetPod(ctx, target)
 	pod.Master.LastUpdateValid = false
-	pod.Master.UpdateData()
+	pod.Master.UpdateData(ctx)
 	context.Constellation.PodMap[pod.Name] = pod
 	context.Constellation.LocalPodMap[pod.Name] = pod
 	context.Constellation.RemotePodMap[pod.Name] = pod
 	context.Title = title
 	context.ViewTemplate = "add-slave-form"
+	context.CSRFToken = CSRFToken(c)
 	context.Pod = pod
 	render(w, context)
 }
 
 // APIAddSlave is the API call handler for adding a slave
 func APIAddSlave(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	target := c.URLParams["podName"]
-	context, err := NewPageContext()
+	context, err := NewPageContext(ctx)
 	checkContextError(err, &w)
-	pod, _ := context.Constellation.GetPod(target)
+	pod, _ := context.Constellation.GetPod(ctx, target)
 	body, err := ioutil.ReadAll(r.Body)
 	var response InfoResponse
 	var reqdata common.AddSlaveRequest
 	err = json.Unmarshal(body, &reqdata)
 	if err != nil {
 		retcode, em := throwJSONParseError(r)
-		log.Print(em)
+		logging.Errorf("%s", em)
 		http.Error(w, em, retcode)
 	}
 	reqdata.Podname = target
 	name := fmt.Sprintf("%s:%d", reqdata.SlaveAddress, reqdata.SlavePort)
-	slave_target, err := client.DialWithConfig(&client.DialConfig{Address: name, Password: reqdata.SlaveAuth})
-	defer slave_target.ClosePool()
+	slave_target, err := common.Dial(ctx, client.DialConfig{Address: name, Password: reqdata.SlaveAuth})
 	if err != nil {
-		log.Print("ERR: Dialing slave -", err)
+		logging.Errorf("ERR: Dialing slave - %s", err)
 		response.Status = "ERROR"
 		response.StatusMessage = "Unable to connect and command slave"
 		http.Error(w, "Unable to contact slave", 400)
 		return
 	}
-	err = slave_target.SlaveOf(pod.Info.IP, fmt.Sprintf("%d", pod.Info.Port))
+	defer slave_target.ClosePool()
+	err = common.Do(ctx, func() error {
+		return slave_target.SlaveOf(pod.Info.IP, fmt.Sprintf("%d", pod.Info.Port))
+	})
 	if err != nil {
-		log.Printf("Err: %v", err)
+		logging.Errorf("Err: %v", err)
 		if strings.Contains(err.Error(), "Already connected to specified master") {
 			response.Status = "NOOP"
 			response.StatusMessage = "Already connected to specified master"
@@ -179,8 +200,10 @@ func APIAddSlave(c web.C, w http.ResponseWriter, r *http.Request) {
 
 	pod.Master.LastUpdateValid = false
 	context.Constellation.PodMap[pod.Name] = pod
-	slave_target.ConfigSet("masterauth", pod.AuthToken)
-	slave_target.ConfigSet("requirepass", pod.AuthToken)
+	common.Do(ctx, func() error {
+		slave_target.ConfigSet("masterauth", pod.AuthToken)
+		return slave_target.ConfigSet("requirepass", pod.AuthToken)
+	})
 	response.Status = "COMPLETE"
 	response.StatusMessage = "Slave added"
 	packed, _ := json.Marshal(response)
@@ -190,22 +213,38 @@ func APIAddSlave(c web.C, w http.ResponseWriter, r *http.Request) {
 
 // BalancePodProcessor calls the constellation's BalancePod function for the pod
 func BalancePodProcessor(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	podname := c.URLParams["name"]
-	context, err := NewPageContext()
+	context, err := NewPageContext(ctx)
 	checkContextError(err, &w)
 	context.Title = "Pod Slave Result"
 	context.ViewTemplate = "balance-pod"
 	context.Refresh = true
 	context.RefreshURL = fmt.Sprintf("/pod/%s", podname)
 	context.RefreshTime = 5
-	pod, err := context.Constellation.GetPod(podname)
+	pod, err := context.Constellation.GetPod(ctx, podname)
 	if err != nil {
-		log.Print("Unable to obtain entry/data for pod: " + podname + " error returned=" + err.Error())
+		logging.Pod(podname).Errorf("Unable to obtain entry/data for pod: %s error returned=%s", podname, err)
 		context.Error = err
 		context.Refresh = false
 		render(w, context)
+		return
+	}
+	force := r.FormValue("force") == "true"
+	if !force && context.Constellation.InMaintenance(podname) {
+		context.Error = actions.ErrPodInMaintenance
+		context.Refresh = false
+		context.Pod = pod
+		render(w, context)
+		return
 	}
-	go context.Constellation.BalancePod(pod)
+	balanceCtx, cancel := detachedContext()
+	go func() {
+		defer cancel()
+		context.Constellation.Acquire()
+		defer context.Constellation.Release()
+		context.Constellation.BalancePod(balanceCtx, pod, force)
+	}()
 	context.Pod = pod
 	render(w, context)
 
@@ -213,12 +252,13 @@ func BalancePodProcessor(c web.C, w http.ResponseWriter, r *http.Request) {
 
 // AddSlaveHTMLProcessor is the action target for the AddSlaveHTML form
 func AddSlaveHTMLProcessor(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	r.ParseForm()
-	log.Print("add slave processor called")
+	logging.Debugf("add slave processor called")
 	podname := c.URLParams["podName"]
-	context, err := NewPageContext()
+	context, err := NewPageContext(ctx)
 	checkContextError(err, &w)
-	pod, _ := context.Constellation.GetPod(podname)
+	pod, _ := context.Constellation.GetPod(ctx, podname)
 	context.Title = "Pod Slave Result"
 	context.ViewTemplate = "slave-added"
 	context.Pod = pod
@@ -242,24 +282,28 @@ func AddSlaveHTMLProcessor(c web.C, w http.ResponseWriter, r *http.Request) {
 	}
 	res := results{PodName: podname, SlaveName: sname, SlaveAddress: address, SlavePort: port}
 	name := fmt.Sprintf("%s:%d", address, port)
-	slave_target, err := client.DialWithConfig(&client.DialConfig{Address: name, Password: slaveauth})
-	defer slave_target.ClosePool()
+	slave_target, err := common.Dial(ctx, client.DialConfig{Address: name, Password: slaveauth})
 	if err != nil {
-		log.Print("ERR: Dialing slave -", err)
+		logging.Errorf("ERR: Dialing slave - %s", err)
 		context.Data = err
 		render(w, context)
 		return
 	}
-	err = slave_target.SlaveOf(pod.Info.IP, fmt.Sprintf("%d", pod.Info.Port))
+	defer slave_target.ClosePool()
+	err = common.Do(ctx, func() error {
+		return slave_target.SlaveOf(pod.Info.IP, fmt.Sprintf("%d", pod.Info.Port))
+	})
 	if err != nil {
-		log.Printf("Err: %v", err)
+		logging.Errorf("Err: %v", err)
 	} else {
-		log.Printf("Slave added success")
-		slave_target.ConfigSet("masterauth", pod.AuthToken)
-		slave_target.ConfigSet("requirepass", pod.AuthToken)
-		slave, err := common.LoadNodeFromHostPort(address, port, pod.AuthToken)
+		logging.Infof("Slave added success")
+		common.Do(ctx, func() error {
+			slave_target.ConfigSet("masterauth", pod.AuthToken)
+			return slave_target.ConfigSet("requirepass", pod.AuthToken)
+		})
+		slave, err := common.LoadNodeFromHostPort(ctx, address, port, pod.AuthToken)
 		if err != nil {
-			log.Printf("In AddSlaveHTMLProcessor, unable to get new slave node")
+			logging.Errorf("In AddSlaveHTMLProcessor, unable to get new slave node")
 		} else {
 			pod.Master.Slaves = append(pod.Master.Slaves, slave)
 		}
@@ -271,19 +315,50 @@ func AddSlaveHTMLProcessor(c web.C, w http.ResponseWriter, r *http.Request) {
 
 // ResetPodProcessor is called to reset the pod's slave&sentinel configuration
 func ResetPodProcessor(c web.C, w http.ResponseWriter, r *http.Request) {
-	r.ParseForm()
-	log.Print("reset pod processor called")
+	ctx := r.Context()
+	logging.Debugf("reset pod processor called")
 	podname := c.URLParams["name"]
-	context, err := NewPageContext()
+	if !confirmed(c, w, r, resetConfirmation(podname)) {
+		return
+	}
+	context, err := NewPageContext(ctx)
 	checkContextError(err, &w)
-	pod, _ := context.Constellation.GetPod(podname)
+	pod, _ := context.Constellation.GetPod(ctx, podname)
 	context.Title = "Pod Slave Result"
 	context.ViewTemplate = "reset-issued"
 	context.Refresh = true
 	context.RefreshURL = fmt.Sprintf("/pod/%s", pod.Name)
 	context.RefreshTime = 10
 	context.Pod = pod
-	go context.Constellation.ResetPod(podname, false)
+	resetCtx, cancel := detachedContext()
+	go func() {
+		defer cancel()
+		context.Constellation.Acquire()
+		defer context.Constellation.Release()
+		context.Constellation.ResetPod(resetCtx, podname, false)
+	}()
 	render(w, context)
 
 }
+
+// ShowPodSentinels shows each sentinel's view of the pod and where they
+// disagree
+func ShowPodSentinels(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	target := c.URLParams["podName"]
+	context, err := NewPageContext(ctx)
+	checkContextError(err, &w)
+	context.Title = fmt.Sprintf("Pod: %s", target)
+	context.SubTitle = "Sentinel Consistency"
+	context.ViewTemplate = "pod-sentinels"
+	report, err := context.Constellation.ValidatePodSentinels(ctx, target)
+	if err != nil && len(report.Views) == 0 {
+		http.Error(w, err.Error(), 404)
+		return
+	}
+	context.Data = report
+	context.Refresh = true
+	context.RefreshURL = fmt.Sprintf("/pod/%s/sentinels", target)
+	context.RefreshTime = 15
+	render(w, context)
+}
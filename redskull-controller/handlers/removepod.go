@@ -1,16 +1,22 @@
 package handlers
 
 import (
-	"log"
 	"net/http"
 
+	"github.com/therealbill/redskull/redskull-shared/logging"
 	"github.com/zenazn/goji/web"
 )
 
-// RemovePodHTML is the action target for adding a pod. It does the heavy lifting
+// RemovePodHTML is the action target for the remove pod confirmation. It
+// does the heavy lifting
 func RemovePodHTML(c web.C, w http.ResponseWriter, r *http.Request) {
-	log.Print("########### REMOVE POD PROCESSING ###########")
-	context, err := NewPageContext()
+	ctx := r.Context()
+	podname := c.URLParams["podname"]
+	if !confirmed(c, w, r, removeConfirmation(podname)) {
+		return
+	}
+	logging.Debugf("########### REMOVE POD PROCESSING ###########")
+	context, err := NewPageContext(ctx)
 	checkContextError(err, &w)
 	context.Title = "Pod Remove Result"
 	context.ViewTemplate = "removepod"
@@ -20,20 +26,18 @@ func RemovePodHTML(c web.C, w http.ResponseWriter, r *http.Request) {
 		Error    string
 		HasError bool
 	}
-	podname := c.URLParams["podname"]
 	res := results{Name: podname}
 
-	_, err = context.Constellation.RemovePod(podname)
+	_, err = context.Constellation.RemovePod(ctx, podname)
 	if err != nil {
-		log.Printf("Error on remove pod: %s", err.Error())
+		logging.Pod(podname).Errorf("Error on remove pod: %s", err.Error())
 		res.Message = "Error on attempt to remove pod"
 		res.Error = err.Error()
 		res.HasError = true
-		return
 	} else {
 		res.Message = "Pod " + podname + " was removed from management"
 	}
 	context.Data = res
-	log.Print("########### REMOVE POD PROCESSED ###########")
+	logging.Debugf("########### REMOVE POD PROCESSED ###########")
 	render(w, context)
 }
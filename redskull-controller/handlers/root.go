@@ -1,20 +1,21 @@
 package handlers
 
 import (
-	"log"
 	"net/http"
 
+	"github.com/therealbill/redskull/redskull-shared/logging"
 	"github.com/zenazn/goji/web"
 )
 
 // Root shows the index page of Red Skull, if you didn't want to display the
 // dashboard at the root.
 func Root(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	//ManagedConstellation.LoadPods()
-	context, err := NewPageContext()
+	context, err := NewPageContext(ctx)
 	checkContextError(err, &w)
 	context.Title = "Welcome to the Redis Manager"
 	context.ViewTemplate = "index"
-	log.Print("Index called")
+	logging.Debugf("Index called")
 	render(w, context)
 }
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/therealbill/redskull/redskull-shared/auth"
+	"github.com/zenazn/goji/web"
+)
+
+// PodAuthResponse carries a pod's auth token
+type PodAuthResponse struct {
+	Pod       string
+	AuthToken string
+}
+
+// APIGetPodAuth returns the pod's auth token. Every other response masks it;
+// this is the one place it can be retrieved, and every call is audited.
+func APIGetPodAuth(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var response InfoResponse
+	podname := c.URLParams["podName"]
+	context, err := NewPageContext(ctx)
+	checkContextError(err, &w)
+	auth.Audit(c, r, "get-pod-auth", podname)
+	token := context.Constellation.GetPodAuth(podname)
+	if token == "" {
+		response.Status = "NOTFOUND"
+		response.StatusMessage = "No auth token known for pod '" + podname + "'"
+		w.WriteHeader(404)
+	} else {
+		response.Status = "COMPLETE"
+		response.Data = PodAuthResponse{Pod: podname, AuthToken: token}
+	}
+	packed, _ := json.Marshal(response)
+	w.Write(packed)
+}
+
+// APIGetPodAuthVersions returns the history of the pod's auth token. Secrets
+// are masked; only the version metadata is returned.
+func APIGetPodAuthVersions(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var response InfoResponse
+	podname := c.URLParams["podName"]
+	context, err := NewPageContext(ctx)
+	checkContextError(err, &w)
+	store := context.Constellation.Credentials
+	if store == nil {
+		response.Status = "ERROR"
+		response.StatusMessage = "Credential store is not running"
+		w.WriteHeader(503)
+	} else {
+		response.Status = "COMPLETE"
+		response.Data = store.Versions(podname)
+	}
+	packed, _ := json.Marshal(response)
+	w.Write(packed)
+}
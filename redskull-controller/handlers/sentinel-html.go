@@ -2,31 +2,40 @@ package handlers
 
 import (
 	"fmt"
-	"log"
 	"net/http"
 
+	"github.com/therealbill/redskull/redskull-controller/actions"
+	"github.com/therealbill/redskull/redskull-shared/logging"
 	"github.com/zenazn/goji/web"
 )
 
 // DoFailoverHTML is how the UI initiates a failover for a pod
 func DoFailoverHTML(c web.C, w http.ResponseWriter, r *http.Request) {
-	// Needs changed to use templates!
+	ctx := r.Context()
 	podname := c.URLParams["name"]
-	context, err := NewPageContext()
+	if !confirmed(c, w, r, failoverConfirmation(podname)) {
+		return
+	}
+	context, err := NewPageContext(ctx)
 	checkContextError(err, &w)
 	context.ViewTemplate = "failover-requested"
 	context.Refresh = true
 	context.RefreshTime = 10
 	context.RefreshURL = fmt.Sprintf("/pod/%s", podname)
-	log.Printf("Failover requested for pod '%s'", podname)
-	didFailover, err := context.Constellation.Failover(podname)
+	logging.Pod(podname).Infof("Failover requested for pod '%s'", podname)
+	didFailover, err := context.Constellation.Failover(ctx, podname, r.FormValue("force") == "true")
+	if err == actions.ErrPodInMaintenance {
+		w.WriteHeader(http.StatusConflict)
+		renderConfirmation(ctx, c, w, failoverConfirmation(podname), err)
+		return
+	}
 	if err != nil {
 		retcode, emsg := handleFailoverError(podname, r, err)
-		log.Printf("%d: '%s'", retcode, emsg)
+		logging.Warnf("%d: '%s'", retcode, emsg)
 	}
 	if !didFailover {
 		retcode, emsg := handleFailoverError(podname, r, err)
-		log.Printf("%d: '%s'", retcode, emsg)
+		logging.Warnf("%d: '%s'", retcode, emsg)
 	}
 	render(w, context)
 }
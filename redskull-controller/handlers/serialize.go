@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/therealbill/redskull/redskull-controller/actions"
+	"github.com/zenazn/goji/web"
+)
+
+// Serialize is middleware keeping requests from using the constellation
+// while it is being changed. GET and HEAD requests only read it, so each
+// works on its own snapshot of the constellation, taken when the handler
+// first asks for it, and never waits for the lock. Other requests hold the
+// constellation's lock while their handler runs. Their response is buffered
+// and only sent once the lock is released, so a slow client does not keep
+// it. Static files and the event stream, which use no constellation state,
+// are passed straight through.
+func Serialize(c *web.C, h http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if constellation.Name == "" || !serialized(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if r.Method == "GET" || r.Method == "HEAD" {
+			ctx := context.WithValue(r.Context(), snapshotKey{}, new(requestSnapshot))
+			h.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+		res := &bufferedResponse{w: w}
+		func() {
+			constellation.Acquire()
+			defer constellation.Release()
+			h.ServeHTTP(res, r)
+		}()
+		res.send()
+	}
+	return http.HandlerFunc(fn)
+}
+
+// serialized returns false for the requests Serialize lets through
+// untouched
+func serialized(r *http.Request) bool {
+	if strings.HasPrefix(r.URL.Path, "/static/") {
+		return false
+	}
+	return r.URL.Path != APIv2Prefix+"/events/stream"
+}
+
+type snapshotKey struct{}
+
+// requestSnapshot is the snapshot a reading request works on
+type requestSnapshot struct {
+	once sync.Once
+	con  *actions.Constellation
+}
+
+// requestConstellation returns the constellation the request with the given
+// context works on: a snapshot for a reading request, the constellation
+// itself otherwise
+func requestConstellation(ctx context.Context) *actions.Constellation {
+	s, ok := ctx.Value(snapshotKey{}).(*requestSnapshot)
+	if !ok {
+		return &constellation
+	}
+	s.once.Do(func() {
+		s.con = constellation.Snapshot()
+	})
+	return s.con
+}
+
+// bufferedResponse holds a response's status and body until send is
+// called. Headers are set on the underlying writer directly.
+type bufferedResponse struct {
+	w      http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.w.Header()
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.body.Write(p)
+}
+
+// send writes the held response to the underlying writer
+func (b *bufferedResponse) send() {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	b.w.WriteHeader(b.status)
+	b.w.Write(b.body.Bytes())
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/therealbill/redskull/redskull-controller/simulate"
+	"github.com/therealbill/redskull/redskull-shared/auth"
+	"github.com/zenazn/goji/web"
+)
+
+// Simulation is the synthetic constellation being served in simulate mode,
+// or nil
+var Simulation *simulate.Simulation
+
+// FailureRequest asks for a simulated failure. An empty Target picks one.
+type FailureRequest struct {
+	Kind   string
+	Target string
+}
+
+// APIGetSimulation returns the simulated topology and active failures
+func APIGetSimulation(c web.C, w http.ResponseWriter, r *http.Request) {
+	response := InfoResponse{Status: "COMPLETE", Data: Simulation.Status()}
+	packed, _ := json.Marshal(response)
+	w.Write(packed)
+}
+
+// APIInjectFailure starts a simulated failure
+func APIInjectFailure(c web.C, w http.ResponseWriter, r *http.Request) {
+	var (
+		response InfoResponse
+		reqdata  FailureRequest
+	)
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &reqdata)
+	}
+	if err != nil {
+		retcode, em := throwJSONParseError(r)
+		http.Error(w, em, retcode)
+		return
+	}
+	failure, err := Simulation.Inject(reqdata.Kind, reqdata.Target)
+	if err != nil {
+		response.Status = "ERROR"
+		response.StatusMessage = err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+	} else {
+		auth.Audit(c, r, "inject-failure", failure.Kind+" "+failure.Target)
+		response.Status = "COMPLETE"
+		response.Data = failure
+	}
+	packed, _ := json.Marshal(response)
+	w.Write(packed)
+}
+
+// APIHealFailure ends a simulated failure
+func APIHealFailure(c web.C, w http.ResponseWriter, r *http.Request) {
+	var response InfoResponse
+	id := c.URLParams["id"]
+	err := Simulation.Heal(id)
+	if err != nil {
+		response.Status = "ERROR"
+		response.StatusMessage = err.Error()
+		w.WriteHeader(http.StatusNotFound)
+	} else {
+		auth.Audit(c, r, "heal-failure", id)
+		response.Status = "COMPLETE"
+		response.StatusMessage = "Failure healed"
+	}
+	packed, _ := json.Marshal(response)
+	w.Write(packed)
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-shared/auth"
+	"github.com/therealbill/redskull/redskull-shared/logging"
+	"github.com/zenazn/goji/web"
+)
+
+// APIExportConstellation returns a snapshot of the constellation topology.
+// Passing encrypt=true in the query string encrypts pod auth tokens with the
+// configured secret key. Every export is audited, and plaintext ones are
+// recorded as such.
+func APIExportConstellation(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	context, err := NewPageContext(ctx)
+	checkContextError(err, &w)
+	encrypt := r.URL.Query().Get("encrypt") == "true"
+	action := "export-plaintext"
+	if encrypt {
+		action = "export-encrypted"
+	}
+	auth.Audit(c, r, action, context.Constellation.Name)
+	snap, err := context.Constellation.ExportSnapshot(ctx, encrypt)
+	if err != nil {
+		logging.Errorf("Export error: %s", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	packed, _ := json.MarshalIndent(snap, "", "  ")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", "attachment; filename=constellation-snapshot.json")
+	w.Write(packed)
+}
+
+// APIRestoreConstellation re-monitors the pods in the posted snapshot
+func APIRestoreConstellation(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var (
+		response InfoResponse
+		snap     common.ConstellationSnapshot
+	)
+	body, err := ioutil.ReadAll(r.Body)
+	err = json.Unmarshal(body, &snap)
+	if err != nil {
+		retcode, em := throwJSONParseError(r)
+		logging.Errorf("%s", em)
+		http.Error(w, em, retcode)
+		return
+	}
+	context, err := NewPageContext(ctx)
+	checkContextError(err, &w)
+	report, err := context.Constellation.RestoreSnapshot(ctx, snap)
+	if err != nil {
+		response.Status = "ERROR"
+		response.StatusMessage = err.Error()
+	} else {
+		response.Status = "COMPLETE"
+		for _, res := range report.Results {
+			if res.Error != "" {
+				response.Status = "INCOMPLETE"
+				response.StatusMessage = "One or more pods failed to restore"
+				break
+			}
+		}
+		response.Data = report
+	}
+	packed, _ := json.Marshal(response)
+	w.Write(packed)
+}
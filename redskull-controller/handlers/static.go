@@ -2,10 +2,10 @@ package handlers
 
 import (
 	"io"
-	"log"
 	"net/http"
 	"time"
 
+	"github.com/therealbill/redskull/redskull-shared/logging"
 	"github.com/zenazn/goji/web"
 )
 
@@ -26,7 +26,7 @@ func Static(c web.C, w http.ResponseWriter, req *http.Request) {
 			http.ServeContent(w, req, static_file, time.Now(), content)
 			return
 		}
-		log.Print(err)
+		logging.Infof("%s", err)
 	}
 	http.NotFound(w, req)
 }
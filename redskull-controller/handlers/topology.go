@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/zenazn/goji/web"
+)
+
+// APIGetPodTopology checks the pod's replication topology against its
+// sentinels and returns the findings
+func APIGetPodTopology(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var response InfoResponse
+	podname := c.URLParams["podName"]
+	context, err := NewPageContext(ctx)
+	checkContextError(err, &w)
+	report, err := context.Constellation.CheckPodTopology(ctx, podname)
+	response.Data = report
+	switch {
+	case err != nil:
+		response.Status = "ERROR"
+		response.StatusMessage = err.Error()
+	case report.HasFindings():
+		response.Status = "FINDINGS"
+		response.StatusMessage = "Topology anomalies found"
+	default:
+		response.Status = "COMPLETE"
+	}
+	packed, _ := json.Marshal(response)
+	w.Write(packed)
+}
+
+// APIGetTopology checks every pod's topology. Only pods with findings or
+// errors are returned unless all=true is given in the query string.
+func APIGetTopology(c web.C, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var response InfoResponse
+	context, err := NewPageContext(ctx)
+	checkContextError(err, &w)
+	all := r.URL.Query().Get("all") == "true"
+	reports := []common.TopologyReport{}
+	for _, report := range context.Constellation.CheckTopology(ctx) {
+		if all || report.HasFindings() || len(report.Errors) > 0 {
+			reports = append(reports, report)
+		}
+	}
+	response.Status = "COMPLETE"
+	response.Data = reports
+	packed, _ := json.Marshal(response)
+	w.Write(packed)
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/therealbill/redskull/redskull-controller/events"
+	"github.com/therealbill/redskull/redskull-shared/auth"
+	"github.com/zenazn/goji/web"
+)
+
+// APIGetWebhooks returns the configured webhook sinks, with secrets masked
+func APIGetWebhooks(c web.C, w http.ResponseWriter, r *http.Request) {
+	response := InfoResponse{Status: "COMPLETE"}
+	if events.Webhooks == nil {
+		response.StatusMessage = "No webhooks are configured"
+		response.Data = []events.WebhookSink{}
+	} else {
+		response.Data = events.Webhooks.Sinks()
+	}
+	packed, _ := json.Marshal(response)
+	w.Write(packed)
+}
+
+// APIGetWebhookDeliveries returns the webhook delivery log, newest first
+func APIGetWebhookDeliveries(c web.C, w http.ResponseWriter, r *http.Request) {
+	response := InfoResponse{Status: "COMPLETE"}
+	if events.Webhooks == nil {
+		response.Data = []events.Delivery{}
+	} else {
+		response.Data = events.Webhooks.Deliveries()
+	}
+	packed, _ := json.Marshal(response)
+	w.Write(packed)
+}
+
+// APITestWebhook sends a test event to the named webhook
+func APITestWebhook(c web.C, w http.ResponseWriter, r *http.Request) {
+	var response InfoResponse
+	name := c.URLParams["name"]
+	auth.Audit(c, r, "test-webhook", name)
+	if events.Webhooks == nil {
+		response.Status = "NOTFOUND"
+		response.StatusMessage = "No webhooks are configured"
+		w.WriteHeader(404)
+	} else if err := events.Webhooks.Test(name); err != nil {
+		response.Status = "ERROR"
+		response.StatusMessage = err.Error()
+		w.WriteHeader(502)
+	} else {
+		response.Status = "COMPLETE"
+		response.StatusMessage = "Test event delivered"
+	}
+	packed, _ := json.Marshal(response)
+	w.Write(packed)
+}
@@ -0,0 +1,337 @@
+package integration
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/therealbill/redskull/redskull-controller/actions"
+	"github.com/therealbill/redskull/redskull-controller/common"
+)
+
+// notices records the alerts a notifier is told of
+type notices struct {
+	sync.Mutex
+	alerts []common.Alert
+}
+
+func (n *notices) Notify(ctx context.Context, a common.Alert) error {
+	n.Lock()
+	n.alerts = append(n.alerts, a)
+	n.Unlock()
+	return nil
+}
+
+// take returns the alerts notified since the last take
+func (n *notices) take() []common.Alert {
+	n.Lock()
+	defer n.Unlock()
+	alerts := n.alerts
+	n.alerts = nil
+	return alerts
+}
+
+// loadAlertRules writes rules to a file and loads it as the constellation's
+// alert rule file, returning the notifier the rules name as "record"
+func loadAlertRules(t *testing.T, c *cluster, rules string) *notices {
+	t.Helper()
+	recorder := &notices{}
+	actions.RegisterAlertNotifier("record", recorder)
+	writeAlertRules(t, rules)
+	if _, err := c.con.ReloadAlertRules(context.Background()); err != nil {
+		t.Fatalf("ReloadAlertRules: %s", err)
+	}
+	return recorder
+}
+
+// writeAlertRules writes the rule file and points AlertRuleFile at it
+func writeAlertRules(t *testing.T, rules string) {
+	t.Helper()
+	if actions.AlertRuleFile == "" {
+		dir, err := ioutil.TempDir("", "redskull-alerts")
+		if err != nil {
+			t.Fatal(err)
+		}
+		actions.AlertRuleFile = filepath.Join(dir, "alerts.yml")
+		t.Cleanup(func() {
+			os.RemoveAll(dir)
+			actions.AlertRuleFile = ""
+		})
+	}
+	if err := ioutil.WriteFile(actions.AlertRuleFile, []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func findAlert(alerts []common.Alert, rule, target string) (common.Alert, bool) {
+	for _, a := range alerts {
+		if a.Rule == rule && a.Target == target {
+			return a, true
+		}
+	}
+	return common.Alert{}, false
+}
+
+func TestAlertsForDuration(t *testing.T) {
+	ctx := context.Background()
+	c := newCluster(t, 3, 3)
+	recorder := loadAlertRules(t, c, `
+rules:
+  - name: lagging
+    metric: replica-lag
+    op: ">"
+    value: 5
+    for: 200ms
+    severity: critical
+    notify: [record]
+`)
+	slave := c.pod.Slaves()[0]
+	slave.SetLag(10)
+
+	c.con.EvaluateAlerts(ctx)
+	a, ok := findAlert(c.con.Alerts.Alerts(), "lagging", slave.Addr())
+	if !ok || a.State != common.AlertPending || a.Pod != "pod1" || a.Value != 10 {
+		t.Fatalf("alert after the first evaluation is %+v, %v, want pending", a, ok)
+	}
+	if got := recorder.take(); len(got) != 0 {
+		t.Fatalf("pending alert was notified: %+v", got)
+	}
+
+	time.Sleep(250 * time.Millisecond)
+	c.con.EvaluateAlerts(ctx)
+	got := recorder.take()
+	if len(got) != 1 || got[0].State != common.AlertFiring || got[0].Severity != common.SeverityCritical {
+		t.Fatalf("notified %+v, want the alert firing once", got)
+	}
+	c.con.EvaluateAlerts(ctx)
+	if got := recorder.take(); len(got) != 0 {
+		t.Errorf("firing alert was notified again: %+v", got)
+	}
+
+	slave.SetLag(0)
+	c.con.EvaluateAlerts(ctx)
+	got = recorder.take()
+	if len(got) != 1 || got[0].State != common.AlertResolved || got[0].Target != slave.Addr() {
+		t.Fatalf("notified %+v, want the alert resolved", got)
+	}
+	if alerts := c.con.Alerts.Alerts(); len(alerts) != 0 {
+		t.Errorf("alerts after resolving are %+v", alerts)
+	}
+
+	// A condition which clears before its for duration is never notified
+	slave.SetLag(10)
+	c.con.EvaluateAlerts(ctx)
+	slave.SetLag(0)
+	c.con.EvaluateAlerts(ctx)
+	if got := recorder.take(); len(got) != 0 {
+		t.Errorf("alert which never fired was notified: %+v", got)
+	}
+}
+
+func TestAlertsSilence(t *testing.T) {
+	ctx := context.Background()
+	c := newCluster(t, 3, 3)
+	recorder := loadAlertRules(t, c, `
+rules:
+  - name: no-promotable-slaves
+    metric: promotable-slaves
+    op: "<"
+    value: 1
+    notify: [record]
+`)
+	c.con.EvaluateAlerts(ctx)
+	if alerts := c.con.Alerts.Alerts(); len(alerts) != 0 {
+		t.Fatalf("alerts with a promotable slave are %+v", alerts)
+	}
+
+	silence, err := c.con.Alerts.AddSilence(common.Silence{Pod: "pod1", Expires: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.pod.Slaves()[0].SetConfig("slave-priority", "0")
+	c.con.EvaluateAlerts(ctx)
+	a, ok := findAlert(c.con.Alerts.Alerts(), "no-promotable-slaves", "pod1")
+	if !ok || a.State != common.AlertFiring || !a.Silenced || a.Notified {
+		t.Fatalf("alert under a silence is %+v, %v, want firing and silenced", a, ok)
+	}
+	if got := recorder.take(); len(got) != 0 {
+		t.Fatalf("silenced alert was notified: %+v", got)
+	}
+
+	// Once the silence ends the alert still firing is notified
+	if ok, err := c.con.Alerts.ExpireSilence(silence.ID); !ok || err != nil {
+		t.Fatalf("ExpireSilence returned %v, %v", ok, err)
+	}
+	c.con.EvaluateAlerts(ctx)
+	got := recorder.take()
+	if len(got) != 1 || got[0].State != common.AlertFiring || got[0].Silenced {
+		t.Fatalf("notified %+v, want the alert firing once the silence ended", got)
+	}
+
+	// Pods in maintenance are not evaluated, so their alerts resolve
+	if _, err := c.con.SetPodMaintenance(ctx, "pod1", "testing", "integration", time.Time{}, false); err != nil {
+		t.Fatal(err)
+	}
+	c.con.EvaluateAlerts(ctx)
+	got = recorder.take()
+	if len(got) != 1 || got[0].State != common.AlertResolved {
+		t.Errorf("notified %+v, want the alert resolved while the pod is in maintenance", got)
+	}
+}
+
+func TestAlertsNodesAndSentinels(t *testing.T) {
+	ctx := context.Background()
+	c := newCluster(t, 3, 3)
+	recorder := loadAlertRules(t, c, `
+rules:
+  - name: memory
+    metric: node-memory-percent
+    op: ">="
+    value: 90
+    notify: [record]
+  - name: sentinel-down
+    metric: sentinel-unreachable
+    op: "=="
+    value: 1
+    notify: [record]
+`)
+	master := c.pod.Master()
+	master.SetConfig("maxmemory", "1000")
+	master.SetUsedMemory(950)
+	c.sentinels[2].Stop()
+
+	c.con.EvaluateAlerts(ctx)
+	got := recorder.take()
+	if len(got) != 2 {
+		t.Fatalf("notified %+v, want the master's memory and the stopped sentinel", got)
+	}
+	if a, ok := findAlert(got, "memory", master.Addr()); !ok || a.Value != 95 || a.Pod != "pod1" {
+		t.Errorf("memory alert is %+v, %v, want the master at 95%%", a, ok)
+	}
+	if a, ok := findAlert(got, "sentinel-down", c.sentinels[2].Addr()); !ok || a.Pod != "" {
+		t.Errorf("sentinel alert is %+v, %v, want %s unreachable", a, ok, c.sentinels[2].Addr())
+	}
+}
+
+func TestAlertsReload(t *testing.T) {
+	ctx := context.Background()
+	c := newCluster(t, 3, 3)
+	recorder := loadAlertRules(t, c, `
+rules:
+  - name: kept
+    metric: promotable-slaves
+    op: ">="
+    value: 1
+    notify: [record]
+  - name: removed
+    metric: promotable-slaves
+    op: ">"
+    value: 0
+    notify: [record]
+`)
+	c.con.EvaluateAlerts(ctx)
+	if got := recorder.take(); len(got) != 2 {
+		t.Fatalf("notified %+v, want both rules firing", got)
+	}
+	kept, _ := findAlert(c.con.Alerts.Alerts(), "kept", "pod1")
+
+	writeAlertRules(t, `
+rules:
+  - name: kept
+    metric: promotable-slaves
+    op: ">="
+    value: 1
+    severity: critical
+    notify: [record]
+`)
+	if n, err := c.con.ReloadAlertRules(ctx); n != 1 || err != nil {
+		t.Fatalf("ReloadAlertRules returned %d, %v", n, err)
+	}
+	got := recorder.take()
+	if len(got) != 1 || got[0].Rule != "removed" || got[0].State != common.AlertResolved {
+		t.Fatalf("notified %+v, want the removed rule's alert resolved", got)
+	}
+	c.con.EvaluateAlerts(ctx)
+	if got := recorder.take(); len(got) != 0 {
+		t.Errorf("kept rule's alert was notified again: %+v", got)
+	}
+	a, ok := findAlert(c.con.Alerts.Alerts(), "kept", "pod1")
+	if !ok || !a.FiredAt.Equal(kept.FiredAt) || a.Severity != common.SeverityCritical {
+		t.Errorf("kept alert is %+v, want it still firing since %s with the new severity", a, kept.FiredAt)
+	}
+
+	writeAlertRules(t, "rules:\n  - name: broken\n    metric: nonsense\n    op: '>'\n")
+	if _, err := c.con.ReloadAlertRules(ctx); err == nil {
+		t.Error("ReloadAlertRules accepted an unknown metric")
+	}
+	if rules := c.con.Alerts.Rules(); len(rules) != 1 || rules[0].Name != "kept" {
+		t.Errorf("rules after a failed reload are %+v, want the previous ones", rules)
+	}
+}
+
+func TestAPIAlerts(t *testing.T) {
+	ctx := context.Background()
+	c := newCluster(t, 3, 3)
+	server := apiServer(t, c)
+	loadAlertRules(t, c, `
+rules:
+  - name: lagging
+    metric: replica-lag
+    op: ">"
+    value: 5
+`)
+	slave := c.pod.Slaves()[0]
+	slave.SetLag(10)
+	c.con.EvaluateAlerts(ctx)
+
+	var alerts []common.Alert
+	if status, apiErr := call(t, server, "GET", "/alerts?state=firing&pod=pod*", nil, &alerts); apiErr != nil {
+		t.Fatalf("GET alerts: %d %s", status, apiErr.Message)
+	}
+	if len(alerts) != 1 || alerts[0].Target != slave.Addr() || alerts[0].Severity != common.SeverityWarning {
+		t.Errorf("alerts are %+v, want the lagging slave at the default severity", alerts)
+	}
+	if status, apiErr := call(t, server, "GET", "/alerts?severity=critical", nil, &alerts); apiErr != nil || len(alerts) != 0 {
+		t.Errorf("GET critical alerts: %d %v %+v", status, apiErr, alerts)
+	}
+	var rules []common.AlertRule
+	if status, apiErr := call(t, server, "GET", "/alerts/rules", nil, &rules); apiErr != nil || len(rules) != 1 {
+		t.Errorf("GET alert rules: %d %v %+v", status, apiErr, rules)
+	}
+
+	var silence common.Silence
+	status, apiErr := call(t, server, "POST", "/silences", common.SilenceRequest{Rule: "lagging", Duration: "1h", Comment: "known"}, &silence)
+	if apiErr != nil || status != http.StatusCreated || silence.ID == "" {
+		t.Fatalf("POST silence: %d %v %+v", status, apiErr, silence)
+	}
+	if status, apiErr := call(t, server, "POST", "/silences", common.SilenceRequest{Rule: "lagging", Duration: "soon"}, nil); apiErr == nil || apiErr.Code != common.ErrCodeInvalidRequest {
+		t.Errorf("POST silence with a bad duration: %d %v", status, apiErr)
+	}
+	c.con.EvaluateAlerts(ctx)
+	if call(t, server, "GET", "/alerts", nil, &alerts); len(alerts) != 1 || !alerts[0].Silenced {
+		t.Errorf("alerts are %+v, want the lagging slave silenced", alerts)
+	}
+	var silences []common.Silence
+	if status, apiErr := call(t, server, "GET", "/silences", nil, &silences); apiErr != nil || len(silences) != 1 {
+		t.Errorf("GET silences: %d %v %+v", status, apiErr, silences)
+	}
+	if status, apiErr := call(t, server, "DELETE", "/silences/"+silence.ID, nil, nil); apiErr != nil {
+		t.Errorf("DELETE silence: %d %s", status, apiErr.Message)
+	}
+	if status, apiErr := call(t, server, "DELETE", "/silences/"+silence.ID, nil, nil); apiErr == nil || apiErr.Code != common.ErrCodeSilenceNotFound {
+		t.Errorf("DELETE expired silence: %d %v", status, apiErr)
+	}
+
+	writeAlertRules(t, "rules: []\n")
+	if status, apiErr := call(t, server, "POST", "/alerts/reload", nil, nil); apiErr != nil {
+		t.Fatalf("POST reload: %d %s", status, apiErr.Message)
+	}
+	if call(t, server, "GET", "/alerts/rules", nil, &rules); len(rules) != 0 {
+		t.Errorf("rules after reloading an empty file are %+v", rules)
+	}
+}
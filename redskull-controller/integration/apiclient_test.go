@@ -0,0 +1,32 @@
+package integration
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/therealbill/redskull/redskull-controller/apiclient"
+)
+
+// TestAPIClientEscapesOnce checks names are escaped exactly once on the wire
+func TestAPIClientEscapesOnce(t *testing.T) {
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.RequestURI
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"Data":{}}`))
+	}))
+	defer server.Close()
+
+	c, err := apiclient.NewClient(apiclient.Config{URL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetPod(context.Background(), "pod a/b%"); err != nil {
+		t.Fatal(err)
+	}
+	if want := "/api/v2/pods/pod%20a%2Fb%25"; got != want {
+		t.Errorf("request URI = %q, want %q", got, want)
+	}
+}
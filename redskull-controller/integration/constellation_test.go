@@ -0,0 +1,219 @@
+package integration
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/therealbill/redskull/redskull-controller/actions"
+)
+
+func TestGetConstellation(t *testing.T) {
+	c := newCluster(t, 3, 3)
+	if c.con.Name != c.sentinels[0].Addr() {
+		t.Errorf("constellation name is %q, want the local sentinel %q", c.con.Name, c.sentinels[0].Addr())
+	}
+	pod, ok := c.con.LocalPodMap["pod1"]
+	if !ok {
+		t.Fatalf("pod1 not loaded, have %v", c.con.LocalPodMap)
+	}
+	master := c.pod.Master()
+	if pod.Info.IP != master.Host() || pod.Info.Port != master.Port() {
+		t.Errorf("pod1 master is %s:%d, want %s", pod.Info.IP, pod.Info.Port, master.Addr())
+	}
+	if pod.AuthToken != "secret" {
+		t.Errorf("pod1 auth is %q, want it read from the config file", pod.AuthToken)
+	}
+	if len(c.con.RemoteSentinels) != 2 {
+		t.Errorf("found %d remote sentinels, want 2", len(c.con.RemoteSentinels))
+	}
+	if c.con.Metrics.PodCount != 1 || c.con.Metrics.NodeCount != 2 {
+		t.Errorf("metrics count %d pods and %d nodes, want 1 and 2", c.con.Metrics.PodCount, c.con.Metrics.NodeCount)
+	}
+	if !c.con.IsBalanced(context.Background()) {
+		t.Error("constellation with quorum+1 sentinels per pod is not balanced")
+	}
+}
+
+func TestMonitorPod(t *testing.T) {
+	ctx := context.Background()
+	c := newCluster(t, 4, 3)
+	master := c.topo.AddRedis()
+	master.SetConfig("requirepass", "newsecret")
+	ok, err := c.con.MonitorPod(ctx, "pod2", master.Host(), master.Port(), 2, "newsecret")
+	if err != nil || !ok {
+		t.Fatalf("MonitorPod returned %v, %v", ok, err)
+	}
+	monitors := 0
+	for _, s := range c.sentinels {
+		if s.MasterAddr("pod2") == "" {
+			continue
+		}
+		monitors++
+		if s.MasterAddr("pod2") != master.Addr() {
+			t.Errorf("sentinel %s monitors pod2 at %s, want %s", s.Addr(), s.MasterAddr("pod2"), master.Addr())
+		}
+		if s.AuthPass("pod2") != "newsecret" {
+			t.Errorf("sentinel %s has auth-pass %q for pod2", s.Addr(), s.AuthPass("pod2"))
+		}
+	}
+	if monitors != 3 {
+		t.Errorf("pod2 is monitored by %d sentinels, want quorum+1", monitors)
+	}
+	if c.con.GetPodAuth("pod2") != "newsecret" {
+		t.Errorf("constellation did not record the auth for pod2")
+	}
+	if _, err := c.con.MonitorPod(ctx, "pod1", master.Host(), master.Port(), 2, ""); err == nil {
+		t.Error("monitoring an already monitored pod name succeeded")
+	}
+}
+
+func TestBalancePod(t *testing.T) {
+	ctx := context.Background()
+	c := newCluster(t, 4, 2)
+	if c.con.IsBalanced(ctx) {
+		t.Error("pod with quorum 2 and 2 sentinels reported balanced")
+	}
+	pod, err := c.con.GetPod(ctx, "pod1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.con.BalancePod(ctx, pod, false); err != nil {
+		t.Fatalf("BalancePod: %s", err)
+	}
+	monitors := 0
+	for _, s := range c.sentinels {
+		if s.MasterAddr("pod1") == c.pod.Master().Addr() {
+			monitors++
+			if s.AuthPass("pod1") != "secret" {
+				t.Errorf("sentinel %s was added without pod1's auth", s.Addr())
+			}
+		}
+	}
+	if monitors != 3 {
+		t.Errorf("pod1 is monitored by %d sentinels after balancing, want 3", monitors)
+	}
+}
+
+func TestBalancePodInMaintenance(t *testing.T) {
+	ctx := context.Background()
+	c := newCluster(t, 4, 2)
+	if _, err := c.con.SetPodMaintenance(ctx, "pod1", "testing", "integration", time.Time{}, false); err != nil {
+		t.Fatal(err)
+	}
+	pod, err := c.con.GetPod(ctx, "pod1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.con.BalancePod(ctx, pod, false); err != actions.ErrPodInMaintenance {
+		t.Errorf("BalancePod of a pod in maintenance returned %v", err)
+	}
+	if n := c.topo.Sentinels()[3].Calls("SENTINEL MONITOR"); n != 0 {
+		t.Errorf("pod in maintenance was added to a sentinel %d times", n)
+	}
+}
+
+func TestExpiredMaintenance(t *testing.T) {
+	c := newCluster(t, 3, 2)
+	ctx := context.Background()
+	if _, err := c.con.SetPodMaintenance(ctx, "pod1", "testing", "integration", time.Now().Add(-time.Second), false); err != nil {
+		t.Fatal(err)
+	}
+	if c.con.InMaintenance("pod1") {
+		t.Error("pod1 is in maintenance after it expired")
+	}
+	if _, ok := c.con.Maintenance.Get("pod1"); !ok {
+		t.Error("reading pod1's maintenance removed the expired entry")
+	}
+	c.con.ClearExpiredMaintenance(ctx)
+	if _, ok := c.con.Maintenance.Get("pod1"); ok {
+		t.Error("expired maintenance entry was not cleared")
+	}
+}
+
+func TestConfirmRebalance(t *testing.T) {
+	ctx := context.Background()
+	c := newCluster(t, 4, 2)
+	plan, err := c.con.PlanRebalance(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.HasChanges() {
+		t.Fatal("pod1 needs no rebalancing")
+	}
+	for fingerprint, want := range map[string]error{"": actions.ErrRebalanceUnconfirmed, "stale": actions.ErrRebalancePlanChanged} {
+		if _, _, err := c.con.ConfirmRebalance(ctx, fingerprint); err != want {
+			t.Errorf("ConfirmRebalance(%q) returned %v, want %v", fingerprint, err, want)
+		}
+	}
+	if n := c.topo.Sentinels()[3].Calls("SENTINEL MONITOR"); n != 0 {
+		t.Errorf("unconfirmed rebalance changed sentinels %d times", n)
+	}
+	if _, _, err := c.con.ConfirmRebalance(ctx, plan.Fingerprint); err != nil {
+		t.Errorf("ConfirmRebalance of the previewed plan: %s", err)
+	}
+}
+
+func TestFailover(t *testing.T) {
+	ctx := context.Background()
+	c := newCluster(t, 3, 3)
+	oldMaster, slave := c.pod.Master(), c.pod.Slaves()[0]
+	ok, err := c.con.Failover(ctx, "pod1", false)
+	if err != nil || !ok {
+		t.Fatalf("Failover returned %v, %v", ok, err)
+	}
+	if c.pod.Master() != slave {
+		t.Fatalf("slave %s was not promoted", slave.Addr())
+	}
+	if slave.Role() != "master" || oldMaster.MasterAddr() != slave.Addr() {
+		t.Errorf("old master replicates from %q, want the promoted slave", oldMaster.MasterAddr())
+	}
+	master, err := c.con.GetMaster(ctx, "pod1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if master.Host != slave.Host() || master.Port != slave.Port() {
+		t.Errorf("constellation reports master %s:%d, want %s", master.Host, master.Port, slave.Addr())
+	}
+}
+
+func TestFailoverNoGoodSlave(t *testing.T) {
+	c := newCluster(t, 3, 3)
+	c.pod.Slaves()[0].SetConfig("slave-priority", "0")
+	ok, err := c.con.Failover(context.Background(), "pod1", false)
+	if ok || err == nil || !strings.Contains(err.Error(), "NOGOODSLAVE") {
+		t.Errorf("Failover with no promotable slave returned %v, %v", ok, err)
+	}
+}
+
+func TestCallDeadline(t *testing.T) {
+	c := newCluster(t, 3, 3)
+	c.sentinels[0].Delay("SENTINEL GET-MASTER-ADDR-BY-NAME", 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := c.con.LocalSentinel.GetMaster(ctx, "pod1")
+	if err == nil {
+		t.Fatal("GetMaster on a stalled sentinel succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("GetMaster took %s to give up, want the context's deadline", elapsed)
+	}
+}
+
+func TestSentinelDown(t *testing.T) {
+	ctx := context.Background()
+	c := newCluster(t, 3, 3)
+	c.sentinels[2].Stop()
+	if _, err := c.con.RemoteSentinels[c.sentinels[2].Addr()].GetMaster(ctx, "pod1"); err == nil {
+		t.Error("GetMaster on a stopped sentinel succeeded")
+	}
+	master, err := c.con.GetMaster(ctx, "pod1")
+	if err != nil {
+		t.Fatalf("GetMaster with one sentinel down: %s", err)
+	}
+	if master.Port != c.pod.Master().Port() {
+		t.Errorf("GetMaster returned port %d, want %d", master.Port, c.pod.Master().Port())
+	}
+}
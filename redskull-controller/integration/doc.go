@@ -0,0 +1,4 @@
+// Package integration drives the constellation and the HTTP API against the
+// in-process fake sentinels and Redis instances from redistest. It has no
+// code of its own; run it with "go test ./integration/".
+package integration
@@ -0,0 +1,211 @@
+package integration
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/therealbill/redskull/redskull-controller/actions"
+	"github.com/therealbill/redskull/redskull-controller/common"
+)
+
+func init() {
+	actions.DrillPollInterval = 20 * time.Millisecond
+	actions.DrillCheckInterval = 20 * time.Millisecond
+}
+
+func TestDrill(t *testing.T) {
+	c := newCluster(t, 3, 3)
+	c.topo.SetFailoverDelay(200*time.Millisecond, 300*time.Millisecond)
+	oldMaster, slave := c.pod.Master(), c.pod.Slaves()[0]
+	report, err := c.con.RunDrill(context.Background(), "pod1", false, 5*time.Second, "test")
+	if err != nil || !report.Passed {
+		t.Fatalf("RunDrill returned %+v, %v", report, err)
+	}
+	if report.Failover.From != oldMaster.Addr() || report.Failover.To != slave.Addr() {
+		t.Errorf("drill failed over %s to %s, want %s to %s", report.Failover.From, report.Failover.To, oldMaster.Addr(), slave.Addr())
+	}
+	if report.Failover.SwitchMaster < 200*time.Millisecond {
+		t.Errorf("switch-master took %s, want at least the failover delay", report.Failover.SwitchMaster)
+	}
+	if report.Failover.ClientsSwitched < report.Failover.SwitchMaster {
+		t.Errorf("clients switched after %s, before switch-master at %s", report.Failover.ClientsSwitched, report.Failover.SwitchMaster)
+	}
+	if report.Failover.SentinelsAgreed < 500*time.Millisecond {
+		t.Errorf("sentinels agreed after %s, want at least the failover and propagation delays", report.Failover.SentinelsAgreed)
+	}
+	if report.Failback != nil {
+		t.Error("drill without failback reports a failback")
+	}
+	if c.pod.Master() != slave || slave.Role() != "master" {
+		t.Errorf("slave %s was not promoted", slave.Addr())
+	}
+	stored, ok := c.con.Drills.Get(report.ID)
+	if !ok || stored.Pod != "pod1" || !stored.Passed {
+		t.Errorf("stored report is %+v, %v", stored, ok)
+	}
+}
+
+func TestDrillFailback(t *testing.T) {
+	c := newCluster(t, 3, 3)
+	c.topo.SetFailoverDelay(100*time.Millisecond, 300*time.Millisecond)
+	oldMaster, slave := c.pod.Master(), c.pod.Slaves()[0]
+	// A second slave which, ahead of the old master, would be promoted by
+	// the failback were it not pinned
+	other := c.topo.AddRedis()
+	other.SetConfig("requirepass", "secret")
+	other.SetConfig("masterauth", "secret")
+	other.SlaveOf(oldMaster)
+	slave.SetReplOffset(300)
+	other.SetReplOffset(200)
+
+	report, err := c.con.RunDrill(context.Background(), "pod1", true, 5*time.Second, "test")
+	if err != nil || !report.Passed {
+		t.Fatalf("RunDrill returned %+v, %v", report, err)
+	}
+	if report.Failover.To != slave.Addr() {
+		t.Errorf("drill failed over to %s, want %s", report.Failover.To, slave.Addr())
+	}
+	if report.Failback == nil || report.Failback.From != slave.Addr() || report.Failback.To != oldMaster.Addr() {
+		t.Fatalf("failback is %+v, want %s to %s", report.Failback, slave.Addr(), oldMaster.Addr())
+	}
+	if c.pod.Master() != oldMaster || oldMaster.Role() != "master" {
+		t.Errorf("master is %s after failback, want %s", c.pod.Master().Addr(), oldMaster.Addr())
+	}
+	if p := other.Config("slave-priority"); p != "100" {
+		t.Errorf("pinned slave has slave-priority %s after the drill, want it restored to 100", p)
+	}
+	if pinned := c.con.Drills.Pinned(); len(pinned) != 0 {
+		t.Errorf("priorities still pinned after the drill: %v", pinned)
+	}
+}
+
+func TestDrillCannotFailover(t *testing.T) {
+	c := newCluster(t, 3, 3)
+	oldMaster := c.pod.Master()
+	c.pod.Slaves()[0].SetConfig("slave-priority", "0")
+	report, err := c.con.RunDrill(context.Background(), "pod1", false, 5*time.Second, "test")
+	if err == nil || report.Passed {
+		t.Fatalf("drill of a pod which cannot fail over passed: %+v", report)
+	}
+	if c.pod.Master() != oldMaster {
+		t.Error("drill failed the pod over although it cannot fail over")
+	}
+	found := false
+	for _, e := range report.Errors {
+		if e == "before: cannot-failover" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("report errors are %v, want cannot-failover seen before the drill", report.Errors)
+	}
+	if _, ok := c.con.Drills.Get(report.ID); !ok {
+		t.Error("failed drill was not stored")
+	}
+}
+
+func TestAPIDrillPod(t *testing.T) {
+	c := newCluster(t, 3, 3)
+	server := apiServer(t, c)
+	var job common.Job
+	status, apiErr := call(t, server, "POST", "/pods/pod1/drill", common.DrillRequest{Failback: true, Timeout: "5s"}, &job)
+	if apiErr != nil || status != http.StatusAccepted || job.Type != common.JobDrill {
+		t.Fatalf("POST drill: %d %v %+v", status, apiErr, job)
+	}
+	if job = waitForJob(t, server, job.ID); job.State != common.JobSucceeded {
+		t.Fatalf("drill job %s: %s", job.State, job.Error)
+	}
+
+	var reports []common.DrillReport
+	if status, apiErr := call(t, server, "GET", "/drills?pod=pod1&result=passed", nil, &reports); apiErr != nil {
+		t.Fatalf("GET drills: %d %s", status, apiErr.Message)
+	}
+	if len(reports) != 1 || reports[0].Failback == nil {
+		t.Fatalf("drills listed are %+v, want the one passed drill with its failback", reports)
+	}
+	var report common.DrillReport
+	if status, apiErr := call(t, server, "GET", "/drills/"+reports[0].ID, nil, &report); apiErr != nil || report.ID != reports[0].ID {
+		t.Errorf("GET drill %s: %d %v", reports[0].ID, status, apiErr)
+	}
+	if status, apiErr := call(t, server, "GET", "/drills/missing", nil, nil); apiErr == nil || apiErr.Code != common.ErrCodeDrillNotFound {
+		t.Errorf("GET missing drill: %d %v", status, apiErr)
+	}
+}
+
+func TestAPIDrillPodInMaintenance(t *testing.T) {
+	c := newCluster(t, 3, 3)
+	server := apiServer(t, c)
+	if _, err := c.con.SetPodMaintenance(context.Background(), "pod1", "testing", "integration", time.Time{}, false); err != nil {
+		t.Fatal(err)
+	}
+	status, apiErr := call(t, server, "POST", "/pods/pod1/drill", nil, nil)
+	if apiErr == nil || status != http.StatusConflict || apiErr.Code != common.ErrCodeInMaintenance {
+		t.Errorf("POST drill of a pod in maintenance: %d %v", status, apiErr)
+	}
+}
+
+func TestDrillWindowWrapsMidnight(t *testing.T) {
+	s := common.DrillSchedule{Window: "22:00-02:00", Every: "1h"}
+	for clock, want := range map[string]bool{"23:30": true, "00:00": true, "01:00": true, "02:00": false, "12:00": false, "21:59": false, "22:00": true} {
+		at, err := time.ParseInLocation("15:04", clock, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := s.InWindow(at); got != want {
+			t.Errorf("InWindow(%s) of %s is %v, want %v", clock, s.Window, got, want)
+		}
+	}
+}
+
+// scheduleFor runs the drill scheduler with the schedules for d
+func scheduleFor(c *cluster, d time.Duration, schedules ...common.DrillSchedule) {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	c.con.ScheduleDrills(ctx, schedules)
+}
+
+func TestScheduledDrillDueOnce(t *testing.T) {
+	c := newCluster(t, 3, 3)
+	scheduleFor(c, 3*time.Second, common.DrillSchedule{Pods: []string{"pod*"}, Every: "1h", Timeout: "2s"})
+	if reports := c.con.Drills.List(); len(reports) != 1 || reports[0].Pod != "pod1" || reports[0].Trigger != "schedule" {
+		t.Errorf("scheduler made drills %+v, want one drill of pod1, as it is not due again for an hour", reports)
+	}
+}
+
+func TestScheduledDrillSkipsMaintenance(t *testing.T) {
+	c := newCluster(t, 3, 3)
+	oldMaster := c.pod.Master()
+	if _, err := c.con.SetPodMaintenance(context.Background(), "pod1", "testing", "integration", time.Time{}, false); err != nil {
+		t.Fatal(err)
+	}
+	scheduleFor(c, 200*time.Millisecond, common.DrillSchedule{Every: "1h", Timeout: "2s"})
+	if reports := c.con.Drills.List(); len(reports) != 0 {
+		t.Errorf("scheduler drilled a pod in maintenance: %+v", reports)
+	}
+	if c.pod.Master() != oldMaster {
+		t.Error("scheduler failed over a pod in maintenance")
+	}
+}
+
+func TestRestoreDrillPriorities(t *testing.T) {
+	c := newCluster(t, 3, 3)
+	slave := c.pod.Slaves()[0]
+	slave.SetConfig("slave-priority", "0")
+	c.con.StartDrillStore()
+	if err := c.con.Drills.Pin("pod1", slave.Addr(), "100"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.con.Drills.Pin("pod1", "127.0.0.1:1", "100"); err != nil {
+		t.Fatal(err)
+	}
+	c.con.RestoreDrillPriorities(context.Background())
+	if p := slave.Config("slave-priority"); p != "100" {
+		t.Errorf("pinned slave has slave-priority %s, want it restored to 100", p)
+	}
+	pinned := c.con.Drills.Pinned()
+	if _, ok := pinned["pod1"][slave.Addr()]; ok || pinned["pod1"]["127.0.0.1:1"] != "100" {
+		t.Errorf("pins left are %v, want only the unreachable node's", pinned)
+	}
+}
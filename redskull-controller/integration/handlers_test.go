@@ -0,0 +1,307 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-controller/handlers"
+	"github.com/therealbill/redskull/redskull-shared/auth"
+	"github.com/zenazn/goji/web"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// apiServer serves the v1 pod and failover routes and the v2 API over the
+// cluster's constellation, with the middleware main installs
+func apiServer(t *testing.T, c *cluster) *httptest.Server {
+	t.Helper()
+	handlers.SetConstellation(c.con)
+	mux := web.New()
+	mux.Use(auth.Middleware)
+	mux.Use(handlers.CSRF)
+	mux.Use(handlers.Serialize)
+	mux.Get("/api/pod/:podName", handlers.APIGetPod)
+	mux.Post("/api/constellation/:podName/failover", auth.Require(auth.Operator, handlers.APIFailover))
+	handlers.RegisterAPIv2(mux)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// call makes a v2 call with a JSON body and decodes the envelope's Data into
+// data, returning the status code and the error, if any
+func call(t *testing.T, server *httptest.Server, method, path string, body, data interface{}) (int, *handlers.APIError) {
+	t.Helper()
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, server.URL+handlers.APIv2Prefix+path, bytes.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %s", method, path, err)
+	}
+	defer res.Body.Close()
+	var envelope struct {
+		Data  json.RawMessage
+		Error *handlers.APIError
+	}
+	if err := json.NewDecoder(res.Body).Decode(&envelope); err != nil {
+		t.Fatalf("%s %s: undecodable response: %s", method, path, err)
+	}
+	if data != nil && envelope.Error == nil {
+		if err := json.Unmarshal(envelope.Data, data); err != nil {
+			t.Fatalf("%s %s: undecodable data: %s", method, path, err)
+		}
+	}
+	return res.StatusCode, envelope.Error
+}
+
+// waitForJob polls the job until it finishes
+func waitForJob(t *testing.T, server *httptest.Server, id string) common.Job {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		var job common.Job
+		if status, apiErr := call(t, server, "GET", "/jobs/"+id, nil, &job); apiErr != nil {
+			t.Fatalf("GET job %s: %d %s", id, status, apiErr.Message)
+		}
+		if job.State != common.JobRunning {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s still running", id)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestAPIGetPod(t *testing.T) {
+	c := newCluster(t, 3, 3)
+	server := apiServer(t, c)
+	var pod common.RedisPod
+	status, apiErr := call(t, server, "GET", "/pods/pod1", nil, &pod)
+	if apiErr != nil {
+		t.Fatalf("GET pod1: %d %s", status, apiErr.Message)
+	}
+	master := c.pod.Master()
+	if pod.Name != "pod1" || pod.Info.IP != master.Host() || pod.Info.Port != master.Port() {
+		t.Errorf("GET pod1 returned %s at %s:%d, want pod1 at %s", pod.Name, pod.Info.IP, pod.Info.Port, master.Addr())
+	}
+	status, apiErr = call(t, server, "GET", "/pods/nosuchpod", nil, nil)
+	if status != http.StatusNotFound || apiErr == nil || apiErr.Code != common.ErrCodePodNotFound {
+		t.Errorf("GET of an unknown pod returned %d %+v", status, apiErr)
+	}
+
+	res, err := http.Get(server.URL + "/api/pod/pod1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var v1 handlers.InfoResponse
+	if err := json.NewDecoder(res.Body).Decode(&v1); err != nil {
+		t.Fatal(err)
+	}
+	if v1.Status != "COMPLETE" {
+		t.Errorf("v1 GET pod1 returned status %q: %s", v1.Status, v1.StatusMessage)
+	}
+}
+
+func TestAPIListPods(t *testing.T) {
+	c := newCluster(t, 3, 3)
+	server := apiServer(t, c)
+	var pods []common.PodSummary
+	if status, apiErr := call(t, server, "GET", "/pods", nil, &pods); apiErr != nil {
+		t.Fatalf("GET pods: %d %s", status, apiErr.Message)
+	}
+	if len(pods) != 1 || pods[0].Name != "pod1" {
+		t.Fatalf("GET pods returned %+v, want pod1", pods)
+	}
+	if pods[0].SentinelCount != 3 || pods[0].Slaves != 1 {
+		t.Errorf("pod1 summary has %d sentinels and %d slaves, want 3 and 1", pods[0].SentinelCount, pods[0].Slaves)
+	}
+}
+
+func TestAPIMaster(t *testing.T) {
+	c := newCluster(t, 3, 3)
+	server := apiServer(t, c)
+	var master struct {
+		Host string
+		Port int
+	}
+	if status, apiErr := call(t, server, "GET", "/pods/pod1/master", nil, &master); apiErr != nil {
+		t.Fatalf("GET master: %d %s", status, apiErr.Message)
+	}
+	if want := c.pod.Master(); master.Host != want.Host() || master.Port != want.Port() {
+		t.Errorf("GET master returned %s:%d, want %s", master.Host, master.Port, want.Addr())
+	}
+}
+
+func TestAPIMonitorPod(t *testing.T) {
+	c := newCluster(t, 3, 3)
+	server := apiServer(t, c)
+	master := c.topo.AddRedis()
+	master.SetConfig("requirepass", "newsecret")
+	req := common.MonitorRequest{MasterAddress: master.Host(), MasterPort: master.Port(), Quorum: 2, AuthToken: "newsecret"}
+	var pod common.RedisPod
+	if status, apiErr := call(t, server, "PUT", "/pods/pod2", req, &pod); apiErr != nil {
+		t.Fatalf("PUT pod2: %d %s", status, apiErr.Message)
+	}
+	if pod.Name != "pod2" {
+		t.Errorf("PUT pod2 returned pod %q", pod.Name)
+	}
+	for _, s := range c.sentinels {
+		if s.MasterAddr("pod2") != master.Addr() || s.AuthPass("pod2") != "newsecret" {
+			t.Errorf("sentinel %s monitors pod2 at %q with auth %q", s.Addr(), s.MasterAddr("pod2"), s.AuthPass("pod2"))
+		}
+	}
+	status, apiErr := call(t, server, "PUT", "/pods/pod3", common.MonitorRequest{MasterAddress: master.Host()}, nil)
+	if status != http.StatusBadRequest || apiErr == nil {
+		t.Errorf("PUT without a port and quorum returned %d %+v", status, apiErr)
+	}
+}
+
+func TestAPIFailover(t *testing.T) {
+	c := newCluster(t, 3, 3)
+	server := apiServer(t, c)
+	slave := c.pod.Slaves()[0]
+	var result common.APIResult
+	if status, apiErr := call(t, server, "POST", "/pods/pod1/failover", common.FailoverOptions{}, &result); apiErr != nil {
+		t.Fatalf("POST failover: %d %s", status, apiErr.Message)
+	}
+	if c.pod.Master() != slave {
+		t.Errorf("failover did not promote %s", slave.Addr())
+	}
+
+	// The old master is the only slave now; without priority it can't be
+	// promoted back
+	c.pod.Slaves()[0].SetConfig("slave-priority", "0")
+	status, apiErr := call(t, server, "POST", "/pods/pod1/failover", common.FailoverOptions{}, nil)
+	if status != http.StatusConflict || apiErr == nil || apiErr.Code != common.ErrCodeNoGoodSlave {
+		t.Errorf("failover with no promotable slave returned %d %+v", status, apiErr)
+	}
+}
+
+func TestAPIFailoverSentinelError(t *testing.T) {
+	c := newCluster(t, 3, 3)
+	server := apiServer(t, c)
+	for _, s := range c.sentinels {
+		s.Fail("SENTINEL FAILOVER", "INPROG Failover already in progress")
+	}
+	status, apiErr := call(t, server, "POST", "/pods/pod1/failover", common.FailoverOptions{}, nil)
+	if status != http.StatusConflict || apiErr == nil || apiErr.Code != common.ErrCodeFailoverInProgress {
+		t.Errorf("failover while one is in progress returned %d %+v", status, apiErr)
+	}
+}
+
+// TestAPIFailoverBasicAuth makes a v1 failover as curl -u does, with basic
+// auth and a JSON body sent as a form, which CSRF protection lets through
+func TestAPIFailoverBasicAuth(t *testing.T) {
+	c := newCluster(t, 3, 3)
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "redskull-htpasswd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	htpasswd := filepath.Join(dir, "htpasswd")
+	if err := ioutil.WriteFile(htpasswd, []byte("ops:"+string(hash)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	basic, err := auth.NewBasicAuthenticator(htpasswd, map[string]auth.Role{"ops": auth.Operator}, auth.Viewer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(authenticators []auth.Authenticator) { auth.Authenticators = authenticators }(auth.Authenticators)
+	auth.Authenticators = []auth.Authenticator{basic}
+	server := apiServer(t, c)
+	slave := c.pod.Slaves()[0]
+
+	req, err := http.NewRequest("POST", server.URL+"/api/constellation/pod1/failover", strings.NewReader(`{"Force": false}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth("ops", "secret")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var response handlers.InfoResponse
+	json.NewDecoder(res.Body).Decode(&response)
+	if res.StatusCode != http.StatusOK || response.Status != "SUCCESS" {
+		t.Fatalf("basic auth failover returned %d %+v", res.StatusCode, response)
+	}
+	if c.pod.Master() != slave {
+		t.Errorf("failover did not promote %s", slave.Addr())
+	}
+}
+
+func TestAPIBalancePod(t *testing.T) {
+	c := newCluster(t, 4, 2)
+	server := apiServer(t, c)
+	var job common.Job
+	status, apiErr := call(t, server, "POST", "/pods/pod1/balance", common.BalanceOptions{}, &job)
+	if apiErr != nil || status != http.StatusAccepted {
+		t.Fatalf("POST balance: %d %+v", status, apiErr)
+	}
+	job = waitForJob(t, server, job.ID)
+	if job.State != common.JobSucceeded {
+		t.Fatalf("balance job %s: %s", job.State, job.Error)
+	}
+	monitors := 0
+	for _, s := range c.sentinels {
+		if s.MasterAddr("pod1") != "" {
+			monitors++
+		}
+	}
+	if monitors != 3 {
+		t.Errorf("pod1 is monitored by %d sentinels after balancing, want 3", monitors)
+	}
+}
+
+func TestAPISentinels(t *testing.T) {
+	c := newCluster(t, 3, 3)
+	server := apiServer(t, c)
+	var sentinels []common.SentinelSummary
+	if status, apiErr := call(t, server, "GET", "/sentinels", nil, &sentinels); apiErr != nil {
+		t.Fatalf("GET sentinels: %d %s", status, apiErr.Message)
+	}
+	if len(sentinels) != len(c.sentinels) {
+		t.Errorf("GET sentinels returned %d, want %d", len(sentinels), len(c.sentinels))
+	}
+	seen := make(map[string]bool)
+	for _, s := range sentinels {
+		seen[s.Name] = true
+	}
+	for _, s := range c.sentinels {
+		if !seen[s.Addr()] {
+			t.Errorf("sentinel %s missing from %v", s.Addr(), seen)
+		}
+	}
+	var one common.SentinelSummary
+	path := fmt.Sprintf("/sentinels/%s", c.sentinels[1].Addr())
+	if status, apiErr := call(t, server, "GET", path, nil, &one); apiErr != nil {
+		t.Fatalf("GET %s: %d %s", path, status, apiErr.Message)
+	}
+}
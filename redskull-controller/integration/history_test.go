@@ -0,0 +1,121 @@
+package integration
+
+import (
+	"context"
+	"encoding/csv"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-controller/handlers"
+)
+
+func TestHistoryFailover(t *testing.T) {
+	ctx := context.Background()
+	c := newCluster(t, 3, 3)
+	oldMaster, slave := c.pod.Master(), c.pod.Slaves()[0]
+	c.con.PollHistory(ctx)
+	h, ok := c.con.History.Get("pod1")
+	if !ok || h.Master != oldMaster.Addr() || len(h.Entries) != 0 {
+		t.Fatalf("history after the first poll is %+v, %v", h, ok)
+	}
+
+	if ok, err := c.con.Failover(ctx, "pod1", false); !ok {
+		t.Fatalf("Failover returned %v, %v", ok, err)
+	}
+	c.con.PollHistory(ctx)
+	h, _ = c.con.History.Get("pod1")
+	if len(h.Entries) != 1 {
+		t.Fatalf("history after a failover has entries %+v, want one master change", h.Entries)
+	}
+	e := h.Entries[0]
+	if e.Kind != common.HistoryMasterChange || e.From != oldMaster.Addr() || e.To != slave.Addr() || e.Reason != common.ChangeRequested {
+		t.Errorf("master change is %+v, want %s to %s as requested", e, oldMaster.Addr(), slave.Addr())
+	}
+	sla := h.SLA(24*time.Hour, time.Now())
+	if sla.Failovers != 1 || sla.Unavailable != 0 || sla.Availability != 100 {
+		t.Errorf("SLA is %+v, want one failover and no unavailable time", sla)
+	}
+}
+
+func TestHistoryDown(t *testing.T) {
+	ctx := context.Background()
+	c := newCluster(t, 3, 3)
+	oldMaster, slave := c.pod.Master(), c.pod.Slaves()[0]
+	c.con.PollHistory(ctx)
+
+	oldMaster.Stop()
+	c.con.PollHistory(ctx)
+	h, _ := c.con.History.Get("pod1")
+	down := h.Down()
+	if down == nil || down.From != oldMaster.Addr() || down.Reason == "" {
+		t.Fatalf("history with the master stopped has entries %+v, want an ongoing down period", h.Entries)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// The sentinels fail the pod over on their own
+	if ok, err := c.con.LocalSentinel.DoFailover(ctx, "pod1"); !ok {
+		t.Fatalf("DoFailover returned %v, %v", ok, err)
+	}
+	c.con.PollHistory(ctx)
+	h, _ = c.con.History.Get("pod1")
+	if h.Down() != nil || len(h.Entries) != 2 {
+		t.Fatalf("history after the failover has entries %+v, want the down period ended and a master change", h.Entries)
+	}
+	ended, change := h.Entries[0], h.Entries[1]
+	if ended.To != slave.Addr() || ended.Duration(time.Now()) < 100*time.Millisecond {
+		t.Errorf("down period is %+v, want it to last until %s was promoted", ended, slave.Addr())
+	}
+	if change.Reason != common.ChangeMasterDown || change.To != slave.Addr() {
+		t.Errorf("master change is %+v, want %s promoted as the master was down", change, slave.Addr())
+	}
+	sla := h.SLA(24*time.Hour, time.Now())
+	if sla.DownPeriods != 1 || sla.Unavailable != ended.Duration(time.Now()) || sla.Availability >= 100 {
+		t.Errorf("SLA is %+v, want the down period counted", sla)
+	}
+}
+
+func TestAPIHistory(t *testing.T) {
+	ctx := context.Background()
+	c := newCluster(t, 3, 3)
+	server := apiServer(t, c)
+	c.con.PollHistory(ctx)
+	c.con.Failover(ctx, "pod1", false)
+	c.con.PollHistory(ctx)
+
+	var entries []common.HistoryEntry
+	if status, apiErr := call(t, server, "GET", "/pods/pod1/history?kind=master-change", nil, &entries); apiErr != nil {
+		t.Fatalf("GET history: %d %s", status, apiErr.Message)
+	}
+	if len(entries) != 1 || entries[0].Reason != common.ChangeRequested {
+		t.Errorf("history is %+v, want the requested failover", entries)
+	}
+	if status, apiErr := call(t, server, "GET", "/pods/missing/history", nil, nil); status != http.StatusNotFound {
+		t.Errorf("GET history of a missing pod: %d %v", status, apiErr)
+	}
+
+	var slas []common.PodSLA
+	if status, apiErr := call(t, server, "GET", "/sla?pod=pod1&window=1h,7d", nil, &slas); apiErr != nil {
+		t.Fatalf("GET sla: %d %s", status, apiErr.Message)
+	}
+	if len(slas) != 2 || slas[0].Window != "1h" || slas[1].Window != "7d" || slas[0].Failovers != 1 {
+		t.Errorf("SLA is %+v, want one failover in each of the two windows", slas)
+	}
+	if status, apiErr := call(t, server, "GET", "/sla?window=soon", nil, nil); apiErr == nil || apiErr.Code != common.ErrCodeInvalidRequest {
+		t.Errorf("GET sla with a bad window: %d %v", status, apiErr)
+	}
+
+	res, err := http.Get(server.URL + handlers.APIv2Prefix + "/pods/pod1/history?format=csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	records, err := csv.NewReader(res.Body).ReadAll()
+	if err != nil || res.Header.Get("Content-Type") != "text/csv; charset=utf-8" {
+		t.Fatalf("CSV history: %s, %v", res.Header.Get("Content-Type"), err)
+	}
+	if len(records) != 2 || records[0][0] != "pod" || records[1][1] != common.HistoryMasterChange || records[1][7] != common.ChangeRequested {
+		t.Errorf("CSV history is %v, want a header and the master change", records)
+	}
+}
@@ -0,0 +1,73 @@
+package integration
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/therealbill/redskull/redskull-controller/common"
+)
+
+func TestControllerSecretRefs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	outside, err := ioutil.TempFile("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	outside.Close()
+	defer os.Remove(outside.Name())
+	if err := ioutil.WriteFile(filepath.Join(dir, "pod1"), []byte("token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer func(dir string) { common.SecretsDirectory = dir }(common.SecretsDirectory)
+
+	common.SecretsDirectory = ""
+	if _, err := common.ResolveControllerSecretRef("file:" + filepath.Join(dir, "pod1")); err == nil {
+		t.Error("resolved a file reference with no secrets directory configured")
+	}
+	common.SecretsDirectory = dir
+	for _, ref := range []string{"file:pod1", "file:" + filepath.Join(dir, "pod1")} {
+		secret, err := common.ResolveControllerSecretRef(ref)
+		if err != nil || secret != "token" {
+			t.Errorf("%s resolved to %q, %v, want token", ref, secret, err)
+		}
+	}
+	os.Setenv("REDSKULL_TEST_SECRET", "token")
+	defer os.Unsetenv("REDSKULL_TEST_SECRET")
+	for _, ref := range []string{"file:" + outside.Name(), "file:../" + filepath.Base(outside.Name()), "env:REDSKULL_TEST_SECRET"} {
+		if _, err := common.ResolveControllerSecretRef(ref); err == nil {
+			t.Errorf("controller resolved %s", ref)
+		}
+	}
+	if secret, err := common.ResolveSecretRef("env:REDSKULL_TEST_SECRET"); err != nil || secret != "token" {
+		t.Errorf("client resolved env reference to %q, %v, want token", secret, err)
+	}
+}
+
+func TestManifestRejectsScripts(t *testing.T) {
+	for _, key := range []string{"notification-script", "client-reconfig-script"} {
+		m := common.Manifest{Pods: []common.PodManifest{{
+			Name:       "pod1",
+			Master:     "127.0.0.1:6379",
+			Quorum:     2,
+			Parameters: map[string]string{key: "/tmp/run-me"},
+		}}}
+		if err := m.Validate(); err == nil {
+			t.Errorf("manifest setting %s validated", key)
+		}
+	}
+	c := newCluster(t, 3, 2)
+	ctx := context.Background()
+	if err := c.con.SetPodParameter(ctx, "pod1", "notification-script", "/tmp/run-me"); err == nil {
+		t.Error("SetPodParameter set notification-script")
+	}
+	if err := c.con.SetPodParameter(ctx, "pod1", "down-after-milliseconds", "5000"); err != nil {
+		t.Errorf("SetPodParameter down-after-milliseconds: %s", err)
+	}
+}
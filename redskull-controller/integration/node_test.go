@@ -0,0 +1,86 @@
+package integration
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/therealbill/redskull/redskull-controller/common"
+)
+
+func TestNodeData(t *testing.T) {
+	topo := newTopology()
+	defer topo.Close()
+	r := topo.AddRedis()
+	r.SetConfig("requirepass", "secret")
+	r.SetConfig("latency-monitor-threshold", "100")
+	r.SetUsedMemory(900 * 1024 * 1024)
+	r.AddLatency("command", 250*time.Millisecond)
+	r.AddSlowLog(20*time.Millisecond, "KEYS", "*")
+	node, err := common.LoadNodeFromHostPort(context.Background(), r.Host(), r.Port(), "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !node.MemoryUseCritical {
+		t.Errorf("node using %.0f%% of maxmemory is not critical", node.PercentUsed)
+	}
+	if !node.SaveEnabled || node.AOFEnabled {
+		t.Errorf("node reports save %v and AOF %v, want save only", node.SaveEnabled, node.AOFEnabled)
+	}
+	if !node.LatencyMonitoringEnabled || len(node.LatencyHistory.Records) != 1 || node.LatencyHistory.Records[0].Latency != 250 {
+		t.Errorf("latency history is %+v", node.LatencyHistory)
+	}
+	if node.SlowLogLength != 1 || len(node.SlowLogRecords) != 1 || node.SlowLogRecords[0].Command[0] != "KEYS" {
+		t.Errorf("slowlog has %d entries: %+v", node.SlowLogLength, node.SlowLogRecords)
+	}
+}
+
+func TestNodeBadAuth(t *testing.T) {
+	topo := newTopology()
+	defer topo.Close()
+	r := topo.AddRedis()
+	r.SetConfig("requirepass", "secret")
+	_, err := common.LoadNodeFromHostPort(context.Background(), r.Host(), r.Port(), "wrong")
+	if err == nil || !strings.Contains(err.Error(), "password") {
+		t.Errorf("loading a node with the wrong password returned %v", err)
+	}
+}
+
+func TestNodeDeadline(t *testing.T) {
+	topo := newTopology()
+	defer topo.Close()
+	r := topo.AddRedis()
+	r.Delay("INFO", 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := common.LoadNodeFromHostPort(ctx, r.Host(), r.Port(), ""); err == nil {
+		t.Fatal("loading a stalled node succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("loading a stalled node took %s to give up", elapsed)
+	}
+}
+
+func TestSlaveLink(t *testing.T) {
+	topo := newTopology()
+	defer topo.Close()
+	pod := topo.AddPod("pod1", 1, 1, "secret")
+	master, slave := pod.Nodes[0], pod.Nodes[1]
+	node, err := common.LoadNodeFromHostPort(context.Background(), slave.Host(), slave.Port(), "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.Info.Replication.Role != "slave" || node.Info.Replication.MasterLinkStatus != "up" {
+		t.Errorf("slave reports role %q and link %q", node.Info.Replication.Role, node.Info.Replication.MasterLinkStatus)
+	}
+	master.Stop()
+	node.LastUpdateValid = false
+	if _, err := node.UpdateData(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if node.Info.Replication.MasterLinkStatus != "down" {
+		t.Errorf("slave of a stopped master reports link %q", node.Info.Replication.MasterLinkStatus)
+	}
+}
@@ -0,0 +1,55 @@
+package integration
+
+import (
+	"net"
+	"net/rpc"
+	"testing"
+	"time"
+
+	rsclient "github.com/therealbill/redskull/redskull-controller/rpcclient"
+	"github.com/therealbill/redskull/redskull-shared/auth"
+)
+
+// Blocker's Wait call blocks until its context ends
+type Blocker struct {
+	started chan struct{}
+	ended   chan struct{}
+}
+
+func (b *Blocker) Wait(req rsclient.EmptyRequest, resp *rsclient.EmptyResponse) error {
+	close(b.started)
+	<-req.Context().Done()
+	close(b.ended)
+	return nil
+}
+
+func TestRPCContextEndsWithConnection(t *testing.T) {
+	b := &Blocker{started: make(chan struct{}), ended: make(chan struct{})}
+	server := rpc.NewServer()
+	if err := server.Register(b); err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go (&auth.RPCServer{Server: server}).Serve(l)
+
+	client, err := rpc.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Go("Blocker.Wait", rsclient.EmptyRequest{}, new(rsclient.EmptyResponse), nil)
+	select {
+	case <-b.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("call never reached the service")
+	}
+	client.Close()
+	select {
+	case <-b.ended:
+	case <-time.After(5 * time.Second):
+		t.Error("call's context was not cancelled when the client hung up")
+	}
+}
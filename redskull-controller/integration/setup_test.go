@@ -0,0 +1,82 @@
+package integration
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/therealbill/redskull/redskull-controller/actions"
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-controller/redistest"
+	"github.com/therealbill/redskull/redskull-shared/auth"
+	"github.com/therealbill/redskull/redskull-shared/logging"
+)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if !testing.Verbose() {
+		logging.SetOutput(ioutil.Discard)
+		auth.SetAuditFile(os.DevNull)
+	}
+	// Every test reads nodes fresh rather than through the refresh cache
+	common.NodeRefreshInterval = 0
+	os.Exit(m.Run())
+}
+
+// newTopology returns an empty topology. Nodes are cached by address and
+// loopback ports are reused between tests, so the cache is emptied first.
+func newTopology() *redistest.Topology {
+	common.NodesMap = make(map[string]*common.RedisNode)
+	return redistest.New()
+}
+
+// cluster is a topology with one pod and the constellation loaded from the
+// first sentinel's config file
+type cluster struct {
+	topo      *redistest.Topology
+	sentinels []*redistest.Sentinel
+	pod       *redistest.Pod
+	con       actions.Constellation
+}
+
+// newCluster starts the given number of sentinels and a pod called "pod1"
+// with quorum 2 and one slave, monitored by the first monitors of them, and
+// loads a constellation with the first sentinel as the local one, as main
+// does
+func newCluster(t *testing.T, sentinels, monitors int) *cluster {
+	t.Helper()
+	c := &cluster{topo: newTopology()}
+	t.Cleanup(c.topo.Close)
+	c.sentinels = c.topo.AddSentinels(sentinels)
+	c.pod = c.topo.AddPod("pod1", 2, 1, "secret", c.sentinels[:monitors]...)
+	dir, err := ioutil.TempDir("", "redskull-integration")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	// RedSkull reads a sentinel's auth-pass lines from the config file its
+	// INFO names, so each sentinel gets one as if they shared a host
+	for i, s := range c.sentinels {
+		if err := s.SetConfigFile(filepath.Join(dir, fmt.Sprintf("sentinel-%d.conf", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.con, err = actions.GetConstellation(context.Background(), "", c.sentinels[0].ConfigFile(), "integration", "")
+	if err != nil {
+		t.Fatalf("GetConstellation: %s", err)
+	}
+	// Sentinels monitoring none of the pods can't be discovered, so they
+	// are added as an operator would
+	for _, s := range c.sentinels[monitors:] {
+		if err := c.con.AddSentinel(context.Background(), s.Host(), s.Port()); err != nil {
+			t.Fatalf("AddSentinel %s: %s", s.Addr(), err)
+		}
+	}
+	// main checks the balance once loaded, which maps pods to sentinels
+	c.con.IsBalanced(context.Background())
+	return c
+}
@@ -0,0 +1,120 @@
+package integration
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/therealbill/redskull/redskull-controller/actions"
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-controller/handlers"
+)
+
+// TestWatchersWhileServing runs the background watchers, with short
+// intervals, while clients call the API and the pod is balanced, failed over
+// and drilled. Run with -race it shows the snapshots readers work on share
+// nothing the watchers and writers change.
+func TestWatchersWhileServing(t *testing.T) {
+	defer func(interval time.Duration) { actions.WatchInterval = interval }(actions.WatchInterval)
+	defer func(interval time.Duration) { actions.HistoryInterval = interval }(actions.HistoryInterval)
+	defer func(interval time.Duration) { actions.AlertInterval = interval }(actions.AlertInterval)
+	defer func(interval time.Duration) { actions.DrillCheckInterval = interval }(actions.DrillCheckInterval)
+	actions.WatchInterval = 5 * time.Millisecond
+	actions.HistoryInterval = 5 * time.Millisecond
+	actions.AlertInterval = 5 * time.Millisecond
+	actions.DrillCheckInterval = 5 * time.Millisecond
+	// one sentinel short of quorum+1, so balancing moves the pod
+	c := newCluster(t, 4, 2)
+	server := apiServer(t, c)
+	loadAlertRules(t, c, `
+rules:
+  - name: errors
+    metric: pod-errors
+    op: ">"
+    value: 0
+  - name: lagging
+    metric: replica-lag
+    op: ">"
+    value: 5
+  - name: sentinel-down
+    metric: sentinel-unreachable
+    op: "=="
+    value: 1
+`)
+
+	// main runs the watchers on the handlers' copy of the constellation
+	pc, err := handlers.NewPageContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	watchers := []func(context.Context){
+		pc.Constellation.Watch,
+		pc.Constellation.TrackHistory,
+		pc.Constellation.WatchAlerts,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	watch := func(watch func(context.Context)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			watch(ctx)
+		}()
+	}
+	for _, w := range watchers {
+		watch(w)
+	}
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	paths := []string{
+		"/api/pod/pod1",
+		handlers.APIv2Prefix + "/pods",
+		handlers.APIv2Prefix + "/pods/pod1",
+		handlers.APIv2Prefix + "/pods/pod1/master",
+		handlers.APIv2Prefix + "/pods/pod1/sentinels",
+		handlers.APIv2Prefix + "/pods/pod1/topology",
+		handlers.APIv2Prefix + "/nodes",
+		handlers.APIv2Prefix + "/sentinels",
+	}
+	deadline := time.Now().Add(500 * time.Millisecond)
+	var clients sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		clients.Add(1)
+		go func(i int) {
+			defer clients.Done()
+			for n := i; time.Now().Before(deadline); n++ {
+				path := paths[n%len(paths)]
+				res, err := http.Get(server.URL + path)
+				if err != nil {
+					t.Errorf("GET %s: %s", path, err)
+					return
+				}
+				res.Body.Close()
+				if res.StatusCode != http.StatusOK {
+					t.Errorf("GET %s returned %d", path, res.StatusCode)
+					return
+				}
+			}
+		}(i)
+	}
+	var job common.Job
+	if status, apiErr := call(t, server, "POST", "/pods/pod1/balance", common.BalanceOptions{}, &job); apiErr != nil {
+		t.Errorf("balance returned %d %s", status, apiErr.Message)
+	} else if job = waitForJob(t, server, job.ID); job.State != common.JobSucceeded {
+		t.Errorf("balance job %s: %s", job.State, job.Error)
+	}
+	if status, apiErr := call(t, server, "POST", "/pods/pod1/failover", nil, nil); apiErr != nil {
+		t.Errorf("failover returned %d %s", status, apiErr.Message)
+	}
+	// Scheduled drills fail the pod over too, so they start once the
+	// failover above has been made
+	watch(func(ctx context.Context) {
+		pc.Constellation.ScheduleDrills(ctx, []common.DrillSchedule{{Every: "1h", Timeout: "1s"}})
+	})
+	clients.Wait()
+}
@@ -1,23 +1,31 @@
 package main // import "github.com/therealbill/redskull/redskull-controller"
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
-	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/kelseyhightower/envconfig"
-	"github.com/therealbill/airbrake-go"
+	rsagent "github.com/therealbill/redskull/redskull-agent/rpcclient"
 	"github.com/therealbill/redskull/redskull-controller/actions"
+	"github.com/therealbill/redskull/redskull-controller/common"
+	rserrors "github.com/therealbill/redskull/redskull-controller/errors"
+	"github.com/therealbill/redskull/redskull-controller/events"
 	"github.com/therealbill/redskull/redskull-controller/handlers"
+	"github.com/therealbill/redskull/redskull-controller/simulate"
+	"github.com/therealbill/redskull/redskull-shared/auth"
+	"github.com/therealbill/redskull/redskull-shared/logging"
 	"github.com/zenazn/goji"
 )
 
 var Build string
-var key string
 
 type ConstellationConfig struct {
 	Nodes           []string
@@ -27,17 +35,19 @@ type ConstellationConfig struct {
 
 func RefreshData() {
 	t := time.Tick(60 * time.Second)
-	context, err := handlers.NewPageContext()
+	pc, err := handlers.NewPageContext(context.Background())
 	if err != nil {
-		log.Fatal("[RefreshData]", err)
+		logging.Op("RefreshData").Fatalf("%s", err)
 	}
-	mc := context.Constellation
+	mc := pc.Constellation
 	if err != nil {
-		log.Fatal("Unable to connect to constellation")
+		logging.Fatalf("Unable to connect to constellation")
 	}
 	for _ = range t {
+		ctx, cancel := common.WithCallTimeout(context.Background())
+		mc.Acquire()
 		mc.LoadSentinelConfigFile()
-		mc.GetAllSentinels()
+		mc.GetAllSentinels(ctx)
 		for _, pod := range mc.RemotePodMap {
 			_, _ = mc.LocalPodMap[pod.Name]
 			auth := mc.GetPodAuth(pod.Name)
@@ -48,43 +58,192 @@ func RefreshData() {
 		for _, pod := range mc.LocalPodMap {
 			pod.AuthToken = mc.GetPodAuth(pod.Name)
 		}
-		mc.IsBalanced()
-		log.Printf("Main Cache Stats: %+v", mc.AuthCache.GetStats())
-		log.Printf("Hot Cache Stats: %+v", mc.AuthCache.GetHotStats())
+		mc.IsBalanced(ctx)
+		mc.Release()
+		cancel()
+		logging.Infof("Credential store holds %d pods", mc.Credentials.Count())
 	}
 }
 
 type LaunchConfig struct {
-	Name                string
-	Port                int
-	IP                  string
-	SentinelConfigFile  string
-	GroupName           string
-	BindAddress         string
-	SentinelHostAddress string
-	TemplateDirectory   string
-	NodeRefreshInterval float64
-	RPCPort             int
+	Name                 string
+	Port                 int
+	IP                   string
+	SentinelConfigFile   string
+	GroupName            string
+	BindAddress          string
+	SentinelHostAddress  string
+	TemplateDirectory    string
+	NodeRefreshInterval  float64
+	RPCPort              int
+	JSONRPCPort          int
+	SecretKeyFile        string
+	SecretsDirectory     string
+	AuthTokenFile        string
+	AuthHtpasswdFile     string
+	AuthProxyHeader      string
+	AuthProxyRoleHeader  string
+	AuthTrustedProxies   []string
+	AuthUserRoles        map[string]string
+	AuthDefaultRole      string
+	AuditLogFile         string
+	CredentialStoreFile  string
+	CredentialPort       int
+	DataDirectory        string
+	AgentRPCPort         int
+	AgentRPCToken        string
+	AgentRPCTLS          bool
+	AgentRPCTLSCA        string
+	AgentRPCTLSCert      string
+	AgentRPCTLSKey       string
+	RPCTLSCert           string
+	RPCTLSKey            string
+	RPCTLSClientCA       string
+	RPCRequireClientCert bool
+	RPCTokenFile         string
+	RPCCertRoles         map[string]string
+	RPCCertDefaultRole   string
+	WebhookFile          string
+	DrillFile            string
+	AlertFile            string
+	AlertInterval        float64
+	WatchInterval        float64
+	HistoryInterval      float64
+	SLAWindows           string
+	DialTimeout          float64
+	CallTimeout          float64
+	ErrorReporter        string
+	ErrorReporterURL     string
+	ErrorReporterFile    string
+	LogLevel             string
+	LogFormat            string
+}
+
+// launchConfigWire has LaunchConfig's fields but none of its methods, so
+// it can be printed without recursing into the redacting ones below.
+type launchConfigWire LaunchConfig
+
+// redacted returns the config with the agent RPC token masked
+func (lc LaunchConfig) redacted() launchConfigWire {
+	w := launchConfigWire(lc)
+	w.AgentRPCToken = common.MaskSecret(w.AgentRPCToken)
+	return w
+}
+
+// String masks the agent RPC token, so the config can be logged
+func (lc LaunchConfig) String() string {
+	return fmt.Sprintf("%+v", lc.redacted())
+}
+
+// MarshalJSON masks the agent RPC token
+func (lc LaunchConfig) MarshalJSON() ([]byte, error) {
+	return json.Marshal(lc.redacted())
 }
 
 var config LaunchConfig
 
+// drillSchedules are the failover drill schedules loaded from DrillFile
+var drillSchedules []common.DrillSchedule
+
+// Simulate mode serves a synthetic constellation instead of the local
+// sentinel's; see the simulate package
+var (
+	simulateMode      = flag.Bool("simulate", false, "serve a simulated constellation instead of the local sentinel's")
+	simulateSentinels = flag.Int("simulate-sentinels", 5, "number of simulated sentinels")
+	simulatePods      = flag.Int("simulate-pods", 8, "number of simulated pods")
+	simulateSlaves    = flag.Int("simulate-slaves", 2, "number of slaves in each simulated pod")
+	simulateFailures  = flag.Duration("simulate-failures", 0, "inject a random failure at this interval, e.g. 2m")
+)
+
 func init() {
 	err := envconfig.Process("redskull", &config)
 	if err != nil {
-		log.Fatal(err)
+		logging.Fatalf("%s", err)
+	}
+	err = setupLogging()
+	if err != nil {
+		logging.Fatalf("Unable to configure logging: %s", err)
 	}
 	if config.NodeRefreshInterval == 0 {
 		config.NodeRefreshInterval = 60
 	}
 	actions.NodeRefreshInterval = config.NodeRefreshInterval
 
-	log.Printf("Launch Config: %+v", config)
+	if config.SecretKeyFile > "" {
+		actions.SecretKey, err = common.LoadKeyFile(config.SecretKeyFile)
+		if err != nil {
+			logging.Fatalf("Unable to load secret key file '%s': %s", config.SecretKeyFile, err)
+		}
+	}
+
+	actions.DataDirectory = config.DataDirectory
+	common.SecretsDirectory = config.SecretsDirectory
+	actions.AgentRPCPort = config.AgentRPCPort
+	err = setupAgentRPC()
+	if err != nil {
+		logging.Fatalf("Unable to configure the agent RPC client: %s", err)
+	}
+	actions.CredentialStoreFile = config.CredentialStoreFile
+	if config.CredentialPort > 0 {
+		actions.CredentialPort = config.CredentialPort
+	}
+
+	if config.WatchInterval != 0 {
+		actions.WatchInterval = time.Duration(config.WatchInterval * float64(time.Second))
+	}
+	if config.HistoryInterval != 0 {
+		actions.HistoryInterval = time.Duration(config.HistoryInterval * float64(time.Second))
+	}
+	if config.AlertInterval != 0 {
+		actions.AlertInterval = time.Duration(config.AlertInterval * float64(time.Second))
+	}
+	if config.SLAWindows > "" {
+		actions.SLAWindows, err = common.ParseWindows(config.SLAWindows)
+		if err == nil && len(actions.SLAWindows) == 0 {
+			err = fmt.Errorf("no windows given")
+		}
+		if err != nil {
+			logging.Fatalf("Unable to configure SLA windows: %s", err)
+		}
+	}
+	if config.DialTimeout > 0 {
+		common.DialTimeout = time.Duration(config.DialTimeout * float64(time.Second))
+	}
+	if config.CallTimeout != 0 {
+		common.CallTimeout = time.Duration(config.CallTimeout * float64(time.Second))
+	}
+
+	err = setupErrorReporter()
+	if err != nil {
+		logging.Fatalf("Unable to configure error reporting: %s", err)
+	}
+
+	err = setupWebhooks()
+	if err != nil {
+		logging.Fatalf("Unable to configure webhooks: %s", err)
+	}
+
+	err = setupAuth()
+	if err != nil {
+		logging.Fatalf("Unable to configure authentication: %s", err)
+	}
+
+	err = setupDrills()
+	if err != nil {
+		logging.Fatalf("Unable to configure failover drills: %s", err)
+	}
+
+	err = setupAlerts()
+	if err != nil {
+		logging.Fatalf("Unable to configure alert rules: %s", err)
+	}
+
+	logging.Infof("Launch Config: %+v", config)
 	if config.BindAddress > "" {
 		flag.Set("bind", config.BindAddress)
 	} else {
 		if config.Port == 0 {
-			log.Print("ENV contained no port, using default")
+			logging.Warnf("ENV contained no port, using default")
 			config.Port = 8000
 		}
 	}
@@ -94,7 +253,7 @@ func init() {
 	}
 
 	ps := fmt.Sprintf("%s:%d", config.IP, config.Port)
-	log.Printf("binding to '%s'", ps)
+	logging.Infof("binding to '%s'", ps)
 	flag.Set("bind", ps)
 
 	if config.TemplateDirectory > "" {
@@ -106,89 +265,354 @@ func init() {
 
 	// handle absent sentinel config file w/a default
 	if config.SentinelConfigFile == "" {
-		log.Print("ENV contained no SentinelConfigFile, using default")
+		logging.Warnf("ENV contained no SentinelConfigFile, using default")
 		config.SentinelConfigFile = "/etc/redis/sentinel.conf"
 	}
 
 	// handle absent sentinel config file w/a default
 	if config.GroupName == "" {
 		config.GroupName = "redskull:1"
-		log.Print("ENV contained no GroupName, using default:" + config.GroupName)
+		logging.Warnf("ENV contained no GroupName, using default: %s", config.GroupName)
 	}
 
 	config_json, _ := json.Marshal(config)
-	log.Printf("Config: %s", config_json)
+	logging.Infof("Config: %s", config_json)
 
-	key = os.Getenv("AIRBRAKE_API_KEY")
-	airbrake.Endpoint = "https://api.airbrake.io/notifier_api/v2/notices"
-	airbrake.ApiKey = key
-	airbrake.Environment = os.Getenv("RSM_ENVIRONMENT")
-	if len(airbrake.Environment) == 0 {
-		airbrake.Environment = "Development"
-	}
 	if len(Build) == 0 {
 		Build = ".1"
 		return
 	}
 }
 
+// setupSimulation starts the simulated constellation and points the
+// controller at its local sentinel in place of the configured one
+func setupSimulation() (*simulate.Simulation, error) {
+	sim, err := simulate.New(simulate.Config{
+		Sentinels:       *simulateSentinels,
+		Pods:            *simulatePods,
+		Slaves:          *simulateSlaves,
+		FailureInterval: *simulateFailures,
+	})
+	if err != nil {
+		return nil, err
+	}
+	logging.Warnf("Running in simulate mode, no real sentinels will be contacted")
+	config.SentinelConfigFile = sim.ConfigFile()
+	config.SentinelHostAddress = ""
+	handlers.Simulation = sim
+	return sim, nil
+}
+
+// setupLogging sets the log level and format. Output from the standard log
+// package, such as from libraries, is sent through the same logger.
+func setupLogging() error {
+	if config.LogLevel > "" {
+		level, err := logging.ParseLevel(config.LogLevel)
+		if err != nil {
+			return err
+		}
+		logging.SetLevel(level)
+	}
+	err := logging.SetFormat(config.LogFormat)
+	if err != nil {
+		return err
+	}
+	logging.CaptureStandardLog()
+	return nil
+}
+
+// setupErrorReporter selects where errors are reported. Airbrake is used by
+// default when AIRBRAKE_API_KEY is set, otherwise errors are only logged.
+func setupErrorReporter() error {
+	key := os.Getenv("AIRBRAKE_API_KEY")
+	if config.ErrorReporter == "" && key > "" {
+		config.ErrorReporter = "airbrake"
+	}
+	if env := os.Getenv("RSM_ENVIRONMENT"); env > "" {
+		rserrors.Environment = env
+	}
+	reporter, err := rserrors.NewReporter(rserrors.ReporterConfig{
+		Kind:   config.ErrorReporter,
+		URL:    config.ErrorReporterURL,
+		File:   config.ErrorReporterFile,
+		APIKey: key,
+	})
+	if err != nil {
+		return err
+	}
+	rserrors.SetReporter(reporter)
+	return nil
+}
+
+// setupWebhooks loads the webhook sinks, if configured, and subscribes them
+// to events. Deliveries are logged to the data directory.
+func setupWebhooks() error {
+	if config.WebhookFile == "" {
+		return nil
+	}
+	cfg, err := events.LoadWebhookConfig(config.WebhookFile)
+	if err != nil {
+		return err
+	}
+	logFile := ""
+	if config.DataDirectory > "" {
+		logFile = filepath.Join(config.DataDirectory, "webhook-deliveries.log")
+	}
+	dispatcher, err := events.NewDispatcher(cfg, logFile)
+	if err != nil {
+		return err
+	}
+	events.EnableWebhooks(dispatcher)
+	logging.Infof("Loaded %d webhooks from %s", len(cfg.Sinks), config.WebhookFile)
+	return nil
+}
+
+// setupDrills loads the failover drill schedules, if configured
+func setupDrills() error {
+	if config.DrillFile == "" {
+		return nil
+	}
+	cfg, err := actions.LoadDrillConfig(config.DrillFile)
+	if err != nil {
+		return err
+	}
+	drillSchedules = cfg.Schedules
+	logging.Infof("Loaded %d drill schedules from %s", len(drillSchedules), config.DrillFile)
+	return nil
+}
+
+// setupAlerts checks the alert rule file loads, if configured. The
+// constellation's alert engine loads it, and reloads it on SIGHUP.
+func setupAlerts() error {
+	if config.AlertFile == "" {
+		return nil
+	}
+	cfg, err := actions.LoadAlertConfig(config.AlertFile)
+	if err != nil {
+		return err
+	}
+	actions.AlertRuleFile = config.AlertFile
+	logging.Infof("Loaded %d alert rules from %s", len(cfg.Rules), config.AlertFile)
+	return nil
+}
+
+// reloadAlertsOnHangup reloads the alert rules each time the process is
+// sent SIGHUP
+func reloadAlertsOnHangup(ctx context.Context, con *actions.Constellation) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		if _, err := con.ReloadAlertRules(ctx); err != nil {
+			logging.Errorf("Unable to reload alert rules, keeping the current ones: %s", err)
+		}
+	}
+}
+
+// setupAgentRPC configures how the controller authenticates to
+// redskull-agent
+func setupAgentRPC() error {
+	actions.AgentRPCOptions.Token = config.AgentRPCToken
+	if config.AgentRPCTLS || config.AgentRPCTLSCA > "" || config.AgentRPCTLSCert > "" {
+		tlsConfig, err := rsagent.TLSConfig(config.AgentRPCTLSCA, config.AgentRPCTLSCert, config.AgentRPCTLSKey)
+		if err != nil {
+			return err
+		}
+		actions.AgentRPCOptions.TLS = tlsConfig
+	}
+	return nil
+}
+
+// setupAuth configures the HTTP authenticators from the launch config. With
+// none configured the HTTP interface remains open.
+func setupAuth() error {
+	defaultRole := auth.Viewer
+	if config.AuthDefaultRole > "" {
+		role, err := auth.ParseRole(config.AuthDefaultRole)
+		if err != nil {
+			return err
+		}
+		defaultRole = role
+	}
+	roles, err := auth.ParseRoles(config.AuthUserRoles)
+	if err != nil {
+		return err
+	}
+	if config.AuthTokenFile > "" {
+		ta, err := auth.NewTokenAuthenticator(config.AuthTokenFile)
+		if err != nil {
+			return err
+		}
+		auth.Authenticators = append(auth.Authenticators, ta)
+	}
+	if config.AuthHtpasswdFile > "" {
+		ba, err := auth.NewBasicAuthenticator(config.AuthHtpasswdFile, roles, defaultRole)
+		if err != nil {
+			return err
+		}
+		auth.Authenticators = append(auth.Authenticators, ba)
+		auth.Challenge = `Basic realm="RedSkull"`
+	}
+	if config.AuthProxyHeader > "" {
+		pa, err := auth.NewProxyAuthenticator(config.AuthProxyHeader, config.AuthProxyRoleHeader, config.AuthTrustedProxies, roles, defaultRole)
+		if err != nil {
+			return err
+		}
+		auth.Authenticators = append(auth.Authenticators, pa)
+	}
+	if config.AuditLogFile > "" {
+		err := auth.SetAuditFile(config.AuditLogFile)
+		if err != nil {
+			return err
+		}
+	}
+	if !auth.Enabled() {
+		logging.Warnf("No authentication configured, the HTTP interface is open to anyone who can reach it")
+	}
+	return nil
+}
+
 func main() {
-	mc, err := actions.GetConstellation(config.Name, config.SentinelConfigFile, config.GroupName, config.SentinelHostAddress)
+	// The initial crawl and the watcher run for the life of the process;
+	// each call they make is still bounded by the dial timeout
+	ctx := context.Background()
+	flag.Parse()
+	if *simulateMode {
+		sim, err := setupSimulation()
+		if err != nil {
+			logging.Fatalf("Unable to start the simulation: %s", err)
+		}
+		defer sim.Close()
+		go sim.Run(ctx)
+	}
+	mc, err := actions.GetConstellation(ctx, config.Name, config.SentinelConfigFile, config.GroupName, config.SentinelHostAddress)
 	if err != nil {
-		log.Fatal("Unable to connect to constellation")
+		logging.Fatalf("Unable to connect to constellation")
+	}
+	if handlers.Simulation != nil {
+		// Sentinels are normally found through the pods they share with the
+		// local one; add them all in case some share none
+		for _, address := range handlers.Simulation.SentinelAddresses() {
+			mc.AddSentinelByAddress(ctx, address)
+		}
 	}
 	//log.Print("Starting refresh ticker")
 	//go RefreshData()
 	_, _ = mc.GetPodMap()
-	mc.IsBalanced()
+	mc.IsBalanced(ctx)
 	//mc = mc
 	//_ = handlers.NewPageContext()
-	if mc.AuthCache == nil {
-		log.Print("Uninitialized AuthCache, StartCache not called, calling now")
-		mc.StartCache()
+	if mc.Credentials == nil {
+		logging.Debugf("Uninitialized credential store, StartCredentialStore not called, calling now")
+		mc.StartCredentialStore()
 	}
-	log.Printf("Main Cache Stats: %+v", mc.AuthCache.GetStats())
-	log.Printf("Hot Cache Stats: %+v", mc.AuthCache.GetHotStats())
+	logging.Infof("Credential store holds %d pods", mc.Credentials.Count())
 	handlers.SetConstellation(mc)
+	// Watch the handlers' copy of the constellation, which the UI and RPC
+	// share, rather than mc
+	if pc, err := handlers.NewPageContext(ctx); err == nil {
+		restore, cancel := common.WithCallTimeout(ctx)
+		pc.Constellation.RestoreDrillPriorities(restore)
+		cancel()
+		go pc.Constellation.Watch(ctx)
+		go pc.Constellation.TrackHistory(ctx)
+		go pc.Constellation.ScheduleDrills(ctx, drillSchedules)
+		go pc.Constellation.WatchAlerts(ctx)
+		if config.AlertFile > "" {
+			go reloadAlertsOnHangup(ctx, pc.Constellation)
+		}
+	}
 
 	go ServeRPC()
 
+	goji.Use(auth.Middleware)
+	goji.Use(handlers.CSRF)
+	goji.Use(handlers.Serialize)
+
+	// Reads need only an authenticated user. Mutating pod operations need
+	// the operator role, sentinel and constellation wide changes need admin.
+	// Destructive pod actions are confirmed by typing the pod name on the
+	// GET page before the POST is accepted.
 	// HTML Interface URLS
 	goji.Get("/constellation/", handlers.ConstellationInfoHTML) // Needs moved? instance tree?
 	goji.Get("/dashboard/", handlers.Dashboard)                 // Needs moved? instance tree?
 	goji.Get("/constellation/addpodform/", handlers.AddPodForm)
-	goji.Post("/constellation/addpod/", handlers.AddPodHTML)
-	goji.Post("/constellation/addsentinel/", handlers.AddSentinelHTML)
+	goji.Post("/constellation/addpod/", auth.Require(auth.Operator, handlers.AddPodHTML))
+	goji.Post("/constellation/addsentinel/", auth.Require(auth.Admin, handlers.AddSentinelHTML))
 	goji.Get("/constellation/addsentinelform/", handlers.AddSentinelForm)
 	goji.Get("/constellation/rebalance/", handlers.RebalanceHTML)
-	goji.Get("/constellation/removepod/:podname", handlers.RemovePodHTML)
+	goji.Post("/constellation/rebalance/", auth.Require(auth.Admin, handlers.RebalanceConfirmHTML))
+	goji.Get("/constellation/removepod/:podname", auth.Require(auth.Operator, handlers.ConfirmRemovePodHTML))
+	goji.Post("/constellation/removepod/:podname", auth.Require(auth.Operator, handlers.RemovePodHTML))
 	//goji.Get("/pod/:podName/dropslave", handlers.DropSlaveHTML)
 	goji.Get("/pod/:podName/addslave", handlers.AddSlaveHTML)
-	goji.Post("/pod/:podName/addslave", handlers.AddSlaveHTMLProcessor)
-	goji.Post("/pod/:name/failover", handlers.DoFailoverHTML)
-	goji.Post("/pod/:name/reset", handlers.ResetPodProcessor)
-	goji.Post("/pod/:name/balance", handlers.BalancePodProcessor)
+	goji.Post("/pod/:podName/addslave", auth.Require(auth.Operator, handlers.AddSlaveHTMLProcessor))
+	goji.Get("/pod/:name/failover", auth.Require(auth.Operator, handlers.ConfirmFailoverHTML))
+	goji.Post("/pod/:name/failover", auth.Require(auth.Operator, handlers.DoFailoverHTML))
+	goji.Get("/pod/:name/drill", auth.Require(auth.Operator, handlers.ConfirmDrillHTML))
+	goji.Post("/pod/:name/drill", auth.Require(auth.Operator, handlers.DrillHTML))
+	goji.Get("/pod/:name/reset", auth.Require(auth.Operator, handlers.ConfirmResetHTML))
+	goji.Post("/pod/:name/reset", auth.Require(auth.Operator, handlers.ResetPodProcessor))
+	goji.Post("/pod/:name/balance", auth.Require(auth.Operator, handlers.BalancePodProcessor))
+	goji.Get("/pod/:podName/maintenance", auth.Require(auth.Operator, handlers.MaintenanceFormHTML))
+	goji.Post("/pod/:podName/maintenance", auth.Require(auth.Operator, handlers.SetMaintenanceHTML))
+	goji.Post("/pod/:podName/maintenance/clear", auth.Require(auth.Operator, handlers.ClearMaintenanceHTML))
+	goji.Get("/pod/:podName/sentinels", handlers.ShowPodSentinels)
 	goji.Get("/pod/:podName", handlers.ShowPod)
 	goji.Get("/pods/", handlers.ShowPods)
 	goji.Get("/nodes/", handlers.ShowNodes)
 	goji.Get("/node/:name", handlers.ShowNode)
+	goji.Get("/drills/", handlers.ShowDrills)
+	goji.Get("/alerts/", handlers.ShowAlerts)
+	goji.Post("/alerts/silences", auth.Require(auth.Operator, handlers.SilenceHTML))
+	goji.Post("/alerts/silences/:id/expire", auth.Require(auth.Operator, handlers.ExpireSilenceHTML))
 	goji.Get("/", handlers.Root) // Needs moved? instance tree?
 
 	// API URLS
 	goji.Get("/api/knownpods", handlers.APIGetPods)
-	goji.Put("/api/monitor/:podName", handlers.APIMonitorPod)
-	goji.Post("/api/constellation/:podName/failover", handlers.APIFailover)
+	goji.Put("/api/monitor/:podName", auth.Require(auth.Operator, handlers.APIMonitorPod))
+	goji.Post("/api/constellation/:podName/failover", auth.Require(auth.Operator, handlers.APIFailover))
 
 	goji.Get("/api/pod/:podName", handlers.APIGetPod)
-	goji.Put("/api/pod/:podName", handlers.APIMonitorPod)
-	goji.Put("/api/pod/:podName/addslave", handlers.APIAddSlave)
-	goji.Delete("/api/pod/:podName", handlers.APIRemovePod)
+	goji.Put("/api/pod/:podName", auth.Require(auth.Operator, handlers.APIMonitorPod))
+	goji.Put("/api/pod/:podName/addslave", auth.Require(auth.Operator, handlers.APIAddSlave))
+	goji.Delete("/api/pod/:podName", auth.Require(auth.Operator, handlers.APIRemovePod))
+	goji.Get("/api/pod/:podName/auth", auth.Require(auth.Admin, handlers.APIGetPodAuth))
+	goji.Get("/api/pod/:podName/auth/versions", auth.Require(auth.Admin, handlers.APIGetPodAuthVersions))
+	goji.Get("/api/pod/:podName/maintenance", handlers.APIGetPodMaintenance)
+	goji.Put("/api/pod/:podName/maintenance", auth.Require(auth.Operator, handlers.APISetPodMaintenance))
+	goji.Delete("/api/pod/:podName/maintenance", auth.Require(auth.Operator, handlers.APIClearPodMaintenance))
 	goji.Get("/api/pod/:podName/master", handlers.APIGetMaster)
 	goji.Get("/api/pod/:podName/slaves", handlers.APIGetSlaves)
+	goji.Get("/api/pod/:podName/topology", handlers.APIGetPodTopology)
+	goji.Get("/api/topology", handlers.APIGetTopology)
+	goji.Get("/api/maintenance", handlers.APIGetMaintenance)
+
+	goji.Get("/api/webhooks", auth.Require(auth.Admin, handlers.APIGetWebhooks))
+	goji.Get("/api/admin/loglevel", auth.Require(auth.Admin, handlers.APIGetLogLevel))
+	goji.Put("/api/admin/loglevel", auth.Require(auth.Admin, handlers.APISetLogLevel))
+	goji.Get("/api/webhooks/deliveries", auth.Require(auth.Admin, handlers.APIGetWebhookDeliveries))
+	goji.Post("/api/webhooks/:name/test", auth.Require(auth.Admin, handlers.APITestWebhook))
+
+	goji.Get("/api/constellation/rebalance", handlers.APIRebalancePlan)
+	goji.Post("/api/constellation/rebalance", auth.Require(auth.Admin, handlers.APIRebalanceConfirm))
+	goji.Get("/api/constellation/export", auth.Require(auth.Admin, handlers.APIExportConstellation))
+	goji.Post("/api/constellation/restore", auth.Require(auth.Admin, handlers.APIRestoreConstellation))
+
+	goji.Post("/api/manifest/plan", auth.Require(auth.Admin, handlers.APIPlanManifest))
+	goji.Post("/api/manifest/apply", auth.Require(auth.Admin, handlers.APIApplyManifest))
 
-	goji.Post("/api/node/clone", handlers.Clone) // Needs moved to the node tree
+	goji.Post("/api/node/clone", auth.Require(auth.Operator, handlers.Clone)) // Needs moved to the node tree
 	goji.Get("/api/node/:name", handlers.GetNodeJSON)
 
+	if handlers.Simulation != nil {
+		goji.Get("/api/simulate", handlers.APIGetSimulation)
+		goji.Post("/api/simulate/failures", auth.Require(auth.Admin, handlers.APIInjectFailure))
+		goji.Delete("/api/simulate/failures/:id", auth.Require(auth.Admin, handlers.APIHealFailure))
+	}
+
+	// Versioned API, see handlers/openapi.go for the routes
+	handlers.RegisterAPIv2(goji.DefaultMux)
+
 	goji.Get("/static/*", handlers.Static) // Needs moved? instance tree?
 	//goji.Abandon(middleware.Logger)
 
@@ -0,0 +1,523 @@
+package redistest
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// redisVersion is the version fake instances report
+const redisVersion = "3.2.12"
+
+// defaultConfig is the configuration a new instance starts with. Only these
+// parameters may be set with CONFIG SET, as with a real server. maxmemory
+// is set so nodes do not look out of memory.
+var defaultConfig = map[string]string{
+	"appendonly":                "no",
+	"daemonize":                 "no",
+	"databases":                 "16",
+	"dir":                       "/tmp",
+	"latency-monitor-threshold": "0",
+	"masterauth":                "",
+	"maxclients":                "10000",
+	"maxmemory":                 "1073741824",
+	"maxmemory-policy":          "noeviction",
+	"min-slaves-to-write":       "0",
+	"repl-backlog-size":         "1048576",
+	"requirepass":               "",
+	"save":                      "900 1 300 10 60 10000",
+	"slave-priority":            "100",
+	"slave-read-only":           "yes",
+	"slowlog-log-slower-than":   "10000",
+	"slowlog-max-len":           "128",
+	"timeout":                   "0",
+}
+
+// Redis is a fake Redis instance. Its replication follows the topology:
+// SLAVEOF points it at another instance, and its link is up while that
+// instance runs and, if it requires auth, masterauth matches.
+type Redis struct {
+	server
+	runID      string
+	started    time.Time
+	masterAddr string
+	config     map[string]string
+	usedMemory int64
+	offset     int64
+	lag        int
+	syncing    bool
+	slowlog    []slowlogEntry
+	slowlogID  int64
+	latency    map[string][]latencySample
+}
+
+type slowlogEntry struct {
+	id       int64
+	time     time.Time
+	duration time.Duration
+	args     []string
+}
+
+type latencySample struct {
+	time    time.Time
+	latency time.Duration
+}
+
+func newRedis() *Redis {
+	r := &Redis{
+		runID:      newRunID(),
+		started:    time.Now(),
+		config:     make(map[string]string),
+		usedMemory: 1024 * 1024,
+		latency:    make(map[string][]latencySample),
+	}
+	for k, v := range defaultConfig {
+		r.config[k] = v
+	}
+	return r
+}
+
+// Role returns "master" or "slave"
+func (r *Redis) Role() string {
+	r.topo.mu.Lock()
+	defer r.topo.mu.Unlock()
+	return r.role()
+}
+
+// MasterAddr returns the address the instance replicates from, or "" if it
+// is a master
+func (r *Redis) MasterAddr() string {
+	r.topo.mu.Lock()
+	defer r.topo.mu.Unlock()
+	return r.masterAddr
+}
+
+// SlaveOf points the instance at master, or makes it a master if master is
+// nil
+func (r *Redis) SlaveOf(master *Redis) {
+	r.topo.mu.Lock()
+	defer r.topo.mu.Unlock()
+	r.masterAddr = ""
+	if master != nil {
+		r.masterAddr = master.addr
+	}
+}
+
+// Config returns a configuration parameter
+func (r *Redis) Config(key string) string {
+	r.topo.mu.Lock()
+	defer r.topo.mu.Unlock()
+	return r.config[key]
+}
+
+// SetConfig sets a configuration parameter, whether or not CONFIG SET would
+// accept it
+func (r *Redis) SetConfig(key, value string) {
+	r.topo.mu.Lock()
+	defer r.topo.mu.Unlock()
+	r.config[key] = value
+}
+
+// SetUsedMemory sets the used_memory INFO reports
+func (r *Redis) SetUsedMemory(bytes int64) {
+	r.topo.mu.Lock()
+	defer r.topo.mu.Unlock()
+	r.usedMemory = bytes
+}
+
+// SetReplOffset sets the replication offset, which decides which slave a
+// failover promotes
+func (r *Redis) SetReplOffset(offset int64) {
+	r.topo.mu.Lock()
+	defer r.topo.mu.Unlock()
+	r.offset = offset
+}
+
+// SetLag sets how many seconds behind its master a slave reports being
+func (r *Redis) SetLag(seconds int) {
+	r.topo.mu.Lock()
+	defer r.topo.mu.Unlock()
+	r.lag = seconds
+}
+
+// SetSyncing marks a slave as in the middle of its initial sync
+func (r *Redis) SetSyncing(syncing bool) {
+	r.topo.mu.Lock()
+	defer r.topo.mu.Unlock()
+	r.syncing = syncing
+}
+
+// AddSlowLog records a slow command
+func (r *Redis) AddSlowLog(d time.Duration, args ...string) {
+	r.topo.mu.Lock()
+	defer r.topo.mu.Unlock()
+	r.slowlogID++
+	r.slowlog = append(r.slowlog, slowlogEntry{id: r.slowlogID, time: time.Now(), duration: d, args: args})
+}
+
+// AddLatency records a latency spike for the event, e.g. "command"
+func (r *Redis) AddLatency(event string, latency time.Duration) {
+	r.topo.mu.Lock()
+	defer r.topo.mu.Unlock()
+	r.latency[event] = append(r.latency[event], latencySample{time: time.Now(), latency: latency})
+}
+
+func (r *Redis) role() string {
+	if r.masterAddr == "" {
+		return "master"
+	}
+	return "slave"
+}
+
+func (r *Redis) priority() int {
+	p, _ := strconv.Atoi(r.config["slave-priority"])
+	return p
+}
+
+// linkUp reports whether a slave is replicating. The topology must be
+// locked.
+func (r *Redis) linkUp() bool {
+	if r.masterAddr == "" || r.syncing {
+		return false
+	}
+	master := r.topo.redisAt(r.masterAddr)
+	if master == nil || !master.Running() {
+		return false
+	}
+	pass := master.config["requirepass"]
+	return pass == "" || pass == r.config["masterauth"]
+}
+
+// command answers a command with the topology locked
+func (r *Redis) command(c *conn, args []string) interface{} {
+	name := strings.ToUpper(args[0])
+	if name == "AUTH" {
+		if len(args) != 2 {
+			return errorf("ERR wrong number of arguments for 'auth' command")
+		}
+		pass := r.config["requirepass"]
+		if pass == "" {
+			return errorf("ERR Client sent AUTH, but no password is set")
+		}
+		if args[1] != pass {
+			c.authed = false
+			return errorf("ERR invalid password")
+		}
+		c.authed = true
+		return okReply
+	}
+	if r.config["requirepass"] != "" && !c.authed {
+		return errorf("NOAUTH Authentication required.")
+	}
+	switch name {
+	case "PING":
+		if len(args) > 1 {
+			return args[1]
+		}
+		return status("PONG")
+	case "ECHO":
+		if len(args) != 2 {
+			return errorf("ERR wrong number of arguments for 'echo' command")
+		}
+		return args[1]
+	case "SELECT":
+		return okReply
+	case "DBSIZE":
+		return 0
+	case "INFO":
+		section := ""
+		if len(args) > 1 {
+			section = args[1]
+		}
+		return r.info(section)
+	case "CONFIG":
+		return r.configCommand(args[1:])
+	case "SLAVEOF", "REPLICAOF":
+		return r.slaveOfCommand(args[1:])
+	case "SLOWLOG":
+		return r.slowlogCommand(args[1:])
+	case "LATENCY":
+		return r.latencyCommand(args[1:])
+	}
+	return errorf("ERR unknown command '%s'", strings.ToLower(args[0]))
+}
+
+func (r *Redis) configCommand(args []string) interface{} {
+	if len(args) == 0 {
+		return errorf("ERR wrong number of arguments for 'config' command")
+	}
+	switch strings.ToUpper(args[0]) {
+	case "GET":
+		if len(args) != 2 {
+			return errorf("ERR Wrong number of arguments for CONFIG get")
+		}
+		var keys []string
+		for k := range r.config {
+			if ok, _ := path.Match(strings.ToLower(args[1]), k); ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		var reply fields
+		for _, k := range keys {
+			reply.add(k, r.config[k])
+		}
+		return []string(reply)
+	case "SET":
+		if len(args) != 3 {
+			return errorf("ERR Wrong number of arguments for CONFIG set")
+		}
+		key := strings.ToLower(args[1])
+		if _, ok := r.config[key]; !ok {
+			return errorf("ERR Unsupported CONFIG parameter: %s", args[1])
+		}
+		r.config[key] = args[2]
+		return okReply
+	case "REWRITE", "RESETSTAT":
+		return okReply
+	}
+	return errorf("ERR CONFIG subcommand must be one of GET, SET, RESETSTAT, REWRITE")
+}
+
+func (r *Redis) slaveOfCommand(args []string) interface{} {
+	if len(args) != 2 {
+		return errorf("ERR wrong number of arguments for 'slaveof' command")
+	}
+	if strings.EqualFold(args[0], "no") && strings.EqualFold(args[1], "one") {
+		r.masterAddr = ""
+		return okReply
+	}
+	port, err := strconv.Atoi(args[1])
+	if err != nil {
+		return errorf("ERR value is not an integer or out of range")
+	}
+	addr := net.JoinHostPort(args[0], strconv.Itoa(port))
+	if addr == r.masterAddr {
+		return status("OK Already connected to specified master")
+	}
+	r.masterAddr = addr
+	return okReply
+}
+
+func (r *Redis) slowlogCommand(args []string) interface{} {
+	if len(args) == 0 {
+		return errorf("ERR wrong number of arguments for 'slowlog' command")
+	}
+	switch strings.ToUpper(args[0]) {
+	case "LEN":
+		return len(r.slowlog)
+	case "RESET":
+		r.slowlog = nil
+		return okReply
+	case "GET":
+		count := 10
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil {
+				return errorf("ERR value is not an integer or out of range")
+			}
+			count = n
+		}
+		var reply []interface{}
+		for i := len(r.slowlog) - 1; i >= 0 && (count < 0 || len(reply) < count); i-- {
+			e := r.slowlog[i]
+			reply = append(reply, []interface{}{e.id, e.time.Unix(), int64(e.duration / time.Microsecond), e.args})
+		}
+		if reply == nil {
+			return []interface{}{}
+		}
+		return reply
+	}
+	return errorf("ERR Unknown SLOWLOG subcommand or wrong # of args. Try GET, RESET, LEN.")
+}
+
+func (r *Redis) latencyCommand(args []string) interface{} {
+	if len(args) == 0 {
+		return errorf("ERR wrong number of arguments for 'latency' command")
+	}
+	switch strings.ToUpper(args[0]) {
+	case "HISTORY":
+		if len(args) != 2 {
+			return errorf("ERR wrong number of arguments for 'latency' command")
+		}
+		reply := []interface{}{}
+		for _, s := range r.latency[args[1]] {
+			reply = append(reply, []interface{}{s.time.Unix(), int64(s.latency / time.Millisecond)})
+		}
+		return reply
+	case "LATEST":
+		reply := []interface{}{}
+		for _, event := range r.latencyEvents() {
+			samples := r.latency[event]
+			last := samples[len(samples)-1]
+			var max time.Duration
+			for _, s := range samples {
+				if s.latency > max {
+					max = s.latency
+				}
+			}
+			reply = append(reply, []interface{}{event, last.time.Unix(), int64(last.latency / time.Millisecond), int64(max / time.Millisecond)})
+		}
+		return reply
+	case "DOCTOR":
+		events := r.latencyEvents()
+		if len(events) == 0 {
+			return "Dave, no latency spike was observed during the lifetime of this Redis instance, not in the slightest bit. I honestly think you ought to sleep better tonight."
+		}
+		var b strings.Builder
+		b.WriteString("Dave, I have observed latency spikes in this Redis instance. You don't mind talking about it, do you Dave?\n\n")
+		for i, event := range events {
+			fmt.Fprintf(&b, "%d. %s: %d latency spikes.\n", i+1, event, len(r.latency[event]))
+		}
+		return b.String()
+	case "RESET":
+		events := args[1:]
+		if len(events) == 0 {
+			events = r.latencyEvents()
+		}
+		reset := 0
+		for _, event := range events {
+			if _, ok := r.latency[event]; ok {
+				delete(r.latency, event)
+				reset++
+			}
+		}
+		return reset
+	}
+	return errorf("ERR Unknown LATENCY subcommand or wrong number of arguments")
+}
+
+func (r *Redis) latencyEvents() []string {
+	var events []string
+	for event, samples := range r.latency {
+		if len(samples) > 0 {
+			events = append(events, event)
+		}
+	}
+	sort.Strings(events)
+	return events
+}
+
+// info renders INFO. The default sections leave out commandstats, as Redis
+// does.
+func (r *Redis) info(section string) string {
+	section = strings.ToLower(section)
+	all := section == "all" || section == "everything"
+	def := section == "" || section == "default"
+	var b strings.Builder
+	add := func(name string, render func(*strings.Builder)) {
+		if all || def && name != "commandstats" || section == name {
+			if b.Len() > 0 {
+				b.WriteString("\r\n")
+			}
+			fmt.Fprintf(&b, "# %s%s\r\n", strings.ToUpper(name[:1]), name[1:])
+			render(&b)
+		}
+	}
+	uptime := int64(time.Since(r.started) / time.Second)
+	add("server", func(b *strings.Builder) {
+		fmt.Fprintf(b, "redis_version:%s\r\n", redisVersion)
+		b.WriteString("redis_mode:standalone\r\n")
+		b.WriteString("os:Linux\r\narch_bits:64\r\n")
+		fmt.Fprintf(b, "run_id:%s\r\n", r.runID)
+		fmt.Fprintf(b, "tcp_port:%d\r\n", r.port)
+		fmt.Fprintf(b, "uptime_in_seconds:%d\r\n", uptime)
+		fmt.Fprintf(b, "uptime_in_days:%d\r\n", uptime/86400)
+		b.WriteString("config_file:\r\n")
+	})
+	add("clients", func(b *strings.Builder) {
+		r.mu.Lock()
+		clients := len(r.conns)
+		r.mu.Unlock()
+		fmt.Fprintf(b, "connected_clients:%d\r\nblocked_clients:0\r\n", clients)
+	})
+	add("memory", func(b *strings.Builder) {
+		fmt.Fprintf(b, "used_memory:%d\r\n", r.usedMemory)
+		fmt.Fprintf(b, "used_memory_human:%.2fM\r\n", float64(r.usedMemory)/(1024*1024))
+		fmt.Fprintf(b, "used_memory_rss:%d\r\n", r.usedMemory)
+		fmt.Fprintf(b, "used_memory_peak:%d\r\n", r.usedMemory)
+		b.WriteString("used_memory_lua:37888\r\n")
+		fmt.Fprintf(b, "maxmemory:%s\r\n", r.config["maxmemory"])
+		fmt.Fprintf(b, "maxmemory_policy:%s\r\n", r.config["maxmemory-policy"])
+	})
+	add("persistence", func(b *strings.Builder) {
+		b.WriteString("loading:0\r\n")
+		b.WriteString("rdb_changes_since_last_save:0\r\n")
+		b.WriteString("rdb_bgsave_in_progress:0\r\n")
+		b.WriteString("rdb_last_bgsave_status:ok\r\n")
+		aof := 0
+		if r.config["appendonly"] == "yes" {
+			aof = 1
+		}
+		fmt.Fprintf(b, "aof_enabled:%d\r\n", aof)
+		b.WriteString("aof_rewrite_in_progress:0\r\n")
+		b.WriteString("aof_last_bgrewrite_status:ok\r\n")
+	})
+	add("stats", func(b *strings.Builder) {
+		b.WriteString("total_connections_received:1\r\n")
+		b.WriteString("total_commands_processed:1\r\n")
+	})
+	add("replication", func(b *strings.Builder) {
+		fmt.Fprintf(b, "role:%s\r\n", r.role())
+		if r.masterAddr != "" {
+			host, port, _ := net.SplitHostPort(r.masterAddr)
+			fmt.Fprintf(b, "master_host:%s\r\n", host)
+			fmt.Fprintf(b, "master_port:%s\r\n", port)
+			link := "down"
+			if r.linkUp() {
+				link = "up"
+			}
+			fmt.Fprintf(b, "master_link_status:%s\r\n", link)
+			fmt.Fprintf(b, "master_last_io_seconds_ago:%d\r\n", r.lag+1)
+			fmt.Fprintf(b, "master_sync_in_progress:%d\r\n", boolInt(r.syncing))
+			fmt.Fprintf(b, "slave_repl_offset:%d\r\n", r.offset)
+			fmt.Fprintf(b, "slave_priority:%s\r\n", r.config["slave-priority"])
+			fmt.Fprintf(b, "slave_read_only:%d\r\n", boolInt(r.config["slave-read-only"] == "yes"))
+		}
+		var slaves []*Redis
+		for _, s := range r.topo.slavesOf(r.addr) {
+			if s.linkUp() {
+				slaves = append(slaves, s)
+			}
+		}
+		fmt.Fprintf(b, "connected_slaves:%d\r\n", len(slaves))
+		for i, s := range slaves {
+			fmt.Fprintf(b, "slave%d:ip=%s,port=%d,state=online,offset=%d,lag=%d\r\n", i, s.host, s.port, s.offset, s.lag)
+		}
+		fmt.Fprintf(b, "master_repl_offset:%d\r\n", r.offset)
+		b.WriteString("repl_backlog_active:0\r\n")
+		fmt.Fprintf(b, "repl_backlog_size:%s\r\n", r.config["repl-backlog-size"])
+	})
+	add("cpu", func(b *strings.Builder) {
+		b.WriteString("used_cpu_sys:0.01\r\nused_cpu_user:0.01\r\n")
+	})
+	add("commandstats", func(b *strings.Builder) {
+		r.mu.Lock()
+		counts := make(map[string]int)
+		for name, n := range r.calls {
+			counts[strings.ToLower(strings.Fields(name)[0])] += n
+		}
+		r.mu.Unlock()
+		var names []string
+		for name := range counts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(b, "cmdstat_%s:calls=%d,usec=%d,usec_per_call=1.00\r\n", name, counts[name], counts[name])
+		}
+	})
+	add("keyspace", func(b *strings.Builder) {})
+	return b.String()
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,120 @@
+package redistest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxBulkLen bounds the size of a single command argument
+const maxBulkLen = 512 * 1024 * 1024
+
+var errProtocol = errors.New("Protocol error")
+
+// status is a simple string reply, written as +status
+type status string
+
+// replyError is an error reply, written as -message. The message starts with
+// the error type, e.g. "ERR" or "NOAUTH".
+type replyError string
+
+// nilArray is the null multi-bulk reply, written as *-1
+type nilArray struct{}
+
+// okReply is the reply most write commands give
+const okReply = status("OK")
+
+// errorf returns an error reply
+func errorf(format string, args ...interface{}) replyError {
+	return replyError(fmt.Sprintf(format, args...))
+}
+
+// readCommand reads one command, either as a multi-bulk request or inline
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, nil
+	}
+	if line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+	count, err := strconv.Atoi(line[1:])
+	if err != nil || count > 1024*1024 {
+		return nil, errProtocol
+	}
+	args := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		header, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(header) == 0 || header[0] != '$' {
+			return nil, errProtocol
+		}
+		size, err := strconv.Atoi(header[1:])
+		if err != nil || size < 0 || size > maxBulkLen {
+			return nil, errProtocol
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// writeReply encodes a reply. Strings are bulk strings, nil is the null
+// bulk string and slices are multi-bulk replies.
+func writeReply(w *bufio.Writer, reply interface{}) {
+	switch v := reply.(type) {
+	case status:
+		fmt.Fprintf(w, "+%s\r\n", string(v))
+	case replyError:
+		fmt.Fprintf(w, "-%s\r\n", string(v))
+	case int:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case string:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case nil:
+		w.WriteString("$-1\r\n")
+	case nilArray:
+		w.WriteString("*-1\r\n")
+	case []string:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, s := range v {
+			writeReply(w, s)
+		}
+	case []interface{}:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, item := range v {
+			writeReply(w, item)
+		}
+	default:
+		writeReply(w, errorf("ERR fake server cannot encode %T", reply))
+	}
+}
+
+// fields flattens key/value pairs into the alternating list Redis and
+// Sentinel use for hashes
+type fields []string
+
+func (f *fields) add(key string, value interface{}) {
+	*f = append(*f, key, fmt.Sprint(value))
+}
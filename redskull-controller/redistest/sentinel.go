@@ -0,0 +1,514 @@
+package redistest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultOptions are the per-master settings a sentinel reports unless
+// SENTINEL SET changes them
+var defaultOptions = map[string]string{
+	"down-after-milliseconds": "30000",
+	"failover-timeout":        "180000",
+	"parallel-syncs":          "1",
+}
+
+// Sentinel is a fake sentinel. What it reports about a master's slaves and
+// other sentinels comes from the topology rather than from gossip, so it is
+// always up to date.
+type Sentinel struct {
+	server
+	runID        string
+	started      time.Time
+	masters      map[string]*monitor
+	tilt         bool
+	configFile   string
+	currentEpoch int64
+}
+
+// monitor is a master a sentinel monitors
+type monitor struct {
+	name        string
+	host        string
+	port        int
+	quorum      int
+	authPass    string
+	options     map[string]string
+	configEpoch int64
+}
+
+func (m *monitor) addr() string {
+	return net.JoinHostPort(m.host, strconv.Itoa(m.port))
+}
+
+func (m *monitor) option(key string) string {
+	if v, ok := m.options[key]; ok {
+		return v
+	}
+	return defaultOptions[key]
+}
+
+func newSentinel() *Sentinel {
+	return &Sentinel{
+		runID:   newRunID(),
+		started: time.Now(),
+		masters: make(map[string]*monitor),
+	}
+}
+
+// Monitor has the sentinel monitor master as name, as SENTINEL MONITOR
+// followed by SENTINEL SET auth-pass would
+func (s *Sentinel) Monitor(name string, master *Redis, quorum int, auth string) {
+	s.topo.mu.Lock()
+	defer s.topo.mu.Unlock()
+	s.masters[name] = &monitor{
+		name:     name,
+		host:     master.host,
+		port:     master.port,
+		quorum:   quorum,
+		authPass: auth,
+		options:  make(map[string]string),
+	}
+	s.topo.rewriteConfigs()
+}
+
+// Remove stops the sentinel monitoring name
+func (s *Sentinel) Remove(name string) {
+	s.topo.mu.Lock()
+	defer s.topo.mu.Unlock()
+	delete(s.masters, name)
+	s.topo.rewriteConfigs()
+}
+
+// Masters returns the names the sentinel monitors, sorted
+func (s *Sentinel) Masters() []string {
+	s.topo.mu.Lock()
+	defer s.topo.mu.Unlock()
+	return s.masterNames()
+}
+
+// MasterAddr returns the address the sentinel has for name's master, or ""
+func (s *Sentinel) MasterAddr(name string) string {
+	s.topo.mu.Lock()
+	defer s.topo.mu.Unlock()
+	if m, ok := s.masters[name]; ok {
+		return m.addr()
+	}
+	return ""
+}
+
+// AuthPass returns the auth-pass the sentinel has for name
+func (s *Sentinel) AuthPass(name string) string {
+	s.topo.mu.Lock()
+	defer s.topo.mu.Unlock()
+	if m, ok := s.masters[name]; ok {
+		return m.authPass
+	}
+	return ""
+}
+
+// Option returns a setting such as "down-after-milliseconds" the sentinel
+// has for name
+func (s *Sentinel) Option(name, key string) string {
+	s.topo.mu.Lock()
+	defer s.topo.mu.Unlock()
+	if m, ok := s.masters[name]; ok {
+		return m.option(key)
+	}
+	return ""
+}
+
+// SetTilt puts the sentinel in or out of TILT mode
+func (s *Sentinel) SetTilt(tilt bool) {
+	s.topo.mu.Lock()
+	defer s.topo.mu.Unlock()
+	s.tilt = tilt
+}
+
+// SetConfigFile gives the sentinel a config file, which it writes now and
+// rewrites whenever its masters change, as Sentinel does. INFO reports it
+// as config_file.
+func (s *Sentinel) SetConfigFile(filename string) error {
+	s.topo.mu.Lock()
+	defer s.topo.mu.Unlock()
+	s.configFile = filename
+	return s.rewriteConfig()
+}
+
+// ConfigFile returns the sentinel's config file, or "" if it has none
+func (s *Sentinel) ConfigFile() string {
+	s.topo.mu.Lock()
+	defer s.topo.mu.Unlock()
+	return s.configFile
+}
+
+func (s *Sentinel) masterNames() []string {
+	var names []string
+	for name := range s.masters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// rewriteConfig writes the config file in the layout Sentinel uses, with
+// port and bind ahead of the sentinel directives. The topology must be
+// locked.
+func (s *Sentinel) rewriteConfig() error {
+	if s.configFile == "" {
+		return nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "port %d\n", s.port)
+	fmt.Fprintf(&b, "bind %s\n", s.host)
+	fmt.Fprintf(&b, "dir \"%s\"\n", path.Dir(s.configFile))
+	fmt.Fprintf(&b, "sentinel myid %s\n", s.runID)
+	for _, name := range s.masterNames() {
+		m := s.masters[name]
+		fmt.Fprintf(&b, "sentinel monitor %s %s %d %d\n", name, m.host, m.port, m.quorum)
+		var keys []string
+		for k := range m.options {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if m.options[k] != defaultOptions[k] {
+				fmt.Fprintf(&b, "sentinel %s %s %s\n", k, name, m.options[k])
+			}
+		}
+		if m.authPass != "" {
+			fmt.Fprintf(&b, "sentinel auth-pass %s %s\n", name, m.authPass)
+		}
+		fmt.Fprintf(&b, "sentinel config-epoch %s %d\n", name, m.configEpoch)
+		fmt.Fprintf(&b, "sentinel leader-epoch %s %d\n", name, m.configEpoch)
+		for _, r := range s.topo.slavesOf(m.addr()) {
+			fmt.Fprintf(&b, "sentinel known-slave %s %s %d\n", name, r.host, r.port)
+		}
+		for _, other := range s.topo.monitorsOf(name, m.addr()) {
+			if other != s {
+				fmt.Fprintf(&b, "sentinel known-sentinel %s %s %d %s\n", name, other.host, other.port, other.runID)
+			}
+		}
+	}
+	fmt.Fprintf(&b, "sentinel current-epoch %d\n", s.currentEpoch)
+	return ioutil.WriteFile(s.configFile, []byte(b.String()), 0600)
+}
+
+// command answers a command with the topology locked
+func (s *Sentinel) command(c *conn, args []string) interface{} {
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return status("PONG")
+	case "INFO":
+		section := ""
+		if len(args) > 1 {
+			section = args[1]
+		}
+		return s.info(section)
+	case "SENTINEL":
+		if len(args) < 2 {
+			return errorf("ERR wrong number of arguments for 'sentinel' command")
+		}
+		return s.sentinelCommand(strings.ToUpper(args[1]), args[2:])
+	}
+	return errorf("ERR unknown command '%s'", strings.ToLower(args[0]))
+}
+
+func (s *Sentinel) sentinelCommand(sub string, args []string) interface{} {
+	wrongArgs := errorf("ERR wrong number of arguments for 'sentinel %s'", strings.ToLower(sub))
+	if sub == "MASTERS" {
+		reply := []interface{}{}
+		for _, name := range s.masterNames() {
+			reply = append(reply, s.masterFields(s.masters[name]))
+		}
+		return reply
+	}
+	if sub == "MONITOR" {
+		if len(args) != 4 {
+			return wrongArgs
+		}
+		return s.monitorCommand(args[0], args[1], args[2], args[3])
+	}
+	if sub == "RESET" {
+		if len(args) != 1 {
+			return wrongArgs
+		}
+		reset := 0
+		for _, name := range s.masterNames() {
+			if ok, _ := path.Match(args[0], name); ok {
+				reset++
+			}
+		}
+		return reset
+	}
+	if len(args) == 0 {
+		return wrongArgs
+	}
+	name := args[0]
+	m, ok := s.masters[name]
+	if sub == "GET-MASTER-ADDR-BY-NAME" {
+		if !ok {
+			return nilArray{}
+		}
+		return []string{m.host, strconv.Itoa(m.port)}
+	}
+	if !ok {
+		return errorf("ERR No such master with that name")
+	}
+	switch sub {
+	case "MASTER":
+		return s.masterFields(m)
+	case "SLAVES", "REPLICAS":
+		reply := []interface{}{}
+		for _, r := range s.topo.slavesOf(m.addr()) {
+			reply = append(reply, slaveFields(r))
+		}
+		return reply
+	case "SENTINELS":
+		reply := []interface{}{}
+		for _, other := range s.topo.monitorsOf(name, m.addr()) {
+			if other != s {
+				reply = append(reply, sentinelFields(other))
+			}
+		}
+		return reply
+	case "REMOVE":
+		delete(s.masters, name)
+		s.topo.rewriteConfigs()
+		return okReply
+	case "SET":
+		if len(args) < 3 || len(args)%2 != 1 {
+			return wrongArgs
+		}
+		return s.setCommand(m, args[1:])
+	case "FAILOVER":
+		if e := s.topo.failover(name, m.addr(), s); e != "" {
+			return e
+		}
+		return okReply
+	case "CKQUORUM":
+		usable := 0
+		for _, other := range s.topo.monitorsOf(name, m.addr()) {
+			if other.Running() {
+				usable++
+			}
+		}
+		if usable < m.quorum {
+			return errorf("NOQUORUM %d usable Sentinels. Not enough available Sentinels to reach the specified quorum for this master", usable)
+		}
+		if usable <= len(s.topo.monitorsOf(name, m.addr()))/2 {
+			return errorf("NOQUORUM %d usable Sentinels. Not enough available Sentinels to reach the majority and authorize a failover", usable)
+		}
+		return status(fmt.Sprintf("OK %d usable Sentinels. Quorum and failover authorization can be reached", usable))
+	}
+	return errorf("ERR Unknown sentinel subcommand '%s'", strings.ToLower(sub))
+}
+
+func (s *Sentinel) monitorCommand(name, ip, port, quorum string) interface{} {
+	if _, ok := s.masters[name]; ok {
+		return errorf("ERR Duplicated master name")
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return errorf("ERR value is not an integer or out of range")
+	}
+	q, err := strconv.Atoi(quorum)
+	if err != nil {
+		return errorf("ERR value is not an integer or out of range")
+	}
+	if q <= 0 {
+		return errorf("ERR Quorum must be 1 or greater.")
+	}
+	if net.ParseIP(ip) == nil {
+		return errorf("ERR Invalid IP address specified")
+	}
+	s.masters[name] = &monitor{name: name, host: ip, port: p, quorum: q, options: make(map[string]string)}
+	s.topo.rewriteConfigs()
+	return okReply
+}
+
+func (s *Sentinel) setCommand(m *monitor, pairs []string) interface{} {
+	for i := 0; i < len(pairs); i += 2 {
+		key, value := strings.ToLower(pairs[i]), pairs[i+1]
+		switch key {
+		case "auth-pass":
+			m.authPass = value
+		case "quorum":
+			q, err := strconv.Atoi(value)
+			if err != nil || q <= 0 {
+				return errorf("ERR Invalid argument '%s' for SENTINEL SET '%s'", value, key)
+			}
+			m.quorum = q
+		case "down-after-milliseconds", "failover-timeout", "parallel-syncs":
+			if n, err := strconv.Atoi(value); err != nil || n <= 0 {
+				return errorf("ERR Invalid argument '%s' for SENTINEL SET '%s'", value, key)
+			}
+			m.options[key] = value
+		case "notification-script", "client-reconfig-script":
+			m.options[key] = value
+		default:
+			return errorf("ERR Invalid argument '%s' for SENTINEL SET '%s'", value, key)
+		}
+	}
+	s.rewriteConfig()
+	return okReply
+}
+
+// masterFields renders a master as SENTINEL MASTER does. A master which is
+// down or unknown is subjectively down, and objectively down once a quorum
+// of running sentinels monitor it.
+func (s *Sentinel) masterFields(m *monitor) []string {
+	flags := "master"
+	master := s.topo.redisAt(m.addr())
+	runID := ""
+	if master == nil || !master.Running() {
+		flags += ",s_down"
+		agree := 0
+		for _, other := range s.topo.monitorsOf(m.name, m.addr()) {
+			if other.Running() {
+				agree++
+			}
+		}
+		if agree >= m.quorum {
+			flags += ",o_down"
+		}
+	} else {
+		runID = master.runID
+	}
+	others := 0
+	for _, other := range s.topo.monitorsOf(m.name, m.addr()) {
+		if other != s {
+			others++
+		}
+	}
+	var f fields
+	f.add("name", m.name)
+	f.add("ip", m.host)
+	f.add("port", m.port)
+	f.add("runid", runID)
+	f.add("flags", flags)
+	f.add("link-pending-commands", 0)
+	f.add("link-refcount", 1)
+	f.add("last-ping-sent", 0)
+	f.add("last-ok-ping-reply", 100)
+	f.add("last-ping-reply", 100)
+	f.add("down-after-milliseconds", m.option("down-after-milliseconds"))
+	f.add("info-refresh", 1000)
+	f.add("role-reported", "master")
+	f.add("role-reported-time", int64(time.Since(s.started)/time.Millisecond))
+	f.add("config-epoch", m.configEpoch)
+	f.add("num-slaves", len(s.topo.slavesOf(m.addr())))
+	f.add("num-other-sentinels", others)
+	f.add("quorum", m.quorum)
+	f.add("failover-timeout", m.option("failover-timeout"))
+	f.add("parallel-syncs", m.option("parallel-syncs"))
+	return f
+}
+
+func slaveFields(r *Redis) []string {
+	flags := "slave"
+	if !r.Running() {
+		flags += ",s_down"
+	}
+	link := "err"
+	if r.linkUp() {
+		link = "ok"
+	}
+	host, port, _ := net.SplitHostPort(r.masterAddr)
+	var f fields
+	f.add("name", r.addr)
+	f.add("ip", r.host)
+	f.add("port", r.port)
+	f.add("runid", r.runID)
+	f.add("flags", flags)
+	f.add("link-pending-commands", 0)
+	f.add("link-refcount", 1)
+	f.add("last-ping-sent", 0)
+	f.add("last-ok-ping-reply", 100)
+	f.add("last-ping-reply", 100)
+	f.add("down-after-milliseconds", defaultOptions["down-after-milliseconds"])
+	f.add("info-refresh", 1000)
+	f.add("role-reported", "slave")
+	f.add("role-reported-time", int64(time.Since(r.started)/time.Millisecond))
+	f.add("master-link-down-time", 0)
+	f.add("master-link-status", link)
+	f.add("master-host", host)
+	f.add("master-port", port)
+	f.add("slave-priority", r.priority())
+	f.add("slave-repl-offset", r.offset)
+	return f
+}
+
+func sentinelFields(s *Sentinel) []string {
+	flags := "sentinel"
+	if !s.Running() {
+		flags += ",s_down"
+	}
+	var f fields
+	f.add("name", s.addr)
+	f.add("ip", s.host)
+	f.add("port", s.port)
+	f.add("runid", s.runID)
+	f.add("flags", flags)
+	f.add("link-pending-commands", 0)
+	f.add("link-refcount", 1)
+	f.add("last-hello-message", 500)
+	f.add("voted-leader", "?")
+	f.add("voted-leader-epoch", 0)
+	return f
+}
+
+// info renders INFO for a sentinel, which has no memory, persistence or
+// replication sections
+func (s *Sentinel) info(section string) string {
+	section = strings.ToLower(section)
+	all := section == "" || section == "default" || section == "all" || section == "everything"
+	var b strings.Builder
+	uptime := int64(time.Since(s.started) / time.Second)
+	if all || section == "server" {
+		b.WriteString("# Server\r\n")
+		fmt.Fprintf(&b, "redis_version:%s\r\n", redisVersion)
+		b.WriteString("redis_mode:sentinel\r\n")
+		b.WriteString("os:Linux\r\narch_bits:64\r\n")
+		fmt.Fprintf(&b, "run_id:%s\r\n", s.runID)
+		fmt.Fprintf(&b, "tcp_port:%d\r\n", s.port)
+		fmt.Fprintf(&b, "uptime_in_seconds:%d\r\n", uptime)
+		fmt.Fprintf(&b, "uptime_in_days:%d\r\n", uptime/86400)
+		fmt.Fprintf(&b, "config_file:%s\r\n", s.configFile)
+	}
+	if all || section == "clients" {
+		if b.Len() > 0 {
+			b.WriteString("\r\n")
+		}
+		s.mu.Lock()
+		clients := len(s.conns)
+		s.mu.Unlock()
+		fmt.Fprintf(&b, "# Clients\r\nconnected_clients:%d\r\nblocked_clients:0\r\n", clients)
+	}
+	if all || section == "sentinel" {
+		if b.Len() > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString("# Sentinel\r\n")
+		fmt.Fprintf(&b, "sentinel_masters:%d\r\n", len(s.masters))
+		fmt.Fprintf(&b, "sentinel_tilt:%d\r\n", boolInt(s.tilt))
+		b.WriteString("sentinel_running_scripts:0\r\n")
+		b.WriteString("sentinel_scripts_queue_length:0\r\n")
+		for i, name := range s.masterNames() {
+			m := s.masters[name]
+			state := "ok"
+			if master := s.topo.redisAt(m.addr()); master == nil || !master.Running() {
+				state = "odown"
+			}
+			fmt.Fprintf(&b, "master%d:name=%s,status=%s,address=%s,slaves=%d,sentinels=%d\r\n",
+				i, name, state, m.addr(), len(s.topo.slavesOf(m.addr())), len(s.topo.monitorsOf(name, m.addr())))
+		}
+	}
+	return b.String()
+}
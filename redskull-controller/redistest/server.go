@@ -0,0 +1,269 @@
+package redistest
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fault is a scripted misbehaviour for a command
+type fault struct {
+	err   replyError
+	delay time.Duration
+	drop  bool
+}
+
+// server is the network side shared by Redis and Sentinel: it accepts
+// connections, applies scripted faults and hands each command to handle
+// with the topology locked.
+type server struct {
+	topo   *Topology
+	handle func(c *conn, args []string) interface{}
+	addr   string
+	host   string
+	port   int
+
+	mu       sync.Mutex // guards the fields below
+	listener net.Listener
+	conns    map[net.Conn]bool
+	stopped  chan struct{}
+	faults   map[string]fault
+	calls    map[string]int
+}
+
+// conn is a client connection's state
+type conn struct {
+	server *server
+	authed bool
+}
+
+// listen starts the server on a free loopback port. Like httptest, it
+// panics if no port can be had.
+func (s *server) listen(t *Topology, handle func(c *conn, args []string) interface{}) {
+	s.topo = t
+	s.handle = handle
+	s.faults = make(map[string]fault)
+	s.calls = make(map[string]int)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("redistest: failed to listen on a port: %v", err))
+	}
+	s.addr = l.Addr().String()
+	host, port, _ := net.SplitHostPort(s.addr)
+	s.host = host
+	s.port, _ = strconv.Atoi(port)
+	s.serve(l)
+}
+
+func (s *server) serve(l net.Listener) {
+	s.mu.Lock()
+	s.listener = l
+	s.conns = make(map[net.Conn]bool)
+	s.stopped = make(chan struct{})
+	stopped := s.stopped
+	s.mu.Unlock()
+	go func() {
+		for {
+			nc, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			if s.listener != l {
+				s.mu.Unlock()
+				nc.Close()
+				return
+			}
+			s.conns[nc] = true
+			s.mu.Unlock()
+			go s.serveConn(nc, stopped)
+		}
+	}()
+}
+
+func (s *server) serveConn(nc net.Conn, stopped chan struct{}) {
+	defer func() {
+		nc.Close()
+		s.mu.Lock()
+		delete(s.conns, nc)
+		s.mu.Unlock()
+	}()
+	c := &conn{server: s}
+	r := bufio.NewReader(nc)
+	w := bufio.NewWriter(nc)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			if err == errProtocol {
+				writeReply(w, errorf("ERR Protocol error"))
+				w.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		name := commandName(args)
+		s.mu.Lock()
+		s.calls[name]++
+		f, faulty := s.faultFor(name)
+		s.mu.Unlock()
+		var reply interface{}
+		if faulty {
+			if f.delay > 0 {
+				select {
+				case <-time.After(f.delay):
+				case <-stopped:
+					return
+				}
+			}
+			if f.drop {
+				return
+			}
+			if f.err != "" {
+				reply = f.err
+			}
+		}
+		if reply == nil {
+			if name == "QUIT" {
+				writeReply(w, okReply)
+				w.Flush()
+				return
+			}
+			s.topo.mu.Lock()
+			reply = s.handle(c, args)
+			s.topo.mu.Unlock()
+		}
+		writeReply(w, reply)
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// commandName returns the command's name in upper case, with the
+// subcommand for commands which have them, e.g. "SENTINEL MASTERS"
+func commandName(args []string) string {
+	name := strings.ToUpper(args[0])
+	switch name {
+	case "SENTINEL", "CONFIG", "SLOWLOG", "LATENCY", "CLIENT":
+		if len(args) > 1 {
+			name += " " + strings.ToUpper(args[1])
+		}
+	}
+	return name
+}
+
+// faultFor returns the fault scripted for the command, for its command
+// family ("SENTINEL" covers "SENTINEL MASTERS") or for every command ("*")
+func (s *server) faultFor(name string) (fault, bool) {
+	if f, ok := s.faults[name]; ok {
+		return f, true
+	}
+	if i := strings.Index(name, " "); i > 0 {
+		if f, ok := s.faults[name[:i]]; ok {
+			return f, true
+		}
+	}
+	f, ok := s.faults["*"]
+	return f, ok
+}
+
+func (s *server) setFault(command string, update func(*fault)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := strings.ToUpper(command)
+	f := s.faults[key]
+	update(&f)
+	s.faults[key] = f
+}
+
+// Addr returns the server's address in host:port form
+func (s *server) Addr() string {
+	return s.addr
+}
+
+// Host returns the IP the server listens on
+func (s *server) Host() string {
+	return s.host
+}
+
+// Port returns the port the server listens on
+func (s *server) Port() int {
+	return s.port
+}
+
+// Fail makes the command, e.g. "INFO" or "SENTINEL MASTERS", answer with
+// the error message instead. A command family such as "SENTINEL", or "*"
+// for every command, may be given. The message should start with an error
+// type such as "ERR".
+func (s *server) Fail(command, message string) {
+	s.setFault(command, func(f *fault) { f.err = replyError(message) })
+}
+
+// Delay makes the command wait before it is answered, to exercise client
+// deadlines. Stopping the server ends the wait.
+func (s *server) Delay(command string, d time.Duration) {
+	s.setFault(command, func(f *fault) { f.delay = d })
+}
+
+// Drop makes the server close the connection when the command arrives,
+// without answering
+func (s *server) Drop(command string) {
+	s.setFault(command, func(f *fault) { f.drop = true })
+}
+
+// ClearFaults removes every scripted fault
+func (s *server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = make(map[string]fault)
+}
+
+// Calls returns how many times the command has been received. Commands
+// with subcommands are counted by their full name, e.g. "SENTINEL MASTERS".
+func (s *server) Calls(command string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[strings.ToUpper(command)]
+}
+
+// Running returns true if the server is accepting connections
+func (s *server) Running() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.listener != nil
+}
+
+// Stop closes the listener and every open connection, as if the process
+// had died. The server keeps its state and can be started again.
+func (s *server) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return
+	}
+	s.listener.Close()
+	s.listener = nil
+	close(s.stopped)
+	for nc := range s.conns {
+		nc.Close()
+	}
+}
+
+// Start listens again on the server's address after Stop
+func (s *server) Start() error {
+	if s.Running() {
+		return nil
+	}
+	l, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	s.serve(l)
+	return nil
+}
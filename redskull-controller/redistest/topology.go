@@ -0,0 +1,332 @@
+// Package redistest runs fake Redis and Sentinel servers in-process so code
+// which dials sentinels can be tested without real ones. The servers speak
+// RESP on loopback ports and answer the INFO, CONFIG, SLAVEOF, SLOWLOG,
+// LATENCY and SENTINEL commands RedSkull uses the way Redis 3.2 does.
+//
+// A Topology holds the servers and the replication and monitoring between
+// them: a sentinel's SLAVES and SENTINELS replies, a master's replication
+// INFO and the outcome of SENTINEL FAILOVER are all worked out from it.
+// Failures are scripted per server with Stop, Fail, Delay and Drop.
+//
+//	topo := redistest.New()
+//	defer topo.Close()
+//	sentinels := topo.AddSentinels(3)
+//	pod := topo.AddPod("pod1", 2, 1, "secret", sentinels...)
+//	sentinels[0].SetConfigFile(path)
+package redistest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Topology is a set of fake Redis instances and sentinels
+type Topology struct {
+	mu        sync.Mutex // guards the state of every server; held while a command runs
+	nodes     []*Redis
+	sentinels []*Sentinel
+
+	switchAfter time.Duration
+	propagate   time.Duration
+	failovers   map[string]bool // masters with a delayed failover in progress
+}
+
+// Pod is a master and its slaves as created by AddPod. Which node is the
+// master changes with failovers; use Master and Slaves to find out.
+type Pod struct {
+	Name   string
+	Quorum int
+	Auth   string
+	Nodes  []*Redis
+	topo   *Topology
+}
+
+// New returns an empty topology
+func New() *Topology {
+	return &Topology{}
+}
+
+// AddRedis starts a Redis instance with no auth, replicating from nothing
+func (t *Topology) AddRedis() *Redis {
+	r := newRedis()
+	r.listen(t, r.command)
+	t.mu.Lock()
+	t.nodes = append(t.nodes, r)
+	t.mu.Unlock()
+	return r
+}
+
+// AddSentinel starts a sentinel monitoring nothing
+func (t *Topology) AddSentinel() *Sentinel {
+	s := newSentinel()
+	s.listen(t, s.command)
+	t.mu.Lock()
+	t.sentinels = append(t.sentinels, s)
+	t.mu.Unlock()
+	return s
+}
+
+// AddSentinels starts n sentinels
+func (t *Topology) AddSentinels(n int) []*Sentinel {
+	var sentinels []*Sentinel
+	for i := 0; i < n; i++ {
+		sentinels = append(sentinels, t.AddSentinel())
+	}
+	return sentinels
+}
+
+// AddPod starts a master and the given number of slaves, all requiring
+// auth, and has each of the sentinels monitor the master as name
+func (t *Topology) AddPod(name string, quorum, slaves int, auth string, sentinels ...*Sentinel) *Pod {
+	pod := &Pod{Name: name, Quorum: quorum, Auth: auth, topo: t}
+	master := t.AddRedis()
+	master.SetConfig("requirepass", auth)
+	master.SetConfig("masterauth", auth)
+	pod.Nodes = append(pod.Nodes, master)
+	for i := 0; i < slaves; i++ {
+		slave := t.AddRedis()
+		slave.SetConfig("requirepass", auth)
+		slave.SetConfig("masterauth", auth)
+		slave.SlaveOf(master)
+		pod.Nodes = append(pod.Nodes, slave)
+	}
+	for _, s := range sentinels {
+		s.Monitor(name, master, quorum, auth)
+	}
+	return pod
+}
+
+// Redis returns the instance listening on addr, or nil
+func (t *Topology) Redis(addr string) *Redis {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.redisAt(addr)
+}
+
+// Sentinels returns every sentinel in the topology
+func (t *Topology) Sentinels() []*Sentinel {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*Sentinel(nil), t.sentinels...)
+}
+
+// Close stops every server
+func (t *Topology) Close() {
+	t.mu.Lock()
+	nodes := append([]*Redis(nil), t.nodes...)
+	sentinels := append([]*Sentinel(nil), t.sentinels...)
+	t.mu.Unlock()
+	for _, r := range nodes {
+		r.Stop()
+	}
+	for _, s := range sentinels {
+		s.Stop()
+	}
+}
+
+// SetFailoverDelay makes SENTINEL FAILOVER take time, as a real one does.
+// The command returns OK at once; the slave is promoted and the sentinel the
+// command was sent to switches master after switchAfter, and the other
+// sentinels monitoring the master switch propagate later. Another FAILOVER
+// of the same master meanwhile is answered with INPROG. With both zero, the
+// default, the failover is complete when the command returns.
+func (t *Topology) SetFailoverDelay(switchAfter, propagate time.Duration) {
+	t.mu.Lock()
+	t.switchAfter, t.propagate = switchAfter, propagate
+	t.mu.Unlock()
+}
+
+// Master returns the node the pod's sentinels report as its master, or nil
+// if none of them monitor it
+func (p *Pod) Master() *Redis {
+	p.topo.mu.Lock()
+	defer p.topo.mu.Unlock()
+	for _, s := range p.topo.sentinels {
+		if m, ok := s.masters[p.Name]; ok {
+			return p.topo.redisAt(m.addr())
+		}
+	}
+	return nil
+}
+
+// Slaves returns the pod's nodes other than its master
+func (p *Pod) Slaves() (slaves []*Redis) {
+	master := p.Master()
+	for _, node := range p.Nodes {
+		if node != master {
+			slaves = append(slaves, node)
+		}
+	}
+	return slaves
+}
+
+// redisAt returns the instance listening on addr, or nil. The topology must
+// be locked.
+func (t *Topology) redisAt(addr string) *Redis {
+	for _, r := range t.nodes {
+		if r.addr == addr {
+			return r
+		}
+	}
+	return nil
+}
+
+// slavesOf returns the instances configured to replicate from addr, in
+// address order. The topology must be locked.
+func (t *Topology) slavesOf(addr string) (slaves []*Redis) {
+	for _, r := range t.nodes {
+		if r.masterAddr == addr {
+			slaves = append(slaves, r)
+		}
+	}
+	sort.Slice(slaves, func(i, j int) bool { return slaves[i].addr < slaves[j].addr })
+	return slaves
+}
+
+// monitorsOf returns the sentinels monitoring the master called name at
+// addr. The topology must be locked.
+func (t *Topology) monitorsOf(name, addr string) (sentinels []*Sentinel) {
+	for _, s := range t.sentinels {
+		if m, ok := s.masters[name]; ok && m.addr() == addr {
+			sentinels = append(sentinels, s)
+		}
+	}
+	return sentinels
+}
+
+// failover promotes the best slave of the master called name at addr,
+// points the other nodes at it and updates every sentinel monitoring the
+// master, by first. With a failover delay set the promotion happens later.
+// The topology must be locked.
+func (t *Topology) failover(name, addr string, by *Sentinel) replyError {
+	if t.failovers[name] {
+		return errorf("INPROG Failover already in progress")
+	}
+	if t.bestSlave(addr) == nil {
+		return errorf("NOGOODSLAVE No suitable slave to promote")
+	}
+	monitors := t.monitorsOf(name, addr)
+	if t.switchAfter == 0 && t.propagate == 0 {
+		t.switchMaster(name, t.promote(addr), t.nextEpoch(), monitors)
+		return ""
+	}
+	if t.failovers == nil {
+		t.failovers = make(map[string]bool)
+	}
+	t.failovers[name] = true
+	var others []*Sentinel
+	for _, s := range monitors {
+		if s != by {
+			others = append(others, s)
+		}
+	}
+	propagate := t.propagate
+	time.AfterFunc(t.switchAfter, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		promoted := t.promote(addr)
+		if promoted == nil {
+			delete(t.failovers, name)
+			return
+		}
+		epoch := t.nextEpoch()
+		t.switchMaster(name, promoted, epoch, []*Sentinel{by})
+		time.AfterFunc(propagate, func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			delete(t.failovers, name)
+			t.switchMaster(name, promoted, epoch, others)
+		})
+	})
+	return ""
+}
+
+// bestSlave returns the slave of addr a failover would promote: the running
+// one with the lowest non-zero priority, then the highest offset. The
+// topology must be locked.
+func (t *Topology) bestSlave(addr string) *Redis {
+	var candidates []*Redis
+	for _, r := range t.slavesOf(addr) {
+		if r.Running() && r.priority() > 0 {
+			candidates = append(candidates, r)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.priority() != b.priority() {
+			return a.priority() < b.priority()
+		}
+		return a.offset > b.offset
+	})
+	return candidates[0]
+}
+
+// promote makes the best slave of addr a master and points the other nodes
+// at it, returning the promoted node or nil if there was none. The topology
+// must be locked.
+func (t *Topology) promote(addr string) *Redis {
+	promoted := t.bestSlave(addr)
+	if promoted == nil {
+		return nil
+	}
+	promoted.masterAddr = ""
+	for _, r := range t.slavesOf(addr) {
+		r.masterAddr = promoted.addr
+	}
+	if old := t.redisAt(addr); old != nil {
+		old.masterAddr = promoted.addr
+	}
+	return promoted
+}
+
+// nextEpoch returns the epoch following the highest any sentinel has seen.
+// The topology must be locked.
+func (t *Topology) nextEpoch() int64 {
+	var epoch int64
+	for _, s := range t.sentinels {
+		if s.currentEpoch > epoch {
+			epoch = s.currentEpoch
+		}
+	}
+	return epoch + 1
+}
+
+// switchMaster points the given sentinels' master called name at promoted
+// under epoch. The topology must be locked.
+func (t *Topology) switchMaster(name string, promoted *Redis, epoch int64, sentinels []*Sentinel) {
+	for _, s := range sentinels {
+		m, ok := s.masters[name]
+		if !ok {
+			continue
+		}
+		m.host, m.port = promoted.host, promoted.port
+		m.configEpoch = epoch
+		s.currentEpoch = epoch
+	}
+	t.rewriteConfigs()
+}
+
+// rewriteConfigs rewrites every sentinel's config file, as the known-slave
+// and known-sentinel lines of one depend on the others. The topology must be
+// locked.
+func (t *Topology) rewriteConfigs() {
+	for _, s := range t.sentinels {
+		s.rewriteConfig()
+	}
+}
+
+// newRunID returns a random 40 character run id
+func newRunID() string {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("redistest: unable to generate a run id: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
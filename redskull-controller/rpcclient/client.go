@@ -1,21 +1,26 @@
 package rsclient
 
 import (
-	"errors"
-	"log"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
 	"net"
 	"net/rpc"
 	"time"
 
+	"github.com/therealbill/libredis/structures"
 	"github.com/therealbill/redskull/redskull-controller/common"
 )
 
+// Client talks to a RedSkull controller's RPC port. Failed calls return an
+// *Error whose Code is one of the common.ErrCode constants.
 type Client struct {
 	connection *rpc.Client
 }
 
 // NewPodRequest is a struct used for passing in the pod information from the
-// client
+// client. It is only used by the deprecated "RPC" service.
 type NewPodRequest struct {
 	Name   string
 	IP     string
@@ -25,7 +30,7 @@ type NewPodRequest struct {
 }
 
 // AddSlaveToPodRequest is a struct for passing slave+pod information over the
-// wire
+// wire. It is only used by the deprecated "RPC" service.
 type AddSlaveToPodRequest struct {
 	Pod       string
 	SlaveIP   string
@@ -33,124 +38,454 @@ type AddSlaveToPodRequest struct {
 	SlaveAuth string
 }
 
+// ApplyManifestRequest carries a manifest and whether to only report the
+// changes. It is only used by the deprecated "RPC" service.
+type ApplyManifestRequest struct {
+	Manifest common.Manifest
+	DryRun   bool
+}
+
+// LoginMethod authenticates the connection with a token. It is answered by
+// the server's RPC layer, not a service.
+const LoginMethod = "Auth.Login"
+
+// Options configure how a client connects and authenticates
+type Options struct {
+	// Timeout bounds dialing, the TLS handshake and the login
+	Timeout time.Duration
+	// TLS, if set, connects over TLS. Include a client certificate to
+	// authenticate with it.
+	TLS *tls.Config
+	// Token, if set, is presented to the server right after connecting
+	Token string
+}
+
 // NewClient returns a client connection
 func NewClient(dsn string, timeout time.Duration) (*Client, error) {
-	connection, err := net.DialTimeout("tcp", dsn, timeout)
+	return NewClientWithOptions(dsn, Options{Timeout: timeout})
+}
+
+// NewClientWithOptions returns a client connection using TLS and token
+// authentication as configured in opts
+func NewClientWithOptions(dsn string, opts Options) (*Client, error) {
+	dialer := &net.Dialer{Timeout: opts.Timeout}
+	var connection net.Conn
+	var err error
+	if opts.TLS != nil {
+		connection, err = tls.DialWithDialer(dialer, "tcp", dsn, opts.TLS)
+	} else {
+		connection, err = dialer.Dial("tcp", dsn)
+	}
 	if err != nil {
 		return nil, err
 	}
-	return &Client{connection: rpc.NewClient(connection)}, nil
+	c := &Client{connection: rpc.NewClient(connection)}
+	if opts.Token > "" {
+		var identity string
+		if opts.Timeout > 0 {
+			connection.SetDeadline(time.Now().Add(opts.Timeout))
+		}
+		err = c.connection.Call(LoginMethod, opts.Token, &identity)
+		connection.SetDeadline(time.Time{})
+		if err != nil {
+			c.connection.Close()
+			return nil, serverError(err)
+		}
+	}
+	return c, nil
 }
 
-//CheckPodAuth has the server check it's authenticationn capability to the
-//master and all attached slaves for the pod. It returns a map true/false for
-//each IP in the pod. If the master can not be authed against it returns an
-//empty map.
-func (c *Client) CheckPodAuth(podname string) (map[string]bool, error) {
-	authmap := make(map[string]bool)
-	if c == nil {
-		log.Fatal("c is nil! This means you didn't call NewClient to get a working client connection")
+// TLSConfig returns a TLS configuration trusting the CA in caFile, or the
+// system roots if it is empty, and presenting the client certificate in
+// certFile and keyFile if they are set
+func TLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile > "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in '%s'", caFile)
+		}
 	}
-	err := c.connection.Call("RPC.CheckPodAuth", podname, &authmap)
-	if err != nil {
-		log.Print(err)
-		return authmap, err
+	if certFile > "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
 	}
-	return authmap, nil
+	return config, nil
 }
 
-//AddSlaveToPod is used to instruct Red skull to add a slave to the given pod.
-func (c *Client) AddSlaveToPod(podname, slaveip string, slaveport int, slaveauth string) (bool, error) {
-	nsr := AddSlaveToPodRequest{Pod: podname, SlaveIP: slaveip, SlavePort: slaveport, SlaveAuth: slaveauth}
-	var added bool
-	err := c.connection.Call("RPC.AddSlaveToPod", nsr, &added)
+// call invokes the typed service's method and returns the error the server
+// put in the response header, if any
+func (c *Client) call(method string, req Request, resp Response) error {
+	if c == nil {
+		panic("rsclient: nil Client; use NewClient to get a working client connection")
+	}
+	req.setVersion()
+	err := c.connection.Call(ServiceName+"."+method, req, resp)
 	if err != nil {
-		log.Print(err)
-		return false, err
+		return serverError(err)
+	}
+	if e := resp.header().Error; e != nil {
+		return e
 	}
-	return true, nil
+	return nil
 }
 
-// GetSentinelsForPod(podname)  returns the number and list of sentinels for
-// the given podname
-func (c *Client) GetSentinelsForPod(address string) (int, []string, error) {
-	var sc int
-	var sentinels []string
-	err := c.connection.Call("RPC.GetSentinelsForPod", address, &sentinels)
-	if err != nil {
-		log.Print(err)
-	} else {
-		sc = len(sentinels)
+// CheckVersion asks the server which protocol versions it accepts and
+// returns an ErrCodeIncompatible error if this client is not among them
+func (c *Client) CheckVersion() error {
+	var resp VersionResponse
+	if err := c.call("Version", &EmptyRequest{}, &resp); err != nil {
+		return err
+	}
+	if ProtocolVersion < resp.MinVersion || ProtocolVersion > resp.Version {
+		return NewError(common.ErrCodeIncompatible,
+			"Client speaks RPC protocol version %d, the server supports %d to %d; upgrade the older side",
+			ProtocolVersion, resp.MinVersion, resp.Version)
 	}
-	return sc, sentinels, err
+	return nil
 }
 
-// AddSentinel(address) will instuct Redskull to add the sentinel at the given
-// address
-func (c *Client) AddSentinel(address string) (bool, error) {
-	var ok bool
-	err := c.connection.Call("RPC.AddSentinel", address, &ok)
-	if err != nil {
-		log.Print(err)
-	} else {
-		ok = true
-	}
-	return ok, err
+// ListPods returns a summary of every pod
+func (c *Client) ListPods() ([]common.PodSummary, error) {
+	return c.ListPodsWithStatus("")
 }
 
-// AddPod(NewPodRequest) will take the information in the PodRequest and
-// instruct Redskull to add it to it's monitor list.
-func (c *Client) AddPod(name, ip string, port, quorum int, auth string) (common.RedisPod, error) {
-	var pod common.RedisPod
-	pr := NewPodRequest{Name: name, IP: ip, Port: port, Quorum: quorum, Auth: auth}
-	err := c.connection.Call("RPC.AddPod", pr, &pod)
-	if err != nil {
-		log.Print(err)
+// ListPodsWithStatus returns a summary of every pod whose status is one of
+// common.PodStatusOK, PodStatusError or PodStatusMaintenance; an empty
+// status returns every pod
+func (c *Client) ListPodsWithStatus(status string) ([]common.PodSummary, error) {
+	var resp ListPodsResponse
+	err := c.call("ListPods", &ListPodsRequest{Status: status}, &resp)
+	return resp.Pods, err
+}
+
+// GetPodList returns the names of every pod
+func (c *Client) GetPodList() ([]string, error) {
+	pods, err := c.ListPods()
+	names := make([]string, 0, len(pods))
+	for _, pod := range pods {
+		names = append(names, pod.Name)
 	}
-	return pod, err
+	return names, err
+}
 
+// ListPodsInError returns every pod currently in an error state
+func (c *Client) ListPodsInError() ([]common.RedisPod, error) {
+	var resp PodsResponse
+	err := c.call("ListPodsInError", &EmptyRequest{}, &resp)
+	return resp.Pods, err
 }
 
 // GetPod(podname) will return the common.RedisPod type for the given pod, if
 // found.
 func (c *Client) GetPod(podname string) (common.RedisPod, error) {
-	var pod common.RedisPod
-	err := c.connection.Call("RPC.GetPod", podname, &pod)
-	if err != nil {
-		log.Print(err)
-	}
-	return pod, err
+	var resp PodResponse
+	err := c.call("GetPod", &PodRequest{Pod: podname}, &resp)
+	return resp.Pod, err
+}
+
+// AddPod(NewPodRequest) will take the information in the PodRequest and
+// instruct Redskull to add it to it's monitor list.
+func (c *Client) AddPod(name, ip string, port, quorum int, auth string) (common.RedisPod, error) {
+	req := MonitorPodRequest{MonitorRequest: common.MonitorRequest{Podname: name, MasterAddress: ip, MasterPort: port, Quorum: quorum, AuthToken: auth}}
+	var resp PodResponse
+	err := c.call("MonitorPod", &req, &resp)
+	return resp.Pod, err
 }
 
 //RemovePod(podname) removes the prod from Redskull and associated sentinels
 func (c *Client) RemovePod(podname string) error {
-	ok := false
-	err := c.connection.Call("RPC.RemovePod", podname, &ok)
-	if err != nil {
-		log.Printf("ok=%s,Error: %s", ok, err.Error())
-		return err
-	}
-	if !ok {
-		return errors.New("Unable to remove pod")
-	}
-	return nil
+	return c.call("RemovePod", &PodRequest{Pod: podname}, &EmptyResponse{})
+}
+
+// Failover fails the pod over to one of its slaves. Force proceeds even if
+// the pod is in maintenance.
+func (c *Client) Failover(podname string, force bool) error {
+	return c.call("Failover", &FailoverPodRequest{Pod: podname, Force: force}, &EmptyResponse{})
+}
+
+// ResetPod starts a job resetting the pod on its sentinels. Follow it with
+// GetJob.
+func (c *Client) ResetPod(podname string, simultaneous bool) (common.Job, error) {
+	var resp JobResponse
+	err := c.call("ResetPod", &ResetPodRequest{Pod: podname, Simultaneous: simultaneous}, &resp)
+	return resp.Job, err
 }
 
 //BalancePod will attempt to rebalance the pod's sentinels
 func (c *Client) BalancePod(podname string) error {
-	ok := false
-	err := c.connection.Call("RPC.BalancePod", podname, &ok)
-	if !ok {
-		if err != nil {
-			log.Printf("Error: %s", err.Error())
-		}
-		return errors.New("Was unable to initiate balance operation")
+	return c.BalancePodForce(podname, false)
+}
+
+// BalancePodForce rebalances the pod's sentinels, even if the pod is in
+// maintenance when force is set
+func (c *Client) BalancePodForce(podname string, force bool) error {
+	return c.call("BalancePod", &BalancePodRequest{Pod: podname, Force: force}, &EmptyResponse{})
+}
+
+// GetMaster returns the pod's master as its sentinels report it
+func (c *Client) GetMaster(podname string) (structures.MasterAddress, error) {
+	var resp MasterResponse
+	err := c.call("GetMaster", &PodRequest{Pod: podname}, &resp)
+	return resp.Master, err
+}
+
+// GetSlaves returns the pod's slaves as its sentinels report them
+func (c *Client) GetSlaves(podname string) ([]structures.SlaveInfo, error) {
+	var resp SlavesResponse
+	err := c.call("GetSlaves", &PodRequest{Pod: podname}, &resp)
+	return resp.Slaves, err
+}
+
+//AddSlaveToPod is used to instruct Red skull to add a slave to the given pod.
+func (c *Client) AddSlaveToPod(podname, slaveip string, slaveport int, slaveauth string) (bool, error) {
+	req := AddSlaveRequest{Pod: podname, Address: slaveip, Port: slaveport, Auth: slaveauth}
+	err := c.call("AddSlave", &req, &EmptyResponse{})
+	return err == nil, err
+}
+
+// RemoveSlaveFromPod detaches the slave at address, in host:port form, from
+// the pod
+func (c *Client) RemoveSlaveFromPod(podname, address string) error {
+	return c.call("RemoveSlave", &RemoveSlaveRequest{Pod: podname, Slave: address}, &EmptyResponse{})
+}
+
+//CheckPodAuth has the server check it's authenticationn capability to the
+//master and all attached slaves for the pod. It returns a map true/false for
+//each node in the pod.
+func (c *Client) CheckPodAuth(podname string) (map[string]bool, error) {
+	var resp PodAuthResponse
+	err := c.call("CheckPodAuth", &PodRequest{Pod: podname}, &resp)
+	if resp.Nodes == nil {
+		resp.Nodes = make(map[string]bool)
 	}
-	return nil
+	return resp.Nodes, err
+}
+
+// GetSentinelsForPod(podname)  returns the number and list of sentinels for
+// the given podname
+func (c *Client) GetSentinelsForPod(podname string) (int, []string, error) {
+	sentinels, err := c.GetPodSentinels(podname)
+	names := make([]string, 0, len(sentinels))
+	for _, sentinel := range sentinels {
+		names = append(names, sentinel.Name)
+	}
+	return len(names), names, err
+}
+
+// GetPodSentinels returns a summary of each sentinel monitoring the pod
+func (c *Client) GetPodSentinels(podname string) ([]common.SentinelSummary, error) {
+	var resp SentinelsResponse
+	err := c.call("GetPodSentinels", &PodRequest{Pod: podname}, &resp)
+	return resp.Sentinels, err
+}
+
+// ListSentinels returns a summary of every sentinel in the constellation
+func (c *Client) ListSentinels() ([]common.SentinelSummary, error) {
+	var resp SentinelsResponse
+	err := c.call("ListSentinels", &EmptyRequest{}, &resp)
+	return resp.Sentinels, err
+}
+
+// AddSentinel(address) will instuct Redskull to add the sentinel at the given
+// address
+func (c *Client) AddSentinel(address string) (bool, error) {
+	err := c.call("AddSentinel", &AddressRequest{Address: address}, &EmptyResponse{})
+	return err == nil, err
+}
+
+//ValidatePodSentinels validates the sentinels listed for the given pod. The
+// report holds each sentinel's view of the pod; the error is set if any
+// sentinel diverges from the majority or reports a problem.
+func (c *Client) ValidatePodSentinels(podname string) (common.SentinelConsistencyReport, error) {
+	var resp ConsistencyResponse
+	err := c.call("ValidatePodSentinels", &PodRequest{Pod: podname}, &resp)
+	return resp.Report, err
+}
+
+// CheckPodTopology compares what the pod's sentinels and Redis nodes report
+// and returns any anomalies found, such as split brain or replicas following
+// the wrong master.
+func (c *Client) CheckPodTopology(podname string) (common.TopologyReport, error) {
+	var resp TopologyResponse
+	err := c.call("CheckPodTopology", &PodRequest{Pod: podname}, &resp)
+	return resp.Report, err
+}
+
+// CheckTopology returns the topology report of every pod
+func (c *Client) CheckTopology() ([]common.TopologyReport, error) {
+	var resp TopologiesResponse
+	err := c.call("CheckTopology", &EmptyRequest{}, &resp)
+	return resp.Reports, err
+}
+
+// GetPodMaintenance returns the pod's maintenance window. The error has code
+// common.ErrCodeNotFound if the pod is not in maintenance.
+func (c *Client) GetPodMaintenance(podname string) (common.PodMaintenance, error) {
+	var resp MaintenanceResponse
+	err := c.call("GetPodMaintenance", &PodRequest{Pod: podname}, &resp)
+	return resp.Maintenance, err
+}
+
+// SetPodMaintenance places a pod into maintenance. While in maintenance
+// RedSkull does not report the pod's errors, and will not balance or fail it
+// over unless forced.
+func (c *Client) SetPodMaintenance(req common.MaintenanceRequest) (common.PodMaintenance, error) {
+	var resp MaintenanceResponse
+	err := c.call("SetPodMaintenance", &MaintenanceRequest{MaintenanceRequest: req}, &resp)
+	return resp.Maintenance, err
+}
+
+// ClearPodMaintenance takes a pod out of maintenance
+func (c *Client) ClearPodMaintenance(podname string) error {
+	return c.call("ClearPodMaintenance", &PodRequest{Pod: podname}, &EmptyResponse{})
+}
+
+// ListMaintenance returns every pod currently in maintenance
+func (c *Client) ListMaintenance() ([]common.PodMaintenance, error) {
+	var resp MaintenanceListResponse
+	err := c.call("ListMaintenance", &EmptyRequest{}, &resp)
+	return resp.Maintenance, err
+}
+
+// ListNodes returns a summary of every node RedSkull has connected to
+func (c *Client) ListNodes() ([]common.NodeSummary, error) {
+	var resp NodesResponse
+	err := c.call("ListNodes", &EmptyRequest{}, &resp)
+	return resp.Nodes, err
+}
+
+// GetNode returns the named node, in host:port form, with fresh data
+func (c *Client) GetNode(name string) (common.RedisNode, error) {
+	var resp NodeResponse
+	err := c.call("GetNode", &NodeRequest{Node: name}, &resp)
+	return resp.Node, err
+}
+
+// CloneNode starts a job cloning one node to another. Follow it with GetJob.
+func (c *Client) CloneNode(req common.CloneRequest) (common.Job, error) {
+	var resp JobResponse
+	err := c.call("CloneNode", &CloneNodeRequest{CloneRequest: req}, &resp)
+	return resp.Job, err
+}
+
+// GetStats returns the constellation's metrics
+func (c *Client) GetStats() (common.ConstellationStats, error) {
+	var resp StatsResponse
+	err := c.call("GetStats", &EmptyRequest{}, &resp)
+	return resp.Stats, err
+}
+
+// ListJobs returns the jobs started on the controller, newest first
+func (c *Client) ListJobs() ([]common.Job, error) {
+	return c.FindJobs(ListJobsRequest{})
+}
+
+// FindJobs returns the jobs matching the request's type, state and pod,
+// newest first. Empty fields match every job.
+func (c *Client) FindJobs(req ListJobsRequest) ([]common.Job, error) {
+	var resp JobsResponse
+	err := c.call("ListJobs", &req, &resp)
+	return resp.Jobs, err
+}
+
+// GetJob returns the job with the given ID
+func (c *Client) GetJob(id string) (common.Job, error) {
+	var resp JobResponse
+	err := c.call("GetJob", &JobRequest{ID: id}, &resp)
+	return resp.Job, err
+}
+
+// ListEvents returns recent events matching the request, newest first.
+// Type and Pod may be glob patterns.
+func (c *Client) ListEvents(req ListEventsRequest) ([]common.Event, error) {
+	var resp EventsResponse
+	err := c.call("ListEvents", &req, &resp)
+	return resp.Events, err
+}
+
+// PlanRebalance returns the moves a constellation rebalance would make,
+// without making them.
+func (c *Client) PlanRebalance() (common.RebalancePlan, error) {
+	var resp RebalancePlanResponse
+	err := c.call("PlanRebalance", &EmptyRequest{}, &resp)
+	return resp.Plan, err
+}
+
+// ConfirmRebalance executes a constellation rebalance. Pass the Fingerprint
+// of a plan from PlanRebalance; the rebalance only proceeds if the plan is
+// unchanged.
+func (c *Client) ConfirmRebalance(fingerprint string) (common.RebalanceReport, error) {
+	var resp RebalanceReportResponse
+	err := c.call("ConfirmRebalance", &ConfirmRebalanceRequest{Fingerprint: fingerprint}, &resp)
+	return resp.Report, err
+}
+
+// PlanManifest returns the steps needed to bring the constellation in line
+// with the manifest.
+func (c *Client) PlanManifest(m common.Manifest) (common.ManifestPlan, error) {
+	var resp ManifestPlanResponse
+	err := c.call("PlanManifest", &ManifestRequest{Manifest: m}, &resp)
+	return resp.Plan, err
+}
+
+// ApplyManifest applies the manifest to the constellation. With dryRun set
+// nothing is changed and the report lists the planned steps.
+func (c *Client) ApplyManifest(m common.Manifest, dryRun bool) (common.ManifestReport, error) {
+	var resp ManifestReportResponse
+	err := c.call("ApplyManifest", &ManifestRequest{Manifest: m, DryRun: dryRun}, &resp)
+	return resp.Report, err
+}
+
+// ExportConstellation returns a snapshot of the constellation topology. If
+// encrypt is set the server encrypts pod auth tokens with its secret key.
+func (c *Client) ExportConstellation(encrypt bool) (common.ConstellationSnapshot, error) {
+	var resp SnapshotResponse
+	err := c.call("ExportConstellation", &ExportRequest{Encrypt: encrypt}, &resp)
+	return resp.Snapshot, err
+}
+
+// RestoreConstellation has the server re-monitor every pod in the snapshot
+// it does not already know about.
+func (c *Client) RestoreConstellation(snap common.ConstellationSnapshot) (common.RestoreReport, error) {
+	var resp RestoreResponse
+	err := c.call("RestoreConstellation", &RestoreRequest{Snapshot: snap}, &resp)
+	return resp.Report, err
+}
+
+// GetLogLevel returns the server's log level
+func (c *Client) GetLogLevel() (string, error) {
+	var resp LogLevelResponse
+	err := c.call("GetLogLevel", &EmptyRequest{}, &resp)
+	return resp.Level, err
+}
+
+// SetLogLevel changes the server's log level and returns the new level
+func (c *Client) SetLogLevel(level string) (string, error) {
+	var resp LogLevelResponse
+	err := c.call("SetLogLevel", &LogLevelRequest{Level: level}, &resp)
+	return resp.Level, err
+}
+
+// GetPodAuth returns the pod's auth token. It needs the admin role and is
+// audited; every other call masks the token.
+func (c *Client) GetPodAuth(podname string) (string, error) {
+	var resp PodAuthTokenResponse
+	err := c.call("GetPodAuth", &PodRequest{Pod: podname}, &resp)
+	return resp.AuthToken, err
 }
 
-//ValidatePodSentinels validates the sentinels listed for the given pod.
-func (c *Client) ValidatePodSentinels(podname string) (map[string]bool, error) {
-	checks := make(map[string]bool)
-	return checks, nil
+// GetPodAuthVersions returns the versions of the pod's auth token the
+// credential store holds, with the tokens masked
+func (c *Client) GetPodAuthVersions(podname string) ([]common.CredentialVersion, error) {
+	var resp PodAuthVersionsResponse
+	err := c.call("GetPodAuthVersions", &PodRequest{Pod: podname}, &resp)
+	return resp.Versions, err
 }
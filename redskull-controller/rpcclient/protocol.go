@@ -0,0 +1,440 @@
+package rsclient
+
+import (
+	"context"
+	"fmt"
+	"net/rpc"
+	"strings"
+
+	"github.com/therealbill/libredis/structures"
+	"github.com/therealbill/redskull/redskull-controller/common"
+)
+
+// ServiceName is the name the typed RPC service is registered under. The
+// untyped "RPC" service is kept for older clients.
+const ServiceName = "RedSkull"
+
+// ProtocolVersion is the version of the RPC protocol this package speaks.
+// Servers reject requests from clients older than their MinProtocolVersion
+// with an ErrCodeIncompatible error.
+const ProtocolVersion = 1
+
+// MinProtocolVersion is the oldest client protocol version a server built
+// from this package accepts
+const MinProtocolVersion = 1
+
+// Error is returned by calls the server could not complete. Code is one of
+// the common.ErrCode constants.
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// NewError returns an Error with a formatted message
+func NewError(code, format string, v ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, v...)}
+}
+
+// ErrorCode returns the code of err if it is an *Error, otherwise ""
+func ErrorCode(err error) string {
+	if e, ok := err.(*Error); ok {
+		return e.Code
+	}
+	return ""
+}
+
+// serverError converts the errors the server's RPC layer sends when it
+// refuses a call into an *Error
+func serverError(err error) error {
+	se, ok := err.(rpc.ServerError)
+	if !ok {
+		return err
+	}
+	for _, code := range []string{common.ErrCodeUnauthorized, common.ErrCodeForbidden} {
+		if strings.HasPrefix(string(se), code+": ") {
+			return &Error{Code: code, Message: strings.TrimPrefix(string(se), code+": ")}
+		}
+	}
+	return err
+}
+
+// RequestHeader is embedded in every request. On the server it carries the
+// call's context, which is not sent.
+type RequestHeader struct {
+	Version int
+	ctx     context.Context
+}
+
+// SetContext is called by the server with the call's context, which ends
+// when the client hangs up
+func (h *RequestHeader) SetContext(ctx context.Context) {
+	h.ctx = ctx
+}
+
+// Context returns the call's context, or context.Background if the request
+// was not received by a server
+func (h *RequestHeader) Context() context.Context {
+	if h.ctx == nil {
+		return context.Background()
+	}
+	return h.ctx
+}
+
+func (h *RequestHeader) setVersion() {
+	h.Version = ProtocolVersion
+}
+
+// ResponseHeader is embedded in every response. Errors are returned in the
+// header rather than as the call's error so the code survives the trip.
+type ResponseHeader struct {
+	Version int
+	Error   *Error
+}
+
+func (h *ResponseHeader) header() *ResponseHeader {
+	return h
+}
+
+// Failure returns the error the server reported, or nil
+func (h *ResponseHeader) Failure() *Error {
+	return h.Error
+}
+
+// Failed returns the code and message of the error the server reported, so
+// the JSON-RPC endpoint can answer with it
+func (h *ResponseHeader) Failed() (code, message string, failed bool) {
+	if h.Error == nil {
+		return "", "", false
+	}
+	return h.Error.Code, h.Error.Message, true
+}
+
+// Request is any request; the client sets the version before sending it
+type Request interface {
+	setVersion()
+}
+
+// Response is any response
+type Response interface {
+	header() *ResponseHeader
+}
+
+// EmptyRequest is used by calls which take no arguments
+type EmptyRequest struct {
+	RequestHeader
+}
+
+// EmptyResponse is returned by calls which only succeed or fail
+type EmptyResponse struct {
+	ResponseHeader
+}
+
+// VersionResponse reports the protocol versions a server supports
+type VersionResponse struct {
+	ResponseHeader
+	MinVersion int
+}
+
+// PodRequest names a pod
+type PodRequest struct {
+	RequestHeader
+	Pod string
+}
+
+// ListPodsRequest filters ListPods. Status is ok, error or maintenance.
+type ListPodsRequest struct {
+	RequestHeader
+	Status string
+}
+
+// ListPodsResponse holds pod summaries sorted by name
+type ListPodsResponse struct {
+	ResponseHeader
+	Pods []common.PodSummary
+}
+
+// PodResponse holds a pod
+type PodResponse struct {
+	ResponseHeader
+	Pod common.RedisPod
+}
+
+// PodsResponse holds pods
+type PodsResponse struct {
+	ResponseHeader
+	Pods []common.RedisPod
+}
+
+// MonitorPodRequest asks for a pod to be monitored
+type MonitorPodRequest struct {
+	RequestHeader
+	common.MonitorRequest
+}
+
+// FailoverPodRequest asks for a pod to be failed over
+type FailoverPodRequest struct {
+	RequestHeader
+	Pod   string
+	Force bool
+}
+
+// ResetPodRequest asks for a pod to be reset on its sentinels
+type ResetPodRequest struct {
+	RequestHeader
+	Pod          string
+	Simultaneous bool
+}
+
+// BalancePodRequest asks for a pod's sentinels to be balanced
+type BalancePodRequest struct {
+	RequestHeader
+	Pod   string
+	Force bool
+}
+
+// JobResponse holds a job, as started or as it is now
+type JobResponse struct {
+	ResponseHeader
+	Job common.Job
+}
+
+// MasterResponse holds a pod's master as its sentinels report it
+type MasterResponse struct {
+	ResponseHeader
+	Master structures.MasterAddress
+}
+
+// SlavesResponse holds a pod's slaves as its sentinels report them
+type SlavesResponse struct {
+	ResponseHeader
+	Slaves []structures.SlaveInfo
+}
+
+// AddSlaveRequest asks for a Redis instance to become a slave of the pod's
+// master
+type AddSlaveRequest struct {
+	RequestHeader
+	Pod     string
+	Address string
+	Port    int
+	Auth    string
+}
+
+// RemoveSlaveRequest identifies a slave, in host:port form, to detach from a
+// pod
+type RemoveSlaveRequest struct {
+	RequestHeader
+	Pod   string
+	Slave string
+}
+
+// PodAuthResponse holds whether each node of a pod accepts the pod's auth
+type PodAuthResponse struct {
+	ResponseHeader
+	Nodes map[string]bool
+}
+
+// SentinelsResponse holds sentinel summaries
+type SentinelsResponse struct {
+	ResponseHeader
+	Sentinels []common.SentinelSummary
+}
+
+// AddressRequest carries a host:port address
+type AddressRequest struct {
+	RequestHeader
+	Address string
+}
+
+// ConsistencyResponse holds each sentinel's view of a pod
+type ConsistencyResponse struct {
+	ResponseHeader
+	Report common.SentinelConsistencyReport
+}
+
+// TopologyResponse holds a pod's topology report
+type TopologyResponse struct {
+	ResponseHeader
+	Report common.TopologyReport
+}
+
+// TopologiesResponse holds the topology report of every pod
+type TopologiesResponse struct {
+	ResponseHeader
+	Reports []common.TopologyReport
+}
+
+// MaintenanceRequest places a pod into maintenance
+type MaintenanceRequest struct {
+	RequestHeader
+	common.MaintenanceRequest
+}
+
+// MaintenanceResponse holds a pod's maintenance window
+type MaintenanceResponse struct {
+	ResponseHeader
+	Maintenance common.PodMaintenance
+}
+
+// MaintenanceListResponse holds every pod in maintenance
+type MaintenanceListResponse struct {
+	ResponseHeader
+	Maintenance []common.PodMaintenance
+}
+
+// NodeRequest names a node in host:port form
+type NodeRequest struct {
+	RequestHeader
+	Node string
+}
+
+// NodeResponse holds a node
+type NodeResponse struct {
+	ResponseHeader
+	Node common.RedisNode
+}
+
+// NodesResponse holds node summaries sorted by name
+type NodesResponse struct {
+	ResponseHeader
+	Nodes []common.NodeSummary
+}
+
+// CloneNodeRequest asks for one node to be cloned to another
+type CloneNodeRequest struct {
+	RequestHeader
+	common.CloneRequest
+}
+
+// StatsResponse holds the constellation's metrics
+type StatsResponse struct {
+	ResponseHeader
+	Stats common.ConstellationStats
+}
+
+// ListJobsRequest filters ListJobs
+type ListJobsRequest struct {
+	RequestHeader
+	Type  string
+	State string
+	Pod   string
+}
+
+// JobsResponse holds jobs, newest first
+type JobsResponse struct {
+	ResponseHeader
+	Jobs []common.Job
+}
+
+// JobRequest names a job
+type JobRequest struct {
+	RequestHeader
+	ID string
+}
+
+// ListEventsRequest filters ListEvents. Type and Pod are glob patterns.
+type ListEventsRequest struct {
+	RequestHeader
+	Type        string
+	Pod         string
+	MinSeverity string
+	Limit       int
+}
+
+// EventsResponse holds events, newest first
+type EventsResponse struct {
+	ResponseHeader
+	Events []common.Event
+}
+
+// RebalancePlanResponse holds a rebalance plan
+type RebalancePlanResponse struct {
+	ResponseHeader
+	Plan common.RebalancePlan
+}
+
+// ConfirmRebalanceRequest executes a rebalance. Fingerprint is required and
+// must match the current plan.
+type ConfirmRebalanceRequest struct {
+	RequestHeader
+	Fingerprint string
+}
+
+// RebalanceReportResponse holds the result of a rebalance
+type RebalanceReportResponse struct {
+	ResponseHeader
+	Report common.RebalanceReport
+}
+
+// ManifestRequest carries a manifest and whether to only report changes
+type ManifestRequest struct {
+	RequestHeader
+	Manifest common.Manifest
+	DryRun   bool
+}
+
+// ManifestPlanResponse holds the steps to apply a manifest
+type ManifestPlanResponse struct {
+	ResponseHeader
+	Plan common.ManifestPlan
+}
+
+// ManifestReportResponse holds the result of applying a manifest
+type ManifestReportResponse struct {
+	ResponseHeader
+	Report common.ManifestReport
+}
+
+// ExportRequest asks for a snapshot, with auth tokens encrypted if Encrypt
+// is set
+type ExportRequest struct {
+	RequestHeader
+	Encrypt bool
+}
+
+// SnapshotResponse holds a constellation snapshot
+type SnapshotResponse struct {
+	ResponseHeader
+	Snapshot common.ConstellationSnapshot
+}
+
+// RestoreRequest carries a snapshot to restore
+type RestoreRequest struct {
+	RequestHeader
+	Snapshot common.ConstellationSnapshot
+}
+
+// RestoreResponse holds the result of a restore
+type RestoreResponse struct {
+	ResponseHeader
+	Report common.RestoreReport
+}
+
+// LogLevelRequest sets the server's log level
+type LogLevelRequest struct {
+	RequestHeader
+	Level string
+}
+
+// LogLevelResponse holds the server's log level
+type LogLevelResponse struct {
+	ResponseHeader
+	Level string
+}
+
+// PodAuthTokenResponse holds a pod's auth token, unmasked
+type PodAuthTokenResponse struct {
+	ResponseHeader
+	AuthToken string
+}
+
+// PodAuthVersionsResponse holds the versions of a pod's auth token with the
+// tokens masked
+type PodAuthVersionsResponse struct {
+	ResponseHeader
+	Versions []common.CredentialVersion
+}
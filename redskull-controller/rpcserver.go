@@ -1,21 +1,21 @@
 package main
 
 import (
+	"context"
 	"encoding/gob"
 	"errors"
 	"fmt"
-	"log"
-	"net"
 	"net/rpc"
-	"strings"
 	"sync"
 	"time"
 
-	"github.com/therealbill/libredis/client"
 	"github.com/therealbill/redskull/redskull-controller/actions"
 	"github.com/therealbill/redskull/redskull-controller/common"
 	"github.com/therealbill/redskull/redskull-controller/handlers"
 	"github.com/therealbill/redskull/redskull-controller/rpcclient"
+	"github.com/therealbill/redskull/redskull-shared/auth"
+	"github.com/therealbill/redskull/redskull-shared/jsonrpc"
+	"github.com/therealbill/redskull/redskull-shared/logging"
 )
 
 type Item struct {
@@ -23,6 +23,12 @@ type Item struct {
 	Item interface{}
 }
 
+// RPC is the original, untyped RPC service. It is deprecated in favour of
+// Service and only kept so older clients keep working; new calls are added
+// to Service only. Like Service, its calls which change the constellation
+// hold its lock and the rest work on a snapshot. Its arguments carry no
+// context, so its calls are only bounded by common.CallTimeout and run on
+// when the client hangs up.
 type RPC struct {
 	constellation *actions.Constellation
 	mu            *sync.RWMutex
@@ -34,58 +40,61 @@ func badContextError(err error) {
 	}
 }
 
+// readCall returns a snapshot of the constellation for an RPC call which only
+// reads it, and a context for the call derived from parent and bounded by
+// common.CallTimeout
+func readCall(parent context.Context, con *actions.Constellation) (*actions.Constellation, context.Context, context.CancelFunc) {
+	ctx, cancel := common.WithCallTimeout(parent)
+	return con.Snapshot(), ctx, cancel
+}
+
+// writeCall takes the constellation's lock for an RPC call which changes it
+// and returns it with a context derived from parent and bounded by
+// common.CallTimeout from when the lock is held. done cancels the context and
+// releases the lock.
+func writeCall(parent context.Context, con *actions.Constellation) (*actions.Constellation, context.Context, func()) {
+	con.Acquire()
+	ctx, cancel := common.WithCallTimeout(parent)
+	return con, ctx, func() {
+		cancel()
+		con.Release()
+	}
+}
+
 // AddSlaveToPod is used for adding a new slave to an existing pod.
 // TODO: technically the actual implementation should be moved into the actions
 // package and the UI's handlers package can then also call it. As it is, it is
 // also implemented there.
 func (r *RPC) AddSlaveToPod(nsr rsclient.AddSlaveToPodRequest, resp *bool) error {
-	pod, err := r.constellation.GetPod(nsr.Pod)
-	if err != nil {
-		return errors.New("Pod not found")
-	}
-	name := fmt.Sprintf("%s:%d", nsr.SlaveIP, nsr.SlavePort)
-	new_slave, err := client.DialWithConfig(&client.DialConfig{Address: name, Password: nsr.SlaveAuth})
-	defer new_slave.ClosePool()
-	if err != nil {
-		log.Print("ERR: Dialing slave -", err)
-		return errors.New("Server was unable to connect to slave")
-	}
-	err = new_slave.SlaveOf(pod.Info.IP, fmt.Sprintf("%d", pod.Info.Port))
-	if err != nil {
-		log.Printf("Err: %v", err)
-		if strings.Contains(err.Error(), "Already connected to specified master") {
-			return errors.New("Already connected to specified master")
-		}
-	}
-
-	new_slave.ConfigSet("masterauth", pod.AuthToken)
-	new_slave.ConfigSet("requirepass", pod.AuthToken)
-	pod.Master.LastUpdateValid = false
-	r.constellation.PodMap[pod.Name] = pod
-	*resp = true
+	con, ctx, done := writeCall(context.Background(), r.constellation)
+	defer done()
+	err := con.AddSlaveToPod(ctx, nsr.Pod, nsr.SlaveIP, nsr.SlavePort, nsr.SlaveAuth)
+	*resp = err == nil
 	return err
 }
 
 func (r *RPC) CheckPodAuth(podname string, resp *map[string]bool) error {
-	pod, err := r.constellation.GetPod(podname)
+	con, ctx, cancel := readCall(context.Background(), r.constellation)
+	defer cancel()
+	pod, err := con.GetPod(ctx, podname)
 	if err != nil || pod == nil {
-		log.Print("No pod. Error: ", err)
+		logging.Warnf("No pod. Error: %s", err)
 		return err
 	}
 	psresults := make(map[string]bool)
 	if pod.Master == nil {
-		mnode, err := common.LoadNodeFromHostPort(pod.Master.Address, pod.Master.Port, pod.AuthToken)
+		mnode, err := common.LoadNodeFromHostPort(ctx, pod.Master.Address, pod.Master.Port, pod.AuthToken)
 		if err != nil {
-			log.Print("Connection error: ", err)
+			logging.Errorf("Connection error: %s", err)
 			return errors.New("Unable to connect to master nod at all. Check server logs for why")
 		}
 		pod.Master = mnode
 	}
-	mres := pod.Master.Ping()
+	mres := pod.Master.Ping(ctx)
 	psresults[pod.Master.Name] = mres
 	for _, slave := range pod.Master.Slaves {
-		log.Printf("Checking ping/auth for slave %s", slave.Name)
-		sres := slave.Ping()
+		logging.Node(slave.Name).Debugf("Checking ping/auth for slave %s", slave.Name)
+		sres := slave.Ping(ctx)
 		psresults[slave.Name] = sres
 	}
 	*resp = psresults
@@ -93,7 +102,9 @@ func (r *RPC) CheckPodAuth(podname string, resp *map[string]bool) error {
 }
 
 func (r *RPC) GetSentinelsForPod(podname string, resp *[]string) error {
-	sentinels := r.constellation.GetSentinelsForPod(podname)
+	con, ctx, cancel := readCall(context.Background(), r.constellation)
+	defer cancel()
+	sentinels := con.GetSentinelsForPod(ctx, podname)
 	var snames []string
 	for _, s := range sentinels {
 		snames = append(snames, s.Name)
@@ -103,18 +114,20 @@ func (r *RPC) GetSentinelsForPod(podname string, resp *[]string) error {
 }
 
 func (r *RPC) AddPod(pr rsclient.NewPodRequest, resp *common.RedisPod) (err error) {
+	con, ctx, done := writeCall(context.Background(), r.constellation)
+	defer done()
 	gob.Register(common.RedisPod{})
-	ok, err := r.constellation.MonitorPod(pr.Name, pr.IP, pr.Port, pr.Quorum, pr.Auth)
+	ok, err := con.MonitorPod(ctx, pr.Name, pr.IP, pr.Port, pr.Quorum, pr.Auth)
 	if err != nil {
-		log.Printf("MonitorPod call ('%+v') Failed. Error: %s", pr, err.Error())
+		logging.Pod(pr.Name).Errorf("MonitorPod call for '%s' (%s:%d) Failed. Error: %s", pr.Name, pr.IP, pr.Port, err.Error())
 		return err
 	}
 	if !ok {
-		log.Printf("MonitorPod call ('%+v') Failed. No Error", pr)
+		logging.Pod(pr.Name).Errorf("MonitorPod call for '%s' (%s:%d) Failed. No Error", pr.Name, pr.IP, pr.Port)
 		err = errors.New("MonitorPod call returned false, no error")
 	}
-	time.Sleep(time.Second * 2)
-	pod, err := r.constellation.GetPod(pr.Name)
+	common.Sleep(ctx, time.Second*2)
+	pod, err := con.GetPod(ctx, pr.Name)
 	if pod == nil || pod.Name == "" {
 		err = errors.New("New Pod Not found")
 		return err
@@ -124,8 +137,10 @@ func (r *RPC) AddPod(pr rsclient.NewPodRequest, resp *common.RedisPod) (err erro
 }
 
 func (r *RPC) GetPod(podname string, resp *common.RedisPod) (err error) {
+	con, ctx, cancel := readCall(context.Background(), r.constellation)
+	defer cancel()
 	gob.Register(common.RedisPod{})
-	pod, err := r.constellation.GetPod(podname)
+	pod, err := con.GetPod(ctx, podname)
 	if pod == nil || pod.Name == "" {
 		err = errors.New("Pod Not found")
 		return err
@@ -135,13 +150,17 @@ func (r *RPC) GetPod(podname string, resp *common.RedisPod) (err error) {
 }
 
 func (r *RPC) RemovePod(podname string, resp *bool) (err error) {
-	ok, err := r.constellation.RemovePod(podname)
+	con, ctx, done := writeCall(context.Background(), r.constellation)
+	defer done()
+	ok, err := con.RemovePod(ctx, podname)
 	*resp = ok
 	return err
 }
 
 func (r *RPC) AddSentinel(address string, resp *bool) (err error) {
-	err = r.constellation.AddSentinelByAddress(address)
+	con, ctx, done := writeCall(context.Background(), r.constellation)
+	defer done()
+	err = con.AddSentinelByAddress(ctx, address)
 	if err == nil {
 		*resp = true
 	}
@@ -149,43 +168,143 @@ func (r *RPC) AddSentinel(address string, resp *bool) (err error) {
 }
 
 func (r *RPC) BalancePod(podname string, resp *bool) (err error) {
-	pod, err := r.constellation.GetPod(podname)
+	con, ctx, done := writeCall(context.Background(), r.constellation)
+	defer done()
+	pod, err := con.GetPod(ctx, podname)
 	if pod == nil || pod.Name == "" {
 		err = errors.New("Pod Not found")
 		*resp = false
 	}
-	r.constellation.BalancePod(pod)
-	*resp = true
+	err = con.BalancePod(ctx, pod, false)
+	*resp = err == nil
 	return err
 }
 
-func (r *RPC) ValidatePodSentinels(podname string, resp *map[string]bool) error {
-	pod, err := r.constellation.GetPod(podname)
-	res := make(map[string]bool)
+// PlanRebalance returns the moves a constellation rebalance would make
+func (r *RPC) PlanRebalance(unused bool, resp *common.RebalancePlan) (err error) {
+	con, ctx, cancel := readCall(context.Background(), r.constellation)
+	defer cancel()
+	*resp, err = con.PlanRebalance(ctx)
+	return err
+}
+
+// ConfirmRebalance executes a constellation rebalance. The fingerprint is
+// required and must match the freshly computed plan.
+func (r *RPC) ConfirmRebalance(fingerprint string, resp *common.RebalanceReport) error {
+	con, ctx, done := writeCall(context.Background(), r.constellation)
+	defer done()
+	_, report, err := con.ConfirmRebalance(ctx, fingerprint)
+	*resp = report
+	return err
+}
+
+// CheckPodTopology returns the topology anomalies found for the pod
+func (r *RPC) CheckPodTopology(podname string, resp *common.TopologyReport) error {
+	con, ctx, cancel := readCall(context.Background(), r.constellation)
+	defer cancel()
+	report, err := con.CheckPodTopology(ctx, podname)
+	*resp = report
+	return err
+}
+
+// ValidatePodSentinels returns each sentinel's view of the pod, flagging
+// sentinels which diverge from the majority or are in TILT mode.
+func (r *RPC) ValidatePodSentinels(podname string, resp *common.SentinelConsistencyReport) error {
+	con, ctx, cancel := readCall(context.Background(), r.constellation)
+	defer cancel()
+	pod, err := con.GetPod(ctx, podname)
 	if pod == nil || pod.Name == "" {
-		err = errors.New("Pod Not found")
-		*resp = res
+		return errors.New("Pod Not found")
+	}
+	report, err := con.ValidatePodSentinels(ctx, podname)
+	*resp = report
+	return err
+}
+
+// PlanManifest diffs the manifest against the constellation without making
+// any changes.
+func (r *RPC) PlanManifest(m common.Manifest, resp *common.ManifestPlan) error {
+	con, ctx, cancel := readCall(context.Background(), r.constellation)
+	defer cancel()
+	plan, err := con.PlanManifest(ctx, m)
+	*resp = plan
+	return err
+}
+
+// ApplyManifest applies the manifest, or reports what would be done if
+// DryRun is set.
+func (r *RPC) ApplyManifest(req rsclient.ApplyManifestRequest, resp *common.ManifestReport) error {
+	con, ctx, done := writeCall(context.Background(), r.constellation)
+	defer done()
+	report, err := con.ApplyManifest(ctx, req.Manifest, req.DryRun)
+	*resp = report
+	return err
+}
+
+// ExportConstellation returns a snapshot of the constellation topology,
+// optionally with auth tokens encrypted.
+func (r *RPC) ExportConstellation(encrypt bool, resp *common.ConstellationSnapshot) error {
+	con, ctx, cancel := readCall(context.Background(), r.constellation)
+	defer cancel()
+	snap, err := con.ExportSnapshot(ctx, encrypt)
+	*resp = snap
+	return err
+}
+
+// RestoreConstellation re-monitors the pods in the given snapshot.
+func (r *RPC) RestoreConstellation(snap common.ConstellationSnapshot, resp *common.RestoreReport) error {
+	con, ctx, done := writeCall(context.Background(), r.constellation)
+	defer done()
+	report, err := con.RestoreSnapshot(ctx, snap)
+	*resp = report
+	return err
+}
+
+// SetPodMaintenance places a pod into maintenance
+func (r *RPC) SetPodMaintenance(req common.MaintenanceRequest, resp *common.PodMaintenance) error {
+	con, ctx, done := writeCall(context.Background(), r.constellation)
+	defer done()
+	if req.Reason == "" {
+		return errors.New("A reason is required")
+	}
+	expires, err := req.ExpiresAt()
+	if err != nil {
 		return err
 	}
-	results, err := r.constellation.ValidatePodSentinels(podname)
-	*resp = results
+	m, err := con.SetPodMaintenance(ctx, req.Podname, req.Reason, req.Owner, expires, req.Consul)
+	*resp = m
 	return err
+}
 
+// ClearPodMaintenance takes a pod out of maintenance
+func (r *RPC) ClearPodMaintenance(podname string, resp *bool) error {
+	con, ctx, done := writeCall(context.Background(), r.constellation)
+	defer done()
+	err := con.ClearPodMaintenance(ctx, podname)
+	*resp = err == nil
+	return err
+}
+
+// ListMaintenance returns every pod currently in maintenance
+func (r *RPC) ListMaintenance(unused bool, resp *[]common.PodMaintenance) error {
+	*resp = r.constellation.ListMaintenance()
+	return nil
 }
 
 func NewRPC() *RPC {
-	context, err := handlers.NewPageContext()
+	pc, err := handlers.NewPageContext(context.Background())
 	badContextError(err)
 	return &RPC{
-		constellation: context.Constellation,
+		constellation: pc.Constellation,
 	}
 }
 
 func (r *RPC) GetPodList(verbose bool, resp *[]string) (err error) {
+	con := r.constellation.Snapshot()
 	var podlist []string
-	for k, _ := range r.constellation.PodMap {
+	for k, _ := range con.PodMap {
 		if verbose {
-			log.Printf("found pod %s", k)
+			logging.Debugf("found pod %s", k)
 		}
 		podlist = append(podlist, k)
 	}
@@ -193,12 +312,106 @@ func (r *RPC) GetPodList(verbose bool, resp *[]string) (err error) {
 	return nil
 }
 
+// rpcPolicy is the role needed for each RPC method, matching the role the
+// HTTP API requires for the same operation. Methods not listed need admin.
+var rpcPolicy = auth.RPCPolicy{
+	"RedSkull.Version":              auth.Viewer,
+	"RedSkull.ListPods":             auth.Viewer,
+	"RedSkull.ListPodsInError":      auth.Viewer,
+	"RedSkull.GetPod":               auth.Viewer,
+	"RedSkull.MonitorPod":           auth.Operator,
+	"RedSkull.RemovePod":            auth.Operator,
+	"RedSkull.Failover":             auth.Operator,
+	"RedSkull.ResetPod":             auth.Operator,
+	"RedSkull.BalancePod":           auth.Operator,
+	"RedSkull.GetMaster":            auth.Viewer,
+	"RedSkull.GetSlaves":            auth.Viewer,
+	"RedSkull.AddSlave":             auth.Operator,
+	"RedSkull.RemoveSlave":          auth.Operator,
+	"RedSkull.CheckPodAuth":         auth.Viewer,
+	"RedSkull.GetPodSentinels":      auth.Viewer,
+	"RedSkull.ValidatePodSentinels": auth.Viewer,
+	"RedSkull.CheckPodTopology":     auth.Viewer,
+	"RedSkull.CheckTopology":        auth.Viewer,
+	"RedSkull.GetPodMaintenance":    auth.Viewer,
+	"RedSkull.SetPodMaintenance":    auth.Operator,
+	"RedSkull.ClearPodMaintenance":  auth.Operator,
+	"RedSkull.ListMaintenance":      auth.Viewer,
+	"RedSkull.ListNodes":            auth.Viewer,
+	"RedSkull.GetNode":              auth.Viewer,
+	"RedSkull.CloneNode":            auth.Operator,
+	"RedSkull.GetStats":             auth.Viewer,
+	"RedSkull.ListSentinels":        auth.Viewer,
+	"RedSkull.ListJobs":             auth.Viewer,
+	"RedSkull.GetJob":               auth.Viewer,
+	"RedSkull.ListEvents":           auth.Viewer,
+	"RedSkull.PlanRebalance":        auth.Viewer,
+
+	"RPC.GetPodList":           auth.Viewer,
+	"RPC.GetPod":               auth.Viewer,
+	"RPC.AddPod":               auth.Operator,
+	"RPC.RemovePod":            auth.Operator,
+	"RPC.BalancePod":           auth.Operator,
+	"RPC.AddSlaveToPod":        auth.Operator,
+	"RPC.CheckPodAuth":         auth.Viewer,
+	"RPC.GetSentinelsForPod":   auth.Viewer,
+	"RPC.ValidatePodSentinels": auth.Viewer,
+	"RPC.CheckPodTopology":     auth.Viewer,
+	"RPC.PlanRebalance":        auth.Viewer,
+	"RPC.SetPodMaintenance":    auth.Operator,
+	"RPC.ClearPodMaintenance":  auth.Operator,
+	"RPC.ListMaintenance":      auth.Viewer,
+}
+
+// newRPCServer configures TLS and authentication for the RPC port
+func newRPCServer() (*auth.RPCServer, error) {
+	server := &auth.RPCServer{Server: rpc.NewServer(), Policy: rpcPolicy}
+	if config.RPCTLSCert > "" {
+		tlsConfig, err := auth.ServerTLSConfig(config.RPCTLSCert, config.RPCTLSKey, config.RPCTLSClientCA, config.RPCRequireClientCert)
+		if err != nil {
+			return nil, err
+		}
+		server.TLS = tlsConfig
+	}
+	if config.RPCTokenFile > "" {
+		tokens, err := auth.NewTokenAuthenticator(config.RPCTokenFile)
+		if err != nil {
+			return nil, err
+		}
+		server.Tokens = tokens
+	}
+	roles, err := auth.ParseRoles(config.RPCCertRoles)
+	if err != nil {
+		return nil, err
+	}
+	server.CertRoles = roles
+	if config.RPCCertDefaultRole > "" {
+		server.CertDefaultRole, err = auth.ParseRole(config.RPCCertDefaultRole)
+		if err != nil {
+			return nil, err
+		}
+	}
+	server.Server.Register(NewRPC())
+	server.Server.RegisterName(rsclient.ServiceName, NewService())
+	return server, nil
+}
+
 func ServeRPC() {
-	rpc.Register(NewRPC())
+	server, err := newRPCServer()
+	if err != nil {
+		logging.Fatalf("Unable to configure RPC: %s", err)
+	}
+	if config.JSONRPCPort > 0 {
+		go func() {
+			err := jsonrpc.ListenAndServe(fmt.Sprintf("%s:%d", config.BindAddress, config.JSONRPCPort), server)
+			if err != nil {
+				logging.Fatalf("JSON-RPC listen error:%s", err)
+			}
+		}()
+	}
 	rpc_on := fmt.Sprintf("%s:%d", config.BindAddress, config.RPCPort)
-	l, e := net.Listen("tcp", rpc_on)
-	if e != nil {
-		log.Fatal("listen error:", e)
+	err = server.ListenAndServe(rpc_on)
+	if err != nil {
+		logging.Fatalf("listen error:%s", err)
 	}
-	rpc.Accept(l)
 }
@@ -0,0 +1,752 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/therealbill/redskull/redskull-controller/actions"
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-controller/events"
+	"github.com/therealbill/redskull/redskull-controller/handlers"
+	"github.com/therealbill/redskull/redskull-controller/rpcclient"
+	"github.com/therealbill/redskull/redskull-shared/jsonrpc"
+	"github.com/therealbill/redskull/redskull-shared/logging"
+)
+
+// Service is the typed RPC service, registered as rsclient.ServiceName.
+// Every method takes a request embedding rsclient.RequestHeader and fills a
+// response embedding rsclient.ResponseHeader. Failures are reported in the
+// response header with an error code; the call itself only fails if the
+// request could not be delivered. As with HTTP requests, calls which change
+// the constellation hold its lock while they run and calls which only read
+// it work on a snapshot.
+type Service struct {
+	constellation *actions.Constellation
+}
+
+// Service's responses report their errors to JSON-RPC callers
+var _ jsonrpc.Failure = (*rsclient.ResponseHeader)(nil)
+
+// NewService returns the typed RPC service for the running constellation
+func NewService() *Service {
+	pc, err := handlers.NewPageContext(context.Background())
+	badContextError(err)
+	return &Service{constellation: pc.Constellation}
+}
+
+// begin checks the request's protocol version and prepares the response.
+// It returns false, with the response's error set, if the call must not
+// proceed.
+func (s *Service) begin(req rsclient.RequestHeader, resp *rsclient.ResponseHeader) bool {
+	resp.Version = rsclient.ProtocolVersion
+	if req.Version < rsclient.MinProtocolVersion || req.Version > rsclient.ProtocolVersion {
+		resp.Error = rsclient.NewError(common.ErrCodeIncompatible,
+			"Client speaks RPC protocol version %d, this server supports %d to %d; upgrade the older side",
+			req.Version, rsclient.MinProtocolVersion, rsclient.ProtocolVersion)
+		return false
+	}
+	return true
+}
+
+// pod returns the named pod or a pod_not_found error
+func (s *Service) pod(ctx context.Context, con *actions.Constellation, podname string) (*common.RedisPod, *rsclient.Error) {
+	pod, _ := con.GetPod(ctx, podname)
+	if pod == nil || pod.Name == "" {
+		return nil, rsclient.NewError(common.ErrCodePodNotFound, "Pod '%s' not found", podname)
+	}
+	return pod, nil
+}
+
+// sentinelError wraps an error from talking to sentinels
+func sentinelError(err error) *rsclient.Error {
+	return rsclient.NewError(common.ErrCodeSentinel, "%s", err)
+}
+
+// Version reports the protocol versions the server accepts. It answers
+// requests of any version so clients can find out why they are rejected.
+func (s *Service) Version(req rsclient.EmptyRequest, resp *rsclient.VersionResponse) error {
+	resp.ResponseHeader.Version = rsclient.ProtocolVersion
+	resp.MinVersion = rsclient.MinProtocolVersion
+	return nil
+}
+
+// ListPods returns a summary of every pod, optionally only those with the
+// given status
+func (s *Service) ListPods(req rsclient.ListPodsRequest, resp *rsclient.ListPodsResponse) error {
+	con, ctx, cancel := readCall(req.Context(), s.constellation)
+	defer cancel()
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	resp.Pods = []common.PodSummary{}
+	for _, pod := range con.PodSummaries(ctx) {
+		if req.Status == "" || pod.Status() == req.Status {
+			resp.Pods = append(resp.Pods, pod)
+		}
+	}
+	return nil
+}
+
+// ListPodsInError returns every pod currently in an error state
+func (s *Service) ListPodsInError(req rsclient.EmptyRequest, resp *rsclient.PodsResponse) error {
+	con, ctx, cancel := readCall(req.Context(), s.constellation)
+	defer cancel()
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	resp.Pods = []common.RedisPod{}
+	for _, pod := range con.GetPodsInError(ctx) {
+		resp.Pods = append(resp.Pods, *pod)
+	}
+	return nil
+}
+
+// GetPod returns the named pod
+func (s *Service) GetPod(req rsclient.PodRequest, resp *rsclient.PodResponse) error {
+	con, ctx, cancel := readCall(req.Context(), s.constellation)
+	defer cancel()
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	pod, rerr := s.pod(ctx, con, req.Pod)
+	if rerr != nil {
+		resp.Error = rerr
+		return nil
+	}
+	resp.Pod = *pod
+	return nil
+}
+
+// MonitorPod has the constellation's sentinels monitor the pod
+func (s *Service) MonitorPod(req rsclient.MonitorPodRequest, resp *rsclient.PodResponse) error {
+	con, ctx, done := writeCall(req.Context(), s.constellation)
+	defer done()
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	m := req.MonitorRequest
+	if m.Podname == "" || m.MasterAddress == "" || m.MasterPort == 0 || m.Quorum < 1 {
+		resp.Error = rsclient.NewError(common.ErrCodeInvalidRequest, "Podname, MasterAddress, MasterPort and Quorum are required")
+		return nil
+	}
+	ok, err := con.MonitorPod(ctx, m.Podname, m.MasterAddress, m.MasterPort, m.Quorum, m.AuthToken)
+	if !ok {
+		resp.Error = rsclient.NewError(common.ErrCodeQuorum, "Pod '%s' failed to reach sentinel quorum: %v", m.Podname, err)
+		return nil
+	}
+	pod, rerr := s.pod(ctx, con, m.Podname)
+	if rerr != nil {
+		resp.Error = rerr
+		return nil
+	}
+	resp.Pod = *pod
+	return nil
+}
+
+// RemovePod stops the constellation monitoring the pod
+func (s *Service) RemovePod(req rsclient.PodRequest, resp *rsclient.EmptyResponse) error {
+	con, ctx, done := writeCall(req.Context(), s.constellation)
+	defer done()
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	if _, rerr := s.pod(ctx, con, req.Pod); rerr != nil {
+		resp.Error = rerr
+		return nil
+	}
+	ok, err := con.RemovePod(ctx, req.Pod)
+	if err != nil || !ok {
+		resp.Error = rsclient.NewError(common.ErrCodeSentinel, "Unable to remove pod '%s' from every sentinel: %v", req.Pod, err)
+	}
+	return nil
+}
+
+// Failover fails the pod over to one of its slaves
+func (s *Service) Failover(req rsclient.FailoverPodRequest, resp *rsclient.EmptyResponse) error {
+	con, ctx, done := writeCall(req.Context(), s.constellation)
+	defer done()
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	if _, rerr := s.pod(ctx, con, req.Pod); rerr != nil {
+		resp.Error = rerr
+		return nil
+	}
+	ok, err := con.Failover(ctx, req.Pod, req.Force)
+	switch {
+	case err == actions.ErrPodInMaintenance:
+		resp.Error = rsclient.NewError(common.ErrCodeInMaintenance, "%s", err)
+	case err != nil && strings.Contains(err.Error(), "INPROG"):
+		resp.Error = rsclient.NewError(common.ErrCodeFailoverInProgress, "A failover is already in progress for pod '%s'", req.Pod)
+	case err != nil && strings.Contains(err.Error(), "NOGOODSLAVE"):
+		resp.Error = rsclient.NewError(common.ErrCodeNoGoodSlave, "No suitable slave to promote in pod '%s'", req.Pod)
+	case err != nil:
+		resp.Error = sentinelError(err)
+	case !ok:
+		resp.Error = rsclient.NewError(common.ErrCodeSentinel, "No sentinel accepted the failover of pod '%s'", req.Pod)
+	}
+	return nil
+}
+
+// ResetPod starts a job resetting the pod on its sentinels
+func (s *Service) ResetPod(req rsclient.ResetPodRequest, resp *rsclient.JobResponse) error {
+	con, ctx, done := writeCall(req.Context(), s.constellation)
+	defer done()
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	if _, rerr := s.pod(ctx, con, req.Pod); rerr != nil {
+		resp.Error = rerr
+		return nil
+	}
+	resp.Job = actions.Jobs.Start(common.JobReset, req.Pod, "rpc", func(ctx context.Context, log *logging.Logger) (interface{}, error) {
+		con.Acquire()
+		defer con.Release()
+		con.ResetPod(ctx, req.Pod, req.Simultaneous)
+		return common.APIResult{Message: fmt.Sprintf("Pod '%s' reset", req.Pod)}, nil
+	})
+	return nil
+}
+
+// BalancePod brings the pod to the number of sentinels it needs
+func (s *Service) BalancePod(req rsclient.BalancePodRequest, resp *rsclient.EmptyResponse) error {
+	con, ctx, done := writeCall(req.Context(), s.constellation)
+	defer done()
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	pod, rerr := s.pod(ctx, con, req.Pod)
+	if rerr != nil {
+		resp.Error = rerr
+		return nil
+	}
+	err := con.BalancePod(ctx, pod, req.Force)
+	switch {
+	case err == actions.ErrPodInMaintenance:
+		resp.Error = rsclient.NewError(common.ErrCodeInMaintenance, "%s", err)
+	case err != nil:
+		resp.Error = sentinelError(err)
+	}
+	return nil
+}
+
+// GetMaster returns the pod's master as its sentinels report it
+func (s *Service) GetMaster(req rsclient.PodRequest, resp *rsclient.MasterResponse) error {
+	con, ctx, cancel := readCall(req.Context(), s.constellation)
+	defer cancel()
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	master, err := con.GetMaster(ctx, req.Pod)
+	switch {
+	case err != nil:
+		resp.Error = sentinelError(err)
+	case master.Host == "":
+		resp.Error = rsclient.NewError(common.ErrCodePodNotFound, "No master found for pod '%s'", req.Pod)
+	default:
+		resp.Master = master
+	}
+	return nil
+}
+
+// GetSlaves returns the pod's slaves as its sentinels report them
+func (s *Service) GetSlaves(req rsclient.PodRequest, resp *rsclient.SlavesResponse) error {
+	con, ctx, cancel := readCall(req.Context(), s.constellation)
+	defer cancel()
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	slaves, err := con.GetSlaves(ctx, req.Pod)
+	if err != nil {
+		resp.Error = sentinelError(err)
+		return nil
+	}
+	resp.Slaves = slaves
+	return nil
+}
+
+// AddSlave makes a Redis instance a slave of the pod's master
+func (s *Service) AddSlave(req rsclient.AddSlaveRequest, resp *rsclient.EmptyResponse) error {
+	con, ctx, done := writeCall(req.Context(), s.constellation)
+	defer done()
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	if _, rerr := s.pod(ctx, con, req.Pod); rerr != nil {
+		resp.Error = rerr
+		return nil
+	}
+	err := con.AddSlaveToPod(ctx, req.Pod, req.Address, req.Port, req.Auth)
+	switch {
+	case err == actions.ErrAlreadySlave:
+		resp.Error = rsclient.NewError(common.ErrCodeAlreadySlave, "%s:%d is already a slave of pod '%s'", req.Address, req.Port, req.Pod)
+	case err != nil:
+		resp.Error = rsclient.NewError(common.ErrCodeNodeUnreachable, "%s", err)
+	}
+	return nil
+}
+
+// RemoveSlave detaches a slave from the pod
+func (s *Service) RemoveSlave(req rsclient.RemoveSlaveRequest, resp *rsclient.EmptyResponse) error {
+	con, ctx, done := writeCall(req.Context(), s.constellation)
+	defer done()
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	if _, rerr := s.pod(ctx, con, req.Pod); rerr != nil {
+		resp.Error = rerr
+		return nil
+	}
+	err := con.RemoveSlaveFromPod(ctx, req.Pod, req.Slave)
+	switch {
+	case err == actions.ErrNotSlaveOfPod:
+		resp.Error = rsclient.NewError(common.ErrCodeNotSlave, "%s is not a slave of pod '%s'", req.Slave, req.Pod)
+	case err != nil:
+		resp.Error = rsclient.NewError(common.ErrCodeNodeUnreachable, "%s", err)
+	}
+	return nil
+}
+
+// CheckPodAuth reports whether each of the pod's nodes accepts its auth
+// token
+func (s *Service) CheckPodAuth(req rsclient.PodRequest, resp *rsclient.PodAuthResponse) error {
+	con, ctx, cancel := readCall(req.Context(), s.constellation)
+	defer cancel()
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	pod, rerr := s.pod(ctx, con, req.Pod)
+	if rerr != nil {
+		resp.Error = rerr
+		return nil
+	}
+	if pod.Master == nil {
+		resp.Error = rsclient.NewError(common.ErrCodeNodeUnreachable, "No connection to the master of pod '%s'", req.Pod)
+		return nil
+	}
+	resp.Nodes = map[string]bool{pod.Master.Name: pod.Master.Ping(ctx)}
+	for _, slave := range pod.Master.Slaves {
+		resp.Nodes[slave.Name] = slave.Ping(ctx)
+	}
+	return nil
+}
+
+// GetPodAuth returns the pod's auth token. The RPC layer audits the call.
+func (s *Service) GetPodAuth(req rsclient.PodRequest, resp *rsclient.PodAuthTokenResponse) error {
+	con := s.constellation.Snapshot()
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	token := con.GetPodAuth(req.Pod)
+	if token == "" {
+		resp.Error = rsclient.NewError(common.ErrCodeNotFound, "No auth token known for pod '%s'", req.Pod)
+		return nil
+	}
+	resp.AuthToken = token
+	return nil
+}
+
+// GetPodAuthVersions returns the history of the pod's auth token with the
+// tokens masked
+func (s *Service) GetPodAuthVersions(req rsclient.PodRequest, resp *rsclient.PodAuthVersionsResponse) error {
+	con := s.constellation.Snapshot()
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	store := con.Credentials
+	if store == nil {
+		resp.Error = rsclient.NewError(common.ErrCodeInternal, "Credential store is not running")
+		return nil
+	}
+	resp.Versions = store.Versions(req.Pod)
+	return nil
+}
+
+// GetPodSentinels returns the sentinels monitoring the pod
+func (s *Service) GetPodSentinels(req rsclient.PodRequest, resp *rsclient.SentinelsResponse) error {
+	con, ctx, cancel := readCall(req.Context(), s.constellation)
+	defer cancel()
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	if _, rerr := s.pod(ctx, con, req.Pod); rerr != nil {
+		resp.Error = rerr
+		return nil
+	}
+	resp.Sentinels = []common.SentinelSummary{}
+	for _, sentinel := range con.GetSentinelsForPod(ctx, req.Pod) {
+		resp.Sentinels = append(resp.Sentinels, con.SummarizeSentinel(ctx, sentinel))
+	}
+	return nil
+}
+
+// ValidatePodSentinels returns each sentinel's view of the pod
+func (s *Service) ValidatePodSentinels(req rsclient.PodRequest, resp *rsclient.ConsistencyResponse) error {
+	con, ctx, cancel := readCall(req.Context(), s.constellation)
+	defer cancel()
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	if _, rerr := s.pod(ctx, con, req.Pod); rerr != nil {
+		resp.Error = rerr
+		return nil
+	}
+	report, err := con.ValidatePodSentinels(ctx, req.Pod)
+	resp.Report = report
+	if err != nil {
+		resp.Error = sentinelError(err)
+	}
+	return nil
+}
+
+// CheckPodTopology returns the topology anomalies found for the pod
+func (s *Service) CheckPodTopology(req rsclient.PodRequest, resp *rsclient.TopologyResponse) error {
+	con, ctx, cancel := readCall(req.Context(), s.constellation)
+	defer cancel()
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	report, err := con.CheckPodTopology(ctx, req.Pod)
+	resp.Report = report
+	if err != nil {
+		resp.Error = sentinelError(err)
+	}
+	return nil
+}
+
+// CheckTopology returns the topology report of every pod
+func (s *Service) CheckTopology(req rsclient.EmptyRequest, resp *rsclient.TopologiesResponse) error {
+	con, ctx, cancel := readCall(req.Context(), s.constellation)
+	defer cancel()
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	resp.Reports = con.CheckTopology(ctx)
+	return nil
+}
+
+// GetPodMaintenance returns the pod's maintenance window
+func (s *Service) GetPodMaintenance(req rsclient.PodRequest, resp *rsclient.MaintenanceResponse) error {
+	con := s.constellation.Snapshot()
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	m, in := con.GetPodMaintenance(req.Pod)
+	if !in {
+		resp.Error = rsclient.NewError(common.ErrCodeNotFound, "Pod '%s' is not in maintenance", req.Pod)
+		return nil
+	}
+	resp.Maintenance = m
+	return nil
+}
+
+// SetPodMaintenance places a pod into maintenance
+func (s *Service) SetPodMaintenance(req rsclient.MaintenanceRequest, resp *rsclient.MaintenanceResponse) error {
+	con, ctx, done := writeCall(req.Context(), s.constellation)
+	defer done()
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	if req.Reason == "" {
+		resp.Error = rsclient.NewError(common.ErrCodeInvalidRequest, "A reason is required")
+		return nil
+	}
+	expires, err := req.ExpiresAt()
+	if err != nil {
+		resp.Error = rsclient.NewError(common.ErrCodeInvalidRequest, "Invalid duration: %s", err)
+		return nil
+	}
+	m, err := con.SetPodMaintenance(ctx, req.Podname, req.Reason, req.Owner, expires, req.Consul)
+	if err != nil {
+		resp.Error = rsclient.NewError(common.ErrCodeInvalidRequest, "%s", err)
+		return nil
+	}
+	resp.Maintenance = m
+	return nil
+}
+
+// ClearPodMaintenance takes a pod out of maintenance
+func (s *Service) ClearPodMaintenance(req rsclient.PodRequest, resp *rsclient.EmptyResponse) error {
+	con, ctx, done := writeCall(req.Context(), s.constellation)
+	defer done()
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	if err := con.ClearPodMaintenance(ctx, req.Pod); err != nil {
+		resp.Error = rsclient.NewError(common.ErrCodeInternal, "%s", err)
+	}
+	return nil
+}
+
+// ListMaintenance returns every pod currently in maintenance
+func (s *Service) ListMaintenance(req rsclient.EmptyRequest, resp *rsclient.MaintenanceListResponse) error {
+	con := s.constellation.Snapshot()
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	resp.Maintenance = con.ListMaintenance()
+	return nil
+}
+
+// ListNodes returns a summary of every node RedSkull has connected to
+func (s *Service) ListNodes(req rsclient.EmptyRequest, resp *rsclient.NodesResponse) error {
+	con, ctx, cancel := readCall(req.Context(), s.constellation)
+	defer cancel()
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	resp.Nodes = con.NodeSummaries(ctx)
+	return nil
+}
+
+// GetNode returns a node, refreshing its data first
+func (s *Service) GetNode(req rsclient.NodeRequest, resp *rsclient.NodeResponse) error {
+	con, ctx, cancel := readCall(req.Context(), s.constellation)
+	defer cancel()
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	podname, known := con.NodeNameToPodMap[req.Node]
+	if !known {
+		resp.Error = rsclient.NewError(common.ErrCodeNodeNotFound, "Node '%s' is not part of a known pod", req.Node)
+		return nil
+	}
+	node, err := con.GetNode(ctx, req.Node, podname, "")
+	if err != nil || node == nil {
+		resp.Error = rsclient.NewError(common.ErrCodeNodeUnreachable, "Unable to connect to node '%s': %v", req.Node, err)
+		return nil
+	}
+	node.UpdateData(ctx)
+	resp.Node = *node
+	return nil
+}
+
+// CloneNode starts a job cloning one node to another
+func (s *Service) CloneNode(req rsclient.CloneNodeRequest, resp *rsclient.JobResponse) error {
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	clone := req.CloneRequest
+	if clone.Origin == "" || clone.Clone == "" || clone.Origin == clone.Clone {
+		resp.Error = rsclient.NewError(common.ErrCodeInvalidRequest, "Origin and Clone are required and must differ")
+		return nil
+	}
+	if clone.Role == "" {
+		clone.Role = "master"
+	}
+	if clone.Reconfig {
+		clone.Promote = true
+	}
+	resp.Job = actions.Jobs.Start(common.JobClone, "", "rpc", func(ctx context.Context, log *logging.Logger) (interface{}, error) {
+		result := handlers.CloneServer(ctx, clone.Origin, clone.Clone, clone.Promote, clone.Reconfig, 3.0, clone.Role)
+		if result["status"] == "ERROR" {
+			return result, fmt.Errorf("%s", result["error"])
+		}
+		return result, nil
+	})
+	return nil
+}
+
+// GetStats returns the constellation's metrics
+func (s *Service) GetStats(req rsclient.EmptyRequest, resp *rsclient.StatsResponse) error {
+	con, ctx, cancel := readCall(req.Context(), s.constellation)
+	defer cancel()
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	resp.Stats = con.GetStats(ctx)
+	return nil
+}
+
+// ListSentinels returns a summary of every sentinel in the constellation
+func (s *Service) ListSentinels(req rsclient.EmptyRequest, resp *rsclient.SentinelsResponse) error {
+	con, ctx, cancel := readCall(req.Context(), s.constellation)
+	defer cancel()
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	resp.Sentinels = con.SentinelSummaries(ctx)
+	return nil
+}
+
+// AddSentinel adds the sentinel at the address to the constellation
+func (s *Service) AddSentinel(req rsclient.AddressRequest, resp *rsclient.EmptyResponse) error {
+	con, ctx, done := writeCall(req.Context(), s.constellation)
+	defer done()
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	if err := con.AddSentinelByAddress(ctx, req.Address); err != nil {
+		resp.Error = sentinelError(err)
+	}
+	return nil
+}
+
+// ListJobs returns jobs, newest first
+func (s *Service) ListJobs(req rsclient.ListJobsRequest, resp *rsclient.JobsResponse) error {
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	resp.Jobs = []common.Job{}
+	for _, job := range actions.Jobs.List() {
+		if (req.Type == "" || job.Type == req.Type) && (req.State == "" || job.State == req.State) && (req.Pod == "" || job.Pod == req.Pod) {
+			resp.Jobs = append(resp.Jobs, job)
+		}
+	}
+	return nil
+}
+
+// GetJob returns the job with the given ID
+func (s *Service) GetJob(req rsclient.JobRequest, resp *rsclient.JobResponse) error {
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	job, ok := actions.Jobs.Get(req.ID)
+	if !ok {
+		resp.Error = rsclient.NewError(common.ErrCodeJobNotFound, "Job '%s' not found", req.ID)
+		return nil
+	}
+	resp.Job = job
+	return nil
+}
+
+// ListEvents returns recent events, newest first
+func (s *Service) ListEvents(req rsclient.ListEventsRequest, resp *rsclient.EventsResponse) error {
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	for _, pattern := range []string{req.Type, req.Pod} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			resp.Error = rsclient.NewError(common.ErrCodeInvalidRequest, "'%s' is not a valid pattern", pattern)
+			return nil
+		}
+	}
+	resp.Events = events.History(events.Filter{Type: req.Type, Pod: req.Pod, MinSeverity: req.MinSeverity})
+	if req.Limit > 0 && len(resp.Events) > req.Limit {
+		resp.Events = resp.Events[:req.Limit]
+	}
+	return nil
+}
+
+// PlanRebalance returns the moves a constellation rebalance would make
+func (s *Service) PlanRebalance(req rsclient.EmptyRequest, resp *rsclient.RebalancePlanResponse) error {
+	con, ctx, cancel := readCall(req.Context(), s.constellation)
+	defer cancel()
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	plan, err := con.PlanRebalance(ctx)
+	resp.Plan = plan
+	if err != nil {
+		resp.Error = sentinelError(err)
+	}
+	return nil
+}
+
+// ConfirmRebalance executes the previewed constellation rebalance
+func (s *Service) ConfirmRebalance(req rsclient.ConfirmRebalanceRequest, resp *rsclient.RebalanceReportResponse) error {
+	con, ctx, done := writeCall(req.Context(), s.constellation)
+	defer done()
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	_, report, err := con.ConfirmRebalance(ctx, req.Fingerprint)
+	resp.Report = report
+	switch {
+	case err == actions.ErrRebalancePlanChanged:
+		resp.Error = rsclient.NewError(common.ErrCodeRebalanceChanged, "%s", err)
+	case err == actions.ErrRebalanceUnconfirmed:
+		resp.Error = rsclient.NewError(common.ErrCodeInvalidRequest, "%s", err)
+	case err != nil:
+		resp.Error = sentinelError(err)
+	}
+	return nil
+}
+
+// PlanManifest diffs the manifest against the constellation
+func (s *Service) PlanManifest(req rsclient.ManifestRequest, resp *rsclient.ManifestPlanResponse) error {
+	con, ctx, cancel := readCall(req.Context(), s.constellation)
+	defer cancel()
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	plan, err := con.PlanManifest(ctx, req.Manifest)
+	resp.Plan = plan
+	if err != nil {
+		resp.Error = rsclient.NewError(common.ErrCodeInvalidRequest, "%s", err)
+	}
+	return nil
+}
+
+// ApplyManifest applies the manifest, or reports what would be done if
+// DryRun is set
+func (s *Service) ApplyManifest(req rsclient.ManifestRequest, resp *rsclient.ManifestReportResponse) error {
+	con, ctx, done := writeCall(req.Context(), s.constellation)
+	defer done()
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	report, err := con.ApplyManifest(ctx, req.Manifest, req.DryRun)
+	resp.Report = report
+	if err != nil {
+		resp.Error = rsclient.NewError(common.ErrCodeInvalidRequest, "%s", err)
+	}
+	return nil
+}
+
+// ExportConstellation returns a snapshot of the constellation topology
+func (s *Service) ExportConstellation(req rsclient.ExportRequest, resp *rsclient.SnapshotResponse) error {
+	con, ctx, cancel := readCall(req.Context(), s.constellation)
+	defer cancel()
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	snap, err := con.ExportSnapshot(ctx, req.Encrypt)
+	resp.Snapshot = snap
+	if err != nil {
+		resp.Error = rsclient.NewError(common.ErrCodeInternal, "%s", err)
+	}
+	return nil
+}
+
+// RestoreConstellation re-monitors the pods in the snapshot
+func (s *Service) RestoreConstellation(req rsclient.RestoreRequest, resp *rsclient.RestoreResponse) error {
+	con, ctx, done := writeCall(req.Context(), s.constellation)
+	defer done()
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	report, err := con.RestoreSnapshot(ctx, req.Snapshot)
+	resp.Report = report
+	if err != nil {
+		resp.Error = rsclient.NewError(common.ErrCodeInvalidRequest, "%s", err)
+	}
+	return nil
+}
+
+// GetLogLevel returns the server's log level
+func (s *Service) GetLogLevel(req rsclient.EmptyRequest, resp *rsclient.LogLevelResponse) error {
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	resp.Level = logging.GetLevel().String()
+	return nil
+}
+
+// SetLogLevel changes the server's log level
+func (s *Service) SetLogLevel(req rsclient.LogLevelRequest, resp *rsclient.LogLevelResponse) error {
+	if !s.begin(req.RequestHeader, &resp.ResponseHeader) {
+		return nil
+	}
+	level, err := logging.ParseLevel(req.Level)
+	if err != nil {
+		resp.Error = rsclient.NewError(common.ErrCodeInvalidRequest, "%s", err)
+		return nil
+	}
+	logging.SetLevel(level)
+	logging.Infof("Log level set to %s over RPC", level)
+	resp.Level = level.String()
+	return nil
+}
@@ -0,0 +1,451 @@
+// Package simulate builds a synthetic constellation for demos and UI work.
+// The sentinels and Redis instances are the in-process fakes from redistest,
+// so the controller runs its normal code against them, and failures such as
+// a dead sentinel or a split brain can be injected on a schedule or on
+// demand.
+package simulate
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/therealbill/redskull/redskull-controller/redistest"
+	"github.com/therealbill/redskull/redskull-shared/logging"
+)
+
+// The failures which can be injected
+const (
+	DeadSentinel = "dead-sentinel"
+	BadAuth      = "bad-auth"
+	LaggingSlave = "lagging-slave"
+	SplitBrain   = "split-brain"
+)
+
+// Kinds lists every failure kind
+var Kinds = []string{DeadSentinel, BadAuth, LaggingSlave, SplitBrain}
+
+// Config describes the constellation to build. FailureInterval, if set,
+// injects a random failure at that interval, healing the previous one.
+type Config struct {
+	Sentinels       int
+	Pods            int
+	Slaves          int
+	FailureInterval time.Duration
+}
+
+// Failure is an injected failure. Target is the pod for pod failures and
+// the sentinel's address for a dead sentinel.
+type Failure struct {
+	ID        string
+	Kind      string
+	Target    string
+	Detail    string
+	Scheduled bool
+	Started   time.Time
+	heal      func()
+}
+
+// PodStatus describes a simulated pod
+type PodStatus struct {
+	Name      string
+	Master    string
+	Slaves    []string
+	Sentinels []string
+}
+
+// Status is the simulation's topology and active failures
+type Status struct {
+	Sentinels []string
+	Pods      []PodStatus
+	Failures  []Failure
+	Kinds     []string
+}
+
+// Simulation is a running synthetic constellation. The first sentinel is
+// the local one and monitors every pod.
+type Simulation struct {
+	Config
+	topo      *redistest.Topology
+	sentinels []*redistest.Sentinel
+	pods      map[string]*redistest.Pod
+	offsets   map[*redistest.Redis]int64
+	dir       string
+
+	mu       sync.Mutex // guards failures and lastID
+	failures map[string]*Failure
+	lastID   int
+}
+
+// New starts the sentinels and pods. Each pod has a quorum of two, or one
+// with fewer than three sentinels, and is monitored by quorum+1 sentinels.
+func New(cfg Config) (*Simulation, error) {
+	if cfg.Sentinels < 1 {
+		return nil, fmt.Errorf("A simulation needs at least one sentinel")
+	}
+	if cfg.Pods < 0 || cfg.Slaves < 0 {
+		return nil, fmt.Errorf("Pod and slave counts can't be negative")
+	}
+	dir, err := ioutil.TempDir("", "redskull-simulation")
+	if err != nil {
+		return nil, err
+	}
+	sim := &Simulation{
+		Config:   cfg,
+		topo:     redistest.New(),
+		pods:     make(map[string]*redistest.Pod),
+		offsets:  make(map[*redistest.Redis]int64),
+		dir:      dir,
+		failures: make(map[string]*Failure),
+	}
+	// Failovers take a moment and reach the other sentinels later, as real
+	// ones do, so failover drills have something to time
+	sim.topo.SetFailoverDelay(time.Second, 2*time.Second)
+	sim.sentinels = sim.topo.AddSentinels(cfg.Sentinels)
+	for i, s := range sim.sentinels {
+		// RedSkull reads pod auth from each sentinel's config file
+		err := s.SetConfigFile(filepath.Join(dir, fmt.Sprintf("sentinel-%d.conf", i)))
+		if err != nil {
+			sim.Close()
+			return nil, err
+		}
+	}
+	quorum := 2
+	if cfg.Sentinels < 3 {
+		quorum = 1
+	}
+	monitors := quorum + 1
+	if monitors > cfg.Sentinels {
+		monitors = cfg.Sentinels
+	}
+	for i := 0; i < cfg.Pods; i++ {
+		name := fmt.Sprintf("pod%d", i+1)
+		// The local sentinel plus the next ones in turn, so load is spread
+		// and every sentinel can be discovered through a pod
+		watchers := []*redistest.Sentinel{sim.sentinels[0]}
+		for j := 1; j < monitors; j++ {
+			watchers = append(watchers, sim.sentinels[1+(i*(monitors-1)+j-1)%(cfg.Sentinels-1)])
+		}
+		pod := sim.topo.AddPod(name, quorum, cfg.Slaves, "simulated-"+name, watchers...)
+		sim.pods[name] = pod
+		sim.populate(pod)
+	}
+	logging.Infof("Simulating %d sentinels and %d pods with %d slaves each", cfg.Sentinels, cfg.Pods, cfg.Slaves)
+	return sim, nil
+}
+
+// populate gives a pod's nodes plausible memory use, replication offsets,
+// slow log entries and latency spikes
+func (sim *Simulation) populate(pod *redistest.Pod) {
+	offset := rand.Int63n(1 << 30)
+	for i, node := range pod.Nodes {
+		node.SetUsedMemory((10 + rand.Int63n(60)) * (1 << 30) / 100)
+		node.SetReplOffset(offset)
+		sim.offsets[node] = offset
+		if i == 0 {
+			node.SetConfig("latency-monitor-threshold", "100")
+			for n := rand.Intn(4); n > 0; n-- {
+				node.AddLatency("command", time.Duration(100+rand.Intn(400))*time.Millisecond)
+			}
+			for n := rand.Intn(6); n > 0; n-- {
+				node.AddSlowLog(time.Duration(10+rand.Intn(90))*time.Millisecond, "KEYS", "session:*")
+			}
+		}
+	}
+}
+
+// ConfigFile returns the local sentinel's config file, for the controller to
+// load
+func (sim *Simulation) ConfigFile() string {
+	return sim.sentinels[0].ConfigFile()
+}
+
+// SentinelAddresses returns the address of every sentinel
+func (sim *Simulation) SentinelAddresses() (addresses []string) {
+	for _, s := range sim.sentinels {
+		addresses = append(addresses, s.Addr())
+	}
+	return addresses
+}
+
+// Status returns the simulated topology and the active failures
+func (sim *Simulation) Status() Status {
+	status := Status{Sentinels: sim.SentinelAddresses(), Failures: sim.Failures(), Kinds: Kinds}
+	for _, name := range sim.podNames() {
+		pod := sim.pods[name]
+		ps := PodStatus{Name: name}
+		if master := pod.Master(); master != nil {
+			ps.Master = master.Addr()
+		}
+		for _, slave := range pod.Slaves() {
+			ps.Slaves = append(ps.Slaves, slave.Addr())
+		}
+		for _, s := range sim.sentinels {
+			if s.MasterAddr(name) != "" {
+				ps.Sentinels = append(ps.Sentinels, s.Addr())
+			}
+		}
+		status.Pods = append(status.Pods, ps)
+	}
+	return status
+}
+
+// Failures returns the active failures, oldest first
+func (sim *Simulation) Failures() []Failure {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	list := make([]Failure, 0, len(sim.failures))
+	for _, f := range sim.failures {
+		list = append(list, *f)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Started.Before(list[j].Started) })
+	return list
+}
+
+// Inject starts a failure of the given kind. The target is a pod name, or a
+// sentinel address for a dead sentinel; an empty target picks one at random.
+// A target can only have one failure at a time.
+func (sim *Simulation) Inject(kind, target string) (Failure, error) {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	return sim.inject(kind, target, false)
+}
+
+func (sim *Simulation) inject(kind, target string, scheduled bool) (Failure, error) {
+	if target == "" {
+		target = sim.pickTarget(kind)
+		if target == "" {
+			return Failure{}, fmt.Errorf("No target available for a %s failure", kind)
+		}
+	}
+	for _, f := range sim.failures {
+		if f.Target == target {
+			return Failure{}, fmt.Errorf("'%s' already has an active %s failure", target, f.Kind)
+		}
+	}
+	f := &Failure{Kind: kind, Target: target, Scheduled: scheduled, Started: time.Now()}
+	var err error
+	switch kind {
+	case DeadSentinel:
+		err = sim.killSentinel(f)
+	case BadAuth:
+		err = sim.changeAuth(f)
+	case LaggingSlave:
+		err = sim.lagSlave(f)
+	case SplitBrain:
+		err = sim.splitBrain(f)
+	default:
+		err = fmt.Errorf("Unknown failure kind '%s'", kind)
+	}
+	if err != nil {
+		return Failure{}, err
+	}
+	sim.lastID++
+	f.ID = strconv.Itoa(sim.lastID)
+	sim.failures[f.ID] = f
+	logging.Warnf("Simulation: injected %s failure %s on %s: %s", f.Kind, f.ID, f.Target, f.Detail)
+	return *f, nil
+}
+
+// Heal ends a failure
+func (sim *Simulation) Heal(id string) error {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	return sim.healLocked(id)
+}
+
+func (sim *Simulation) healLocked(id string) error {
+	f, ok := sim.failures[id]
+	if !ok {
+		return fmt.Errorf("No active failure '%s'", id)
+	}
+	f.heal()
+	delete(sim.failures, id)
+	logging.Infof("Simulation: healed %s failure %s on %s", f.Kind, f.ID, f.Target)
+	return nil
+}
+
+// Run injects a random failure every FailureInterval until ctx ends, healing
+// the previous scheduled failure first. It returns at once without an
+// interval.
+func (sim *Simulation) Run(ctx context.Context) {
+	if sim.FailureInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(sim.FailureInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		sim.mu.Lock()
+		for id, f := range sim.failures {
+			if f.Scheduled {
+				sim.healLocked(id)
+			}
+		}
+		kind := Kinds[rand.Intn(len(Kinds))]
+		if _, err := sim.inject(kind, "", true); err != nil {
+			logging.Warnf("Simulation: unable to inject a %s failure: %s", kind, err)
+		}
+		sim.mu.Unlock()
+	}
+}
+
+// Close heals every failure, stops the servers and removes the config files
+func (sim *Simulation) Close() {
+	sim.mu.Lock()
+	for id := range sim.failures {
+		sim.healLocked(id)
+	}
+	sim.mu.Unlock()
+	sim.topo.Close()
+	os.RemoveAll(sim.dir)
+}
+
+func (sim *Simulation) podNames() []string {
+	var names []string
+	for name := range sim.pods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// pickTarget returns a random target without an active failure which the
+// kind of failure can apply to, or ""
+func (sim *Simulation) pickTarget(kind string) string {
+	busy := make(map[string]bool)
+	for _, f := range sim.failures {
+		busy[f.Target] = true
+	}
+	var candidates []string
+	if kind == DeadSentinel {
+		// The controller can't run without its local sentinel
+		for _, s := range sim.sentinels[1:] {
+			if !busy[s.Addr()] {
+				candidates = append(candidates, s.Addr())
+			}
+		}
+	} else {
+		for _, name := range sim.podNames() {
+			if !busy[name] && (kind == BadAuth || len(sim.pods[name].Slaves()) > 0) {
+				candidates = append(candidates, name)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	return candidates[rand.Intn(len(candidates))]
+}
+
+func (sim *Simulation) pod(name string) (*redistest.Pod, error) {
+	pod, ok := sim.pods[name]
+	if !ok {
+		return nil, fmt.Errorf("No simulated pod '%s'", name)
+	}
+	return pod, nil
+}
+
+// killSentinel stops a sentinel other than the local one
+func (sim *Simulation) killSentinel(f *Failure) error {
+	for _, s := range sim.sentinels[1:] {
+		if s.Addr() == f.Target {
+			s.Stop()
+			f.Detail = "sentinel stopped"
+			f.heal = func() {
+				if err := s.Start(); err != nil {
+					logging.Errorf("Simulation: unable to restart sentinel %s: %s", s.Addr(), err)
+				}
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("No simulated remote sentinel '%s'", f.Target)
+}
+
+// changeAuth changes the password of every node in the pod behind the
+// sentinels' and the controller's backs
+func (sim *Simulation) changeAuth(f *Failure) error {
+	pod, err := sim.pod(f.Target)
+	if err != nil {
+		return err
+	}
+	password := fmt.Sprintf("rotated-%d", rand.Int63())
+	for _, node := range pod.Nodes {
+		node.SetConfig("requirepass", password)
+		node.SetConfig("masterauth", password)
+	}
+	f.Detail = "pod password changed on every node"
+	f.heal = func() {
+		for _, node := range pod.Nodes {
+			node.SetConfig("requirepass", pod.Auth)
+			node.SetConfig("masterauth", pod.Auth)
+		}
+	}
+	return nil
+}
+
+// lagSlave puts one of the pod's slaves a minute and 64MB behind its
+// master
+func (sim *Simulation) lagSlave(f *Failure) error {
+	pod, err := sim.pod(f.Target)
+	if err != nil {
+		return err
+	}
+	slaves := pod.Slaves()
+	if len(slaves) == 0 {
+		return fmt.Errorf("Pod '%s' has no slaves to lag", f.Target)
+	}
+	slave := slaves[rand.Intn(len(slaves))]
+	offset := sim.offsets[slave]
+	slave.SetLag(60)
+	slave.SetReplOffset(offset - 64<<20)
+	f.Detail = fmt.Sprintf("slave %s lagging", slave.Addr())
+	f.heal = func() {
+		slave.SetLag(0)
+		slave.SetReplOffset(offset)
+	}
+	return nil
+}
+
+// splitBrain promotes one of the pod's slaves and points one of its remote
+// sentinels at it, so the sentinels disagree on the master
+func (sim *Simulation) splitBrain(f *Failure) error {
+	pod, err := sim.pod(f.Target)
+	if err != nil {
+		return err
+	}
+	master, slaves := pod.Master(), pod.Slaves()
+	if master == nil || len(slaves) == 0 {
+		return fmt.Errorf("Pod '%s' has no slave to promote", f.Target)
+	}
+	var rogue *redistest.Sentinel
+	for _, s := range sim.sentinels[1:] {
+		if s.MasterAddr(pod.Name) == master.Addr() {
+			rogue = s
+		}
+	}
+	if rogue == nil {
+		return fmt.Errorf("Pod '%s' has no remote sentinel to disagree", f.Target)
+	}
+	promoted := slaves[0]
+	promoted.SlaveOf(nil)
+	rogue.Monitor(pod.Name, promoted, pod.Quorum, pod.Auth)
+	f.Detail = fmt.Sprintf("slave %s promoted, sentinel %s follows it", promoted.Addr(), rogue.Addr())
+	f.heal = func() {
+		promoted.SlaveOf(master)
+		rogue.Monitor(pod.Name, master, pod.Quorum, pod.Auth)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/therealbill/redskull/redskull-controller/rpcclient"
+	"github.com/urfave/cli"
+)
+
+func listJobs(c *cli.Context) error {
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
+	all, err := client.ListJobs()
+	if err != nil {
+		return err
+	}
+	jobs := []common.Job{}
+	for _, job := range all {
+		if state := c.String("state"); state != "" && job.State != state {
+			continue
+		}
+		if pod := c.String("pod"); pod != "" && job.Pod != pod {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	return output(c, jobs, func(w io.Writer) {
+		fmt.Fprintln(w, "JOB\tTYPE\tPOD\tSTATE\tSTARTED\tOWNER")
+		for _, job := range jobs {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", job.ID, job.Type, job.Pod, job.State, job.Started.Format(time.RFC3339), job.Owner)
+		}
+	})
+}
+
+func getJob(c *cli.Context) error {
+	if err := requireArgs(c, 1); err != nil {
+		return err
+	}
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
+	job, err := client.GetJob(c.Args().First())
+	if err != nil {
+		return err
+	}
+	return showJob(c, job)
+}
+
+func waitJob(c *cli.Context) error {
+	if err := requireArgs(c, 1); err != nil {
+		return err
+	}
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
+	job, err := waitForJob(client, c.Args().First(), c.Duration("interval"))
+	if err != nil {
+		return err
+	}
+	return showJob(c, job)
+}
+
+// waitForJob polls the job every interval until it finishes
+func waitForJob(client *rsclient.Client, id string, interval time.Duration) (common.Job, error) {
+	for {
+		job, err := client.GetJob(id)
+		if err != nil || job.Done() {
+			return job, err
+		}
+		time.Sleep(interval)
+	}
+}
+
+// showJob writes the job, returning an error if it failed
+func showJob(c *cli.Context, job common.Job) error {
+	err := output(c, job, func(w io.Writer) {
+		fmt.Fprintf(w, "Job:\t%s\n", job.ID)
+		fmt.Fprintf(w, "Type:\t%s\n", job.Type)
+		fmt.Fprintf(w, "Pod:\t%s\n", job.Pod)
+		fmt.Fprintf(w, "State:\t%s\n", job.State)
+		fmt.Fprintf(w, "Started:\t%s\n", job.Started.Format(time.RFC3339))
+		if job.Done() {
+			fmt.Fprintf(w, "Finished:\t%s\n", job.Finished.Format(time.RFC3339))
+		}
+		if job.Error != "" {
+			fmt.Fprintf(w, "Error:\t%s\n", job.Error)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if job.State == common.JobFailed {
+		return cli.NewExitError(fmt.Sprintf("job %s failed: %s", job.ID, job.Error), exitError)
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/therealbill/redskull/redskull-controller/rpcclient"
+	"github.com/urfave/cli"
+)
+
+var (
+	Build string
+	app   *cli.App
+)
+
+func main() {
+	app = cli.NewApp()
+	app.Name = "redskull-ctl"
+	app.Usage = "manage a RedSkull constellation from the command line"
+	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:   "s,server",
+			Usage:  "RedSkull controller RPC address",
+			Value:  "localhost:8001",
+			EnvVar: "REDSKULL_SERVER",
+		},
+		cli.DurationFlag{
+			Name:   "t,timeout",
+			Usage:  "connection timeout",
+			Value:  15 * time.Second,
+			EnvVar: "REDSKULL_TIMEOUT",
+		},
+		cli.StringFlag{
+			Name:   "f,format",
+			Usage:  "output format: table, json or yaml",
+			Value:  "table",
+			EnvVar: "REDSKULL_FORMAT",
+		},
+		cli.StringFlag{
+			Name:   "token",
+			Usage:  "RPC token to authenticate with",
+			EnvVar: "REDSKULL_RPCTOKEN",
+		},
+		cli.BoolFlag{
+			Name:   "tls",
+			Usage:  "connect over TLS, trusting the system CAs unless --tls-ca is given",
+			EnvVar: "REDSKULL_RPCTLS",
+		},
+		cli.StringFlag{
+			Name:   "tls-ca",
+			Usage:  "CA file to verify the controller's certificate; implies --tls",
+			EnvVar: "REDSKULL_RPCTLSCA",
+		},
+		cli.StringFlag{
+			Name:   "tls-cert",
+			Usage:  "client certificate to authenticate with; implies --tls",
+			EnvVar: "REDSKULL_RPCTLSCLIENTCERT",
+		},
+		cli.StringFlag{
+			Name:   "tls-key",
+			Usage:  "key file for --tls-cert",
+			EnvVar: "REDSKULL_RPCTLSCLIENTKEY",
+		},
+	}
+	intervalFlag := cli.DurationFlag{
+		Name:  "interval",
+		Usage: "how often to check the job",
+		Value: time.Second,
+	}
+	app.Commands = []cli.Command{
+		{
+			Name:   "pods",
+			Usage:  "list pods, exiting 2 if any have errors",
+			Action: listPods,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "name",
+					Usage: "only pods matching this glob pattern",
+				},
+				cli.StringFlag{
+					Name:  "status",
+					Usage: "only pods with this status: ok, error or maintenance",
+				},
+			},
+		},
+		{
+			Name:      "inspect",
+			Usage:     "show a pod in detail, exiting 2 if it has errors",
+			ArgsUsage: "POD",
+			Action:    inspectPod,
+		},
+		{
+			Name:      "monitor",
+			Usage:     "monitor a pod on the constellation's sentinels",
+			ArgsUsage: "POD",
+			Action:    monitorPod,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "m,master",
+					Usage: "the pod's master as host:port",
+				},
+				cli.IntFlag{
+					Name:  "q,quorum",
+					Usage: "sentinel quorum",
+					Value: 2,
+				},
+				cli.StringFlag{
+					Name:   "a,auth",
+					Usage:  "the pod's auth token",
+					EnvVar: "REDSKULL_POD_AUTH",
+				},
+			},
+		},
+		{
+			Name:      "remove",
+			Usage:     "stop monitoring a pod",
+			ArgsUsage: "POD",
+			Action:    removePod,
+		},
+		{
+			Name:      "failover",
+			Usage:     "fail a pod over to one of its slaves",
+			ArgsUsage: "POD",
+			Action:    failoverPod,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "force",
+					Usage: "fail over even if the pod is in maintenance",
+				},
+			},
+		},
+		{
+			Name:      "reset",
+			Usage:     "reset a pod on its sentinels",
+			ArgsUsage: "POD",
+			Action:    resetPod,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "simultaneous",
+					Usage: "reset every sentinel at once instead of one at a time",
+				},
+				cli.BoolFlag{
+					Name:  "w,wait",
+					Usage: "wait for the reset to finish",
+				},
+				intervalFlag,
+			},
+		},
+		{
+			Name:      "balance",
+			Usage:     "bring a pod to the number of sentinels it needs",
+			ArgsUsage: "POD",
+			Action:    balancePod,
+		},
+		{
+			Name:      "add-slave",
+			Usage:     "make a Redis instance a slave of the pod's master",
+			ArgsUsage: "POD HOST:PORT",
+			Action:    addSlave,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:   "a,auth",
+					Usage:  "the new slave's current auth token",
+					EnvVar: "REDSKULL_SLAVE_AUTH",
+				},
+			},
+		},
+		{
+			Name:      "remove-slave",
+			Usage:     "detach a slave from the pod",
+			ArgsUsage: "POD HOST:PORT",
+			Action:    removeSlave,
+		},
+		{
+			Name:  "sentinels",
+			Usage: "list and add sentinels",
+			Subcommands: []cli.Command{
+				{
+					Name:   "list",
+					Usage:  "list the constellation's sentinels",
+					Action: listSentinels,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "p,pod",
+							Usage: "only sentinels monitoring this pod",
+						},
+					},
+				},
+				{
+					Name:      "add",
+					Usage:     "add a sentinel to the constellation",
+					ArgsUsage: "HOST:PORT",
+					Action:    addSentinel,
+				},
+			},
+		},
+		{
+			Name:  "jobs",
+			Usage: "follow long running operations",
+			Subcommands: []cli.Command{
+				{
+					Name:   "list",
+					Usage:  "list jobs, newest first",
+					Action: listJobs,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "s,state",
+							Usage: "only jobs in this state: running, succeeded or failed",
+						},
+						cli.StringFlag{
+							Name:  "p,pod",
+							Usage: "only jobs for this pod",
+						},
+					},
+				},
+				{
+					Name:      "show",
+					Usage:     "show a job, exiting 1 if it failed",
+					ArgsUsage: "JOB",
+					Action:    getJob,
+				},
+				{
+					Name:      "wait",
+					Usage:     "wait for a job to finish, exiting 1 if it failed",
+					ArgsUsage: "JOB",
+					Action:    waitJob,
+					Flags:     []cli.Flag{intervalFlag},
+				},
+			},
+		},
+		{
+			Name:      "plan",
+			Usage:     "show the changes needed to apply a pod manifest",
+			ArgsUsage: "MANIFEST",
+			Action:    planManifest,
+		},
+		{
+			Name:      "apply",
+			Usage:     "apply a pod manifest to the constellation",
+			ArgsUsage: "MANIFEST",
+			Action:    applyManifest,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "n,dry-run",
+					Usage: "report the steps without executing them",
+				},
+			},
+		},
+		{
+			Name:   "export",
+			Usage:  "write a snapshot of the constellation topology as JSON",
+			Action: exportSnapshot,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "e,encrypt",
+					Usage: "encrypt pod auth tokens with the controller's secret key",
+				},
+				cli.StringFlag{
+					Name:  "o,output",
+					Usage: "file to write the snapshot to (default stdout)",
+				},
+			},
+		},
+		{
+			Name:      "restore",
+			Usage:     "re-monitor the pods recorded in a snapshot",
+			ArgsUsage: "SNAPSHOT",
+			Action:    restoreSnapshot,
+		},
+	}
+	err := app.Run(os.Args)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// getClient connects to the controller named by the global flags
+func getClient(c *cli.Context) (*rsclient.Client, error) {
+	opts := rsclient.Options{Timeout: c.GlobalDuration("timeout"), Token: c.GlobalString("token")}
+	if c.GlobalBool("tls") || c.GlobalString("tls-ca") > "" || c.GlobalString("tls-cert") > "" {
+		tlsConfig, err := rsclient.TLSConfig(c.GlobalString("tls-ca"), c.GlobalString("tls-cert"), c.GlobalString("tls-key"))
+		if err != nil {
+			return nil, err
+		}
+		opts.TLS = tlsConfig
+	}
+	return rsclient.NewClientWithOptions(c.GlobalString("server"), opts)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/urfave/cli"
+)
+
+// loadManifestArg loads the manifest named by the first argument and
+// resolves its secret references here, rather than on the controller
+func loadManifestArg(c *cli.Context) (common.Manifest, error) {
+	if c.NArg() != 1 {
+		return common.Manifest{}, errors.New("a manifest file is required")
+	}
+	manifest, err := common.LoadManifestFile(c.Args().First())
+	if err != nil {
+		return manifest, err
+	}
+	return manifest, manifest.ResolveSecrets()
+}
+
+func planManifest(c *cli.Context) error {
+	manifest, err := loadManifestArg(c)
+	if err != nil {
+		return err
+	}
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
+	plan, err := client.PlanManifest(manifest)
+	if err != nil {
+		return err
+	}
+	if len(plan.Steps) == 0 {
+		fmt.Println("Constellation matches manifest, nothing to do")
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "POD\tACTION\tPARAMETER\tVALUE\tDETAIL")
+	for _, step := range plan.Steps {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", step.Pod, step.Action, step.Parameter, step.Value, step.Detail)
+	}
+	return tw.Flush()
+}
+
+func applyManifest(c *cli.Context) error {
+	manifest, err := loadManifestArg(c)
+	if err != nil {
+		return err
+	}
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
+	report, err := client.ApplyManifest(manifest, c.Bool("dry-run"))
+	if err != nil {
+		return err
+	}
+	if report.DryRun {
+		fmt.Println("Dry run, no changes were made")
+	}
+	failed := 0
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "POD\tACTION\tPARAMETER\tRESULT\tDETAIL")
+	for _, res := range report.Results {
+		result := "skipped"
+		switch {
+		case res.Error != "":
+			result = "failed: " + res.Error
+			failed++
+		case res.Applied:
+			result = "applied"
+		case report.DryRun && res.Step.Action != common.ManifestWarn:
+			result = "pending"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", res.Step.Pod, res.Step.Action, res.Step.Parameter, result, res.Step.Detail)
+	}
+	tw.Flush()
+	if failed > 0 {
+		return fmt.Errorf("%d manifest steps failed", failed)
+	}
+	return nil
+}
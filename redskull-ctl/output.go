@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v2"
+)
+
+// Exit codes, so scripts can tell a failed command from unhealthy pods
+const (
+	exitError     = 1
+	exitUnhealthy = 2
+)
+
+// output writes v in the format chosen by the global --format flag. table is
+// called to write it as a table, with a tabwriter which is flushed after.
+func output(c *cli.Context, v interface{}, table func(w io.Writer)) error {
+	switch format := c.GlobalString("format"); format {
+	case "json":
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	case "yaml":
+		// go through JSON so the keys match the JSON output and the API
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		var generic interface{}
+		if err := yaml.Unmarshal(data, &generic); err != nil {
+			return err
+		}
+		data, err = yaml.Marshal(generic)
+		if err != nil {
+			return err
+		}
+		os.Stdout.Write(data)
+	case "table", "":
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		table(tw)
+		return tw.Flush()
+	default:
+		return cli.NewExitError(fmt.Sprintf("unknown output format '%s', use table, json or yaml", format), exitError)
+	}
+	return nil
+}
+
+// requireArgs returns an error unless exactly n arguments were given
+func requireArgs(c *cli.Context, n int) error {
+	if c.NArg() != n {
+		return cli.NewExitError(fmt.Sprintf("%s requires %s", c.Command.Name, c.Command.ArgsUsage), exitError)
+	}
+	return nil
+}
+
+// message prints a confirmation, unless structured output was asked for
+func message(c *cli.Context, format string, v ...interface{}) {
+	if f := c.GlobalString("format"); f == "table" || f == "" {
+		fmt.Printf(format+"\n", v...)
+	}
+}
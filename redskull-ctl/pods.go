@@ -0,0 +1,279 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/urfave/cli"
+)
+
+// podDetail is what inspect reports about a pod
+type podDetail struct {
+	common.PodSummary
+	Slaves    []string
+	Sentinels []string
+	Problems  []string
+}
+
+// unhealthy returns an exit error naming the pods with errors, or nil if
+// there are none
+func unhealthy(pods []common.PodSummary) error {
+	var bad []string
+	for _, pod := range pods {
+		if pod.Status() == common.PodStatusError {
+			bad = append(bad, pod.Name)
+		}
+	}
+	if len(bad) == 0 {
+		return nil
+	}
+	return cli.NewExitError(fmt.Sprintf("%d unhealthy pods: %s", len(bad), strings.Join(bad, ", ")), exitUnhealthy)
+}
+
+func listPods(c *cli.Context) error {
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
+	all, err := client.ListPods()
+	if err != nil {
+		return err
+	}
+	pattern, status := c.String("name"), c.String("status")
+	pods := []common.PodSummary{}
+	for _, pod := range all {
+		if pattern != "" {
+			if ok, _ := path.Match(pattern, pod.Name); !ok {
+				continue
+			}
+		}
+		if status != "" && pod.Status() != status {
+			continue
+		}
+		pods = append(pods, pod)
+	}
+	err = output(c, pods, func(w io.Writer) {
+		fmt.Fprintln(w, "POD\tSTATUS\tMASTER\tQUORUM\tSLAVES\tSENTINELS")
+		for _, pod := range pods {
+			fmt.Fprintf(w, "%s\t%s\t%s:%d\t%d\t%d\t%d/%d\n", pod.Name, pod.Status(), pod.MasterAddress, pod.MasterPort,
+				pod.Quorum, pod.Slaves, pod.SentinelCount, pod.NeededSentinels)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return unhealthy(pods)
+}
+
+func inspectPod(c *cli.Context) error {
+	if err := requireArgs(c, 1); err != nil {
+		return err
+	}
+	podname := c.Args().First()
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
+	pod, err := client.GetPod(podname)
+	if err != nil {
+		return err
+	}
+	summaries, err := client.ListPods()
+	if err != nil {
+		return err
+	}
+	detail := podDetail{Slaves: []string{}, Problems: []string{}}
+	for _, s := range summaries {
+		if s.Name == pod.Name {
+			detail.PodSummary = s
+		}
+	}
+	if pod.Master != nil {
+		for _, slave := range pod.Master.Slaves {
+			detail.Slaves = append(detail.Slaves, slave.Name)
+		}
+	}
+	_, detail.Sentinels, err = client.GetSentinelsForPod(podname)
+	if err != nil {
+		return err
+	}
+	if pod.MissingSentinels {
+		detail.Problems = append(detail.Problems, fmt.Sprintf("needs %d sentinels, has %d", pod.NeededSentinels, pod.SentinelCount))
+	}
+	if pod.TooManySentinels {
+		detail.Problems = append(detail.Problems, fmt.Sprintf("has %d sentinels, needs %d", pod.SentinelCount, pod.NeededSentinels))
+	}
+	if !pod.ValidAuth {
+		detail.Problems = append(detail.Problems, "auth token is not valid on the master")
+	}
+	if !pod.ValidMasterConnection {
+		detail.Problems = append(detail.Problems, "unable to connect to the master")
+	}
+	if !pod.HasValidSlaves {
+		detail.Problems = append(detail.Problems, "no slave able to take over as master")
+	}
+	err = output(c, detail, func(w io.Writer) {
+		fmt.Fprintf(w, "Pod:\t%s\n", detail.Name)
+		fmt.Fprintf(w, "Status:\t%s\n", detail.Status())
+		fmt.Fprintf(w, "Master:\t%s:%d\n", detail.MasterAddress, detail.MasterPort)
+		fmt.Fprintf(w, "Quorum:\t%d\n", detail.Quorum)
+		fmt.Fprintf(w, "Can Failover:\t%t\n", detail.CanFailover)
+		fmt.Fprintf(w, "Slaves:\t%s\n", strings.Join(detail.Slaves, ", "))
+		fmt.Fprintf(w, "Sentinels:\t%d of %d needed\n", detail.SentinelCount, detail.NeededSentinels)
+		for _, s := range detail.Sentinels {
+			fmt.Fprintf(w, "\t%s\n", s)
+		}
+		for _, p := range detail.Problems {
+			fmt.Fprintf(w, "Problem:\t%s\n", p)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return unhealthy([]common.PodSummary{detail.PodSummary})
+}
+
+// splitAddress splits a host:port argument
+func splitAddress(address string) (string, int, error) {
+	host, portstr, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", 0, cli.NewExitError(fmt.Sprintf("'%s' is not a host:port address", address), exitError)
+	}
+	port, err := strconv.Atoi(portstr)
+	if err != nil {
+		return "", 0, cli.NewExitError(fmt.Sprintf("'%s' is not a valid port", portstr), exitError)
+	}
+	return host, port, nil
+}
+
+func monitorPod(c *cli.Context) error {
+	if err := requireArgs(c, 1); err != nil {
+		return err
+	}
+	if c.String("master") == "" {
+		return cli.NewExitError("monitor requires --master HOST:PORT", exitError)
+	}
+	host, port, err := splitAddress(c.String("master"))
+	if err != nil {
+		return err
+	}
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
+	pod, err := client.AddPod(c.Args().First(), host, port, c.Int("quorum"), c.String("auth"))
+	if err != nil {
+		return err
+	}
+	return output(c, pod, func(w io.Writer) {
+		fmt.Fprintf(w, "Now monitoring pod %s, master %s:%d, quorum %d\n", pod.Name, pod.Info.IP, pod.Info.Port, pod.Info.Quorum)
+	})
+}
+
+func removePod(c *cli.Context) error {
+	if err := requireArgs(c, 1); err != nil {
+		return err
+	}
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
+	if err := client.RemovePod(c.Args().First()); err != nil {
+		return err
+	}
+	message(c, "Pod %s removed", c.Args().First())
+	return nil
+}
+
+func failoverPod(c *cli.Context) error {
+	if err := requireArgs(c, 1); err != nil {
+		return err
+	}
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
+	if err := client.Failover(c.Args().First(), c.Bool("force")); err != nil {
+		return err
+	}
+	message(c, "Failover of pod %s started", c.Args().First())
+	return nil
+}
+
+func resetPod(c *cli.Context) error {
+	if err := requireArgs(c, 1); err != nil {
+		return err
+	}
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
+	job, err := client.ResetPod(c.Args().First(), c.Bool("simultaneous"))
+	if err != nil {
+		return err
+	}
+	if c.Bool("wait") {
+		job, err = waitForJob(client, job.ID, c.Duration("interval"))
+		if err != nil {
+			return err
+		}
+	}
+	return showJob(c, job)
+}
+
+func balancePod(c *cli.Context) error {
+	if err := requireArgs(c, 1); err != nil {
+		return err
+	}
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
+	if err := client.BalancePod(c.Args().First()); err != nil {
+		return err
+	}
+	message(c, "Pod %s balanced", c.Args().First())
+	return nil
+}
+
+func addSlave(c *cli.Context) error {
+	if err := requireArgs(c, 2); err != nil {
+		return err
+	}
+	host, port, err := splitAddress(c.Args().Get(1))
+	if err != nil {
+		return err
+	}
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
+	if _, err := client.AddSlaveToPod(c.Args().First(), host, port, c.String("auth")); err != nil {
+		return err
+	}
+	message(c, "%s is now a slave in pod %s", c.Args().Get(1), c.Args().First())
+	return nil
+}
+
+func removeSlave(c *cli.Context) error {
+	if err := requireArgs(c, 2); err != nil {
+		return err
+	}
+	if _, _, err := splitAddress(c.Args().Get(1)); err != nil {
+		return err
+	}
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
+	if err := client.RemoveSlaveFromPod(c.Args().First(), c.Args().Get(1)); err != nil {
+		return err
+	}
+	message(c, "%s removed from pod %s", c.Args().Get(1), c.Args().First())
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/urfave/cli"
+)
+
+func listSentinels(c *cli.Context) error {
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
+	all, err := client.ListSentinels()
+	if err != nil {
+		return err
+	}
+	sentinels := []common.SentinelSummary{}
+	for _, s := range all {
+		if pod := c.String("pod"); pod != "" && !contains(s.Pods, pod) {
+			continue
+		}
+		sentinels = append(sentinels, s)
+	}
+	return output(c, sentinels, func(w io.Writer) {
+		fmt.Fprintln(w, "SENTINEL\tERRORS\tPODS\tLOCAL")
+		for _, s := range sentinels {
+			local := ""
+			if s.Local {
+				local = "yes"
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", s.Name, s.Errors, strings.Join(s.Pods, ","), local)
+		}
+	})
+}
+
+func addSentinel(c *cli.Context) error {
+	if err := requireArgs(c, 1); err != nil {
+		return err
+	}
+	if _, _, err := splitAddress(c.Args().First()); err != nil {
+		return err
+	}
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
+	if _, err := client.AddSentinel(c.Args().First()); err != nil {
+		return err
+	}
+	message(c, "Sentinel %s added", c.Args().First())
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"text/tabwriter"
+
+	"github.com/therealbill/redskull/redskull-controller/common"
+	"github.com/urfave/cli"
+)
+
+func exportSnapshot(c *cli.Context) error {
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
+	snap, err := client.ExportConstellation(c.Bool("encrypt"))
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if out := c.String("output"); out != "" {
+		return ioutil.WriteFile(out, data, 0600)
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+func restoreSnapshot(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return errors.New("a snapshot file is required")
+	}
+	data, err := ioutil.ReadFile(c.Args().First())
+	if err != nil {
+		return err
+	}
+	var snap common.ConstellationSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("unable to parse snapshot: %s", err)
+	}
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
+	report, err := client.RestoreConstellation(snap)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "POD\tMASTER\tRESULT\tDETAIL")
+	for _, res := range report.Results {
+		result := "restored"
+		switch {
+		case res.Error != "":
+			result = "failed: " + res.Error
+			failed++
+		case res.Skipped:
+			result = "skipped"
+		case !res.Restored:
+			result = "not restored"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", res.Pod, res.Master, result, res.Message)
+	}
+	tw.Flush()
+	if failed > 0 {
+		return fmt.Errorf("%d pods failed to restore", failed)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/zenazn/goji/web"
+)
+
+// auditLog records access to sensitive data. It writes to stderr unless
+// SetAuditFile is called.
+var auditLog = log.New(os.Stderr, "AUDIT ", log.LstdFlags)
+
+// SetAuditFile appends audit records to the given file instead of stderr
+func SetAuditFile(path string) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	auditLog = log.New(file, "AUDIT ", log.LstdFlags)
+	return nil
+}
+
+// Audit records who performed an action against which target
+func Audit(c web.C, r *http.Request, action, target string) {
+	id, _ := FromContext(c)
+	auditLog.Printf("user=%q role=%s via=%s remote=%s action=%s target=%q", id.Name, id.Role, id.Method, r.RemoteAddr, action, target)
+}
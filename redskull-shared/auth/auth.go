@@ -0,0 +1,165 @@
+// Package auth provides authentication and role based access control for
+// the RedSkull HTTP interface and RPC ports.
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/therealbill/redskull/redskull-shared/logging"
+	"github.com/zenazn/goji/web"
+)
+
+// Role is an access level. Each role includes the ones below it.
+type Role int
+
+const (
+	Viewer Role = iota + 1
+	Operator
+	Admin
+)
+
+// identityKey is the web.C Env key the authenticated identity is stored under
+const identityKey = "auth.identity"
+
+// ErrBadCredentials is returned by an Authenticator when credentials were
+// presented but are not valid
+var ErrBadCredentials = errors.New("Invalid credentials")
+
+func (r Role) String() string {
+	switch r {
+	case Viewer:
+		return "viewer"
+	case Operator:
+		return "operator"
+	case Admin:
+		return "admin"
+	}
+	return "none"
+}
+
+// ParseRole converts a role name to a Role
+func ParseRole(name string) (Role, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "viewer":
+		return Viewer, nil
+	case "operator":
+		return Operator, nil
+	case "admin":
+		return Admin, nil
+	}
+	return 0, errors.New("Unknown role '" + name + "'")
+}
+
+// ParseRoles converts a map of names to role names, as given in the
+// configuration, to a map of names to Roles
+func ParseRoles(names map[string]string) (map[string]Role, error) {
+	roles := make(map[string]Role)
+	for name, roleName := range names {
+		role, err := ParseRole(roleName)
+		if err != nil {
+			return nil, err
+		}
+		roles[name] = role
+	}
+	return roles, nil
+}
+
+// Identity is an authenticated user and the role granted to it
+type Identity struct {
+	Name   string
+	Role   Role
+	Method string
+}
+
+// Authenticator inspects a request for credentials. It returns ok false if
+// the request carries none of the kind it handles, and ErrBadCredentials if
+// it carries invalid ones.
+type Authenticator interface {
+	Authenticate(r *http.Request) (id Identity, ok bool, err error)
+}
+
+// Authenticators are tried in the order they were configured. When none are
+// configured authentication is disabled and every request is treated as
+// admin, as RedSkull has always behaved.
+var Authenticators []Authenticator
+
+// Challenge is sent in the WWW-Authenticate header of 401 responses
+var Challenge = `Bearer realm="RedSkull"`
+
+// Enabled returns true if any authenticator is configured
+func Enabled() bool {
+	return len(Authenticators) > 0
+}
+
+// Middleware authenticates every request and stores the identity in the
+// goji context. Requests without valid credentials are rejected, except for
+// static assets.
+func Middleware(c *web.C, h http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if !Enabled() {
+			setIdentity(c, Identity{Name: "anonymous", Role: Admin, Method: "none"})
+			h.ServeHTTP(w, r)
+			return
+		}
+		for _, a := range Authenticators {
+			id, ok, err := a.Authenticate(r)
+			if err != nil {
+				logging.Warnf("Authentication failed for %s %s from %s: %s", r.Method, r.URL.Path, r.RemoteAddr, err)
+				unauthorized(w)
+				return
+			}
+			if ok {
+				setIdentity(c, id)
+				h.ServeHTTP(w, r)
+				return
+			}
+		}
+		if strings.HasPrefix(r.URL.Path, "/static/") {
+			h.ServeHTTP(w, r)
+			return
+		}
+		unauthorized(w)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// Require wraps a handler so it is only called for identities holding at
+// least the given role
+func Require(role Role, h web.HandlerFunc) web.HandlerFunc {
+	return func(c web.C, w http.ResponseWriter, r *http.Request) {
+		id, ok := FromContext(c)
+		if !ok {
+			unauthorized(w)
+			return
+		}
+		if id.Role < role {
+			logging.Warnf("User '%s' (%s) denied %s %s, requires %s", id.Name, id.Role, r.Method, r.URL.Path, role)
+			http.Error(w, "Forbidden: requires the "+role.String()+" role", http.StatusForbidden)
+			return
+		}
+		h(c, w, r)
+	}
+}
+
+// FromContext returns the identity the request was authenticated as
+func FromContext(c web.C) (Identity, bool) {
+	if c.Env == nil {
+		return Identity{}, false
+	}
+	id, ok := c.Env[identityKey].(Identity)
+	return id, ok
+}
+
+func setIdentity(c *web.C, id Identity) {
+	if c.Env == nil {
+		c.Env = make(map[interface{}]interface{})
+	}
+	c.Env[identityKey] = id
+}
+
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", Challenge)
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/therealbill/redskull/redskull-shared/logging"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// BasicAuthenticator checks HTTP basic auth credentials against an htpasswd
+// file. Only bcrypt ("htpasswd -B") and {SHA} hashes are supported. Roles
+// are looked up in Roles, falling back to DefaultRole.
+type BasicAuthenticator struct {
+	hashes      map[string]string
+	Roles       map[string]Role
+	DefaultRole Role
+}
+
+// NewBasicAuthenticator loads the given htpasswd file
+func NewBasicAuthenticator(path string, roles map[string]Role, defaultRole Role) (*BasicAuthenticator, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	ba := &BasicAuthenticator{hashes: make(map[string]string), Roles: roles, DefaultRole: defaultRole}
+	scanner := bufio.NewScanner(file)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected USER:HASH", path, lineno)
+		}
+		hash := parts[1]
+		if !strings.HasPrefix(hash, "$2") && !strings.HasPrefix(hash, "{SHA}") {
+			logging.Warnf("Skipping htpasswd user '%s': only bcrypt and {SHA} hashes are supported", parts[0])
+			continue
+		}
+		ba.hashes[parts[0]] = hash
+	}
+	return ba, scanner.Err()
+}
+
+// Authenticate implements Authenticator
+func (ba *BasicAuthenticator) Authenticate(r *http.Request) (Identity, bool, error) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		return Identity{}, false, nil
+	}
+	hash, known := ba.hashes[user]
+	if !known || !checkHash(hash, pass) {
+		return Identity{}, false, ErrBadCredentials
+	}
+	role, ok := ba.Roles[user]
+	if !ok {
+		role = ba.DefaultRole
+	}
+	return Identity{Name: user, Role: role, Method: "basic"}, true, nil
+}
+
+func checkHash(hash, pass string) bool {
+	if strings.HasPrefix(hash, "{SHA}") {
+		sum := sha1.Sum([]byte(pass))
+		expected := "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+		return subtle.ConstantTimeCompare([]byte(hash), []byte(expected)) == 1
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass)) == nil
+}
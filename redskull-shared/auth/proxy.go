@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ProxyAuthenticator trusts a user name set in a header by a reverse proxy
+// which has already authenticated the user. The header is only honoured on
+// requests coming from one of the trusted networks. If RoleHeader is set the
+// proxy may also assert the role; otherwise roles come from Roles, falling
+// back to DefaultRole.
+type ProxyAuthenticator struct {
+	UserHeader  string
+	RoleHeader  string
+	Trusted     []*net.IPNet
+	Roles       map[string]Role
+	DefaultRole Role
+}
+
+// NewProxyAuthenticator builds a ProxyAuthenticator trusting the given
+// CIDRs. Bare addresses are treated as single hosts.
+func NewProxyAuthenticator(userHeader, roleHeader string, trusted []string, roles map[string]Role, defaultRole Role) (*ProxyAuthenticator, error) {
+	if len(trusted) == 0 {
+		return nil, fmt.Errorf("A proxy user header requires at least one trusted proxy address")
+	}
+	pa := &ProxyAuthenticator{UserHeader: userHeader, RoleHeader: roleHeader, Roles: roles, DefaultRole: defaultRole}
+	for _, cidr := range trusted {
+		cidr = strings.TrimSpace(cidr)
+		if !strings.Contains(cidr, "/") {
+			if strings.Contains(cidr, ":") {
+				cidr += "/128"
+			} else {
+				cidr += "/32"
+			}
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		pa.Trusted = append(pa.Trusted, network)
+	}
+	return pa, nil
+}
+
+// Authenticate implements Authenticator
+func (pa *ProxyAuthenticator) Authenticate(r *http.Request) (Identity, bool, error) {
+	user := r.Header.Get(pa.UserHeader)
+	if user == "" || !pa.trusts(r.RemoteAddr) {
+		return Identity{}, false, nil
+	}
+	role, ok := pa.Roles[user]
+	if !ok {
+		role = pa.DefaultRole
+	}
+	if pa.RoleHeader != "" {
+		if asserted := r.Header.Get(pa.RoleHeader); asserted != "" {
+			parsed, err := ParseRole(asserted)
+			if err != nil {
+				return Identity{}, false, err
+			}
+			role = parsed
+		}
+	}
+	return Identity{Name: user, Role: role, Method: "proxy"}, true, nil
+}
+
+func (pa *ProxyAuthenticator) trusts(remote string) bool {
+	host, _, err := net.SplitHostPort(remote)
+	if err != nil {
+		host = remote
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range pa.Trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
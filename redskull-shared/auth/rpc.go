@@ -0,0 +1,346 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/rpc"
+	"sync"
+	"time"
+
+	"github.com/therealbill/redskull/redskull-shared/logging"
+)
+
+// RPCLoginMethod is answered by the RPC server itself rather than a
+// registered service. Its argument is a token from the token file; on
+// success the rest of the connection runs as that token's identity.
+const RPCLoginMethod = "Auth.Login"
+
+// rpcHandshakeTimeout bounds how long a client may take to complete the TLS
+// handshake
+const rpcHandshakeTimeout = 10 * time.Second
+
+// ContextArg is implemented by RPC arguments which take the context of the
+// call. The context is cancelled once the connection the call arrived on is
+// closed, or for JSON-RPC, once the HTTP request ends.
+type ContextArg interface {
+	SetContext(ctx context.Context)
+}
+
+// RPCPolicy maps "Service.Method" to the role needed to call it. Methods
+// which are not listed require Admin.
+type RPCPolicy map[string]Role
+
+// Required returns the role needed to call the method
+func (p RPCPolicy) Required(method string) Role {
+	if role, ok := p[method]; ok {
+		return role
+	}
+	return Admin
+}
+
+// RPCServer serves net/rpc connections, optionally over TLS, and checks
+// every call against Policy. Callers authenticate with a verified client
+// certificate, whose common name is looked up in CertRoles, or by calling
+// RPCLoginMethod with a token. When neither Tokens nor client certificates
+// are configured every caller is treated as admin, as the RPC port has
+// always behaved.
+type RPCServer struct {
+	Server          *rpc.Server
+	TLS             *tls.Config
+	Tokens          *TokenAuthenticator
+	CertRoles       map[string]Role
+	CertDefaultRole Role
+	Policy          RPCPolicy
+}
+
+// Enabled returns true if callers must authenticate
+func (s *RPCServer) Enabled() bool {
+	return s.Tokens != nil || (s.TLS != nil && s.TLS.ClientCAs != nil)
+}
+
+// ListenAndServe listens on the address and serves connections until the
+// listener fails
+func (s *RPCServer) ListenAndServe(address string) error {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	if s.TLS != nil {
+		l = tls.NewListener(l, s.TLS)
+	} else {
+		logging.Warnf("RPC on %s is not using TLS, credentials and pod data cross the network in the clear", address)
+	}
+	if !s.Enabled() {
+		logging.Warnf("No RPC authentication configured, the RPC port on %s is open to anyone who can reach it", address)
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on the listener and serves each in its own
+// goroutine
+func (s *RPCServer) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+// ServeConn authenticates the connection's client certificate, if any, and
+// serves calls on it until the client hangs up
+func (s *RPCServer) ServeConn(conn net.Conn) {
+	id := Identity{Name: "anonymous", Role: Admin, Method: "none"}
+	if s.Enabled() {
+		id = Identity{Name: "anonymous", Method: "none"}
+	}
+	if tc, ok := conn.(*tls.Conn); ok {
+		tc.SetDeadline(time.Now().Add(rpcHandshakeTimeout))
+		if err := tc.Handshake(); err != nil {
+			logging.Warnf("RPC TLS handshake with %s failed: %s", conn.RemoteAddr(), err)
+			conn.Close()
+			return
+		}
+		tc.SetDeadline(time.Time{})
+		if certID, ok := s.certIdentity(tc.ConnectionState()); ok {
+			id = certID
+		}
+	}
+	server := s.Server
+	if server == nil {
+		server = rpc.DefaultServer
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	buf := bufio.NewWriter(conn)
+	codec := &rpcCodec{
+		server: s,
+		conn:   conn,
+		dec:    gob.NewDecoder(conn),
+		enc:    gob.NewEncoder(buf),
+		encBuf: buf,
+		id:     id,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	server.ServeCodec(codec)
+}
+
+// certIdentity returns the identity of a verified client certificate
+func (s *RPCServer) certIdentity(state tls.ConnectionState) (Identity, bool) {
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return Identity{}, false
+	}
+	name := state.VerifiedChains[0][0].Subject.CommonName
+	role, ok := s.CertRoles[name]
+	if !ok {
+		role = s.CertDefaultRole
+	}
+	if role == 0 {
+		logging.Warnf("RPC client certificate '%s' has no role", name)
+		return Identity{}, false
+	}
+	return Identity{Name: name, Role: role, Method: "certificate"}, true
+}
+
+// RPCDenial is returned by Authorize when a call is refused. Code is
+// "unauthorized" if the caller has not authenticated and "forbidden" if its
+// role is too low.
+type RPCDenial struct {
+	Code    string
+	Message string
+}
+
+func (d *RPCDenial) Error() string {
+	return d.Code + ": " + d.Message
+}
+
+// Authorize returns an *RPCDenial if the identity may not call the method.
+// Permitted admin calls are written to the audit log.
+func (s *RPCServer) Authorize(id Identity, method, remote string) error {
+	required := s.Policy.Required(method)
+	if id.Role >= required {
+		if required == Admin && s.Enabled() {
+			auditLog.Printf("user=%q role=%s via=%s remote=%s action=rpc:%s", id.Name, id.Role, id.Method, remote, method)
+		}
+		return nil
+	}
+	if id.Role == 0 {
+		return &RPCDenial{Code: "unauthorized", Message: method + " requires authentication"}
+	}
+	logging.Warnf("RPC user '%s' (%s) from %s denied %s, requires %s", id.Name, id.Role, remote, method, required)
+	return &RPCDenial{Code: "forbidden", Message: fmt.Sprintf("%s requires the %s role", method, required)}
+}
+
+// IdentifyHTTP returns the identity of a request made over HTTP to a
+// transport sharing this server's settings, such as JSON-RPC. A token in the
+// Authorization bearer or X-Redskull-Token header takes precedence over a
+// client certificate. Invalid tokens return ErrBadCredentials.
+func (s *RPCServer) IdentifyHTTP(r *http.Request) (Identity, error) {
+	if !s.Enabled() {
+		return Identity{Name: "anonymous", Role: Admin, Method: "none"}, nil
+	}
+	if s.Tokens != nil {
+		id, ok, err := s.Tokens.Authenticate(r)
+		if err != nil {
+			return Identity{}, err
+		}
+		if ok {
+			return id, nil
+		}
+	}
+	if r.TLS != nil {
+		if id, ok := s.certIdentity(*r.TLS); ok {
+			return id, nil
+		}
+	}
+	return Identity{Name: "anonymous", Method: "none"}, nil
+}
+
+// rpcCodec is the gob codec net/rpc uses, with authentication and
+// authorization checked as each request header is read. Denied calls are
+// answered here and never reach the service.
+type rpcCodec struct {
+	server *RPCServer
+	conn   net.Conn
+	dec    *gob.Decoder
+	enc    *gob.Encoder
+	encBuf *bufio.Writer
+	mu     sync.Mutex // guards writes, which net/rpc makes from many goroutines
+	id     Identity
+	ctx    context.Context // the calls' context, cancelled once reading fails
+	cancel context.CancelFunc
+}
+
+func (c *rpcCodec) ReadRequestHeader(r *rpc.Request) error {
+	for {
+		if err := c.dec.Decode(r); err != nil {
+			// the client has hung up, or the connection is unusable;
+			// net/rpc waits for the calls in flight before returning
+			c.cancel()
+			return err
+		}
+		if r.ServiceMethod == RPCLoginMethod {
+			if err := c.login(r); err != nil {
+				return err
+			}
+			continue
+		}
+		err := c.server.Authorize(c.id, r.ServiceMethod, c.conn.RemoteAddr().String())
+		if err == nil {
+			return nil
+		}
+		if err := c.ReadRequestBody(nil); err != nil {
+			return err
+		}
+		if err := c.WriteResponse(&rpc.Response{ServiceMethod: r.ServiceMethod, Seq: r.Seq, Error: err.Error()}, struct{}{}); err != nil {
+			return err
+		}
+	}
+}
+
+// login answers an RPCLoginMethod request
+func (c *rpcCodec) login(r *rpc.Request) error {
+	var token string
+	if err := c.dec.Decode(&token); err != nil {
+		return err
+	}
+	resp := &rpc.Response{ServiceMethod: r.ServiceMethod, Seq: r.Seq}
+	var reply string
+	id, ok := c.server.authenticate(token)
+	if !c.server.Enabled() {
+		id, ok = c.id, true
+	}
+	if ok {
+		c.id = id
+		reply = fmt.Sprintf("%s (%s)", id.Name, id.Role)
+	} else {
+		logging.Warnf("RPC authentication failed from %s", c.conn.RemoteAddr())
+		resp.Error = (&RPCDenial{Code: "unauthorized", Message: ErrBadCredentials.Error()}).Error()
+	}
+	return c.WriteResponse(resp, reply)
+}
+
+func (c *rpcCodec) ReadRequestBody(body interface{}) error {
+	if err := c.dec.Decode(body); err != nil {
+		return err
+	}
+	if arg, ok := body.(ContextArg); ok {
+		arg.SetContext(c.ctx)
+	}
+	return nil
+}
+
+func (c *rpcCodec) WriteResponse(r *rpc.Response, body interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.enc.Encode(r); err != nil {
+		c.conn.Close()
+		return err
+	}
+	if err := c.enc.Encode(body); err != nil {
+		c.conn.Close()
+		return err
+	}
+	return c.encBuf.Flush()
+}
+
+func (c *rpcCodec) Close() error {
+	return c.conn.Close()
+}
+
+// authenticate looks up a login token
+func (s *RPCServer) authenticate(token string) (Identity, bool) {
+	if s.Tokens == nil || token == "" {
+		return Identity{}, false
+	}
+	return s.Tokens.Lookup(token)
+}
+
+// ServerTLSConfig loads the certificate and key the RPC server presents.
+// If clientCAFile is set client certificates signed by it are verified, and
+// required if requireClientCert is set.
+func ServerTLSConfig(certFile, keyFile, clientCAFile string, requireClientCert bool) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if clientCAFile == "" {
+		if requireClientCert {
+			return nil, errors.New("Requiring client certificates needs a client CA file")
+		}
+		return config, nil
+	}
+	pool, err := loadCertPool(clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	config.ClientCAs = pool
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+	if requireClientCert {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("No certificates found in '%s'", path)
+	}
+	return pool, nil
+}
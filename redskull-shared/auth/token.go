@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// TokenAuthenticator accepts static API tokens passed as a bearer token in
+// the Authorization header or in the X-Redskull-Token header.
+type TokenAuthenticator struct {
+	tokens map[string]Identity
+}
+
+// NewTokenAuthenticator loads tokens from a file with one token per line in
+// the form "TOKEN ROLE NAME". Blank lines and lines starting with # are
+// ignored.
+func NewTokenAuthenticator(path string) (*TokenAuthenticator, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	ta := &TokenAuthenticator{tokens: make(map[string]Identity)}
+	scanner := bufio.NewScanner(file)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("%s:%d: expected TOKEN ROLE NAME", path, lineno)
+		}
+		role, err := ParseRole(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, lineno, err)
+		}
+		ta.tokens[fields[0]] = Identity{Name: fields[2], Role: role, Method: "token"}
+	}
+	return ta, scanner.Err()
+}
+
+// Authenticate implements Authenticator
+func (ta *TokenAuthenticator) Authenticate(r *http.Request) (Identity, bool, error) {
+	token := r.Header.Get("X-Redskull-Token")
+	if header := r.Header.Get("Authorization"); token == "" && strings.HasPrefix(header, "Bearer ") {
+		token = strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	}
+	if token == "" {
+		return Identity{}, false, nil
+	}
+	if id, ok := ta.Lookup(token); ok {
+		return id, true, nil
+	}
+	return Identity{}, false, ErrBadCredentials
+}
+
+// Lookup returns the identity the token belongs to
+func (ta *TokenAuthenticator) Lookup(token string) (Identity, bool) {
+	for known, id := range ta.tokens {
+		if subtle.ConstantTimeCompare([]byte(known), []byte(token)) == 1 {
+			return id, true
+		}
+	}
+	return Identity{}, false
+}
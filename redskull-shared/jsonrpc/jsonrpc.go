@@ -0,0 +1,296 @@
+// Package jsonrpc serves the methods of a net/rpc server as JSON-RPC 2.0
+// over HTTP, so the controller and agent RPC services can be called from
+// languages without gob. Each call is run through the same rpc.Server, with
+// the same authentication and per-method policy, as the gob RPC port.
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/rpc"
+	"strings"
+
+	"github.com/therealbill/redskull/redskull-shared/auth"
+	"github.com/therealbill/redskull/redskull-shared/logging"
+)
+
+// errBadParamCount is returned for params arrays which do not hold exactly
+// one element; every RPC method takes a single argument
+var errBadParamCount = errors.New("params must be the argument or an array holding only the argument")
+
+// Path is where calls are POSTed
+const Path = "/rpc"
+
+// Version is the JSON-RPC version spoken
+const Version = "2.0"
+
+// maxBodySize bounds the size of a request or batch
+const maxBodySize = 1 << 20
+
+// Error codes. The -32000 range is used for errors reported by the service;
+// the error's data then holds the service's error code, if there is one.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+	CodeServerError    = -32000
+	CodeUnauthorized   = -32001
+	CodeForbidden      = -32003
+)
+
+// Error codes given in ErrorData for errors this package reports itself.
+// They are the values of the controller's matching common.ErrCode
+// constants.
+const (
+	errCodeInvalidRequest = "invalid_request"
+	errCodeInternal       = "internal_error"
+	errCodeUnauthorized   = "unauthorized"
+)
+
+// Failure is implemented by results which report an error in the result
+// itself rather than failing the call, as the controller's typed RPC
+// service does. Such results are answered with a JSON-RPC error.
+type Failure interface {
+	// Failed returns the reported error's code and message, or false if
+	// the call succeeded
+	Failed() (code, message string, failed bool)
+}
+
+// Request is a JSON-RPC 2.0 request. Params is the method's argument,
+// either as is or as the only element of an array. A request without an ID
+// is a notification and gets no response.
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+// Response is a JSON-RPC 2.0 response. Exactly one of Result and Error is
+// set.
+type Response struct {
+	JSONRPC string           `json:"jsonrpc"`
+	Result  *json.RawMessage `json:"result,omitempty"`
+	Error   *Error           `json:"error,omitempty"`
+	ID      json.RawMessage  `json:"id"`
+}
+
+// Error is a JSON-RPC 2.0 error object
+type Error struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// ErrorData is the data of errors which carry an error code
+type ErrorData struct {
+	Code string
+}
+
+// Handler answers JSON-RPC calls to the services registered on RPC.Server
+type Handler struct {
+	RPC *auth.RPCServer
+}
+
+// ListenAndServe serves JSON-RPC on the address, over TLS if the RPC server
+// is configured with it
+func ListenAndServe(address string, server *auth.RPCServer) error {
+	mux := http.NewServeMux()
+	mux.Handle(Path, &Handler{RPC: server})
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	if server.TLS != nil {
+		l = tls.NewListener(l, server.TLS)
+	} else {
+		logging.Warnf("JSON-RPC on %s is not using TLS, credentials and pod data cross the network in the clear", address)
+	}
+	logging.Infof("Serving JSON-RPC on %s%s", address, Path)
+	return http.Serve(l, mux)
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "JSON-RPC calls must be POSTed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	id, err := h.RPC.IdentifyHTTP(r)
+	if err != nil {
+		logging.Warnf("JSON-RPC authentication failed from %s", r.RemoteAddr)
+		writeJSON(w, http.StatusUnauthorized, errorResponse(nil, CodeUnauthorized, err.Error(), errCodeUnauthorized))
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		writeJSON(w, http.StatusRequestEntityTooLarge, errorResponse(nil, CodeInvalidRequest, "Unable to read request: "+err.Error(), ""))
+		return
+	}
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(body, &batch); err != nil {
+			writeJSON(w, http.StatusOK, errorResponse(nil, CodeParseError, "Parse error: "+err.Error(), ""))
+			return
+		}
+		if len(batch) == 0 {
+			writeJSON(w, http.StatusOK, errorResponse(nil, CodeInvalidRequest, "Empty batch", ""))
+			return
+		}
+		responses := []*Response{}
+		for _, raw := range batch {
+			if resp := h.handle(r.Context(), id, r.RemoteAddr, raw); resp != nil {
+				responses = append(responses, resp)
+			}
+		}
+		if len(responses) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJSON(w, http.StatusOK, responses)
+		return
+	}
+	resp := h.handle(r.Context(), id, r.RemoteAddr, body)
+	if resp == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handle runs one request, returning nil for notifications
+func (h *Handler) handle(ctx context.Context, id auth.Identity, remote string, raw json.RawMessage) *Response {
+	var req Request
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return errorResponse(nil, CodeParseError, "Parse error: "+err.Error(), "")
+	}
+	if req.JSONRPC != Version || req.Method == "" {
+		return errorResponse(req.ID, CodeInvalidRequest, "Requests must have jsonrpc \"2.0\" and a method", "")
+	}
+	resp := h.call(ctx, id, remote, req)
+	if len(req.ID) == 0 {
+		return nil
+	}
+	return resp
+}
+
+// call authorizes the request and runs it through the rpc.Server. Arguments
+// implementing auth.ContextArg are given the HTTP request's context.
+func (h *Handler) call(ctx context.Context, id auth.Identity, remote string, req Request) *Response {
+	if err := h.RPC.Authorize(id, req.Method, remote); err != nil {
+		denial := err.(*auth.RPCDenial)
+		code := CodeForbidden
+		if denial.Code == errCodeUnauthorized {
+			code = CodeUnauthorized
+		}
+		return errorResponse(req.ID, code, denial.Message, denial.Code)
+	}
+	server := h.RPC.Server
+	if server == nil {
+		server = rpc.DefaultServer
+	}
+	codec := &requestCodec{ctx: ctx, req: req}
+	server.ServeRequest(codec)
+	if codec.resp == nil {
+		return errorResponse(req.ID, CodeInternalError, "No response from "+req.Method, errCodeInternal)
+	}
+	if msg := codec.resp.Error; msg > "" {
+		switch {
+		case codec.paramsErr != nil:
+			return errorResponse(req.ID, CodeInvalidParams, "Invalid params: "+codec.paramsErr.Error(), errCodeInvalidRequest)
+		case strings.HasPrefix(msg, "rpc: can't find"), strings.HasPrefix(msg, "rpc: service/method request ill-formed"):
+			return errorResponse(req.ID, CodeMethodNotFound, "Method not found: "+req.Method, "")
+		}
+		return errorResponse(req.ID, CodeServerError, msg, "")
+	}
+	if f, ok := codec.result.(Failure); ok {
+		if code, message, failed := f.Failed(); failed {
+			return errorResponse(req.ID, CodeServerError, message, code)
+		}
+	}
+	packed, err := json.Marshal(codec.result)
+	if err != nil {
+		return errorResponse(req.ID, CodeInternalError, "Unable to encode result: "+err.Error(), errCodeInternal)
+	}
+	result := json.RawMessage(packed)
+	return &Response{JSONRPC: Version, Result: &result, ID: req.ID}
+}
+
+// requestCodec feeds a single request to rpc.Server.ServeRequest and keeps
+// the response
+type requestCodec struct {
+	ctx       context.Context
+	req       Request
+	paramsErr error
+	resp      *rpc.Response
+	result    interface{}
+}
+
+func (c *requestCodec) ReadRequestHeader(r *rpc.Request) error {
+	r.ServiceMethod = c.req.Method
+	r.Seq = 0
+	return nil
+}
+
+func (c *requestCodec) ReadRequestBody(body interface{}) error {
+	if arg, ok := body.(auth.ContextArg); ok {
+		arg.SetContext(c.ctx)
+	}
+	params := c.req.Params
+	if body == nil || len(params) == 0 || string(params) == "null" {
+		return nil
+	}
+	if params[0] == '[' {
+		var list []json.RawMessage
+		if err := json.Unmarshal(params, &list); err != nil {
+			c.paramsErr = err
+			return err
+		}
+		if len(list) != 1 {
+			c.paramsErr = errBadParamCount
+			return c.paramsErr
+		}
+		params = list[0]
+	}
+	c.paramsErr = json.Unmarshal(params, body)
+	return c.paramsErr
+}
+
+func (c *requestCodec) WriteResponse(r *rpc.Response, body interface{}) error {
+	c.resp = r
+	c.result = body
+	return nil
+}
+
+func (c *requestCodec) Close() error {
+	return nil
+}
+
+func errorResponse(id json.RawMessage, code int, message, errCode string) *Response {
+	e := &Error{Code: code, Message: message}
+	if errCode > "" {
+		e.Data = ErrorData{Code: errCode}
+	}
+	return &Response{JSONRPC: Version, Error: e, ID: id}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	packed, err := json.Marshal(v)
+	if err != nil {
+		logging.Errorf("Unable to pack JSON, err:%s", err)
+		status = http.StatusInternalServerError
+		packed = []byte(`{"jsonrpc":"2.0","error":{"code":-32603,"message":"Unable to encode response"},"id":null}`)
+	}
+	w.WriteHeader(status)
+	w.Write(packed)
+}
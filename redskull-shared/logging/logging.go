@@ -0,0 +1,278 @@
+// Package logging is RedSkull's leveled, structured logger. Every message
+// carries a level and a set of fields, such as the pod or sentinel it is
+// about, and is written either as text or as one JSON object per line.
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a message
+type Level int
+
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+	FatalLevel
+)
+
+var levelNames = []string{"debug", "info", "warn", "error", "fatal"}
+
+// String returns the level's name
+func (l Level) String() string {
+	if l < DebugLevel || l > FatalLevel {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel returns the level with the given name
+func ParseLevel(name string) (Level, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "warning" {
+		name = "warn"
+	}
+	for i, n := range levelNames {
+		if n == name {
+			return Level(i), nil
+		}
+	}
+	return InfoLevel, fmt.Errorf("Unknown log level '%s', use one of %s", name, strings.Join(levelNames, ", "))
+}
+
+// Standard field names, so the same thing is called the same everywhere
+const (
+	FieldPod       = "pod"
+	FieldSentinel  = "sentinel"
+	FieldNode      = "node"
+	FieldOperation = "op"
+	FieldJob       = "job"
+	FieldError     = "error"
+)
+
+// Fields are the key/value pairs attached to a message
+type Fields map[string]interface{}
+
+var (
+	mu     sync.RWMutex
+	level  = InfoLevel
+	asJSON bool
+	out    io.Writer = os.Stderr
+)
+
+// SetLevel sets the lowest level that is written
+func SetLevel(l Level) {
+	mu.Lock()
+	level = l
+	mu.Unlock()
+}
+
+// GetLevel returns the lowest level that is written
+func GetLevel() Level {
+	mu.RLock()
+	defer mu.RUnlock()
+	return level
+}
+
+// SetFormat selects "text" or "json" output
+func SetFormat(format string) error {
+	switch strings.ToLower(format) {
+	case "", "text":
+		mu.Lock()
+		asJSON = false
+		mu.Unlock()
+	case "json":
+		mu.Lock()
+		asJSON = true
+		mu.Unlock()
+	default:
+		return fmt.Errorf("Unknown log format '%s', use text or json", format)
+	}
+	return nil
+}
+
+// SetOutput sets where messages are written
+func SetOutput(w io.Writer) {
+	mu.Lock()
+	out = w
+	mu.Unlock()
+}
+
+// CaptureStandardLog sends anything written through the standard log
+// package, such as by libraries, through this logger at info level
+func CaptureStandardLog() {
+	log.SetFlags(0)
+	log.SetPrefix("")
+	log.SetOutput(stdWriter{})
+}
+
+type stdWriter struct{}
+
+func (stdWriter) Write(p []byte) (int, error) {
+	std.output(InfoLevel, strings.TrimRight(string(p), "\n"))
+	return len(p), nil
+}
+
+// Logger writes messages with a fixed set of fields
+type Logger struct {
+	fields Fields
+}
+
+var std = &Logger{}
+
+// With returns a logger adding the given fields to every message
+func With(fields Fields) *Logger {
+	return std.With(fields)
+}
+
+// With returns a copy of the logger with the given fields added
+func (l *Logger) With(fields Fields) *Logger {
+	merged := make(Fields, len(l.fields)+len(fields))
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return &Logger{fields: merged}
+}
+
+// Pod returns a logger for messages about the named pod
+func Pod(name string) *Logger { return std.Pod(name) }
+
+// Sentinel returns a logger for messages about the sentinel at address
+func Sentinel(address string) *Logger { return std.Sentinel(address) }
+
+// Node returns a logger for messages about the node at address
+func Node(address string) *Logger { return std.Node(address) }
+
+// Op returns a logger for messages about the named operation
+func Op(name string) *Logger { return std.Op(name) }
+
+// Pod adds the pod field
+func (l *Logger) Pod(name string) *Logger { return l.With(Fields{FieldPod: name}) }
+
+// Sentinel adds the sentinel field
+func (l *Logger) Sentinel(address string) *Logger {
+	return l.With(Fields{FieldSentinel: address})
+}
+
+// Node adds the node field
+func (l *Logger) Node(address string) *Logger { return l.With(Fields{FieldNode: address}) }
+
+// Op adds the operation field
+func (l *Logger) Op(name string) *Logger { return l.With(Fields{FieldOperation: name}) }
+
+// Job adds the job ID field
+func (l *Logger) Job(id string) *Logger { return l.With(Fields{FieldJob: id}) }
+
+// Err adds the error field
+func (l *Logger) Err(err error) *Logger {
+	if err == nil {
+		return l
+	}
+	return l.With(Fields{FieldError: err.Error()})
+}
+
+// Debugf logs at debug level
+func (l *Logger) Debugf(format string, v ...interface{}) { l.logf(DebugLevel, format, v...) }
+
+// Infof logs at info level
+func (l *Logger) Infof(format string, v ...interface{}) { l.logf(InfoLevel, format, v...) }
+
+// Warnf logs at warn level
+func (l *Logger) Warnf(format string, v ...interface{}) { l.logf(WarnLevel, format, v...) }
+
+// Errorf logs at error level
+func (l *Logger) Errorf(format string, v ...interface{}) { l.logf(ErrorLevel, format, v...) }
+
+// Fatalf logs at fatal level and exits
+func (l *Logger) Fatalf(format string, v ...interface{}) {
+	l.logf(FatalLevel, format, v...)
+	os.Exit(1)
+}
+
+// Debugf logs at debug level
+func Debugf(format string, v ...interface{}) { std.logf(DebugLevel, format, v...) }
+
+// Infof logs at info level
+func Infof(format string, v ...interface{}) { std.logf(InfoLevel, format, v...) }
+
+// Warnf logs at warn level
+func Warnf(format string, v ...interface{}) { std.logf(WarnLevel, format, v...) }
+
+// Errorf logs at error level
+func Errorf(format string, v ...interface{}) { std.logf(ErrorLevel, format, v...) }
+
+// Fatalf logs at fatal level and exits
+func Fatalf(format string, v ...interface{}) {
+	std.logf(FatalLevel, format, v...)
+	os.Exit(1)
+}
+
+// Enabled returns true if messages at level are written, for callers that
+// want to skip building an expensive message
+func Enabled(l Level) bool {
+	return l >= GetLevel()
+}
+
+func (l *Logger) logf(lvl Level, format string, v ...interface{}) {
+	if !Enabled(lvl) {
+		return
+	}
+	l.output(lvl, fmt.Sprintf(format, v...))
+}
+
+func (l *Logger) output(lvl Level, msg string) {
+	now := time.Now()
+	mu.RLock()
+	w, j := out, asJSON
+	mu.RUnlock()
+	var line []byte
+	if j {
+		entry := make(map[string]interface{}, len(l.fields)+3)
+		for k, v := range l.fields {
+			entry[k] = v
+		}
+		entry["time"] = now.Format(time.RFC3339Nano)
+		entry["level"] = lvl.String()
+		entry["msg"] = msg
+		line, _ = json.Marshal(entry)
+	} else {
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s %-5s %s", now.Format("2006/01/02 15:04:05"), strings.ToUpper(lvl.String()), msg)
+		for _, k := range sortedKeys(l.fields) {
+			fmt.Fprintf(&b, " %s=%s", k, quote(fmt.Sprint(l.fields[k])))
+		}
+		line = []byte(b.String())
+	}
+	mu.Lock()
+	w.Write(append(line, '\n'))
+	mu.Unlock()
+}
+
+func sortedKeys(fields Fields) (keys []string) {
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// quote quotes values containing spaces so text output stays parseable
+func quote(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\"=") {
+		return fmt.Sprintf("%q", s)
+	}
+	return s
+}